@@ -0,0 +1,149 @@
+// attach.go - Convenience helpers for adding attachments to a Message from
+// files and readers, so callers do not repeat the read + MIME detection
+// boilerplate, and access to attachment content whether held in memory or
+// streamed.
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AttachFile reads the file at path and appends it to m.Attachments, named
+// after the file's base name.
+//
+// Example:
+//
+//	if err := msg.AttachFile("reports/q3.pdf"); err != nil {
+//	    return err
+//	}
+func (m *Message) AttachFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("attach %s: %w", path, err)
+	}
+	m.attach(filepath.Base(path), content)
+	return nil
+}
+
+// AttachReader reads r to the end and appends its content to m.Attachments
+// as name. The caller remains responsible for closing r.
+func (m *Message) AttachReader(name string, r io.Reader) error {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("attach %s: %w", name, err)
+	}
+	m.attach(name, content)
+	return nil
+}
+
+// AttachStream appends an attachment whose content is read from open when
+// the message is sent (see Attachment.Open), e.g. a large file:
+//
+//	msg.AttachStream("export.csv", func() (io.ReadCloser, error) {
+//	    return os.Open("/var/exports/export.csv")
+//	})
+//
+// The MIME type is detected from the name only.
+func (m *Message) AttachStream(name string, open func() (io.ReadCloser, error)) {
+	m.Attachments = append(m.Attachments, Attachment{
+		Filename: name,
+		Open:     open,
+		MimeType: getContentType(name),
+	})
+}
+
+// open returns a reader over the attachment's content.
+func (a Attachment) open() (io.ReadCloser, error) {
+	if a.Open != nil {
+		return a.Open()
+	}
+	return io.NopCloser(bytes.NewReader(a.Content)), nil
+}
+
+// bytes returns the attachment's content, reading a streamed attachment in
+// full.
+func (a Attachment) bytes() ([]byte, error) {
+	if a.Open == nil {
+		return a.Content, nil
+	}
+	r, err := a.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// hasStreamedAttachments reports whether any attachment uses Open.
+func hasStreamedAttachments(msg *Message) bool {
+	for _, att := range msg.Attachments {
+		if att.Open != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// attach appends an attachment, detecting its MIME type from the name and,
+// for unknown extensions, from the content.
+func (m *Message) attach(name string, content []byte) {
+	m.Attachments = append(m.Attachments, Attachment{
+		Filename: name,
+		Content:  content,
+		MimeType: detectContentType(name, content),
+	})
+}
+
+// detectContentType returns the MIME type for an attachment: by extension
+// where known, otherwise by sniffing the content.
+func detectContentType(name string, content []byte) string {
+	if ct := getContentType(name); ct != "application/octet-stream" {
+		return ct
+	}
+	return http.DetectContentType(content)
+}
+
+// getContentType returns the MIME type based on file extension.
+// It supports common file types and defaults to application/octet-stream
+// for unknown extensions.
+func getContentType(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	switch ext {
+	case ".pdf":
+		return "application/pdf"
+	case ".doc":
+		return "application/msword"
+	case ".docx":
+		return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	case ".xls":
+		return "application/vnd.ms-excel"
+	case ".xlsx":
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case ".png":
+		return "image/png"
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".gif":
+		return "image/gif"
+	case ".txt":
+		return "text/plain"
+	case ".html", ".htm":
+		return "text/html"
+	case ".zip":
+		return "application/zip"
+	case ".csv":
+		return "text/csv"
+	case ".xml":
+		return "application/xml"
+	case ".json":
+		return "application/json"
+	default:
+		return "application/octet-stream"
+	}
+}
@@ -0,0 +1,59 @@
+package email
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMessageAttachFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.pdf")
+	if err := os.WriteFile(path, []byte("%PDF-1.4"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &Message{}
+	if err := msg.AttachFile(path); err != nil {
+		t.Fatalf("AttachFile() error = %v", err)
+	}
+	if len(msg.Attachments) != 1 {
+		t.Fatalf("got %d attachments, want 1", len(msg.Attachments))
+	}
+	att := msg.Attachments[0]
+	if att.Filename != "report.pdf" || att.MimeType != "application/pdf" || string(att.Content) != "%PDF-1.4" {
+		t.Errorf("attachment = %+v", att)
+	}
+
+	if err := msg.AttachFile(filepath.Join(dir, "missing.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("AttachFile(missing) error = %v, want os.ErrNotExist", err)
+	}
+	if len(msg.Attachments) != 1 {
+		t.Errorf("failed AttachFile appended an attachment")
+	}
+}
+
+func TestMessageAttachReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantType string
+	}{
+		{"notes.txt", "hello", "text/plain"},
+		{"page", "<!DOCTYPE html><html></html>", "text/html; charset=utf-8"},
+		{"blob.bin", "\x00\x01\x02", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &Message{}
+			if err := msg.AttachReader(tt.name, strings.NewReader(tt.content)); err != nil {
+				t.Fatalf("AttachReader() error = %v", err)
+			}
+			if got := msg.Attachments[0].MimeType; got != tt.wantType {
+				t.Errorf("MimeType = %q, want %q", got, tt.wantType)
+			}
+		})
+	}
+}
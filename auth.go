@@ -1,3 +1,5 @@
+//go:build !email_no_gmail
+
 // auth.go - Authentication helpers for OAuth2 providers
 package email
 
@@ -0,0 +1,300 @@
+// authresults.go - Sender authentication and spam verdicts of inbound mail.
+// The receiving mail system records its SPF, DKIM and DMARC checks in the
+// Authentication-Results header (RFC 8601) and its spam filter's opinion in
+// headers such as X-Spam-Status or Exchange's X-MS-Exchange-Organization-SCL.
+// ParseMessageAuth turns them into structured fields so automations can
+// quarantine suspicious messages instead of acting on them.
+//
+// Authentication-Results can be forged by the sender like any other header.
+// Only the receiving system's own results are trusted: those carrying one of
+// the given authserv-ids, or by default the topmost one, which the last hop
+// added.
+package email
+
+import (
+	"context"
+	"net/mail"
+	"strconv"
+	"strings"
+)
+
+// AuthResult is the outcome of one authentication method, as named in RFC
+// 8601 ("pass", "fail", "softfail", "neutral", "none", "temperror",
+// "permerror", ...). The zero value means the method was not reported.
+type AuthResult string
+
+// Common authentication results.
+const (
+	AuthPass      AuthResult = "pass"
+	AuthFail      AuthResult = "fail"
+	AuthSoftFail  AuthResult = "softfail"
+	AuthNeutral   AuthResult = "neutral"
+	AuthNone      AuthResult = "none"
+	AuthTempError AuthResult = "temperror"
+	AuthPermError AuthResult = "permerror"
+)
+
+// MessageAuth holds the authentication and spam verdicts of an inbound
+// message.
+type MessageAuth struct {
+	// AuthServID is the authserv-id of the Authentication-Results header
+	// the verdicts were read from (e.g. "mx.google.com"); empty for
+	// Exchange Online, which omits it.
+	AuthServID string
+
+	// SPF, DKIM, DMARC and ARC are the results of each method. DKIM is
+	// "pass" if any signature passed.
+	SPF, DKIM, DMARC, ARC AuthResult
+
+	// SPFDomain is the domain SPF checked (smtp.mailfrom).
+	SPFDomain string
+
+	// DKIMDomain is the signing domain (header.d) of the passing signature,
+	// or of the first one if none passed.
+	DKIMDomain string
+
+	// DMARCDomain is the From domain DMARC evaluated (header.from).
+	DMARCDomain string
+
+	// SpamScore is the spam filter's score (X-Spam-Score, X-Spam-Status
+	// score=), if HasSpamScore.
+	SpamScore    float64
+	HasSpamScore bool
+
+	// SCL is Exchange's spam confidence level, -1 to 9; -2 if absent.
+	// Exchange treats 5 and above as spam.
+	SCL int
+
+	// Spam reports whether a spam filter flagged the message (X-Spam-Flag,
+	// X-Spam-Status, an SCL of 5 or more, or an Exchange SFV:SPM verdict).
+	Spam bool
+}
+
+// sclAbsent is MessageAuth.SCL when no spam confidence level was reported.
+const sclAbsent = -2
+
+// Suspicious reports whether the message should be treated with suspicion:
+// it was flagged as spam, failed DMARC, or failed SPF without a passing DKIM
+// signature.
+func (a *MessageAuth) Suspicious() bool {
+	switch {
+	case a.Spam, a.DMARC == AuthFail:
+		return true
+	case a.SPF == AuthFail && a.DKIM != AuthPass:
+		return true
+	}
+	return false
+}
+
+// ParseMessageAuth extracts the verdicts from a message header. Only
+// Authentication-Results headers with one of the trusted authserv-ids are
+// used; with none given, the topmost Authentication-Results header is.
+//
+// Example:
+//
+//	h, err := client.MessageHeaders(id)
+//	...
+//	if email.ParseMessageAuth(h, "mx.example.com").Suspicious() {
+//	    client.Move(id, "Quarantine")
+//	}
+func ParseMessageAuth(h mail.Header, trusted ...string) *MessageAuth {
+	a := &MessageAuth{SCL: sclAbsent}
+	for _, v := range h["Authentication-Results"] {
+		servID, results := parseAuthResults(v)
+		if !trustedServID(servID, trusted) {
+			continue
+		}
+		a.AuthServID = servID
+		for _, r := range results {
+			a.apply(r)
+		}
+		break
+	}
+	if a.SPF == "" {
+		// Received-SPF: Pass (mailfrom) identity=mailfrom; ...
+		if v := h.Get("Received-SPF"); v != "" {
+			a.SPF = AuthResult(strings.ToLower(strings.Fields(v)[0]))
+		}
+	}
+	a.parseSpam(h)
+	return a
+}
+
+// CheckMessage fetches a message's header and returns its verdicts, trusting
+// Authentication-Results as ParseMessageAuth does, with a default timeout.
+func (c *Client) CheckMessage(id string, trusted ...string) (*MessageAuth, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	return c.CheckMessageWithContext(ctx, id, trusted...)
+}
+
+// CheckMessageWithContext is CheckMessage with a caller-supplied context.
+func (c *Client) CheckMessageWithContext(ctx context.Context, id string, trusted ...string) (*MessageAuth, error) {
+	h, err := c.MessageHeadersWithContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMessageAuth(h, trusted...), nil
+}
+
+// trustedServID reports whether results from servID are trusted; with no
+// trusted ids only the first header is considered, by the caller's loop.
+func trustedServID(servID string, trusted []string) bool {
+	if len(trusted) == 0 {
+		return true
+	}
+	for _, t := range trusted {
+		if strings.EqualFold(servID, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// authResult is one resinfo of an Authentication-Results header.
+type authResult struct {
+	method string
+	result AuthResult
+	props  map[string]string // "smtp.mailfrom", "header.d", ...
+}
+
+// parseAuthResults splits an Authentication-Results value into its
+// authserv-id and results, dropping comments.
+func parseAuthResults(v string) (string, []authResult) {
+	parts := strings.Split(stripComments(v), ";")
+	servID := ""
+	if first := strings.Fields(parts[0]); len(first) > 0 && !strings.Contains(first[0], "=") {
+		servID = first[0]
+		parts = parts[1:]
+	}
+	var out []authResult
+	for _, p := range parts {
+		fields := strings.Fields(p)
+		if len(fields) == 0 {
+			continue
+		}
+		method, result, ok := strings.Cut(fields[0], "=")
+		if !ok {
+			continue // "none": no checks were made
+		}
+		method, _, _ = strings.Cut(method, "/") // "dkim/1" version suffix
+		r := authResult{method: strings.ToLower(method), result: AuthResult(strings.ToLower(result)), props: make(map[string]string)}
+		for _, f := range fields[1:] {
+			if k, v, ok := strings.Cut(f, "="); ok {
+				r.props[strings.ToLower(k)] = strings.Trim(v, `"`)
+			}
+		}
+		out = append(out, r)
+	}
+	return servID, out
+}
+
+// apply records one result.
+func (a *MessageAuth) apply(r authResult) {
+	switch r.method {
+	case "spf":
+		a.SPF = r.result
+		a.SPFDomain = r.props["smtp.mailfrom"]
+		if _, domain, ok := strings.Cut(a.SPFDomain, "@"); ok {
+			a.SPFDomain = domain
+		}
+	case "dkim":
+		if a.DKIM == AuthPass {
+			return
+		}
+		if a.DKIM == "" || r.result == AuthPass {
+			a.DKIM = r.result
+			a.DKIMDomain = r.props["header.d"]
+			if a.DKIMDomain == "" {
+				_, a.DKIMDomain, _ = strings.Cut(r.props["header.i"], "@")
+			}
+		}
+	case "dmarc":
+		a.DMARC = r.result
+		a.DMARCDomain = r.props["header.from"]
+	case "arc":
+		a.ARC = r.result
+	}
+}
+
+// parseSpam reads the common spam filter headers.
+func (a *MessageAuth) parseSpam(h mail.Header) {
+	if strings.EqualFold(strings.TrimSpace(h.Get("X-Spam-Flag")), "yes") {
+		a.Spam = true
+	}
+	if v := h.Get("X-Spam-Score"); v != "" {
+		if score, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			a.SpamScore, a.HasSpamScore = score, true
+		}
+	}
+	// X-Spam-Status: Yes, score=7.1 required=5.0 tests=...
+	if v := h.Get("X-Spam-Status"); v != "" {
+		verdict, rest, _ := strings.Cut(v, ",")
+		if strings.EqualFold(strings.TrimSpace(verdict), "yes") {
+			a.Spam = true
+		}
+		for _, f := range strings.Fields(rest) {
+			if s, ok := strings.CutPrefix(f, "score="); ok && !a.HasSpamScore {
+				if score, err := strconv.ParseFloat(s, 64); err == nil {
+					a.SpamScore, a.HasSpamScore = score, true
+				}
+			}
+		}
+	}
+	if v := h.Get("X-MS-Exchange-Organization-SCL"); v != "" {
+		if scl, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			a.SCL = scl
+		}
+	}
+	// X-Forefront-Antispam-Report: CIP:1.2.3.4;CTRY:;LANG:en;SCL:5;SRV:;SFV:SPM;...
+	for _, f := range strings.Split(h.Get("X-Forefront-Antispam-Report"), ";") {
+		k, v, _ := strings.Cut(strings.TrimSpace(f), ":")
+		switch k {
+		case "SCL":
+			if scl, err := strconv.Atoi(v); err == nil && a.SCL == sclAbsent {
+				a.SCL = scl
+			}
+		case "SFV":
+			if v == "SPM" {
+				a.Spam = true
+			}
+		}
+	}
+	if a.SCL >= 5 {
+		a.Spam = true
+	}
+}
+
+// stripComments removes RFC 5322 comments (nested parentheses) from v,
+// leaving quoted strings alone.
+func stripComments(v string) string {
+	var b strings.Builder
+	depth, quoted := 0, false
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		switch {
+		case c == '\\' && i+1 < len(v) && (depth > 0 || quoted):
+			if depth == 0 {
+				b.WriteByte(c)
+				b.WriteByte(v[i+1])
+			}
+			i++
+			continue
+		case c == '"' && depth == 0:
+			quoted = !quoted
+		case c == '(' && !quoted:
+			depth++
+			continue
+		case c == ')' && !quoted && depth > 0:
+			depth--
+			if depth == 0 {
+				b.WriteByte(' ')
+			}
+			continue
+		}
+		if depth == 0 {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
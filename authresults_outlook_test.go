@@ -0,0 +1,37 @@
+//go:build !email_no_outlook
+
+package email
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestCheckMessage(t *testing.T) {
+	provider := newTestOutlook(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1.0/users/user@example.com/messages/m1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"internetMessageHeaders":[
+			{"name":"Authentication-Results","value":"spf=pass (sender IP is 192.0.2.1) smtp.mailfrom=example.com; dkim=pass header.d=example.com;dmarc=pass action=none header.from=example.com"},
+			{"name":"X-MS-Exchange-Organization-SCL","value":"1"}]}`)
+	})
+	h, err := provider.MessageHeaders(context.Background(), "m1")
+	if err != nil {
+		t.Fatalf("MessageHeaders() error = %v", err)
+	}
+	if h.Get("x-ms-exchange-organization-scl") != "1" {
+		t.Errorf("MessageHeaders() = %v", h)
+	}
+	a, err := (&Client{provider: provider}).CheckMessage("m1")
+	if err != nil {
+		t.Fatalf("CheckMessage() error = %v", err)
+	}
+	if a.DMARC != AuthPass || a.SCL != 1 || a.Suspicious() {
+		t.Errorf("CheckMessage() = %+v", a)
+	}
+}
@@ -0,0 +1,96 @@
+package email
+
+import (
+	"net/mail"
+	"testing"
+)
+
+func TestParseMessageAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  mail.Header
+		trusted []string
+		want    MessageAuth
+		suspect bool
+	}{
+		{
+			name: "gmail pass",
+			header: mail.Header{"Authentication-Results": {"mx.google.com;\r\n       dkim=pass header.i=@example.com header.s=s1 header.b=abc;\r\n" +
+				"       spf=pass (google.com: domain of bounce@example.com designates 192.0.2.1 as permitted sender) smtp.mailfrom=bounce@example.com;\r\n" +
+				"       dmarc=pass (p=REJECT sp=REJECT dis=NONE) header.from=example.com"}},
+			want: MessageAuth{AuthServID: "mx.google.com", SPF: AuthPass, DKIM: AuthPass, DMARC: AuthPass,
+				SPFDomain: "example.com", DKIMDomain: "example.com", DMARCDomain: "example.com", SCL: sclAbsent},
+		},
+		{
+			name: "exchange spoof",
+			header: mail.Header{
+				"Authentication-Results":         {"spf=fail (sender IP is 203.0.113.9) smtp.mailfrom=bank.example; dkim=none (message not signed) header.d=none;dmarc=fail action=quarantine header.from=bank.example;compauth=fail reason=000"},
+				"X-Ms-Exchange-Organization-Scl": {"5"},
+			},
+			want: MessageAuth{SPF: AuthFail, DKIM: AuthNone, DMARC: AuthFail, SPFDomain: "bank.example", DKIMDomain: "none",
+				DMARCDomain: "bank.example", SCL: 5, Spam: true},
+			suspect: true,
+		},
+		{
+			name: "forged header below trusted one",
+			header: mail.Header{"Authentication-Results": {
+				"mx.example.com; spf=softfail smtp.mailfrom=evil.example; dkim=fail header.d=evil.example; dkim=pass header.d=relay.example",
+				"mx.example.com; spf=pass smtp.mailfrom=evil.example; dmarc=pass header.from=evil.example",
+			}},
+			want: MessageAuth{AuthServID: "mx.example.com", SPF: AuthSoftFail, DKIM: AuthPass, SPFDomain: "evil.example",
+				DKIMDomain: "relay.example", SCL: sclAbsent},
+		},
+		{
+			name: "untrusted authserv-id ignored",
+			header: mail.Header{
+				"Authentication-Results": {"mx.evil.example; spf=pass smtp.mailfrom=x.example", "mx.example.com; spf=fail smtp.mailfrom=x.example"},
+			},
+			trusted: []string{"MX.example.com"},
+			want:    MessageAuth{AuthServID: "mx.example.com", SPF: AuthFail, SPFDomain: "x.example", SCL: sclAbsent},
+			suspect: true,
+		},
+		{
+			name: "spamassassin and received-spf",
+			header: mail.Header{
+				"Received-Spf":  {"Pass (mailfrom) identity=mailfrom; client-ip=192.0.2.1"},
+				"X-Spam-Status": {"Yes, score=7.1 required=5.0 tests=BAYES_99 autolearn=no"},
+			},
+			want:    MessageAuth{SPF: AuthPass, SpamScore: 7.1, HasSpamScore: true, Spam: true, SCL: sclAbsent},
+			suspect: true,
+		},
+		{
+			name: "forefront report",
+			header: mail.Header{
+				"X-Forefront-Antispam-Report": {"CIP:192.0.2.1;CTRY:US;LANG:en;SCL:1;SRV:;IPV:NLI;SFV:SPM;H:mail.example;"},
+				"X-Spam-Flag":                 {"NO"},
+				"X-Spam-Score":                {"-0.5"},
+			},
+			want:    MessageAuth{SCL: 1, Spam: true, SpamScore: -0.5, HasSpamScore: true},
+			suspect: true,
+		},
+		{
+			name:   "nothing reported",
+			header: mail.Header{},
+			want:   MessageAuth{SCL: sclAbsent},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseMessageAuth(tt.header, tt.trusted...)
+			if *got != tt.want {
+				t.Errorf("ParseMessageAuth() =\n%+v\nwant\n%+v", *got, tt.want)
+			}
+			if got.Suspicious() != tt.suspect {
+				t.Errorf("Suspicious() = %v, want %v", got.Suspicious(), tt.suspect)
+			}
+		})
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	got := stripComments(`spf=pass (a (nested) comment) smtp.mailfrom="x(y)"; dkim=pass (escaped \) paren) header.d=d`)
+	want := `spf=pass   smtp.mailfrom="x(y)"; dkim=pass   header.d=d`
+	if got != want {
+		t.Errorf("stripComments() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,303 @@
+// batch.go - Sending a set of messages as one unit, such as a campaign or a
+// monthly statement run. SendBatch sends the messages one by one through
+// the Client, so routing, policies and the send budget apply to each, and
+// reports per-message failures instead of stopping at the first. Large
+// batches can require an operator's approval first (Config.BatchApproval),
+// given by a callback or by a token bound to the batch's size, so a
+// fat-fingered launch to the whole customer base stops before the first
+// message goes out.
+package email
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Batch is a set of messages sent together.
+type Batch struct {
+	// ID identifies the batch in approvals and reports, e.g.
+	// "newsletter-2024-10".
+	ID string
+
+	// Messages are sent in order.
+	Messages []*Message
+
+	// ApprovalToken approves the batch when BatchApproval requires it; see
+	// BatchApproval.Token.
+	ApprovalToken string
+}
+
+// BatchSummary describes a batch for approval.
+type BatchSummary struct {
+	ID         string
+	Messages   int
+	Recipients int // To, Cc and Bcc addresses across all messages
+
+	// Subjects are the distinct subjects, most frequent first, at most 5.
+	Subjects []string
+}
+
+// BatchApproval configures the approval gate for large batches.
+type BatchApproval struct {
+	// Threshold is the number of recipients from which a batch needs
+	// approval. Zero requires approval for every batch.
+	Threshold int
+
+	// Approve, if set, is asked to approve batches without a valid
+	// ApprovalToken, e.g. by prompting an operator or checking a change
+	// ticket. A nil error approves the batch; an error refuses it and is
+	// wrapped in the *ApprovalRequiredError returned.
+	Approve func(ctx context.Context, s BatchSummary) error
+
+	// Secret signs approval tokens (see Token). Without it tokens are not
+	// accepted.
+	Secret []byte
+}
+
+// Token returns the token approving a batch with summary s, for an
+// operator tool to hand to the job that sends it. The token is bound to the
+// batch ID and its message and recipient counts: approving 5,000 recipients
+// does not approve 500,000.
+//
+// Example:
+//
+//	// Operator, after reviewing the summary in the error:
+//	token := approval.Token(approvalErr.Summary)
+//	// Job:
+//	batch.ApprovalToken = token
+//	report, err := client.SendBatch(batch)
+func (a *BatchApproval) Token(s BatchSummary) string {
+	mac := hmac.New(sha256.New, a.Secret)
+	mac.Write([]byte(s.ID + "\n" + strconv.Itoa(s.Messages) + "\n" + strconv.Itoa(s.Recipients)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// check approves or refuses the batch summarized by s.
+func (a *BatchApproval) check(ctx context.Context, b *Batch, s BatchSummary) error {
+	if s.Recipients < a.Threshold {
+		return nil
+	}
+	if b.ApprovalToken != "" && len(a.Secret) > 0 && hmac.Equal([]byte(b.ApprovalToken), []byte(a.Token(s))) {
+		return nil
+	}
+	if a.Approve == nil {
+		return &ApprovalRequiredError{Summary: s}
+	}
+	if err := a.Approve(ctx, s); err != nil {
+		return &ApprovalRequiredError{Summary: s, Err: err}
+	}
+	return nil
+}
+
+// ApprovalRequiredError is returned by SendBatch when a batch needs approval
+// and did not get it. Nothing was sent. It matches ErrApprovalRequired with
+// errors.Is.
+type ApprovalRequiredError struct {
+	Summary BatchSummary
+
+	// Err is the Approve callback's refusal, if it was asked.
+	Err error
+}
+
+func (e *ApprovalRequiredError) Error() string {
+	msg := fmt.Sprintf("%s: batch %q of %d messages to %d recipients", ErrApprovalRequired, e.Summary.ID, e.Summary.Messages, e.Summary.Recipients)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is reports whether target is ErrApprovalRequired.
+func (e *ApprovalRequiredError) Is(target error) bool {
+	return target == ErrApprovalRequired
+}
+
+// Hint suggests approving the batch.
+func (e *ApprovalRequiredError) Hint() string {
+	return "approve the batch, or send it with an ApprovalToken from BatchApproval.Token"
+}
+
+// Unwrap returns the Approve callback's error.
+func (e *ApprovalRequiredError) Unwrap() error {
+	return e.Err
+}
+
+// BatchReport is the outcome of SendBatch.
+type BatchReport struct {
+	ID     string
+	Sent   int
+	Failed int
+
+	// Resumed is how many of the Sent messages were sent by an earlier,
+	// interrupted run of the batch and skipped (see Config.BatchStore).
+	Resumed int
+
+	// Unknown is the number of messages an earlier run was interrupted
+	// while sending, or whose send failed with an error wrapping
+	// ErrOutcomeUnknown. They are not resent, and are listed in Errors with
+	// ErrOutcomeUnknown.
+	Unknown int
+
+	// Errors lists the failed messages, those with an unknown outcome and
+	// those sent with an error wrapping ErrPartialSend, which count as Sent.
+	Errors []BatchError
+
+	Start, End time.Time
+}
+
+// BatchError is the failure of one message of a batch.
+type BatchError struct {
+	// Index is the message's position in Batch.Messages.
+	Index int
+	Err   error
+}
+
+// Summarize returns the batch's summary as presented for approval.
+func (b *Batch) Summarize() BatchSummary {
+	s := BatchSummary{ID: b.ID, Messages: len(b.Messages)}
+	subjects := make(map[string]int)
+	for _, m := range b.Messages {
+		s.Recipients += len(m.To) + len(m.Cc) + len(m.Bcc)
+		subjects[m.Subject]++
+	}
+	for subj := range subjects {
+		s.Subjects = append(s.Subjects, subj)
+	}
+	sort.Slice(s.Subjects, func(i, j int) bool {
+		a, b := s.Subjects[i], s.Subjects[j]
+		if subjects[a] != subjects[b] {
+			return subjects[a] > subjects[b]
+		}
+		return a < b
+	})
+	if len(s.Subjects) > 5 {
+		s.Subjects = s.Subjects[:5]
+	}
+	return s
+}
+
+// SendBatch sends the batch's messages in order, after approval if the
+// Client's BatchApproval requires it. Failed messages are recorded in the
+// report and the rest are still sent; the error is non-nil only if the
+// batch was refused (*ApprovalRequiredError), ctx ended, the provider's
+// daily quota ran out (*QuotaExceededError, whose ResetAt says when to send
+// the batch again), a provider blackout outlasted ctx
+// (*SendWindowClosedError), the BatchStore failed or the BatchWebhook could
+// not be delivered; the report covers the messages attempted so far.
+// During a blackout (Config.SendWindows) the remaining messages are held
+// until it ends.
+// There is no overall timeout; each message gets 30 seconds, as with Send.
+//
+// With Config.BatchStore set, progress is recorded per message and sending
+// a batch again with the same ID resumes it: messages already sent are
+// skipped, failed ones are retried and ones whose outcome is unknown (the
+// process died while sending them) are left alone, so nobody gets a
+// message twice. The batch must list the same messages in the same order.
+func (c *Client) SendBatch(b *Batch) (*BatchReport, error) {
+	return c.SendBatchWithContext(context.Background(), b)
+}
+
+// SendBatchWithContext is SendBatch with a caller-supplied context, which
+// bounds the whole batch.
+func (c *Client) SendBatchWithContext(ctx context.Context, b *Batch) (*BatchReport, error) {
+	report := &BatchReport{ID: b.ID, Start: time.Now()}
+	if c.approval != nil {
+		if err := c.approval.check(ctx, b, b.Summarize()); err != nil {
+			report.End = time.Now()
+			return report, err
+		}
+	}
+	var done map[int]BatchStatus
+	if c.batchStore != nil {
+		var err error
+		if done, err = resumeBatch(ctx, c.batchStore, b); err != nil {
+			report.End = time.Now()
+			return report, err
+		}
+	}
+	err := c.sendBatch(ctx, b, done, report)
+	report.End = time.Now()
+	if c.batchHook != nil {
+		if hookErr := c.batchHook.notify(ctx, report, err); err == nil {
+			err = hookErr
+		}
+	}
+	return report, err
+}
+
+// sendBatch sends the messages of b not already done, recording progress
+// in the Client's BatchStore if it has one.
+func (c *Client) sendBatch(ctx context.Context, b *Batch, done map[int]BatchStatus, report *BatchReport) error {
+	record := func(i int, status BatchStatus, sendErr error) error {
+		if c.batchStore == nil {
+			return nil
+		}
+		rec := BatchRecord{Index: i, Recipients: batchRecipients(b.Messages[i]), Status: status, Time: time.Now()}
+		if sendErr != nil {
+			rec.Error = sendErr.Error()
+		}
+		if err := c.batchStore.Append(ctx, b.ID, rec); err != nil {
+			return fmt.Errorf("batch %q: record progress: %w", b.ID, err)
+		}
+		return nil
+	}
+	for i, msg := range b.Messages {
+		switch done[i] {
+		case BatchSent:
+			report.Sent++
+			report.Resumed++
+			continue
+		case BatchPending:
+			report.Unknown++
+			report.Errors = append(report.Errors, BatchError{Index: i, Err: ErrOutcomeUnknown})
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Held, not failed, during a blackout: the rest of the batch goes
+		// out once it ends.
+		if err := c.awaitWindow(ctx, c.route(msg), msg); err != nil {
+			return err
+		}
+		if err := record(i, BatchPending, nil); err != nil {
+			return err
+		}
+		sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err := c.SendWithContext(sendCtx, msg)
+		cancel()
+		status := BatchSent
+		switch {
+		case errors.Is(err, ErrPartialSend):
+			// The message went out; resuming must not send it again.
+			report.Sent++
+			report.Errors = append(report.Errors, BatchError{Index: i, Err: err})
+		case errors.Is(err, ErrOutcomeUnknown):
+			// It may still go out; left pending, resuming skips it.
+			status = BatchPending
+			report.Unknown++
+			report.Errors = append(report.Errors, BatchError{Index: i, Err: err})
+		case err != nil:
+			status = BatchFailed
+			report.Failed++
+			report.Errors = append(report.Errors, BatchError{Index: i, Err: err})
+		default:
+			report.Sent++
+		}
+		if err := record(i, status, err); err != nil {
+			return err
+		}
+		if errors.Is(err, ErrDailyQuotaExceeded) {
+			// Every later message would fail the same way until the reset.
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// testBatch returns a batch of n messages with one recipient each.
+func testBatch(id string, n int) *Batch {
+	b := &Batch{ID: id}
+	for i := 0; i < n; i++ {
+		b.Messages = append(b.Messages, &Message{From: "news@example.com", To: []string{fmt.Sprintf("user%d@example.com", i)},
+			Subject: "October news", Body: "Hello"})
+	}
+	return b
+}
+
+func TestSendBatchReport(t *testing.T) {
+	mock := &mockProvider{sendFunc: func(_ context.Context, msg *Message) error {
+		if msg.To[0] == "user1@example.com" {
+			return errors.New("mailbox full")
+		}
+		return nil
+	}}
+	c := &Client{provider: mock}
+	b := testBatch("b1", 3)
+	b.Messages = append(b.Messages, &Message{From: "news@example.com"}) // invalid
+
+	report, err := c.SendBatchWithContext(context.Background(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ID != "b1" || report.Sent != 2 || report.Failed != 2 || len(report.Errors) != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	if report.Errors[0].Index != 1 || report.Errors[1].Index != 3 {
+		t.Errorf("errors = %+v", report.Errors)
+	}
+}
+
+func TestSendBatchApproval(t *testing.T) {
+	secret := []byte("s3cret")
+	tests := []struct {
+		name     string
+		size     int
+		token    func(a *BatchApproval, b *Batch) string
+		approve  func(context.Context, BatchSummary) error
+		wantErr  bool
+		wantSent int
+	}{
+		{name: "below threshold", size: 2, wantSent: 2},
+		{name: "no approval", size: 5, wantErr: true},
+		{name: "valid token", size: 5, wantSent: 5,
+			token: func(a *BatchApproval, b *Batch) string { return a.Token(b.Summarize()) }},
+		{name: "token for a smaller batch", size: 5, wantErr: true,
+			token: func(a *BatchApproval, b *Batch) string { return a.Token(testBatch(b.ID, 4).Summarize()) }},
+		{name: "callback approves", size: 5, wantSent: 5,
+			approve: func(context.Context, BatchSummary) error { return nil }},
+		{name: "callback refuses", size: 5, wantErr: true,
+			approve: func(context.Context, BatchSummary) error { return errors.New("no change ticket") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			approval := &BatchApproval{Threshold: 3, Secret: secret, Approve: tt.approve}
+			mock := &mockProvider{}
+			c := &Client{provider: mock, approval: approval}
+			b := testBatch("launch", tt.size)
+			if tt.token != nil {
+				b.ApprovalToken = tt.token(approval, b)
+			}
+			report, err := c.SendBatchWithContext(context.Background(), b)
+			if tt.wantErr {
+				var ae *ApprovalRequiredError
+				if !errors.As(err, &ae) || !errors.Is(err, ErrApprovalRequired) {
+					t.Fatalf("err = %v, want *ApprovalRequiredError", err)
+				}
+				if ae.Summary.Recipients != tt.size || ae.Summary.Subjects[0] != "October news" {
+					t.Errorf("summary = %+v", ae.Summary)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if report.Sent != tt.wantSent || len(mock.calls) != tt.wantSent {
+				t.Errorf("sent = %d, calls = %d; want %d", report.Sent, len(mock.calls), tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestSendBatchCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	mock := &mockProvider{sendFunc: func(context.Context, *Message) error {
+		cancel()
+		return nil
+	}}
+	c := &Client{provider: mock}
+	report, err := c.SendBatchWithContext(ctx, testBatch("b", 3))
+	if !errors.Is(err, context.Canceled) || report.Sent != 1 {
+		t.Errorf("err = %v, sent = %d; want context.Canceled after 1", err, report.Sent)
+	}
+}
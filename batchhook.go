@@ -0,0 +1,176 @@
+// batchhook.go - Completion notifications for batches. Orchestration systems
+// (workflow engines, CI pipelines, a campaign UI) that start a batch want to
+// know when it is done without polling: a BatchWebhook posts a signed JSON
+// summary to a URL, calls a function, or both, when SendBatch finishes.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BatchWebhook configures the notification sent when a batch finishes.
+type BatchWebhook struct {
+	// URL, if set, is POSTed the BatchCompletion as JSON.
+	URL string
+
+	// Secret, if set, signs webhook requests: the X-Email-Timestamp header
+	// holds the Unix time of the request and X-Email-Signature
+	// "sha256=" + hex HMAC-SHA256 of the timestamp, ".", and the body. See
+	// VerifyBatchWebhook.
+	Secret []byte
+
+	// ReportURL, if set, returns a link to the batch's detailed report
+	// (e.g. a download of WriteBatchCSV's output), included in the
+	// notification.
+	ReportURL func(id string) string
+
+	// OnComplete, if set, is called with the completion, before the
+	// webhook is posted.
+	OnComplete func(BatchCompletion)
+
+	// HTTPClient posts the webhook. Defaults to a client with a 10 second
+	// timeout.
+	HTTPClient *http.Client
+}
+
+// BatchCompletion is the notification of a finished batch.
+type BatchCompletion struct {
+	ID string `json:"id"`
+
+	// Status is "completed", or "aborted" if the batch stopped early (its
+	// context ended or progress could not be recorded).
+	Status string `json:"status"`
+
+	// Error is why an aborted batch stopped.
+	Error string `json:"error,omitempty"`
+
+	Sent    int `json:"sent"`
+	Failed  int `json:"failed"`
+	Resumed int `json:"resumed"`
+	Unknown int `json:"unknown"`
+
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// ReportURL links to the detailed report, if BatchWebhook.ReportURL is
+	// set.
+	ReportURL string `json:"report_url,omitempty"`
+}
+
+// Batch completion statuses.
+const (
+	BatchCompleted = "completed"
+	BatchAborted   = "aborted"
+)
+
+// Header names of signed webhook requests.
+const (
+	webhookTimestampHeader = "X-Email-Timestamp"
+	webhookSignatureHeader = "X-Email-Signature"
+)
+
+// notify reports the end of a batch. Refused batches never started and are
+// not reported.
+func (h *BatchWebhook) notify(ctx context.Context, report *BatchReport, batchErr error) error {
+	c := BatchCompletion{
+		ID: report.ID, Status: BatchCompleted,
+		Sent: report.Sent, Failed: report.Failed, Resumed: report.Resumed, Unknown: report.Unknown,
+		Start: report.Start, End: report.End,
+	}
+	if batchErr != nil {
+		c.Status, c.Error = BatchAborted, batchErr.Error()
+	}
+	if h.ReportURL != nil {
+		c.ReportURL = h.ReportURL(report.ID)
+	}
+	if h.OnComplete != nil {
+		h.OnComplete(c)
+	}
+	if h.URL == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	// The batch's own context may be what ended it.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(h.Secret) > 0 {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(webhookTimestampHeader, ts)
+		req.Header.Set(webhookSignatureHeader, "sha256="+webhookSignature(h.Secret, ts, body))
+	}
+	client := h.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("batch %q: completion webhook: %w", report.ID, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("batch %q: completion webhook: %s", report.ID, resp.Status)
+	}
+	return nil
+}
+
+// webhookSignature returns the hex HMAC-SHA256 of timestamp "." body.
+func webhookSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyBatchWebhook checks a completion webhook request's signature
+// headers against the body, and that it was signed within maxAge (if
+// positive) to reject replays. Receivers call it before trusting the body.
+//
+// Example:
+//
+//	body, _ := io.ReadAll(r.Body)
+//	if err := email.VerifyBatchWebhook(secret, r.Header, body, 5*time.Minute); err != nil {
+//	    http.Error(w, "bad signature", http.StatusUnauthorized)
+//	    return
+//	}
+func VerifyBatchWebhook(secret []byte, h http.Header, body []byte, maxAge time.Duration) error {
+	ts := h.Get(webhookTimestampHeader)
+	sig, ok := strings.CutPrefix(h.Get(webhookSignatureHeader), "sha256=")
+	if ts == "" || !ok {
+		return errors.New("webhook: missing signature")
+	}
+	if !hmac.Equal([]byte(sig), []byte(webhookSignature(secret, ts, body))) {
+		return errors.New("webhook: signature mismatch")
+	}
+	if maxAge > 0 {
+		sec, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return fmt.Errorf("webhook: invalid timestamp %q", ts)
+		}
+		if age := time.Since(time.Unix(sec, 0)); age > maxAge || age < -maxAge {
+			return fmt.Errorf("webhook: timestamp outside %s", maxAge)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBatchWebhook(t *testing.T) {
+	secret := []byte("hook-secret")
+	var got BatchCompletion
+	var verifyErr error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verifyErr = VerifyBatchWebhook(secret, r.Header, body, time.Minute)
+		json.Unmarshal(body, &got)
+	}))
+	defer srv.Close()
+
+	var called BatchCompletion
+	hook := &BatchWebhook{
+		URL:        srv.URL,
+		Secret:     secret,
+		ReportURL:  func(id string) string { return "https://ops.example.com/batches/" + id + ".csv" },
+		OnComplete: func(c BatchCompletion) { called = c },
+	}
+	mock := &mockProvider{sendFunc: func(_ context.Context, msg *Message) error {
+		if msg.To[0] == "user2@example.com" {
+			return errors.New("rejected")
+		}
+		return nil
+	}}
+	c := &Client{provider: mock, batchHook: hook}
+
+	if _, err := c.SendBatchWithContext(context.Background(), testBatch("oct", 3)); err != nil {
+		t.Fatal(err)
+	}
+	if verifyErr != nil {
+		t.Errorf("signature: %v", verifyErr)
+	}
+	if got.ID != "oct" || got.Status != BatchCompleted || got.Sent != 2 || got.Failed != 1 ||
+		got.ReportURL != "https://ops.example.com/batches/oct.csv" || got.End.IsZero() {
+		t.Errorf("webhook body = %+v", got)
+	}
+	if called.ID != "oct" || called.Sent != 2 {
+		t.Errorf("OnComplete got %+v", called)
+	}
+
+	// An aborted batch is reported too, even though its context has ended.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.SendBatchWithContext(ctx, testBatch("oct-2", 3)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if got.ID != "oct-2" || got.Status != BatchAborted || got.Error == "" {
+		t.Errorf("aborted webhook body = %+v", got)
+	}
+}
+
+func TestBatchWebhookDeliveryFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	c := &Client{provider: &mockProvider{}, batchHook: &BatchWebhook{URL: srv.URL}}
+	report, err := c.SendBatchWithContext(context.Background(), testBatch("b", 1))
+	if err == nil || report.Sent != 1 {
+		t.Errorf("err = %v, sent = %d; want webhook error after 1 sent", err, report.Sent)
+	}
+}
+
+func TestVerifyBatchWebhook(t *testing.T) {
+	secret := []byte("s")
+	body := []byte(`{"id":"x"}`)
+	ts := "1700000000"
+	h := http.Header{}
+	h.Set(webhookTimestampHeader, ts)
+	h.Set(webhookSignatureHeader, "sha256="+webhookSignature(secret, ts, body))
+
+	if err := VerifyBatchWebhook(secret, h, body, 0); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	if err := VerifyBatchWebhook(secret, h, []byte(`{"id":"y"}`), 0); err == nil {
+		t.Error("tampered body: expected error")
+	}
+	if err := VerifyBatchWebhook([]byte("other"), h, body, 0); err == nil {
+		t.Error("wrong secret: expected error")
+	}
+	if err := VerifyBatchWebhook(secret, h, body, time.Minute); err == nil {
+		t.Error("stale timestamp: expected error")
+	}
+	if err := VerifyBatchWebhook(secret, http.Header{}, body, 0); err == nil {
+		t.Error("unsigned: expected error")
+	}
+}
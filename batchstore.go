@@ -0,0 +1,246 @@
+// batchstore.go - Durable batch progress. With Config.BatchStore set,
+// SendBatch records each message's outcome as it goes, so a batch
+// interrupted by a crash or a deploy can be resumed without mailing anyone
+// twice, and a per-recipient report can be produced from the records alone.
+// FileBatchStore keeps one append-only JSON Lines file per batch; other
+// stores (a database table, a key-value store) implement BatchStore.
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BatchStatus is the recorded state of one message of a batch.
+type BatchStatus string
+
+const (
+	// BatchPending is recorded before a message is handed to the provider.
+	// A message whose last record is pending was interrupted mid-send: it
+	// may or may not have gone out.
+	BatchPending BatchStatus = "pending"
+
+	// BatchSent is recorded once the provider accepted the message.
+	BatchSent BatchStatus = "sent"
+
+	// BatchFailed is recorded when the send failed.
+	BatchFailed BatchStatus = "failed"
+)
+
+// BatchRecord is one progress record of a batch.
+type BatchRecord struct {
+	// Index is the message's position in Batch.Messages.
+	Index int `json:"index"`
+
+	// Recipients are the message's To, Cc and Bcc addresses.
+	Recipients []string `json:"recipients"`
+
+	Status BatchStatus `json:"status"`
+	Error  string      `json:"error,omitempty"`
+	Time   time.Time   `json:"time"`
+}
+
+// BatchStore persists batch progress. Implementations must be safe for
+// concurrent use and must not report an Append as done before the record
+// is durable.
+type BatchStore interface {
+	// Append records rec for the batch id.
+	Append(ctx context.Context, id string, rec BatchRecord) error
+
+	// Records returns the batch's records in the order appended, or none
+	// for an unknown batch.
+	Records(ctx context.Context, id string) ([]BatchRecord, error)
+}
+
+// resumeBatch loads the batch's progress from the store and checks it
+// against the batch: resuming a batch whose messages changed order or
+// recipients would skip the wrong people. It returns the last status per
+// message.
+func resumeBatch(ctx context.Context, store BatchStore, b *Batch) (map[int]BatchStatus, error) {
+	records, err := LatestBatchRecords(ctx, store, b.ID)
+	if err != nil {
+		return nil, fmt.Errorf("batch %q: load progress: %w", b.ID, err)
+	}
+	status := make(map[int]BatchStatus, len(records))
+	for _, r := range records {
+		if r.Index >= len(b.Messages) || !equalStrings(r.Recipients, batchRecipients(b.Messages[r.Index])) {
+			return nil, fmt.Errorf("batch %q: message %d does not match the recorded progress", b.ID, r.Index)
+		}
+		status[r.Index] = r.Status
+	}
+	return status, nil
+}
+
+// batchRecipients returns a message's recipients as recorded.
+func batchRecipients(m *Message) []string {
+	out := make([]string, 0, len(m.To)+len(m.Cc)+len(m.Bcc))
+	out = append(out, m.To...)
+	out = append(out, m.Cc...)
+	return append(out, m.Bcc...)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// LatestBatchRecords returns the last record of each message of the batch
+// id, ordered by index: the batch's current per-message status, e.g. for a
+// report after a crash.
+//
+// Example:
+//
+//	records, err := email.LatestBatchRecords(ctx, store, "newsletter-2024-10")
+//	...
+//	err = email.WriteBatchCSV(f, records)
+func LatestBatchRecords(ctx context.Context, store BatchStore, id string) ([]BatchRecord, error) {
+	records, err := store.Records(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[int]BatchRecord)
+	for _, r := range records {
+		latest[r.Index] = r
+	}
+	out := make([]BatchRecord, 0, len(latest))
+	for _, r := range latest {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Index < out[j].Index })
+	return out, nil
+}
+
+// WriteBatchCSV writes records as CSV with a header row and one row per
+// recipient. Times are RFC 3339 in UTC.
+func WriteBatchCSV(w io.Writer, records []BatchRecord) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"index", "recipient", "status", "error", "time"}); err != nil {
+		return err
+	}
+	for _, r := range records {
+		for _, rcpt := range r.Recipients {
+			row := []string{
+				strconv.Itoa(r.Index),
+				rcpt,
+				string(r.Status),
+				r.Error,
+				r.Time.UTC().Format(time.RFC3339),
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// FileBatchStore is a BatchStore keeping each batch's records in a JSON
+// Lines file in a directory. Records are synced to disk as they are
+// appended; lines that do not parse, records torn by a crash, are skipped
+// when reading.
+type FileBatchStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileBatchStore returns a store keeping its files in dir, which is
+// created on first use.
+func NewFileBatchStore(dir string) *FileBatchStore {
+	return &FileBatchStore{dir: dir}
+}
+
+// path returns the file of the batch id.
+func (s *FileBatchStore) path(id string) (string, error) {
+	if id == "" {
+		return "", errors.New("batch id is required")
+	}
+	return filepath.Join(s.dir, url.PathEscape(id)+".jsonl"), nil
+}
+
+// Append implements BatchStore.
+func (s *FileBatchStore) Append(_ context.Context, id string, rec BatchRecord) error {
+	name, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return err
+	}
+	// After a crash mid-write the file ends in a torn record; start a new
+	// line so it does not swallow this one.
+	if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, fi.Size()-1); err == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Records implements BatchStore.
+func (s *FileBatchStore) Records(_ context.Context, id string) ([]BatchRecord, error) {
+	name, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	data, err := os.ReadFile(name)
+	s.mu.Unlock()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []BatchRecord
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var r BatchRecord
+		if json.Unmarshal(sc.Bytes(), &r) != nil {
+			continue // torn by a crash
+		}
+		out = append(out, r)
+	}
+	return out, sc.Err()
+}
@@ -0,0 +1,165 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileBatchStore(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "progress")
+	store := NewFileBatchStore(dir)
+
+	if recs, err := store.Records(ctx, "none"); err != nil || len(recs) != 0 {
+		t.Fatalf("unknown batch: %v, %v", recs, err)
+	}
+	at := time.Date(2024, 10, 16, 9, 0, 0, 0, time.UTC)
+	for _, r := range []BatchRecord{
+		{Index: 0, Recipients: []string{"a@example.com"}, Status: BatchPending, Time: at},
+		{Index: 0, Recipients: []string{"a@example.com"}, Status: BatchSent, Time: at},
+	} {
+		if err := store.Append(ctx, "news/10", r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A crash tears the next record; later appends must survive it.
+	name := filepath.Join(dir, "news%2F10.jsonl")
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"index":1,"recip`)
+	f.Close()
+	if err := store.Append(ctx, "news/10", BatchRecord{Index: 1, Recipients: []string{"b@example.com"}, Status: BatchFailed, Error: "boom", Time: at}); err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := store.Records(ctx, "news/10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 || recs[1].Status != BatchSent || recs[2].Index != 1 || recs[2].Error != "boom" {
+		t.Fatalf("records = %+v", recs)
+	}
+
+	latest, err := LatestBatchRecords(ctx, store, "news/10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := WriteBatchCSV(&b, latest); err != nil {
+		t.Fatal(err)
+	}
+	want := "index,recipient,status,error,time\n" +
+		"0,a@example.com,sent,,2024-10-16T09:00:00Z\n" +
+		"1,b@example.com,failed,boom,2024-10-16T09:00:00Z\n"
+	if b.String() != want {
+		t.Errorf("CSV =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestSendBatchResume(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileBatchStore(t.TempDir())
+	b := testBatch("resume", 5)
+
+	// An earlier run sent message 0, failed message 1 and died while
+	// sending message 2.
+	for _, r := range []BatchRecord{
+		{Index: 0, Status: BatchPending}, {Index: 0, Status: BatchSent},
+		{Index: 1, Status: BatchPending}, {Index: 1, Status: BatchFailed},
+		{Index: 2, Status: BatchPending},
+	} {
+		r.Recipients = batchRecipients(b.Messages[r.Index])
+		if err := store.Append(ctx, b.ID, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mock := &mockProvider{}
+	c := &Client{provider: mock, batchStore: store}
+	report, err := c.SendBatchWithContext(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sentTo []string
+	for _, m := range mock.calls {
+		sentTo = append(sentTo, m.To[0])
+	}
+	if got := strings.Join(sentTo, ","); got != "user1@example.com,user3@example.com,user4@example.com" {
+		t.Errorf("sent to %s", got)
+	}
+	if report.Sent != 4 || report.Resumed != 1 || report.Unknown != 1 || report.Failed != 0 {
+		t.Errorf("report = %+v", report)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Index != 2 || !errors.Is(report.Errors[0].Err, ErrOutcomeUnknown) {
+		t.Errorf("errors = %+v", report.Errors)
+	}
+
+	latest, err := LatestBatchRecords(ctx, store, b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []string
+	for _, r := range latest {
+		statuses = append(statuses, string(r.Status))
+	}
+	if got := strings.Join(statuses, ","); got != "sent,sent,pending,sent,sent" {
+		t.Errorf("statuses = %s", got)
+	}
+
+	// A batch that no longer matches its progress is refused.
+	b.Messages[0].To = []string{"someone-else@example.com"}
+	if _, err := c.SendBatchWithContext(ctx, b); err == nil {
+		t.Error("changed batch: expected error")
+	}
+}
+
+func TestSendBatchResumePartialSend(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileBatchStore(t.TempDir())
+	b := testBatch("partial", 3)
+
+	mock := &mockProvider{}
+	mock.sendFunc = func(_ context.Context, msg *Message) error {
+		switch msg.To[0] {
+		case "user1@example.com":
+			return fmt.Errorf("%w: label it: boom", ErrPartialSend)
+		case "user2@example.com":
+			return fmt.Errorf("%w: poll: timeout", ErrOutcomeUnknown)
+		}
+		return errors.New("down")
+	}
+	c := &Client{provider: mock, batchStore: store}
+	report, err := c.SendBatchWithContext(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Sent != 1 || report.Failed != 1 || report.Unknown != 1 || len(report.Errors) != 3 ||
+		!errors.Is(report.Errors[1].Err, ErrPartialSend) || !errors.Is(report.Errors[2].Err, ErrOutcomeUnknown) {
+		t.Errorf("report = %+v", report)
+	}
+
+	// Resuming retries the failed message only.
+	mock.calls, mock.sendFunc = nil, nil
+	if report, err = c.SendBatchWithContext(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	var sentTo []string
+	for _, m := range mock.calls {
+		sentTo = append(sentTo, m.To[0])
+	}
+	if got := strings.Join(sentTo, ","); got != "user0@example.com" {
+		t.Errorf("resume sent to %s", got)
+	}
+	if report.Sent != 2 || report.Resumed != 1 || report.Unknown != 1 {
+		t.Errorf("resumed report = %+v", report)
+	}
+}
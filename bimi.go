@@ -0,0 +1,410 @@
+// bimi.go - BIMI (Brand Indicators for Message Identification) diagnostics.
+// Inboxes that support BIMI show a sender's logo next to its messages only
+// when every piece is in place: a DMARC policy at enforcement, a BIMI TXT
+// record pointing at an SVG Tiny PS logo and, for Gmail and Apple Mail, a
+// Verified Mark Certificate (VMC) for the logo. None of that is visible when
+// it goes wrong, logos just don't appear, so CheckBIMI walks the chain for a
+// sending domain and reports every problem found.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// bimiMaxLogo is the logo size BIMI implementations accept.
+const bimiMaxLogo = 32 << 10
+
+// bimiMaxVMC caps the VMC download.
+const bimiMaxVMC = 64 << 10
+
+// Object identifiers of VMC certificates.
+var (
+	oidBIMIKeyUsage = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 31}
+	oidLogotype     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 12}
+)
+
+// BIMIChecker checks a domain's BIMI setup. The zero value checks the
+// default selector and downloads the logo and VMC with a 10 second timeout.
+type BIMIChecker struct {
+	// Selector is the BIMI selector to check. Defaults to "default", the
+	// one used unless messages carry a BIMI-Selector header.
+	Selector string
+
+	// SkipAssets checks the DNS records only, without downloading the logo
+	// and certificate.
+	SkipAssets bool
+
+	// HTTPClient downloads the logo and certificate.
+	HTTPClient *http.Client
+
+	// lookupTXT and now are replaced in tests.
+	lookupTXT func(ctx context.Context, name string) ([]string, error)
+	now       func() time.Time
+}
+
+// BIMIReport is the result of a BIMI check.
+type BIMIReport struct {
+	// Domain is the domain checked.
+	Domain string
+
+	// DMARCRecord is the DMARC record that applies to Domain (its own or
+	// its organizational domain's) and DMARCPolicy its effective policy.
+	DMARCRecord string
+	DMARCPolicy string
+
+	// Record is the BIMI record found, with its logo (l=) and authority
+	// evidence (a=) locations.
+	Record       string
+	LogoURL      string
+	AuthorityURL string
+
+	// VMC is the Verified Mark Certificate downloaded from AuthorityURL.
+	VMC *x509.Certificate
+
+	// Problems are the reasons logos will not be displayed; Warnings
+	// are issues that limit where they are displayed.
+	Problems []string
+	Warnings []string
+}
+
+// Ready reports whether no problems were found.
+func (r *BIMIReport) Ready() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *BIMIReport) problem(format string, args ...any) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+func (r *BIMIReport) warn(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// CheckBIMI checks the BIMI setup of a domain, or of an address's domain,
+// with a zero BIMIChecker.
+//
+// Example:
+//
+//	report, err := email.CheckBIMI(ctx, "news@example.com")
+//	if err == nil && !report.Ready() {
+//	    log.Printf("BIMI: %s", strings.Join(report.Problems, "; "))
+//	}
+func CheckBIMI(ctx context.Context, domain string) (*BIMIReport, error) {
+	return (&BIMIChecker{}).Check(ctx, domain)
+}
+
+// Check checks the BIMI setup of domain, which may also be an address. DNS
+// and download failures are reported as problems; the error is non-nil only
+// if ctx ends.
+func (b *BIMIChecker) Check(ctx context.Context, domain string) (*BIMIReport, error) {
+	if strings.Contains(domain, "@") {
+		_, domain, _ = strings.Cut(parseAddr(domain), "@")
+	}
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	r := &BIMIReport{Domain: domain}
+
+	b.checkDMARC(ctx, r)
+	b.checkRecord(ctx, r)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if b.SkipAssets || r.Record == "" {
+		return r, nil
+	}
+	if r.LogoURL != "" {
+		b.checkLogo(ctx, r)
+	}
+	if r.AuthorityURL != "" {
+		b.checkVMC(ctx, r)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (b *BIMIChecker) txt(ctx context.Context, name string) []string {
+	lookup := b.lookupTXT
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupTXT
+	}
+	txts, _ := lookup(ctx, name)
+	return txts
+}
+
+// orgDomain approximates the organizational domain as the last two labels.
+// Public suffixes of more labels (co.uk) make it one label too short, and
+// the lookup there simply finds nothing.
+func orgDomain(domain string) string {
+	labels := strings.Split(domain, ".")
+	if len(labels) <= 2 {
+		return domain
+	}
+	return strings.Join(labels[len(labels)-2:], ".")
+}
+
+// findRecord returns the first TXT record at name starting with version.
+func (b *BIMIChecker) findRecord(ctx context.Context, name, version string) string {
+	for _, txt := range b.txt(ctx, name) {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(txt)), strings.ToLower(version)) {
+			return txt
+		}
+	}
+	return ""
+}
+
+// recordTags parses "k=v; k=v" tags, lowercasing the keys.
+func recordTags(record string) map[string]string {
+	tags := make(map[string]string)
+	for _, field := range strings.Split(record, ";") {
+		if k, v, ok := strings.Cut(field, "="); ok {
+			tags[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		}
+	}
+	return tags
+}
+
+// checkDMARC checks that the domain's DMARC policy is at enforcement, which
+// BIMI requires.
+func (b *BIMIChecker) checkDMARC(ctx context.Context, r *BIMIReport) {
+	org := orgDomain(r.Domain)
+	record := b.findRecord(ctx, "_dmarc."+r.Domain, "v=DMARC1")
+	inherited := false
+	if record == "" && org != r.Domain {
+		record, inherited = b.findRecord(ctx, "_dmarc."+org, "v=DMARC1"), true
+	}
+	if record == "" {
+		r.problem("no DMARC record for %s", r.Domain)
+		return
+	}
+	r.DMARCRecord = record
+	tags := recordTags(record)
+	policy := strings.ToLower(tags["p"])
+	if sp := strings.ToLower(tags["sp"]); inherited && sp != "" {
+		policy = sp
+	}
+	r.DMARCPolicy = policy
+	if policy != "quarantine" && policy != "reject" {
+		r.problem("DMARC policy is %q; BIMI requires quarantine or reject", policy)
+	}
+	if pct, ok := tags["pct"]; ok && pct != "100" {
+		r.problem("DMARC pct=%s; BIMI requires the policy to apply to all mail (pct=100)", pct)
+	}
+}
+
+// checkRecord looks up the BIMI record, falling back to the organizational
+// domain as receivers do.
+func (b *BIMIChecker) checkRecord(ctx context.Context, r *BIMIReport) {
+	selector := b.Selector
+	if selector == "" {
+		selector = "default"
+	}
+	record := b.findRecord(ctx, selector+"._bimi."+r.Domain, "v=BIMI1")
+	if org := orgDomain(r.Domain); record == "" && org != r.Domain {
+		record = b.findRecord(ctx, selector+"._bimi."+org, "v=BIMI1")
+	}
+	if record == "" {
+		r.problem("no BIMI record at %s._bimi.%s", selector, r.Domain)
+		return
+	}
+	r.Record = record
+	tags := recordTags(record)
+	r.LogoURL, r.AuthorityURL = tags["l"], tags["a"]
+	if r.LogoURL == "" {
+		r.problem("BIMI record has no logo location (l=)")
+	} else if !strings.HasPrefix(strings.ToLower(r.LogoURL), "https://") {
+		r.problem("logo location %q is not an https URL", r.LogoURL)
+		r.LogoURL = ""
+	}
+	if r.AuthorityURL == "" {
+		r.warn("no Verified Mark Certificate (a=): Gmail and Apple Mail will not display the logo")
+	} else if !strings.HasPrefix(strings.ToLower(r.AuthorityURL), "https://") {
+		r.problem("authority evidence location %q is not an https URL", r.AuthorityURL)
+		r.AuthorityURL = ""
+	}
+}
+
+// fetch downloads u, at most limit bytes.
+func (b *BIMIChecker) fetch(ctx context.Context, u string, limit int64) ([]byte, error) {
+	client := b.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, limit+1))
+}
+
+// checkLogo downloads the logo and checks it against the SVG Tiny Portable/
+// Secure profile BIMI requires.
+func (b *BIMIChecker) checkLogo(ctx context.Context, r *BIMIReport) {
+	svg, err := b.fetch(ctx, r.LogoURL, bimiMaxLogo)
+	if err != nil {
+		r.problem("logo download failed: %v", err)
+		return
+	}
+	if len(svg) > bimiMaxLogo {
+		r.problem("logo is larger than %d KB", bimiMaxLogo>>10)
+		return
+	}
+	for _, p := range svgTinyPSProblems(svg) {
+		r.problem("logo: %s", p)
+	}
+}
+
+// svgForbidden are elements SVG Tiny PS does not allow.
+var svgForbidden = map[string]bool{
+	"script": true, "image": true, "foreignobject": true, "animate": true, "animatemotion": true,
+	"animatetransform": true, "animatecolor": true, "set": true, "a": true, "video": true, "audio": true,
+}
+
+// svgTinyPSProblems returns the ways svg departs from SVG Tiny PS.
+func svgTinyPSProblems(svg []byte) []string {
+	var problems []string
+	dec := xml.NewDecoder(bytes.NewReader(svg))
+	depth, hasTitle := 0, false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return append(problems, "not well-formed XML: "+err.Error())
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			name := strings.ToLower(t.Name.Local)
+			attrs := make(map[string]string)
+			for _, a := range t.Attr {
+				attrs[strings.ToLower(a.Name.Local)] = a.Value
+			}
+			if depth == 1 {
+				if name != "svg" {
+					return append(problems, "root element is not svg")
+				}
+				if attrs["baseprofile"] != "tiny-ps" {
+					problems = append(problems, `root element lacks baseProfile="tiny-ps"`)
+				}
+				if attrs["version"] != "1.2" {
+					problems = append(problems, `root element lacks version="1.2"`)
+				}
+				if _, ok := attrs["x"]; ok {
+					problems = append(problems, "root element has an x attribute")
+				}
+				if _, ok := attrs["y"]; ok {
+					problems = append(problems, "root element has a y attribute")
+				}
+			}
+			if depth == 2 && name == "title" {
+				hasTitle = true
+			}
+			if svgForbidden[name] {
+				problems = append(problems, fmt.Sprintf("contains a forbidden <%s> element", t.Name.Local))
+			}
+			if href, ok := attrs["href"]; ok && !strings.HasPrefix(href, "#") {
+				problems = append(problems, fmt.Sprintf("references external content %q", href))
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if !hasTitle {
+		problems = append(problems, "has no <title> element")
+	}
+	return problems
+}
+
+// checkVMC downloads the Verified Mark Certificate chain and checks the
+// certificate itself: its BIMI key usage, logotype, validity and that it
+// covers the domain. Whether it chains to a mark verifying authority root is
+// left to the mailbox providers, which keep their own root lists.
+func (b *BIMIChecker) checkVMC(ctx context.Context, r *BIMIReport) {
+	data, err := b.fetch(ctx, r.AuthorityURL, bimiMaxVMC)
+	if err != nil {
+		r.problem("VMC download failed: %v", err)
+		return
+	}
+	var chain []*x509.Certificate
+	for rest := data; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			r.problem("VMC: invalid certificate: %v", err)
+			return
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		r.problem("VMC: no PEM certificate found")
+		return
+	}
+	vmc := chain[0]
+	r.VMC = vmc
+
+	hasUsage := false
+	for _, oid := range vmc.UnknownExtKeyUsage {
+		hasUsage = hasUsage || oid.Equal(oidBIMIKeyUsage)
+	}
+	if !hasUsage {
+		r.problem("VMC: certificate lacks the BIMI extended key usage")
+	}
+	hasLogo := false
+	for _, ext := range vmc.Extensions {
+		hasLogo = hasLogo || ext.Id.Equal(oidLogotype)
+	}
+	if !hasLogo {
+		r.problem("VMC: certificate has no embedded logotype")
+	}
+	now := time.Now
+	if b.now != nil {
+		now = b.now
+	}
+	if t := now(); t.Before(vmc.NotBefore) || t.After(vmc.NotAfter) {
+		r.problem("VMC: certificate is not valid at %s (valid %s to %s)", t.Format(time.DateOnly),
+			vmc.NotBefore.Format(time.DateOnly), vmc.NotAfter.Format(time.DateOnly))
+	} else if left := vmc.NotAfter.Sub(t); left < 30*24*time.Hour {
+		r.warn("VMC: certificate expires in %d days", int(left.Hours()/24))
+	}
+	if vmc.VerifyHostname(r.Domain) != nil && vmc.VerifyHostname(orgDomain(r.Domain)) != nil {
+		r.problem("VMC: certificate does not cover %s", r.Domain)
+	}
+	if len(chain) == 1 {
+		r.warn("VMC: intermediate certificates are missing from %s", r.AuthorityURL)
+	} else if err := vmc.CheckSignatureFrom(chain[1]); err != nil {
+		r.problem("VMC: certificate is not signed by the next certificate in the file: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package email
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBIMILogo = `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" version="1.2" baseProfile="tiny-ps" viewBox="0 0 100 100">
+  <title>Example</title>
+  <circle cx="50" cy="50" r="40" fill="#c00"/>
+</svg>`
+
+// testVMC returns a PEM VMC for domain signed by a test issuer, followed by
+// the issuer.
+func testVMC(t *testing.T, domain string, notAfter time.Time) []byte {
+	t.Helper()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := &x509.Certificate{
+		SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Test Mark CA"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: notAfter.Add(time.Hour),
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ = x509.ParseCertificate(caDER)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	vmc := &x509.Certificate{
+		SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: domain},
+		DNSNames:  []string{domain},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: notAfter,
+		UnknownExtKeyUsage: []asn1.ObjectIdentifier{oidBIMIKeyUsage},
+		ExtraExtensions:    []pkix.Extension{{Id: oidLogotype, Value: []byte{0x30, 0x00}}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, vmc, ca, key.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})...)
+}
+
+func TestCheckBIMI(t *testing.T) {
+	vmc := testVMC(t, "example.com", time.Now().Add(365*24*time.Hour))
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/logo.svg":
+			w.Write([]byte(testBIMILogo))
+		case "/bad.svg":
+			w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>x()</script></svg>`))
+		case "/vmc.pem":
+			w.Write(vmc)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		domain   string
+		records  map[string]string
+		problems []string // substrings, one per expected problem
+		warnings int
+	}{
+		{
+			name:   "ready",
+			domain: "news@example.com",
+			records: map[string]string{
+				"_dmarc.example.com":        "v=DMARC1; p=reject; rua=mailto:d@example.com",
+				"default._bimi.example.com": "v=BIMI1; l=" + srv.URL + "/logo.svg; a=" + srv.URL + "/vmc.pem",
+			},
+		},
+		{
+			name:   "subdomain inherits",
+			domain: "mail.example.com",
+			records: map[string]string{
+				"_dmarc.example.com":        "v=DMARC1; p=none; sp=quarantine",
+				"default._bimi.example.com": "v=BIMI1; l=" + srv.URL + "/logo.svg; a=" + srv.URL + "/vmc.pem",
+			},
+		},
+		{
+			name:   "dmarc not enforced",
+			domain: "example.com",
+			records: map[string]string{
+				"_dmarc.example.com":        "v=DMARC1; p=quarantine; pct=50",
+				"default._bimi.example.com": "v=BIMI1; l=" + srv.URL + "/logo.svg",
+			},
+			problems: []string{"pct=50"},
+			warnings: 1,
+		},
+		{
+			name:     "nothing",
+			domain:   "example.com",
+			records:  map[string]string{},
+			problems: []string{"no DMARC", "no BIMI"},
+		},
+		{
+			name:   "bad assets",
+			domain: "example.com",
+			records: map[string]string{
+				"_dmarc.example.com":        "v=DMARC1; p=reject",
+				"default._bimi.example.com": "v=BIMI1; l=" + srv.URL + "/bad.svg; a=" + srv.URL + "/missing.pem",
+			},
+			problems: []string{"tiny-ps", "version", "<script>", "<title>", "VMC download failed"},
+		},
+		{
+			name:   "http logo",
+			domain: "example.com",
+			records: map[string]string{
+				"_dmarc.example.com":        "v=DMARC1; p=reject",
+				"default._bimi.example.com": "v=BIMI1; l=http://cdn.example.com/logo.svg; a=",
+			},
+			problems: []string{"not an https URL"},
+			warnings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BIMIChecker{
+				HTTPClient: srv.Client(),
+				lookupTXT: func(_ context.Context, name string) ([]string, error) {
+					if r, ok := tt.records[name]; ok {
+						return []string{r}, nil
+					}
+					return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+				},
+			}
+			r, err := b.Check(context.Background(), tt.domain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(r.Problems) != len(tt.problems) || len(r.Warnings) != tt.warnings {
+				t.Fatalf("problems = %q, warnings = %q", r.Problems, r.Warnings)
+			}
+			for i, want := range tt.problems {
+				if !strings.Contains(r.Problems[i], want) {
+					t.Errorf("problem %d = %q, want it to mention %q", i, r.Problems[i], want)
+				}
+			}
+			if r.Ready() != (len(tt.problems) == 0) {
+				t.Errorf("Ready() = %v", r.Ready())
+			}
+		})
+	}
+}
+
+func TestCheckBIMIExpiredVMC(t *testing.T) {
+	vmc := testVMC(t, "other.example", time.Now().Add(10*24*time.Hour))
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(vmc)
+	}))
+	defer srv.Close()
+	b := &BIMIChecker{
+		HTTPClient: srv.Client(),
+		lookupTXT: func(_ context.Context, name string) ([]string, error) {
+			switch name {
+			case "_dmarc.example.com":
+				return []string{"v=DMARC1; p=reject"}, nil
+			case "default._bimi.example.com":
+				return []string{"v=BIMI1; l=; a=" + srv.URL + "/vmc.pem"}, nil
+			}
+			return nil, nil
+		},
+		now: func() time.Time { return time.Now().Add(20 * 24 * time.Hour) },
+	}
+	r, err := b.Check(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"no logo location", "not valid at", "does not cover example.com"}
+	if len(r.Problems) != len(want) {
+		t.Fatalf("problems = %q", r.Problems)
+	}
+	for i, w := range want {
+		if !strings.Contains(r.Problems[i], w) {
+			t.Errorf("problem %d = %q, want %q", i, r.Problems[i], w)
+		}
+	}
+}
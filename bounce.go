@@ -0,0 +1,254 @@
+// bounce.go - Bounce classification. Providers and receiving servers word
+// their non-delivery reports differently; a BounceClassifier maps the SMTP
+// reply code, enhanced status code (RFC 3463) and free text of a bounce onto
+// a small set of normalized reasons. Rules are data, not code: they can be
+// loaded from JSON (LoadBounceRules) and extended or reordered without a
+// release. DefaultBounceRules covers the common Outlook, Gmail, Exchange and
+// Postfix phrasings.
+package email
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// BounceReason is a normalized bounce cause.
+type BounceReason string
+
+// Normalized bounce reasons.
+const (
+	BounceUnknown         BounceReason = "unknown"
+	BounceUserUnknown     BounceReason = "user_unknown"
+	BounceMailboxFull     BounceReason = "mailbox_full"
+	BounceMailboxDisabled BounceReason = "mailbox_disabled"
+	BounceDomainNotFound  BounceReason = "domain_not_found"
+	BounceMessageTooLarge BounceReason = "message_too_large"
+	BounceAuthFailure     BounceReason = "auth_failure"
+	BounceBlocked         BounceReason = "blocked"
+	BounceTemporary       BounceReason = "temporary"
+)
+
+// BounceRule maps SMTP codes and/or a text pattern to a reason. A rule
+// matches when any of its Codes matches the bounce's codes or its Pattern
+// matches the text; rules are tried in order and the first match wins.
+type BounceRule struct {
+	// Name identifies the rule in Bounce.Rule, for debugging rule sets.
+	Name string `json:"name"`
+
+	// Codes are basic ("550") or enhanced ("5.1.1") status codes. A "*"
+	// matches any run of characters, so "5.7.*" covers every policy status
+	// and "4*" every transient reply.
+	Codes []string `json:"codes,omitempty"`
+
+	// Pattern is a regular expression (RE2 syntax) matched against the bounce
+	// text. Prefix it with (?i) for case-insensitive matching.
+	Pattern string `json:"pattern,omitempty"`
+
+	// Reason is the normalized reason reported for a match.
+	Reason BounceReason `json:"reason"`
+
+	// Hard marks the failure as permanent: the address should be suppressed
+	// rather than retried.
+	Hard bool `json:"hard"`
+}
+
+// Bounce is the classification of one bounce text.
+type Bounce struct {
+	// Reason is the normalized cause, BounceUnknown if no rule matched.
+	Reason BounceReason
+
+	// Hard reports a permanent failure: the matching rule's Hard, never set
+	// for a transient (4.x.x / 4xx) status. For unmatched bounces it follows
+	// the status class.
+	Hard bool
+
+	// Code and Status are the first basic and enhanced status codes found in
+	// the text, if any.
+	Code   string
+	Status string
+
+	// Rule is the Name of the matching rule, empty if none matched.
+	Rule string
+}
+
+// compiledBounceRule is a BounceRule with its pattern compiled.
+type compiledBounceRule struct {
+	BounceRule
+	re *regexp.Regexp
+}
+
+// BounceClassifier classifies bounce texts with an ordered rule set. It is
+// immutable after construction and safe for concurrent use.
+type BounceClassifier struct {
+	rules []compiledBounceRule
+}
+
+// NewBounceClassifier compiles rules into a classifier. Pass
+// DefaultBounceRules(), optionally with custom rules prepended so they take
+// precedence. A rule needs a Reason and at least one of Codes or Pattern.
+func NewBounceClassifier(rules []BounceRule) (*BounceClassifier, error) {
+	c := &BounceClassifier{rules: make([]compiledBounceRule, 0, len(rules))}
+	for i, r := range rules {
+		if r.Reason == "" {
+			return nil, fmt.Errorf("bounce rule %d (%s): reason is required", i, r.Name)
+		}
+		if len(r.Codes) == 0 && r.Pattern == "" {
+			return nil, fmt.Errorf("bounce rule %d (%s): codes or pattern is required", i, r.Name)
+		}
+		for _, code := range r.Codes {
+			if _, err := path.Match(code, ""); err != nil {
+				return nil, fmt.Errorf("bounce rule %d (%s): invalid code %q: %w", i, r.Name, code, err)
+			}
+		}
+		cr := compiledBounceRule{BounceRule: r}
+		if r.Pattern != "" {
+			re, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("bounce rule %d (%s): %w", i, r.Name, err)
+			}
+			cr.re = re
+		}
+		c.rules = append(c.rules, cr)
+	}
+	return c, nil
+}
+
+// LoadBounceRules reads a JSON array of rules, e.g. from a config file:
+//
+//	[{"name": "legacy-quota", "pattern": "(?i)quota", "reason": "mailbox_full"}]
+func LoadBounceRules(r io.Reader) ([]BounceRule, error) {
+	var rules []BounceRule
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("invalid bounce rules: %w", err)
+	}
+	return rules, nil
+}
+
+var (
+	// bounceStatusRe finds an RFC 3463 enhanced status code.
+	bounceStatusRe = regexp.MustCompile(`\b([245]\.\d{1,3}\.\d{1,3})\b`)
+
+	// bounceCodeRe finds a basic SMTP reply code at a word boundary.
+	bounceCodeRe = regexp.MustCompile(`\b([245]\d\d)\b`)
+)
+
+// Classify returns the classification of a bounce text, such as a
+// diagnostic code from a DSN or the error of a failed SMTP transaction.
+func (c *BounceClassifier) Classify(text string) Bounce {
+	var b Bounce
+	if m := bounceStatusRe.FindStringSubmatch(text); m != nil {
+		b.Status = m[1]
+	}
+	// Skip digits that belong to the enhanced status itself ("5.5.0 550").
+	if m := bounceCodeRe.FindStringSubmatch(bounceStatusRe.ReplaceAllString(text, " ")); m != nil {
+		b.Code = m[1]
+	}
+
+	for _, r := range c.rules {
+		if r.matchesCode(b.Code, b.Status) || (r.re != nil && r.re.MatchString(text)) {
+			// A transient (4xx) reply is never a permanent failure, whatever
+			// the text says: the server asked for a retry.
+			b.Reason, b.Hard, b.Rule = r.Reason, r.Hard && !b.transient(), r.Name
+			return b
+		}
+	}
+
+	b.Reason = BounceUnknown
+	b.Hard = strings.HasPrefix(b.class(), "5")
+	return b
+}
+
+// class returns the status class digit source: the enhanced status if
+// present, else the basic code.
+func (b Bounce) class() string {
+	if b.Status != "" {
+		return b.Status
+	}
+	return b.Code
+}
+
+// transient reports a 4xx / 4.x.x status.
+func (b Bounce) transient() bool {
+	return strings.HasPrefix(b.class(), "4")
+}
+
+// matchesCode reports whether one of the rule's codes matches the basic code
+// or the enhanced status.
+func (r compiledBounceRule) matchesCode(code, status string) bool {
+	for _, p := range r.Codes {
+		for _, v := range []string{code, status} {
+			if v == "" {
+				continue
+			}
+			if ok, _ := path.Match(p, v); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DefaultBounceRules returns the built-in rule set. Specific causes come
+// before the broad policy and transient catch-alls, so append custom
+// catch-alls rather than prepending them.
+func DefaultBounceRules() []BounceRule {
+	return []BounceRule{
+		{
+			Name:    "mailbox-full",
+			Codes:   []string{"4.2.2", "5.2.2"},
+			Pattern: `(?i)mailbox (is )?full|over ?quota|quota exceeded|insufficient (system )?storage`,
+			Reason:  BounceMailboxFull,
+		},
+		{
+			Name:    "message-too-large",
+			Codes:   []string{"5.3.4", "5.2.3"},
+			Pattern: `(?i)message (size )?(exceeds|is too (large|big))|size limit`,
+			Reason:  BounceMessageTooLarge,
+			Hard:    true,
+		},
+		{
+			Name:    "mailbox-disabled",
+			Codes:   []string{"5.2.1"},
+			Pattern: `(?i)(account|mailbox) (is )?(disabled|inactive|suspended)`,
+			Reason:  BounceMailboxDisabled,
+			Hard:    true,
+		},
+		{
+			Name:    "user-unknown",
+			Codes:   []string{"5.1.1", "5.1.10", "5.1.6"},
+			Pattern: `(?i)user unknown|no such (user|recipient|mailbox)|does not exist|unknown (user|recipient)|recipient not found|RecipientNotFound|address (not found|rejected)|invalid recipient`,
+			Reason:  BounceUserUnknown,
+			Hard:    true,
+		},
+		{
+			Name:    "domain-not-found",
+			Codes:   []string{"5.1.2", "5.4.4", "5.4.310"},
+			Pattern: `(?i)(host|domain)( name)? not found|unrouteable|no mx|nxdomain|DNS domain .* does not exist`,
+			Reason:  BounceDomainNotFound,
+			Hard:    true,
+		},
+		{
+			Name:    "auth-failure",
+			Codes:   []string{"5.7.23", "5.7.25", "5.7.26", "5.7.27"},
+			Pattern: `(?i)\b(dmarc|spf|dkim)\b|unauthenticated (email|sender)`,
+			Reason:  BounceAuthFailure,
+			Hard:    true,
+		},
+		{
+			Name:    "blocked",
+			Codes:   []string{"5.7.*"},
+			Pattern: `(?i)spam|block ?list|black ?list|blocked|denied by policy|poor reputation|spamhaus`,
+			Reason:  BounceBlocked,
+			Hard:    true,
+		},
+		{
+			Name:   "temporary",
+			Codes:  []string{"4*"},
+			Reason: BounceTemporary,
+		},
+	}
+}
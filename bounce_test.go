@@ -0,0 +1,114 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBounceClassify(t *testing.T) {
+	c, err := NewBounceClassifier(DefaultBounceRules())
+	if err != nil {
+		t.Fatalf("NewBounceClassifier() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		text   string
+		reason BounceReason
+		hard   bool
+		code   string
+		status string
+	}{
+		{
+			name:   "gmail user unknown",
+			text:   "550 5.1.1 The email account that you tried to reach does not exist.",
+			reason: BounceUserUnknown, hard: true, code: "550", status: "5.1.1",
+		},
+		{
+			name:   "exchange recipient not found",
+			text:   "Remote Server returned '550 5.1.10 RESOLVER.ADR.RecipientNotFound; Recipient not found by SMTP address lookup'",
+			reason: BounceUserUnknown, hard: true, code: "550", status: "5.1.10",
+		},
+		{
+			name:   "mailbox full by text only",
+			text:   "552 Mailbox is full",
+			reason: BounceMailboxFull, hard: false, code: "552",
+		},
+		{
+			name:   "dmarc rejection",
+			text:   "550 5.7.26 Unauthenticated email from example.com is not accepted due to domain's DMARC policy",
+			reason: BounceAuthFailure, hard: true, code: "550", status: "5.7.26",
+		},
+		{
+			name:   "policy block",
+			text:   "554 5.7.1 Service unavailable; Client host [192.0.2.1] blocked using zen.spamhaus.org",
+			reason: BounceBlocked, hard: true, code: "554", status: "5.7.1",
+		},
+		{
+			name:   "greylisting is never hard",
+			text:   "450 4.7.1 Client host blocked temporarily, try again later",
+			reason: BounceBlocked, hard: false, code: "450", status: "4.7.1",
+		},
+		{
+			name:   "generic transient",
+			text:   "421 4.4.2 Connection dropped",
+			reason: BounceTemporary, hard: false, code: "421", status: "4.4.2",
+		},
+		{
+			name:   "unmatched permanent",
+			text:   "554 5.0.0 Something odd happened",
+			reason: BounceUnknown, hard: true, code: "554", status: "5.0.0",
+		},
+		{
+			name:   "no codes",
+			text:   "delivery failed",
+			reason: BounceUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.Classify(tt.text)
+			if got.Reason != tt.reason || got.Hard != tt.hard || got.Code != tt.code || got.Status != tt.status {
+				t.Errorf("Classify() = %+v, want reason=%s hard=%v code=%q status=%q",
+					got, tt.reason, tt.hard, tt.code, tt.status)
+			}
+		})
+	}
+}
+
+func TestLoadBounceRulesPrecedence(t *testing.T) {
+	custom, err := LoadBounceRules(strings.NewReader(
+		`[{"name": "legacy-vacation", "pattern": "(?i)on vacation", "reason": "temporary"}]`))
+	if err != nil {
+		t.Fatalf("LoadBounceRules() error = %v", err)
+	}
+	c, err := NewBounceClassifier(append(custom, DefaultBounceRules()...))
+	if err != nil {
+		t.Fatalf("NewBounceClassifier() error = %v", err)
+	}
+
+	got := c.Classify("550 5.1.1 user is on vacation")
+	if got.Reason != BounceTemporary || got.Rule != "legacy-vacation" || got.Hard {
+		t.Errorf("Classify() = %+v, want custom rule to win", got)
+	}
+}
+
+func TestNewBounceClassifierErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule BounceRule
+	}{
+		{"no reason", BounceRule{Name: "r", Pattern: "x"}},
+		{"no match criteria", BounceRule{Name: "r", Reason: BounceBlocked}},
+		{"bad regexp", BounceRule{Name: "r", Pattern: "(", Reason: BounceBlocked}},
+		{"bad code glob", BounceRule{Name: "r", Codes: []string{"5.[1"}, Reason: BounceBlocked}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewBounceClassifier([]BounceRule{tt.rule}); err == nil {
+				t.Error("NewBounceClassifier() succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+// budget.go - A hard cap on the number of messages a Client sends, as a last
+// line of defense against a bug mass-mailing customers: a loop without an
+// exit, a job scheduled every second instead of every day. Unlike rate
+// limiting, which delays sends, an exhausted budget fails them with a
+// *BudgetExceededError, and with Latch set it stays shut until an operator
+// calls ResetSendBudget.
+package email
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SendBudget configures a Client's hard send cap. Limits count send
+// attempts, successful or not, over sliding windows with minute
+// granularity; zero leaves a window unlimited.
+type SendBudget struct {
+	// PerHour is the maximum number of messages in any 60 minutes.
+	PerHour int
+
+	// PerDay is the maximum number of messages in any 24 hours.
+	PerDay int
+
+	// Latch turns the budget into a kill switch: once a limit is hit, every
+	// send fails until ResetSendBudget is called, even after the window has
+	// moved on.
+	Latch bool
+
+	// OnExceeded, if set, is called for every refused send, e.g. to page
+	// whoever owns the sending job.
+	OnExceeded func(*BudgetExceededError)
+}
+
+// BudgetExceededError is returned by Send when the Client's SendBudget is
+// exhausted. Nothing is sent. It matches ErrBudgetExceeded with errors.Is.
+type BudgetExceededError struct {
+	// Window is the exhausted window: "hour" or "day".
+	Window string
+
+	// Limit is the configured limit of Window.
+	Limit int
+
+	// Latched reports whether the budget has latched shut; sending resumes
+	// only after ResetSendBudget.
+	Latched bool
+
+	// RetryAfter is how long until the window has room again; zero when
+	// Latched.
+	RetryAfter time.Duration
+}
+
+func (e *BudgetExceededError) Error() string {
+	if e.Latched {
+		return fmt.Sprintf("%s: %d messages per %s; sending disabled until reset", ErrBudgetExceeded, e.Limit, e.Window)
+	}
+	return fmt.Sprintf("%s: %d messages per %s; retry after %s", ErrBudgetExceeded, e.Limit, e.Window, e.RetryAfter)
+}
+
+// Is reports whether target is ErrBudgetExceeded.
+func (e *BudgetExceededError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+// Hint suggests waiting, or resetting a latched budget.
+func (e *BudgetExceededError) Hint() string {
+	if e.Latched {
+		return "find out why the budget ran out before calling ResetSendBudget; a runaway job may be sending"
+	}
+	return fmt.Sprintf("retry after %s, or raise the SendBudget limit if the volume is expected", e.RetryAfter)
+}
+
+// budgetSlots is the number of one-minute slots tracked: one day.
+const budgetSlots = 24 * 60
+
+// sendBudget is a SendBudget's state.
+type sendBudget struct {
+	config SendBudget
+	now    func() time.Time
+
+	mu      sync.Mutex
+	counts  [budgetSlots]int   // sends per minute, indexed by minute % budgetSlots
+	minutes [budgetSlots]int64 // the minute each slot counts, to expire stale ones
+	tripped *BudgetExceededError
+}
+
+func newSendBudget(config *SendBudget) (*sendBudget, error) {
+	if config.PerHour < 0 || config.PerDay < 0 {
+		return nil, fmt.Errorf("invalid send budget: limits must not be negative")
+	}
+	return &sendBudget{config: *config, now: time.Now}, nil
+}
+
+// take reserves one send, or returns the *BudgetExceededError refusing it.
+func (b *sendBudget) take() error {
+	b.mu.Lock()
+	e, onExceeded := b.takeLocked(), b.config.OnExceeded
+	b.mu.Unlock()
+	if e == nil {
+		return nil
+	}
+	if onExceeded != nil {
+		onExceeded(e)
+	}
+	return e
+}
+
+func (b *sendBudget) takeLocked() *BudgetExceededError {
+	if b.tripped != nil {
+		e := *b.tripped
+		return &e
+	}
+	minute := b.now().Unix() / 60
+	for _, w := range []struct {
+		name    string
+		limit   int
+		minutes int64
+	}{{"hour", b.config.PerHour, 60}, {"day", b.config.PerDay, budgetSlots}} {
+		if w.limit == 0 {
+			continue
+		}
+		used, oldest := 0, int64(-1)
+		for m := minute - w.minutes + 1; m <= minute; m++ {
+			if n := b.countAt(m); n > 0 {
+				used += n
+				if oldest < 0 {
+					oldest = m
+				}
+			}
+		}
+		if used < w.limit {
+			continue
+		}
+		e := &BudgetExceededError{Window: w.name, Limit: w.limit}
+		if b.config.Latch {
+			e.Latched = true
+			b.tripped = e
+			c := *e
+			return &c
+		}
+		// Room frees up when the oldest counted minute leaves the window.
+		e.RetryAfter = time.Unix((oldest+w.minutes)*60, 0).Sub(b.now())
+		return e
+	}
+	slot := minute % budgetSlots
+	if b.minutes[slot] != minute {
+		b.minutes[slot], b.counts[slot] = minute, 0
+	}
+	b.counts[slot]++
+	return nil
+}
+
+// countAt returns the sends counted in minute m.
+func (b *sendBudget) countAt(m int64) int {
+	slot := m % budgetSlots
+	if b.minutes[slot] != m {
+		return 0
+	}
+	return b.counts[slot]
+}
+
+// reset clears the counts and an open latch.
+func (b *sendBudget) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.counts = [budgetSlots]int{}
+	b.minutes = [budgetSlots]int64{}
+	b.tripped = nil
+}
+
+// setLimits replaces the budget's limits and latch setting, as reloaded
+// from the config files, keeping the sends counted so far and OnExceeded.
+func (b *sendBudget) setLimits(config SendBudget) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if config.OnExceeded == nil {
+		config.OnExceeded = b.config.OnExceeded
+	}
+	b.config = config
+}
+
+// ResetSendBudget re-enables a Client whose SendBudget has latched shut and
+// forgets the sends counted so far. It does nothing for a Client without a
+// budget.
+func (c *Client) ResetSendBudget() {
+	if b := c.sendLimits(); b != nil {
+		b.reset()
+	}
+}
+
+// sendLimits returns the client's send budget, nil if it has none.
+func (c *Client) sendLimits() *sendBudget {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.budget
+}
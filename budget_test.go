@@ -0,0 +1,136 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSendBudget(t *testing.T) {
+	start := time.Date(2024, 10, 16, 12, 0, 30, 0, time.UTC)
+	tests := []struct {
+		name   string
+		budget SendBudget
+		// sends at the given offsets from start; want reports which succeed
+		at   []time.Duration
+		want []bool
+	}{
+		{
+			name:   "hourly limit",
+			budget: SendBudget{PerHour: 2},
+			at:     []time.Duration{0, time.Minute, 2 * time.Minute, 60 * time.Minute, 61 * time.Minute, 62 * time.Minute},
+			want:   []bool{true, true, false, true, true, false},
+		},
+		{
+			name:   "daily limit",
+			budget: SendBudget{PerHour: 10, PerDay: 3},
+			at:     []time.Duration{0, 2 * time.Hour, 4 * time.Hour, 6 * time.Hour, 24 * time.Hour},
+			want:   []bool{true, true, true, false, true},
+		},
+		{
+			name:   "latch",
+			budget: SendBudget{PerHour: 1, Latch: true},
+			at:     []time.Duration{0, time.Minute, 3 * time.Hour},
+			want:   []bool{true, false, false},
+		},
+		{
+			name:   "unlimited",
+			budget: SendBudget{},
+			at:     []time.Duration{0, 0, 0},
+			want:   []bool{true, true, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := newSendBudget(&tt.budget)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, at := range tt.at {
+				b.now = func() time.Time { return start.Add(at) }
+				err := b.take()
+				if (err == nil) != tt.want[i] {
+					t.Errorf("send %d at +%s: err = %v, want ok = %v", i, at, err, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSendBudgetRetryAfter(t *testing.T) {
+	start := time.Date(2024, 10, 16, 12, 0, 0, 0, time.UTC)
+	b, _ := newSendBudget(&SendBudget{PerHour: 1})
+	b.now = func() time.Time { return start }
+	if err := b.take(); err != nil {
+		t.Fatal(err)
+	}
+	b.now = func() time.Time { return start.Add(20 * time.Minute) }
+	var be *BudgetExceededError
+	if err := b.take(); !errors.As(err, &be) {
+		t.Fatalf("err = %v, want *BudgetExceededError", err)
+	}
+	if be.Window != "hour" || be.Limit != 1 || be.RetryAfter != 40*time.Minute {
+		t.Errorf("error = %+v", be)
+	}
+}
+
+func TestClientSendBudget(t *testing.T) {
+	var exceeded int
+	budget, err := newSendBudget(&SendBudget{PerHour: 1, Latch: true, OnExceeded: func(*BudgetExceededError) { exceeded++ }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := &mockProvider{}
+	c := &Client{provider: mock, budget: budget}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+
+	if err := c.SendWithContext(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	err = c.SendWithContext(context.Background(), msg)
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("err = %v, want ErrBudgetExceeded", err)
+	}
+	if len(mock.calls) != 1 || exceeded != 1 {
+		t.Errorf("calls = %d, exceeded = %d; want 1, 1", len(mock.calls), exceeded)
+	}
+
+	c.ResetSendBudget()
+	if err := c.SendWithContext(context.Background(), msg); err != nil {
+		t.Errorf("after reset: %v", err)
+	}
+}
+
+// rejectingSealer is a messageSealer that cannot seal any message.
+type rejectingSealer struct{}
+
+func (rejectingSealer) check(*Message) error { return errors.New("no certificate for the sender") }
+
+func (rejectingSealer) write(io.Writer, *Message, rawOptions) error { return nil }
+
+func TestClientSendBudgetAfterPrepare(t *testing.T) {
+	budget, err := newSendBudget(&SendBudget{PerHour: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := &mockProvider{}
+	c := &Client{provider: mock, budget: budget, sealer: rejectingSealer{}}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+
+	if err := c.SendWithContext(context.Background(), msg); err == nil || errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("err = %v, want the sealer's error", err)
+	}
+	// The rejected message did not use up the budget.
+	c.sealer = nil
+	if err := c.SendWithContext(context.Background(), msg); err != nil {
+		t.Errorf("send after a rejected message: %v", err)
+	}
+}
+
+func TestSendBudgetRejectsNegativeLimits(t *testing.T) {
+	if _, err := newSendBudget(&SendBudget{PerDay: -1}); err == nil {
+		t.Error("expected error for negative limit")
+	}
+}
@@ -0,0 +1,232 @@
+// complaint.go - Feedback loop (FBL) complaint processing. Mailbox providers
+// report "this is spam" clicks as ARF messages (RFC 5965): a multipart/report
+// carrying a machine-readable message/feedback-report part and a copy of the
+// original message or its headers. ParseComplaint decodes one; Events and
+// ProcessComplaint turn it into suppression events so complaining recipients
+// are not mailed again.
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Complaint is a parsed ARF feedback report.
+type Complaint struct {
+	// FeedbackType is the report type: "abuse", "fraud", "virus", "other" or
+	// "not-spam".
+	FeedbackType string
+
+	// UserAgent and Version identify the generator of the report.
+	UserAgent string
+	Version   string
+
+	// OriginalMailFrom and OriginalRcptTo are the envelope addresses of the
+	// reported message. Many providers redact OriginalRcptTo.
+	OriginalMailFrom string
+	OriginalRcptTo   []string
+
+	// ArrivalDate is when the reporter received the original message.
+	ArrivalDate time.Time
+
+	// ReportingMTA and SourceIP describe where the report came from and the
+	// IP the original message was received from.
+	ReportingMTA string
+	SourceIP     string
+
+	// OriginalHeaders are the headers of the reported message, if included.
+	OriginalHeaders mail.Header
+}
+
+// Recipients returns the complaining addresses: OriginalRcptTo, or the To
+// header of the included original when the envelope recipient is redacted.
+func (c *Complaint) Recipients() []string {
+	var out []string
+	for _, r := range c.OriginalRcptTo {
+		if a := parseAddr(r); a != "" {
+			out = append(out, a)
+		}
+	}
+	if len(out) > 0 || c.OriginalHeaders == nil {
+		return out
+	}
+	return splitAddrs(c.OriginalHeaders.Get("To"))
+}
+
+// OriginalMessageID returns the Message-ID of the reported message, without
+// angle brackets, or "" if the original headers were not included.
+func (c *Complaint) OriginalMessageID() string {
+	if c.OriginalHeaders == nil {
+		return ""
+	}
+	return strings.Trim(strings.TrimSpace(c.OriginalHeaders.Get("Message-Id")), "<>")
+}
+
+// SuppressionEvent records that an address must no longer be mailed.
+type SuppressionEvent struct {
+	// Address is the recipient to suppress.
+	Address string
+
+	// Reason is why, e.g. "complaint".
+	Reason string
+
+	// FeedbackType is the ARF feedback type of a complaint.
+	FeedbackType string
+
+	// MessageID is the Message-ID of the message that triggered the event,
+	// if known.
+	MessageID string
+
+	// Time is when the triggering message arrived, or when the event was
+	// created if unknown.
+	Time time.Time
+}
+
+// SuppressionSink receives suppression events, e.g. to add them to a
+// suppression list or database.
+type SuppressionSink interface {
+	Suppress(ctx context.Context, ev SuppressionEvent) error
+}
+
+// Events returns one suppression event per complaining recipient. A
+// "not-spam" report is a retraction, not a complaint, and yields none.
+func (c *Complaint) Events() []SuppressionEvent {
+	if strings.EqualFold(c.FeedbackType, "not-spam") {
+		return nil
+	}
+	when := c.ArrivalDate
+	if when.IsZero() {
+		when = time.Now()
+	}
+	rcpts := c.Recipients()
+	out := make([]SuppressionEvent, 0, len(rcpts))
+	for _, addr := range rcpts {
+		out = append(out, SuppressionEvent{
+			Address:      strings.ToLower(addr),
+			Reason:       "complaint",
+			FeedbackType: c.FeedbackType,
+			MessageID:    c.OriginalMessageID(),
+			Time:         when,
+		})
+	}
+	return out
+}
+
+// ProcessComplaint parses an ARF message and hands its suppression events
+// to sink. It returns the parsed complaint; ErrNotComplaint is returned for
+// other messages.
+//
+// Example:
+//
+//	for _, id := range ids {
+//		raw := fetchRaw(id)
+//		if _, err := email.ProcessComplaint(ctx, raw, suppressions); errors.Is(err, email.ErrNotComplaint) {
+//			continue
+//		}
+//	}
+func ProcessComplaint(ctx context.Context, r io.Reader, sink SuppressionSink) (*Complaint, error) {
+	c, err := ParseComplaint(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, ev := range c.Events() {
+		if err := sink.Suppress(ctx, ev); err != nil {
+			return c, fmt.Errorf("suppress %s: %w", ev.Address, err)
+		}
+	}
+	return c, nil
+}
+
+// ParseComplaint decodes an RFC 5965 feedback report from a raw message.
+func ParseComplaint(r io.Reader) (*Complaint, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid complaint message: %w", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" || !strings.EqualFold(params["report-type"], "feedback-report") {
+		return nil, ErrNotComplaint
+	}
+
+	var (
+		c     Complaint
+		found bool
+	)
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid complaint message: %w", err)
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		switch partType {
+		case "message/feedback-report":
+			fields, err := readHeaderBlock(partBody(part))
+			if err != nil {
+				return nil, fmt.Errorf("invalid feedback report: %w", err)
+			}
+			c.fill(fields)
+			found = true
+		case "message/rfc822", "text/rfc822-headers":
+			// Only the headers matter; the original body may be truncated.
+			if orig, err := mail.ReadMessage(partBody(part)); err == nil {
+				c.OriginalHeaders = orig.Header
+			}
+		}
+	}
+	if !found {
+		return nil, ErrNotComplaint
+	}
+	return &c, nil
+}
+
+// fill copies the feedback-report fields into c.
+func (c *Complaint) fill(f textproto.MIMEHeader) {
+	c.FeedbackType = strings.ToLower(strings.TrimSpace(f.Get("Feedback-Type")))
+	c.UserAgent = f.Get("User-Agent")
+	c.Version = f.Get("Version")
+	c.OriginalMailFrom = strings.Trim(f.Get("Original-Mail-From"), "<> ")
+	for _, r := range f.Values("Original-Rcpt-To") {
+		c.OriginalRcptTo = append(c.OriginalRcptTo, strings.Trim(r, "<> "))
+	}
+	if d, err := mail.ParseDate(f.Get("Arrival-Date")); err == nil {
+		c.ArrivalDate = d
+	} else if d, err := mail.ParseDate(f.Get("Received-Date")); err == nil {
+		c.ArrivalDate = d
+	}
+	c.ReportingMTA = strings.TrimSpace(strings.TrimPrefix(f.Get("Reporting-MTA"), "dns;"))
+	c.SourceIP = f.Get("Source-IP")
+}
+
+// partBody returns a part's content, decoding base64 transfer encoding
+// (multipart.Reader already decodes quoted-printable).
+func partBody(p *multipart.Part) io.Reader {
+	if strings.EqualFold(strings.TrimSpace(p.Header.Get("Content-Transfer-Encoding")), "base64") {
+		return base64.NewDecoder(base64.StdEncoding, p)
+	}
+	return p
+}
+
+// readHeaderBlock reads an RFC 822 style field block, tolerating a missing
+// blank line at the end.
+func readHeaderBlock(r io.Reader) (textproto.MIMEHeader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = append(bytes.TrimRight(data, "\r\n"), "\r\n\r\n"...)
+	return textproto.NewReader(bufio.NewReader(bytes.NewReader(data))).ReadMIMEHeader()
+}
@@ -0,0 +1,98 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testARF = "From: <abuse@isp.example>\r\n" +
+	"To: <fbl@sender.example>\r\n" +
+	"Subject: FW: Spring sale\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/report; report-type=feedback-report; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"This is an email abuse report.\r\n" +
+	"--b1\r\n" +
+	"Content-Type: message/feedback-report\r\n" +
+	"\r\n" +
+	"Feedback-Type: abuse\r\n" +
+	"User-Agent: SomeGenerator/1.0\r\n" +
+	"Version: 1\r\n" +
+	"Original-Mail-From: <bounces@sender.example>\r\n" +
+	"Arrival-Date: Thu, 8 Mar 2024 14:00:00 +0000\r\n" +
+	"Reporting-MTA: dns; mail.isp.example\r\n" +
+	"Source-IP: 192.0.2.1\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/rfc822-headers\r\n" +
+	"\r\n" +
+	"From: <news@sender.example>\r\n" +
+	"To: Some User <Some.User@isp.example>\r\n" +
+	"Message-ID: <abc123@sender.example>\r\n" +
+	"Subject: Spring sale\r\n" +
+	"\r\n" +
+	"--b1--\r\n"
+
+type recordingSink struct{ events []SuppressionEvent }
+
+func (s *recordingSink) Suppress(_ context.Context, ev SuppressionEvent) error {
+	s.events = append(s.events, ev)
+	return nil
+}
+
+func TestParseComplaint(t *testing.T) {
+	c, err := ParseComplaint(strings.NewReader(testARF))
+	if err != nil {
+		t.Fatalf("ParseComplaint() error = %v", err)
+	}
+	if c.FeedbackType != "abuse" || c.ReportingMTA != "mail.isp.example" || c.SourceIP != "192.0.2.1" {
+		t.Errorf("report fields = %+v", c)
+	}
+	if c.OriginalMailFrom != "bounces@sender.example" {
+		t.Errorf("OriginalMailFrom = %q", c.OriginalMailFrom)
+	}
+	if c.ArrivalDate.IsZero() {
+		t.Error("ArrivalDate not parsed")
+	}
+	// Original-Rcpt-To is redacted; the recipient comes from the original headers.
+	if got := c.Recipients(); len(got) != 1 || got[0] != "Some.User@isp.example" {
+		t.Errorf("Recipients() = %v", got)
+	}
+	if got := c.OriginalMessageID(); got != "abc123@sender.example" {
+		t.Errorf("OriginalMessageID() = %q", got)
+	}
+}
+
+func TestProcessComplaint(t *testing.T) {
+	sink := &recordingSink{}
+	if _, err := ProcessComplaint(context.Background(), strings.NewReader(testARF), sink); err != nil {
+		t.Fatalf("ProcessComplaint() error = %v", err)
+	}
+	if len(sink.events) != 1 {
+		t.Fatalf("got %d events, want 1", len(sink.events))
+	}
+	ev := sink.events[0]
+	if ev.Address != "some.user@isp.example" || ev.Reason != "complaint" || ev.MessageID != "abc123@sender.example" {
+		t.Errorf("event = %+v", ev)
+	}
+
+	notSpam := strings.Replace(testARF, "Feedback-Type: abuse", "Feedback-Type: not-spam", 1)
+	sink = &recordingSink{}
+	if _, err := ProcessComplaint(context.Background(), strings.NewReader(notSpam), sink); err != nil {
+		t.Fatalf("ProcessComplaint(not-spam) error = %v", err)
+	}
+	if len(sink.events) != 0 {
+		t.Errorf("not-spam report produced %d events", len(sink.events))
+	}
+}
+
+func TestParseComplaintNotARF(t *testing.T) {
+	raw := "From: a@example.com\r\nSubject: hi\r\nContent-Type: text/plain\r\n\r\nhello\r\n"
+	if _, err := ParseComplaint(strings.NewReader(raw)); !errors.Is(err, ErrNotComplaint) {
+		t.Errorf("ParseComplaint() error = %v, want ErrNotComplaint", err)
+	}
+}
@@ -0,0 +1,277 @@
+// compose.go - Replies and forwards built from an existing Message. NewReply
+// and NewForward do what every ticketing integration otherwise reimplements:
+// the "Re:"/"Fwd:" subject, the In-Reply-To and References headers that keep
+// the conversation threaded in the recipient's client, the quoted or
+// forwarded original and, for forwards, its attachments. They are pure
+// builders; for an in-thread reply through the mailbox API see Client.ReplyTo.
+// FullMessage.Message and Client.BuildReply/BuildForward bring messages read
+// from a mailbox into the same builders.
+package email
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// NewReply returns a reply to original: addressed to its Reply-To header or
+// sender, with a "Re:" subject, threading headers when original has a
+// Message-ID, and body above the quoted original. body is plain text; when
+// original is HTML the reply is HTML too, with body escaped and the original
+// quoted in a blockquote. From is left for the caller to set.
+//
+// Example:
+//
+//	reply := email.NewReply(ticket, "Thanks, we are looking into it.")
+//	reply.From = "support@example.com"
+//	err := client.Send(reply)
+func NewReply(original *Message, body string) *Message {
+	to := original.From
+	if rt := headerValue(original.Headers, "Reply-To"); rt != "" {
+		to = rt
+	}
+	reply := &Message{
+		To:      []string{to},
+		Subject: prefixSubject("Re:", original.Subject),
+		HTML:    original.HTML,
+		Headers: threadHeaders(original, true),
+	}
+	attribution := original.From + " wrote:"
+	if date := headerValue(original.Headers, "Date"); date != "" {
+		attribution = "On " + displayDate(date) + ", " + attribution
+	}
+	if original.HTML {
+		reply.Body = textToHTML(body) + `<br><div class="gmail_quote"><div class="gmail_attr">` +
+			html.EscapeString(attribution) + `</div><blockquote class="gmail_quote" style="margin:0 0 0 .8ex;border-left:1px solid #ccc;padding-left:1ex">` +
+			original.Body + `</blockquote></div>`
+		return reply
+	}
+	reply.Body = body + "\n\n" + attribution + "\n" + quoteText(original.Body)
+	return reply
+}
+
+// NewForward returns original forwarded to the given recipients, with a
+// "Fwd:" subject, a forwarded-message header block above the original body
+// and the original's attachments. From is left for the caller to set; add a
+// note by prepending it to Body.
+//
+// Example:
+//
+//	fwd := email.NewForward(invoice, "accounting@example.com")
+//	fwd.From = "ap@example.com"
+//	err := client.Send(fwd)
+func NewForward(original *Message, to ...string) *Message {
+	fwd := &Message{
+		To:          to,
+		Subject:     prefixSubject("Fwd:", original.Subject),
+		HTML:        original.HTML,
+		Attachments: append([]Attachment(nil), original.Attachments...),
+		Headers:     threadHeaders(original, false),
+	}
+	fields := [][2]string{{"From", original.From}}
+	if date := headerValue(original.Headers, "Date"); date != "" {
+		fields = append(fields, [2]string{"Date", displayDate(date)})
+	}
+	fields = append(fields, [2]string{"Subject", original.Subject}, [2]string{"To", strings.Join(original.To, ", ")})
+	if len(original.Cc) > 0 {
+		fields = append(fields, [2]string{"Cc", strings.Join(original.Cc, ", ")})
+	}
+
+	const separator = "---------- Forwarded message ---------"
+	var b strings.Builder
+	if original.HTML {
+		b.WriteString(`<div class="gmail_quote"><div class="gmail_attr">` + separator + "<br>")
+		for _, f := range fields {
+			fmt.Fprintf(&b, "%s: %s<br>", f[0], html.EscapeString(f[1]))
+		}
+		b.WriteString("</div><br>" + original.Body + "</div>")
+	} else {
+		b.WriteString(separator + "\n")
+		for _, f := range fields {
+			fmt.Fprintf(&b, "%s: %s\n", f[0], f[1])
+		}
+		b.WriteString("\n" + original.Body)
+	}
+	fwd.Body = b.String()
+	return fwd
+}
+
+// Message converts a message read from a mailbox into a Message that
+// NewReply and NewForward accept: the body (HTML if there is one), the
+// addresses and the Message-ID, References, Reply-To and Date headers needed
+// for threading and attribution. Attachments are not included; see
+// Client.BuildForward. The result is a source for those builders, not a
+// message to send as is: it reuses the original's Message-ID.
+func (m *FullMessage) Message() *Message {
+	msg := &Message{
+		From:    m.From,
+		To:      m.To,
+		Cc:      m.Cc,
+		Subject: m.Subject,
+		Body:    m.BodyText,
+		Headers: make(map[string]string),
+	}
+	if m.BodyHTML != "" {
+		msg.Body, msg.HTML = m.BodyHTML, true
+	}
+	if m.MessageID != "" {
+		msg.Headers["Message-ID"] = "<" + m.MessageID + ">"
+	}
+	if m.References != "" {
+		msg.Headers["References"] = m.References
+	}
+	if m.ReplyTo != "" {
+		msg.Headers["Reply-To"] = m.ReplyTo
+	}
+	if !m.Received.IsZero() {
+		msg.Headers["Date"] = m.Received.Format(time.RFC1123Z)
+	}
+	return msg
+}
+
+// BuildReply reads the message id from the mailbox and returns NewReply's
+// reply to it, with a default timeout. Nothing is sent.
+//
+// Example:
+//
+//	reply, err := client.BuildReply(id, "Your ticket has been resolved.")
+//	...
+//	reply.From = "support@example.com"
+//	err = client.Send(reply)
+func (c *Client) BuildReply(id, body string) (*Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	return c.BuildReplyWithContext(ctx, id, body)
+}
+
+// BuildReplyWithContext is BuildReply with a caller-supplied context.
+func (c *Client) BuildReplyWithContext(ctx context.Context, id, body string) (*Message, error) {
+	full, err := c.ReadWithContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return NewReply(full.Message(), body), nil
+}
+
+// BuildForward reads the message id from the mailbox, including its
+// attachments, and returns NewForward's forward of it to the given
+// recipients, with a default timeout. Nothing is sent. Attachments are
+// downloaded with GetAttachment; providers without it return ErrUnsupported
+// for messages that have attachments.
+func (c *Client) BuildForward(id string, to ...string) (*Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	return c.BuildForwardWithContext(ctx, id, to...)
+}
+
+// BuildForwardWithContext is BuildForward with a caller-supplied context.
+func (c *Client) BuildForwardWithContext(ctx context.Context, id string, to ...string) (*Message, error) {
+	r, err := c.receiver()
+	if err != nil {
+		return nil, err
+	}
+	full, err := r.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	original := full.Message()
+	if full.HasAttachments {
+		metas, err := r.ListAttachments(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, meta := range metas {
+			content, err := c.GetAttachmentWithContext(ctx, id, meta.ID)
+			if err != nil {
+				return nil, fmt.Errorf("forward attachment %q: %w", meta.Filename, err)
+			}
+			original.Attachments = append(original.Attachments, Attachment{Filename: meta.Filename, Content: content, MimeType: meta.MimeType})
+		}
+	}
+	return NewForward(original, to...), nil
+}
+
+// Reply and forward subject prefixes in common mail clients' languages,
+// lower-cased.
+var (
+	replyPrefixes   = []string{"re:", "aw:", "sv:", "antw:", "rif:"}
+	forwardPrefixes = []string{"fwd:", "fw:", "wg:", "tr:", "rv:", "enc:"}
+)
+
+// prefixSubject adds prefix to subject unless it already starts with the
+// same kind of prefix ("Re:" for replies, "Fwd:" for forwards).
+func prefixSubject(prefix, subject string) string {
+	existing := replyPrefixes
+	if prefix != "Re:" {
+		existing = forwardPrefixes
+	}
+	lower := strings.ToLower(strings.TrimSpace(subject))
+	for _, p := range existing {
+		if strings.HasPrefix(lower, p) {
+			return subject
+		}
+	}
+	return prefix + " " + subject
+}
+
+// threadHeaders returns the In-Reply-To (for replies) and References
+// headers linking a new message to original, or nil if original has no
+// Message-ID.
+func threadHeaders(original *Message, reply bool) map[string]string {
+	id := headerValue(original.Headers, "Message-Id")
+	if id == "" {
+		return nil
+	}
+	id = "<" + strings.Trim(id, "<>") + ">"
+	refs := id
+	if prev := headerValue(original.Headers, "References"); prev != "" {
+		refs = prev + " " + id
+	}
+	h := map[string]string{"References": refs}
+	if reply {
+		h["In-Reply-To"] = id
+	}
+	return h
+}
+
+// headerValue returns the value of the header name in h, matched
+// case-insensitively.
+func headerValue(h map[string]string, name string) string {
+	for k, v := range h {
+		if strings.EqualFold(k, name) {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// displayDate formats an RFC 5322 date the way mail clients show it in
+// attributions, or returns it unchanged if it does not parse.
+func displayDate(date string) string {
+	t, err := mail.ParseDate(date)
+	if err != nil {
+		return date
+	}
+	return t.Format("Mon, Jan 2, 2006 at 3:04 PM")
+}
+
+// quoteText prefixes each line of s with "> ".
+func quoteText(s string) string {
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(s, "\r\n", "\n"), "\n"), "\n")
+	for i, l := range lines {
+		if l == "" || strings.HasPrefix(l, ">") {
+			lines[i] = ">" + l
+		} else {
+			lines[i] = "> " + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// textToHTML escapes plain text for an HTML body, keeping line breaks.
+func textToHTML(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>")
+}
@@ -0,0 +1,54 @@
+//go:build !email_no_gmail
+
+package email
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestClientBuildReplyAndForward(t *testing.T) {
+	provider := newTestGmail(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/gmail/v1/users/me/messages/m1":
+			io.WriteString(w, `{"id":"m1","threadId":"t1","internalDate":"1704103200000","payload":{
+				"mimeType":"multipart/mixed","headers":[
+					{"name":"From","value":"Alice <alice@example.com>"},{"name":"To","value":"ap@example.com"},
+					{"name":"Subject","value":"Invoice"},{"name":"Message-ID","value":"<inv@example.com>"}],
+				"parts":[{"mimeType":"text/plain","body":{"data":"`+base64.RawURLEncoding.EncodeToString([]byte("See attached."))+`"}},
+					{"mimeType":"application/pdf","filename":"invoice.pdf","body":{"attachmentId":"a1","size":4}}]}}`)
+		case "/gmail/v1/users/me/messages/m1/attachments/a1":
+			io.WriteString(w, `{"data":"`+base64.RawURLEncoding.EncodeToString([]byte("%PDF"))+`"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	c := &Client{provider: provider}
+
+	reply, err := c.BuildReply("m1", "Paid.")
+	if err != nil {
+		t.Fatalf("BuildReply() error = %v", err)
+	}
+	if reply.Subject != "Re: Invoice" || reply.To[0] != "alice@example.com" || reply.Headers["In-Reply-To"] != "<inv@example.com>" {
+		t.Errorf("BuildReply() = %+v", reply)
+	}
+	if !strings.HasPrefix(reply.Body, "Paid.\n\nOn Mon, Jan 1, 2024 at ") || !strings.HasSuffix(reply.Body, "\n> See attached.") {
+		t.Errorf("BuildReply() body = %q", reply.Body)
+	}
+
+	fwd, err := c.BuildForward("m1", "accounting@example.com")
+	if err != nil {
+		t.Fatalf("BuildForward() error = %v", err)
+	}
+	if fwd.Subject != "Fwd: Invoice" || fwd.Headers["References"] != "<inv@example.com>" {
+		t.Errorf("BuildForward() = %+v", fwd)
+	}
+	if len(fwd.Attachments) != 1 || fwd.Attachments[0].Filename != "invoice.pdf" || string(fwd.Attachments[0].Content) != "%PDF" ||
+		fwd.Attachments[0].MimeType != "application/pdf" {
+		t.Errorf("BuildForward() attachments = %+v", fwd.Attachments)
+	}
+}
@@ -0,0 +1,112 @@
+package email
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewReply(t *testing.T) {
+	original := &Message{
+		From:    "Alice <alice@example.com>",
+		To:      []string{"support@example.com"},
+		Subject: "Printer broken",
+		Body:    "It jams.\n\nAlice",
+		Headers: map[string]string{
+			"Message-ID": "<m2@example.com>",
+			"references": "<m1@example.com>",
+			"Date":       "Mon, 01 Jan 2024 10:00:00 +0000",
+		},
+	}
+	reply := NewReply(original, "We are on it.")
+	if reply.Subject != "Re: Printer broken" {
+		t.Errorf("Subject = %q", reply.Subject)
+	}
+	if !reflect.DeepEqual(reply.To, []string{"Alice <alice@example.com>"}) || reply.From != "" {
+		t.Errorf("To = %v, From = %q", reply.To, reply.From)
+	}
+	wantHeaders := map[string]string{"In-Reply-To": "<m2@example.com>", "References": "<m1@example.com> <m2@example.com>"}
+	if !reflect.DeepEqual(reply.Headers, wantHeaders) {
+		t.Errorf("Headers = %v, want %v", reply.Headers, wantHeaders)
+	}
+	wantBody := "We are on it.\n\nOn Mon, Jan 1, 2024 at 10:00 AM, Alice <alice@example.com> wrote:\n> It jams.\n>\n> Alice"
+	if reply.Body != wantBody {
+		t.Errorf("Body = %q, want %q", reply.Body, wantBody)
+	}
+	if got := ParseReply(reply.Body).Body; got != "We are on it." {
+		t.Errorf("ParseReply(reply).Body = %q", got)
+	}
+
+	// Reply-To wins, existing prefixes are kept, no Message-ID means no
+	// threading headers, and HTML originals get an HTML reply.
+	original = &Message{From: "noreply@shop.example", Subject: "RE: Order <1>", Body: "<p>Shipped</p>", HTML: true,
+		Headers: map[string]string{"Reply-To": "orders@shop.example"}}
+	reply = NewReply(original, "Thanks <3")
+	if reply.To[0] != "orders@shop.example" || reply.Subject != "RE: Order <1>" || reply.Headers != nil || !reply.HTML {
+		t.Errorf("reply = %+v", reply)
+	}
+	if !strings.HasPrefix(reply.Body, "Thanks &lt;3<br>") || !strings.Contains(reply.Body, "<blockquote") {
+		t.Errorf("HTML Body = %q", reply.Body)
+	}
+	if got := HTMLToText(reply.Body, TextOptions{StripQuoted: true}); got != "Thanks <3" {
+		t.Errorf("HTMLToText(reply) = %q", got)
+	}
+}
+
+func TestNewForward(t *testing.T) {
+	original := &Message{
+		From:        "billing@vendor.example",
+		To:          []string{"ap@example.com"},
+		Cc:          []string{"cfo@example.com"},
+		Subject:     "Invoice 42",
+		Body:        "Please find the invoice attached.",
+		Attachments: []Attachment{{Filename: "invoice.pdf", Content: []byte("%PDF")}},
+		Headers:     map[string]string{"Message-Id": "inv42@vendor.example"},
+	}
+	fwd := NewForward(original, "accounting@example.com", "audit@example.com")
+	if fwd.Subject != "Fwd: Invoice 42" || !reflect.DeepEqual(fwd.To, []string{"accounting@example.com", "audit@example.com"}) {
+		t.Errorf("Subject = %q, To = %v", fwd.Subject, fwd.To)
+	}
+	if len(fwd.Attachments) != 1 || fwd.Attachments[0].Filename != "invoice.pdf" {
+		t.Errorf("Attachments = %v", fwd.Attachments)
+	}
+	fwd.Attachments[0].Filename = "changed.pdf"
+	if original.Attachments[0].Filename != "invoice.pdf" {
+		t.Error("forward shares the original's attachment slice")
+	}
+	if want := map[string]string{"References": "<inv42@vendor.example>"}; !reflect.DeepEqual(fwd.Headers, want) {
+		t.Errorf("Headers = %v, want %v", fwd.Headers, want)
+	}
+	wantBody := "---------- Forwarded message ---------\nFrom: billing@vendor.example\nSubject: Invoice 42\n" +
+		"To: ap@example.com\nCc: cfo@example.com\n\nPlease find the invoice attached."
+	if fwd.Body != wantBody {
+		t.Errorf("Body = %q, want %q", fwd.Body, wantBody)
+	}
+	if got := NewForward(&Message{Subject: "FW: x"}, "a@example.com").Subject; got != "FW: x" {
+		t.Errorf("Subject of re-forward = %q", got)
+	}
+}
+
+func TestFullMessageMessage(t *testing.T) {
+	full := &FullMessage{
+		Summary:    Summary{From: "alice@example.com", Subject: "Hi", Received: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+		To:         []string{"support@example.com"},
+		BodyText:   "text",
+		BodyHTML:   "<p>html</p>",
+		MessageID:  "m2@example.com",
+		References: "<m1@example.com>",
+		ReplyTo:    "help@example.com",
+	}
+	got := full.Message()
+	want := &Message{
+		From: "alice@example.com", To: []string{"support@example.com"}, Subject: "Hi", Body: "<p>html</p>", HTML: true,
+		Headers: map[string]string{
+			"Message-ID": "<m2@example.com>", "References": "<m1@example.com>",
+			"Reply-To": "help@example.com", "Date": "Mon, 01 Jan 2024 10:00:00 +0000",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Message() = %+v, want %+v", got, want)
+	}
+}
@@ -11,6 +11,23 @@ import (
 const (
 	ProviderOutlook365 = "outlook365"
 	ProviderGmail      = "gmail"
+	ProviderDirect     = "direct"
+)
+
+// Cloud environment constants, used as the OutlookConfig.CloudEnvironment
+// value and the OUTLOOK_CLOUD env var.
+const (
+	// CloudPublic is the global Microsoft 365 cloud, including GCC (moderate).
+	CloudPublic = "public"
+
+	// CloudUSGovHigh is Microsoft 365 GCC High.
+	CloudUSGovHigh = "usgovhigh"
+
+	// CloudUSGovDoD is Microsoft 365 DoD.
+	CloudUSGovDoD = "usgovdod"
+
+	// CloudChina is Microsoft 365 operated by 21Vianet.
+	CloudChina = "china"
 )
 
 // ConfigFromEnv creates an email configuration from environment variables.
@@ -21,7 +38,9 @@ const (
 //   - For Outlook 365:
 //   - OUTLOOK_TENANT_ID: Azure AD tenant ID (required)
 //   - OUTLOOK_CLIENT_ID: Azure AD application client ID (required)
-//   - OUTLOOK_CLIENT_SECRET: Azure AD application client secret (required)
+//   - OUTLOOK_CLIENT_SECRET: Azure AD application client secret (required unless OUTLOOK_TOKEN_FILE is set)
+//   - OUTLOOK_TOKEN_FILE: Path to a delegated token JSON file from OutlookAuthHelper, to send as the signed-in user
+//   - OUTLOOK_CLOUD: National cloud ("public", "usgovhigh", "usgovdod", "china"), defaults to "public"
 //   - For Gmail:
 //   - GMAIL_CREDENTIALS_FILE: Path to the OAuth2 credentials JSON file (required)
 //   - GMAIL_TOKEN_FILE: Path to the OAuth2 token JSON file (defaults to "token.json")
@@ -71,9 +90,10 @@ func ConfigFromEnv() (*Config, error) {
 // outlookConfigFromEnv reads Outlook 365 configuration from environment variables
 func outlookConfigFromEnv() (*OutlookConfig, error) {
 	config := &OutlookConfig{
-		TenantID:     os.Getenv("OUTLOOK_TENANT_ID"),
-		ClientID:     os.Getenv("OUTLOOK_CLIENT_ID"),
-		ClientSecret: os.Getenv("OUTLOOK_CLIENT_SECRET"),
+		TenantID:         os.Getenv("OUTLOOK_TENANT_ID"),
+		ClientID:         os.Getenv("OUTLOOK_CLIENT_ID"),
+		ClientSecret:     os.Getenv("OUTLOOK_CLIENT_SECRET"),
+		CloudEnvironment: os.Getenv("OUTLOOK_CLOUD"),
 	}
 
 	if config.TenantID == "" {
@@ -82,7 +102,13 @@ func outlookConfigFromEnv() (*OutlookConfig, error) {
 	if config.ClientID == "" {
 		return nil, fmt.Errorf("OUTLOOK_CLIENT_ID is required")
 	}
-	if config.ClientSecret == "" {
+	if tokenFile := os.Getenv("OUTLOOK_TOKEN_FILE"); tokenFile != "" {
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token file: %w", err)
+		}
+		config.TokenJSON = token
+	} else if config.ClientSecret == "" {
 		return nil, fmt.Errorf("OUTLOOK_CLIENT_SECRET is required")
 	}
 
@@ -0,0 +1,79 @@
+// deployment.go - Deployment metadata headers. A client configured with a
+// Deployment stamps every message it sends with the application version,
+// environment and build commit, so a problematic email can be traced back to
+// the build that sent it.
+package email
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DeploymentInfo describes the deployment sending through a Client. Each
+// non-empty field becomes a header on every message; headers the message
+// already sets are left alone.
+type DeploymentInfo struct {
+	// AppVersion is the application's version (X-App-Version).
+	AppVersion string
+
+	// Environment names the deployment, e.g. "staging" (X-Environment).
+	Environment string
+
+	// Commit is the build's git commit (X-Git-Commit). Defaults to GitCommit.
+	Commit string
+
+	// Headers are further headers to stamp, e.g. "X-Region". They are
+	// subject to the same rules as Message.Headers; Outlook 365 only passes
+	// X- headers through Graph.
+	Headers map[string]string
+}
+
+// headers returns the header fields to stamp on each message.
+func (d *DeploymentInfo) headers() (map[string]string, error) {
+	commit := d.Commit
+	if commit == "" {
+		commit = GitCommit
+	}
+	h := make(map[string]string, len(d.Headers)+3)
+	for name, value := range d.Headers {
+		h[name] = value
+	}
+	for name, value := range map[string]string{
+		"X-App-Version": d.AppVersion,
+		"X-Environment": d.Environment,
+		"X-Git-Commit":  commit,
+	} {
+		if value != "" {
+			h[name] = value
+		}
+	}
+	for name, value := range h {
+		if err := validateHeader(name, value); err != nil {
+			return nil, fmt.Errorf("deployment: %w", err)
+		}
+	}
+	return h, nil
+}
+
+// stampHeaders returns msg with headers added, or msg itself when there is
+// nothing to add. The caller's message is not modified.
+func stampHeaders(msg *Message, headers map[string]string) *Message {
+	if len(headers) == 0 {
+		return msg
+	}
+	out := *msg
+	out.Headers = make(map[string]string, len(msg.Headers)+len(headers))
+	for name, value := range headers {
+		out.Headers[name] = value
+	}
+	for name, value := range msg.Headers {
+		// A message header wins over a stamped one of any case.
+		for stamped := range headers {
+			if strings.EqualFold(stamped, name) {
+				delete(out.Headers, stamped)
+			}
+		}
+		out.Headers[name] = value
+	}
+	return &out
+}
@@ -0,0 +1,58 @@
+package email
+
+import "testing"
+
+func TestClientSendDeploymentHeaders(t *testing.T) {
+	saved := GitCommit
+	GitCommit = "abc123"
+	defer func() { GitCommit = saved }()
+
+	deploy := &DeploymentInfo{AppVersion: "2.4.0", Environment: "staging", Headers: map[string]string{"X-Region": "eu-1"}}
+	stamp, err := deploy.headers()
+	if err != nil {
+		t.Fatalf("headers() error = %v", err)
+	}
+	mock := &mockProvider{}
+	client := &Client{provider: mock, stamp: stamp}
+
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+		Headers: map[string]string{"x-environment": "override"}}
+	if err := client.Send(msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	got := mock.calls[0].Headers
+	want := map[string]string{
+		"X-App-Version": "2.4.0",
+		"X-Git-Commit":  "abc123",
+		"X-Region":      "eu-1",
+		"x-environment": "override",
+	}
+	if len(got) != len(want) {
+		t.Errorf("headers = %v, want %v", got, want)
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("header %s = %q, want %q", name, got[name], value)
+		}
+	}
+	if len(msg.Headers) != 1 {
+		t.Errorf("caller's message was modified: %v", msg.Headers)
+	}
+}
+
+func TestDeploymentInfoHeadersInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		deploy DeploymentInfo
+	}{
+		{"line break", DeploymentInfo{Environment: "prod\r\nBcc: x@example.com"}},
+		{"reserved header", DeploymentInfo{Headers: map[string]string{"Subject": "x"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.deploy.headers(); err == nil {
+				t.Error("headers() error = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,418 @@
+// direct.go - Direct-to-MX delivery. Instead of submitting to a relay, the
+// direct provider resolves each recipient domain's MX hosts and delivers over
+// port 25 like an MTA: messages are DKIM-signed, MX hosts are tried in
+// preference order under the domain's MTA-STS/DANE policy (mxpolicy.go), and
+// temporary failures are deferred and retried in the background on a
+// schedule until they succeed, fail permanently or expire. Greylisting
+// replies get a schedule of their own that waits longer before the first
+// retry. Connections can be
+// made from named pools of local addresses (IP pools), keeping bulk and
+// transactional reputations apart.
+//
+// The deferral queue is kept in memory: deliveries still queued when the
+// process exits are lost. Senders needing durable queuing should run a real
+// MTA and use it as a relay.
+package email
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DeliveryFailure reports a deferred delivery that failed for good.
+type DeliveryFailure struct {
+	// Domain is the recipient domain and Recipients its addresses.
+	Domain     string
+	Recipients []string
+
+	// MessageID is the Message-ID of the undelivered message.
+	MessageID string
+
+	// Attempts is the number of delivery attempts made.
+	Attempts int
+
+	// Err is the last delivery error.
+	Err error
+}
+
+// Defaults for DirectConfig.
+var (
+	defaultRetrySchedule = []time.Duration{
+		5 * time.Minute, 15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour, 4 * time.Hour,
+	}
+	defaultGreylistRetrySchedule = []time.Duration{
+		15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour, 4 * time.Hour,
+	}
+	defaultMaxQueueTime = 5 * 24 * time.Hour
+)
+
+// directAttemptTimeout bounds one background retry across all MX hosts.
+const directAttemptTimeout = 5 * time.Minute
+
+// directProvider implements Provider by delivering to recipient MX hosts.
+type directProvider struct {
+	config   *DirectConfig
+	hostname string
+	dkim     *dkimSigner
+	policies *mxPolicyResolver
+
+	// pools are the configured IP pools by name.
+	pools map[string]*directPool
+
+	// lookupMX and port are replaced in tests.
+	lookupMX func(ctx context.Context, domain string) ([]*net.MX, error)
+	port     string
+}
+
+// directDelivery is one message bound for one recipient domain.
+type directDelivery struct {
+	domain    string
+	messageID string
+	msg       smtpMessage
+	pool      *directPool
+	first     time.Time
+	attempts  int
+}
+
+// newDirectProvider creates a direct-to-MX provider.
+func newDirectProvider(config *DirectConfig) (*directProvider, error) {
+	p := &directProvider{
+		config:   config,
+		hostname: config.Hostname,
+		policies: &mxPolicyResolver{dnsServer: config.DNSSECResolver},
+		lookupMX: net.DefaultResolver.LookupMX,
+		port:     "25",
+	}
+	if p.hostname == "" {
+		h, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("unable to determine EHLO hostname: %w", err)
+		}
+		p.hostname = h
+	}
+	if err := p.initPools(); err != nil {
+		return nil, err
+	}
+	if !config.DisableMTASTS {
+		p.policies.sts = newMTASTSCache(config.HTTPClient)
+	}
+	if config.DKIM != nil {
+		signer, err := newDKIMSigner(config.DKIM)
+		if err != nil {
+			return nil, err
+		}
+		p.dkim = signer
+	}
+	return p, nil
+}
+
+// Send delivers msg to every recipient domain. It returns nil once each
+// domain has either accepted the message or had it deferred for retry (4xx
+// replies, unreachable hosts, TLS policy failures); permanent failures (5xx
+// replies, null MX) are returned, wrapping ErrPartialSend if other domains
+// took the message. Deferred deliveries that later fail are reported to
+// DirectConfig.OnFailure.
+func (p *directProvider) Send(ctx context.Context, msg *Message) error {
+	_, err := p.SendWithResult(ctx, msg)
+	return err
+}
+
+// SendWithResult is Send, reporting the Message-ID the message was sent
+// with, also when it fails with ErrPartialSend. Direct delivery has no
+// provider ids.
+func (p *directProvider) SendWithResult(ctx context.Context, msg *Message) (*SendResult, error) {
+	pool, err := p.pool(msg.IPPool)
+	if err != nil {
+		return nil, fmt.Errorf("unable to send message: %w", err)
+	}
+	m, messageID, err := p.prepare(msg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to send message: %w", err)
+	}
+
+	var errs []error
+	accepted := false // by, or scheduled for, some domain
+	var held *smtpMessage
+	for _, g := range groupByDomain(messageRecipients(msg)) {
+		dm := m
+		dm.rcpts = g.rcpts
+		d := &directDelivery{domain: g.domain, messageID: messageID, msg: dm, pool: pool, first: time.Now()}
+		err := p.attempt(ctx, d)
+		if err != nil && ctx.Err() == nil && !smtpPermanent(err) && held == nil {
+			// Retries outlive the call; they send the message as it is now.
+			h, herr := m.held()
+			if herr != nil {
+				err = fmt.Errorf("%w (rendering for retry: %w)", err, herr)
+			} else {
+				held = &h
+			}
+		}
+		switch {
+		case err == nil:
+			accepted = true
+		case ctx.Err() == nil && !smtpPermanent(err) && held != nil:
+			d.msg.write = held.write
+			p.schedule(d, err)
+			accepted = true
+		default:
+			errs = append(errs, fmt.Errorf("%s: %w", g.domain, err))
+		}
+	}
+	res := &SendResult{MessageID: messageID}
+	switch {
+	case len(errs) == 0:
+		return res, nil
+	case accepted:
+		// The other domains have the message; sending it again would
+		// duplicate it there.
+		return res, fmt.Errorf("%w: %w", ErrPartialSend, errors.Join(errs...))
+	default:
+		return nil, fmt.Errorf("unable to send message: %w", errors.Join(errs...))
+	}
+}
+
+// prepare readies msg for sending, DKIM-signed if configured, adding the
+// Date and Message-ID headers a receiving MX expects from the originator.
+func (p *directProvider) prepare(msg *Message) (smtpMessage, string, error) {
+	write, messageID, err := signedSMTPMessage(msg, p.dkim)
+	if err != nil {
+		return smtpMessage{}, "", err
+	}
+	return smtpMessage{from: asciiAddress(parseAddr(msg.From)), dsn: msg.DSN, write: write}, messageID, nil
+}
+
+// newMessageID returns a unique Message-ID (without angle brackets) in the
+// sender's domain.
+func newMessageID(from string) string {
+	domain := "localhost"
+	if i := strings.LastIndexByte(from, '@'); i >= 0 {
+		domain = asciiDomain(from[i+1:])
+	}
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return fmt.Sprintf("%d.%x@%s", time.Now().UnixNano(), b, domain)
+}
+
+// attempt tries the domain's MX hosts in preference order. It returns nil on
+// acceptance, the first permanent error, or the last temporary one.
+func (p *directProvider) attempt(ctx context.Context, d *directDelivery) error {
+	d.attempts++
+	hosts, err := p.mxHosts(ctx, d.domain)
+	if err != nil {
+		return err
+	}
+	var last error
+	for _, host := range hosts {
+		policy, err := p.policies.resolve(ctx, d.domain, host)
+		if err != nil {
+			last = err
+			continue
+		}
+		srv := smtpServer{
+			addr:     net.JoinHostPort(host, p.port),
+			security: SMTPSecurityOpportunistic,
+			helo:     p.hostname,
+			policy:   policy,
+		}
+		if d.pool != nil {
+			srv.localAddr = d.pool.next()
+			if d.pool.hostname != "" {
+				srv.helo = d.pool.hostname
+			}
+		}
+		err = smtpSend(ctx, srv, d.msg)
+		if err == nil || smtpPermanent(err) {
+			return err
+		}
+		last = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return last
+}
+
+// mxHosts returns the domain's MX hosts by preference, falling back to the
+// domain itself when it has no MX records (RFC 5321 §5.1). A null MX (RFC
+// 7505) is a permanent failure.
+func (p *directProvider) mxHosts(ctx context.Context, domain string) ([]string, error) {
+	mxs, err := p.lookupMX(ctx, domain)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return []string{domain}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mx lookup: %w", err)
+	}
+	if len(mxs) == 1 && (mxs[0].Host == "." || mxs[0].Host == "") {
+		return nil, &textproto.Error{Code: 556, Msg: "5.1.10 domain does not accept mail (null MX)"}
+	}
+	hosts := make([]string, 0, len(mxs))
+	for _, mx := range mxs { // net sorts by preference
+		hosts = append(hosts, strings.TrimSuffix(mx.Host, "."))
+	}
+	return hosts, nil
+}
+
+// smtpPermanent reports whether err rules out a retry: a 5xx reply, a message
+// the server can never accept, or a feature it lacks.
+func smtpPermanent(err error) bool {
+	var tp *textproto.Error
+	if errors.As(err, &tp) {
+		return tp.Code >= 500
+	}
+	return errors.Is(err, ErrMessageTooLarge) || errors.Is(err, ErrUnsupported)
+}
+
+// greylistRe matches the text of greylisting replies across common
+// implementations (postgrey, Exim, Exchange).
+var greylistRe = regexp.MustCompile(`(?i)gr[ae]y-?list|(try|retry|come back)( again)? later`)
+
+// greylisted reports whether err is a greylisting reply.
+func greylisted(err error) bool {
+	var tp *textproto.Error
+	return errors.As(err, &tp) && (tp.Code == 450 || tp.Code == 451) && greylistRe.MatchString(tp.Msg)
+}
+
+// schedule queues d for its next retry after the temporary failure err, or
+// fails it once MaxQueueTime has passed.
+func (p *directProvider) schedule(d *directDelivery, err error) {
+	retries := p.config.RetrySchedule
+	if len(retries) == 0 {
+		retries = defaultRetrySchedule
+	}
+	if greylisted(err) {
+		retries = p.config.GreylistRetrySchedule
+		if len(retries) == 0 {
+			retries = defaultGreylistRetrySchedule
+		}
+	}
+	maxAge := p.config.MaxQueueTime
+	if maxAge <= 0 {
+		maxAge = defaultMaxQueueTime
+	}
+	delay := retries[min(d.attempts, len(retries))-1]
+	if time.Since(d.first)+delay > maxAge {
+		p.fail(d, fmt.Errorf("delivery expired after %d attempts", d.attempts))
+		return
+	}
+	time.AfterFunc(delay, func() { p.retry(d) })
+}
+
+// retry makes one background delivery attempt for d.
+func (p *directProvider) retry(d *directDelivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), directAttemptTimeout)
+	defer cancel()
+	switch err := p.attempt(ctx, d); {
+	case err == nil:
+	case smtpPermanent(err):
+		p.fail(d, err)
+	default:
+		p.schedule(d, err)
+	}
+}
+
+// fail reports d to OnFailure.
+func (p *directProvider) fail(d *directDelivery, err error) {
+	if p.config.OnFailure == nil {
+		return
+	}
+	p.config.OnFailure(DeliveryFailure{
+		Domain:     d.domain,
+		Recipients: d.msg.rcpts,
+		MessageID:  d.messageID,
+		Attempts:   d.attempts,
+		Err:        err,
+	})
+}
+
+// directPool is a parsed IPPool.
+type directPool struct {
+	addrs    []*net.TCPAddr
+	hostname string
+	counter  atomic.Uint32
+}
+
+// next returns the pool's next source address in rotation.
+func (dp *directPool) next() net.Addr {
+	return dp.addrs[int(dp.counter.Add(1)-1)%len(dp.addrs)]
+}
+
+// initPools parses config.IPPools.
+func (p *directProvider) initPools() error {
+	p.pools = make(map[string]*directPool, len(p.config.IPPools))
+	for name, pool := range p.config.IPPools {
+		if len(pool.Addrs) == 0 {
+			return fmt.Errorf("ip pool %q has no addresses", name)
+		}
+		dp := &directPool{hostname: pool.Hostname}
+		for _, a := range pool.Addrs {
+			ip := net.ParseIP(a)
+			if ip == nil {
+				return fmt.Errorf("ip pool %q: invalid address %q", name, a)
+			}
+			dp.addrs = append(dp.addrs, &net.TCPAddr{IP: ip})
+		}
+		p.pools[name] = dp
+	}
+	if name := p.config.DefaultIPPool; name != "" && p.pools[name] == nil {
+		return fmt.Errorf("default ip pool %q is not configured", name)
+	}
+	return nil
+}
+
+// pool returns the pool named by a message, DefaultIPPool if name is empty,
+// or nil to let the system choose the source address.
+func (p *directProvider) pool(name string) (*directPool, error) {
+	if name == "" {
+		name = p.config.DefaultIPPool
+	}
+	if name == "" {
+		return nil, nil
+	}
+	dp := p.pools[name]
+	if dp == nil {
+		return nil, fmt.Errorf("unknown ip pool %q", name)
+	}
+	return dp, nil
+}
+
+// domainGroup is the recipients of one domain.
+type domainGroup struct {
+	domain string
+	rcpts  []string
+}
+
+// groupByDomain groups bare recipient addresses by lowercased domain,
+// preserving first-seen order and dropping duplicates. Domains are
+// converted to ASCII for DNS.
+func groupByDomain(addrs []string) []domainGroup {
+	var groups []domainGroup
+	index := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, a := range addrs {
+		addr := asciiAddress(parseAddr(a))
+		if seen[strings.ToLower(addr)] {
+			continue
+		}
+		seen[strings.ToLower(addr)] = true
+		domain := strings.ToLower(addr[strings.LastIndexByte(addr, '@')+1:])
+		i, ok := index[domain]
+		if !ok {
+			i = len(groups)
+			index[domain] = i
+			groups = append(groups, domainGroup{domain: domain})
+		}
+		groups[i].rcpts = append(groups[i].rcpts, addr)
+	}
+	return groups
+}
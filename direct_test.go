@@ -0,0 +1,252 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestDirect returns a direct provider delivering to srv for every domain
+// (lookupMX may override that).
+func newTestDirect(t *testing.T, srv *fakeSMTP, config *DirectConfig) *directProvider {
+	t.Helper()
+	config.Hostname = "mta.example.com"
+	config.DisableMTASTS = true
+	p, err := newDirectProvider(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.lookupMX = func(ctx context.Context, domain string) ([]*net.MX, error) {
+		return []*net.MX{{Host: "127.0.0.1.", Pref: 10}}, nil
+	}
+	if srv != nil {
+		_, p.port, _ = net.SplitHostPort(srv.addr)
+	}
+	return p
+}
+
+func TestGroupByDomain(t *testing.T) {
+	got := groupByDomain([]string{"a@x.com", "B <b@Y.com>", "c@X.COM", "A@x.com"})
+	if len(got) != 2 || got[0].domain != "x.com" || len(got[0].rcpts) != 2 || got[1].domain != "y.com" || got[1].rcpts[0] != "b@Y.com" {
+		t.Errorf("groupByDomain = %+v", got)
+	}
+}
+
+func TestSMTPPermanent(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&textproto.Error{Code: 550, Msg: "no such user"}, true},
+		{&textproto.Error{Code: 451, Msg: "try later"}, false},
+		{errors.New("connection refused"), false},
+		{ErrMessageTooLarge, true},
+	}
+	for _, tt := range tests {
+		if got := smtpPermanent(tt.err); got != tt.want {
+			t.Errorf("smtpPermanent(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestGreylisted(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&textproto.Error{Code: 450, Msg: "4.2.0 <you@example.net>: Recipient address rejected: Greylisted"}, true},
+		{&textproto.Error{Code: 451, Msg: "4.7.1 Please try again later"}, true},
+		{&textproto.Error{Code: 451, Msg: "Temporary local problem - please retry later"}, true},
+		{&textproto.Error{Code: 452, Msg: "4.2.2 Mailbox full, try again later"}, false},
+		{&textproto.Error{Code: 421, Msg: "4.4.2 Connection dropped"}, false},
+		{&textproto.Error{Code: 550, Msg: "greylisted forever"}, false},
+		{errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got := greylisted(tt.err); got != tt.want {
+			t.Errorf("greylisted(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestDirectSend(t *testing.T) {
+	srv := newFakeSMTP(t, "8BITMIME")
+	p := newTestDirect(t, srv, &DirectConfig{})
+	msg := &Message{From: "me@example.com", To: []string{"you@example.net"}, Subject: "Hi", Body: "Hello"}
+	if err := p.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	data := <-srv.data
+	for _, want := range []string{"Message-Id: <", "@example.com>", "Date: "} {
+		if !strings.Contains(data, want) {
+			t.Errorf("message lacks %q", want)
+		}
+	}
+	cmds := <-srv.commands
+	if cmds[0] != "EHLO mta.example.com" {
+		t.Errorf("first command = %q, want EHLO with configured hostname", cmds[0])
+	}
+	if msg.Headers != nil {
+		t.Error("Send modified the caller's message")
+	}
+}
+
+func TestDirectNullMX(t *testing.T) {
+	p := newTestDirect(t, nil, &DirectConfig{})
+	p.lookupMX = func(ctx context.Context, domain string) ([]*net.MX, error) {
+		return []*net.MX{{Host: ".", Pref: 0}}, nil
+	}
+	err := p.Send(context.Background(), &Message{From: "me@example.com", To: []string{"you@example.net"}, Subject: "Hi", Body: "x"})
+	if err == nil || !strings.Contains(err.Error(), "null MX") {
+		t.Errorf("Send() error = %v, want null MX failure", err)
+	}
+}
+
+func TestDirectPartialSend(t *testing.T) {
+	srv := newFakeSMTP(t)
+	p := newTestDirect(t, srv, &DirectConfig{})
+	lookup := p.lookupMX
+	p.lookupMX = func(ctx context.Context, domain string) ([]*net.MX, error) {
+		if domain == "example.org" {
+			return []*net.MX{{Host: ".", Pref: 0}}, nil
+		}
+		return lookup(ctx, domain)
+	}
+	msg := &Message{From: "me@example.com", To: []string{"you@example.net", "them@example.org"}, Subject: "Hi", Body: "x"}
+	res, err := p.SendWithResult(context.Background(), msg)
+	if !errors.Is(err, ErrPartialSend) || !strings.Contains(err.Error(), "null MX") {
+		t.Errorf("SendWithResult() error = %v, want ErrPartialSend with the null MX failure", err)
+	}
+	if res == nil || res.MessageID == "" {
+		t.Errorf("SendWithResult() = %+v, want the Message-ID of the partial send", res)
+	}
+	<-srv.data
+}
+
+func TestDirectDeferral(t *testing.T) {
+	t.Run("retried", func(t *testing.T) {
+		srv := newFakeSMTP(t)
+		p := newTestDirect(t, srv, &DirectConfig{RetrySchedule: []time.Duration{10 * time.Millisecond}})
+		var calls atomic.Int32
+		lookup := p.lookupMX
+		p.lookupMX = func(ctx context.Context, domain string) ([]*net.MX, error) {
+			if calls.Add(1) == 1 {
+				return nil, &net.DNSError{Err: "timeout", Name: domain, IsTemporary: true}
+			}
+			return lookup(ctx, domain)
+		}
+		content := []byte("first")
+		msg := &Message{From: "me@example.com", To: []string{"you@example.net"}, Subject: "Hi", Body: "x",
+			Attachments: []Attachment{{Filename: "a.bin", Content: content, Encoding: EncodingBase64}}}
+		if err := p.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send: %v (want deferral)", err)
+		}
+		copy(content, "reuse") // the retry sends the message as it was
+		select {
+		case data := <-srv.data:
+			if !strings.Contains(data, "Zmlyc3Q=") {
+				t.Errorf("retried message:\n%s", data)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("deferred message was not retried")
+		}
+	})
+
+	t.Run("greylisted", func(t *testing.T) {
+		srv := newFakeSMTP(t)
+		p := newTestDirect(t, srv, &DirectConfig{
+			RetrySchedule:         []time.Duration{time.Hour},
+			GreylistRetrySchedule: []time.Duration{10 * time.Millisecond},
+		})
+		var calls atomic.Int32
+		lookup := p.lookupMX
+		p.lookupMX = func(ctx context.Context, domain string) ([]*net.MX, error) {
+			if calls.Add(1) == 1 {
+				// Stands in for a greylisting RCPT reply.
+				return nil, &textproto.Error{Code: 451, Msg: "4.7.1 Greylisted, please try again later"}
+			}
+			return lookup(ctx, domain)
+		}
+		if err := p.Send(context.Background(), &Message{From: "me@example.com", To: []string{"you@example.net"}, Subject: "Hi", Body: "x"}); err != nil {
+			t.Fatalf("Send: %v (want deferral)", err)
+		}
+		select {
+		case <-srv.data:
+		case <-time.After(5 * time.Second):
+			t.Fatal("greylisted message was not retried on the greylist schedule")
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		failures := make(chan DeliveryFailure, 1)
+		p := newTestDirect(t, nil, &DirectConfig{
+			RetrySchedule: []time.Duration{10 * time.Millisecond},
+			MaxQueueTime:  50 * time.Millisecond,
+			OnFailure:     func(f DeliveryFailure) { failures <- f },
+		})
+		p.lookupMX = func(ctx context.Context, domain string) ([]*net.MX, error) {
+			return nil, &net.DNSError{Err: "timeout", Name: domain, IsTemporary: true}
+		}
+		if err := p.Send(context.Background(), &Message{From: "me@example.com", To: []string{"you@example.net"}, Subject: "Hi", Body: "x"}); err != nil {
+			t.Fatalf("Send: %v (want deferral)", err)
+		}
+		select {
+		case f := <-failures:
+			if f.Domain != "example.net" || f.Attempts < 2 || f.MessageID == "" {
+				t.Errorf("failure = %+v", f)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expired delivery was not reported")
+		}
+	})
+}
+
+func TestDirectIPPools(t *testing.T) {
+	srv := newFakeSMTP(t)
+	p := newTestDirect(t, srv, &DirectConfig{
+		IPPools: map[string]IPPool{
+			"bulk":          {Addrs: []string{"127.0.0.1"}, Hostname: "bulk.example.com"},
+			"transactional": {Addrs: []string{"127.0.0.1", "::1"}},
+		},
+		DefaultIPPool: "transactional",
+	})
+	msg := &Message{From: "me@example.com", To: []string{"you@example.net"}, Subject: "Hi", Body: "x", IPPool: "bulk"}
+	if err := p.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	<-srv.data
+	if cmds := <-srv.commands; cmds[0] != "EHLO bulk.example.com" {
+		t.Errorf("first command = %q, want the pool's EHLO name", cmds[0])
+	}
+
+	tx, _ := p.pool("")
+	if a, b, c := tx.next(), tx.next(), tx.next(); a.String() == b.String() || a.String() != c.String() {
+		t.Errorf("rotation = %v, %v, %v", a, b, c)
+	}
+	msg.IPPool = "missing"
+	if err := p.Send(context.Background(), msg); err == nil || !strings.Contains(err.Error(), "unknown ip pool") {
+		t.Errorf("Send(unknown pool) error = %v", err)
+	}
+}
+
+func TestDirectIPPoolConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config DirectConfig
+	}{
+		{"empty pool", DirectConfig{IPPools: map[string]IPPool{"bulk": {}}}},
+		{"bad address", DirectConfig{IPPools: map[string]IPPool{"bulk": {Addrs: []string{"10.0.0.300"}}}}},
+		{"unknown default", DirectConfig{DefaultIPPool: "bulk"}},
+	}
+	for _, tt := range tests {
+		tt.config.Hostname = "mta.example.com"
+		if _, err := newDirectProvider(&tt.config); err == nil {
+			t.Errorf("%s: want error, got nil", tt.name)
+		}
+	}
+}
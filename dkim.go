@@ -0,0 +1,265 @@
+// dkim.go - DKIM signing (RFC 6376) for direct-to-MX delivery. Messages are
+// signed with relaxed/relaxed canonicalization using rsa-sha256 or
+// ed25519-sha256 (RFC 8463), depending on the key.
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DKIMConfig holds the DKIM signing key and identity.
+type DKIMConfig struct {
+	// Domain is the signing domain (d=), normally the From domain so the
+	// signature aligns for DMARC.
+	Domain string
+
+	// Selector (s=) locates the public key at
+	// <Selector>._domainkey.<Domain>.
+	Selector string
+
+	// PrivateKeyPEM is the signing key: RSA (PKCS#1 or PKCS#8, 1024 bits or
+	// more) or Ed25519 (PKCS#8).
+	PrivateKeyPEM []byte
+
+	// Headers lists the header fields to sign. Defaults to From, To, Cc,
+	// Subject, Date, Message-ID, Reply-To, MIME-Version and Content-Type;
+	// From is always signed.
+	Headers []string
+}
+
+// dkimDefaultHeaders are signed when DKIMConfig.Headers is empty.
+var dkimDefaultHeaders = []string{
+	"From", "To", "Cc", "Subject", "Date", "Message-ID", "Reply-To", "MIME-Version", "Content-Type",
+}
+
+// dkimSigner signs raw messages.
+type dkimSigner struct {
+	domain, selector string
+	key              crypto.Signer
+	algorithm        string
+	headers          []string
+}
+
+// newDKIMSigner validates config and parses its key.
+func newDKIMSigner(config *DKIMConfig) (*dkimSigner, error) {
+	if config.Domain == "" || config.Selector == "" {
+		return nil, fmt.Errorf("dkim: domain and selector are required")
+	}
+	block, _ := pem.Decode(config.PrivateKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("dkim: no PEM private key found")
+	}
+	var key any
+	var err error
+	if block.Type == "RSA PRIVATE KEY" {
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dkim: invalid private key: %w", err)
+	}
+
+	s := &dkimSigner{domain: config.Domain, selector: config.Selector}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 1024 {
+			return nil, fmt.Errorf("dkim: RSA key of %d bits is too short", k.N.BitLen())
+		}
+		s.key, s.algorithm = k, "rsa-sha256"
+	case ed25519.PrivateKey:
+		s.key, s.algorithm = k, "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("dkim: unsupported key type %T", key)
+	}
+
+	s.headers = config.Headers
+	if len(s.headers) == 0 {
+		s.headers = dkimDefaultHeaders
+	}
+	hasFrom := false
+	for _, h := range s.headers {
+		hasFrom = hasFrom || strings.EqualFold(h, "From")
+	}
+	if !hasFrom {
+		s.headers = append([]string{"From"}, s.headers...)
+	}
+	return s, nil
+}
+
+// signedSMTPMessage prepares msg for SMTP submission, DKIM-signed by signer
+// if it is not nil, and returns the writer of its 8-bit or 7-bit variant
+// and its Message-ID. The Date and Message-ID headers are added if missing,
+// so that they are covered by the signature. Without a signer the writer
+// streams the message; a signature covers the final bytes, so with one each
+// variant is rendered and signed in memory the first time it is written,
+// and reused after that.
+func signedSMTPMessage(msg *Message, signer *dkimSigner) (write func(w io.Writer, sevenBit bool) error, messageID string, err error) {
+	out := *msg
+	out.Headers = make(map[string]string, len(msg.Headers)+2)
+	for k, v := range msg.Headers {
+		out.Headers[textproto.CanonicalMIMEHeaderKey(k)] = v
+	}
+	if _, ok := out.Headers["Date"]; !ok {
+		out.Headers["Date"] = time.Now().Format(time.RFC1123Z)
+	}
+	if _, ok := out.Headers["Message-Id"]; !ok {
+		out.Headers["Message-Id"] = "<" + newMessageID(parseAddr(msg.From)) + ">"
+	}
+	messageID = strings.Trim(out.Headers["Message-Id"], "<>")
+
+	boundary := newBoundary()
+	if signer == nil {
+		return func(w io.Writer, sevenBit bool) error {
+			return writeMessage(w, &out, rawOptions{sevenBit: sevenBit, boundary: boundary})
+		}, messageID, nil
+	}
+	var mu sync.Mutex
+	var signed [2][]byte // 8-bit, 7-bit
+	return func(w io.Writer, sevenBit bool) error {
+		i := 0
+		if sevenBit {
+			i = 1
+		}
+		mu.Lock()
+		raw := signed[i]
+		if raw == nil {
+			var err error
+			if raw, err = renderMessage(&out, rawOptions{sevenBit: sevenBit, boundary: boundary}); err == nil {
+				raw, err = signer.sign(raw, time.Now())
+			}
+			if err != nil {
+				mu.Unlock()
+				return err
+			}
+			signed[i] = raw
+		}
+		mu.Unlock()
+		_, err := w.Write(raw)
+		return err
+	}, messageID, nil
+}
+
+// sign returns raw with a DKIM-Signature header prepended. Header fields
+// listed for signing but absent from the message are left out of h=.
+func (s *dkimSigner) sign(raw []byte, now time.Time) ([]byte, error) {
+	header, body, ok := bytes.Cut(raw, []byte("\r\n\r\n"))
+	if !ok {
+		header, body = bytes.TrimSuffix(raw, []byte("\r\n")), nil
+	}
+	fields := splitHeaderFields(string(header) + "\r\n")
+
+	bh := sha256.Sum256(dkimRelaxedBody(body))
+
+	// Sign the bottom-most unused instance of each named field (RFC 6376
+	// §5.4.2).
+	used := make([]bool, len(fields))
+	var names []string
+	var signed strings.Builder
+	for _, name := range s.headers {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fields[i].name, name) {
+				used[i] = true
+				names = append(names, strings.ToLower(name))
+				signed.WriteString(dkimRelaxedHeader(fields[i].name, fields[i].value))
+				break
+			}
+		}
+	}
+
+	value := fmt.Sprintf("v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s; t=%s; h=%s; bh=%s; b=",
+		s.algorithm, s.domain, s.selector, strconv.FormatInt(now.Unix(), 10),
+		strings.Join(names, ":"), base64.StdEncoding.EncodeToString(bh[:]))
+	signed.WriteString(strings.TrimSuffix(dkimRelaxedHeader("DKIM-Signature", value), "\r\n"))
+
+	digest := sha256.Sum256([]byte(signed.String()))
+	opts := crypto.Hash(0) // Ed25519 signs the SHA-256 digest itself (RFC 8463)
+	if s.algorithm == "rsa-sha256" {
+		opts = crypto.SHA256
+	}
+	sig, err := s.key.Sign(rand.Reader, digest[:], opts)
+	if err != nil {
+		return nil, fmt.Errorf("dkim: %w", err)
+	}
+
+	out := make([]byte, 0, len(raw)+len(value)+400)
+	out = append(out, "DKIM-Signature: "+value+base64.StdEncoding.EncodeToString(sig)+"\r\n"...)
+	return append(out, raw...), nil
+}
+
+// headerField is one (possibly folded) header field.
+type headerField struct {
+	name, value string
+}
+
+// splitHeaderFields splits a CRLF-terminated header block into fields,
+// keeping folded continuation lines with their field.
+func splitHeaderFields(block string) []headerField {
+	var fields []headerField
+	for _, line := range strings.SplitAfter(block, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].value += line
+			continue
+		}
+		name, value, _ := strings.Cut(line, ":")
+		fields = append(fields, headerField{name: name, value: value})
+	}
+	return fields
+}
+
+// dkimRelaxedHeader canonicalizes one header field (RFC 6376 §3.4.2).
+func dkimRelaxedHeader(name, value string) string {
+	value = strings.NewReplacer("\r\n", "").Replace(value)
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(collapseWSP(value)) + "\r\n"
+}
+
+// dkimRelaxedBody canonicalizes a body (RFC 6376 §3.4.4).
+func dkimRelaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(collapseWSP(l), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// collapseWSP replaces each run of spaces and tabs with a single space.
+func collapseWSP(s string) string {
+	var b strings.Builder
+	inWSP := false
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == ' ' || c == '\t' {
+			if !inWSP {
+				b.WriteByte(' ')
+			}
+			inWSP = true
+			continue
+		}
+		inWSP = false
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,223 @@
+package email
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDKIMRelaxedCanonicalization(t *testing.T) {
+	// RFC 6376 §3.4.6 example.
+	fields := splitHeaderFields("A: X\r\nB : Y\t\r\n\tZ  \r\n")
+	var got string
+	for _, f := range fields {
+		got += dkimRelaxedHeader(f.name, f.value)
+	}
+	if want := "a:X\r\nb:Y Z\r\n"; got != want {
+		t.Errorf("relaxed headers = %q, want %q", got, want)
+	}
+	if got, want := string(dkimRelaxedBody([]byte(" C \r\nD \t E\r\n\r\n\r\n"))), " C\r\nD E\r\n"; got != want {
+		t.Errorf("relaxed body = %q, want %q", got, want)
+	}
+	if got := dkimRelaxedBody([]byte("\r\n\r\n")); len(got) != 0 {
+		t.Errorf("relaxed empty body = %q, want empty", got)
+	}
+}
+
+func TestDKIMSign(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		pem    []byte
+		algo   string
+		verify func(digest, sig []byte) bool
+	}{
+		{
+			"rsa", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), "rsa-sha256",
+			func(digest, sig []byte) bool {
+				return rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest, sig) == nil
+			},
+		},
+		{
+			"ed25519", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER}), "ed25519-sha256",
+			func(digest, sig []byte) bool { return ed25519.Verify(edKey.Public().(ed25519.PublicKey), digest, sig) },
+		},
+	}
+
+	msg := &Message{From: "Me <me@example.com>", To: []string{"you@example.net"}, Subject: "Hi", Body: "Hello  there \r\n"}
+	raw, err := renderMessage(msg, rawOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newDKIMSigner(&DKIMConfig{Domain: "example.com", Selector: "sel", PrivateKeyPEM: tt.pem, Headers: []string{"Subject", "X-Missing"}})
+			if err != nil {
+				t.Fatalf("newDKIMSigner: %v", err)
+			}
+			signed, err := s.sign(raw, time.Unix(1700000000, 0))
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			line, rest, _ := strings.Cut(string(signed), "\r\n")
+			if rest != string(raw) {
+				t.Fatal("signed message does not end with the original")
+			}
+			value := strings.TrimPrefix(line, "DKIM-Signature: ")
+			for _, want := range []string{"a=" + tt.algo, "d=example.com", "s=sel", "t=1700000000", "h=from:subject;"} {
+				if !strings.Contains(value, want) {
+					t.Errorf("signature %q lacks %q", value, want)
+				}
+			}
+
+			_, body, _ := strings.Cut(string(raw), "\r\n\r\n")
+			bh := sha256.Sum256(dkimRelaxedBody([]byte(body)))
+			if !strings.Contains(value, "bh="+base64.StdEncoding.EncodeToString(bh[:])) {
+				t.Error("body hash mismatch")
+			}
+
+			i := strings.Index(value, "b=")
+			for strings.Contains(value[i+2:], "b=") { // skip "bh="
+				i += 2 + strings.Index(value[i+2:], "b=")
+			}
+			sig, err := base64.StdEncoding.DecodeString(value[i+2:])
+			if err != nil {
+				t.Fatalf("signature encoding: %v", err)
+			}
+			data := dkimRelaxedHeader("From", " Me <me@example.com>") + dkimRelaxedHeader("Subject", " Hi") +
+				strings.TrimSuffix(dkimRelaxedHeader("DKIM-Signature", value[:i+2]), "\r\n")
+			digest := sha256.Sum256([]byte(data))
+			if !tt.verify(digest[:], sig) {
+				t.Error("signature does not verify")
+			}
+		})
+	}
+}
+
+func TestNewDKIMSignerErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config DKIMConfig
+	}{
+		{"no selector", DKIMConfig{Domain: "example.com", PrivateKeyPEM: []byte("x")}},
+		{"no pem", DKIMConfig{Domain: "example.com", Selector: "s", PrivateKeyPEM: []byte("not a key")}},
+		{"bad der", DKIMConfig{Domain: "example.com", Selector: "s", PrivateKeyPEM: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1, 2}})}},
+	}
+	for _, tt := range tests {
+		if _, err := newDKIMSigner(&tt.config); err == nil {
+			t.Errorf("%s: want error, got nil", tt.name)
+		}
+	}
+}
+
+func TestSignedSMTPMessage(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newDKIMSigner(&DKIMConfig{Domain: "example.com", Selector: "sel", PrivateKeyPEM: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &Message{From: "me@example.com", To: []string{"you@example.net"}, Subject: "Hi", Body: "héllo"}
+	write, id, err := signedSMTPMessage(msg, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(id, "@example.com") {
+		t.Errorf("Message-ID = %q", id)
+	}
+	for _, sevenBit := range []bool{false, true} {
+		var b strings.Builder
+		if err := write(&b, sevenBit); err != nil {
+			t.Fatal(err)
+		}
+		raw := b.String()
+		if !strings.HasPrefix(raw, "DKIM-Signature: ") {
+			t.Errorf("sevenBit=%v: message not signed:\n%s", sevenBit, raw)
+		}
+		// Date and Message-Id are fixed before signing so that both
+		// renderings carry, and sign, the same values.
+		for _, want := range []string{"\r\nDate: ", "\r\nMessage-Id: <" + id + ">"} {
+			if !strings.Contains(raw, want) {
+				t.Errorf("sevenBit=%v: message lacks %q", sevenBit, want)
+			}
+		}
+	}
+}
+
+func TestSignedSMTPMessageRendering(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := newDKIMSigner(&DKIMConfig{Domain: "example.com", Selector: "sel", PrivateKeyPEM: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opens := 0
+	msg := &Message{From: "me@example.com", To: []string{"you@example.net"}, Subject: "Hi", Body: "héllo",
+		Attachments: []Attachment{{Filename: "data.txt", Open: func() (io.ReadCloser, error) {
+			opens++
+			return io.NopCloser(strings.NewReader("data")), nil
+		}}}}
+
+	// Unsigned messages are streamed on each write; signed ones are
+	// rendered once per variant written, and the other variant not at all.
+	for _, tt := range []struct {
+		name   string
+		signer *dkimSigner
+		opens  int
+	}{
+		{"unsigned", nil, 2},
+		{"signed", signer, 1},
+	} {
+		opens = 0
+		write, _, err := signedSMTPMessage(msg, tt.signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var first, second strings.Builder
+		if err := write(&first, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := write(&second, false); err != nil {
+			t.Fatal(err)
+		}
+		if first.String() != second.String() {
+			t.Errorf("%s: writes differ", tt.name)
+		}
+		if opens != tt.opens {
+			t.Errorf("%s: attachment opened %d times, want %d", tt.name, opens, tt.opens)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// eai.go - Internationalized email addresses (EAI, RFC 6530). An address
+// like jörg@bücher.de only needs its domain converted to ASCII (punycode,
+// "xn--bcher-kva.de") to travel like any other: DNS lookups, SMTP envelopes
+// and header fields use that form, so servers without SMTPUTF8 accept it.
+// An address whose local part is non-ASCII (用户@例子.测试) cannot be
+// converted; it is sent as UTF-8 and needs SMTPUTF8 end to end, which the
+// SMTP paths negotiate and refuse cleanly without (see smtpNegotiate).
+package email
+
+import (
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// asciiDomain returns domain with its internationalized labels converted to
+// ASCII (A-labels), lowercased as IDNA maps them. Labels that are already
+// ASCII, wildcards included, and labels that are not valid IDNs are kept
+// as they are.
+func asciiDomain(domain string) string {
+	if isASCII(domain) {
+		return domain
+	}
+	labels := strings.Split(domain, ".")
+	for i, l := range labels {
+		if isASCII(l) {
+			continue
+		}
+		if a, err := idna.Lookup.ToASCII(l); err == nil {
+			labels[i] = a
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// asciiAddress returns the bare address addr with its domain converted by
+// asciiDomain. The local part is kept.
+func asciiAddress(addr string) string {
+	i := strings.LastIndexByte(addr, '@')
+	if i < 0 {
+		return addr
+	}
+	return addr[:i+1] + asciiDomain(addr[i+1:])
+}
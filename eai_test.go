@@ -0,0 +1,48 @@
+package email
+
+import "testing"
+
+func TestASCIIAddress(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"a@example.com", "a@example.com"},
+		{"jörg@bücher.de", "jörg@xn--bcher-kva.de"},
+		{"info@BÜCHER.de", "info@xn--bcher-kva.de"},
+		{"用户@例子.测试", "用户@xn--fsqu00a.xn--0zwm56d"},
+		{"*@*.bücher.de", "*@*.xn--bcher-kva.de"},
+		{"no-at-sign", "no-at-sign"},
+	}
+	for _, tt := range tests {
+		if got := asciiAddress(tt.in); got != tt.want {
+			t.Errorf("asciiAddress(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeAddressListIDN(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"info@bücher.de", "info@xn--bcher-kva.de"},
+		{"Jörg <info@bücher.de>", "=?utf-8?q?J=C3=B6rg?= <info@xn--bcher-kva.de>"},
+		{"Shop <info@bücher.de>", "Shop <info@xn--bcher-kva.de>"},
+		// A UTF-8 mailbox needs SMTPUTF8 anyway; it is left as written.
+		{"用户@例子.测试", "用户@例子.测试"},
+	}
+	for _, tt := range tests {
+		if got := encodeAddressList([]string{tt.in}); got != tt.want {
+			t.Errorf("encodeAddressList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIDNRoutingAndDelivery(t *testing.T) {
+	r := providerRoute{patterns: []string{normalizeRoutePattern("Bücher.de")}}
+	for _, addr := range []string{"info@bücher.de", "info@xn--bcher-kva.de"} {
+		if !r.matches(addr) {
+			t.Errorf("route for bücher.de does not match %s", addr)
+		}
+	}
+
+	groups := groupByDomain([]string{"a@bücher.de", "B <b@xn--bcher-kva.de>", "用户@例子.测试"})
+	if len(groups) != 2 || groups[0].domain != "xn--bcher-kva.de" || len(groups[0].rcpts) != 2 || groups[1].domain != "xn--fsqu00a.xn--0zwm56d" {
+		t.Errorf("groupByDomain() = %+v", groups)
+	}
+}
@@ -31,8 +31,16 @@ package email
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/text/language"
 )
 
 // Message represents an email message with all necessary fields for sending.
@@ -40,7 +48,9 @@ type Message struct {
 	// From is the sender's email address (required)
 	From string
 
-	// To contains the primary recipient email addresses (at least one required)
+	// To contains the primary recipient email addresses. It may be empty
+	// when there are Cc or Bcc recipients; a message with only Bcc
+	// recipients is addressed to "undisclosed-recipients:;".
 	To []string
 
 	// Cc contains carbon copy recipient email addresses (optional)
@@ -59,8 +69,139 @@ type Message struct {
 	// If false, the body is treated as plain text.
 	HTML bool
 
+	// TextBody is a plain-text alternative to an HTML Body (optional), sent
+	// as multipart/alternative for clients that do not render HTML. It is
+	// ignored when HTML is false, and by Outlook 365's JSON API, which only
+	// takes one body; Exchange derives the text alternative itself.
+	TextBody string
+
 	// Attachments contains file attachments (optional)
 	Attachments []Attachment
+
+	// Headers adds custom header fields (optional), e.g. "X-Campaign-ID" or
+	// "Auto-Submitted". Headers rendered from the fields above (From, To,
+	// Subject, Content-Type, ...) cannot be overridden. Outlook 365 maps
+	// "X-" headers to Graph internetMessageHeaders and submits the message as
+	// MIME when any other header is present.
+	Headers map[string]string
+
+	// SentFolder files the saved sent copy into this folder after sending
+	// (optional), e.g. "Automated/Invoices". The path is resolved by display
+	// name from the mailbox root and missing folders are created; a
+	// well-known folder name ("archive") or a folder id is used as is.
+	// Outlook 365 only; Gmail ignores it (see Labels).
+	SentFolder string
+
+	// Labels are applied to the sent message in the sender's mailbox after
+	// sending (optional), e.g. "automated/invoices", on top of
+	// GmailConfig.SentLabels. Missing labels are created; "/" nests them.
+	// Gmail API only: SMTP relay sends with Labels fail, and other
+	// providers ignore it (see SentFolder for Outlook 365).
+	Labels []string
+
+	// SaveToSent controls whether a copy of the message is kept in the
+	// sender's Sent Items (optional); nil applies Config.SaveToSent, and
+	// saving is the default. High-volume automated senders can set it to
+	// false to keep the Sent folder from flooding. Outlook 365 only: Gmail
+	// files every API-sent message under the SENT label and has no option
+	// not to, and SMTP and direct delivery never save a copy. It cannot be
+	// false together with SentFolder, nor for messages Outlook 365 submits
+	// as MIME.
+	SaveToSent *bool
+
+	// DSN requests delivery status notifications (RFC 3461) for SMTP
+	// submissions (optional). It is ignored by API-based sends and by SMTP
+	// servers that do not advertise the DSN extension.
+	DSN *DSNOptions
+
+	// IPPool selects the outbound IP pool (optional), e.g. "bulk" or
+	// "transactional", so traffic classes build separate sender reputations.
+	// Direct delivery only (see DirectConfig.IPPools); other providers ignore
+	// it.
+	IPPool string
+
+	// Priority marks the message as high or low priority (optional). It is
+	// rendered as the X-Priority and Importance headers, which take
+	// precedence over the same headers in Headers, and as the Graph message
+	// importance for Outlook 365.
+	Priority Priority
+
+	// Sensitivity marks the message as personal, private or confidential
+	// (optional). It is rendered as the Sensitivity header (RFC 2156), which
+	// takes precedence over the same header in Headers, and as the message
+	// sensitivity Outlook shows for Outlook 365.
+	Sensitivity Sensitivity
+
+	// Language is the language of the content as a BCP 47 tag (optional),
+	// e.g. "de" or "pt-BR". It is rendered as the Content-Language header
+	// (RFC 3282), which mail clients use for fonts, hyphenation and spell
+	// checking and filters to route by, and as Accept-Language, the
+	// language replies are welcome in; both take precedence over the same
+	// headers in Headers. Templates rendered for a locale set it (see
+	// TemplateStore.RenderLocale). Graph's JSON API takes neither header,
+	// so Outlook 365 submits messages with a Language as MIME.
+	Language string
+
+	// SendAt schedules the message for later delivery (optional). Outlook 365
+	// defers it in the mailbox, which sends it at SendAt; other providers
+	// need Config.Scheduler, which holds it until then. A SendAt in the past
+	// sends at once.
+	SendAt time.Time
+
+	// MIMELayout adjusts the multipart structure and line endings of the
+	// rendered message (optional); the zero value is the standard
+	// structure. Clients apply Config.MIMELayout to messages that leave it
+	// zero. The Outlook 365 JSON API builds its own MIME and ignores it.
+	MIMELayout MIMELayout
+
+	// seal, set by clients configured with Config.SMIME or Config.PGP,
+	// signs or encrypts the message when it is rendered.
+	seal messageSealer
+}
+
+// Priority is a message's importance to the recipient.
+type Priority string
+
+// Message priorities. The zero value leaves the priority unset, which mail
+// clients show as normal.
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = "normal"
+	PriorityLow    Priority = "low"
+)
+
+// Sensitivity is how a message should be treated by its recipients, e.g.
+// HR and legal mail marked confidential.
+type Sensitivity string
+
+// Message sensitivities. The zero value leaves the sensitivity unset, which
+// mail clients show as normal.
+const (
+	SensitivityPersonal     Sensitivity = "personal"
+	SensitivityPrivate      Sensitivity = "private"
+	SensitivityConfidential Sensitivity = "confidential"
+)
+
+// header returns the Sensitivity header value for s.
+func (s Sensitivity) header() string {
+	switch s {
+	case SensitivityPersonal:
+		return "Personal"
+	case SensitivityPrivate:
+		return "Private"
+	}
+	return "Company-Confidential"
+}
+
+// xPriority returns the X-Priority header value for p.
+func (p Priority) xPriority() string {
+	switch p {
+	case PriorityHigh:
+		return "1 (Highest)"
+	case PriorityLow:
+		return "5 (Lowest)"
+	}
+	return "3 (Normal)"
 }
 
 // Attachment represents a file attachment for an email.
@@ -71,24 +212,92 @@ type Attachment struct {
 	// Content is the file content as bytes
 	Content []byte
 
+	// Open, if set, supplies the content instead of Content. It is called
+	// each time the message is rendered (SMTP sizes the message before
+	// sending it) and must return the same content every time; the reader
+	// is base64-encoded as it is streamed, so large files are never held in
+	// memory on the SMTP and Gmail paths. Outlook 365 reads the content in
+	// full, as Graph takes attachments inside the JSON request.
+	Open func() (io.ReadCloser, error)
+
 	// MimeType is the MIME type of the file (optional).
 	// If empty, it will be automatically detected based on the filename.
 	MimeType string
+
+	// Inline embeds the attachment in the HTML body instead of listing it as
+	// a download; the body references it as "cid:" + ContentID, e.g.
+	// <img src="cid:logo">. Requires ContentID.
+	Inline bool
+
+	// ContentID identifies an inline attachment, without angle brackets
+	// (e.g. "logo" or "logo@example.com").
+	ContentID string
+
+	// Encoding selects the attachment's Content-Transfer-Encoding. The zero
+	// value is base64. Outlook 365 encodes attachments itself unless the
+	// message is submitted as MIME.
+	Encoding TransferEncoding
 }
 
-// Provider is the interface that all email providers must implement.
-// This allows for easy addition of new email providers.
-type Provider interface {
+// TransferEncoding is the Content-Transfer-Encoding of an attachment.
+type TransferEncoding string
+
+// Attachment transfer encodings.
+const (
+	// EncodingBase64 suits any content, at a third more than its size.
+	EncodingBase64 TransferEncoding = "base64"
+
+	// EncodingQuotedPrintable keeps mostly-ASCII text readable and close to
+	// its size. Line breaks are sent as CRLF, so it is for text only.
+	EncodingQuotedPrintable TransferEncoding = "quoted-printable"
+
+	// Encoding7Bit sends the content as is, with CRLF line breaks. Sending
+	// fails if the content is not ASCII text in lines of at most 998 bytes.
+	Encoding7Bit TransferEncoding = "7bit"
+
+	// EncodingAuto picks the smallest of the above that fits the content:
+	// 7bit for short-lined ASCII text, quoted-printable for other text/*
+	// content that is mostly ASCII, base64 otherwise. It reads streamed
+	// content in full to decide.
+	EncodingAuto TransferEncoding = "auto"
+)
+
+// DSNOptions are the delivery status notification parameters of an SMTP
+// submission.
+type DSNOptions struct {
+	// Notify lists when to notify the sender: "SUCCESS", "FAILURE",
+	// "DELAY", or only "NEVER". Empty leaves the choice to the server.
+	Notify []string
+
+	// Return selects what a bounce includes: "FULL" message or "HDRS" only.
+	Return string
+
+	// EnvelopeID is an opaque ID echoed back in notifications, e.g. to
+	// correlate bounces with sends.
+	EnvelopeID string
+}
+
+// Sender sends messages.
+type Sender interface {
 	// Send sends an email message using the provider's implementation.
 	// The context can be used for timeout and cancellation.
 	Send(ctx context.Context, msg *Message) error
 }
 
+// Provider is the interface that all email providers must implement.
+// This allows for easy addition of new email providers. Sending is the only
+// required capability; providers add others (Receiver, MailboxManager,
+// AttachmentProvider, ...) by implementing their interfaces.
+type Provider interface {
+	Sender
+}
+
 // Config holds the configuration for creating email providers.
 // Only one provider configuration should be set.
 type Config struct {
 	// Provider specifies which email provider to use.
-	// Supported values: "outlook365", "gmail"
+	// Supported values: "outlook365", "gmail", "direct", and the names of
+	// providers registered with RegisterProvider.
 	Provider string
 
 	// Outlook contains Outlook 365 specific configuration.
@@ -99,8 +308,105 @@ type Config struct {
 	// Required when Provider is "gmail".
 	Gmail *GmailConfig
 
-	// Custom is reserved for future provider extensions
+	// Direct contains direct-to-MX delivery configuration.
+	// Required when Provider is "direct".
+	Direct *DirectConfig
+
+	// Custom holds the settings of providers registered outside this
+	// package, under the keys they document.
 	Custom map[string]interface{}
+
+	// Routes optionally sends messages through a different provider based on
+	// their recipients' domains (e.g. "*@ourcompany.com" via outlook365). A
+	// message goes through the first route matching all of its recipients;
+	// anything else uses the provider configured above. See Route.
+	Routes []Route
+
+	// Usage, if set, accounts every send attempt per tenant/tag (see
+	// WithUsageTags). One meter may be shared by several clients.
+	Usage *UsageMeter
+
+	// Deployment, if set, stamps deployment metadata headers (X-App-Version,
+	// X-Environment, X-Git-Commit) on every message sent. See DeploymentInfo.
+	Deployment *DeploymentInfo
+
+	// RecipientPolicy, if set, warns about or rejects role accounts and
+	// disposable addresses before sending. See RecipientPolicy.
+	RecipientPolicy *RecipientPolicy
+
+	// SkipAddressValidation turns off the address syntax checks of
+	// Message.Validate on Send, for legacy systems whose addresses net/mail
+	// rejects. The required-field checks still apply.
+	SkipAddressValidation bool
+
+	// AllowEmptySubject and AllowEmptyBody let Send accept messages without
+	// a subject or body, e.g. subject-only alerts. See ValidateOptions.
+	AllowEmptySubject bool
+	AllowEmptyBody    bool
+
+	// Duplicates, if set, flags or refuses repeated sends of the same
+	// content to the same recipients. See DuplicateMonitor.
+	Duplicates *DuplicateMonitor
+
+	// Budget, if set, caps the messages this client sends per hour and day.
+	// See SendBudget.
+	Budget *SendBudget
+
+	// SendWindows, if set, pauses sending through this configuration's
+	// provider during blackout periods, e.g. a tenant migration. On a
+	// Route's Config it applies to the route's provider. See SendWindows.
+	SendWindows *SendWindows
+
+	// Templates holds the message templates SendTemplate renders. One
+	// store may be shared by several clients.
+	Templates *TemplateStore
+
+	// BatchApproval, if set, holds batches above a size threshold until an
+	// operator approves them. See SendBatch.
+	BatchApproval *BatchApproval
+
+	// BatchStore, if set, records SendBatch progress per message so that an
+	// interrupted batch can be resumed and reported on. See BatchStore.
+	BatchStore BatchStore
+
+	// HTMLPolicy, if set, sanitizes HTML bodies with SanitizeHTML before
+	// sending, for messages that embed user-generated content. An empty
+	// HTMLPolicy applies the default allowlist.
+	HTMLPolicy *HTMLPolicy
+
+	// BatchWebhook, if set, notifies a URL or callback when a SendBatch
+	// finishes. See BatchWebhook.
+	BatchWebhook *BatchWebhook
+
+	// SMIME, if set, S/MIME signs every message sent with its certificate.
+	// Signed messages are submitted as MIME, so Outlook 365 sends them
+	// through its MIME path and they cannot use SentFolder. Custom
+	// providers do not sign.
+	SMIME *SMIMEConfig
+
+	// PGP, if set, signs and/or encrypts every message sent as PGP/MIME.
+	// Like SMIME, with which it cannot be combined, it applies to the
+	// built-in providers' MIME submission. See PGPConfig.
+	PGP *PGPConfig
+
+	// MIMELayout, if not zero, is the multipart structure of messages whose
+	// own MIMELayout is zero, for downstream gateways and archivers that
+	// require a particular one. See MIMELayout.
+	MIMELayout MIMELayout
+
+	// ZipAttachments, if set, bundles a message's attachments into one zip
+	// archive when together they exceed a size threshold, to stay under
+	// provider limits. See AttachmentZip.
+	ZipAttachments *AttachmentZip
+
+	// Scheduler, if set, holds messages with a future Message.SendAt for
+	// providers that cannot schedule them, and sends them when due. One
+	// Scheduler may be shared by several clients. See Scheduler.
+	Scheduler *Scheduler
+
+	// SaveToSent, if set, is whether to keep a copy of messages whose own
+	// SaveToSent is nil in the sender's Sent Items. See Message.SaveToSent.
+	SaveToSent *bool
 }
 
 // OutlookConfig holds Outlook 365 specific configuration for OAuth2 authentication.
@@ -114,12 +420,94 @@ type OutlookConfig struct {
 	// ClientSecret is the Azure AD application client secret
 	ClientSecret string
 
+	// TokenJSON, if set, sends as a signed-in user with delegated
+	// permissions instead of as the application: it is the token
+	// OutlookAuthHelper.Authenticate returns, whose refresh token renews
+	// access silently. ClientSecret is not used. The app registration must
+	// allow public client flows and hold the delegated Mail.Send
+	// permission; messages can only be sent from the user's own address
+	// and mailboxes the user may send as.
+	TokenJSON []byte
+
+	// RefreshToken, if set, sends as the user it was issued for, like
+	// TokenJSON: it is a refresh token the application obtained through its
+	// own authorization code flow (with the offline_access scope) and
+	// stored for the user, e.g. in a SaaS app that sends as whoever is
+	// signed in. Access tokens are obtained and renewed from it silently.
+	// ClientSecret, if set, authenticates the application as a confidential
+	// client, as it did when it redeemed the code. Set one Client per user.
+	RefreshToken string
+
+	// OnRefreshToken, if set, is called with the new refresh token when
+	// Azure AD issues one while renewing access for RefreshToken or
+	// TokenJSON. Azure AD rotates refresh tokens and the old one eventually
+	// stops working, so store the new one in its place.
+	OnRefreshToken func(refreshToken string)
+
+	// Credential, if set, is the azcore.TokenCredential the provider gets
+	// Graph access tokens from, e.g. an azidentity workload identity,
+	// managed identity, Azure CLI or chained credential, in place of
+	// ClientSecret, TokenJSON and RefreshToken, which must then be empty.
+	// Tokens are requested for the cloud's Graph ".default" scope. It is
+	// typed any so that programs built without the Outlook provider do not
+	// link the Azure SDK; a value of another type is an error.
+	Credential any
+
 	// UserID is the mailbox (user principal name or object id) that the read
 	// and management operations of MailboxProvider act on, e.g.
 	// "info@deltalegal.com.au". It is not required for sending — Send keys off
 	// the message's From address — but the mailbox operations (List, Read,
 	// Move, ...) need a concrete target and return an error if it is empty.
 	UserID string
+
+	// CloudEnvironment selects the Microsoft cloud the tenant lives in:
+	// CloudPublic (default, also GCC), CloudUSGovHigh, CloudUSGovDoD or
+	// CloudChina. It switches both the Azure AD authority and the Graph host.
+	CloudEnvironment string
+
+	// BaseURL overrides the Microsoft Graph endpoint, including the version
+	// path (e.g. "http://localhost:8080/v1.0" for a mock server). Defaults to
+	// the CloudEnvironment's Graph root. Tokens are still requested for the
+	// cloud's Graph resource.
+	BaseURL string
+
+	// HTTPClient, if set, carries both Graph and Azure AD token requests, e.g.
+	// to route through an egress proxy or a test transport. The SDK's retry
+	// and redirect handling is layered on top of its Transport.
+	HTTPClient *http.Client
+
+	// MaxRecipients caps the recipients (To, Cc and Bcc together) of one
+	// Graph message; Exchange Online rejects messages over the mailbox's
+	// recipient limit, 500 by default. A message with more is sent as
+	// several, each to a consecutive slice of its recipient lists.
+	// Defaults to 500; negative disables splitting.
+	MaxRecipients int
+
+	// OnChunk, if set, is called after each chunk of a split message is
+	// sent or fails, e.g. to record which chunk each recipient landed in.
+	OnChunk func(SendChunk)
+
+	// Throttle, if set, paces this client's Graph requests. Share one
+	// (see SharedGraphThrottle) between all Clients of the same app and
+	// tenant so that together they stay within Microsoft's limits.
+	Throttle *GraphThrottle
+}
+
+// SendChunk reports one of the messages a split send went out as.
+type SendChunk struct {
+	// Index is the chunk's position, from 0, of Total.
+	Index, Total int
+
+	// Recipients are the chunk's addresses, as given in To, Cc and Bcc.
+	Recipients []string
+
+	// Result identifies the sent chunk. It is nil on failure, and for
+	// chunks sent by Send, which reports no identifiers.
+	Result *SendResult
+
+	// Err is why the chunk was not sent. Chunks after a failed one are not
+	// attempted.
+	Err error
 }
 
 // GmailConfig holds Gmail specific configuration for OAuth2 authentication.
@@ -138,12 +526,220 @@ type GmailConfig struct {
 	// deletion. Widening scopes requires re-running the consent flow and
 	// replacing the stored token.
 	Scopes []string
+
+	// SMTPRelay sends through Gmail's SMTP server with XOAUTH2 instead of the
+	// Gmail REST API, for Workspace tenants that restrict the API but allow
+	// SMTP. XOAUTH2 requires the full gmail.MailGoogleComScope, which becomes
+	// the default scope in this mode. Mailbox operations still use the API.
+	SMTPRelay bool
+
+	// SMTPAddr overrides the SMTP server (host:port) used by SMTPRelay.
+	// Defaults to "smtp.gmail.com:587"; Workspace relay customers may use
+	// "smtp-relay.gmail.com:587".
+	SMTPAddr string
+
+	// SMTPUser is the account SMTPRelay authenticates as. Defaults to the
+	// message's From address; set it when sending from an alias.
+	SMTPUser string
+
+	// SMTPSecurity selects implicit TLS, STARTTLS or opportunistic TLS for
+	// SMTPRelay. The default (SMTPSecurityAuto) decides by port: 465 implicit
+	// TLS, 587 STARTTLS.
+	SMTPSecurity SMTPSecurity
+
+	// SMTPPins optionally pins the relay's TLS certificate: base64 SHA-256
+	// hashes of acceptable SubjectPublicKeyInfos ("sha256/..." accepted). One
+	// certificate in the presented chain must match; regular chain
+	// validation still applies.
+	SMTPPins []string
+
+	// DKIM, if set, DKIM-signs messages submitted by SMTPRelay with the
+	// sender's own domain key, so that they pass DMARC for that domain
+	// whether or not Google signs them for it. It requires SMTPRelay: the
+	// Gmail API rewrites messages it is handed.
+	DKIM *DKIMConfig
+
+	// DailyLimit is how many messages each sending account may send per
+	// day, e.g. 2000 for Workspace or 500 for consumer Gmail. Days run from
+	// midnight to midnight Pacific Time, when Google resets quotas. Sends
+	// past it fail with a *QuotaExceededError without reaching Gmail.
+	// Zero sets no local limit; either way, once Gmail itself refuses a send
+	// for the sending limit, the account's sends fail the same way until
+	// midnight. See Client.Quota.
+	DailyLimit int
+
+	// SentLabels are applied to every message sent, like Message.Labels.
+	// They cannot be combined with SMTPRelay, which returns no message id
+	// to label.
+	SentLabels []string
+
+	// VerifySendAs checks each message's From address against the
+	// account's send-as aliases before sending. Gmail rewrites the sender
+	// of a message from an address that is not a verified alias to the
+	// account's primary address without an error; with VerifySendAs such a
+	// send fails with a *SendAsError instead. A From without a display name
+	// gets the alias's. The aliases are read with the Gmail settings API,
+	// which the default gmail.modify scope covers.
+	VerifySendAs bool
+
+	// BaseURL overrides the Gmail API endpoint (default
+	// "https://gmail.googleapis.com/"), e.g. for an emulator or mock server.
+	BaseURL string
+
+	// HTTPClient, if set, carries both Gmail API and OAuth2 token refresh
+	// requests, e.g. to route through an egress proxy. The OAuth2 transport
+	// is layered on top of its Transport.
+	HTTPClient *http.Client
+
+	// TokenSource, if set, is the golang.org/x/oauth2 TokenSource the
+	// provider gets access tokens from, in place of CredentialsJSON and
+	// TokenJSON, which must then be empty: e.g. Application Default
+	// Credentials from google.DefaultTokenSource, or a service account
+	// impersonating the sending user. Its tokens need the scopes the
+	// provider's operations use (see Scopes); Scopes itself is not read.
+	// It is typed any so that programs built without the Gmail provider do
+	// not link the OAuth2 packages; a value of another type is an error.
+	TokenSource any
+
+	// AuthClient, if set, is an HTTP client that already authorizes its
+	// requests, e.g. one from google.DefaultClient or oauth2.Config.Client;
+	// the provider sends its API requests through it as is. It replaces
+	// CredentialsJSON, TokenJSON and TokenSource, which must then be empty,
+	// and HTTPClient is not used. SMTPRelay needs access tokens of its own,
+	// so it requires TokenSource or TokenJSON instead.
+	AuthClient *http.Client
+}
+
+// DirectConfig configures direct-to-MX delivery: the client resolves each
+// recipient domain's MX hosts and delivers over port 25 itself, for senders
+// operating their own infrastructure (static IP with matching PTR, SPF and
+// DKIM records) rather than a relay.
+type DirectConfig struct {
+	// Hostname is announced in EHLO and should match the sending IP's
+	// reverse DNS. Defaults to os.Hostname().
+	Hostname string
+
+	// DKIM signs every message when set. Receivers increasingly reject
+	// unsigned mail from unknown senders, so this is strongly recommended.
+	DKIM *DKIMConfig
+
+	// DisableMTASTS skips MTA-STS policy lookups. Leave it unset unless
+	// HTTPS egress to recipient domains is impossible.
+	DisableMTASTS bool
+
+	// DNSSECResolver is a DNSSEC-validating resolver (host:port), ideally on
+	// localhost, used for DANE TLSA lookups. Empty disables DANE.
+	DNSSECResolver string
+
+	// RetrySchedule is the delay before each retry of a deferred delivery;
+	// the last delay repeats. Defaults to 5m, 15m, 30m, 1h, 2h, 4h.
+	RetrySchedule []time.Duration
+
+	// GreylistRetrySchedule replaces RetrySchedule after a greylisting reply:
+	// a 450/451 asking the sender to try again later. Greylisting servers
+	// only accept a retry after a minimum wait, commonly 5 to 15 minutes, and
+	// an early retry may restart it. Defaults to 15m, 30m, 1h, 2h, 4h.
+	GreylistRetrySchedule []time.Duration
+
+	// MaxQueueTime is how long a deferred delivery is retried before it
+	// fails. Defaults to 5 days.
+	MaxQueueTime time.Duration
+
+	// OnFailure is called when a deferred delivery fails permanently or
+	// expires. Failures during Send itself are returned by Send instead.
+	OnFailure func(DeliveryFailure)
+
+	// HTTPClient fetches MTA-STS policies. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// IPPools names groups of local source addresses to deliver from,
+	// selected per message with Message.IPPool. Messages without an IPPool
+	// use DefaultIPPool, or the system's choice of address if that is empty.
+	IPPools map[string]IPPool
+
+	// DefaultIPPool is the pool for messages that do not name one.
+	DefaultIPPool string
+}
+
+// IPPool is a group of local addresses that share a sending reputation.
+type IPPool struct {
+	// Addrs are local IPv4/IPv6 addresses assigned to this host, used in
+	// rotation.
+	Addrs []string `doc:"Local IPv4/IPv6 addresses of this host, used in rotation." required:"true"`
+
+	// Hostname overrides DirectConfig.Hostname for connections from this
+	// pool, so EHLO matches the pool addresses' reverse DNS.
+	Hostname string `doc:"EHLO name for this pool, matching its addresses' reverse DNS."`
 }
 
 // Client is the main email client that wraps a provider implementation.
 // It is thread-safe and can be used concurrently.
 type Client struct {
 	provider Provider
+
+	// name is the default provider's name (Config.Provider), for SendVia.
+	name string
+
+	// routes are the optional recipient-domain routes consulted by Send,
+	// guarded by mu as ReloadRoutes may replace them.
+	mu     sync.RWMutex
+	routes []providerRoute
+
+	// usage is the optional send accounting meter.
+	usage *UsageMeter
+
+	// stamp holds the deployment headers added to every message.
+	stamp map[string]string
+
+	// policy is the optional recipient policy, guarded by mu as WatchConfig
+	// may replace it.
+	policy *recipientPolicy
+
+	// duplicates is the optional duplicate-content monitor.
+	duplicates *DuplicateMonitor
+
+	// budget is the optional hard send cap, guarded by mu as WatchConfig
+	// may replace it.
+	budget *sendBudget
+
+	// windows holds the default provider's optional blackouts.
+	windows *SendWindows
+
+	// templates is the optional template store for SendTemplate.
+	templates *TemplateStore
+
+	// approval is the optional approval gate for SendBatch.
+	approval *BatchApproval
+
+	// batchStore is the optional SendBatch progress store.
+	batchStore BatchStore
+
+	// sanitizer is the compiled Config.HTMLPolicy, if any.
+	sanitizer *htmlSanitizer
+
+	// batchHook is the optional batch completion notification.
+	batchHook *BatchWebhook
+
+	// sealer is the optional S/MIME or PGP signer.
+	sealer messageSealer
+
+	// layout is the default MIMELayout of messages.
+	layout MIMELayout
+
+	// zip is the optional attachment zipping.
+	zip *AttachmentZip
+
+	// scheduler holds messages to be sent later, if any.
+	scheduler *Scheduler
+
+	// saveToSent is the default Message.SaveToSent, if any.
+	saveToSent *bool
+
+	// idempotency remembers sends made WithIdempotencyKey.
+	idempotency idempotencyKeys
+
+	// validation holds the Config validation switches applied on Send.
+	validation ValidateOptions
 }
 
 // NewClient creates a new email client with the specified configuration.
@@ -162,74 +758,371 @@ type Client struct {
 //
 //	client, err := email.NewClient(config)
 func NewClient(config *Config) (*Client, error) {
-	var provider Provider
-	var err error
+	provider, err := newProvider(config)
+	if err != nil {
+		return nil, err
+	}
 
-	switch config.Provider {
-	case ProviderOutlook365:
-		if config.Outlook == nil {
-			return nil, fmt.Errorf("outlook configuration is required")
+	routes, err := newRoutes(config.Routes, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routes: %w", err)
+	}
+
+	var stamp map[string]string
+	if config.Deployment != nil {
+		if stamp, err = config.Deployment.headers(); err != nil {
+			return nil, err
 		}
-		provider, err = newOutlookProvider(config.Outlook)
-	case ProviderGmail:
-		if config.Gmail == nil {
-			return nil, fmt.Errorf("gmail configuration is required")
+	}
+
+	var policy *recipientPolicy
+	if config.RecipientPolicy != nil {
+		if policy, err = newRecipientPolicy(config.RecipientPolicy); err != nil {
+			return nil, err
 		}
-		provider, err = newGmailProvider(config.Gmail)
-	default:
-		return nil, fmt.Errorf("unsupported provider: %s", config.Provider)
 	}
 
+	var budget *sendBudget
+	if config.Budget != nil {
+		if budget, err = newSendBudget(config.Budget); err != nil {
+			return nil, err
+		}
+	}
+
+	windows, err := newSendWindows(config.SendWindows)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create provider: %w", err)
+		return nil, err
+	}
+
+	var sanitizer *htmlSanitizer
+	if config.HTMLPolicy != nil {
+		sanitizer = config.HTMLPolicy.compile()
+	}
+
+	var zip *AttachmentZip
+	if config.ZipAttachments != nil {
+		if err := config.ZipAttachments.validate(); err != nil {
+			return nil, err
+		}
+		z := *config.ZipAttachments
+		zip = &z
 	}
 
-	return &Client{provider: provider}, nil
+	var sealer messageSealer
+	switch {
+	case config.SMIME != nil && config.PGP != nil:
+		return nil, fmt.Errorf("SMIME and PGP cannot both be configured")
+	case config.SMIME != nil:
+		if sealer, err = newSMIMESigner(config.SMIME); err != nil {
+			return nil, err
+		}
+	case config.PGP != nil:
+		if sealer, err = newPGPSealer(config.PGP); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Client{
+		provider:   provider,
+		name:       config.Provider,
+		routes:     routes,
+		usage:      config.Usage,
+		stamp:      stamp,
+		policy:     policy,
+		duplicates: config.Duplicates,
+		budget:     budget,
+		windows:    windows,
+		templates:  config.Templates,
+		approval:   config.BatchApproval,
+		batchStore: config.BatchStore,
+		sanitizer:  sanitizer,
+		batchHook:  config.BatchWebhook,
+		sealer:     sealer,
+		layout:     config.MIMELayout,
+		zip:        zip,
+		scheduler:  config.Scheduler,
+		saveToSent: config.SaveToSent,
+		validation: ValidateOptions{
+			SkipAddresses:     config.SkipAddressValidation,
+			AllowEmptySubject: config.AllowEmptySubject,
+			AllowEmptyBody:    config.AllowEmptyBody,
+		},
+	}, nil
+}
+
+// newProvider creates the provider selected by config.Provider.
+func newProvider(config *Config) (Provider, error) {
+	factory, err := providerFactory(config.Provider)
+	if err != nil {
+		return nil, err
+	}
+	return factory(config)
 }
 
 // Send sends an email message with a default timeout of 30 seconds.
 // It validates the message before sending and returns an error if
-// validation fails or the send operation fails.
-func (c *Client) Send(msg *Message) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	return c.SendWithContext(ctx, msg)
+// validation fails or the send operation fails. opts adjust this send;
+// see SendOption.
+func (c *Client) Send(msg *Message, opts ...SendOption) error {
+	o := newSendOptions(opts)
+	if o.timeout <= 0 {
+		o.timeout = defaultTimeout
+	}
+	_, err := c.sendWithOptions(context.Background(), msg, false, o)
+	return err
 }
 
 // SendWithContext sends an email message with a custom context.
 // This allows for custom timeouts, cancellation, and passing request-scoped values.
-// The message is validated before sending.
+// The message is validated before sending and, when the client has Routes,
+// sent through the provider of the route matching its recipients.
 //
 // Example:
 //
 //	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 //	defer cancel()
 //
-//	err := client.SendWithContext(ctx, msg)
-func (c *Client) SendWithContext(ctx context.Context, msg *Message) error {
+//	err := client.SendWithContext(ctx, msg, email.WithIdempotencyKey(orderID))
+func (c *Client) SendWithContext(ctx context.Context, msg *Message, opts ...SendOption) error {
+	_, err := c.sendWithOptions(ctx, msg, false, newSendOptions(opts))
+	return err
+}
+
+// send validates msg, sends it through provider and accounts the attempt.
+// With result set, providers implementing ResultSender report the sent
+// message's identifiers; otherwise the SendResult is empty.
+func (c *Client) send(ctx context.Context, provider Provider, msg *Message, result bool) (*SendResult, error) {
+	msg = repairText(msg)
+
 	// Validate message
-	if err := msg.Validate(); err != nil {
-		return fmt.Errorf("invalid message: %w", err)
+	if err := msg.ValidateWith(c.validation); err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	if p := c.recipientPolicy(); p != nil {
+		if err := p.check(msg); err != nil {
+			return nil, err
+		}
+	}
+	if msg.SendAt.After(time.Now()) && !dryRun(ctx) && !c.schedulesNatively(provider, msg) {
+		return c.schedule(ctx, provider, msg)
+	}
+	if c.sanitizer != nil && msg.HTML {
+		clean := *msg
+		clean.Body = c.sanitizer.sanitize(msg.Body)
+		msg = &clean
+	}
+	if c.zip != nil {
+		zipped, err := c.zip.apply(msg)
+		if err != nil {
+			return nil, err
+		}
+		msg = zipped
+	}
+	if err := c.checkSize(provider, msg); err != nil {
+		return nil, err
+	}
+	if dryRun(ctx) {
+		prepared, err := c.prepare(msg)
+		if err != nil {
+			return nil, err
+		}
+		return renderDryRun(prepared)
+	}
+	if err := c.awaitWindow(ctx, provider, msg); err != nil {
+		return nil, err
+	}
+	if c.duplicates != nil {
+		if err := c.duplicates.check(msg); err != nil {
+			return nil, err
+		}
+	}
+	msg, err := c.prepare(msg)
+	if err != nil {
+		return nil, err
+	}
+	// Taken last, so that only messages handed to the provider count.
+	if b := c.sendLimits(); b != nil {
+		if err := b.take(); err != nil {
+			return nil, err
+		}
+	}
+
+	var res *SendResult
+	if rs, ok := provider.(ResultSender); ok && result {
+		res, err = rs.SendWithResult(ctx, msg)
+	} else if err = provider.Send(ctx, msg); err == nil {
+		res = &SendResult{}
+	}
+	if c.usage != nil {
+		c.usage.record(ctx, msg, err)
+	}
+	return res, err
+}
+
+// prepare returns msg as handed to the provider: with the deployment
+// headers, the default MIMELayout and the signer applied.
+func (c *Client) prepare(msg *Message) (*Message, error) {
+	msg = stampHeaders(msg, c.stamp)
+	if c.layout != (MIMELayout{}) && msg.MIMELayout == (MIMELayout{}) {
+		laid := *msg
+		laid.MIMELayout = c.layout
+		msg = &laid
 	}
+	if c.saveToSent != nil && msg.SaveToSent == nil {
+		saved := *msg
+		saved.SaveToSent = c.saveToSent
+		msg = &saved
+	}
+	if c.sealer != nil {
+		if err := c.sealer.check(msg); err != nil {
+			return nil, err
+		}
+		sealed := *msg
+		sealed.seal = c.sealer
+		msg = &sealed
+	}
+	return msg, nil
+}
 
-	return c.provider.Send(ctx, msg)
+// validateAddresses parses every address of m, naming the offending field
+// and index on error ("invalid to[1] address ...").
+func validateAddresses(m *Message) error {
+	if _, err := mail.ParseAddress(m.From); err != nil {
+		return fmt.Errorf("invalid from address %q: %w", m.From, err)
+	}
+	for _, f := range []struct {
+		name  string
+		addrs []string
+	}{{"to", m.To}, {"cc", m.Cc}, {"bcc", m.Bcc}} {
+		for i, a := range f.addrs {
+			if _, err := mail.ParseAddress(a); err != nil {
+				return fmt.Errorf("invalid %s[%d] address %q: %w", f.name, i, a, err)
+			}
+		}
+	}
+	return nil
 }
 
-// Validate checks if the message has all required fields.
+// Validate checks if the message has all required fields and that every
+// address is syntactically valid (RFC 5322, as parsed by net/mail; either a
+// bare address or "Name <address>").
 // It returns an error describing the first validation failure found.
 func (m *Message) Validate() error {
+	return m.ValidateWith(ValidateOptions{})
+}
+
+// ValidateOptions relaxes the checks of Message.ValidateWith. The zero value
+// applies every check, as Validate does.
+type ValidateOptions struct {
+	// SkipAddresses turns off the address syntax checks, for legacy systems
+	// whose addresses net/mail rejects.
+	SkipAddresses bool
+
+	// AllowEmptySubject accepts a message without a subject.
+	AllowEmptySubject bool
+
+	// AllowEmptyBody accepts a message without a body, e.g. a subject-only
+	// alert. An attachment-only message also needs it.
+	AllowEmptyBody bool
+}
+
+// ValidateWith is Validate with the checks relaxed per opts. Clients apply
+// the options set in their Config.
+func (m *Message) ValidateWith(opts ValidateOptions) error {
 	if m.From == "" {
 		return fmt.Errorf("from address is required")
 	}
-	if len(m.To) == 0 {
+	if len(m.To)+len(m.Cc)+len(m.Bcc) == 0 {
 		return fmt.Errorf("at least one recipient is required")
 	}
-	if m.Subject == "" {
+	if !opts.SkipAddresses {
+		if err := validateAddresses(m); err != nil {
+			return err
+		}
+	}
+	if m.Subject == "" && !opts.AllowEmptySubject {
 		return fmt.Errorf("subject is required")
 	}
-	if m.Body == "" {
+	if m.Body == "" && !opts.AllowEmptyBody {
 		return fmt.Errorf("body is required")
 	}
+	for name, value := range m.Headers {
+		if err := validateHeader(name, value); err != nil {
+			return err
+		}
+	}
+	if err := validateAttachments(m.Attachments); err != nil {
+		return err
+	}
+	switch m.Priority {
+	case "", PriorityHigh, PriorityNormal, PriorityLow:
+	default:
+		return fmt.Errorf("invalid priority %q", m.Priority)
+	}
+	switch m.Sensitivity {
+	case "", SensitivityPersonal, SensitivityPrivate, SensitivityConfidential:
+	default:
+		return fmt.Errorf("invalid sensitivity %q", m.Sensitivity)
+	}
+	for i, l := range m.Labels {
+		if strings.TrimSpace(l) == "" {
+			return fmt.Errorf("label %d is empty", i)
+		}
+	}
+	if m.Language != "" {
+		if _, err := language.Parse(m.Language); err != nil {
+			return fmt.Errorf("invalid language %q: %w", m.Language, err)
+		}
+	}
+	if m.DSN != nil {
+		if err := m.DSN.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateAttachments checks every attachment and returns all problems
+// found, joined: missing or ambiguous filenames, empty content and invalid
+// content ids and encodings. Filenames must not contain path separators,
+// which some clients turn into directories or cut off, and regular
+// attachments must have distinct names so that none is saved over another.
+func validateAttachments(attachments []Attachment) error {
+	var errs []error
+	seen := make(map[string]bool)
+	for i, att := range attachments {
+		fail := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("attachment %d (%q): "+format, append([]any{i, att.Filename}, args...)...))
+		}
+		switch {
+		case strings.TrimSpace(att.Filename) == "":
+			fail("filename is required")
+		case strings.ContainsAny(att.Filename, "/\\"):
+			fail("filename contains a path separator")
+		case !att.Inline && seen[strings.ToLower(att.Filename)]:
+			fail("duplicate filename")
+		}
+		if !att.Inline {
+			seen[strings.ToLower(att.Filename)] = true
+		}
+		if att.Open == nil && len(att.Content) == 0 {
+			fail("content is empty")
+		}
+		if att.Inline && att.ContentID == "" {
+			fail("inline attachment requires a content id")
+		}
+		if strings.ContainsAny(att.ContentID, "<>\r\n \t") {
+			fail("invalid content id %q", att.ContentID)
+		}
+		switch att.Encoding {
+		case "", EncodingBase64, EncodingQuotedPrintable, Encoding7Bit, EncodingAuto:
+		default:
+			fail("invalid encoding %q", att.Encoding)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid attachments: %w", errors.Join(errs...))
+	}
 	return nil
 }
 
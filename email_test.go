@@ -3,6 +3,9 @@ package email
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
 	"time"
 )
@@ -68,6 +71,50 @@ func TestMessageValidation(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid display names and internationalized address",
+			message: &Message{
+				From:    `"Müller, Jörg" <joerg@example.com>`,
+				To:      []string{"Jane Doe <jane@example.com>", "jörg@example.de"},
+				Subject: "Test Subject",
+				Body:    "Test body",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid from address",
+			message: &Message{
+				From:    "sender",
+				To:      []string{"recipient@example.com"},
+				Subject: "Test Subject",
+				Body:    "Test body",
+			},
+			wantErr: true,
+			errMsg:  `invalid from address "sender": mail: missing '@' or angle-addr`,
+		},
+		{
+			name: "invalid cc address",
+			message: &Message{
+				From:    "sender@example.com",
+				To:      []string{"recipient@example.com"},
+				Cc:      []string{"cc@example.com", "cc@@example.com"},
+				Subject: "Test Subject",
+				Body:    "Test body",
+			},
+			wantErr: true,
+			errMsg:  `invalid cc[1] address "cc@@example.com": mail: missing '@' or angle-addr`,
+		},
+		{
+			name: "several addresses in one entry",
+			message: &Message{
+				From:    "sender@example.com",
+				To:      []string{"a@example.com, b@example.com"},
+				Subject: "Test Subject",
+				Body:    "Test body",
+			},
+			wantErr: true,
+			errMsg:  `invalid to[0] address "a@example.com, b@example.com": mail: expected single address, got ", b@example.com"`,
+		},
 		{
 			name: "missing from address",
 			message: &Message{
@@ -99,6 +146,16 @@ func TestMessageValidation(t *testing.T) {
 			wantErr: true,
 			errMsg:  "at least one recipient is required",
 		},
+		{
+			name: "bcc only",
+			message: &Message{
+				From:    "sender@example.com",
+				Bcc:     []string{"subscriber@example.com"},
+				Subject: "Test Subject",
+				Body:    "Test body",
+			},
+			wantErr: false,
+		},
 		{
 			name: "missing subject",
 			message: &Message{
@@ -119,6 +176,18 @@ func TestMessageValidation(t *testing.T) {
 			wantErr: true,
 			errMsg:  "body is required",
 		},
+		{
+			name: "empty label",
+			message: &Message{
+				From:    "sender@example.com",
+				To:      []string{"recipient@example.com"},
+				Subject: "Test Subject",
+				Body:    "Test body",
+				Labels:  []string{"invoices", " "},
+			},
+			wantErr: true,
+			errMsg:  "label 1 is empty",
+		},
 	}
 
 	for _, tt := range tests {
@@ -169,6 +238,9 @@ func TestNewClient(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			if _, err := providerFactory(tt.config.Provider); err != nil && excludedProviders[tt.config.Provider] != "" {
+				t.Skip(err)
+			}
 			_, err := NewClient(tt.config)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewClient() error = %v, wantErr %v", err, tt.wantErr)
@@ -386,3 +458,161 @@ func BenchmarkClientSend(b *testing.B) {
 		_ = client.Send(msg)
 	}
 }
+
+func TestMessageValidationInline(t *testing.T) {
+	msg := &Message{
+		From:        "a@example.com",
+		To:          []string{"b@example.com"},
+		Subject:     "s",
+		Body:        "b",
+		Attachments: []Attachment{{Filename: "logo.png", Content: []byte("png"), Inline: true}},
+	}
+	if err := msg.Validate(); err == nil {
+		t.Error("inline attachment without content id accepted")
+	}
+	msg.Attachments[0].ContentID = "<logo>"
+	if err := msg.Validate(); err == nil {
+		t.Error("content id with angle brackets accepted")
+	}
+	msg.Attachments[0].ContentID = "logo"
+	if err := msg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestMessageValidationAttachments(t *testing.T) {
+	stream := func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader("x")), nil }
+	tests := []struct {
+		name        string
+		attachments []Attachment
+		want        []string // substrings of the error, none for valid
+	}{
+		{"valid", []Attachment{{Filename: "a.pdf", Content: []byte("x")}, {Filename: "big.csv", Open: stream}}, nil},
+		{"empty filename", []Attachment{{Filename: " ", Content: []byte("x")}}, []string{"filename is required"}},
+		{"path separator", []Attachment{{Filename: `reports\q3.pdf`, Content: []byte("x")}}, []string{"path separator"}},
+		{"empty content", []Attachment{{Filename: "a.pdf"}}, []string{"content is empty"}},
+		{"duplicates", []Attachment{{Filename: "a.pdf", Content: []byte("x")}, {Filename: "A.PDF", Content: []byte("y")}}, []string{`attachment 1 ("A.PDF"): duplicate filename`}},
+		{"inline same name", []Attachment{
+			{Filename: "image.png", Content: []byte("x"), Inline: true, ContentID: "a"},
+			{Filename: "image.png", Content: []byte("y"), Inline: true, ContentID: "b"},
+		}, nil},
+		{"aggregated", []Attachment{{Filename: "", Content: []byte("x")}, {Filename: "dir/b.txt"}}, []string{"filename is required", "path separator", "content is empty"}},
+	}
+	for _, tt := range tests {
+		msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b", Attachments: tt.attachments}
+		err := msg.Validate()
+		if (err != nil) != (len(tt.want) > 0) {
+			t.Errorf("%s: Validate() = %v", tt.name, err)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q does not mention %q", tt.name, err, want)
+			}
+		}
+	}
+}
+
+func TestClientSkipAddressValidation(t *testing.T) {
+	msg := &Message{From: "legacy-system", To: []string{"ops"}, Subject: "s", Body: "b"}
+	mock := &mockProvider{}
+	if err := (&Client{provider: mock}).Send(msg); err == nil {
+		t.Error("Send() error = nil, want address validation error")
+	}
+	if err := (&Client{provider: mock, validation: ValidateOptions{SkipAddresses: true}}).Send(msg); err != nil {
+		t.Errorf("Send() with SkipAddressValidation error = %v", err)
+	}
+	if len(mock.calls) != 1 {
+		t.Errorf("provider called %d times, want 1", len(mock.calls))
+	}
+}
+
+func TestValidateWith(t *testing.T) {
+	alert := &Message{From: "monitor@example.com", To: []string{"oncall@example.com"}, Subject: "disk full on db-3"}
+	untitled := &Message{From: "a@example.com", To: []string{"b@example.com"}, Body: "b"}
+	tests := []struct {
+		name    string
+		msg     *Message
+		opts    ValidateOptions
+		wantErr string
+	}{
+		{"empty body", alert, ValidateOptions{}, "body is required"},
+		{"empty body allowed", alert, ValidateOptions{AllowEmptyBody: true}, ""},
+		{"empty subject", untitled, ValidateOptions{AllowEmptyBody: true}, "subject is required"},
+		{"empty subject allowed", untitled, ValidateOptions{AllowEmptySubject: true}, ""},
+		{"still needs recipients", &Message{From: "a@example.com"}, ValidateOptions{AllowEmptySubject: true, AllowEmptyBody: true}, "at least one recipient is required"},
+	}
+	for _, tt := range tests {
+		err := tt.msg.ValidateWith(tt.opts)
+		if got := fmt.Sprint(err); (tt.wantErr == "" && err != nil) || (tt.wantErr != "" && got != tt.wantErr) {
+			t.Errorf("%s: ValidateWith() = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	mock := &mockProvider{}
+	c := &Client{provider: mock, validation: ValidateOptions{AllowEmptyBody: true}}
+	if err := c.Send(alert); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	raw, err := buildRawMessage(&mock.calls[0], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, body, _ := strings.Cut(string(raw), "\r\n\r\n"); strings.TrimSpace(body) != "" {
+		t.Errorf("body = %q, want empty", body)
+	}
+}
+
+func TestMessageValidationPriority(t *testing.T) {
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b", Priority: "urgent"}
+	if err := msg.Validate(); err == nil || err.Error() != `invalid priority "urgent"` {
+		t.Errorf("Validate() error = %v, want invalid priority", err)
+	}
+	msg.Priority = PriorityLow
+	if err := msg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestClientMIMELayoutDefault(t *testing.T) {
+	mock := &mockProvider{}
+	c := &Client{provider: mock, layout: MIMELayout{AlwaysMixed: true}}
+	own := MIMELayout{RelatedOutside: true}
+	for _, msg := range []*Message{
+		{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"},
+		{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b", MIMELayout: own},
+	} {
+		if err := c.SendWithContext(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := mock.calls[0].MIMELayout; got != c.layout {
+		t.Errorf("default layout not applied: %+v", got)
+	}
+	if got := mock.calls[1].MIMELayout; got != own {
+		t.Errorf("message layout overridden: %+v", got)
+	}
+}
+
+func TestClientSaveToSentDefault(t *testing.T) {
+	mock := &mockProvider{}
+	no, yes := false, true
+	c := &Client{provider: mock, saveToSent: &no}
+	for _, msg := range []*Message{
+		{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"},
+		{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b", SaveToSent: &yes},
+	} {
+		if err := c.SendWithContext(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.SaveToSent == &no {
+			t.Error("caller's message changed")
+		}
+	}
+	if got := mock.calls[0].SaveToSent; got == nil || *got {
+		t.Errorf("default SaveToSent not applied: %v", got)
+	}
+	if got := mock.calls[1].SaveToSent; got == nil || !*got {
+		t.Errorf("message SaveToSent overridden: %v", got)
+	}
+}
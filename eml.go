@@ -0,0 +1,446 @@
+// eml.go - .eml export and import of a Message. Export is the RFC 5322
+// rendering the providers submit, with the Bcc header kept as in a sender's
+// own copy, for archiving sent mail, handing it to other systems or
+// snapshotting it in tests. Import decodes such a file, or any other raw
+// message, back into a Message.
+package email
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/language"
+)
+
+// WriteTo writes m to w as an .eml file (RFC 5322 with MIME parts) and
+// returns the number of bytes written. It renders m as the providers do,
+// keeping the Bcc header, as the sender's copy does. The multipart
+// boundaries are derived from the content, so the output is the same every
+// time for the same message; Date and Message-ID are written only if set in
+// m.Headers. It implements io.WriterTo.
+//
+// Example:
+//
+//	f, err := os.Create("sent/" + orderID + ".eml")
+//	if err != nil {
+//	    return err
+//	}
+//	defer f.Close()
+//	_, err = msg.WriteTo(f)
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	cw := &writeCounter{w: w}
+	err := WriteMIME(cw, m, MIMEOptions{Bcc: true, Boundary: emlBoundary(m)})
+	return cw.n, err
+}
+
+// ToEML returns m rendered as by WriteTo.
+func (m *Message) ToEML() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// emlBoundary returns a boundary derived from m's fields. The content
+// cannot contain its own hash, so the boundary cannot occur in it. Streamed
+// attachments contribute their names only.
+func emlBoundary(m *Message) string {
+	h := sha256.New()
+	field := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	field(m.From)
+	for _, list := range [][]string{m.To, m.Cc, m.Bcc} {
+		for _, a := range list {
+			field(a)
+		}
+		field("")
+	}
+	field(m.Subject)
+	field(m.Body)
+	field(m.TextBody)
+	keys := make([]string, 0, len(m.Headers))
+	for k := range m.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		field(k)
+		field(m.Headers[k])
+	}
+	for _, att := range m.Attachments {
+		field(att.Filename)
+		field(att.ContentID)
+		h.Write(att.Content)
+		h.Write([]byte{0})
+	}
+	return "eml-" + hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// writeCounter counts the bytes written through it to w.
+type writeCounter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *writeCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// maxEMLDepth bounds the nesting of multipart entities ParseEML follows.
+const maxEMLDepth = 32
+
+// ParseEML decodes a raw RFC 5322 message, such as an .eml file or the
+// output of WriteTo, into a Message:
+//
+//   - From, To, Cc, Bcc and Subject fill their fields, with RFC 2047
+//     encoded-words decoded; X-Priority and Importance set Priority,
+//     Sensitivity sets Sensitivity and a Content-Language naming one
+//     language sets Language.
+//   - The first HTML part becomes Body (HTML set) and the first plain text
+//     part TextBody, or Body if there is no HTML.
+//   - Every other part becomes an attachment; parts with a Content-ID that
+//     are marked inline or sit beside the body in multipart/related are
+//     Inline.
+//   - The remaining header fields go to Headers, the first occurrence of a
+//     repeated field only. Content fields, which describe the decoded body,
+//     are dropped, as are the fields that identify or trace the original
+//     send (Message-ID, Date, Received, DKIM-Signature,
+//     Authentication-Results and the like), so that sending the parsed
+//     message makes a new message rather than a replay of the old one.
+//
+// Text is converted to UTF-8 from its declared charset and to LF line
+// endings. Parts without a file name are named after their position and
+// type, e.g. "part2.png".
+//
+// Example:
+//
+//	f, err := os.Open("template.eml")
+//	if err != nil {
+//	    return err
+//	}
+//	defer f.Close()
+//	msg, err := email.ParseEML(f)
+//	if err != nil {
+//	    return err
+//	}
+//	msg.To = []string{customer}
+//	err = client.Send(msg)
+func ParseEML(r io.Reader) (*Message, error) {
+	raw, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	p := &emlParser{msg: &Message{}}
+	p.dec.CharsetReader = charsetReader
+	p.headers(raw.Header)
+	if err := p.entity(textproto.MIMEHeader(raw.Header), raw.Body, false, 0); err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	if p.hasHTML {
+		p.msg.Body, p.msg.HTML, p.msg.TextBody = p.html, true, p.text
+	} else {
+		p.msg.Body = p.text
+	}
+	return p.msg, nil
+}
+
+// emlTraceHeaders are the header fields, in canonical form, that ParseEML
+// drops because they identify or trace the original send: a new send adds
+// its own, and reusing them would make receivers take it for the old
+// message or fail its authentication.
+var emlTraceHeaders = map[string]bool{
+	"Message-Id": true, "Date": true, "Received": true, "Return-Path": true, "Delivered-To": true,
+	"Dkim-Signature": true, "Authentication-Results": true, "Received-Spf": true,
+	"Arc-Seal": true, "Arc-Message-Signature": true, "Arc-Authentication-Results": true,
+}
+
+// emlParser accumulates a Message from a parsed raw message.
+type emlParser struct {
+	msg   *Message
+	dec   mime.WordDecoder
+	parts int // leaf entities seen, for naming unnamed attachments
+
+	html, text       string
+	hasHTML, hasText bool
+}
+
+// headers fills the message's header fields from h.
+func (p *emlParser) headers(h mail.Header) {
+	if from := p.addresses(h.Get("From")); len(from) > 0 {
+		p.msg.From = from[0]
+	}
+	p.msg.To = p.addresses(h.Get("To"))
+	p.msg.Cc = p.addresses(h.Get("Cc"))
+	p.msg.Bcc = p.addresses(h.Get("Bcc"))
+	p.msg.Subject = p.decode(h.Get("Subject"))
+	p.msg.Priority = parsePriority(h.Get("X-Priority"), h.Get("Importance"))
+	p.msg.Sensitivity = parseSensitivity(h.Get("Sensitivity"))
+	if tag, err := language.Parse(strings.TrimSpace(h.Get("Content-Language"))); err == nil {
+		p.msg.Language = tag.String()
+	}
+
+	for name, values := range h {
+		switch {
+		case reservedHeaders[name], emlTraceHeaders[name], strings.HasPrefix(name, "Content-") && name != "Content-Language":
+			continue
+		case p.msg.Priority != "" && (name == "X-Priority" || name == "Importance"):
+			continue
+		case p.msg.Sensitivity != "" && name == "Sensitivity":
+			continue
+		case p.msg.Language != "" && (name == "Content-Language" || name == "Accept-Language" && values[0] == p.msg.Language):
+			continue
+		}
+		if p.msg.Headers == nil {
+			p.msg.Headers = make(map[string]string)
+		}
+		p.msg.Headers[name] = p.decode(values[0])
+	}
+}
+
+// addresses parses an address list header into "Name <addr>" strings,
+// falling back to bare addresses when it does not parse (e.g. unquoted
+// specials in a display name).
+func (p *emlParser) addresses(v string) []string {
+	if strings.TrimSpace(v) == "" {
+		return nil
+	}
+	list, err := (&mail.AddressParser{WordDecoder: &p.dec}).ParseList(v)
+	if err != nil {
+		return splitAddrs(v)
+	}
+	var out []string
+	for _, a := range list {
+		out = append(out, formatAddress(a))
+	}
+	return out
+}
+
+// decode decodes RFC 2047 encoded-words in a header value, returning it
+// unchanged on failure.
+func (p *emlParser) decode(v string) string {
+	if !strings.Contains(v, "=?") {
+		return v
+	}
+	if out, err := p.dec.DecodeHeader(v); err == nil {
+		return out
+	}
+	return v
+}
+
+// entity decodes a MIME entity with header h and raw content body into the
+// message. related marks a non-root part of multipart/related.
+func (p *emlParser) entity(h textproto.MIMEHeader, body io.Reader, related bool, depth int) error {
+	mediaType, params := "text/plain", map[string]string{} // RFC 2045 §5.2
+	if ct := h.Get("Content-Type"); ct != "" {
+		var err error
+		if mediaType, params, err = mime.ParseMediaType(ct); err != nil {
+			mediaType = "application/octet-stream"
+		}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if params["boundary"] == "" {
+			return fmt.Errorf("%s without boundary", mediaType)
+		}
+		if depth >= maxEMLDepth {
+			return errors.New("multipart nesting too deep")
+		}
+		mr := multipart.NewReader(body, params["boundary"])
+		for i := 0; ; i++ {
+			// Raw, so that all transfer encodings are decoded in one place.
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			inRelated := mediaType == "multipart/related" && i > 0
+			if err := p.entity(part.Header, part, inRelated, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	p.parts++
+	content, err := io.ReadAll(transferDecoder(h.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return fmt.Errorf("%s part: %w", mediaType, err)
+	}
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := dparams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	filename = p.decode(filename)
+
+	if !related && disposition != "attachment" && filename == "" {
+		if depth > 0 {
+			// The blank line writers (this package's included) leave
+			// before the next boundary.
+			content = bytes.TrimSuffix(content, []byte("\r\n"))
+		}
+		switch {
+		case mediaType == "text/html" && !p.hasHTML:
+			p.html, p.hasHTML = decodeText(content, params["charset"]), true
+			return nil
+		case mediaType == "text/plain" && !p.hasText:
+			p.text, p.hasText = decodeText(content, params["charset"]), true
+			return nil
+		}
+	}
+
+	if filename == "" {
+		filename = fmt.Sprintf("part%d", p.parts)
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			filename += exts[0]
+		}
+	}
+	cid := strings.Trim(strings.TrimSpace(h.Get("Content-Id")), "<>")
+	p.msg.Attachments = append(p.msg.Attachments, Attachment{
+		Filename:  filename,
+		Content:   content,
+		MimeType:  mediaType,
+		ContentID: cid,
+		Inline:    cid != "" && (related || disposition == "inline"),
+	})
+	return nil
+}
+
+// formatAddress renders a parsed address as "Name <addr>", quoting the
+// name when it contains characters special in address lists.
+func formatAddress(a *mail.Address) string {
+	if a.Name == "" {
+		return a.Address
+	}
+	name := a.Name
+	if strings.ContainsAny(name, `()<>[]:;@\,."`) {
+		name = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+	}
+	return name + " <" + a.Address + ">"
+}
+
+// parseSensitivity maps a Sensitivity header value to a Sensitivity, or ""
+// if it names none.
+func parseSensitivity(v string) Sensitivity {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "personal":
+		return SensitivityPersonal
+	case "private":
+		return SensitivityPrivate
+	case "company-confidential", "confidential":
+		return SensitivityConfidential
+	}
+	return ""
+}
+
+// parsePriority maps X-Priority and Importance values to a Priority, or ""
+// if neither is set.
+func parsePriority(xPriority, importance string) Priority {
+	if f := strings.Fields(xPriority); len(f) > 0 {
+		switch f[0] {
+		case "1", "2":
+			return PriorityHigh
+		case "3":
+			return PriorityNormal
+		case "4", "5":
+			return PriorityLow
+		}
+	}
+	switch p := Priority(strings.ToLower(strings.TrimSpace(importance))); p {
+	case PriorityHigh, PriorityNormal, PriorityLow:
+		return p
+	}
+	return ""
+}
+
+// transferDecoder returns r decoded per a Content-Transfer-Encoding value.
+func transferDecoder(cte string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(cte)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// decodeText converts text in charset to UTF-8 with LF line endings. Text
+// in an unknown charset is kept as is.
+func decodeText(b []byte, charset string) string {
+	if cs := strings.ToLower(charset); cs != "" && cs != "utf-8" && cs != "us-ascii" {
+		if r, err := charsetReader(cs, bytes.NewReader(b)); err == nil {
+			if out, err := io.ReadAll(r); err == nil {
+				b = out
+			}
+		}
+	}
+	return strings.ReplaceAll(string(b), "\r\n", "\n")
+}
+
+// charsetReader converts input in charset to UTF-8, for the charsets web
+// browsers know (WHATWG Encoding Standard).
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, err
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+// decodeMIMEHeader decodes RFC 2047 encoded-words (e.g. UTF-8 Croatian
+// subjects) to plain UTF-8, returning the input unchanged on failure.
+func decodeMIMEHeader(s string) string {
+	if s == "" || !strings.Contains(s, "=?") {
+		return s
+	}
+	dec := new(mime.WordDecoder)
+	if out, err := dec.DecodeHeader(s); err == nil {
+		return out
+	}
+	return s
+}
+
+// parseAddr extracts the bare address from a possibly display-named header
+// value (e.g. `Marios <m@x.com>` -> `m@x.com`).
+func parseAddr(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndex(s, "<"); i >= 0 {
+		if j := strings.Index(s[i:], ">"); j >= 0 {
+			return strings.TrimSpace(s[i+1 : i+j])
+		}
+	}
+	return s
+}
+
+// splitAddrs splits a comma-separated recipient header into bare addresses.
+func splitAddrs(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if a := parseAddr(decodeMIMEHeader(part)); a != "" {
+			out = append(out, a)
+		}
+	}
+	return out
+}
@@ -0,0 +1,185 @@
+package email
+
+import (
+	"bytes"
+	"io"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestMessageWriteTo(t *testing.T) {
+	msg := &Message{From: "billing@example.com", To: []string{"client@example.com"}, Bcc: []string{"archive@example.com"},
+		Subject: "Invoice 1042", Body: "Attached.",
+		Headers:     map[string]string{"Date": "Mon, 02 Mar 2026 10:00:00 +0000", "Message-ID": "<inv-1042@example.com>"},
+		Attachments: []Attachment{{Filename: "invoice.pdf", Content: []byte("%PDF-1.7")}}}
+
+	var buf bytes.Buffer
+	n, err := msg.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo() = %d, wrote %d bytes", n, buf.Len())
+	}
+	eml, err := msg.ToEML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(eml, buf.Bytes()) {
+		t.Error("ToEML() differs from WriteTo(): output must be stable for snapshots")
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(eml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"Bcc": "archive@example.com", "Message-Id": "<inv-1042@example.com>", "Subject": "Invoice 1042"} {
+		if got := m.Header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if got := mimeStructure(t, m.Header.Get("Content-Type"), m.Body); got != "mixed{plain,pdf}" {
+		t.Errorf("structure = %s", got)
+	}
+
+	changed := *msg
+	changed.Body = "Attached, with thanks."
+	other, _ := changed.ToEML()
+	if boundary := func(b []byte) string {
+		_, rest, _ := strings.Cut(string(b), "boundary=")
+		line, _, _ := strings.Cut(rest, "\r\n")
+		return line
+	}; boundary(other) == boundary(eml) {
+		t.Error("different content has the same boundary")
+	}
+}
+
+func TestMessageWriteToError(t *testing.T) {
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+	msg.AttachStream("gone.csv", func() (io.ReadCloser, error) { return nil, io.ErrUnexpectedEOF })
+	if _, err := msg.WriteTo(io.Discard); err == nil {
+		t.Error("WriteTo() with a failing attachment: want error")
+	}
+}
+
+func TestParseEMLRoundTrip(t *testing.T) {
+	msg := &Message{From: "Đuro Kovač <billing@example.com>", To: []string{"client@example.com", `"Doe, Jane" <jane@example.com>`},
+		Cc: []string{"team@example.com"}, Bcc: []string{"archive@example.com"},
+		Subject: "Račun 1042 — plaćeno", HTML: true, Body: "<p>Hvala!</p>\n<img src=\"cid:logo\">", TextBody: "Hvala!\n",
+		Priority: PriorityHigh, Sensitivity: SensitivityConfidential, Language: "hr",
+		Headers: map[string]string{"X-Order": "1042"},
+		Attachments: []Attachment{
+			// Inline first: they are rendered, and so parsed, before the others.
+			{Filename: "logo.png", Content: []byte("\x89PNG"), MimeType: "image/png", Inline: true, ContentID: "logo"},
+			{Filename: "račun.pdf", Content: []byte("%PDF-1.7\x00\xff"), MimeType: "application/pdf"},
+		}}
+	eml, err := msg.ToEML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseEML(bytes.NewReader(eml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.From != msg.From || got.Subject != msg.Subject || got.Priority != msg.Priority || got.Sensitivity != msg.Sensitivity || got.Language != msg.Language {
+		t.Errorf("From, Subject, Priority, Sensitivity, Language = %q, %q, %q, %q, %q", got.From, got.Subject, got.Priority, got.Sensitivity, got.Language)
+	}
+	for name, lists := range map[string][2][]string{"To": {got.To, msg.To}, "Cc": {got.Cc, msg.Cc}, "Bcc": {got.Bcc, msg.Bcc}} {
+		if strings.Join(lists[0], "|") != strings.Join(lists[1], "|") {
+			t.Errorf("%s = %q, want %q", name, lists[0], lists[1])
+		}
+	}
+	if !got.HTML || got.Body != msg.Body || got.TextBody != msg.TextBody {
+		t.Errorf("HTML %v, Body %q, TextBody %q", got.HTML, got.Body, got.TextBody)
+	}
+	if len(got.Headers) != 1 || got.Headers["X-Order"] != "1042" {
+		t.Errorf("Headers = %v", got.Headers)
+	}
+	if len(got.Attachments) != 2 {
+		t.Fatalf("got %d attachments", len(got.Attachments))
+	}
+	for i, want := range msg.Attachments {
+		a := got.Attachments[i]
+		if a.Filename != want.Filename || !bytes.Equal(a.Content, want.Content) || a.MimeType != want.MimeType ||
+			a.Inline != want.Inline || a.ContentID != want.ContentID {
+			t.Errorf("attachment %d = %+v, want %+v", i, a, want)
+		}
+	}
+
+	// Rendering the parsed message again gives the same file.
+	again, err := got.ToEML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, eml) {
+		t.Errorf("round trip changed the message:\n%s\n---\n%s", eml, again)
+	}
+}
+
+func TestParseEML(t *testing.T) {
+	raw := "From: =?ISO-8859-1?Q?J=F6rg?= <jorg@example.de>\r\n" +
+		"To: undisclosed-recipients:;\r\n" +
+		"Subject: =?iso-8859-1?q?Gr=FC=DFe?=\r\n" +
+		"Received: from a\r\n" +
+		"Received: from b\r\n" +
+		"DKIM-Signature: v=1; a=rsa-sha256; d=example.de; s=s; bh=x; b=y\r\n" +
+		"Authentication-Results: mx.example.com; dkim=pass\r\n" +
+		"Message-ID: <old@example.de>\r\n" +
+		"Date: Mon, 02 Mar 2026 10:00:00 +0000\r\n" +
+		"X-Mailer: Thunderbird\r\n" +
+		"X-Priority: 5 (Lowest)\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Sch=F6ne Gr=FC=DFe\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename*=UTF-8''%C3%BCbersicht.csv\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"YSxiCjEsMgo=\r\n" +
+		"--outer\r\n" +
+		"Content-Type: image/png\r\n" +
+		"\r\n" +
+		"png\r\n" +
+		"--outer--\r\n"
+	m, err := ParseEML(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.From != "Jörg <jorg@example.de>" || len(m.To) != 0 || m.Subject != "Grüße" || m.Priority != PriorityLow {
+		t.Errorf("From %q, To %q, Subject %q, Priority %q", m.From, m.To, m.Subject, m.Priority)
+	}
+	if m.HTML || m.Body != "Schöne Grüße" {
+		t.Errorf("HTML %v, Body %q", m.HTML, m.Body)
+	}
+	// Only X-Mailer is left: the trace and identity fields of the
+	// original send are dropped.
+	if len(m.Headers) != 1 || m.Headers["X-Mailer"] != "Thunderbird" {
+		t.Errorf("Headers = %v", m.Headers)
+	}
+	if len(m.Attachments) != 2 {
+		t.Fatalf("got %d attachments", len(m.Attachments))
+	}
+	if a := m.Attachments[0]; a.Filename != "übersicht.csv" || string(a.Content) != "a,b\n1,2\n" {
+		t.Errorf("attachment 0 = %q %q", a.Filename, a.Content)
+	}
+	if a := m.Attachments[1]; a.Filename != "part3.png" || a.MimeType != "image/png" || a.Inline {
+		t.Errorf("attachment 1 = %+v", a)
+	}
+
+	for name, raw := range map[string]string{
+		"no header":   "not a message",
+		"no boundary": "Content-Type: multipart/mixed\r\n\r\nbody",
+		"bad base64":  "Content-Transfer-Encoding: base64\r\n\r\n!!!\r\n",
+	} {
+		if _, err := ParseEML(strings.NewReader(raw)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -1,14 +1,100 @@
-// errors.go - Sentinel errors for the email package.
+// errors.go - Sentinel errors for the email package, and the typed errors
+// of providers that can be compiled out, so that code matching them builds
+// either way.
 package email
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	// ErrUnsupported is returned when a configured provider does not implement
-	// the requested mailbox operation (i.e. it is not a MailboxProvider).
+	// the requested mailbox operation (e.g. it is not a Receiver or MailboxManager).
 	ErrUnsupported = errors.New("operation not supported by provider")
 
 	// ErrNotFound is returned when a referenced message, folder, or label does
 	// not exist.
 	ErrNotFound = errors.New("not found")
+
+	// ErrPartialSend is returned when a message was sent but a follow-up step
+	// (e.g. filing the sent copy into Message.SentFolder) failed, or when a
+	// message split by recipients went out to only some of them. The message
+	// must not be re-sent.
+	ErrPartialSend = errors.New("message sent, but a post-send step failed")
+
+	// ErrMessageTooLarge is matched by the *MessageTooLargeError returned
+	// when a message exceeds the size the receiving server or API accepts.
+	ErrMessageTooLarge = errors.New("message too large")
+
+	// ErrNotComplaint is returned by ParseComplaint for messages that are not
+	// ARF feedback reports, so FBL mailboxes can skip unrelated mail.
+	ErrNotComplaint = errors.New("not an ARF feedback report")
+
+	// ErrRecipientRejected is matched by the *RecipientRejectedError a
+	// RecipientPolicy returns for refused recipients.
+	ErrRecipientRejected = errors.New("recipient rejected by policy")
+
+	// ErrDuplicate is returned when a DuplicateMonitor with Reject set
+	// refuses a repeated send of the same content.
+	ErrDuplicate = errors.New("duplicate message content")
+
+	// ErrDailyQuotaExceeded is matched by the *QuotaExceededError returned
+	// when the sending account's daily provider quota is used up.
+	ErrDailyQuotaExceeded = errors.New("daily sending quota exceeded")
+
+	// ErrBudgetExceeded is matched by the *BudgetExceededError returned when
+	// a Client's SendBudget is exhausted.
+	ErrBudgetExceeded = errors.New("send budget exceeded")
+
+	// ErrSendWindowClosed is matched by the *SendWindowClosedError returned
+	// when a send falls into a provider's blackout.
+	ErrSendWindowClosed = errors.New("send window closed")
+
+	// ErrApprovalRequired is matched by the *ApprovalRequiredError SendBatch
+	// returns for batches that need an operator's approval.
+	ErrApprovalRequired = errors.New("batch requires approval")
+
+	// ErrOutcomeUnknown reports a message that may or may not have been
+	// delivered: a batch message that an interrupted run was sending when it
+	// stopped, or a send the provider accepted but whose completion could
+	// not be confirmed. Like a message failing with ErrPartialSend, it must
+	// not be re-sent blindly.
+	ErrOutcomeUnknown = errors.New("send outcome unknown")
+
+	// ErrSendAsNotVerified is matched by the *SendAsError returned when a
+	// Gmail message's From is not a verified send-as alias of the account.
+	ErrSendAsNotVerified = errors.New("sender is not a verified send-as alias")
 )
+
+// SendAsError reports a From address the Gmail account may not send as
+// (see GmailConfig.VerifySendAs). Add the address under "Send mail as" in
+// the account's Gmail settings, and complete its verification.
+type SendAsError struct {
+	// Address is the From address.
+	Address string
+
+	// Status is the alias's verification status, "pending" while Gmail
+	// awaits its confirmation; empty when the account has no such alias.
+	Status string
+}
+
+func (e *SendAsError) Error() string {
+	if e.Status == "" {
+		return fmt.Sprintf("%s: %s is not configured for the account", ErrSendAsNotVerified, e.Address)
+	}
+	return fmt.Sprintf("%s: %s verification is %s", ErrSendAsNotVerified, e.Address, e.Status)
+}
+
+// Is reports whether target is ErrSendAsNotVerified.
+func (e *SendAsError) Is(target error) bool {
+	return target == ErrSendAsNotVerified
+}
+
+// Hint suggests registering the alias.
+func (e *SendAsError) Hint() string {
+	if e.Status == "" {
+		return fmt.Sprintf("add %s under \"Send mail as\" in the account's Gmail settings and verify it", e.Address)
+	}
+	return fmt.Sprintf("complete the verification of %s, from the email Gmail sent to it", e.Address)
+}
@@ -0,0 +1,42 @@
+// Command wasm builds a message the way an edge function would: without any
+// provider, compiled to WebAssembly, handing the rendered MIME to a relay
+// (here, standard output). Build it without the provider SDKs:
+//
+//	GOOS=js GOARCH=wasm go build -tags email_no_outlook,email_no_gmail -o mail.wasm ./wasm
+//	GOOS=wasip1 GOARCH=wasm go build -tags email_no_outlook,email_no_gmail -o mail.wasm ./wasm
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/go-email/go-email"
+)
+
+func main() {
+	msg := &email.Message{
+		From:     "Edge <edge@example.com>",
+		To:       []string{"recipient@example.com"},
+		Subject:  "Rendered at the edge",
+		Body:     "<p>Hello from WebAssembly!</p>",
+		HTML:     true,
+		TextBody: "Hello from WebAssembly!",
+		Headers:  map[string]string{"Date": time.Now().Format(time.RFC1123Z)},
+	}
+	msg.Attachments = append(msg.Attachments, email.Attachment{
+		Filename: "hello.txt",
+		Content:  []byte("attached at the edge"),
+		MimeType: "text/plain",
+	})
+	if err := msg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	raw, err := email.BuildMIME(msg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// A real edge function would POST raw to its relay, or submit it over
+	// SMTP from a host that can open connections.
+	os.Stdout.Write(raw)
+}
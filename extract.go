@@ -0,0 +1,545 @@
+// extract.go - Attachment text extraction for audit records and inbound-mail
+// pipelines. ExtractText picks a TextExtractor by the attachment's MIME type
+// (or its filename when MimeType is empty). Plain text, HTML, PDF and DOCX are
+// built in; RegisterExtractor adds or replaces extractors, e.g. to plug in a
+// full PDF library or an external service such as Apache Tika.
+package email
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Well-known MIME types with built-in extractors.
+const (
+	mimePDF  = "application/pdf"
+	mimeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+)
+
+// TextExtractor pulls plain text out of an attachment's content.
+type TextExtractor interface {
+	// ExtractText returns the readable text of content. The context bounds
+	// extractors that call out to other processes or services.
+	ExtractText(ctx context.Context, content []byte) (string, error)
+}
+
+// TextExtractorFunc adapts a function to the TextExtractor interface.
+type TextExtractorFunc func(ctx context.Context, content []byte) (string, error)
+
+// ExtractText calls f(ctx, content).
+func (f TextExtractorFunc) ExtractText(ctx context.Context, content []byte) (string, error) {
+	return f(ctx, content)
+}
+
+var (
+	extractorsMu sync.RWMutex
+	extractors   = map[string]TextExtractor{
+		"text/plain": TextExtractorFunc(extractPlainText),
+		"text/csv":   TextExtractorFunc(extractPlainText),
+		"text/html":  TextExtractorFunc(extractHTMLText),
+		mimePDF:      TextExtractorFunc(extractPDFText),
+		mimeDOCX:     TextExtractorFunc(extractDOCXText),
+	}
+)
+
+// RegisterExtractor sets the extractor used for mimeType (e.g.
+// "application/pdf"), replacing any built-in one. Parameters such as charset
+// are ignored when matching. A nil extractor removes the registration. It is
+// safe for concurrent use.
+func RegisterExtractor(mimeType string, e TextExtractor) {
+	mimeType = baseMediaType(mimeType)
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	if e == nil {
+		delete(extractors, mimeType)
+		return
+	}
+	extractors[mimeType] = e
+}
+
+// ExtractText returns the text content of an attachment. The extractor is
+// chosen by att.MimeType, falling back to the filename extension. It returns
+// an error wrapping ErrUnsupported when no extractor handles the type.
+//
+// The built-in PDF extractor is best-effort: it reads text drawn with simple
+// fonts from uncompressed and Flate-compressed content streams, which covers
+// most generated documents but not scanned images or CID-keyed fonts. A
+// content stream that inflates to more than 16 MiB fails the extraction.
+//
+// Example:
+//
+//	text, err := email.ExtractText(ctx, att)
+//	if errors.Is(err, email.ErrUnsupported) {
+//		// not a text-bearing type; log metadata only
+//	}
+func ExtractText(ctx context.Context, att Attachment) (string, error) {
+	mimeType := att.MimeType
+	if mimeType == "" {
+		mimeType = getContentType(att.Filename)
+	}
+	mimeType = baseMediaType(mimeType)
+
+	extractorsMu.RLock()
+	e, ok := extractors[mimeType]
+	extractorsMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("extract text from %q (%s): %w", att.Filename, mimeType, ErrUnsupported)
+	}
+	content, err := att.bytes()
+	if err != nil {
+		return "", fmt.Errorf("extract text from %q: %w", att.Filename, err)
+	}
+	text, err := e.ExtractText(ctx, content)
+	if err != nil {
+		return "", fmt.Errorf("extract text from %q: %w", att.Filename, err)
+	}
+	return text, nil
+}
+
+// baseMediaType lower-cases a content type and drops its parameters.
+func baseMediaType(ct string) string {
+	if mt, _, err := mime.ParseMediaType(ct); err == nil {
+		return mt
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
+
+// extractPlainText returns content as UTF-8, replacing invalid sequences.
+func extractPlainText(_ context.Context, content []byte) (string, error) {
+	return strings.ToValidUTF8(string(content), "�"), nil
+}
+
+// extractDOCXText reads the paragraphs of word/document.xml, one per line.
+func extractDOCXText(_ context.Context, content []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", fmt.Errorf("docx: %w", err)
+	}
+	f, err := zr.Open("word/document.xml")
+	if err != nil {
+		return "", fmt.Errorf("docx: %w", err)
+	}
+	defer f.Close()
+
+	var b strings.Builder
+	inText := false
+	dec := xml.NewDecoder(f)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("docx: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				b.WriteByte('\t')
+			case "br", "cr":
+				b.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				b.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// pdfSkipStream lists stream dictionary entries marking streams that hold
+// no page text (images, fonts, cross-reference and object streams).
+var pdfSkipStream = []string{
+	"/Image", "/XRef", "/ObjStm", "/Metadata", "/Length1", "/Length2", "/Length3",
+	"/Type1C", "/CIDFontType0C", "/OpenType",
+}
+
+// maxPDFStreamSize caps the inflated size of one PDF content stream. Flate
+// compresses runs of a byte about a thousandfold, so a small attachment can
+// otherwise inflate into gigabytes; page text is far below the cap.
+const maxPDFStreamSize = 16 << 20
+
+// extractPDFText collects the strings shown by text operators in every
+// content stream of a PDF.
+func extractPDFText(ctx context.Context, content []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(content, "\x00\t\r\n "), []byte("%PDF-")) {
+		return "", fmt.Errorf("pdf: missing %%PDF header")
+	}
+
+	var b strings.Builder
+	for rest := content; ; {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		dict, data, next, ok := nextPDFStream(rest)
+		if !ok {
+			break
+		}
+		rest = next
+		if pdfStreamSkipped(dict) {
+			continue
+		}
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				continue
+			}
+			// A truncated or padded stream still yields what was inflated.
+			data, _ = io.ReadAll(io.LimitReader(zr, maxPDFStreamSize+1))
+			zr.Close()
+			if len(data) > maxPDFStreamSize {
+				return "", fmt.Errorf("pdf: content stream inflates to more than %d bytes", maxPDFStreamSize)
+			}
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			continue // other encodings (DCT, LZW, ...) are not text we can read
+		}
+		pdfContentText(&b, data)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// nextPDFStream finds the next "stream ... endstream" block in data and
+// returns its dictionary, its raw bytes and the remaining input.
+func nextPDFStream(data []byte) (dict, stream, rest []byte, ok bool) {
+	for {
+		i := bytes.Index(data, []byte("stream"))
+		if i < 0 {
+			return nil, nil, nil, false
+		}
+		// The keyword must follow a dictionary, not end "endstream".
+		head := bytes.TrimRight(data[:i], "\t\r\n ")
+		if !bytes.HasSuffix(head, []byte(">>")) {
+			data = data[i+len("stream"):]
+			continue
+		}
+		start := i + len("stream")
+		if start < len(data) && data[start] == '\r' {
+			start++
+		}
+		if start < len(data) && data[start] == '\n' {
+			start++
+		}
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			return nil, nil, nil, false
+		}
+		dictStart := bytes.LastIndex(head, []byte("obj"))
+		if dictStart < 0 {
+			dictStart = 0
+		}
+		return head[dictStart:], bytes.TrimRight(data[start:start+end], "\r\n"), data[start+end+len("endstream"):], true
+	}
+}
+
+// pdfStreamSkipped reports whether a stream dictionary marks non-text data.
+func pdfStreamSkipped(dict []byte) bool {
+	for _, k := range pdfSkipStream {
+		if bytes.Contains(dict, []byte(k)) {
+			return true
+		}
+	}
+	return false
+}
+
+// pdfOperand is one operand on the content-stream stack: a string, a number,
+// or an array of operands (for TJ).
+type pdfOperand struct {
+	str   string
+	isStr bool
+	num   float64
+	arr   []pdfOperand
+}
+
+// pdfContentText interprets the text operators of a content stream and
+// appends the shown text to b. Text positioning that moves to a new line is
+// rendered as a newline; large negative TJ kerning as a space.
+func pdfContentText(b *strings.Builder, data []byte) {
+	var (
+		operands []pdfOperand
+		arrays   [][]pdfOperand
+	)
+	push := func(op pdfOperand) {
+		if n := len(arrays); n > 0 {
+			arrays[n-1] = append(arrays[n-1], op)
+			return
+		}
+		operands = append(operands, op)
+	}
+	newline := func() {
+		if s := b.String(); s != "" && !strings.HasSuffix(s, "\n") {
+			b.WriteByte('\n')
+		}
+	}
+	lastStr := func() {
+		for i := len(operands) - 1; i >= 0; i-- {
+			if operands[i].isStr {
+				b.WriteString(operands[i].str)
+				return
+			}
+		}
+	}
+
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case pdfSpace(c):
+			i++
+		case c == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, n := pdfLiteralString(data[i:])
+			push(pdfOperand{str: s, isStr: true})
+			i += n
+		case c == '<' && i+1 < len(data) && data[i+1] == '<':
+			// Inline dictionaries (BDC properties, inline images) carry no text.
+			i = pdfSkipDict(data, i)
+		case c == '<':
+			s, n := pdfHexString(data[i:])
+			push(pdfOperand{str: s, isStr: true})
+			i += n
+		case c == '[':
+			arrays = append(arrays, nil)
+			i++
+		case c == ']':
+			if n := len(arrays); n > 0 {
+				arr := arrays[n-1]
+				arrays = arrays[:n-1]
+				push(pdfOperand{arr: arr})
+			}
+			i++
+		case c == '/':
+			j := i + 1
+			for j < len(data) && !pdfSpace(data[j]) && !pdfDelim(data[j]) {
+				j++
+			}
+			push(pdfOperand{})
+			i = j
+		default:
+			j := i
+			for j < len(data) && !pdfSpace(data[j]) && !pdfDelim(data[j]) {
+				j++
+			}
+			if j == i {
+				i++ // stray delimiter
+				continue
+			}
+			word := string(data[i:j])
+			i = j
+			if num, err := strconv.ParseFloat(word, 64); err == nil {
+				push(pdfOperand{num: num})
+				continue
+			}
+			switch word {
+			case "Tj":
+				lastStr()
+			case "'", "\"":
+				newline()
+				lastStr()
+			case "TJ":
+				if n := len(operands); n > 0 {
+					for _, el := range operands[n-1].arr {
+						if el.isStr {
+							b.WriteString(el.str)
+						} else if el.num < -200 {
+							b.WriteByte(' ')
+						}
+					}
+				}
+			case "T*", "ET":
+				newline()
+			case "Td", "TD":
+				if n := len(operands); n >= 1 && operands[n-1].num != 0 {
+					newline()
+				}
+			case "ID":
+				// Inline image data runs to "EI"; skip it unparsed.
+				if k := bytes.Index(data[i:], []byte("EI")); k >= 0 {
+					i += k + 2
+				} else {
+					i = len(data)
+				}
+			}
+			operands = operands[:0]
+		}
+	}
+	newline()
+}
+
+// pdfLiteralString decodes a "(...)" string at the start of data and returns
+// it with the number of bytes consumed.
+func pdfLiteralString(data []byte) (string, int) {
+	var out []byte
+	depth := 0
+	i := 0
+	for i < len(data) {
+		c := data[i]
+		switch {
+		case c == '(':
+			if depth > 0 {
+				out = append(out, c)
+			}
+			depth++
+			i++
+		case c == ')':
+			depth--
+			i++
+			if depth == 0 {
+				return pdfTextString(out), i
+			}
+			out = append(out, c)
+		case c == '\\' && i+1 < len(data):
+			i++
+			e := data[i]
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if i+1 < len(data) && data[i+1] == '\n' {
+					i++
+				}
+			case '\n':
+				// line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					v := 0
+					for k := 0; k < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7'; k++ {
+						v = v*8 + int(data[i]-'0')
+						i++
+					}
+					out = append(out, byte(v))
+					continue
+				}
+				out = append(out, e)
+			}
+			i++
+		default:
+			out = append(out, c)
+			i++
+		}
+	}
+	return pdfTextString(out), i
+}
+
+// pdfHexString decodes a "<...>" string at the start of data and returns it
+// with the number of bytes consumed.
+func pdfHexString(data []byte) (string, int) {
+	var out []byte
+	hi, half := byte(0), false
+	i := 1
+	for ; i < len(data) && data[i] != '>'; i++ {
+		v, ok := unhex(data[i])
+		if !ok {
+			continue
+		}
+		if half {
+			out = append(out, hi<<4|v)
+		} else {
+			hi = v
+		}
+		half = !half
+	}
+	if half {
+		out = append(out, hi<<4)
+	}
+	return pdfTextString(out), i + 1
+}
+
+// pdfSkipDict returns the index just past the "<< ... >>" dictionary that
+// starts at data[i], honouring nesting.
+func pdfSkipDict(data []byte, i int) int {
+	depth := 0
+	for i < len(data) {
+		switch {
+		case bytes.HasPrefix(data[i:], []byte("<<")):
+			depth++
+			i += 2
+		case bytes.HasPrefix(data[i:], []byte(">>")):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		case data[i] == '(':
+			_, n := pdfLiteralString(data[i:])
+			i += n
+		default:
+			i++
+		}
+	}
+	return i
+}
+
+// pdfTextString converts PDF string bytes to UTF-8: UTF-16BE when it carries
+// a byte-order mark, otherwise single-byte (Latin-1 as an approximation of
+// the font's encoding). Control characters are dropped.
+func pdfTextString(raw []byte) string {
+	if len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF {
+		u := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			u = append(u, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+	b := make([]byte, 0, len(raw))
+	for _, c := range raw {
+		r := rune(c)
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			continue
+		}
+		b = utf8.AppendRune(b, r)
+	}
+	return string(b)
+}
+
+func pdfSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func pdfDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
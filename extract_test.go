@@ -0,0 +1,134 @@
+package email
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testPDF builds a one-page PDF whose content stream is Flate-compressed.
+func testPDF(t *testing.T, content string) []byte {
+	t.Helper()
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write([]byte(content))
+	zw.Close()
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	b.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	b.WriteString("2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n")
+	b.WriteString("3 0 obj\n<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>\nendobj\n")
+	fmt.Fprintf(&b, "4 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", z.Len())
+	b.Write(z.Bytes())
+	b.WriteString("\nendstream\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func testDOCX(t *testing.T, documentXML string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	w, err := zw.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(documentXML))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestExtractText(t *testing.T) {
+	pdf := testPDF(t, `BT /F1 12 Tf 72 720 Td (Invoice \(copy\)) Tj 0 -14 Td [(Total:) -250 (42)] TJ T* <FEFF00E9> Tj ET`)
+	docx := testDOCX(t, `<?xml version="1.0"?>`+
+		`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>`+
+		`<w:p><w:r><w:t>Hello</w:t></w:r><w:r><w:tab/><w:t>world</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>Second &amp; last</w:t></w:r></w:p>`+
+		`</w:body></w:document>`)
+
+	tests := []struct {
+		name    string
+		att     Attachment
+		want    string
+		wantErr error
+	}{
+		{
+			name: "pdf by filename",
+			att:  Attachment{Filename: "invoice.pdf", Content: pdf},
+			want: "Invoice (copy)\nTotal: 42\né",
+		},
+		{
+			name: "docx by mime type",
+			att:  Attachment{Filename: "letter", MimeType: mimeDOCX, Content: docx},
+			want: "Hello\tworld\nSecond & last",
+		},
+		{
+			name: "plain text with charset",
+			att:  Attachment{Filename: "notes", MimeType: "Text/Plain; charset=utf-8", Content: []byte("just text")},
+			want: "just text",
+		},
+		{
+			name:    "unsupported type",
+			att:     Attachment{Filename: "photo.png", Content: []byte{0x89, 'P', 'N', 'G'}},
+			wantErr: ErrUnsupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractText(context.Background(), tt.att)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ExtractText() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractText() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ExtractText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractTextCorruptPDF(t *testing.T) {
+	_, err := ExtractText(context.Background(), Attachment{Filename: "x.pdf", Content: []byte("not a pdf")})
+	if err == nil {
+		t.Fatal("ExtractText() on a non-PDF succeeded")
+	}
+}
+
+func TestExtractTextPDFBomb(t *testing.T) {
+	pdf := testPDF(t, strings.Repeat(" ", maxPDFStreamSize+1))
+	_, err := ExtractText(context.Background(), Attachment{Filename: "bomb.pdf", Content: pdf})
+	if err == nil || !strings.Contains(err.Error(), "inflates to more than") {
+		t.Fatalf("ExtractText() on a %d-byte PDF inflating past the cap: error = %v", len(pdf), err)
+	}
+}
+
+func TestRegisterExtractor(t *testing.T) {
+	const mt = "application/x-test"
+	RegisterExtractor(mt, TextExtractorFunc(func(_ context.Context, b []byte) (string, error) {
+		return "custom:" + string(b), nil
+	}))
+	defer RegisterExtractor(mt, nil)
+
+	got, err := ExtractText(context.Background(), Attachment{MimeType: mt, Content: []byte("x")})
+	if err != nil || got != "custom:x" {
+		t.Fatalf("ExtractText() = %q, %v; want %q", got, err, "custom:x")
+	}
+
+	RegisterExtractor(mt, nil)
+	if _, err := ExtractText(context.Background(), Attachment{MimeType: mt}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("after removal, error = %v, want ErrUnsupported", err)
+	}
+}
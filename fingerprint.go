@@ -0,0 +1,287 @@
+// fingerprint.go - Content fingerprints of outbound mail. A job stuck in a
+// retry loop or a scheduler firing twice sends the same email over and over;
+// the messages differ only in dynamic fields (dates, order numbers, tracking
+// links), so comparing them byte for byte misses it. Fingerprint hashes the
+// subject and body with those fields masked, plus a SimHash for near
+// duplicates, and a DuplicateMonitor attached via Config.Duplicates flags (or
+// refuses) repeated sends of the same content to the same recipients.
+package email
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentFingerprint identifies a message's content modulo dynamic fields.
+type ContentFingerprint struct {
+	// Hash is a hex digest of the normalized subject and body; messages
+	// that differ only in masked fields have the same Hash.
+	Hash string
+
+	// SimHash is a 64-bit locality-sensitive hash of the normalized text:
+	// similar messages have SimHashes a few bits apart (see Distance).
+	SimHash uint64
+}
+
+// Distance returns the number of SimHash bits in which f and o differ, from
+// 0 (same or near-identical text) to 64. Unrelated messages are typically 20
+// or more bits apart; a few bits mean a small edit.
+func (f ContentFingerprint) Distance(o ContentFingerprint) int {
+	return bits.OnesCount64(f.SimHash ^ o.SimHash)
+}
+
+// Fingerprint returns the content fingerprint of msg's subject and body.
+// HTML bodies are compared by their text. URLs are reduced to their host,
+// and email addresses, UUIDs, hex and alphanumeric tokens (ids, codes) and
+// numbers (amounts, dates, times) are masked, so a template rendered with
+// different data yields the same Hash.
+//
+// Example:
+//
+//	if email.Fingerprint(a).Hash == email.Fingerprint(b).Hash {
+//	    // same content, modulo dynamic fields
+//	}
+func Fingerprint(msg *Message) ContentFingerprint {
+	body := msg.Body
+	if msg.HTML {
+		body = HTMLToText(body, TextOptions{})
+	}
+	subject := normalizeContent(msg.Subject)
+	text := normalizeContent(body)
+	sum := sha256.Sum256([]byte(subject + "\n" + text))
+	return ContentFingerprint{
+		Hash:    hex.EncodeToString(sum[:16]),
+		SimHash: simHash(strings.Fields(subject + " " + text)),
+	}
+}
+
+// Dynamic fields masked by normalizeContent, in the order they are applied.
+var (
+	urlRe     = regexp.MustCompile(`(?i)\b(https?)://([^/\s?#<>"']+)[^\s<>"']*`)
+	addressRe = regexp.MustCompile(`(?i)[a-z0-9._%+\-]+@[a-z0-9\-]+(\.[a-z0-9\-]+)+`)
+	uuidRe    = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	tokenRe   = regexp.MustCompile(`\b[[:alnum:]_\-]*[0-9][[:alnum:]_\-]*\b`)
+)
+
+// normalizeContent lower-cases s, masks its dynamic fields and collapses
+// whitespace.
+func normalizeContent(s string) string {
+	s = strings.ToLower(s)
+	s = urlRe.ReplaceAllString(s, "$1://$2")
+	s = addressRe.ReplaceAllString(s, "<email>")
+	s = uuidRe.ReplaceAllString(s, "<id>")
+	s = tokenRe.ReplaceAllStringFunc(s, func(tok string) string {
+		// Long tokens mixing letters and digits are ids and codes; the
+		// rest (12, 2024-10-16, 3pm) are numbers.
+		if len(tok) >= 6 && strings.IndexFunc(tok, isASCIILetter) >= 0 {
+			return "<id>"
+		}
+		return "0"
+	})
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func isASCIILetter(r rune) bool {
+	return r >= 'a' && r <= 'z'
+}
+
+// simHash computes the SimHash of the word trigrams of words.
+func simHash(words []string) uint64 {
+	const shingle = 3
+	var weights [64]int
+	add := func(s string) {
+		h := fnv.New64a()
+		h.Write([]byte(s))
+		v := h.Sum64()
+		for i := range weights {
+			if v&(1<<i) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+	if len(words) < shingle {
+		add(strings.Join(words, " "))
+	}
+	for i := 0; i+shingle <= len(words); i++ {
+		add(strings.Join(words[i:i+shingle], " "))
+	}
+	var out uint64
+	for i, w := range weights {
+		if w > 0 {
+			out |= 1 << i
+		}
+	}
+	return out
+}
+
+// DuplicateMonitor watches outbound mail for the same content being sent to
+// the same recipients repeatedly. It is safe for concurrent use and may be
+// shared by several Clients; configure its fields before the first send.
+//
+// Example:
+//
+//	client, err := email.NewClient(&email.Config{
+//	    ...
+//	    Duplicates: &email.DuplicateMonitor{
+//	        Window:    time.Hour,
+//	        Threshold: 5,
+//	        OnDuplicate: func(e email.DuplicateEvent) {
+//	            log.Printf("runaway send? %d x %q to %v", e.Count, e.Subject, e.Recipients)
+//	        },
+//	    },
+//	})
+type DuplicateMonitor struct {
+	// Window is how far back sends are remembered. Defaults to 1 hour.
+	Window time.Duration
+
+	// Threshold is the number of sends of near-identical content to the
+	// same recipients within Window at which a send counts as a duplicate.
+	// Defaults to 3.
+	Threshold int
+
+	// MaxDistance is the largest Distance at which two fingerprints count
+	// as near-identical. Defaults to 3; a negative value compares Hash only.
+	MaxDistance int
+
+	// Reject refuses duplicate sends with an error wrapping ErrDuplicate
+	// instead of only reporting them. Refused sends still count, so a
+	// runaway job stays blocked until it has been quiet for Window.
+	Reject bool
+
+	// OnDuplicate, if set, is called for every duplicate send, before it is
+	// sent or refused.
+	OnDuplicate func(DuplicateEvent)
+
+	mu        sync.Mutex
+	sends     map[string][]duplicateEntry // by sorted recipients
+	lastSweep time.Time
+}
+
+// DuplicateEvent describes a duplicate send.
+type DuplicateEvent struct {
+	// Fingerprint is the fingerprint of the duplicate message.
+	Fingerprint ContentFingerprint
+
+	// Subject and Recipients are those of the duplicate message; Recipients
+	// holds its To, Cc and Bcc addresses, sorted.
+	Subject    string
+	Recipients []string
+
+	// Count is the number of near-identical sends within the window,
+	// including this one.
+	Count int
+
+	// First is the time of the earliest of them.
+	First time.Time
+}
+
+// duplicateEntry is one remembered send.
+type duplicateEntry struct {
+	fp ContentFingerprint
+	at time.Time
+}
+
+// maxDuplicateEntries bounds the sends remembered per recipient set.
+const maxDuplicateEntries = 1000
+
+// Observe records a send of msg and reports whether it is a duplicate. The
+// Client calls it for every message it sends; call it directly to monitor
+// mail sent by other means.
+func (d *DuplicateMonitor) Observe(msg *Message) (DuplicateEvent, bool) {
+	return d.observe(msg, time.Now())
+}
+
+func (d *DuplicateMonitor) observe(msg *Message, now time.Time) (DuplicateEvent, bool) {
+	window := d.Window
+	if window <= 0 {
+		window = time.Hour
+	}
+	threshold := d.Threshold
+	if threshold <= 0 {
+		threshold = 3
+	}
+	maxDist := d.MaxDistance
+	if maxDist == 0 {
+		maxDist = 3
+	}
+
+	fp := Fingerprint(msg)
+	rcpts := duplicateRecipients(msg)
+	key := strings.Join(rcpts, ",")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.sends == nil {
+		d.sends = make(map[string][]duplicateEntry)
+	}
+	cutoff := now.Add(-window)
+	if now.Sub(d.lastSweep) > window {
+		for k, entries := range d.sends {
+			if len(entries) == 0 || !entries[len(entries)-1].at.After(cutoff) {
+				delete(d.sends, k)
+			}
+		}
+		d.lastSweep = now
+	}
+
+	entries := d.sends[key]
+	i := 0
+	for i < len(entries) && !entries[i].at.After(cutoff) {
+		i++
+	}
+	entries = entries[i:]
+	ev := DuplicateEvent{Fingerprint: fp, Subject: msg.Subject, Recipients: rcpts, Count: 1, First: now}
+	for _, e := range entries {
+		if e.fp.Hash == fp.Hash || maxDist > 0 && e.fp.Distance(fp) <= maxDist {
+			if ev.Count == 1 {
+				ev.First = e.at
+			}
+			ev.Count++
+		}
+	}
+	if len(entries) >= maxDuplicateEntries {
+		entries = entries[1:]
+	}
+	d.sends[key] = append(entries, duplicateEntry{fp: fp, at: now})
+	return ev, ev.Count >= threshold
+}
+
+// check observes msg for the Client, reporting a duplicate to OnDuplicate
+// and refusing it if configured to.
+func (d *DuplicateMonitor) check(msg *Message) error {
+	ev, dup := d.Observe(msg)
+	if !dup {
+		return nil
+	}
+	if d.OnDuplicate != nil {
+		d.OnDuplicate(ev)
+	}
+	if d.Reject {
+		return fmt.Errorf("%w: %d sends of %q to %s since %s", ErrDuplicate, ev.Count, ev.Subject,
+			strings.Join(ev.Recipients, ", "), ev.First.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// duplicateRecipients returns msg's recipients' addresses, lower-cased and
+// sorted, so the same audience matches whatever the order or display names.
+func duplicateRecipients(msg *Message) []string {
+	var out []string
+	for _, list := range [][]string{msg.To, msg.Cc, msg.Bcc} {
+		for _, a := range list {
+			out = append(out, strings.ToLower(parseAddr(a)))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,107 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFingerprintMasksDynamicFields(t *testing.T) {
+	render := func(name, order, date, link string) *Message {
+		return &Message{
+			Subject: "Your order " + order + " has shipped",
+			Body: "Hi " + name + ",\n\nOrder " + order + " shipped on " + date + ".\n" +
+				"Track it at " + link + "\nQuestions? Write to help@example.com.",
+		}
+	}
+	a := render("Alice", "A1B2C3D4", "2024-10-16", "https://track.example.com/t/8f14e45f?u=1")
+	b := render("Alice", "Z9Y8X7W6", "2024-11-02", "https://track.example.com/t/c9f0f895?u=2")
+	if Fingerprint(a).Hash != Fingerprint(b).Hash {
+		t.Errorf("same template with different data: hashes differ")
+	}
+
+	c := render("Alice", "A1B2C3D4", "2024-10-16", "https://evil.example.net/t")
+	if Fingerprint(a).Hash == Fingerprint(c).Hash {
+		t.Errorf("different link host: hashes equal")
+	}
+
+	html := &Message{Subject: a.Subject, HTML: true, Body: "<p>Hi Alice,</p><p>Order A1B2C3D4 shipped on 2024-10-16.<br>" +
+		`Track it at https://track.example.com/t/1<br>Questions? Write to <a href="mailto:help@example.com">help@example.com</a>.</p>`}
+	if Fingerprint(html).Hash != Fingerprint(a).Hash {
+		t.Errorf("HTML rendering of the same text: hashes differ\n%q\n%q",
+			normalizeContent(HTMLToText(html.Body, TextOptions{})), normalizeContent(a.Body))
+	}
+}
+
+func TestFingerprintDistance(t *testing.T) {
+	base := "Your weekly report is ready. This week the team closed the migration, " +
+		"reviewed the incident from Tuesday and planned the next release. " +
+		"See the dashboard for details and reply to this message with any questions."
+	a := Fingerprint(&Message{Subject: "Weekly report", Body: base})
+	near := Fingerprint(&Message{Subject: "Weekly report", Body: base + " Thanks!"})
+	far := Fingerprint(&Message{Subject: "Invoice overdue", Body: "Please pay the attached invoice " +
+		"within seven days to avoid a suspension of the service and additional fees."})
+
+	if d := a.Distance(near); d > 10 {
+		t.Errorf("near-duplicate distance = %d, want small", d)
+	}
+	if d := a.Distance(far); d <= 10 {
+		t.Errorf("unrelated distance = %d, want large", d)
+	}
+	if a.Distance(a) != 0 {
+		t.Errorf("self distance != 0")
+	}
+}
+
+func TestDuplicateMonitorObserve(t *testing.T) {
+	d := &DuplicateMonitor{Window: time.Hour, Threshold: 3}
+	msg := func(to, order string) *Message {
+		return &Message{To: []string{to}, Subject: "Order " + order, Body: "Your order " + order + " is confirmed."}
+	}
+	now := time.Date(2024, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		msg     *Message
+		at      time.Duration
+		wantDup bool
+		count   int
+	}{
+		{msg("a@example.com", "1001"), 0, false, 1},
+		{msg("b@example.com", "1002"), time.Minute, false, 1}, // other recipient
+		{msg("A@Example.com", "1003"), 2 * time.Minute, false, 2},
+		{msg("Alice <a@example.com>", "1004"), 3 * time.Minute, true, 3},
+		{msg("a@example.com", "1005"), 4 * time.Minute, true, 4},
+		// Past the window of the first sends.
+		{msg("a@example.com", "1006"), 62*time.Minute + 30*time.Second, true, 3},
+		{msg("a@example.com", "1007"), 3 * time.Hour, false, 1},
+	}
+	for i, s := range steps {
+		ev, dup := d.observe(s.msg, now.Add(s.at))
+		if dup != s.wantDup || ev.Count != s.count {
+			t.Errorf("step %d: dup = %v, count = %d; want %v, %d", i, dup, ev.Count, s.wantDup, s.count)
+		}
+	}
+}
+
+func TestClientSendDuplicates(t *testing.T) {
+	var events []DuplicateEvent
+	d := &DuplicateMonitor{Threshold: 2, Reject: true, OnDuplicate: func(e DuplicateEvent) { events = append(events, e) }}
+	mock := &mockProvider{}
+	c := &Client{provider: mock, duplicates: d}
+	msg := &Message{From: "jobs@example.com", To: []string{"user@example.com"}, Subject: "Reminder", Body: "Your trial ends in 3 days."}
+
+	if err := c.SendWithContext(context.Background(), msg); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+	err := c.SendWithContext(context.Background(), msg)
+	if !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("second send: err = %v, want ErrDuplicate", err)
+	}
+	if len(mock.calls) != 1 {
+		t.Errorf("provider called %d times, want 1", len(mock.calls))
+	}
+	if len(events) != 1 || events[0].Count != 2 || events[0].Recipients[0] != "user@example.com" {
+		t.Errorf("events = %+v", events)
+	}
+}
@@ -1,17 +1,26 @@
+//go:build !email_no_gmail
+
 // gmail.go - Gmail provider implementation using Gmail API
 package email
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
@@ -21,11 +30,53 @@ type gmailProvider struct {
 	service *gmail.Service
 	config  *GmailConfig
 
+	// tokens supplies access tokens for the SMTP relay's XOAUTH2 login; the
+	// API service carries its own copy.
+	tokens oauth2.TokenSource
+
+	// dkim signs SMTP relay submissions, if configured.
+	dkim *dkimSigner
+
+	// quota counts sends per sending account against config.DailyLimit.
+	quota *dailyQuota
+
 	// labelCache maps label display name -> label id, lazily populated.
-	// Gmail's Modify endpoint takes label ids, not names.
+	// Gmail's Modify endpoint takes label ids, not names. labelMu guards it,
+	// as sends label concurrently.
+	labelMu    sync.Mutex
 	labelCache map[string]string
+
+	// sendAs caches the account's send-as aliases by lower-cased address,
+	// read at sendAsRead, for VerifySendAs. sendAsMu guards both.
+	sendAsMu   sync.Mutex
+	sendAs     map[string]*gmail.SendAs
+	sendAsRead time.Time
 }
 
+// Compile-time guarantees of the optional interfaces Gmail implements
+// (imports are checked in gmail_import.go).
+var (
+	_ MailboxProvider    = (*gmailProvider)(nil)
+	_ AttachmentProvider = (*gmailProvider)(nil)
+	_ HeaderProvider     = (*gmailProvider)(nil)
+	_ PageProvider       = (*gmailProvider)(nil)
+	_ ResultSender       = (*gmailProvider)(nil)
+	_ StatsProvider      = (*gmailProvider)(nil)
+	_ QuotaReporter      = (*gmailProvider)(nil)
+	_ sizeLimiter        = (*gmailProvider)(nil)
+)
+
+func init() {
+	RegisterProvider(ProviderGmail, func(config *Config) (Provider, error) {
+		if config.Gmail == nil {
+			return nil, fmt.Errorf("gmail configuration is required")
+		}
+		return created(newGmailProvider(config.Gmail))
+	})
+}
+
+func (g *gmailProvider) maxMessageSize() int64 { return gmailMaxMessageSize }
+
 // gmailScopes returns the OAuth scopes to request for a Gmail provider.
 // By default it requests send + modify, which covers send plus all of the
 // MailboxProvider read/move/label/trash operations. If config.Scopes is set,
@@ -37,15 +88,26 @@ type gmailProvider struct {
 // access) and the cached token replaced. Permanent deletion additionally
 // requires gmail.MailGoogleComScope (full access) — add it to config.Scopes
 // only if you need Delete(permanent=true).
+//
+// SMTP relay mode (config.SMTPRelay) authenticates with XOAUTH2, which Google
+// only grants to the full gmail.MailGoogleComScope, so that is the default
+// there instead.
 func gmailScopes(config *GmailConfig) []string {
 	if len(config.Scopes) > 0 {
 		return config.Scopes
 	}
+	if config.SMTPRelay {
+		return []string{gmail.MailGoogleComScope}
+	}
 	return []string{gmail.GmailSendScope, gmail.GmailModifyScope}
 }
 
+// defaultGmailSMTPAddr is Gmail's SMTP submission endpoint (STARTTLS).
+const defaultGmailSMTPAddr = "smtp.gmail.com:587"
+
 // newGmailProvider creates a new Gmail email provider.
-// It requires OAuth2 credentials and a token for authentication.
+// It requires OAuth2 credentials and a token for authentication, or the
+// caller's own token source or authorized HTTP client.
 //
 // Required Google OAuth2 scopes (default): gmail.send + gmail.modify. See
 // gmailScopes for the re-consent caveat when widening scopes.
@@ -56,6 +118,76 @@ func gmailScopes(config *GmailConfig) []string {
 func newGmailProvider(config *GmailConfig) (Provider, error) {
 	ctx := context.Background()
 
+	tokens, err := gmailTokenSource(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create Gmail service with OAuth2 authentication
+	var opts []option.ClientOption
+	switch {
+	case config.AuthClient != nil:
+		opts = []option.ClientOption{option.WithHTTPClient(config.AuthClient)}
+	case config.HTTPClient != nil:
+		// The oauth2 package takes its base client from the context, for
+		// token refreshes and as the transport under the authorized client.
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, config.HTTPClient)
+		opts = []option.ClientOption{option.WithHTTPClient(oauth2.NewClient(ctx, tokens))}
+	default:
+		opts = []option.ClientOption{option.WithTokenSource(tokens)}
+	}
+	if config.BaseURL != "" {
+		opts = append(opts, option.WithEndpoint(config.BaseURL))
+	}
+	service, err := gmail.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Gmail service: %w", err)
+	}
+
+	g := &gmailProvider{
+		service: service,
+		config:  config,
+		tokens:  tokens,
+		quota:   newDailyQuota(config.DailyLimit, pacificTime()),
+	}
+	if len(config.SentLabels) > 0 && config.SMTPRelay {
+		return nil, fmt.Errorf("gmail: SentLabels cannot be combined with SMTPRelay")
+	}
+	if config.DKIM != nil {
+		if !config.SMTPRelay {
+			return nil, fmt.Errorf("gmail: DKIM signing requires SMTPRelay")
+		}
+		if g.dkim, err = newDKIMSigner(config.DKIM); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// gmailTokenSource returns the access tokens for config: its TokenSource,
+// or the token of TokenJSON, refreshed with the client of CredentialsJSON.
+// It returns nil for an AuthClient, which authorizes requests itself.
+func gmailTokenSource(ctx context.Context, config *GmailConfig) (oauth2.TokenSource, error) {
+	switch {
+	case config.AuthClient != nil:
+		if config.TokenSource != nil || len(config.TokenJSON) > 0 || len(config.CredentialsJSON) > 0 {
+			return nil, fmt.Errorf("gmail: AuthClient cannot be combined with TokenSource, TokenJSON or CredentialsJSON")
+		}
+		if config.SMTPRelay {
+			return nil, fmt.Errorf("gmail: SMTPRelay needs a TokenSource or TokenJSON, not an AuthClient")
+		}
+		return nil, nil
+	case config.TokenSource != nil:
+		if len(config.TokenJSON) > 0 || len(config.CredentialsJSON) > 0 {
+			return nil, fmt.Errorf("gmail: TokenSource cannot be combined with TokenJSON or CredentialsJSON")
+		}
+		ts, ok := config.TokenSource.(oauth2.TokenSource)
+		if !ok {
+			return nil, fmt.Errorf("gmail: token source of type %T is not an oauth2.TokenSource", config.TokenSource)
+		}
+		return oauth2.ReuseTokenSource(nil, ts), nil
+	}
+
 	// Parse OAuth2 config from credentials
 	oauthConfig, err := google.ConfigFromJSON(config.CredentialsJSON, gmailScopes(config)...)
 	if err != nil {
@@ -63,153 +195,300 @@ func newGmailProvider(config *GmailConfig) (Provider, error) {
 	}
 
 	// Parse the OAuth2 token
-	var token *oauth2.Token
-	if len(config.TokenJSON) > 0 {
-		token = &oauth2.Token{}
-		if err := json.Unmarshal(config.TokenJSON, token); err != nil {
-			return nil, fmt.Errorf("invalid token: %w", err)
-		}
-	} else {
+	if len(config.TokenJSON) == 0 {
 		// If no token provided, guide user to authenticate
 		return nil, fmt.Errorf("gmail requires initial OAuth authentication - please use the authentication helper")
 	}
-
-	// Create Gmail service with OAuth2 authentication
-	service, err := gmail.NewService(ctx, option.WithTokenSource(oauthConfig.TokenSource(ctx, token)))
-	if err != nil {
-		return nil, fmt.Errorf("unable to create Gmail service: %w", err)
+	token := &oauth2.Token{}
+	if err := json.Unmarshal(config.TokenJSON, token); err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
 	}
-
-	return &gmailProvider{
-		service: service,
-		config:  config,
-	}, nil
+	if config.HTTPClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, config.HTTPClient)
+	}
+	return oauthConfig.TokenSource(ctx, token), nil
 }
 
 // Send sends an email message using the Gmail API.
 // It constructs a properly formatted RFC 2822 message and sends it
-// through the authenticated user's Gmail account.
+// through the authenticated user's Gmail account. In SMTP relay mode the same
+// message is submitted over SMTP instead (see sendSMTP). Either way Gmail
+// keeps the sent message under the SENT label; Message.SaveToSent is
+// ignored, as the API has no way to skip that.
 func (g *gmailProvider) Send(ctx context.Context, msg *Message) error {
-	// Create Gmail message
-	gmailMsg, err := g.createMessage(msg)
+	return gmailAPIError(g.send(ctx, msg))
+}
+
+// send is Send, with provider errors not yet wrapped as *APIError.
+func (g *gmailProvider) send(ctx context.Context, msg *Message) error {
+	if err := g.checkLabels(msg); err != nil {
+		return err
+	}
+	msg, err := g.withSendAs(ctx, msg)
+	if err != nil {
+		return err
+	}
+	var sent *gmail.Message
+	err = g.metered(msg, func() (err error) {
+		if g.config.SMTPRelay {
+			return g.sendSMTP(ctx, msg)
+		}
+		sent, err = g.sendAPI(ctx, msg)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("unable to create message: %w", err)
+		return err
 	}
+	return g.labelSent(ctx, sent, msg)
+}
 
-	// Send the message
-	_, err = g.service.Users.Messages.Send("me", gmailMsg).Context(ctx).Do()
+// SendWithResult sends msg like Send and reports its Message-ID and, through
+// the API, the Gmail message and thread ids. Gmail may replace the
+// Message-ID it was given; the one actually sent is read back when the
+// token's scopes allow reading messages, at the cost of one more request.
+func (g *gmailProvider) SendWithResult(ctx context.Context, msg *Message) (*SendResult, error) {
+	res, err := g.sendWithResult(ctx, msg)
+	return res, gmailAPIError(err)
+}
+
+// sendWithResult is SendWithResult, with provider errors not yet wrapped
+// as *APIError.
+func (g *gmailProvider) sendWithResult(ctx context.Context, msg *Message) (*SendResult, error) {
+	if err := g.checkLabels(msg); err != nil {
+		return nil, err
+	}
+	msg, err := g.withSendAs(ctx, msg)
 	if err != nil {
-		return fmt.Errorf("unable to send message: %w", err)
+		return nil, err
+	}
+	msg, id := withMessageID(msg)
+	if g.config.SMTPRelay {
+		if err := g.metered(msg, func() error { return g.sendSMTP(ctx, msg) }); err != nil {
+			return nil, err
+		}
+		return &SendResult{MessageID: id}, nil
+	}
+	var sent *gmail.Message
+	err = g.metered(msg, func() (err error) {
+		sent, err = g.sendAPI(ctx, msg)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := &SendResult{MessageID: id, ProviderID: sent.Id, ThreadID: sent.ThreadId}
+	if err := g.labelSent(ctx, sent, msg); err != nil {
+		return res, err
 	}
+	m, err := g.service.Users.Messages.Get("me", sent.Id).
+		Format("metadata").MetadataHeaders("Message-ID").Context(ctx).Do()
+	if err == nil && m.Payload != nil {
+		for _, h := range m.Payload.Headers {
+			if strings.EqualFold(h.Name, "Message-Id") {
+				res.MessageID = strings.Trim(strings.TrimSpace(h.Value), "<>")
+			}
+		}
+	}
+	return res, nil
+}
 
+// Quota returns user's usage of the daily quota. Only sends through this
+// provider are counted.
+func (g *gmailProvider) Quota(user string) Quota {
+	return g.quota.quota(strings.ToLower(user))
+}
+
+// metered runs send, which sends msg, within the daily quota of msg's
+// sending account: the SMTPUser in relay mode if set, the From address
+// otherwise.
+func (g *gmailProvider) metered(msg *Message, send func() error) error {
+	user := g.config.SMTPUser
+	if user == "" || !g.config.SMTPRelay {
+		user = parseAddr(msg.From)
+	}
+	user = strings.ToLower(user)
+	if err := g.quota.acquire(user); err != nil {
+		return err
+	}
+	if err := send(); err != nil {
+		return g.quota.release(user, gmailQuotaError(err), err)
+	}
 	return nil
 }
 
-// createMessage constructs a Gmail API message from our Message struct.
-// It creates a properly formatted RFC 2822 email with headers, body,
-// and attachments encoded in base64.
-func (g *gmailProvider) createMessage(msg *Message) (*gmail.Message, error) {
-	var message strings.Builder
+// gmailQuotaError reports whether err is Gmail refusing a send because the
+// account's daily sending limit is reached: an API error with a daily limit
+// reason, or the relay's "5.4.5 Daily user sending limit exceeded".
+func gmailQuotaError(err error) bool {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		for _, item := range gerr.Errors {
+			if item.Reason == "dailyLimitExceeded" || item.Reason == "quotaExceeded" {
+				return true
+			}
+		}
+		return gmailQuotaText(gerr.Message)
+	}
+	var tp *textproto.Error
+	if errors.As(err, &tp) {
+		return strings.Contains(tp.Msg, "5.4.5") || gmailQuotaText(tp.Msg)
+	}
+	return false
+}
+
+// gmailQuotaText reports whether an error message speaks of the sending
+// limit.
+func gmailQuotaText(s string) bool {
+	s = strings.ToLower(s)
+	return strings.Contains(s, "sending limit") || strings.Contains(s, "sending quota")
+}
 
-	// Create email headers
-	headers := make(map[string]string)
-	headers["From"] = msg.From
-	headers["To"] = strings.Join(msg.To, ", ")
+// sendAPI sends msg through the Gmail API and returns the sent message's
+// ids.
+func (g *gmailProvider) sendAPI(ctx context.Context, msg *Message) (*gmail.Message, error) {
+	if hasStreamedAttachments(msg) {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(writeMessage(pw, msg, rawOptions{withBcc: true}))
+		}()
+		defer pr.Close()
+		return g.sendMedia(ctx, pr)
+	}
 
-	if len(msg.Cc) > 0 {
-		headers["Cc"] = strings.Join(msg.Cc, ", ")
+	// Gmail strips the Bcc header itself after reading the recipients from it.
+	raw, err := buildRawMessage(msg, true)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create message: %w", err)
+	}
+	if len(raw) > gmailMaxMessageSize {
+		return nil, fmt.Errorf("unable to send message: %w",
+			&MessageTooLargeError{Provider: "gmail", Size: int64(len(raw)), Limit: gmailMaxMessageSize})
+	}
+	if len(raw) > gmailRawLimit {
+		return g.sendMedia(ctx, bytes.NewReader(raw))
 	}
 
-	if len(msg.Bcc) > 0 {
-		headers["Bcc"] = strings.Join(msg.Bcc, ", ")
+	// Send the message
+	sent, err := g.service.Users.Messages.Send("me", g.rawMessage(raw)).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to send message: %w", gmailSendError(err))
 	}
 
-	headers["Subject"] = msg.Subject
-	headers["MIME-Version"] = "1.0"
+	return sent, nil
+}
 
-	// Handle attachments or simple message
-	if len(msg.Attachments) > 0 {
-		// Multipart message with attachments
-		boundary := fmt.Sprintf("boundary-%d", time.Now().UnixNano())
-		headers["Content-Type"] = "multipart/mixed; boundary=" + boundary
+// Gmail API message size limits.
+const (
+	// gmailRawLimit is the largest message sent inline as base64 in the
+	// JSON request; larger ones go through the upload endpoint.
+	gmailRawLimit = 5 << 20
 
-		// Write headers
-		for k, v := range headers {
-			fmt.Fprintf(&message, "%s: %s\r\n", k, v)
+	// gmailMaxMessageSize is the upload endpoint's limit for messages.send.
+	gmailMaxMessageSize = 35 << 20
+
+	// gmailUploadChunkSize is the resumable upload chunk size. Messages
+	// larger than one chunk are uploaded in resumable sessions, chunk by
+	// chunk with retries, instead of in a single request.
+	gmailUploadChunkSize = 8 << 20
+)
+
+// sendMedia sends a rendered message through the API's upload endpoint
+// rather than base64-encoding it into the JSON body. A message larger than
+// one chunk is sent as a resumable upload; the client library buffers at
+// most one chunk, so streamed attachments (Attachment.Open) are never held
+// in memory whole.
+func (g *gmailProvider) sendMedia(ctx context.Context, r io.Reader) (*gmail.Message, error) {
+	sent, err := g.service.Users.Messages.Send("me", &gmail.Message{}).
+		Media(r, googleapi.ContentType("message/rfc822"), googleapi.ChunkSize(gmailUploadChunkSize)).
+		Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to send message: %w", gmailSendError(err))
+	}
+	return sent, nil
+}
+
+// gmailSendError maps a 413 response to ErrMessageTooLarge.
+func gmailSendError(err error) error {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == http.StatusRequestEntityTooLarge {
+		return fmt.Errorf("%w: %w", ErrMessageTooLarge, err)
+	}
+	return err
+}
+
+// gmailAPIError wraps a Gmail API or Google OAuth2 refusal in err as an
+// *APIError, which carries a hint for its error reason.
+func gmailAPIError(err error) error {
+	var gerr *googleapi.Error
+	var oauth *oauth2.RetrieveError
+	switch {
+	case errors.As(err, &gerr):
+		var reason string
+		if len(gerr.Errors) > 0 {
+			reason = gerr.Errors[0].Reason
 		}
-		message.WriteString("\r\n")
-
-		// Write body part
-		message.WriteString("--" + boundary + "\r\n")
-		if msg.HTML {
-			message.WriteString("Content-Type: text/html; charset=utf-8\r\n")
-		} else {
-			message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		return apiError(ProviderGmail, gerr.Code, reason, err)
+	case errors.As(err, &oauth):
+		var status int
+		if oauth.Response != nil {
+			status = oauth.Response.StatusCode
 		}
-		message.WriteString("\r\n")
-		message.WriteString(msg.Body)
-		message.WriteString("\r\n\r\n")
+		return apiError(ProviderGmail, status, oauth.ErrorCode, err)
+	}
+	return err
+}
 
-		// Write attachments
-		for _, att := range msg.Attachments {
-			g.addAttachment(&message, att, boundary)
-		}
+// rawMessage wraps RFC 2822 bytes as a Gmail API message, base64url-encoded
+// as the Raw field requires.
+func (g *gmailProvider) rawMessage(raw []byte) *gmail.Message {
+	return &gmail.Message{
+		Raw: base64.URLEncoding.EncodeToString(raw),
+	}
+}
 
-		// End boundary
-		message.WriteString("--" + boundary + "--\r\n")
-	} else {
-		// Simple message without attachments
-		if msg.HTML {
-			headers["Content-Type"] = "text/html; charset=utf-8"
-		} else {
-			headers["Content-Type"] = "text/plain; charset=utf-8"
-		}
+// sendSMTP submits msg through Gmail's SMTP server, authenticating as
+// config.SMTPUser (default: the From address) with an XOAUTH2 access token.
+// This avoids the Gmail API scope, which some Workspace tenants restrict, and
+// the base64-in-JSON inflation of the API's raw upload.
+func (g *gmailProvider) sendSMTP(ctx context.Context, msg *Message) error {
+	token, err := g.tokens.Token()
+	if err != nil {
+		return fmt.Errorf("unable to obtain access token: %w", err)
+	}
 
-		// Write headers
-		for k, v := range headers {
-			fmt.Fprintf(&message, "%s: %s\r\n", k, v)
-		}
-		message.WriteString("\r\n")
-		message.WriteString(msg.Body)
+	from := asciiAddress(parseAddr(msg.From))
+	user := g.config.SMTPUser
+	if user == "" {
+		user = from
+	}
+	addr := g.config.SMTPAddr
+	if addr == "" {
+		addr = defaultGmailSMTPAddr
 	}
 
-	// Encode the entire message in base64 for Gmail API
-	raw := base64.URLEncoding.EncodeToString([]byte(message.String()))
+	rcpts := messageRecipients(msg)
+	for i, r := range rcpts {
+		rcpts[i] = asciiAddress(parseAddr(r))
+	}
 
-	return &gmail.Message{
-		Raw: raw,
-	}, nil
-}
-
-// addAttachment adds a single attachment to the email message.
-// It encodes the attachment content in base64 and formats it according
-// to RFC 2822 standards with proper MIME headers.
-func (g *gmailProvider) addAttachment(message *strings.Builder, att Attachment, boundary string) {
-	// Determine MIME type
-	mimeType := att.MimeType
-	if mimeType == "" {
-		mimeType = getContentType(att.Filename)
-	}
-
-	// Write attachment headers
-	message.WriteString("--" + boundary + "\r\n")
-	fmt.Fprintf(message, "Content-Type: %s; name=\"%s\"\r\n", mimeType, att.Filename)
-	message.WriteString("Content-Transfer-Encoding: base64\r\n")
-	fmt.Fprintf(message, "Content-Disposition: attachment; filename=\"%s\"\r\n", att.Filename)
-	message.WriteString("\r\n")
-
-	// Encode content in base64
-	encoded := base64.StdEncoding.EncodeToString(att.Content)
-
-	// Write encoded content in 76-character lines (RFC 2045 standard)
-	for i := 0; i < len(encoded); i += 76 {
-		end := i + 76
-		if end > len(encoded) {
-			end = len(encoded)
+	auth := &xoauth2Auth{user: user, token: token.AccessToken}
+	boundary := newBoundary()
+	m := smtpMessage{
+		from:  from,
+		rcpts: rcpts,
+		dsn:   msg.DSN,
+		write: func(w io.Writer, sevenBit bool) error {
+			return writeMessage(w, msg, rawOptions{sevenBit: sevenBit, boundary: boundary})
+		},
+	}
+	if g.dkim != nil {
+		if m.write, _, err = signedSMTPMessage(msg, g.dkim); err != nil {
+			return fmt.Errorf("unable to create message: %w", err)
 		}
-		message.WriteString(encoded[i:end])
-		message.WriteString("\r\n")
 	}
-
-	message.WriteString("\r\n")
+	srv := smtpServer{addr: addr, auth: auth, security: g.config.SMTPSecurity, pins: g.config.SMTPPins}
+	if err := smtpSend(ctx, srv, m); err != nil {
+		return fmt.Errorf("unable to send message: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,63 @@
+//go:build !email_no_gmail
+
+// gmail_labels.go - Labelling a sent message. Gmail files every message sent
+// through the API under SENT; Message.Labels and GmailConfig.SentLabels add
+// user labels ("automated/invoices") to it using the id the send returns,
+// creating missing labels as Move and SetLabels do. This is Gmail's
+// counterpart to Outlook's Message.SentFolder.
+package email
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// sentLabels returns the labels to apply to msg once sent: the configured
+// SentLabels, then the message's own, without duplicates.
+func (g *gmailProvider) sentLabels(msg *Message) []string {
+	if len(msg.Labels) == 0 {
+		return g.config.SentLabels
+	}
+	seen := make(map[string]bool)
+	var out []string
+	for _, l := range append(append([]string(nil), g.config.SentLabels...), msg.Labels...) {
+		if !seen[l] {
+			seen[l] = true
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// checkLabels rejects labels on SMTP relay sends before they go out: the
+// relay returns no message id to label.
+func (g *gmailProvider) checkLabels(msg *Message) error {
+	if g.config.SMTPRelay && len(msg.Labels) > 0 {
+		return fmt.Errorf("gmail: Labels cannot be applied to SMTP relay sends: %w", ErrUnsupported)
+	}
+	return nil
+}
+
+// labelSent applies the sent labels of msg to sent, the message the API
+// returned. The send has gone out, so errors wrap ErrPartialSend.
+func (g *gmailProvider) labelSent(ctx context.Context, sent *gmail.Message, msg *Message) error {
+	labels := g.sentLabels(msg)
+	if len(labels) == 0 || sent == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(labels))
+	for _, name := range labels {
+		id, err := g.resolveLabelIDCreating(ctx, name)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrPartialSend, err)
+		}
+		ids = append(ids, id)
+	}
+	req := &gmail.ModifyMessageRequest{AddLabelIds: ids}
+	if _, err := g.service.Users.Messages.Modify("me", sent.Id, req).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("%w: label %s: %w", ErrPartialSend, sent.Id, err)
+	}
+	return nil
+}
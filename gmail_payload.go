@@ -0,0 +1,52 @@
+//go:build !email_no_gmail
+
+// gmail_payload.go - The Gmail messages.send request for a Message, built
+// without a Client (see payload.go).
+package email
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// BuildGmailPayload returns the Gmail API request that sends msg from the
+// authorized account, as a Gmail Client's Send would: messages.send with the
+// message base64url-encoded in a JSON body, or through the upload endpoint
+// as message/rfc822 when it is too large for that. The request needs an
+// access token with the gmail.send scope, and is sent as "me", the
+// account the token was issued for.
+//
+// Message.Labels are applied after a send, so messages with labels are
+// rejected here.
+func BuildGmailPayload(msg *Message) (*Payload, error) {
+	msg, err := preparePayload(msg)
+	if err != nil {
+		return nil, err
+	}
+	// Gmail strips the Bcc header itself after reading the recipients from it.
+	raw, err := buildRawMessage(msg, true)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create message: %w", err)
+	}
+	if len(raw) > gmailMaxMessageSize {
+		return nil, &MessageTooLargeError{Provider: "gmail", Size: int64(len(raw)), Limit: gmailMaxMessageSize}
+	}
+	if len(raw) > gmailRawLimit {
+		return &Payload{
+			Method:      "POST",
+			Path:        "/upload/gmail/v1/users/me/messages/send?uploadType=media",
+			ContentType: "message/rfc822",
+			Body:        raw,
+		}, nil
+	}
+	body, err := json.Marshal((&gmailProvider{}).rawMessage(raw))
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode message: %w", err)
+	}
+	return &Payload{
+		Method:      "POST",
+		Path:        "/gmail/v1/users/me/messages/send",
+		ContentType: "application/json",
+		Body:        body,
+	}, nil
+}
@@ -1,3 +1,5 @@
+//go:build !email_no_gmail
+
 // gmail_read.go - Gmail implementation of the MailboxProvider read/management
 // operations. The send path lives in gmail.go; this file adds list/read/
 // search/move/attachments/flags/delete/folders.
@@ -14,8 +16,8 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
-	"mime"
 	"net/mail"
+	"net/textproto"
 	"os"
 	"strings"
 	"time"
@@ -130,6 +132,9 @@ func (g *gmailProvider) Read(ctx context.Context, id string) (*FullMessage, erro
 	full := &FullMessage{Summary: gmailSummary(m)}
 	full.To = splitAddrs(gmailHeader(m, "To"))
 	full.Cc = splitAddrs(gmailHeader(m, "Cc"))
+	full.MessageID = strings.Trim(gmailHeader(m, "Message-Id"), "<>")
+	full.References = gmailHeader(m, "References")
+	full.ReplyTo = parseAddr(gmailHeader(m, "Reply-To"))
 	if m.Payload != nil {
 		full.BodyText = gmailBodyByType(m.Payload, "text/plain")
 		full.BodyHTML = gmailBodyByType(m.Payload, "text/html")
@@ -207,6 +212,40 @@ func (g *gmailProvider) SaveAttachments(ctx context.Context, id, destDir string)
 	return saved, walkErr
 }
 
+// GetAttachment fetches one attachment by its attachment id (messages.
+// attachments.get), the same call attachmentData makes for large parts.
+func (g *gmailProvider) GetAttachment(ctx context.Context, id, attachmentID string) ([]byte, error) {
+	if attachmentID == "" {
+		return nil, fmt.Errorf("gmail get attachment %s: empty attachment id: %w", id, ErrNotFound)
+	}
+	att, err := g.service.Users.Messages.Attachments.Get("me", id, attachmentID).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("gmail get attachment %s/%s: %w", id, attachmentID, err)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(att.Data)
+	if err != nil {
+		return nil, fmt.Errorf("gmail get attachment %s/%s: %w", id, attachmentID, err)
+	}
+	return data, nil
+}
+
+// MessageHeaders fetches the message in metadata format, which carries every
+// header field without the body.
+func (g *gmailProvider) MessageHeaders(ctx context.Context, id string) (mail.Header, error) {
+	m, err := g.service.Users.Messages.Get("me", id).Format("metadata").Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("gmail headers %s: %w", id, err)
+	}
+	h := make(mail.Header)
+	if m.Payload != nil {
+		for _, f := range m.Payload.Headers {
+			k := textproto.CanonicalMIMEHeaderKey(f.Name)
+			h[k] = append(h[k], f.Value)
+		}
+	}
+	return h, nil
+}
+
 // SaveMessageRaw is not implemented for Gmail. The .eml-filing consumer (dl)
 // operates on Outlook mailboxes only; Gmail raw export (messages.get
 // format=raw, base64url -> m.Raw) can be added if a Gmail consumer ever needs
@@ -317,6 +356,7 @@ func (g *gmailProvider) ListFolders(ctx context.Context) ([]Folder, error) {
 // --- label resolution -------------------------------------------------------
 
 // loadLabels populates the name->id cache from the Labels.List endpoint.
+// g.labelMu must be held.
 func (g *gmailProvider) loadLabels(ctx context.Context) error {
 	resp, err := g.service.Users.Labels.List("me").Context(ctx).Do()
 	if err != nil {
@@ -334,6 +374,8 @@ func (g *gmailProvider) resolveLabelID(ctx context.Context, name string) (string
 	if gmailSystemLabels[strings.ToUpper(name)] {
 		return strings.ToUpper(name), nil
 	}
+	g.labelMu.Lock()
+	defer g.labelMu.Unlock()
 	if g.labelCache == nil {
 		if err := g.loadLabels(ctx); err != nil {
 			return "", err
@@ -351,6 +393,8 @@ func (g *gmailProvider) resolveLabelIDCreating(ctx context.Context, name string)
 	if gmailSystemLabels[strings.ToUpper(name)] {
 		return strings.ToUpper(name), nil
 	}
+	g.labelMu.Lock()
+	defer g.labelMu.Unlock()
 	if g.labelCache == nil {
 		if err := g.loadLabels(ctx); err != nil {
 			return "", err
@@ -467,41 +511,60 @@ func walkParts(part *gmail.MessagePart, fn func(*gmail.MessagePart)) {
 	}
 }
 
-// decodeMIMEHeader decodes RFC 2047 encoded-words (e.g. UTF-8 Croatian
-// subjects) to plain UTF-8, returning the input unchanged on failure.
-func decodeMIMEHeader(s string) string {
-	if s == "" || !strings.Contains(s, "=?") {
-		return s
+// ListPage returns one page of List (q.Search empty) or Search results; the
+// page token is Gmail's nextPageToken.
+func (g *gmailProvider) ListPage(ctx context.Context, q MessageQuery, pageToken string) ([]Summary, string, error) {
+	query := gmailQuery(q.ListOptions)
+	call := g.service.Users.Messages.List("me").Context(ctx).MaxResults(int64(q.PageSize))
+	if q.Search != "" {
+		query = strings.TrimSpace(q.Search + " " + query)
+	} else {
+		label := q.Folder
+		if label == "" {
+			label = labelInbox
+		}
+		labelID, err := g.resolveLabelID(ctx, label)
+		if err != nil {
+			return nil, "", err
+		}
+		call = call.LabelIds(labelID)
 	}
-	dec := new(mime.WordDecoder)
-	if out, err := dec.DecodeHeader(s); err == nil {
-		return out
+	if query != "" {
+		call = call.Q(query)
 	}
-	return s
-}
-
-// parseAddr extracts the bare address from a possibly display-named header
-// value (e.g. `Marios <m@x.com>` -> `m@x.com`).
-func parseAddr(s string) string {
-	s = strings.TrimSpace(s)
-	if i := strings.LastIndex(s, "<"); i >= 0 {
-		if j := strings.Index(s[i:], ">"); j >= 0 {
-			return strings.TrimSpace(s[i+1 : i+j])
-		}
+	if pageToken != "" {
+		call = call.PageToken(pageToken)
 	}
-	return s
+	resp, err := call.Do()
+	if err != nil {
+		return nil, "", fmt.Errorf("gmail list: %w", err)
+	}
+	out, err := g.hydrate(ctx, resp.Messages)
+	if err != nil {
+		return nil, "", err
+	}
+	return out, resp.NextPageToken, nil
 }
 
-// splitAddrs splits a comma-separated recipient header into bare addresses.
-func splitAddrs(s string) []string {
-	if strings.TrimSpace(s) == "" {
-		return nil
+// MailboxStats reports the profile's message count and the INBOX and UNREAD
+// label counts. The Gmail API does not expose storage quota.
+func (g *gmailProvider) MailboxStats(ctx context.Context) (*MailboxStats, error) {
+	profile, err := g.service.Users.GetProfile("me").Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("gmail profile: %w", err)
 	}
-	var out []string
-	for _, part := range strings.Split(s, ",") {
-		if a := parseAddr(decodeMIMEHeader(part)); a != "" {
-			out = append(out, a)
-		}
+	inbox, err := g.service.Users.Labels.Get("me", labelInbox).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("gmail label %s: %w", labelInbox, err)
 	}
-	return out
+	unread, err := g.service.Users.Labels.Get("me", labelUnread).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("gmail label %s: %w", labelUnread, err)
+	}
+	return &MailboxStats{
+		Total:       profile.MessagesTotal,
+		Unread:      unread.MessagesTotal,
+		InboxTotal:  inbox.MessagesTotal,
+		InboxUnread: inbox.MessagesUnread,
+	}, nil
 }
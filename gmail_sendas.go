@@ -0,0 +1,76 @@
+//go:build !email_no_gmail
+
+// gmail_sendas.go - Sending from a Gmail alias. Gmail sends a message from
+// an address other than the account's own only when it is one of the
+// account's send-as aliases and verified; otherwise it silently rewrites
+// From to the primary address. With GmailConfig.VerifySendAs the provider
+// checks From against the account's sendAs settings before sending and
+// fails the send with a *SendAsError instead.
+package email
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// sendAsRefresh is how long the sendAs settings are reused before an
+// unknown or unverified From address reads them again, e.g. to pick up an
+// alias verified since.
+const sendAsRefresh = time.Minute
+
+// withSendAs returns msg checked against the account's send-as aliases when
+// VerifySendAs is set. A From without a display name gets the alias's, as
+// Gmail's own compose window does; msg itself is never changed.
+func (g *gmailProvider) withSendAs(ctx context.Context, msg *Message) (*Message, error) {
+	if !g.config.VerifySendAs {
+		return msg, nil
+	}
+	addr := strings.ToLower(parseAddr(msg.From))
+	alias, err := g.sendAsAlias(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case alias == nil:
+		return nil, &SendAsError{Address: addr}
+	case alias.VerificationStatus == "pending":
+		return nil, &SendAsError{Address: addr, Status: alias.VerificationStatus}
+	}
+	from, err := mail.ParseAddress(msg.From)
+	if alias.DisplayName == "" || err != nil || from.Name != "" {
+		return msg, nil
+	}
+	out := *msg
+	out.From = formatAddress(&mail.Address{Name: alias.DisplayName, Address: from.Address})
+	return &out, nil
+}
+
+// sendAsAlias returns the account's send-as alias for addr, or nil if it
+// has none. The settings are cached; a miss or an unverified alias reads
+// them again once they are sendAsRefresh old.
+func (g *gmailProvider) sendAsAlias(ctx context.Context, addr string) (*gmail.SendAs, error) {
+	g.sendAsMu.Lock()
+	defer g.sendAsMu.Unlock()
+	alias := g.sendAs[addr]
+	if g.sendAs != nil && alias != nil && alias.VerificationStatus != "pending" {
+		return alias, nil
+	}
+	if g.sendAs != nil && time.Since(g.sendAsRead) < sendAsRefresh {
+		return alias, nil
+	}
+	resp, err := g.service.Users.Settings.SendAs.List("me").Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("gmail: read send-as settings: %w", err)
+	}
+	g.sendAs = make(map[string]*gmail.SendAs, len(resp.SendAs))
+	for _, s := range resp.SendAs {
+		g.sendAs[strings.ToLower(s.SendAsEmail)] = s
+	}
+	g.sendAsRead = time.Now()
+	return g.sendAs[addr], nil
+}
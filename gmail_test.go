@@ -0,0 +1,447 @@
+//go:build !email_no_gmail
+
+package email
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+func TestGmailBaseURLAndHTTPClient(t *testing.T) {
+	var gotPath, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"m1"}`)
+	}))
+	defer srv.Close()
+
+	creds := []byte(`{"installed":{"client_id":"id","client_secret":"secret",` +
+		`"auth_uri":"https://accounts.google.com/o/oauth2/auth","token_uri":"https://oauth2.googleapis.com/token","redirect_uris":["http://localhost"]}}`)
+	token := []byte(`{"access_token":"tok","token_type":"Bearer","expiry":"2999-01-01T00:00:00Z"}`)
+
+	provider, err := newGmailProvider(&GmailConfig{
+		CredentialsJSON: creds,
+		TokenJSON:       token,
+		BaseURL:         srv.URL + "/",
+		HTTPClient:      srv.Client(),
+	})
+	if err != nil {
+		t.Fatalf("newGmailProvider() error = %v", err)
+	}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+	if err := provider.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if gotPath != "/gmail/v1/users/me/messages/send" {
+		t.Errorf("request path = %q", gotPath)
+	}
+	if gotAuth != "Bearer tok" {
+		t.Errorf("Authorization = %q, want %q", gotAuth, "Bearer tok")
+	}
+}
+
+// newTestGmail returns a Gmail provider talking to handler.
+func newTestGmail(t *testing.T, handler http.HandlerFunc) Provider {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	creds := []byte(`{"installed":{"client_id":"id","client_secret":"secret",` +
+		`"auth_uri":"https://accounts.google.com/o/oauth2/auth","token_uri":"https://oauth2.googleapis.com/token","redirect_uris":["http://localhost"]}}`)
+	token := []byte(`{"access_token":"tok","token_type":"Bearer","expiry":"2999-01-01T00:00:00Z"}`)
+	provider, err := newGmailProvider(&GmailConfig{CredentialsJSON: creds, TokenJSON: token, BaseURL: srv.URL + "/", HTTPClient: srv.Client()})
+	if err != nil {
+		t.Fatalf("newGmailProvider() error = %v", err)
+	}
+	return provider
+}
+
+func TestGmailSendStreamedAttachment(t *testing.T) {
+	var gotPath, gotBody string
+	provider := newTestGmail(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"m1"}`)
+	})
+
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+	msg.AttachStream("report.txt", func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("streamed report")), nil
+	})
+	if err := provider.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if gotPath != "/upload/gmail/v1/users/me/messages/send" {
+		t.Errorf("request path = %q, want the media upload endpoint", gotPath)
+	}
+	if want := base64.StdEncoding.EncodeToString([]byte("streamed report")); !strings.Contains(gotBody, want) {
+		t.Errorf("upload lacks the attachment content:\n%s", gotBody)
+	}
+}
+
+func TestGmailSendLargeMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		status   int
+		wantPath string
+		wantErr  error
+	}{
+		{"small inline", 1 << 10, http.StatusOK, "/gmail/v1/users/me/messages/send", nil},
+		{"upload above raw limit", gmailRawLimit + 1<<20, http.StatusOK, "/upload/gmail/v1/users/me/messages/send", nil},
+		{"rejected by server", gmailRawLimit + 1<<20, http.StatusRequestEntityTooLarge, "/upload/gmail/v1/users/me/messages/send", ErrMessageTooLarge},
+		{"over max size", gmailMaxMessageSize, http.StatusOK, "", ErrMessageTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath string
+			provider := newTestGmail(t, func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				io.Copy(io.Discard, r.Body)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				if tt.status == http.StatusOK {
+					io.WriteString(w, `{"id":"m1"}`)
+				} else {
+					io.WriteString(w, `{"error":{"code":413,"message":"Request Entity Too Large"}}`)
+				}
+			})
+			msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+				Attachments: []Attachment{{Filename: "big.bin", Content: make([]byte, tt.size*3/4)}}}
+			err := provider.Send(context.Background(), msg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Send() error = %v, want %v", err, tt.wantErr)
+			}
+			if gotPath != tt.wantPath {
+				t.Errorf("request path = %q, want %q", gotPath, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestGmailDKIMRequiresSMTPRelay(t *testing.T) {
+	creds := []byte(`{"installed":{"client_id":"id","client_secret":"secret",` +
+		`"auth_uri":"https://accounts.google.com/o/oauth2/auth","token_uri":"https://oauth2.googleapis.com/token","redirect_uris":["http://localhost"]}}`)
+	token := []byte(`{"access_token":"tok","token_type":"Bearer","expiry":"2999-01-01T00:00:00Z"}`)
+	dkim := &DKIMConfig{Domain: "example.com", Selector: "s", PrivateKeyPEM: []byte("not a key")}
+	if _, err := newGmailProvider(&GmailConfig{CredentialsJSON: creds, TokenJSON: token, DKIM: dkim}); err == nil || !strings.Contains(err.Error(), "SMTPRelay") {
+		t.Errorf("API mode: error = %v, want SMTPRelay error", err)
+	}
+	if _, err := newGmailProvider(&GmailConfig{CredentialsJSON: creds, TokenJSON: token, SMTPRelay: true, DKIM: dkim}); err == nil {
+		t.Error("SMTPRelay with an invalid key: want error")
+	}
+}
+
+func TestGmailDailyQuota(t *testing.T) {
+	requests := 0
+	provider := newTestGmail(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		if requests == 2 {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"error":{"code":403,"message":"Daily user sending limit exceeded.","errors":[{"reason":"dailyLimitExceeded","message":"Daily user sending limit exceeded."}]}}`)
+			return
+		}
+		io.WriteString(w, `{"id":"m1"}`)
+	})
+	g := provider.(*gmailProvider)
+	msg := &Message{From: "News <News@example.com>", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+
+	if err := g.Send(context.Background(), msg); err != nil {
+		t.Fatalf("first Send() error = %v", err)
+	}
+	if q := g.Quota("news@example.com"); q.Used != 1 || q.Remaining != -1 {
+		t.Errorf("Quota() = %+v", q)
+	}
+	err := g.Send(context.Background(), msg)
+	var qerr *QuotaExceededError
+	if !errors.As(err, &qerr) || qerr.User != "news@example.com" || qerr.Err == nil {
+		t.Fatalf("second Send() error = %v, want *QuotaExceededError from Gmail", err)
+	}
+	if _, err := g.SendWithResult(context.Background(), msg); !errors.Is(err, ErrDailyQuotaExceeded) {
+		t.Errorf("third send error = %v, want ErrDailyQuotaExceeded", err)
+	}
+	if requests != 2 {
+		t.Errorf("Gmail received %d requests, want 2: the paused account must not be tried", requests)
+	}
+	if q := g.Quota("news@example.com"); !q.Exhausted || q.Remaining != 0 || q.Used != 1 {
+		t.Errorf("Quota() after refusal = %+v", q)
+	}
+}
+
+func TestGmailQuotaError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "dailyLimitExceeded"}}}, true},
+		{&googleapi.Error{Code: 429, Message: "User-rate limit exceeded: Daily sending quota reached"}, true},
+		{&googleapi.Error{Code: 429, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, false},
+		{fmt.Errorf("unable to send message: %w", &textproto.Error{Code: 550, Msg: "5.4.5 Daily user sending limit exceeded."}), true},
+		{&textproto.Error{Code: 550, Msg: "5.1.1 The email account does not exist."}, false},
+		{errors.New("connection reset"), false},
+	}
+	for i, tt := range tests {
+		if got := gmailQuotaError(tt.err); got != tt.want {
+			t.Errorf("%d: gmailQuotaError(%v) = %v, want %v", i, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBuildGmailPayload(t *testing.T) {
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Bcc: []string{"c@example.com"}, Subject: "s", Body: "b"}
+	p, err := BuildGmailPayload(msg)
+	if err != nil {
+		t.Fatalf("BuildGmailPayload() error = %v", err)
+	}
+	if p.Method != "POST" || p.Path != "/gmail/v1/users/me/messages/send" || p.ContentType != "application/json" {
+		t.Errorf("payload = %s %s (%s)", p.Method, p.Path, p.ContentType)
+	}
+	var body struct{ Raw string }
+	if err := json.Unmarshal(p.Body, &body); err != nil {
+		t.Fatalf("invalid JSON %s: %v", p.Body, err)
+	}
+	raw, err := base64.URLEncoding.DecodeString(body.Raw)
+	if err != nil || !strings.Contains(string(raw), "Bcc: c@example.com\r\n") {
+		t.Errorf("raw message = %q, %v; want it to carry Bcc", raw, err)
+	}
+
+	msg.Attachments = []Attachment{{Filename: "big.bin", Content: make([]byte, gmailRawLimit)}}
+	if p, err := BuildGmailPayload(msg); err != nil {
+		t.Errorf("BuildGmailPayload() of a large message: %v", err)
+	} else if p.ContentType != "message/rfc822" || !strings.HasPrefix(p.Path, "/upload/") {
+		t.Errorf("BuildGmailPayload() of a large message = %s (%s), want an upload", p.Path, p.ContentType)
+	}
+
+	msg.Attachments = nil
+	msg.Labels = []string{"automated"}
+	if _, err := BuildGmailPayload(msg); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("BuildGmailPayload() with Labels: error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestGmailVerifySendAs(t *testing.T) {
+	var lists int
+	var raw string
+	provider := newTestGmail(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/settings/sendAs"):
+			lists++
+			io.WriteString(w, `{"sendAs":[
+				{"sendAsEmail":"me@example.com","isPrimary":true},
+				{"sendAsEmail":"Billing@example.com","displayName":"Billing Team","verificationStatus":"accepted"},
+				{"sendAsEmail":"new@example.org","verificationStatus":"pending"}]}`)
+		case strings.HasSuffix(r.URL.Path, "/messages/send"):
+			var m struct{ Raw string }
+			json.NewDecoder(r.Body).Decode(&m)
+			b, _ := base64.URLEncoding.DecodeString(m.Raw)
+			raw = string(b)
+			io.WriteString(w, `{"id":"m1"}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	g := provider.(*gmailProvider)
+	g.config.VerifySendAs = true
+
+	tests := []struct {
+		from     string
+		wantFrom string
+		status   string
+		wantErr  bool
+	}{
+		{from: "me@example.com", wantFrom: "From: me@example.com\r\n"},
+		{from: "billing@example.com", wantFrom: "From: Billing Team <billing@example.com>\r\n"},
+		{from: "Invoices <billing@example.com>", wantFrom: "From: Invoices <billing@example.com>\r\n"},
+		{from: "new@example.org", status: "pending", wantErr: true},
+		{from: "other@example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from, func(t *testing.T) {
+			raw = ""
+			msg := &Message{From: tt.from, To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+			err := g.Send(context.Background(), msg)
+			if tt.wantErr {
+				var sendAs *SendAsError
+				if !errors.As(err, &sendAs) || !errors.Is(err, ErrSendAsNotVerified) || sendAs.Status != tt.status {
+					t.Fatalf("Send() error = %v, want a *SendAsError with status %q", err, tt.status)
+				}
+				if raw != "" {
+					t.Error("message sent despite the error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			if !strings.Contains(raw, tt.wantFrom) {
+				t.Errorf("sent message lacks %q:\n%s", tt.wantFrom, raw)
+			}
+			if msg.From != tt.from {
+				t.Errorf("msg.From changed to %q", msg.From)
+			}
+		})
+	}
+	if lists != 1 {
+		t.Errorf("send-as settings read %d times, want 1", lists)
+	}
+}
+
+func TestGmailSentLabels(t *testing.T) {
+	var modified []string
+	var modifyFails bool
+	provider := newTestGmail(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/messages/send"):
+			io.WriteString(w, `{"id":"m1","threadId":"t1"}`)
+		case strings.HasSuffix(r.URL.Path, "/labels") && r.Method == http.MethodGet:
+			io.WriteString(w, `{"labels":[{"id":"Label_1","name":"automated"}]}`)
+		case strings.HasSuffix(r.URL.Path, "/labels"):
+			var l struct{ Name string }
+			json.NewDecoder(r.Body).Decode(&l)
+			if l.Name == "broken" {
+				w.WriteHeader(http.StatusForbidden)
+				io.WriteString(w, `{"error":{"code":403,"message":"denied"}}`)
+				return
+			}
+			fmt.Fprintf(w, `{"id":"Label_2","name":%q}`, l.Name)
+		case strings.HasSuffix(r.URL.Path, "/messages/m1/modify") && modifyFails:
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `{"error":{"code":500,"message":"backend error"}}`)
+		case strings.HasSuffix(r.URL.Path, "/messages/m1/modify"):
+			var req struct{ AddLabelIds []string }
+			json.NewDecoder(r.Body).Decode(&req)
+			modified = append(modified, strings.Join(req.AddLabelIds, ","))
+			io.WriteString(w, `{"id":"m1"}`)
+		case strings.HasSuffix(r.URL.Path, "/messages/m1"): // SendWithResult reads the Message-ID back
+			io.WriteString(w, `{"id":"m1"}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	g := provider.(*gmailProvider)
+	g.config.SentLabels = []string{"automated"}
+
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+		Labels: []string{"automated/invoices", "automated"}}
+	res, err := g.SendWithResult(context.Background(), msg)
+	if err != nil || res.ProviderID != "m1" {
+		t.Fatalf("SendWithResult() = %+v, %v", res, err)
+	}
+	if err := g.Send(context.Background(), &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(modified) != "[Label_1,Label_2 Label_1]" {
+		t.Errorf("labels applied = %v", modified)
+	}
+
+	msg.Labels = []string{"broken"}
+	if err := g.Send(context.Background(), msg); !errors.Is(err, ErrPartialSend) {
+		t.Errorf("Send() with an uncreatable label: error = %v, want ErrPartialSend", err)
+	}
+	modifyFails = true
+	msg.Labels = []string{"automated"}
+	var gerr *googleapi.Error
+	if err := g.Send(context.Background(), msg); !errors.Is(err, ErrPartialSend) || !errors.As(err, &gerr) || gerr.Code != 500 {
+		t.Errorf("Send() with a failed label request: error = %v, want ErrPartialSend wrapping the API error", err)
+	}
+
+	g.config.SMTPRelay = true
+	if err := g.Send(context.Background(), msg); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("relay Send() with Labels: error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestGmailAPIErrorHint(t *testing.T) {
+	provider := newTestGmail(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"error":{"code":403,"message":"Request had insufficient authentication scopes.","errors":[{"reason":"insufficientPermissions"}]}}`)
+	})
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+	_, err := provider.(*gmailProvider).SendWithResult(context.Background(), msg)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "insufficientPermissions" || apiErr.Provider != ProviderGmail {
+		t.Fatalf("SendWithResult() error = %v, want an *APIError for insufficientPermissions", err)
+	}
+	if !strings.Contains(ErrorHint(err), "GmailConfig.Scopes") {
+		t.Errorf("ErrorHint() = %q", ErrorHint(err))
+	}
+}
+
+// bearerTransport authorizes requests with a fixed token, like a client
+// from google.DefaultClient.
+type bearerTransport struct{ token string }
+
+func (b bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+b.token)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestGmailTokenSourceAndAuthClient(t *testing.T) {
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"m1"}`)
+	}))
+	defer srv.Close()
+
+	tokens := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "ts"})
+	tests := []struct {
+		name     string
+		config   GmailConfig
+		wantAuth string
+		wantErr  string
+	}{
+		{name: "token source", config: GmailConfig{TokenSource: tokens}, wantAuth: "Bearer ts"},
+		{name: "token source over HTTPClient", config: GmailConfig{TokenSource: tokens, HTTPClient: srv.Client()}, wantAuth: "Bearer ts"},
+		{name: "auth client", config: GmailConfig{AuthClient: &http.Client{Transport: bearerTransport{"own"}}}, wantAuth: "Bearer own"},
+		{name: "not a token source", config: GmailConfig{TokenSource: "tok"}, wantErr: "not an oauth2.TokenSource"},
+		{name: "token source and token", config: GmailConfig{TokenSource: tokens, TokenJSON: []byte(`{}`)}, wantErr: "cannot be combined"},
+		{name: "auth client and token source", config: GmailConfig{AuthClient: http.DefaultClient, TokenSource: tokens}, wantErr: "cannot be combined"},
+		{name: "auth client and relay", config: GmailConfig{AuthClient: http.DefaultClient, SMTPRelay: true}, wantErr: "SMTPRelay"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.BaseURL = srv.URL + "/"
+			provider, err := newGmailProvider(&config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("newGmailProvider() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newGmailProvider() error = %v", err)
+			}
+			msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+			if err := provider.Send(context.Background(), msg); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			if gotAuth != tt.wantAuth {
+				t.Errorf("Authorization = %q, want %q", gotAuth, tt.wantAuth)
+			}
+		})
+	}
+}
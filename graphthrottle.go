@@ -0,0 +1,183 @@
+// graphthrottle.go - Client-side pacing of Microsoft Graph requests.
+// Microsoft throttles per app and tenant (and per mailbox within it), not per
+// Client: several Clients for the same app in one process each see only their
+// own traffic and together overrun the limit, then all retry into the same
+// 429s. A GraphThrottle shared between them (OutlookConfig.Throttle, or
+// SharedGraphThrottle to look one up by tenant and app) caps their combined
+// concurrency and request rate, and when Graph answers 429 or 503 with
+// Retry-After, holds back every request through it, not just the retried one.
+package email
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default GraphThrottle limits: Exchange Online allows 4 concurrent requests
+// and 10,000 requests per 10 minutes per app and mailbox.
+const (
+	defaultGraphConcurrency = 4
+	defaultGraphPerMinute   = 1000
+	graphThrottleMaxPause   = 5 * time.Minute
+	graphThrottleMinWait    = time.Millisecond
+)
+
+// GraphThrottle paces the Graph requests of the Clients it is configured on.
+// The zero value uses the default limits. It is safe for concurrent use; do
+// not change its fields after first use.
+type GraphThrottle struct {
+	// MaxConcurrent caps the requests in flight. Defaults to 4.
+	MaxConcurrent int
+
+	// PerMinute caps the requests started per minute, in a steady stream
+	// rather than bursts. Defaults to 1000.
+	PerMinute int
+
+	once  sync.Once
+	slots chan struct{}
+
+	mu    sync.Mutex
+	next  time.Time // earliest start of the next request
+	until time.Time // no request starts before until (Retry-After)
+	now   func() time.Time
+}
+
+// graphThrottles is the registry behind SharedGraphThrottle.
+var graphThrottles = struct {
+	sync.Mutex
+	m map[string]*GraphThrottle
+}{m: make(map[string]*GraphThrottle)}
+
+// SharedGraphThrottle returns the process-wide GraphThrottle of the app
+// clientID in tenantID, creating one with the default limits on first use.
+// Set it as OutlookConfig.Throttle on every Client of that app and tenant.
+//
+// Example:
+//
+//	config.Outlook.Throttle = email.SharedGraphThrottle(tenantID, clientID)
+func SharedGraphThrottle(tenantID, clientID string) *GraphThrottle {
+	key := strings.ToLower(tenantID) + "/" + strings.ToLower(clientID)
+	graphThrottles.Lock()
+	defer graphThrottles.Unlock()
+	t := graphThrottles.m[key]
+	if t == nil {
+		t = &GraphThrottle{}
+		graphThrottles.m[key] = t
+	}
+	return t
+}
+
+// init applies the defaults on first use.
+func (t *GraphThrottle) init() {
+	t.once.Do(func() {
+		n := t.MaxConcurrent
+		if n <= 0 {
+			n = defaultGraphConcurrency
+		}
+		t.slots = make(chan struct{}, n)
+		if t.PerMinute <= 0 {
+			t.PerMinute = defaultGraphPerMinute
+		}
+		if t.now == nil {
+			t.now = time.Now
+		}
+	})
+}
+
+// acquire waits for a concurrency slot and its turn under the rate limit. The caller must
+// call the returned release when the request is done.
+func (t *GraphThrottle) acquire(ctx context.Context) (release func(), err error) {
+	t.init()
+	select {
+	case t.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release = func() { <-t.slots }
+	for {
+		wait := t.take()
+		if wait <= 0 {
+			return release, nil
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			release()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// take claims the next request start and returns 0 if it is due, or
+// returns how long to wait before trying again.
+func (t *GraphThrottle) take() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	if now.Before(t.until) {
+		return t.until.Sub(now)
+	}
+	if now.Before(t.next) {
+		return max(t.next.Sub(now), graphThrottleMinWait)
+	}
+	t.next = now.Add(time.Minute / time.Duration(t.PerMinute))
+	return 0
+}
+
+// pause holds back every request until d from now.
+func (t *GraphThrottle) pause(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until := t.now().Add(min(d, graphThrottleMaxPause)); until.After(t.until) {
+		t.until = until
+	}
+}
+
+// transport returns next wrapped to pace requests through t.
+func (t *GraphThrottle) transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &throttledTransport{throttle: t, next: next}
+}
+
+// throttledTransport paces requests through a GraphThrottle.
+type throttledTransport struct {
+	throttle *GraphThrottle
+	next     http.RoundTripper
+}
+
+func (tt *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := tt.throttle.acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	resp, err := tt.next.RoundTrip(req)
+	if err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if d, ok := retryAfter(resp.Header.Get("Retry-After"), tt.throttle.now()); ok {
+			tt.throttle.pause(d)
+		}
+	}
+	return resp, err
+}
+
+// retryAfter parses a Retry-After value, in seconds or as an HTTP date.
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(now), true
+	}
+	return 0, false
+}
@@ -0,0 +1,63 @@
+//go:build !email_no_outlook
+
+package email
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestGraphThrottleSharedBetweenClients checks that two Outlook clients
+// sharing a throttle keep to its concurrency limit together.
+func TestGraphThrottleSharedBetweenClients(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	throttle := &GraphThrottle{MaxConcurrent: 1}
+	endpoints, err := outlookCloudFor("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var providers []*outlookProvider
+	for i := 0; i < 2; i++ {
+		config := &OutlookConfig{UserID: "user@example.com", BaseURL: srv.URL + "/v1.0", HTTPClient: srv.Client(), Throttle: throttle}
+		client, err := newGraphClient(staticToken{}, endpoints, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		providers = append(providers, &outlookProvider{client: client, config: config})
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 6)
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(o *outlookProvider) {
+			defer wg.Done()
+			errs <- o.Send(context.Background(), &Message{From: "user@example.com", To: []string{"a@example.com"}, Subject: "s", Body: "b"})
+		}(providers[i%2])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Send() error = %v", err)
+		}
+	}
+	if p := peak.Load(); p != 1 {
+		t.Errorf("peak concurrent requests = %d, want 1", p)
+	}
+}
@@ -0,0 +1,119 @@
+package email
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGraphThrottleRate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	th := &GraphThrottle{PerMinute: 60, now: func() time.Time { return now }}
+	th.init()
+
+	if d := th.take(); d != 0 {
+		t.Fatalf("first take() = %v, want 0", d)
+	}
+	if d := th.take(); d != time.Second {
+		t.Errorf("second take() = %v, want 1s", d)
+	}
+	now = now.Add(time.Second)
+	if d := th.take(); d != 0 {
+		t.Errorf("take() after 1s = %v, want 0", d)
+	}
+
+	now = now.Add(time.Hour) // idle time does not build up a burst
+	th.take()
+	if d := th.take(); d <= 0 {
+		t.Errorf("take() after idle burst = %v, want a wait", d)
+	}
+
+	now = now.Add(time.Hour)
+	th.pause(30 * time.Second)
+	th.pause(10 * time.Second) // a shorter pause does not cut the longer one
+	if d := th.take(); d != 30*time.Second {
+		t.Errorf("take() while paused = %v, want 30s", d)
+	}
+	th.pause(time.Hour)
+	if d := th.take(); d != graphThrottleMaxPause {
+		t.Errorf("take() after long Retry-After = %v, want %v", d, graphThrottleMaxPause)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"7", 7 * time.Second, true},
+		{" 0 ", 0, true},
+		{"Thu, 01 Jan 2026 12:00:30 GMT", 30 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSharedGraphThrottle(t *testing.T) {
+	a := SharedGraphThrottle("Tenant", "App")
+	if b := SharedGraphThrottle("tenant", "app"); b != a {
+		t.Error("same tenant and app got different throttles")
+	}
+	if c := SharedGraphThrottle("tenant", "other"); c == a {
+		t.Error("different apps share a throttle")
+	}
+}
+
+// TestGraphThrottleRetryAfter checks that a 429 seen through one transport
+// holds back requests through another sharing the throttle.
+func TestGraphThrottleRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	throttle := &GraphThrottle{}
+	a := &http.Client{Transport: throttle.transport(srv.Client().Transport)}
+	b := &http.Client{Transport: throttle.transport(srv.Client().Transport)}
+	resp, err := a.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("first status = %d", resp.StatusCode)
+	}
+
+	start := time.Now()
+	resp, err = b.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("second client went ahead after %v, within Retry-After", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	throttle.pause(time.Minute)
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := b.Do(req); err == nil {
+		t.Error("request with cancelled context went through a paused throttle")
+	}
+}
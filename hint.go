@@ -0,0 +1,138 @@
+// hint.go - Actionable hints for errors. A provider's refusal usually says
+// what went wrong in its own terms ("ErrorAccessDenied", "invalid_grant")
+// but not what to do about it, which is what the person reading the log
+// needs. Errors that know implement Hinter; ErrorHint finds the hint
+// anywhere in an error's chain, so a CLI or an alert can print it next to
+// the error.
+package email
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Hinter is implemented by errors that can suggest how to fix their cause.
+type Hinter interface {
+	// Hint returns a short, actionable suggestion, "" if there is none.
+	Hint() string
+}
+
+// ErrorHint returns the hint of the first error in err's chain that has
+// one, "" if none does.
+//
+// Example:
+//
+//	if err := client.Send(msg); err != nil {
+//	    if hint := email.ErrorHint(err); hint != "" {
+//	        log.Printf("send failed: %v (hint: %s)", err, hint)
+//	    }
+//	}
+func ErrorHint(err error) string {
+	for err != nil {
+		if h, ok := err.(Hinter); ok {
+			if hint := h.Hint(); hint != "" {
+				return hint
+			}
+		}
+		switch u := err.(type) {
+		case interface{ Unwrap() error }:
+			err = u.Unwrap()
+		case interface{ Unwrap() []error }:
+			for _, e := range u.Unwrap() {
+				if hint := ErrorHint(e); hint != "" {
+					return hint
+				}
+			}
+			return ""
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// APIError is a provider API's refusal of a send, with the provider's
+// error code. Its message is that of the error it wraps, which can still
+// be matched with errors.As, e.g. as a Graph *odataerrors.ODataError or a
+// *googleapi.Error.
+type APIError struct {
+	// Provider is the name of the refusing provider, e.g. "outlook365".
+	Provider string
+
+	// StatusCode is the HTTP status of the response; 0 when the request
+	// got none, e.g. when no access token could be obtained for it.
+	StatusCode int
+
+	// Code is the provider's error code: the Graph error code (e.g.
+	// "ErrorAccessDenied"), the Gmail error reason (e.g.
+	// "insufficientPermissions") or the OAuth2 error (e.g. "invalid_grant").
+	Code string
+
+	// Err is the provider's error.
+	Err error
+}
+
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the provider's error.
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Hint suggests a fix for the provider's error code, or failing that for
+// the response's status.
+func (e *APIError) Hint() string {
+	if hint := apiErrorHints[e.Provider][e.Code]; hint != "" {
+		return hint
+	}
+	return statusHints[e.StatusCode]
+}
+
+// apiErrorHints maps provider names and error codes to hints.
+var apiErrorHints = map[string]map[string]string{
+	ProviderOutlook365: {
+		"ErrorAccessDenied":           "grant the app the Mail.Send application permission in Azure AD and admin-consent it; an application access policy may also exclude the From mailbox",
+		"ErrorSendAsDenied":           "give the app's identity Send As permission on the From mailbox, or send from a mailbox it may send as",
+		"ErrorInvalidUser":            "the From address is not a mailbox in the tenant; check it, and that it is in the tenant set by TenantID",
+		"MailboxNotEnabledForRESTAPI": "the From mailbox is not hosted in Exchange Online or has no Exchange Online license",
+		"ResourceNotFound":            "the From mailbox does not exist in the tenant; check the address and TenantID",
+		"InvalidAuthenticationToken":  "the access token was rejected; check that TenantID and ClientID belong to the same app registration",
+		"ErrorMessageSizeExceeded":    "the message exceeds the mailbox's size limit; shrink the attachments or send links to them",
+		"ErrorQuotaExceeded":          "the From mailbox is full; free space in it, or stop saving copies to Sent Items (SaveToSent)",
+		"ErrorExceededMessageLimit":   "the mailbox hit Exchange Online's sending limit (10,000 recipients a day); spread the sends over time or several mailboxes",
+		"ApplicationThrottled":        "Graph is throttling the app; share one OutlookConfig.Throttle between all clients of the app and send less often",
+		"AuthenticationFailed":        "Azure AD rejected the app's credentials; check TenantID, ClientID and ClientSecret, and that the secret has not expired",
+		"invalid_grant":               "the refresh token expired or was revoked; sign the user in again (OutlookAuthHelper)",
+		"invalid_client":              "Azure AD rejected the app; check ClientID, and that the app registration allows public client flows",
+	},
+	ProviderGmail: {
+		"insufficientPermissions": "the token lacks a scope this needs; add it to GmailConfig.Scopes and run the consent flow again to replace the token",
+		"accessNotConfigured":     "enable the Gmail API in the Google Cloud project the credentials belong to",
+		"dailyLimitExceeded":      "the account reached Gmail's daily sending limit; defer sends until the quota resets",
+		"quotaExceeded":           "the account reached Gmail's daily sending limit; defer sends until the quota resets",
+		"userRateLimitExceeded":   "the account sends too fast for the Gmail API; back off and spread the sends out",
+		"rateLimitExceeded":       "the project calls the Gmail API too fast; back off and spread the sends out",
+		"failedPrecondition":      "the account cannot use the Gmail API, e.g. Gmail is disabled for it in the Workspace admin console",
+		"invalid_grant":           "the token expired or was revoked (tokens of apps in testing expire after 7 days); run the consent flow again (GmailAuthHelper)",
+		"invalid_client":          "Google rejected the OAuth client; check that CredentialsJSON is the current client of the project",
+	},
+}
+
+// statusHints maps HTTP statuses to hints, for error codes without one.
+var statusHints = map[int]string{
+	http.StatusUnauthorized:    "the provider rejected the credentials; check them and renew any expired secret or token",
+	http.StatusForbidden:       "the credentials lack a permission or scope this needs; check what the app was granted",
+	http.StatusTooManyRequests: "the provider is rate limiting; retry later and send less often",
+}
+
+// apiError returns err wrapped in an *APIError for provider, unless err
+// already carries a hint.
+func apiError(provider string, status int, code string, err error) error {
+	var h Hinter
+	if errors.As(err, &h) {
+		return err
+	}
+	return &APIError{Provider: provider, StatusCode: status, Code: code, Err: err}
+}
@@ -0,0 +1,57 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorHint(t *testing.T) {
+	graphErr := errors.New("graph: access denied")
+	quota := &QuotaExceededError{User: "a@example.com", ResetAt: time.Date(2026, 1, 2, 8, 0, 0, 0, time.UTC), Err: graphErr}
+	tests := []struct {
+		name string
+		err  error
+		want string // substring of the hint; "" for none
+	}{
+		{name: "nil", err: nil},
+		{name: "plain", err: errors.New("boom")},
+		{name: "code", err: &APIError{Provider: ProviderOutlook365, StatusCode: 403, Code: "ErrorAccessDenied", Err: graphErr}, want: "Mail.Send application permission"},
+		{name: "unknown code falls back to status", err: &APIError{Provider: ProviderGmail, StatusCode: 401, Code: "nope", Err: graphErr}, want: "rejected the credentials"},
+		{name: "nothing known", err: &APIError{Provider: ProviderGmail, StatusCode: 500, Err: graphErr}},
+		{name: "wrapped", err: fmt.Errorf("send: %w", &APIError{Provider: ProviderGmail, Code: "invalid_grant", Err: graphErr}), want: "consent flow"},
+		{name: "joined", err: errors.Join(errors.New("a"), &MessageTooLargeError{Limit: 100}), want: "below 100 bytes"},
+		{name: "outermost wins", err: &QuotaExceededError{User: "a@example.com", Err: &APIError{Provider: ProviderGmail, Code: "dailyLimitExceeded", Err: graphErr}}, want: "defer sends from a@example.com"},
+		{name: "typed", err: quota, want: "2026-01-02T08:00:00Z"},
+		{name: "send as", err: &SendAsError{Address: "x@example.com", Status: "pending"}, want: "verification of x@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ErrorHint(tt.err)
+			if tt.want == "" {
+				if got != "" {
+					t.Errorf("ErrorHint() = %q, want none", got)
+				}
+				return
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("ErrorHint() = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIErrorKeepsProviderError(t *testing.T) {
+	inner := fmt.Errorf("failed to send email: %w", ErrNotFound)
+	err := apiError(ProviderOutlook365, http.StatusNotFound, "ResourceNotFound", inner)
+	if err.Error() != inner.Error() || !errors.Is(err, ErrNotFound) {
+		t.Errorf("apiError() = %v, want the provider's error", err)
+	}
+	hinted := &SendAsError{Address: "x@example.com"}
+	if got := apiError(ProviderGmail, 403, "insufficientPermissions", hinted); got != hinted {
+		t.Errorf("apiError() of a hinted error = %v, want it unchanged", got)
+	}
+}
@@ -0,0 +1,224 @@
+// htmlsanitize.go - Allowlist sanitizing of HTML bodies, for services that
+// put user-generated content (comments, profile fields, support replies)
+// into email. Mail clients ignore scripts, but webmail runs in a browser and
+// not every client is careful, so anything not on the allowlist goes:
+// scripts, iframes, forms, event handlers, javascript: links and CSS that
+// executes code. The default allowlist covers the markup email layouts use
+// (tables, fonts, inline styles, images).
+package email
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLPolicy is an allowlist for SanitizeHTML. The zero value is the
+// default email-safe policy; the fields extend it.
+type HTMLPolicy struct {
+	// AllowElements adds element names to the default allowlist. Elements
+	// not allowed are removed but their content is kept, except for
+	// scripts, styles, embedded content and forms, which are removed
+	// entirely unless allowed here.
+	AllowElements []string
+
+	// AllowAttributes adds attribute names allowed on every element. Event
+	// handlers ("on...") are never allowed.
+	AllowAttributes []string
+
+	// AllowURLSchemes adds URL schemes allowed in href and src attributes
+	// to http, https, mailto, tel and cid. Relative URLs are allowed.
+	AllowURLSchemes []string
+
+	// AllowDataImages allows data:image/... URLs in img src attributes.
+	AllowDataImages bool
+}
+
+// Default allowlists of HTMLPolicy.
+var (
+	defaultHTMLElements = []string{
+		"a", "abbr", "address", "b", "big", "blockquote", "br", "caption", "center", "cite", "code",
+		"col", "colgroup", "dd", "del", "div", "dl", "dt", "em", "font", "h1", "h2", "h3", "h4",
+		"h5", "h6", "hr", "i", "img", "ins", "kbd", "li", "mark", "ol", "p", "pre", "q", "s",
+		"small", "span", "strike", "strong", "sub", "sup", "table", "tbody", "td", "tfoot", "th",
+		"thead", "tr", "tt", "u", "ul",
+	}
+	defaultHTMLAttributes = []string{
+		"align", "alt", "bgcolor", "border", "cellpadding", "cellspacing", "class", "color",
+		"colspan", "dir", "face", "height", "href", "lang", "rowspan", "size", "src", "style",
+		"target", "title", "valign", "width",
+	}
+	defaultURLSchemes = []string{"http", "https", "mailto", "tel", "cid"}
+
+	// droppedHTMLElements are removed with their content when not allowed:
+	// their content is code, or meaningless outside them.
+	droppedHTMLElements = []string{
+		"script", "style", "iframe", "frame", "frameset", "object", "embed", "applet", "template",
+		"noscript", "svg", "math", "form", "input", "button", "select", "textarea", "title",
+		"head", "meta", "link", "base",
+	}
+
+	// unsafeCSS are fragments of CSS that can run code or load resources in
+	// some client; a style attribute containing one is dropped.
+	unsafeCSS = []string{"expression", "javascript:", "vbscript:", "behavior", "-moz-binding", "@import", "\\"}
+)
+
+// htmlSanitizer is a compiled HTMLPolicy.
+type htmlSanitizer struct {
+	elements, dropped, attrs, schemes map[string]bool
+	dataImages                        bool
+}
+
+func stringSet(lists ...[]string) map[string]bool {
+	m := make(map[string]bool)
+	for _, l := range lists {
+		for _, s := range l {
+			m[strings.ToLower(s)] = true
+		}
+	}
+	return m
+}
+
+// compile builds the sanitizer for p; nil means the defaults.
+func (p *HTMLPolicy) compile() *htmlSanitizer {
+	if p == nil {
+		p = &HTMLPolicy{}
+	}
+	s := &htmlSanitizer{
+		elements:   stringSet(defaultHTMLElements, p.AllowElements),
+		dropped:    stringSet(droppedHTMLElements),
+		attrs:      stringSet(defaultHTMLAttributes, p.AllowAttributes),
+		schemes:    stringSet(defaultURLSchemes, p.AllowURLSchemes),
+		dataImages: p.AllowDataImages,
+	}
+	for name := range s.elements {
+		delete(s.dropped, name)
+	}
+	return s
+}
+
+// SanitizeHTML returns s with every element, attribute and URL not allowed
+// by policy removed; a nil policy is the default one. The result is an HTML
+// fragment: a document's html, head and body wrappers are not kept.
+//
+// Example:
+//
+//	body := "<p>New comment:</p>" + email.SanitizeHTML(comment, nil)
+func SanitizeHTML(s string, policy *HTMLPolicy) string {
+	return policy.compile().sanitize(s)
+}
+
+func (z *htmlSanitizer) sanitize(s string) string {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(s), body)
+	if err != nil {
+		// ParseFragment only fails on reader errors.
+		return html.EscapeString(s)
+	}
+	var b strings.Builder
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+	z.clean(body)
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		html.Render(&b, c)
+	}
+	return b.String()
+}
+
+// clean sanitizes n's children in place.
+func (z *htmlSanitizer) clean(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch c.Type {
+		case html.TextNode:
+		case html.ElementNode:
+			name := strings.ToLower(c.Data)
+			switch {
+			case z.elements[name]:
+				c.Attr = z.cleanAttrs(name, c.Attr)
+				z.clean(c)
+			case z.dropped[name]:
+				n.RemoveChild(c)
+			default:
+				// Unwrap: keep the content, cleaned, in place of c.
+				z.clean(c)
+				for gc := c.FirstChild; gc != nil; gc = c.FirstChild {
+					c.RemoveChild(gc)
+					n.InsertBefore(gc, c)
+				}
+				n.RemoveChild(c)
+			}
+		default:
+			n.RemoveChild(c) // comments (including conditional ones), doctypes
+		}
+		c = next
+	}
+}
+
+// cleanAttrs returns the allowed attributes of an element.
+func (z *htmlSanitizer) cleanAttrs(element string, attrs []html.Attribute) []html.Attribute {
+	out := attrs[:0]
+	for _, a := range attrs {
+		key := strings.ToLower(a.Key)
+		if a.Namespace != "" || !z.attrs[key] || strings.HasPrefix(key, "on") {
+			continue
+		}
+		switch key {
+		case "href", "src":
+			if !z.allowedURL(element, a.Val) {
+				continue
+			}
+		case "style":
+			if !safeCSS(a.Val) {
+				continue
+			}
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// allowedURL reports whether u may appear in an href or src of element.
+func (z *htmlSanitizer) allowedURL(element, u string) bool {
+	// Browsers ignore whitespace and control characters in schemes
+	// ("java\tscript:"); so must the check.
+	u = strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, u)
+	scheme, _, ok := strings.Cut(u, ":")
+	if !ok || strings.ContainsAny(scheme, "/?#") {
+		return true // relative
+	}
+	scheme = strings.ToLower(scheme)
+	if scheme == "data" {
+		return z.dataImages && element == "img" && strings.HasPrefix(strings.ToLower(u), "data:image/")
+	}
+	return z.schemes[scheme]
+}
+
+// safeCSS reports whether an inline style is free of code and of url()s
+// other than http(s) and cid ones.
+func safeCSS(style string) bool {
+	s := strings.ToLower(style)
+	for _, bad := range unsafeCSS {
+		if strings.Contains(s, bad) {
+			return false
+		}
+	}
+	for rest := s; ; {
+		i := strings.Index(rest, "url(")
+		if i < 0 {
+			return true
+		}
+		rest = rest[i+4:]
+		target := strings.TrimLeft(rest, " \t\n\"'")
+		if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") && !strings.HasPrefix(target, "cid:") {
+			return false
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package email
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		policy *HTMLPolicy
+		want   string
+	}{
+		{"formatting kept", `<p align="center"><b>Hi</b> <font color="red">there</font></p>`, nil,
+			`<p align="center"><b>Hi</b> <font color="red">there</font></p>`},
+		{"script removed", `<p>a</p><script>alert(1)</script><p>b</p>`, nil, `<p>a</p><p>b</p>`},
+		{"iframe and form removed", `<iframe src="https://x"></iframe><form><input name="pw"></form>ok`, nil, `ok`},
+		{"event handler dropped", `<img src="https://x/a.png" onerror="alert(1)" alt="a">`, nil, `<img src="https://x/a.png" alt="a"/>`},
+		{"javascript link", `<a href="javascript:alert(1)">x</a>`, nil, `<a>x</a>`},
+		{"obfuscated scheme", `<a href="java&#x09;script:alert(1)">x</a>`, nil, `<a>x</a>`},
+		{"safe links", `<a href="https://example.com/?a=1&amp;b=2">x</a><a href="mailto:a@example.com">m</a><a href="/rel">r</a>`, nil,
+			`<a href="https://example.com/?a=1&amp;b=2">x</a><a href="mailto:a@example.com">m</a><a href="/rel">r</a>`},
+		{"unknown element unwrapped", `<custom-tag><b>kept</b></custom-tag>`, nil, `<b>kept</b>`},
+		{"comment removed", `a<!--[if mso]><x><![endif]-->b`, nil, `ab`},
+		{"unsafe style", `<div style="width: expression(alert(1))">x</div>`, nil, `<div>x</div>`},
+		{"style url", `<td style="background: url('javascript:x')">x</td>`, nil, `x`},
+		{"safe style", `<span style="color: #333; background: url(https://cdn.example.com/bg.png)">x</span>`, nil,
+			`<span style="color: #333; background: url(https://cdn.example.com/bg.png)">x</span>`},
+		{"document wrappers", `<html><head><title>t</title><style>p{}</style></head><body><p>x</p></body></html>`, nil, `<p>x</p>`},
+		{"data image off", `<img src="data:image/png;base64,AAAA">`, nil, `<img/>`},
+		{"data image on", `<img src="data:image/png;base64,AAAA">`, &HTMLPolicy{AllowDataImages: true}, `<img src="data:image/png;base64,AAAA"/>`},
+		{"extra element", `<details><summary>s</summary>d</details>`, &HTMLPolicy{AllowElements: []string{"details", "summary"}},
+			`<details><summary>s</summary>d</details>`},
+		{"extra attribute", `<td nowrap data-id="7">x</td>`, &HTMLPolicy{AllowAttributes: []string{"data-id"}}, `x`},
+		{"text escaped", `1 &lt; 2 &amp; <b>3</b>`, nil, `1 &lt; 2 &amp; <b>3</b>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeHTML(tt.in, tt.policy); got != tt.want {
+				t.Errorf("SanitizeHTML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientSendSanitizesHTML(t *testing.T) {
+	mock := &mockProvider{}
+	c := &Client{provider: mock, sanitizer: (&HTMLPolicy{}).compile()}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s",
+		Body: `<p onclick="x()">hi</p><script>x()</script>`, HTML: true}
+	if err := c.SendWithContext(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if got := mock.calls[0].Body; got != "<p>hi</p>" {
+		t.Errorf("sent body = %q", got)
+	}
+	if msg.Body == "<p>hi</p>" {
+		t.Error("caller's message was modified")
+	}
+
+	text := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "<script> is fine in text"}
+	if err := c.SendWithContext(context.Background(), text); err != nil {
+		t.Fatal(err)
+	}
+	if got := mock.calls[1].Body; got != text.Body {
+		t.Errorf("plain-text body changed: %q", got)
+	}
+}
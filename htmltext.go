@@ -0,0 +1,295 @@
+// htmltext.go - Plain text from inbound HTML mail. HTMLToText renders a body
+// with a real HTML parser rather than regular expressions: scripts, styles,
+// comments and hidden elements are dropped, entities are decoded and block
+// structure becomes line breaks. It can also cut quoted history and
+// signatures, leaving bots with just the new content of a reply.
+package email
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// TextOptions configures HTMLToText, PlainText and FullMessage.Text.
+type TextOptions struct {
+	// StripQuoted removes quoted history: blockquotes and the Gmail,
+	// Outlook and Thunderbird reply containers in HTML, and in text what
+	// ParseReply reports as Quoted.
+	StripQuoted bool
+
+	// StripSignature removes the signature: the Gmail, Outlook and
+	// Thunderbird signature containers in HTML, and in text what ParseReply
+	// reports as Signature.
+	StripSignature bool
+}
+
+// Text returns the message's body as plain text: BodyText if present,
+// otherwise BodyHTML converted with HTMLToText.
+//
+// Example:
+//
+//	full, err := client.Read(id)
+//	...
+//	cmd := full.Text(email.TextOptions{StripQuoted: true, StripSignature: true})
+func (m *FullMessage) Text(opts TextOptions) string {
+	if strings.TrimSpace(m.BodyText) != "" {
+		return PlainText(m.BodyText, opts)
+	}
+	return HTMLToText(m.BodyHTML, opts)
+}
+
+// HTMLToText converts an HTML body to plain text. Links keep their target
+// in angle brackets after the link text and images are replaced by their alt
+// text.
+func HTMLToText(s string, opts TextOptions) string {
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		// html.Parse only fails on reader errors.
+		return PlainText(s, opts)
+	}
+	r := &htmlTextRenderer{opts: opts}
+	r.render(doc)
+	return PlainText(r.b.String(), opts)
+}
+
+// PlainText normalizes a plain-text body: line endings and trailing spaces
+// are cleaned up, runs of blank lines collapsed, and quoted history and the
+// signature removed as opts asks, as classified by ParseReply.
+func PlainText(s string, opts TextOptions) string {
+	lines, kinds := classifyReply(s)
+	out := make([]string, 0, len(lines))
+	for i, line := range lines {
+		if opts.StripQuoted && kinds[i] == replyQuoted || opts.StripSignature && kinds[i] == replySignature {
+			continue
+		}
+		line = strings.TrimRight(line, " \t\u00a0")
+		if line == "" && (len(out) == 0 || out[len(out)-1] == "") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// htmlTextRenderer accumulates the text of an HTML tree.
+type htmlTextRenderer struct {
+	opts TextOptions
+	b    strings.Builder
+	pre  int  // depth of <pre> elements
+	stop bool // the rest of the document is quoted history
+	list []int
+}
+
+// Classes and ids of the containers mail clients wrap quotes and signatures
+// in.
+var (
+	htmlQuoteMarkers = []string{"gmail_quote", "gmail_attr", "moz-cite-prefix", "yahoo_quoted", "divRplyFwdMsg", "appendonsend"}
+	htmlSigMarkers   = []string{"gmail_signature", "moz-signature", "Signature"}
+)
+
+func (r *htmlTextRenderer) render(n *html.Node) {
+	if r.stop {
+		return
+	}
+	switch n.Type {
+	case html.TextNode:
+		r.text(n.Data)
+		return
+	case html.ElementNode:
+	case html.DocumentNode:
+		r.children(n)
+		return
+	default:
+		return // comments, doctypes
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Head, atom.Title, atom.Template, atom.Noscript,
+		atom.Iframe, atom.Object, atom.Svg, atom.Math:
+		return
+	}
+	if hiddenElement(n) {
+		return
+	}
+	if r.opts.StripSignature && hasMarker(n, htmlSigMarkers) {
+		return
+	}
+	if r.opts.StripQuoted {
+		if n.DataAtom == atom.Blockquote {
+			return
+		}
+		if hasMarker(n, htmlQuoteMarkers) {
+			// Outlook and Gmail put the quoted message after the marker,
+			// not inside it.
+			r.stop = true
+			return
+		}
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		r.b.WriteString("\n")
+	case atom.Hr:
+		r.block()
+		r.b.WriteString("---")
+		r.block()
+	case atom.Img:
+		if alt := attr(n, "alt"); alt != "" {
+			r.text(alt)
+		}
+	case atom.Pre:
+		r.paragraph()
+		r.pre++
+		r.children(n)
+		r.pre--
+		r.paragraph()
+	case atom.P, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Blockquote, atom.Table:
+		r.paragraph()
+		r.children(n)
+		r.paragraph()
+	case atom.Ul, atom.Ol:
+		r.block()
+		r.list = append(r.list, 0)
+		r.children(n)
+		r.list = r.list[:len(r.list)-1]
+		r.block()
+	case atom.Li:
+		r.block()
+		marker := "- "
+		if d := len(r.list); d > 0 {
+			r.b.WriteString(strings.Repeat("  ", d-1))
+			if n.Parent != nil && n.Parent.DataAtom == atom.Ol {
+				r.list[d-1]++
+				marker = strconv.Itoa(r.list[d-1]) + ". "
+			}
+		}
+		r.b.WriteString(marker)
+		r.children(n)
+		r.block()
+	case atom.Td, atom.Th:
+		r.children(n)
+		r.b.WriteString("\t")
+	case atom.A:
+		start := r.b.Len()
+		r.children(n)
+		href := attr(n, "href")
+		label := strings.TrimSpace(r.b.String()[start:])
+		if linkTarget(href) && label != href && label != strings.TrimPrefix(href, "mailto:") {
+			r.b.WriteString(" <" + href + ">")
+		}
+	case atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Tr,
+		atom.Dl, atom.Dt, atom.Dd, atom.Address, atom.Center, atom.Form, atom.Fieldset:
+		r.block()
+		r.children(n)
+		r.block()
+	default:
+		r.children(n)
+	}
+}
+
+func (r *htmlTextRenderer) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.render(c)
+	}
+}
+
+// text writes a text node, collapsing whitespace outside <pre>.
+func (r *htmlTextRenderer) text(s string) {
+	s = strings.ReplaceAll(s, "\u00a0", " ")
+	if r.pre > 0 {
+		r.b.WriteString(s)
+		return
+	}
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		if s != "" && !r.atSpace() {
+			r.b.WriteString(" ")
+		}
+		return
+	}
+	if s[0] == ' ' || s[0] == '\t' || s[0] == '\n' || s[0] == '\r' {
+		if !r.atSpace() {
+			r.b.WriteString(" ")
+		}
+	}
+	r.b.WriteString(strings.Join(fields, " "))
+	if last := s[len(s)-1]; last == ' ' || last == '\t' || last == '\n' || last == '\r' {
+		r.b.WriteString(" ")
+	}
+}
+
+// atSpace reports whether the output ends in whitespace (or is empty).
+func (r *htmlTextRenderer) atSpace() bool {
+	s := r.b.String()
+	return s == "" || strings.ContainsAny(s[len(s)-1:], " \t\n")
+}
+
+// block ends the current line, if any.
+func (r *htmlTextRenderer) block() {
+	s := r.b.String()
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		r.b.WriteString("\n")
+	}
+}
+
+// paragraph ends the current line and leaves a blank line.
+func (r *htmlTextRenderer) paragraph() {
+	r.block()
+	if s := r.b.String(); s != "" && !strings.HasSuffix(s, "\n\n") {
+		r.b.WriteString("\n")
+	}
+}
+
+// attr returns the value of n's attribute key.
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasMarker reports whether n's id or one of its classes is in markers.
+func hasMarker(n *html.Node, markers []string) bool {
+	id := attr(n, "id")
+	classes := strings.Fields(attr(n, "class"))
+	for _, m := range markers {
+		if id == m {
+			return true
+		}
+		for _, c := range classes {
+			if c == m {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hiddenElement reports whether n is not rendered: the hidden attribute or
+// an inline display:none, common for preheader text and tracking markup.
+func hiddenElement(n *html.Node) bool {
+	for _, a := range n.Attr {
+		if a.Key == "hidden" {
+			return true
+		}
+	}
+	style := strings.ToLower(strings.Join(strings.Fields(attr(n, "style")), ""))
+	return strings.Contains(style, "display:none")
+}
+
+// linkTarget reports whether href is worth showing next to its text.
+func linkTarget(href string) bool {
+	h := strings.ToLower(href)
+	return strings.HasPrefix(h, "http://") || strings.HasPrefix(h, "https://") || strings.HasPrefix(h, "mailto:")
+}
+
+// extractHTMLText is the text/html TextExtractor.
+func extractHTMLText(_ context.Context, content []byte) (string, error) {
+	return HTMLToText(string(content), TextOptions{}), nil
+}
@@ -0,0 +1,106 @@
+package email
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		opts TextOptions
+		want string
+	}{
+		{
+			name: "blocks and entities",
+			html: "<html><head><title>t</title><style>p{}</style></head><body>" +
+				"<p>Hello&nbsp;<b>Bob</b>,</p><p>Fish &amp; chips\n   at 5?</p>line<br>break</body></html>",
+			want: "Hello Bob,\n\nFish & chips at 5?\n\nline\nbreak",
+		},
+		{
+			name: "scripts comments and hidden",
+			html: `<div style="display: none">preheader</div><script>alert(1)</script><!-- c --><p hidden>x</p>Visible`,
+			want: "Visible",
+		},
+		{
+			name: "lists links and images",
+			html: `<ul><li>one</li><li>two</li></ul><ol><li>a</li><li>b</li></ol>` +
+				`<a href="https://example.com/x">docs</a> <a href="mailto:a@example.com">a@example.com</a> <img alt="[logo]" src="x.png">`,
+			want: "- one\n- two\n1. a\n2. b\ndocs <https://example.com/x> a@example.com [logo]",
+		},
+		{
+			name: "pre keeps whitespace",
+			html: "<p>code:</p><pre>a  b\n  c</pre>",
+			want: "code:\n\na  b\n  c",
+		},
+		{
+			name: "gmail reply",
+			html: `<div dir="ltr">Approved.<div><br></div><div class="gmail_signature">Bob<br>CFO</div></div><br>` +
+				`<div class="gmail_quote"><div class="gmail_attr">On Mon, Alice wrote:<br></div>` +
+				`<blockquote class="gmail_quote">Can you approve?</blockquote></div>`,
+			opts: TextOptions{StripQuoted: true, StripSignature: true},
+			want: "Approved.",
+		},
+		{
+			name: "gmail reply kept",
+			html: `<div dir="ltr">Approved.</div><div class="gmail_quote"><blockquote>Can you approve?</blockquote></div>`,
+			want: "Approved.\n\nCan you approve?",
+		},
+		{
+			name: "outlook reply",
+			html: `<div>Yes, ship it.</div><div id="Signature">Carol</div><div id="appendonsend"></div><hr>` +
+				`<div id="divRplyFwdMsg"><b>From:</b> Dave</div><div>Ship it?</div>`,
+			opts: TextOptions{StripQuoted: true, StripSignature: true},
+			want: "Yes, ship it.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTMLToText(tt.html, tt.opts); got != tt.want {
+				t.Errorf("HTMLToText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		opts TextOptions
+		want string
+	}{
+		{"normalize", "a  \r\n\r\n\r\n\r\nb\t\r\n", TextOptions{}, "a\n\nb"},
+		{"kept", "Sure.\n\nOn Mon, 1 Jan 2024, Alice wrote:\n> ok?\n-- \nBob", TextOptions{}, "Sure.\n\nOn Mon, 1 Jan 2024, Alice wrote:\n> ok?\n--\nBob"},
+		{"attribution", "Sure.\n\nOn Mon, 1 Jan 2024, Alice wrote:\n> ok?", TextOptions{StripQuoted: true}, "Sure."},
+		{"wrapped attribution", "Sure.\nOn Mon, 1 Jan 2024 at 10:00, Alice\n<a@example.com> wrote:\n\n> ok?", TextOptions{StripQuoted: true}, "Sure."},
+		{"inline quotes", "> q1\nanswer 1\n> q2\nanswer 2", TextOptions{StripQuoted: true}, "answer 1\nanswer 2"},
+		{"outlook header", "Done.\n\nFrom: Alice <a@example.com>\nSent: Monday\nSubject: x\n\nold", TextOptions{StripQuoted: true}, "Done."},
+		{"original message", "Done.\n-----Original Message-----\nold", TextOptions{StripQuoted: true}, "Done."},
+		{"outlook separator", "Done.\n________________________________\nFrom: x", TextOptions{StripQuoted: true}, "Done."},
+		{"signature", "Thanks!\n-- \nBob\nACME", TextOptions{StripSignature: true}, "Thanks!"},
+		{"dashes in text", "a -- b\n---\nc", TextOptions{StripSignature: true}, "a -- b\n---\nc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PlainText(tt.text, tt.opts); got != tt.want {
+				t.Errorf("PlainText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFullMessageText(t *testing.T) {
+	opts := TextOptions{StripQuoted: true}
+	if got := (&FullMessage{BodyText: "plain\n> q", BodyHTML: "<p>html</p>"}).Text(opts); got != "plain" {
+		t.Errorf("Text() with BodyText = %q", got)
+	}
+	if got := (&FullMessage{BodyHTML: "<p>html</p><blockquote>q</blockquote>"}).Text(opts); got != "html" {
+		t.Errorf("Text() with BodyHTML only = %q", got)
+	}
+	text, err := ExtractText(context.Background(), Attachment{Filename: "page.html", Content: []byte("<h1>Invoice</h1><p>Total: 5</p>")})
+	if err != nil || text != "Invoice\n\nTotal: 5" {
+		t.Errorf("ExtractText(html) = %q, %v", text, err)
+	}
+}
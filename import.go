@@ -0,0 +1,78 @@
+// import.go - Placing existing messages into a mailbox without delivering
+// them, for migration and archival tools. The message is supplied as raw
+// RFC 5322 bytes (e.g. an .eml file) and lands in the mailbox with the chosen
+// labels and its original date; nobody is notified and no copy is sent.
+// Implemented for Gmail (gmail_import.go); Outlook returns ErrUnsupported.
+package email
+
+import (
+	"context"
+	"io"
+)
+
+// ImportOptions controls how ImportMessage places a message.
+type ImportOptions struct {
+	// Labels are applied to the imported message, by name or system label id
+	// (e.g. "INBOX", "Archive/2019"). Missing user labels are created. With no
+	// labels the message is reachable only through All Mail and search.
+	Labels []string
+
+	// Scan runs the message through the provider's normal inbound processing
+	// (Gmail messages.import: spam/phishing classification, as if received
+	// over SMTP). When false it is placed as-is (Gmail messages.insert).
+	Scan bool
+
+	// NeverMarkSpam keeps a scanned message out of spam regardless of the
+	// classifier's decision. Only meaningful with Scan.
+	NeverMarkSpam bool
+
+	// ReceivedNow sets the message's internal (sort) date to the import time
+	// instead of its Date header. By default the Date header is used so
+	// migrated mail keeps its original position in the mailbox.
+	ReceivedNow bool
+}
+
+// ImportProvider is implemented by providers that can place raw messages into
+// the mailbox without sending them (Gmail).
+type ImportProvider interface {
+	// ImportMessage stores the raw RFC 5322 message read from raw and returns
+	// its provider message id.
+	ImportMessage(ctx context.Context, raw io.Reader, opts ImportOptions) (string, error)
+}
+
+// importer returns the client's provider as an ImportProvider, or
+// ErrUnsupported.
+func (c *Client) importer() (ImportProvider, error) {
+	ip, ok := c.provider.(ImportProvider)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return ip, nil
+}
+
+// ImportMessage stores a raw RFC 5322 message in the mailbox without sending
+// it, with a default timeout, and returns its provider message id.
+//
+// Example:
+//
+//	f, err := os.Open("archive/2019-03-01.eml")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer f.Close()
+//
+//	id, err := client.ImportMessage(f, email.ImportOptions{Labels: []string{"Archive/2019"}})
+func (c *Client) ImportMessage(raw io.Reader, opts ImportOptions) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	return c.ImportMessageWithContext(ctx, raw, opts)
+}
+
+// ImportMessageWithContext is ImportMessage with a caller-supplied context.
+func (c *Client) ImportMessageWithContext(ctx context.Context, raw io.Reader, opts ImportOptions) (string, error) {
+	ip, err := c.importer()
+	if err != nil {
+		return "", err
+	}
+	return ip.ImportMessage(ctx, raw, opts)
+}
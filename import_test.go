@@ -0,0 +1,39 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// mockImporter is a send-only provider that also implements ImportProvider.
+type mockImporter struct {
+	mockProvider
+	raw  string
+	opts ImportOptions
+}
+
+func (m *mockImporter) ImportMessage(_ context.Context, raw io.Reader, opts ImportOptions) (string, error) {
+	b, err := io.ReadAll(raw)
+	m.raw, m.opts = string(b), opts
+	return "imported-1", err
+}
+
+func TestClientImportMessage(t *testing.T) {
+	if _, err := (&Client{provider: &mockProvider{}}).ImportMessage(strings.NewReader(""), ImportOptions{}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("ImportMessage on send-only provider: got %v, want ErrUnsupported", err)
+	}
+
+	mock := &mockImporter{}
+	c := &Client{provider: mock}
+	raw := "From: a@example.com\r\nSubject: old\r\n\r\nbody"
+	id, err := c.ImportMessage(strings.NewReader(raw), ImportOptions{Labels: []string{"Archive"}, Scan: true})
+	if err != nil {
+		t.Fatalf("ImportMessage: %v", err)
+	}
+	if id != "imported-1" || mock.raw != raw || !mock.opts.Scan || len(mock.opts.Labels) != 1 {
+		t.Errorf("got id=%q raw=%q opts=%+v", id, mock.raw, mock.opts)
+	}
+}
@@ -0,0 +1,232 @@
+// language.go - Language detection for inbound mail, e.g. to answer with a
+// localized auto-response or route a reply to the right support queue. The
+// built-in detector needs no models or services: non-Latin scripts identify
+// most languages on their own, and Latin-script text is scored against the
+// common function words of the major European languages. SetLanguageDetector
+// plugs in a more thorough detector (a CLD or fastText binding, a cloud API).
+package email
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Language is the result of language detection.
+type Language struct {
+	// Code is the ISO 639-1 code ("en", "de", "ja"), or "" if the text is
+	// too short or ambiguous to tell.
+	Code string
+
+	// Confidence is between 0 and 1.
+	Confidence float64
+}
+
+// LanguageDetector detects the language of a text.
+type LanguageDetector interface {
+	DetectLanguage(text string) Language
+}
+
+// LanguageDetectorFunc adapts a function to the LanguageDetector interface.
+type LanguageDetectorFunc func(text string) Language
+
+// DetectLanguage calls f(text).
+func (f LanguageDetectorFunc) DetectLanguage(text string) Language {
+	return f(text)
+}
+
+var (
+	languageDetectorMu sync.RWMutex
+	languageDetector   LanguageDetector = LanguageDetectorFunc(detectLanguage)
+)
+
+// SetLanguageDetector replaces the detector used by DetectLanguage and
+// FullMessage.Language; nil restores the built-in one. It is safe for
+// concurrent use.
+func SetLanguageDetector(d LanguageDetector) {
+	if d == nil {
+		d = LanguageDetectorFunc(detectLanguage)
+	}
+	languageDetectorMu.Lock()
+	languageDetector = d
+	languageDetectorMu.Unlock()
+}
+
+// DetectLanguage returns the language of text.
+//
+// Example:
+//
+//	switch email.DetectLanguage(body).Code {
+//	case "de":
+//	    queue = "support-de"
+//	case "fr":
+//	    queue = "support-fr"
+//	}
+func DetectLanguage(text string) Language {
+	languageDetectorMu.RLock()
+	d := languageDetector
+	languageDetectorMu.RUnlock()
+	return d.DetectLanguage(text)
+}
+
+// Language returns the language of the message's new content: quoted
+// history and the signature, which may be in another language, are ignored.
+func (m *FullMessage) Language() Language {
+	r := m.ParseReply()
+	text := r.Body
+	if text == "" {
+		text = m.Subject
+	}
+	return DetectLanguage(text)
+}
+
+// Minimum evidence for the built-in detector.
+const (
+	minScriptLetters  = 4
+	minFunctionWords  = 2
+	minLatinTextWords = 3
+)
+
+// scriptLanguages maps scripts used by essentially one language (in mail) to
+// it. Han, kana and Cyrillic are handled separately.
+var scriptLanguages = []struct {
+	table *unicode.RangeTable
+	code  string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Armenian, "hy"},
+	{unicode.Georgian, "ka"},
+}
+
+// functionWords are frequent, short words of each Latin-script language.
+// Words shared between languages count for each of them; the distinctive
+// ones decide.
+var functionWords = map[string][]string{
+	"en": strings.Fields("the and is are was were you your have has will would this that with for not be of to in it on at we our please thanks thank can could my me"),
+	"de": strings.Fields("der die das und ist nicht ich sie wir ein eine zu mit auf für den dem des bitte danke ihr haben wird sind auch noch aber wie"),
+	"fr": strings.Fields("le la les et est des une un pour dans que qui pas vous nous avec sur ce cette je merci mais sont être avez ai au aux du de"),
+	"es": strings.Fields("el la los las y es que de en un una por para con no se su usted gracias pero está están hola muy del al como"),
+	"it": strings.Fields("il lo la gli le e è che di un una per con non sono ho grazie ma anche della del questo ci si come sei siamo"),
+	"nl": strings.Fields("de het een en is van ik je niet dat die met voor op zijn wij we ook maar bedankt graag heeft aan er"),
+	"pt": strings.Fields("o a os as e é que de do da em um uma para com não por obrigado obrigada mas você está são no na se muito"),
+	"sv": strings.Fields("och att det är som en ett på för med inte jag vi har till av den om tack men kan ska"),
+	"pl": strings.Fields("i w na z że nie to jest się do jak co ale tak dziękuję proszę czy mam być są ten"),
+}
+
+// functionWordLanguages indexes functionWords by word.
+var functionWordLanguages = func() map[string][]string {
+	m := make(map[string][]string)
+	for code, words := range functionWords {
+		for _, w := range words {
+			m[w] = append(m[w], code)
+		}
+	}
+	return m
+}()
+
+// detectLanguage is the built-in detector.
+func detectLanguage(text string) Language {
+	var latin, cyrillic, han, kana, letters int
+	other := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		default:
+			for _, s := range scriptLanguages {
+				if unicode.Is(s.table, r) {
+					other[s.code]++
+					break
+				}
+			}
+		}
+	}
+	if letters == 0 {
+		return Language{}
+	}
+
+	best, count := "", latin
+	for code, n := range other {
+		if n > count {
+			best, count = code, n
+		}
+	}
+	if cyrillic > count {
+		best, count = cyrillicLanguage(text), cyrillic
+	}
+	// Japanese mixes kana with Han; Chinese has no kana.
+	if kana+han > count {
+		best, count = "zh", kana+han
+		if kana > 0 {
+			best = "ja"
+		}
+	}
+	if best != "" {
+		if count < minScriptLetters {
+			return Language{}
+		}
+		return Language{Code: best, Confidence: float64(count) / float64(letters)}
+	}
+	return detectLatin(text)
+}
+
+// cyrillicLanguage tells Ukrainian, Bulgarian and Russian apart by the
+// letters only one of them uses, defaulting to Russian.
+func cyrillicLanguage(text string) string {
+	switch {
+	case strings.ContainsAny(text, "іїєґІЇЄҐ"):
+		return "uk"
+	case strings.ContainsAny(text, "ыэЫЭ"):
+		return "ru"
+	case strings.ContainsAny(text, "ъЪ") && !strings.ContainsAny(text, "ёЁ"):
+		return "bg"
+	}
+	return "ru"
+}
+
+// detectLatin scores Latin-script text by function words.
+func detectLatin(text string) Language {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	if len(words) < minLatinTextWords {
+		return Language{}
+	}
+	scores := make(map[string]int)
+	for _, w := range words {
+		for _, code := range functionWordLanguages[w] {
+			scores[code]++
+		}
+	}
+	best, second := "", 0
+	for code, n := range scores {
+		switch {
+		case best == "" || n > scores[best] || n == scores[best] && code < best:
+			if best != "" {
+				second = max(second, scores[best])
+			}
+			best = code
+		case n > second:
+			second = n
+		}
+	}
+	if best == "" || scores[best] < minFunctionWords || scores[best] == second {
+		return Language{}
+	}
+	return Language{Code: best, Confidence: float64(scores[best]-second) / float64(scores[best])}
+}
@@ -0,0 +1,58 @@
+package email
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Hi, thanks for the quick reply. Could you please send the invoice again?", "en"},
+		{"Hallo, danke für die schnelle Antwort. Können Sie mir bitte die Rechnung noch einmal schicken?", "de"},
+		{"Bonjour, merci pour votre réponse. Pouvez-vous nous envoyer la facture à nouveau ?", "fr"},
+		{"Hola, gracias por la respuesta. ¿Puede enviarme la factura otra vez, por favor?", "es"},
+		{"Ciao, grazie per la risposta. Non ho ricevuto la fattura, puoi mandarla di nuovo?", "it"},
+		{"Hallo, bedankt voor het snelle antwoord. Ik heb de factuur niet ontvangen.", "nl"},
+		{"Olá, obrigado pela resposta. Você pode enviar a fatura de novo? Não recebi.", "pt"},
+		{"Hej, tack för svaret. Jag har inte fått fakturan, kan ni skicka den igen?", "sv"},
+		{"Dzień dobry, dziękuję za odpowiedź. Nie mam faktury, czy można wysłać ją jeszcze raz?", "pl"},
+		{"Здравствуйте, спасибо за быстрый ответ. Вы можете отправить счёт ещё раз?", "ru"},
+		{"Добрий день, дякую за відповідь. Чи можете ви надіслати рахунок ще раз?", "uk"},
+		{"お問い合わせありがとうございます。請求書をもう一度送っていただけますか。", "ja"},
+		{"感谢您的快速回复。请再发送一次发票。", "zh"},
+		{"빠른 답변 감사합니다. 청구서를 다시 보내주실 수 있나요?", "ko"},
+		{"Ευχαριστώ για την απάντηση. Μπορείτε να στείλετε ξανά το τιμολόγιο;", "el"},
+		{"شكرا على الرد السريع. هل يمكنك إرسال الفاتورة مرة أخرى؟", "ar"},
+		{"OK", ""},
+		{"12345 !!! ???", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got := DetectLanguage(tt.text)
+		if got.Code != tt.want {
+			t.Errorf("DetectLanguage(%q) = %+v, want %q", tt.text, got, tt.want)
+		}
+		if got.Code != "" && (got.Confidence <= 0 || got.Confidence > 1) {
+			t.Errorf("DetectLanguage(%q) confidence = %v", tt.text, got.Confidence)
+		}
+	}
+}
+
+func TestFullMessageLanguage(t *testing.T) {
+	m := &FullMessage{BodyText: "Merci, c'est parfait pour nous.\n\nOn Mon, 1 Jan 2024, Alice wrote:\n> Thanks for the order, we will ship it on Monday and send you the invoice."}
+	if got := m.Language().Code; got != "fr" {
+		t.Errorf("Language() = %q, want fr (quoted English ignored)", got)
+	}
+}
+
+func TestSetLanguageDetector(t *testing.T) {
+	SetLanguageDetector(LanguageDetectorFunc(func(string) Language { return Language{Code: "xx", Confidence: 1} }))
+	defer SetLanguageDetector(nil)
+	if got := DetectLanguage("the and is").Code; got != "xx" {
+		t.Errorf("DetectLanguage() with custom detector = %q", got)
+	}
+	SetLanguageDetector(nil)
+	if got := DetectLanguage("thanks for the help, this is great").Code; got != "en" {
+		t.Errorf("DetectLanguage() after reset = %q", got)
+	}
+}
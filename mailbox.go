@@ -12,6 +12,7 @@ package email
 
 import (
 	"context"
+	"net/mail"
 	"time"
 )
 
@@ -58,6 +59,16 @@ type FullMessage struct {
 
 	// BodyHTML is the HTML body, if the message was HTML.
 	BodyHTML string
+
+	// MessageID is the Message-ID header, without angle brackets.
+	MessageID string
+
+	// References is the References header: the Message-IDs of the earlier
+	// messages of the conversation, in angle brackets.
+	References string
+
+	// ReplyTo is the Reply-To address, if the sender set one.
+	ReplyTo string
 }
 
 // ListOptions filters and bounds a List or Search call. The zero value lists
@@ -109,18 +120,14 @@ type AttachmentMeta struct {
 	Size int64
 }
 
-// MailboxProvider extends Provider with read and management operations.
-// Both built-in providers (Outlook 365, Gmail) implement it. Code that only
-// sends can continue to use Provider; code that needs the wider surface can
-// type-assert a provider to MailboxProvider or use the Client methods below,
-// which require it.
+// Receiver is the read side of a mailbox: listing, reading and exporting
+// messages. Both built-in providers (Outlook 365, Gmail) implement it, as do
+// providers that can only receive.
 //
 // All methods take a context for timeout/cancellation. The mailbox operated on
 // is the one the provider was configured for (Outlook: the address passed as
 // the message From / the configured user; Gmail: the authenticated "me").
-type MailboxProvider interface {
-	Provider
-
+type Receiver interface {
 	// List returns message headers from a folder per opts (default inbox),
 	// newest first.
 	List(ctx context.Context, opts ListOptions) ([]Summary, error)
@@ -133,11 +140,6 @@ type MailboxProvider interface {
 	// opts bounds the results (Folder is ignored).
 	Search(ctx context.Context, query string, opts ListOptions) ([]Summary, error)
 
-	// Move relocates a message to the destination folder/label. For Outlook
-	// the message is moved; for Gmail the destination label is added and
-	// INBOX removed (archive-style move). dest is a folder/label name or id.
-	Move(ctx context.Context, id, dest string) error
-
 	// ListAttachments returns metadata for a message's file attachments.
 	ListAttachments(ctx context.Context, id string) ([]AttachmentMeta, error)
 
@@ -154,6 +156,18 @@ type MailboxProvider interface {
 	// ErrUnsupported.
 	SaveMessageRaw(ctx context.Context, id, destDir, baseName string) (string, error)
 
+	// ListFolders returns the mailbox's folders (Outlook) or labels (Gmail).
+	ListFolders(ctx context.Context) ([]Folder, error)
+}
+
+// MailboxManager changes the messages of a mailbox: moving, flagging,
+// labelling and deleting them. Both built-in providers implement it.
+type MailboxManager interface {
+	// Move relocates a message to the destination folder/label. For Outlook
+	// the message is moved; for Gmail the destination label is added and
+	// INBOX removed (archive-style move). dest is a folder/label name or id.
+	Move(ctx context.Context, id, dest string) error
+
 	// MarkRead sets a message's read state.
 	MarkRead(ctx context.Context, id string, read bool) error
 
@@ -167,30 +181,61 @@ type MailboxProvider interface {
 	// deleted where the provider supports it (Gmail requires the full-access
 	// scope for permanent deletion).
 	Delete(ctx context.Context, id string, permanent bool) error
-
-	// ListFolders returns the mailbox's folders (Outlook) or labels (Gmail).
-	ListFolders(ctx context.Context) ([]Folder, error)
 }
 
-// Compile-time guarantees that both built-in providers implement the full
-// mailbox surface, not just Send.
-var (
-	_ MailboxProvider = (*outlookProvider)(nil)
-	_ MailboxProvider = (*gmailProvider)(nil)
-)
+// MailboxProvider is the full mailbox surface: sending, receiving and
+// managing messages. Both built-in providers implement it. Providers may
+// implement any subset of Sender, Receiver and MailboxManager instead; the
+// Client methods need only the capability they use, and AsReceiver and
+// AsMailboxManager detect one at runtime.
+type MailboxProvider interface {
+	Provider
+	Receiver
+	MailboxManager
+}
 
 // defaultTimeout matches the send path's default per-call timeout.
 const defaultTimeout = 30 * time.Second
 
-// mailbox returns the client's provider as a MailboxProvider, or an error if
-// the configured provider does not support mailbox operations. Both built-in
-// providers do; this guard exists for custom providers.
-func (c *Client) mailbox() (MailboxProvider, error) {
-	mp, ok := c.provider.(MailboxProvider)
+// AsReceiver returns the client's default provider as a Receiver, and
+// whether it is one.
+//
+// Example:
+//
+//	if r, ok := email.AsReceiver(client); ok {
+//	    folders, err := r.ListFolders(ctx)
+//	    ...
+//	}
+func AsReceiver(c *Client) (Receiver, bool) {
+	r, ok := c.provider.(Receiver)
+	return r, ok
+}
+
+// AsMailboxManager returns the client's default provider as a
+// MailboxManager, and whether it is one.
+func AsMailboxManager(c *Client) (MailboxManager, bool) {
+	m, ok := c.provider.(MailboxManager)
+	return m, ok
+}
+
+// receiver returns the client's provider as a Receiver, or ErrUnsupported.
+// Both built-in providers are; this guard exists for custom providers.
+func (c *Client) receiver() (Receiver, error) {
+	r, ok := AsReceiver(c)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return r, nil
+}
+
+// manager returns the client's provider as a MailboxManager, or
+// ErrUnsupported.
+func (c *Client) manager() (MailboxManager, error) {
+	m, ok := AsMailboxManager(c)
 	if !ok {
 		return nil, ErrUnsupported
 	}
-	return mp, nil
+	return m, nil
 }
 
 // List returns message headers from a folder (default inbox), newest first,
@@ -203,11 +248,11 @@ func (c *Client) List(opts ListOptions) ([]Summary, error) {
 
 // ListWithContext is List with a caller-supplied context.
 func (c *Client) ListWithContext(ctx context.Context, opts ListOptions) ([]Summary, error) {
-	mp, err := c.mailbox()
+	r, err := c.receiver()
 	if err != nil {
 		return nil, err
 	}
-	return mp.List(ctx, opts)
+	return r.List(ctx, opts)
 }
 
 // Read returns one message including its body, with a default timeout.
@@ -219,11 +264,11 @@ func (c *Client) Read(id string) (*FullMessage, error) {
 
 // ReadWithContext is Read with a caller-supplied context.
 func (c *Client) ReadWithContext(ctx context.Context, id string) (*FullMessage, error) {
-	mp, err := c.mailbox()
+	r, err := c.receiver()
 	if err != nil {
 		return nil, err
 	}
-	return mp.Read(ctx, id)
+	return r.Read(ctx, id)
 }
 
 // Search runs a provider-native full-text search, with a default timeout.
@@ -235,11 +280,11 @@ func (c *Client) Search(query string, opts ListOptions) ([]Summary, error) {
 
 // SearchWithContext is Search with a caller-supplied context.
 func (c *Client) SearchWithContext(ctx context.Context, query string, opts ListOptions) ([]Summary, error) {
-	mp, err := c.mailbox()
+	r, err := c.receiver()
 	if err != nil {
 		return nil, err
 	}
-	return mp.Search(ctx, query, opts)
+	return r.Search(ctx, query, opts)
 }
 
 // Move relocates a message to the destination folder/label, with a default
@@ -252,11 +297,11 @@ func (c *Client) Move(id, dest string) error {
 
 // MoveWithContext is Move with a caller-supplied context.
 func (c *Client) MoveWithContext(ctx context.Context, id, dest string) error {
-	mp, err := c.mailbox()
+	m, err := c.manager()
 	if err != nil {
 		return err
 	}
-	return mp.Move(ctx, id, dest)
+	return m.Move(ctx, id, dest)
 }
 
 // ListAttachments returns metadata for a message's file attachments, with a
@@ -269,11 +314,11 @@ func (c *Client) ListAttachments(id string) ([]AttachmentMeta, error) {
 
 // ListAttachmentsWithContext is ListAttachments with a caller-supplied context.
 func (c *Client) ListAttachmentsWithContext(ctx context.Context, id string) ([]AttachmentMeta, error) {
-	mp, err := c.mailbox()
+	r, err := c.receiver()
 	if err != nil {
 		return nil, err
 	}
-	return mp.ListAttachments(ctx, id)
+	return r.ListAttachments(ctx, id)
 }
 
 // SaveAttachments writes a message's file attachments into destDir, with a
@@ -286,11 +331,75 @@ func (c *Client) SaveAttachments(id, destDir string) ([]string, error) {
 
 // SaveAttachmentsWithContext is SaveAttachments with a caller-supplied context.
 func (c *Client) SaveAttachmentsWithContext(ctx context.Context, id, destDir string) ([]string, error) {
-	mp, err := c.mailbox()
+	r, err := c.receiver()
 	if err != nil {
 		return nil, err
 	}
-	return mp.SaveAttachments(ctx, id, destDir)
+	return r.SaveAttachments(ctx, id, destDir)
+}
+
+// AttachmentProvider is implemented by mailbox providers that can download a
+// single attachment without the rest of its message. Both built-in providers
+// implement it.
+type AttachmentProvider interface {
+	// GetAttachment returns the content of one attachment of message id,
+	// identified by the AttachmentMeta.ID from ListAttachments.
+	GetAttachment(ctx context.Context, id, attachmentID string) ([]byte, error)
+}
+
+// GetAttachment downloads one attachment of a message by the ID reported by
+// ListAttachments, with a default timeout. Only that attachment is
+// transferred, not the whole message.
+//
+// Example:
+//
+//	metas, err := client.ListAttachments(id)
+//	...
+//	for _, m := range metas {
+//	    if m.MimeType == "application/pdf" {
+//	        pdf, err := client.GetAttachment(id, m.ID)
+//	        ...
+//	    }
+//	}
+func (c *Client) GetAttachment(id, attachmentID string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	return c.GetAttachmentWithContext(ctx, id, attachmentID)
+}
+
+// GetAttachmentWithContext is GetAttachment with a caller-supplied context.
+func (c *Client) GetAttachmentWithContext(ctx context.Context, id, attachmentID string) ([]byte, error) {
+	ap, ok := c.provider.(AttachmentProvider)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return ap.GetAttachment(ctx, id, attachmentID)
+}
+
+// HeaderProvider is implemented by mailbox providers that can return a
+// message's complete header. Both built-in providers implement it.
+type HeaderProvider interface {
+	// MessageHeaders returns every header field of message id, in the
+	// order they appear in the message (most recent trace fields first).
+	MessageHeaders(ctx context.Context, id string) (mail.Header, error)
+}
+
+// MessageHeaders returns the complete header of a message, with a default
+// timeout: trace, authentication and spam-filter fields included, which
+// Read does not surface.
+func (c *Client) MessageHeaders(id string) (mail.Header, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	return c.MessageHeadersWithContext(ctx, id)
+}
+
+// MessageHeadersWithContext is MessageHeaders with a caller-supplied context.
+func (c *Client) MessageHeadersWithContext(ctx context.Context, id string) (mail.Header, error) {
+	hp, ok := c.provider.(HeaderProvider)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return hp.MessageHeaders(ctx, id)
 }
 
 // SaveMessageRaw writes a message's raw RFC822 MIME (.eml) into destDir under a
@@ -304,11 +413,11 @@ func (c *Client) SaveMessageRaw(id, destDir, baseName string) (string, error) {
 
 // SaveMessageRawWithContext is SaveMessageRaw with a caller-supplied context.
 func (c *Client) SaveMessageRawWithContext(ctx context.Context, id, destDir, baseName string) (string, error) {
-	mp, err := c.mailbox()
+	r, err := c.receiver()
 	if err != nil {
 		return "", err
 	}
-	return mp.SaveMessageRaw(ctx, id, destDir, baseName)
+	return r.SaveMessageRaw(ctx, id, destDir, baseName)
 }
 
 // MarkRead sets a message's read state, with a default timeout.
@@ -320,11 +429,11 @@ func (c *Client) MarkRead(id string, read bool) error {
 
 // MarkReadWithContext is MarkRead with a caller-supplied context.
 func (c *Client) MarkReadWithContext(ctx context.Context, id string, read bool) error {
-	mp, err := c.mailbox()
+	m, err := c.manager()
 	if err != nil {
 		return err
 	}
-	return mp.MarkRead(ctx, id, read)
+	return m.MarkRead(ctx, id, read)
 }
 
 // SetLabels replaces a message's labels/categories, with a default timeout.
@@ -336,11 +445,11 @@ func (c *Client) SetLabels(id string, labels []string) error {
 
 // SetLabelsWithContext is SetLabels with a caller-supplied context.
 func (c *Client) SetLabelsWithContext(ctx context.Context, id string, labels []string) error {
-	mp, err := c.mailbox()
+	m, err := c.manager()
 	if err != nil {
 		return err
 	}
-	return mp.SetLabels(ctx, id, labels)
+	return m.SetLabels(ctx, id, labels)
 }
 
 // Delete removes a message (trash if permanent is false), with a default
@@ -353,11 +462,11 @@ func (c *Client) Delete(id string, permanent bool) error {
 
 // DeleteWithContext is Delete with a caller-supplied context.
 func (c *Client) DeleteWithContext(ctx context.Context, id string, permanent bool) error {
-	mp, err := c.mailbox()
+	m, err := c.manager()
 	if err != nil {
 		return err
 	}
-	return mp.Delete(ctx, id, permanent)
+	return m.Delete(ctx, id, permanent)
 }
 
 // ListFolders returns the mailbox's folders (Outlook) or labels (Gmail), with
@@ -370,9 +479,9 @@ func (c *Client) ListFolders() ([]Folder, error) {
 
 // ListFoldersWithContext is ListFolders with a caller-supplied context.
 func (c *Client) ListFoldersWithContext(ctx context.Context) ([]Folder, error) {
-	mp, err := c.mailbox()
+	r, err := c.receiver()
 	if err != nil {
 		return nil, err
 	}
-	return mp.ListFolders(ctx)
+	return r.ListFolders(ctx)
 }
@@ -0,0 +1,54 @@
+//go:build !email_no_gmail
+
+package email
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGmailQuery(t *testing.T) {
+	since := time.Unix(1_700_000_000, 0)
+	tests := []struct {
+		name string
+		opts ListOptions
+		want string
+	}{
+		{"empty", ListOptions{}, ""},
+		{"unread", ListOptions{UnreadOnly: true}, "is:unread"},
+		{"since", ListOptions{Since: since}, "after:1700000000"},
+		{"both", ListOptions{UnreadOnly: true, Since: since}, "is:unread after:1700000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gmailQuery(tt.opts); got != tt.want {
+				t.Errorf("gmailQuery(%+v) = %q, want %q", tt.opts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGmailSystemLabelsMapping(t *testing.T) {
+	for _, l := range []string{"INBOX", "SENT", "UNREAD", "TRASH"} {
+		if !gmailSystemLabels[l] {
+			t.Errorf("expected %q to be a recognized system label", l)
+		}
+	}
+	if gmailSystemLabels["Clients/WOO-402"] {
+		t.Error("user label wrongly treated as system label")
+	}
+}
+
+func TestGmailGetAttachment(t *testing.T) {
+	testGetAttachment(t, newTestGmail(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/gmail/v1/users/me/messages/m1/attachments/a1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"size":%d,"data":%q}`, len(testAttachment), base64.RawURLEncoding.EncodeToString(testAttachment))
+	}))
+}
@@ -0,0 +1,51 @@
+//go:build !email_no_outlook
+
+package email
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestOutlookFilter(t *testing.T) {
+	since := time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		opts ListOptions
+		want string // "" means nil
+	}{
+		{"none", ListOptions{}, ""},
+		{"unread", ListOptions{UnreadOnly: true}, "isRead eq false"},
+		{"since", ListOptions{Since: since}, "receivedDateTime ge 2026-06-01T09:00:00Z"},
+		{"both", ListOptions{UnreadOnly: true, Since: since}, "isRead eq false and receivedDateTime ge 2026-06-01T09:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := outlookFilter(tt.opts)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("outlookFilter(%+v) = %q, want nil", tt.opts, *got)
+				}
+				return
+			}
+			if got == nil || *got != tt.want {
+				t.Errorf("outlookFilter(%+v) = %v, want %q", tt.opts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutlookGetAttachment(t *testing.T) {
+	testGetAttachment(t, newTestOutlook(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1.0/users/user@example.com/messages/m1/attachments/a1/$value" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error":{"code":"ErrorItemNotFound","message":"not found"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write(testAttachment)
+	}))
+}
@@ -1,11 +1,11 @@
 package email
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"reflect"
 	"testing"
-	"time"
 )
 
 // mockMailbox implements MailboxProvider for testing the Client wrappers and
@@ -67,6 +67,35 @@ func TestClientMailboxUnsupported(t *testing.T) {
 	}
 }
 
+func TestClientReceiverOnly(t *testing.T) {
+	// A provider implementing only Sender and Receiver reads through the
+	// Client but cannot manage messages.
+	mb := &mockMailbox{summ: []Summary{{ID: "1"}}}
+	p := struct {
+		*mockProvider
+		Receiver
+	}{&mockProvider{}, mb}
+	c := &Client{provider: p}
+
+	if _, ok := AsReceiver(c); !ok {
+		t.Error("AsReceiver() = false for a receiving provider")
+	}
+	if _, ok := AsMailboxManager(c); ok {
+		t.Error("AsMailboxManager() = true for a receive-only provider")
+	}
+	if got, err := c.List(ListOptions{}); err != nil || len(got) != 1 {
+		t.Errorf("List() = %v, %v", got, err)
+	}
+	if err := c.Move("1", "Archive"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Move on receive-only provider: got %v, want ErrUnsupported", err)
+	}
+
+	c = &Client{provider: mb}
+	if _, ok := AsMailboxManager(c); !ok {
+		t.Error("AsMailboxManager() = false for a full mailbox provider")
+	}
+}
+
 func TestClientMailboxDelegation(t *testing.T) {
 	want := []Summary{{ID: "1", Subject: "hi"}}
 	mb := &mockMailbox{summ: want}
@@ -91,55 +120,6 @@ func TestClientMailboxDelegation(t *testing.T) {
 	}
 }
 
-func TestGmailQuery(t *testing.T) {
-	since := time.Unix(1_700_000_000, 0)
-	tests := []struct {
-		name string
-		opts ListOptions
-		want string
-	}{
-		{"empty", ListOptions{}, ""},
-		{"unread", ListOptions{UnreadOnly: true}, "is:unread"},
-		{"since", ListOptions{Since: since}, "after:1700000000"},
-		{"both", ListOptions{UnreadOnly: true, Since: since}, "is:unread after:1700000000"},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := gmailQuery(tt.opts); got != tt.want {
-				t.Errorf("gmailQuery(%+v) = %q, want %q", tt.opts, got, tt.want)
-			}
-		})
-	}
-}
-
-func TestOutlookFilter(t *testing.T) {
-	since := time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC)
-	tests := []struct {
-		name string
-		opts ListOptions
-		want string // "" means nil
-	}{
-		{"none", ListOptions{}, ""},
-		{"unread", ListOptions{UnreadOnly: true}, "isRead eq false"},
-		{"since", ListOptions{Since: since}, "receivedDateTime ge 2026-06-01T09:00:00Z"},
-		{"both", ListOptions{UnreadOnly: true, Since: since}, "isRead eq false and receivedDateTime ge 2026-06-01T09:00:00Z"},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := outlookFilter(tt.opts)
-			if tt.want == "" {
-				if got != nil {
-					t.Errorf("outlookFilter(%+v) = %q, want nil", tt.opts, *got)
-				}
-				return
-			}
-			if got == nil || *got != tt.want {
-				t.Errorf("outlookFilter(%+v) = %v, want %q", tt.opts, got, tt.want)
-			}
-		})
-	}
-}
-
 func TestParseAddr(t *testing.T) {
 	tests := []struct{ in, want string }{
 		{"m@x.com", "m@x.com"},
@@ -177,13 +157,31 @@ func TestDecodeMIMEHeader(t *testing.T) {
 	}
 }
 
-func TestGmailSystemLabelsMapping(t *testing.T) {
-	for _, l := range []string{"INBOX", "SENT", "UNREAD", "TRASH"} {
-		if !gmailSystemLabels[l] {
-			t.Errorf("expected %q to be a recognized system label", l)
-		}
+// testGetAttachment checks provider's GetAttachment of attachment a1 of
+// message m1, which the provider's server serves as testAttachment.
+func testGetAttachment(t *testing.T, provider Provider) {
+	t.Helper()
+	c := &Client{provider: provider}
+	got, err := c.GetAttachment("m1", "a1")
+	if err != nil {
+		t.Fatalf("GetAttachment() error = %v", err)
 	}
-	if gmailSystemLabels["Clients/WOO-402"] {
-		t.Error("user label wrongly treated as system label")
+	if !bytes.Equal(got, testAttachment) {
+		t.Errorf("GetAttachment() = %q, want %q", got, testAttachment)
+	}
+	if _, err := c.GetAttachment("m1", "missing"); err == nil {
+		t.Error("GetAttachment(missing) succeeded")
+	}
+	if _, err := c.GetAttachment("m1", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAttachment(\"\") error = %v, want ErrNotFound", err)
+	}
+}
+
+// testAttachment is the attachment testGetAttachment expects.
+var testAttachment = []byte("%PDF-1.4 invoice \xff\xfe")
+
+func TestClientGetAttachmentUnsupported(t *testing.T) {
+	if _, err := (&Client{provider: &mockProvider{}}).GetAttachment("m1", "a1"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("GetAttachment() error = %v, want ErrUnsupported", err)
 	}
 }
@@ -0,0 +1,766 @@
+// mime.go - RFC 2822 / MIME rendering of a Message, shared by every path that
+// submits raw bytes: the Gmail API, SMTP submission and Outlook's MIME
+// fallback for headers Graph's JSON API cannot carry. BuildMIME and WriteMIME
+// expose the same renderer to applications, e.g. to archive or hand off
+// messages to other systems.
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MIMEOptions controls WriteMIME. The zero value renders a message as it is
+// submitted over SMTP.
+type MIMEOptions struct {
+	// Bcc writes the Bcc header, which SMTP submissions and copies for
+	// other recipients must not carry; APIs that read recipients from the
+	// message, like Gmail's, need it.
+	Bcc bool
+
+	// SevenBit encodes everything to 7-bit ASCII, for transports without
+	// 8BITMIME: non-ASCII bodies as quoted-printable.
+	SevenBit bool
+
+	// Boundary fixes the multipart boundary prefix, for reproducible output;
+	// a unique one is generated when empty. It must not occur in the content.
+	Boundary string
+}
+
+// BuildMIME renders msg as an RFC 5322 message with MIME parts, as it would
+// be submitted over SMTP: without the Bcc header, with attachments base64
+// encoded (see Attachment.Encoding) and non-ASCII headers RFC 2047 encoded.
+// It adds no Date or Message-ID header; set them in msg.Headers when the
+// result is to stand on its own. The message's header fields must be valid
+// (see Message.Validate); the rest of Validate's checks are not applied.
+func BuildMIME(msg *Message) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteMIME(&buf, msg, MIMEOptions{}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteMIME is BuildMIME writing to w per opts. Streamed attachments
+// (Attachment.Open) are copied through without being held in memory.
+func WriteMIME(w io.Writer, msg *Message, opts MIMEOptions) error {
+	for name, value := range msg.Headers {
+		if err := validateHeader(name, value); err != nil {
+			return err
+		}
+	}
+	return writeMessage(w, msg, rawOptions{withBcc: opts.Bcc, sevenBit: opts.SevenBit, boundary: opts.Boundary})
+}
+
+// buildRawMessage renders msg as RFC 2822 bytes. withBcc controls whether the Bcc
+// header is written: the Gmail API reads recipients from it, while an SMTP
+// submission carries them in the envelope and must not disclose them.
+func buildRawMessage(msg *Message, withBcc bool) ([]byte, error) {
+	return renderMessage(msg, rawOptions{withBcc: withBcc})
+}
+
+// MIMELayout adjusts the multipart structure of a rendered message. By
+// default the body is the root entity when there are no regular
+// attachments, and a message with both a text alternative and inline images
+// nests them as multipart/alternative{text, multipart/related{html,
+// images}}, which most clients prefer. Bodies are sent with CRLF line
+// endings, whatever they were written with.
+type MIMELayout struct {
+	// AlwaysMixed makes multipart/mixed the root even when there are no
+	// regular attachments, for archivers that expect it.
+	AlwaysMixed bool
+
+	// RelatedOutside nests the other way round:
+	// multipart/related{multipart/alternative{text, html}, images}, the
+	// structure some gateways require.
+	RelatedOutside bool
+
+	// PreserveLineEndings sends bodies with their line endings as given
+	// rather than normalized to CRLF, for content whose bare LF or CR
+	// characters are significant. Strict MTAs reject bare line endings
+	// (RFC 5322 §2.3), so use it only with relays known to accept them.
+	PreserveLineEndings bool
+}
+
+// rawOptions controls renderMessage.
+type rawOptions struct {
+	// withBcc writes the Bcc header (see buildRawMessage).
+	withBcc bool
+
+	// sevenBit produces a message safe for transports without 8BITMIME:
+	// a non-ASCII body is quoted-printable encoded and a non-ASCII subject
+	// RFC 2047 encoded.
+	sevenBit bool
+
+	// boundary fixes the multipart boundary, so that repeated renderings of
+	// one message (size probe, then transmission) are byte-identical.
+	// Generated when empty.
+	boundary string
+
+	// unsealed renders a message carrying a sealer without sealing it: the
+	// sealer renders the content to sign or encrypt this way.
+	unsealed bool
+}
+
+// messageSealer signs or encrypts messages as they are rendered: S/MIME
+// (smime.go) and PGP/MIME (pgp.go).
+type messageSealer interface {
+	// check returns an error if msg cannot be sealed, before it is sent.
+	check(msg *Message) error
+
+	// write renders msg per opts, sealed, to w.
+	write(w io.Writer, msg *Message, opts rawOptions) error
+}
+
+// contentEntity renders msg for a sealer: header holds the message's header
+// fields other than its content ones, which head content, the MIME entity
+// to sign or encrypt. The entity is rendered 7-bit with CRLF line endings,
+// so that no transport alters it and breaks a signature. boundary is the
+// boundary used, from which sealers derive their own.
+func contentEntity(msg *Message, opts rawOptions) (header string, content []byte, boundary string, err error) {
+	if opts.boundary == "" {
+		opts.boundary = newBoundary()
+	}
+	opts.sevenBit, opts.unsealed = true, true
+	raw, err := renderMessage(msg, opts)
+	if err != nil {
+		return "", nil, "", err
+	}
+	head, body, _ := bytes.Cut(raw, []byte("\r\n\r\n"))
+
+	var outer, entity strings.Builder
+	for _, f := range splitHeaderFields(string(head) + "\r\n") {
+		switch strings.ToLower(f.name) {
+		case "content-type", "content-transfer-encoding":
+			entity.WriteString(f.name + ":" + f.value)
+		default:
+			outer.WriteString(f.name + ":" + f.value)
+		}
+	}
+	entity.WriteString("\r\n")
+	entity.Write(canonicalCRLF(body))
+	return outer.String(), []byte(entity.String()), opts.boundary, nil
+}
+
+// canonicalCRLF converts bare LF and CR line endings to CRLF.
+func canonicalCRLF(b []byte) []byte {
+	s := strings.ReplaceAll(string(b), "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return []byte(strings.ReplaceAll(s, "\n", "\r\n"))
+}
+
+// renderMessage renders msg as RFC 2822 bytes per opts. Paths that can
+// stream should use writeMessage instead, which never holds attachment
+// content in memory.
+func renderMessage(msg *Message, opts rawOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeMessage(&buf, msg, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// newBoundary returns a fresh multipart boundary.
+func newBoundary() string {
+	return fmt.Sprintf("boundary-%d", time.Now().UnixNano())
+}
+
+// writeMessage writes msg as RFC 2822 to w per opts. Attachments are read
+// through Attachment.open and base64-encoded as they are copied; messages
+// to be signed or encrypted are rendered in memory first.
+func writeMessage(w io.Writer, msg *Message, opts rawOptions) error {
+	if msg.seal != nil && !opts.unsealed {
+		return msg.seal.write(w, msg, opts)
+	}
+	withBcc := opts.withBcc
+	message := bufio.NewWriter(w)
+
+	preserve := msg.MIMELayout.PreserveLineEndings
+	body, bodyCTE := encodeBody(msg.Body, opts.sevenBit, preserve)
+	text, textCTE := "", ""
+	if msg.HTML && msg.TextBody != "" {
+		text, textCTE = encodeBody(msg.TextBody, opts.sevenBit, preserve)
+	}
+
+	// Create email headers
+	headers := make(map[string]string)
+	headers["From"] = encodeAddressList([]string{msg.From})
+	switch {
+	case len(msg.To) > 0:
+		headers["To"] = encodeAddressList(msg.To)
+	case len(msg.Cc) == 0:
+		// An empty group (RFC 5322 §3.4) rather than no To, which some
+		// clients show as the sender's own address or flag as spam.
+		headers["To"] = "undisclosed-recipients:;"
+	}
+
+	if len(msg.Cc) > 0 {
+		headers["Cc"] = encodeAddressList(msg.Cc)
+	}
+
+	if withBcc && len(msg.Bcc) > 0 {
+		headers["Bcc"] = encodeAddressList(msg.Bcc)
+	}
+
+	headers["Subject"] = encodeHeaderValue(msg.Subject)
+	headers["MIME-Version"] = "1.0"
+
+	// Custom headers; Validate keeps them clear of the structural ones above.
+	for k, v := range msg.Headers {
+		headers[k] = encodeHeaderValue(v)
+	}
+	if msg.Priority != "" {
+		for k := range headers {
+			if strings.EqualFold(k, "X-Priority") || strings.EqualFold(k, "Importance") {
+				delete(headers, k)
+			}
+		}
+		headers["X-Priority"] = msg.Priority.xPriority()
+		headers["Importance"] = string(msg.Priority)
+	}
+	if msg.Sensitivity != "" {
+		for k := range headers {
+			if strings.EqualFold(k, "Sensitivity") {
+				delete(headers, k)
+			}
+		}
+		headers["Sensitivity"] = msg.Sensitivity.header()
+	}
+	if msg.Language != "" {
+		for k := range headers {
+			if strings.EqualFold(k, "Content-Language") || strings.EqualFold(k, "Accept-Language") {
+				delete(headers, k)
+			}
+		}
+		headers["Content-Language"] = msg.Language
+		headers["Accept-Language"] = msg.Language
+	}
+
+	boundary := opts.boundary
+	if boundary == "" {
+		boundary = newBoundary()
+	}
+	regular, inline := splitInline(msg.Attachments)
+	writeHeaders := func() {
+		// In a fixed order, so that renderings with one boundary match.
+		keys := make([]string, 0, len(headers))
+		for k := range headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(message, "%s: %s\r\n", k, headers[k])
+		}
+		message.WriteString("\r\n")
+	}
+
+	layout := msg.MIMELayout
+	if len(regular) == 0 && !layout.AlwaysMixed {
+		// The body is the whole message.
+		ct, cte, write := bodyEntity(msg.HTML, body, bodyCTE, text, textCTE, inline, boundary, layout)
+		headers["Content-Type"] = ct
+		if cte != "" {
+			headers["Content-Transfer-Encoding"] = cte
+		}
+		writeHeaders()
+		if err := write(message); err != nil {
+			return err
+		}
+		return message.Flush()
+	}
+
+	// Regular attachments go in a multipart/mixed after the body.
+	headers["Content-Type"] = "multipart/mixed; boundary=" + boundary
+	writeHeaders()
+	if text == "" && len(inline) == 0 {
+		writeBodyPart(message, boundary, msg.HTML, body, bodyCTE)
+	} else {
+		ct, _, write := bodyEntity(msg.HTML, body, bodyCTE, text, textCTE, inline, boundary+"-body", layout)
+		message.WriteString("--" + boundary + "\r\n")
+		message.WriteString("Content-Type: " + ct + "\r\n\r\n")
+		if err := write(message); err != nil {
+			return err
+		}
+	}
+	for _, att := range regular {
+		if err := writeAttachmentPart(message, att, boundary); err != nil {
+			return err
+		}
+	}
+	message.WriteString("--" + boundary + "--\r\n")
+	return message.Flush()
+}
+
+// bodyEntity returns the content type and a writer for the message body
+// with its text alternative and inline parts: a single text or HTML part,
+// a multipart/related of the HTML and its inline parts, or a
+// multipart/alternative of the text and either of those (with
+// layout.RelatedOutside, a multipart/related of the alternative and the
+// inline parts instead). Multipart entities use boundary; for a single part,
+// the transfer encoding to declare is returned too.
+func bodyEntity(html bool, body, cte, text, textCTE string, inline []Attachment, boundary string, layout MIMELayout) (contentType, transferEncoding string, write func(*bufio.Writer) error) {
+	related := func(w *bufio.Writer, boundary string) error {
+		return writeRelatedParts(w, boundary, html, body, cte, inline)
+	}
+	switch {
+	case text != "" && len(inline) > 0 && layout.RelatedOutside:
+		return `multipart/related; type="multipart/alternative"; boundary=` + boundary, "", func(w *bufio.Writer) error {
+			inner := boundary + "-alt"
+			w.WriteString("--" + boundary + "\r\n")
+			w.WriteString("Content-Type: multipart/alternative; boundary=" + inner + "\r\n\r\n")
+			writeBodyPart(w, inner, false, text, textCTE)
+			writeBodyPart(w, inner, true, body, cte)
+			w.WriteString("--" + inner + "--\r\n")
+			for _, att := range inline {
+				if err := writeAttachmentPart(w, att, boundary); err != nil {
+					return err
+				}
+			}
+			w.WriteString("--" + boundary + "--\r\n")
+			return nil
+		}
+	case text != "":
+		return "multipart/alternative; boundary=" + boundary, "", func(w *bufio.Writer) error {
+			// Least preferred first (RFC 2046, section 5.1.4).
+			writeBodyPart(w, boundary, false, text, textCTE)
+			if len(inline) > 0 {
+				inner := boundary + "-related"
+				w.WriteString("--" + boundary + "\r\n")
+				w.WriteString("Content-Type: " + relatedContentType(inner) + "\r\n\r\n")
+				if err := related(w, inner); err != nil {
+					return err
+				}
+			} else {
+				writeBodyPart(w, boundary, true, body, cte)
+			}
+			w.WriteString("--" + boundary + "--\r\n")
+			return nil
+		}
+	case len(inline) > 0:
+		return relatedContentType(boundary), "", func(w *bufio.Writer) error {
+			return related(w, boundary)
+		}
+	}
+	return contentTypeFor(html), cte, func(w *bufio.Writer) error {
+		_, err := w.WriteString(body)
+		return err
+	}
+}
+
+// contentTypeFor returns the Content-Type of a text or HTML body.
+func contentTypeFor(html bool) string {
+	if html {
+		return "text/html; charset=utf-8"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// writeBodyPart writes the text or HTML body as one part under boundary.
+func writeBodyPart(message *bufio.Writer, boundary string, html bool, body, cte string) {
+	message.WriteString("--" + boundary + "\r\n")
+	message.WriteString("Content-Type: " + contentTypeFor(html) + "\r\n")
+	if cte != "" {
+		message.WriteString("Content-Transfer-Encoding: " + cte + "\r\n")
+	}
+	message.WriteString("\r\n")
+	message.WriteString(body)
+	message.WriteString("\r\n\r\n")
+}
+
+// writeRelatedParts writes the body followed by the inline parts it
+// references, closing boundary.
+func writeRelatedParts(message *bufio.Writer, boundary string, html bool, body, cte string, inline []Attachment) error {
+	writeBodyPart(message, boundary, html, body, cte)
+	for _, att := range inline {
+		if err := writeAttachmentPart(message, att, boundary); err != nil {
+			return err
+		}
+	}
+	message.WriteString("--" + boundary + "--\r\n")
+	return nil
+}
+
+// relatedContentType is the multipart/related header value for an HTML root.
+func relatedContentType(boundary string) string {
+	return `multipart/related; type="text/html"; boundary=` + boundary
+}
+
+// splitInline separates inline (Content-ID referenced) attachments from
+// regular ones, keeping their order.
+func splitInline(atts []Attachment) (regular, inline []Attachment) {
+	for _, att := range atts {
+		if att.Inline {
+			inline = append(inline, att)
+		} else {
+			regular = append(regular, att)
+		}
+	}
+	return regular, inline
+}
+
+// writeAttachmentPart adds a single attachment to the email message.
+// It streams the attachment content through an encoder per att.Encoding
+// (base64 by default) and formats it according to RFC 2822 standards with
+// proper MIME headers.
+func writeAttachmentPart(message *bufio.Writer, att Attachment, boundary string) error {
+	// Determine MIME type
+	mimeType := att.MimeType
+	if mimeType == "" {
+		mimeType = getContentType(att.Filename)
+	}
+
+	r, err := att.open()
+	if err != nil {
+		return fmt.Errorf("attachment %q: %w", att.Filename, err)
+	}
+	defer r.Close()
+	cte := att.Encoding
+	var content []byte // read in full only where the encoding depends on it
+	switch cte {
+	case "":
+		cte = EncodingBase64
+	case Encoding7Bit, EncodingAuto:
+		if content, err = io.ReadAll(r); err != nil {
+			return fmt.Errorf("attachment %q: %w", att.Filename, err)
+		}
+		r = io.NopCloser(bytes.NewReader(content))
+		if cte == EncodingAuto {
+			cte = chooseEncoding(mimeType, content)
+		} else if err := check7Bit(content); err != nil {
+			return fmt.Errorf("attachment %q: %w", att.Filename, err)
+		}
+	}
+
+	// Write attachment headers
+	message.WriteString("--" + boundary + "\r\n")
+	fmt.Fprintf(message, "Content-Type: %s%s\r\n", mimeType, mimeParam("name", att.Filename))
+	message.WriteString("Content-Transfer-Encoding: " + string(cte) + "\r\n")
+	if att.Inline {
+		fmt.Fprintf(message, "Content-Disposition: inline%s\r\n", mimeParam("filename", att.Filename))
+		fmt.Fprintf(message, "Content-ID: <%s>\r\n", att.ContentID)
+	} else {
+		fmt.Fprintf(message, "Content-Disposition: attachment%s\r\n", mimeParam("filename", att.Filename))
+	}
+	message.WriteString("\r\n")
+
+	switch cte {
+	case Encoding7Bit:
+		message.Write(canonicalCRLF(content))
+		message.WriteString("\r\n")
+		return nil
+	case EncodingQuotedPrintable:
+		qp := quotedprintable.NewWriter(message)
+		if _, err := io.Copy(qp, r); err != nil {
+			return fmt.Errorf("attachment %q: %w", att.Filename, err)
+		}
+		if err := qp.Close(); err != nil {
+			return err
+		}
+		message.WriteString("\r\n")
+		return nil
+	}
+
+	// Encode content in base64, in 76-character lines (RFC 2045 standard)
+	lines := &lineWrapper{w: message, width: 76}
+	enc := base64.NewEncoder(base64.StdEncoding, lines)
+	if _, err := io.Copy(enc, r); err != nil {
+		return fmt.Errorf("attachment %q: %w", att.Filename, err)
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	if lines.col > 0 {
+		message.WriteString("\r\n")
+	}
+
+	message.WriteString("\r\n")
+	return nil
+}
+
+// check7Bit returns an error unless content can be sent as 7bit: ASCII
+// without NULs, in lines of at most 998 bytes (RFC 5322 §2.1.1).
+func check7Bit(content []byte) error {
+	for i, line := range bytes.Split(canonicalCRLF(content), []byte("\r\n")) {
+		if len(line) > 998 {
+			return fmt.Errorf("line %d is longer than 998 bytes; 7bit is not possible", i+1)
+		}
+		for _, c := range line {
+			if c == 0 || c >= 0x80 {
+				return fmt.Errorf("line %d is not ASCII text; 7bit is not possible", i+1)
+			}
+		}
+	}
+	return nil
+}
+
+// chooseEncoding returns the encoding EncodingAuto resolves to for content
+// of type mimeType. Quoted-printable costs two extra bytes per non-ASCII
+// byte against base64's third on everything, so it wins while under about
+// a sixth of the text is non-ASCII.
+func chooseEncoding(mimeType string, content []byte) TransferEncoding {
+	if !strings.HasPrefix(mimeType, "text/") {
+		return EncodingBase64
+	}
+	if check7Bit(content) == nil {
+		return Encoding7Bit
+	}
+	if bytes.IndexByte(content, 0) >= 0 {
+		return EncodingBase64
+	}
+	high := 0
+	for _, c := range content {
+		if c >= 0x80 {
+			high++
+		}
+	}
+	if high*6 > len(content) {
+		return EncodingBase64
+	}
+	return EncodingQuotedPrintable
+}
+
+// lineWrapper inserts a CRLF after every width bytes written through it.
+type lineWrapper struct {
+	w     io.Writer
+	width int
+	col   int
+}
+
+func (l *lineWrapper) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		chunk := min(len(p), l.width-l.col)
+		if _, err := l.w.Write(p[:chunk]); err != nil {
+			return n, err
+		}
+		n += chunk
+		l.col += chunk
+		p = p[chunk:]
+		if l.col == l.width {
+			if _, err := io.WriteString(l.w, "\r\n"); err != nil {
+				return n, err
+			}
+			l.col = 0
+		}
+	}
+	return n, nil
+}
+
+// reservedHeaders are rendered from Message fields and cannot be set through
+// Message.Headers.
+var reservedHeaders = map[string]bool{
+	"From": true, "To": true, "Cc": true, "Bcc": true, "Subject": true,
+	"Mime-Version": true, "Content-Type": true, "Content-Transfer-Encoding": true,
+}
+
+// validateHeader checks a custom header name and value: the name must be an
+// RFC 5322 field name not managed by Message itself, and neither may contain
+// line breaks that would inject further headers.
+func validateHeader(name, value string) error {
+	if name == "" {
+		return fmt.Errorf("header name is required")
+	}
+	for _, r := range name {
+		if r <= ' ' || r > '~' || r == ':' {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+	}
+	if reservedHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+		return fmt.Errorf("header %q is set from message fields", name)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("header %q: value must not contain line breaks", name)
+	}
+	return nil
+}
+
+// encodeHeaderValue RFC 2047-encodes a header value that is not plain ASCII.
+// Mostly-Latin text is Q-encoded, keeping it readable in the raw message;
+// text that is mostly non-ASCII (CJK, emoji) is B-encoded, which is shorter.
+// Long values are split into several encoded-words, one per folded line.
+func encodeHeaderValue(v string) string {
+	if isASCII(v) {
+		return v
+	}
+	enc, other := mime.QEncoding, 0
+	for _, r := range v {
+		if r >= utf8.RuneSelf {
+			other++
+		}
+	}
+	if other*2 > utf8.RuneCountInString(v) {
+		enc = mime.BEncoding
+	}
+	return strings.ReplaceAll(enc.Encode("utf-8", v), "?= =?", "?=\r\n =?")
+}
+
+// encodeAddressList formats addresses for an address header, RFC
+// 2047-encoding non-ASCII display names ("Jörg <j@example.com>").
+// Internationalized domains are converted to ASCII; non-ASCII mailbox names
+// are left as they are, for SMTPUTF8.
+func encodeAddressList(addrs []string) string {
+	out := make([]string, len(addrs))
+	for i, a := range addrs {
+		a = strings.TrimSpace(a)
+		j := strings.LastIndex(a, "<")
+		if j < 0 {
+			out[i] = headerAddrSpec(a)
+			continue
+		}
+		spec, rest, _ := strings.Cut(a[j+1:], ">")
+		spec = "<" + headerAddrSpec(spec) + ">" + rest
+		if j == 0 || isASCII(a[:j]) {
+			out[i] = a[:j] + spec
+			continue
+		}
+		name := strings.TrimSpace(a[:j])
+		if len(name) >= 2 && name[0] == '"' && name[len(name)-1] == '"' {
+			name = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(name[1 : len(name)-1])
+		}
+		out[i] = encodeHeaderValue(name) + " " + spec
+	}
+	return strings.Join(out, ", ")
+}
+
+// headerAddrSpec returns an addr-spec for a header field: with an ASCII
+// local part the domain is converted to ASCII, so the field needs no
+// SMTPUTF8; an internationalized local part is left in UTF-8 (RFC 6532).
+func headerAddrSpec(addr string) string {
+	if i := strings.LastIndexByte(addr, '@'); i >= 0 && isASCII(addr[:i]) {
+		return asciiAddress(addr)
+	}
+	return addr
+}
+
+// mimeParamSegment is the longest encoded value written on one header line by
+// mimeParam, keeping folded lines well under 76 characters.
+const mimeParamSegment = 48
+
+// mimeParam formats a "; attr=value" header parameter. Printable ASCII values
+// are quoted; anything else (non-ASCII or control characters) is
+// percent-encoded as UTF-8 per RFC 2231 on a folded line of its own, split
+// into numbered continuations when long:
+//
+//	Content-Disposition: attachment;
+//		filename*=UTF-8''Rechnung_M%C3%A4rz.pdf
+func mimeParam(attr, value string) string {
+	plain := true
+	for i := 0; i < len(value); i++ {
+		if value[i] < ' ' || value[i] > '~' {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		return "; " + attr + "=\"" + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + "\""
+	}
+
+	var enc strings.Builder
+	enc.WriteString("UTF-8''")
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; isAttrChar(c) {
+			enc.WriteByte(c)
+		} else {
+			fmt.Fprintf(&enc, "%%%02X", c)
+		}
+	}
+	encoded := enc.String()
+	if len(encoded) <= mimeParamSegment {
+		return ";\r\n\t" + attr + "*=" + encoded
+	}
+
+	// Continuations must not split a %XX triplet, nor the triplets of one
+	// UTF-8 sequence: some clients (Outlook among them) decode each
+	// continuation on its own and show a split character as "??".
+	var b strings.Builder
+	for n := 0; encoded != ""; n++ {
+		cut := min(mimeParamSegment, len(encoded))
+		if i := strings.LastIndexByte(encoded[:cut], '%'); i >= 0 && i+3 > cut && i > 0 {
+			cut = i
+		}
+		for cut < len(encoded) && cut >= 3 && isContinuationTriplet(encoded[cut:]) {
+			cut -= 3
+		}
+		fmt.Fprintf(&b, ";\r\n\t%s*%d*=%s", attr, n, encoded[:cut])
+		encoded = encoded[cut:]
+	}
+	return b.String()
+}
+
+// isContinuationTriplet reports whether s starts with the percent-encoding
+// of a UTF-8 continuation byte (0x80 to 0xBF).
+func isContinuationTriplet(s string) bool {
+	return len(s) >= 3 && s[0] == '%' && strings.IndexByte("89AB", s[1]) >= 0
+}
+
+// isAttrChar reports whether c may appear unencoded in an RFC 2231
+// extended parameter value.
+func isAttrChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
+
+// isASCII reports whether s is 7-bit clean.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// maxLineLength is the longest line RFC 5322 §2.1.1 allows, excluding CRLF.
+const maxLineLength = 998
+
+// encodeBody returns body as it is to be sent and its transfer encoding: as
+// is (no encoding header) when it fits, quoted-printable when it has a line
+// longer than maxLineLength (minified HTML, say), which relays may break or
+// reject, or when sevenBit and it is not ASCII. Line endings are normalized
+// to CRLF unless preserve is set.
+func encodeBody(body string, sevenBit, preserve bool) (string, string) {
+	if !preserve {
+		body = string(canonicalCRLF([]byte(body)))
+	}
+	if (sevenBit && !isASCII(body)) || hasLongLine(body) {
+		return quotedPrintable(body), "quoted-printable"
+	}
+	return body, ""
+}
+
+// hasLongLine reports whether s has a line longer than maxLineLength bytes.
+func hasLongLine(s string) bool {
+	for len(s) > maxLineLength {
+		i := strings.IndexAny(s, "\r\n")
+		if i < 0 {
+			return true
+		}
+		if i > maxLineLength {
+			return true
+		}
+		s = s[i+1:]
+	}
+	return false
+}
+
+// quotedPrintable encodes s as quoted-printable with CRLF line breaks.
+func quotedPrintable(s string) string {
+	var b strings.Builder
+	w := quotedprintable.NewWriter(&b)
+	_, _ = w.Write([]byte(s))
+	_ = w.Close()
+	return b.String()
+}
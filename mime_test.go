@@ -0,0 +1,727 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// mustBuildRaw renders msg with buildRawMessage, failing the test on error.
+func mustBuildRaw(t *testing.T, msg *Message, withBcc bool) string {
+	t.Helper()
+	raw, err := buildRawMessage(msg, withBcc)
+	if err != nil {
+		t.Fatalf("buildRawMessage: %v", err)
+	}
+	return string(raw)
+}
+
+func TestBuildRawMessageLineEndings(t *testing.T) {
+	body := "unix\nwindows\r\nmac\rend"
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: body}
+	raw := mustBuildRaw(t, msg, false)
+	if !strings.HasSuffix(raw, "\r\n\r\nunix\r\nwindows\r\nmac\r\nend") {
+		t.Errorf("body not normalized to CRLF: %q", raw)
+	}
+	if strings.Contains(strings.ReplaceAll(raw, "\r\n", ""), "\n") || strings.Contains(strings.ReplaceAll(raw, "\r\n", ""), "\r") {
+		t.Errorf("bare line ending in %q", raw)
+	}
+
+	msg.MIMELayout.PreserveLineEndings = true
+	if raw := mustBuildRaw(t, msg, false); !strings.HasSuffix(raw, "\r\n\r\n"+body) {
+		t.Errorf("line endings not preserved: %q", raw)
+	}
+}
+
+func TestBuildRawMessageBcc(t *testing.T) {
+	msg := &Message{
+		From:    "sender@example.com",
+		To:      []string{"to@example.com"},
+		Bcc:     []string{"hidden@example.com"},
+		Subject: "Subject",
+		Body:    "Body",
+	}
+
+	if raw := mustBuildRaw(t, msg, true); !strings.Contains(raw, "Bcc: hidden@example.com\r\n") {
+		t.Errorf("API raw message lacks Bcc header:\n%s", raw)
+	}
+	if raw := mustBuildRaw(t, msg, false); strings.Contains(raw, "hidden@example.com") {
+		t.Errorf("SMTP raw message discloses Bcc recipient:\n%s", raw)
+	}
+}
+
+func TestBuildRawMessageUndisclosedRecipients(t *testing.T) {
+	msg := &Message{From: "news@example.com", Bcc: []string{"a@example.com", "b@example.com"}, Subject: "Announcement", Body: "Hi all"}
+	for _, withBcc := range []bool{true, false} {
+		raw := mustBuildRaw(t, msg, withBcc)
+		m, err := mail.ReadMessage(strings.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Header.Get("To"); got != "undisclosed-recipients:;" {
+			t.Errorf("withBcc=%v: To = %q", withBcc, got)
+		}
+		if list, err := m.Header.AddressList("To"); err != nil || len(list) != 0 {
+			t.Errorf("withBcc=%v: To parses as %v, %v; want an empty group", withBcc, list, err)
+		}
+	}
+
+	msg.Cc = []string{"team@example.com"}
+	if raw := mustBuildRaw(t, msg, false); strings.Contains(raw, "\r\nTo:") || strings.HasPrefix(raw, "To:") {
+		t.Errorf("message with Cc recipients has a To header:\n%s", raw)
+	}
+}
+
+func TestBuildRawMessageHeaders(t *testing.T) {
+	msg := &Message{
+		From:    "sender@example.com",
+		To:      []string{"to@example.com"},
+		Subject: "Subject",
+		Body:    "Body",
+		Headers: map[string]string{
+			"X-Campaign-ID":  "spring-2024",
+			"Auto-Submitted": "auto-generated",
+			"X-Note":         "Grüße",
+		},
+	}
+	raw := mustBuildRaw(t, msg, true)
+	for _, want := range []string{
+		"X-Campaign-ID: spring-2024\r\n",
+		"Auto-Submitted: auto-generated\r\n",
+		"X-Note: =?utf-8?q?Gr=C3=BC=C3=9Fe?=\r\n",
+	} {
+		if !strings.Contains(raw, want) {
+			t.Errorf("raw message lacks %q:\n%s", want, raw)
+		}
+	}
+}
+
+func TestValidateHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		wantErr bool
+	}{
+		{"custom", map[string]string{"X-Campaign-ID": "1", "Auto-Submitted": "auto-replied"}, false},
+		{"reserved", map[string]string{"subject": "override"}, true},
+		{"injection", map[string]string{"X-Tag": "a\r\nBcc: victim@example.com"}, true},
+		{"bad name", map[string]string{"X Tag": "a"}, true},
+		{"empty name", map[string]string{"": "a"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b", Headers: tt.headers}
+			if err := msg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildRawMessageInline(t *testing.T) {
+	logo := Attachment{Filename: "logo.png", Content: []byte("png"), Inline: true, ContentID: "logo"}
+	report := Attachment{Filename: "report.pdf", Content: []byte("pdf")}
+	base := Message{
+		From:    "sender@example.com",
+		To:      []string{"to@example.com"},
+		Subject: "Subject",
+		Body:    `<img src="cid:logo">`,
+		HTML:    true,
+	}
+
+	t.Run("inline only", func(t *testing.T) {
+		msg := base
+		msg.Attachments = []Attachment{logo}
+		raw := mustBuildRaw(t, &msg, true)
+		if !strings.Contains(raw, "Content-Type: multipart/related; type=\"text/html\"; boundary=") {
+			t.Errorf("top level is not multipart/related:\n%s", raw)
+		}
+		if strings.Contains(raw, "multipart/mixed") {
+			t.Errorf("unexpected multipart/mixed:\n%s", raw)
+		}
+		if !strings.Contains(raw, "Content-ID: <logo>\r\n") || !strings.Contains(raw, "Content-Disposition: inline;") {
+			t.Errorf("inline part headers missing:\n%s", raw)
+		}
+	})
+
+	t.Run("inline and regular", func(t *testing.T) {
+		msg := base
+		msg.Attachments = []Attachment{report, logo}
+		raw := mustBuildRaw(t, &msg, true)
+		mixed := strings.Index(raw, "multipart/mixed")
+		related := strings.Index(raw, "multipart/related")
+		pdf := strings.Index(raw, `filename="report.pdf"`)
+		png := strings.Index(raw, `filename="logo.png"`)
+		if mixed < 0 || related < mixed || png < related || pdf < png {
+			t.Errorf("want mixed{related{html, logo}, report}:\n%s", raw)
+		}
+	})
+}
+
+func TestBuildRawMessageTextAlternative(t *testing.T) {
+	logo := Attachment{Filename: "logo.png", Content: []byte("png"), Inline: true, ContentID: "logo"}
+	report := Attachment{Filename: "report.pdf", Content: []byte("pdf")}
+	tests := []struct {
+		name        string
+		html        bool
+		attachments []Attachment
+		want        string
+	}{
+		{"alternative", true, nil, "alternative{plain,html}"},
+		{"with inline", true, []Attachment{logo}, "alternative{plain,related{html,png}}"},
+		{"with regular", true, []Attachment{report}, "mixed{alternative{plain,html},pdf}"},
+		{"with both", true, []Attachment{report, logo}, "mixed{alternative{plain,related{html,png}},pdf}"},
+		{"plain body", false, nil, "plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s",
+				Body: "<p>Hello</p>", HTML: tt.html, TextBody: "Hello", Attachments: tt.attachments}
+			parsed, err := mail.ReadMessage(strings.NewReader(mustBuildRaw(t, msg, true)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := mimeStructure(t, parsed.Header.Get("Content-Type"), parsed.Body); got != tt.want {
+				t.Errorf("structure = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildRawMessageLayout(t *testing.T) {
+	logo := Attachment{Filename: "logo.png", Content: []byte("png"), Inline: true, ContentID: "logo"}
+	report := Attachment{Filename: "report.pdf", Content: []byte("pdf")}
+	tests := []struct {
+		name        string
+		layout      MIMELayout
+		text        string
+		attachments []Attachment
+		want        string
+	}{
+		{"always mixed", MIMELayout{AlwaysMixed: true}, "", nil, "mixed{html}"},
+		{"always mixed alternative", MIMELayout{AlwaysMixed: true}, "Hello", nil, "mixed{alternative{plain,html}}"},
+		{"related outside", MIMELayout{RelatedOutside: true}, "Hello", []Attachment{logo}, "related{alternative{plain,html},png}"},
+		{"related outside mixed", MIMELayout{RelatedOutside: true}, "Hello", []Attachment{report, logo},
+			"mixed{related{alternative{plain,html},png},pdf}"},
+		{"related outside without text", MIMELayout{RelatedOutside: true}, "", []Attachment{logo}, "related{html,png}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s",
+				Body: "<p>Hello</p>", HTML: true, TextBody: tt.text, Attachments: tt.attachments, MIMELayout: tt.layout}
+			parsed, err := mail.ReadMessage(strings.NewReader(mustBuildRaw(t, msg, true)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := mimeStructure(t, parsed.Header.Get("Content-Type"), parsed.Body); got != tt.want {
+				t.Errorf("structure = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// mimeStructure summarizes a MIME entity's tree as "mixed{plain,pdf}".
+func mimeStructure(t *testing.T, contentType string, body io.Reader) string {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatalf("Content-Type %q: %v", contentType, err)
+	}
+	_, sub, _ := strings.Cut(mediaType, "/")
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return sub
+	}
+	var parts []string
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, mimeStructure(t, p.Header.Get("Content-Type"), p))
+	}
+	return sub + "{" + strings.Join(parts, ",") + "}"
+}
+
+func TestWriteMessageStreamedAttachment(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	inMemory := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+		Attachments: []Attachment{{Filename: "data.txt", Content: []byte(content)}}}
+	streamed := *inMemory
+	opens := 0
+	streamed.Attachments = []Attachment{{Filename: "data.txt", Open: func() (io.ReadCloser, error) {
+		opens++
+		return io.NopCloser(strings.NewReader(content)), nil
+	}}}
+
+	want, err := renderMessage(inMemory, rawOptions{boundary: "b1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := writeMessage(&got, &streamed, rawOptions{boundary: "b1"}); err != nil {
+		t.Fatalf("writeMessage: %v", err)
+	}
+	// Header order is not stable; compare the bodies.
+	_, gotBody, _ := strings.Cut(got.String(), "\r\n\r\n")
+	_, wantBody, _ := strings.Cut(string(want), "\r\n\r\n")
+	if gotBody != wantBody {
+		t.Errorf("streamed rendering differs from in-memory rendering:\n%s\nwant:\n%s", gotBody, wantBody)
+	}
+	if opens != 1 {
+		t.Errorf("Open called %d times, want 1", opens)
+	}
+	for _, line := range strings.Split(got.String(), "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("line longer than 76 characters: %q", line)
+		}
+	}
+
+	failing := *inMemory
+	failing.Attachments = []Attachment{{Filename: "gone.txt", Open: func() (io.ReadCloser, error) {
+		return nil, os.ErrNotExist
+	}}}
+	if err := writeMessage(io.Discard, &failing, rawOptions{}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("writeMessage() error = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestBuildRawMessageLongLines(t *testing.T) {
+	minified := "<html><body>" + strings.Repeat(`<td class="x">cell</td>`, 100) + "</body></html>"
+	tests := []struct {
+		name    string
+		body    string
+		wantCTE string
+	}{
+		{"short lines", "line one\nline two\n", ""},
+		{"998 bytes", strings.Repeat("a", 998) + "\r\n" + strings.Repeat("b", 998), ""},
+		{"999 bytes", strings.Repeat("a", 999), "quoted-printable"},
+		{"long last line", "hi\n" + minified, "quoted-printable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: tt.body, HTML: true}
+			raw := mustBuildRaw(t, msg, false)
+			for i, line := range strings.Split(raw, "\r\n") {
+				if len(line) > 998 {
+					t.Fatalf("line %d is %d bytes long", i+1, len(line))
+				}
+			}
+			m, err := mail.ReadMessage(strings.NewReader(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Header.Get("Content-Transfer-Encoding"); got != tt.wantCTE {
+				t.Fatalf("Content-Transfer-Encoding = %q, want %q", got, tt.wantCTE)
+			}
+			var r io.Reader = m.Body
+			if tt.wantCTE == "quoted-printable" {
+				r = quotedprintable.NewReader(m.Body)
+			}
+			got, _ := io.ReadAll(r)
+			if want := strings.ReplaceAll(strings.ReplaceAll(tt.body, "\r\n", "\n"), "\n", "\r\n"); tt.wantCTE != "" && string(got) != want {
+				t.Errorf("decoded body = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestBuildMIME(t *testing.T) {
+	msg := &Message{From: "Zoë <zoe@example.com>", To: []string{"b@example.com"}, Bcc: []string{"archive@example.com"},
+		Subject: "Relatório", Body: "<p>Olá</p>", HTML: true, TextBody: "Olá",
+		Headers:     map[string]string{"Date": "Mon, 02 Mar 2026 10:00:00 +0000"},
+		Attachments: []Attachment{{Filename: "a.txt", Content: []byte("x")}}}
+	raw, err := BuildMIME(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "archive@example.com") {
+		t.Error("BuildMIME() disclosed the Bcc recipient")
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mimeStructure(t, m.Header.Get("Content-Type"), m.Body); got != "mixed{alternative{plain,html},plain}" {
+		t.Errorf("structure = %s", got)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject")); subject != "Relatório" || m.Header.Get("Date") == "" {
+		t.Errorf("Subject = %q, Date = %q", subject, m.Header.Get("Date"))
+	}
+
+	// Fixed boundaries make output reproducible; options reach the renderer.
+	opts := MIMEOptions{Bcc: true, SevenBit: true, Boundary: "fixed"}
+	var a, b bytes.Buffer
+	if err := WriteMIME(&a, msg, opts); err != nil {
+		t.Fatal(err)
+	}
+	WriteMIME(&b, msg, opts)
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Error("WriteMIME() with a fixed boundary is not reproducible")
+	}
+	for _, want := range []string{"Bcc: archive@example.com\r\n", "boundary=fixed", "Content-Transfer-Encoding: quoted-printable"} {
+		if !strings.Contains(a.String(), want) {
+			t.Errorf("WriteMIME() output lacks %q", want)
+		}
+	}
+	for i := 0; i < a.Len(); i++ {
+		if a.Bytes()[i] >= 0x80 {
+			t.Fatalf("SevenBit output has a non-ASCII byte at %d", i)
+		}
+	}
+
+	msg.Headers = map[string]string{"X-Bad": "a\r\nBcc: victim@example.com"}
+	if _, err := BuildMIME(msg); err == nil {
+		t.Error("BuildMIME() accepted a header with a line break")
+	}
+}
+
+func TestLineWrapper(t *testing.T) {
+	var b strings.Builder
+	w := &lineWrapper{w: &b, width: 4}
+	for _, chunk := range []string{"ab", "cdefg", "hijklmnop"} {
+		io.WriteString(w, chunk)
+	}
+	if want := "abcd\r\nefgh\r\nijkl\r\nmnop\r\n"; b.String() != want {
+		t.Errorf("wrapped = %q, want %q", b.String(), want)
+	}
+}
+
+func TestAttachmentEncoding(t *testing.T) {
+	long := strings.Repeat("x", 1000)
+	tests := []struct {
+		name     string
+		encoding TransferEncoding
+		mimeType string
+		content  string
+		wantCTE  string
+		wantBody string // decoded, with line breaks as sent
+		wantErr  bool
+	}{
+		{"default", "", "text/plain", "a\nb", "base64", "a\nb", false},
+		{"7bit", Encoding7Bit, "text/csv", "a,b\n1,2\n", "7bit", "a,b\r\n1,2\r\n", false},
+		{"7bit non-ascii", Encoding7Bit, "text/plain", "café", "", "", true},
+		{"7bit long line", Encoding7Bit, "text/plain", long, "", "", true},
+		{"quoted-printable", EncodingQuotedPrintable, "text/plain", "café\nthé", "quoted-printable", "café\r\nthé", false},
+		{"auto ascii", EncodingAuto, "text/plain", "hello\n", "7bit", "hello\r\n", false},
+		{"auto long line", EncodingAuto, "text/plain", long, "quoted-printable", long, false},
+		{"auto accented", EncodingAuto, "text/plain", "Crème brûlée for dessert, then coffee on the terrace", "quoted-printable", "Crème brûlée for dessert, then coffee on the terrace", false},
+		{"auto mostly non-ascii", EncodingAuto, "text/plain", "日本語のテキスト", "base64", "日本語のテキスト", false},
+		{"auto binary", EncodingAuto, "application/pdf", "%PDF-1.7", "base64", "%PDF-1.7", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+				Attachments: []Attachment{{Filename: "f", MimeType: tt.mimeType, Content: []byte(tt.content), Encoding: tt.encoding}}}
+			raw, err := buildRawMessage(msg, false)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := mail.ReadMessage(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, params, _ := mime.ParseMediaType(m.Header.Get("Content-Type"))
+			mr := multipart.NewReader(m.Body, params["boundary"])
+			if _, err := mr.NextRawPart(); err != nil { // body
+				t.Fatal(err)
+			}
+			p, err := mr.NextRawPart()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cte := p.Header.Get("Content-Transfer-Encoding")
+			if cte != tt.wantCTE {
+				t.Fatalf("Content-Transfer-Encoding = %q, want %q", cte, tt.wantCTE)
+			}
+			var r io.Reader = p
+			switch cte {
+			case "base64":
+				r = base64.NewDecoder(base64.StdEncoding, p)
+			case "quoted-printable":
+				r = quotedprintable.NewReader(p)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.wantBody {
+				t.Errorf("content = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+
+	bad := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+		Attachments: []Attachment{{Filename: "f", Content: []byte("x"), Encoding: "8bit"}}}
+	if err := bad.Validate(); err == nil {
+		t.Error("Validate() accepted an unknown encoding")
+	}
+}
+
+func TestAttachmentFilenameEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		want     string // expected Content-Disposition parameter text
+	}{
+		{"ascii", "report.pdf", `filename="report.pdf"`},
+		{"quoted", `say "hi".txt`, `filename="say \"hi\".txt"`},
+		{"accented", "Rechnung_März.pdf", `filename*=UTF-8''Rechnung_M%C3%A4rz.pdf`},
+		{"cjk", "報告書.pdf", `filename*=UTF-8''%E5%A0%B1%E5%91%8A%E6%9B%B8.pdf`},
+		{"long cjk", strings.Repeat("日本語", 10) + ".docx", "filename*0*=UTF-8''"},
+		{"control", "a\r\nBcc: x.txt", `filename*=UTF-8''a%0D%0ABcc%3A%20x.txt`},
+		{"emoji", "Übersicht 📎.xlsx", `filename*=UTF-8''%C3%9Cbersicht%20%F0%9F%93%8E.xlsx`},
+		{"long emoji", "Fotos " + strings.Repeat("🎉", 12) + ".zip", "filename*0*=UTF-8''"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+				Attachments: []Attachment{{Filename: tt.filename, Content: []byte("x")}}}
+			raw := mustBuildRaw(t, msg, false)
+			if !strings.Contains(raw, tt.want) {
+				t.Errorf("missing %q:\n%s", tt.want, raw)
+			}
+			for _, line := range strings.Split(raw, "\r\n") {
+				if strings.Contains(line, "*=") && len(line) > 76 {
+					t.Errorf("parameter line longer than 76 characters: %q", line)
+				}
+				// Some clients decode each continuation on its own.
+				if _, v, ok := strings.Cut(line, "*="); ok {
+					v, _ = strings.CutSuffix(strings.TrimPrefix(v, "UTF-8''"), ";")
+					if dec, err := url.PathUnescape(v); err != nil || !utf8.ValidString(dec) {
+						t.Errorf("continuation %q does not decode to whole characters", line)
+					}
+				}
+			}
+
+			// Mail readers must recover the original name.
+			r, err := mail.ReadMessage(strings.NewReader(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			mr := multipart.NewReader(r.Body, params["boundary"])
+			part, err := mr.NextPart()
+			for err == nil && part.Header.Get("Content-Disposition") == "" {
+				part, err = mr.NextPart()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := part.FileName(); got != tt.filename {
+				t.Errorf("FileName() = %q, want %q", got, tt.filename)
+			}
+			if _, ctParams, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); ctParams["name"] != tt.filename {
+				t.Errorf("Content-Type name = %q, want %q", ctParams["name"], tt.filename)
+			}
+		})
+	}
+}
+
+func TestEncodedWordHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject string
+		from    string
+		to      []string
+		cc      []string
+		want    []string // substrings of the raw header block
+	}{
+		{
+			name:    "ascii untouched",
+			subject: "Monthly report",
+			from:    "Sender <a@example.com>",
+			to:      []string{"b@example.com"},
+			want:    []string{"Subject: Monthly report\r\n", "From: Sender <a@example.com>\r\n"},
+		},
+		{
+			name:    "accented",
+			subject: "Rechnung für März",
+			from:    `"Jörg Müller" <jorg@example.com>`,
+			to:      []string{"Zoë <zoe@example.com>", "plain@example.com"},
+			want:    []string{"Subject: =?utf-8?q?Rechnung_f=C3=BCr_M=C3=A4rz?=", "From: =?utf-8?q?J=C3=B6rg_M=C3=BCller?= <jorg@example.com>"},
+		},
+		{
+			name:    "cjk and emoji",
+			subject: "会議の議事録 🎉",
+			from:    "山田太郎 <yamada@example.jp>",
+			to:      []string{"b@example.com"},
+			cc:      []string{"😀 <smile@example.com>"},
+			want:    []string{"Subject: =?utf-8?b?", "From: =?utf-8?b?5bGx55Sw5aSq6YOO?= <yamada@example.jp>"},
+		},
+		{
+			name:    "long emoji subject",
+			subject: "Sale 🔥 " + strings.Repeat("🛍️🎁", 10) + " ends tonight 👩‍👩‍👧",
+			from:    "🦄 Shop <shop@example.com>",
+			to:      []string{"b@example.com"},
+			want:    []string{"Subject: =?utf-8?b?", "?=\r\n =?utf-8?b?"},
+		},
+		{
+			name:    "long subject folds",
+			subject: strings.Repeat("Überweisung ", 12),
+			from:    "a@example.com",
+			to:      []string{"b@example.com"},
+			want:    []string{"?=\r\n =?utf-8?q?"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &Message{From: tt.from, To: tt.to, Cc: tt.cc, Subject: tt.subject, Body: "b"}
+			raw := mustBuildRaw(t, msg, false)
+			header, _, _ := strings.Cut(raw, "\r\n\r\n")
+			header += "\r\n" // header order is random; terminate the last line too
+			if !isASCII(header) {
+				t.Errorf("header block is not ASCII:\n%s", header)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(header, w) {
+					t.Errorf("header block lacks %q:\n%s", w, header)
+				}
+			}
+
+			// Mail readers must recover the original values.
+			r, err := mail.ReadMessage(strings.NewReader(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dec := new(mime.WordDecoder)
+			for _, word := range strings.Fields(r.Header.Get("Subject")) {
+				if d, err := dec.Decode(word); strings.HasPrefix(word, "=?") && (err != nil || !utf8.ValidString(d)) {
+					t.Errorf("encoded-word %q splits a character", word)
+				}
+			}
+			subject, err := dec.DecodeHeader(r.Header.Get("Subject"))
+			if err != nil || subject != tt.subject {
+				t.Errorf("decoded Subject = %q (%v), want %q", subject, err, tt.subject)
+			}
+			for field, addrs := range map[string][]string{"From": {tt.from}, "To": tt.to, "Cc": tt.cc} {
+				if len(addrs) == 0 {
+					continue
+				}
+				got, err := r.Header.AddressList(field)
+				if err != nil {
+					t.Fatalf("%s: %v", field, err)
+				}
+				for i, a := range addrs {
+					want, _ := mail.ParseAddress(a)
+					if got[i].Name != want.Name || got[i].Address != want.Address {
+						t.Errorf("%s[%d] = %+v, want %+v", field, i, got[i], want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBuildRawMessageSensitivity(t *testing.T) {
+	tests := []struct {
+		sensitivity Sensitivity
+		headers     map[string]string
+		want        string
+	}{
+		{"", nil, ""},
+		{"", map[string]string{"Sensitivity": "Private"}, "Private"},
+		{SensitivityPersonal, nil, "Personal"},
+		{SensitivityPrivate, nil, "Private"},
+		{SensitivityConfidential, map[string]string{"sensitivity": "Personal"}, "Company-Confidential"},
+	}
+	for _, tt := range tests {
+		msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+			Sensitivity: tt.sensitivity, Headers: tt.headers}
+		r, err := mail.ReadMessage(strings.NewReader(mustBuildRaw(t, msg, false)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Header["Sensitivity"]; len(got) > 1 || r.Header.Get("Sensitivity") != tt.want {
+			t.Errorf("sensitivity %q: Sensitivity = %q, want %q", tt.sensitivity, got, tt.want)
+		}
+	}
+	if err := (&Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+		Sensitivity: "secret"}).Validate(); err == nil {
+		t.Error("Validate() accepted an unknown sensitivity")
+	}
+}
+
+func TestBuildRawMessageLanguage(t *testing.T) {
+	tests := []struct {
+		language string
+		headers  map[string]string
+		want     string
+	}{
+		{"", nil, ""},
+		{"", map[string]string{"Content-Language": "fr"}, "fr"},
+		{"pt-BR", nil, "pt-BR"},
+		{"de", map[string]string{"content-language": "en", "Accept-Language": "en"}, "de"},
+	}
+	for _, tt := range tests {
+		msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+			Language: tt.language, Headers: tt.headers}
+		r, err := mail.ReadMessage(strings.NewReader(mustBuildRaw(t, msg, false)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Header["Content-Language"]; len(got) > 1 || r.Header.Get("Content-Language") != tt.want {
+			t.Errorf("language %q: Content-Language = %q, want %q", tt.language, got, tt.want)
+		}
+		if tt.language != "" && r.Header.Get("Accept-Language") != tt.want {
+			t.Errorf("language %q: Accept-Language = %q", tt.language, r.Header.Get("Accept-Language"))
+		}
+	}
+	for _, bad := range []string{"english", "de,en", "x"} {
+		if err := (&Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+			Language: bad}).Validate(); err == nil {
+			t.Errorf("Validate() accepted language %q", bad)
+		}
+	}
+}
+
+func TestBuildRawMessagePriority(t *testing.T) {
+	tests := []struct {
+		priority   Priority
+		headers    map[string]string
+		xPriority  string
+		importance string
+	}{
+		{"", nil, "", ""},
+		{"", map[string]string{"X-Priority": "2"}, "2", ""},
+		{PriorityHigh, nil, "1 (Highest)", "high"},
+		{PriorityNormal, nil, "3 (Normal)", "normal"},
+		{PriorityLow, map[string]string{"x-priority": "1", "Importance": "high"}, "5 (Lowest)", "low"},
+	}
+	for _, tt := range tests {
+		msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+			Priority: tt.priority, Headers: tt.headers}
+		r, err := mail.ReadMessage(strings.NewReader(mustBuildRaw(t, msg, false)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Header["X-Priority"]; len(got) > 1 || r.Header.Get("X-Priority") != tt.xPriority {
+			t.Errorf("priority %q: X-Priority = %q, want %q", tt.priority, got, tt.xPriority)
+		}
+		if got := r.Header.Get("Importance"); got != tt.importance {
+			t.Errorf("priority %q: Importance = %q, want %q", tt.priority, got, tt.importance)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// mxcheck.go - Strict message validation: on top of Validate's syntax
+// checks, ValidateStrict asks DNS whether each recipient domain accepts mail
+// at all, so addresses that can only bounce are caught before a send spends
+// provider quota and sender reputation on them.
+package email
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+)
+
+// ValidateStrict validates m like Validate, then looks up the mail exchangers
+// of every recipient domain. A domain that does not exist, or publishes a
+// null MX (RFC 7505) declaring that it accepts no mail, makes its recipients
+// undeliverable; they are reported in a *RecipientRejectedError with the
+// reasons "no such domain" and "null MX". Lookups that fail for any other
+// reason (timeouts, SERVFAIL) are not held against the address: only
+// definite answers reject.
+//
+// Example:
+//
+//	if err := msg.ValidateStrict(ctx); errors.Is(err, email.ErrRecipientRejected) {
+//	    return fmt.Errorf("check the addresses: %w", err)
+//	}
+func (m *Message) ValidateStrict(ctx context.Context) error {
+	return defaultDomainChecker.validate(ctx, m)
+}
+
+// domainChecker looks up whether recipient domains accept mail.
+type domainChecker struct {
+	// lookupMX and lookupHost are replaced in tests.
+	lookupMX   func(ctx context.Context, domain string) ([]*net.MX, error)
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+}
+
+var defaultDomainChecker = &domainChecker{
+	lookupMX:   net.DefaultResolver.LookupMX,
+	lookupHost: net.DefaultResolver.LookupHost,
+}
+
+// validate implements ValidateStrict.
+func (d *domainChecker) validate(ctx context.Context, m *Message) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	byDomain := make(map[string][]string)
+	for _, r := range messageRecipients(m) {
+		addr := strings.ToLower(parseAddr(r))
+		if i := strings.LastIndexByte(addr, '@'); i >= 0 {
+			domain := asciiDomain(addr[i+1:])
+			byDomain[domain] = append(byDomain[domain], addr)
+		}
+	}
+	domains := make([]string, 0, len(byDomain))
+	for domain := range byDomain {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	var issues []RecipientIssue
+	for _, domain := range domains {
+		reason, err := d.check(ctx, domain)
+		if err != nil {
+			return err
+		}
+		if reason == "" {
+			continue
+		}
+		for _, addr := range byDomain[domain] {
+			issues = append(issues, RecipientIssue{Address: addr, Reason: reason})
+		}
+	}
+	if len(issues) > 0 {
+		return &RecipientRejectedError{Issues: issues}
+	}
+	return nil
+}
+
+// check returns why domain cannot receive mail, or "" if it may. Only a
+// cancelled ctx is an error.
+func (d *domainChecker) check(ctx context.Context, domain string) (string, error) {
+	mxs, err := d.lookupMX(ctx, domain)
+	if err == nil {
+		if len(mxs) == 1 && (mxs[0].Host == "." || mxs[0].Host == "") {
+			return "null MX", nil
+		}
+		return "", nil
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		return "", nil
+	}
+	// Without MX records mail goes to the domain's own address (RFC 5321
+	// §5.1); only a domain with neither is a definite dead end.
+	if _, err := d.lookupHost(ctx, domain); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return "no such domain", nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,72 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestValidateStrict(t *testing.T) {
+	notFound := func(name string) error { return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true} }
+	d := &domainChecker{
+		lookupMX: func(_ context.Context, domain string) ([]*net.MX, error) {
+			switch domain {
+			case "example.com":
+				return []*net.MX{{Host: "mx.example.com.", Pref: 10}}, nil
+			case "nomail.example":
+				return []*net.MX{{Host: ".", Pref: 0}}, nil
+			case "flaky.example":
+				return nil, &net.DNSError{Err: "server misbehaving", Name: domain, IsTemporary: true}
+			}
+			return nil, notFound(domain)
+		},
+		lookupHost: func(_ context.Context, host string) ([]string, error) {
+			if host == "a-only.example" {
+				return []string{"192.0.2.1"}, nil
+			}
+			return nil, notFound(host)
+		},
+	}
+
+	tests := []struct {
+		name string
+		to   []string
+		want []RecipientIssue
+	}{
+		{"deliverable", []string{"a@example.com", "b@a-only.example", "c@flaky.example"}, nil},
+		{"undeliverable", []string{"a@example.com", "Typo <x@gmial.invalid>", "y@nomail.example", "z@GMIAL.invalid"}, []RecipientIssue{
+			{Address: "x@gmial.invalid", Reason: "no such domain"},
+			{Address: "z@gmial.invalid", Reason: "no such domain"},
+			{Address: "y@nomail.example", Reason: "null MX"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &Message{From: "me@example.com", To: tt.to, Subject: "s", Body: "b"}
+			err := d.validate(context.Background(), msg)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("validate() = %v", err)
+				}
+				return
+			}
+			var rejected *RecipientRejectedError
+			if !errors.As(err, &rejected) || !errors.Is(err, ErrRecipientRejected) {
+				t.Fatalf("validate() = %v, want *RecipientRejectedError", err)
+			}
+			if len(rejected.Issues) != len(tt.want) {
+				t.Fatalf("issues = %v, want %v", rejected.Issues, tt.want)
+			}
+			for i := range tt.want {
+				if rejected.Issues[i] != tt.want[i] {
+					t.Errorf("issue %d = %v, want %v", i, rejected.Issues[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	if err := d.validate(context.Background(), &Message{From: "me@example.com", To: []string{"not an address"}, Subject: "s", Body: "b"}); err == nil || errors.Is(err, ErrRecipientRejected) {
+		t.Errorf("syntax error = %v, want Validate's error", err)
+	}
+}
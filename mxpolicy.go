@@ -0,0 +1,504 @@
+// mxpolicy.go - Transport security policy for delivering directly to a
+// recipient domain's MX hosts. Port 25 TLS is opportunistic by default and so
+// open to downgrade; two mechanisms let a domain demand better:
+//
+//   - MTA-STS (RFC 8461): an HTTPS-published policy listing the permitted MX
+//     hosts and requiring WebPKI-valid TLS to them.
+//   - DANE (RFC 7672): DNSSEC-signed TLSA records pinning the MX host's
+//     certificate or trust anchor.
+//
+// mxPolicyResolver looks both up and produces an mxTLSPolicy that smtpSend
+// enforces. DANE takes precedence when both are published (RFC 8461 §2).
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// MTA-STS policy modes.
+const (
+	mtaSTSEnforce = "enforce"
+	mtaSTSTesting = "testing"
+	mtaSTSNone    = "none"
+)
+
+// mtaSTSPolicy is a parsed MTA-STS policy file.
+type mtaSTSPolicy struct {
+	id     string
+	mode   string
+	mx     []string
+	maxAge time.Duration
+}
+
+// parseMTASTSPolicy parses a policy file ("key: value" lines).
+func parseMTASTSPolicy(body []byte) (*mtaSTSPolicy, error) {
+	p := &mtaSTSPolicy{}
+	var version string
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "version":
+			version = value
+		case "mode":
+			p.mode = value
+		case "mx":
+			p.mx = append(p.mx, strings.ToLower(value))
+		case "max_age":
+			secs, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || secs < 0 {
+				return nil, fmt.Errorf("mta-sts: invalid max_age %q", value)
+			}
+			p.maxAge = time.Duration(secs) * time.Second
+		}
+	}
+	if version != "STSv1" {
+		return nil, fmt.Errorf("mta-sts: unsupported version %q", version)
+	}
+	switch p.mode {
+	case mtaSTSEnforce, mtaSTSTesting, mtaSTSNone:
+	default:
+		return nil, fmt.Errorf("mta-sts: invalid mode %q", p.mode)
+	}
+	if p.mode != mtaSTSNone && len(p.mx) == 0 {
+		return nil, fmt.Errorf("mta-sts: policy lists no mx")
+	}
+	return p, nil
+}
+
+// matchesMX reports whether host is a permitted MX. A "*." pattern matches
+// exactly one leftmost label.
+func (p *mtaSTSPolicy) matchesMX(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pat := range p.mx {
+		if rest, ok := strings.CutPrefix(pat, "*."); ok {
+			if i := strings.IndexByte(host, '.'); i > 0 && host[i+1:] == rest {
+				return true
+			}
+		} else if host == pat {
+			return true
+		}
+	}
+	return false
+}
+
+// mtaSTSMaxBody caps the policy file size.
+const mtaSTSMaxBody = 64 << 10
+
+// mtaSTSCache resolves and caches MTA-STS policies per domain. A cached,
+// unexpired policy survives a missing TXT record or a failed fetch, which is
+// what defeats an attacker stripping them.
+type mtaSTSCache struct {
+	mu      sync.Mutex
+	entries map[string]mtaSTSEntry
+
+	lookupTXT func(ctx context.Context, name string) ([]string, error)
+	fetch     func(ctx context.Context, domain string) ([]byte, error)
+	now       func() time.Time
+}
+
+type mtaSTSEntry struct {
+	policy  *mtaSTSPolicy
+	expires time.Time
+}
+
+// newMTASTSCache returns a cache that uses the system resolver and fetches
+// policies with client (http.DefaultClient if nil).
+func newMTASTSCache(client *http.Client) *mtaSTSCache {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &mtaSTSCache{
+		entries:   make(map[string]mtaSTSEntry),
+		lookupTXT: net.DefaultResolver.LookupTXT,
+		fetch:     func(ctx context.Context, domain string) ([]byte, error) { return fetchMTASTS(ctx, client, domain) },
+		now:       time.Now,
+	}
+}
+
+// policy returns the domain's MTA-STS policy, or nil if it has none.
+func (c *mtaSTSCache) policy(ctx context.Context, domain string) *mtaSTSPolicy {
+	domain = strings.ToLower(domain)
+	c.mu.Lock()
+	cached, hasCached := c.entries[domain]
+	c.mu.Unlock()
+	if hasCached && c.now().After(cached.expires) {
+		hasCached = false
+	}
+
+	id := ""
+	if txts, err := c.lookupTXT(ctx, "_mta-sts."+domain); err == nil {
+		for _, txt := range txts {
+			if strings.HasPrefix(txt, "v=STSv1") {
+				id = mtaSTSRecordID(txt)
+				break
+			}
+		}
+	}
+	switch {
+	case id == "" && hasCached:
+		return cached.policy
+	case id == "":
+		return nil
+	case hasCached && cached.policy.id == id:
+		return cached.policy
+	}
+
+	body, err := c.fetch(ctx, domain)
+	if err == nil {
+		var p *mtaSTSPolicy
+		if p, err = parseMTASTSPolicy(body); err == nil {
+			p.id = id
+			c.mu.Lock()
+			c.entries[domain] = mtaSTSEntry{policy: p, expires: c.now().Add(p.maxAge)}
+			c.mu.Unlock()
+			return p
+		}
+	}
+	if hasCached {
+		return cached.policy
+	}
+	return nil
+}
+
+// mtaSTSRecordID extracts the id field of a "v=STSv1; id=..." TXT record.
+func mtaSTSRecordID(txt string) string {
+	for _, field := range strings.Split(txt, ";") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(field), "="); ok && k == "id" {
+			return v
+		}
+	}
+	return ""
+}
+
+// fetchMTASTS downloads the policy file from the domain's policy host. The
+// HTTPS certificate is verified as usual and redirects are refused.
+func fetchMTASTS(ctx context.Context, client *http.Client, domain string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://mta-sts."+domain+"/.well-known/mta-sts.txt", nil)
+	if err != nil {
+		return nil, err
+	}
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := noRedirect.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("mta-sts: policy fetch for %s: %s", domain, resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		return nil, fmt.Errorf("mta-sts: policy for %s has content type %q", domain, ct)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, mtaSTSMaxBody))
+}
+
+// tlsaRecord is a DANE TLSA resource record (RFC 6698).
+type tlsaRecord struct {
+	usage, selector, matchingType uint8
+	data                          []byte
+}
+
+// TLSA certificate usages relevant to SMTP (RFC 7672 §3.1).
+const (
+	tlsaUsageDANETA = 2
+	tlsaUsageDANEEE = 3
+)
+
+// matches reports whether cert matches the record's selector and hash.
+func (r tlsaRecord) matches(cert *x509.Certificate) bool {
+	var content []byte
+	switch r.selector {
+	case 0:
+		content = cert.Raw
+	case 1:
+		content = cert.RawSubjectPublicKeyInfo
+	default:
+		return false
+	}
+	switch r.matchingType {
+	case 0:
+		return bytes.Equal(content, r.data)
+	case 1:
+		sum := sha256.Sum256(content)
+		return bytes.Equal(sum[:], r.data)
+	case 2:
+		sum := sha512.Sum512(content)
+		return bytes.Equal(sum[:], r.data)
+	}
+	return false
+}
+
+// usable reports whether SMTP DANE supports the record (PKIX usages 0 and 1
+// are not used for SMTP).
+func (r tlsaRecord) usable() bool {
+	return (r.usage == tlsaUsageDANETA || r.usage == tlsaUsageDANEEE) && r.selector <= 1 && r.matchingType <= 2
+}
+
+// daneVerify checks a presented chain against TLSA records: DANE-EE matches
+// the leaf alone (no name or expiry checks), DANE-TA matches a certificate in
+// the chain that the leaf chains to and requires the leaf to be valid for
+// host.
+func daneVerify(records []tlsaRecord, host string, chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return errors.New("dane: no certificate presented")
+	}
+	leaf := chain[0]
+	for _, r := range records {
+		if r.usage == tlsaUsageDANEEE && r.matches(leaf) {
+			return nil
+		}
+	}
+	for _, r := range records {
+		if r.usage != tlsaUsageDANETA {
+			continue
+		}
+		for _, ta := range chain[1:] {
+			if !r.matches(ta) {
+				continue
+			}
+			roots := x509.NewCertPool()
+			roots.AddCert(ta)
+			inter := x509.NewCertPool()
+			for _, c := range chain[1:] {
+				inter.AddCert(c)
+			}
+			if _, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots, Intermediates: inter}); err == nil {
+				return nil
+			}
+		}
+	}
+	return errors.New("dane: no TLSA record matches the presented certificate")
+}
+
+// typeTLSA is the TLSA resource record type.
+const typeTLSA dnsmessage.Type = 52
+
+// lookupTLSA queries server (host:port) for the TLSA records of
+// _port._tcp.host. secure reports whether the resolver validated the answer
+// with DNSSEC (the AD bit); only a validating resolver the host trusts, such
+// as a local one, should be used for DANE.
+func lookupTLSA(ctx context.Context, server, host string, port int) (records []tlsaRecord, secure bool, err error) {
+	qname := fmt.Sprintf("_%d._tcp.%s", port, strings.TrimSuffix(host, "."))
+	name, err := dnsmessage.NewName(qname + ".")
+	if err != nil {
+		return nil, false, fmt.Errorf("tlsa %s: %w", qname, err)
+	}
+	id := uint16(rand.Uint32())
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true, AuthenticData: true})
+	b.EnableCompression()
+	_ = b.StartQuestions()
+	_ = b.Question(dnsmessage.Question{Name: name, Type: typeTLSA, Class: dnsmessage.ClassINET})
+	_ = b.StartAdditionals()
+	var opt dnsmessage.ResourceHeader
+	_ = opt.SetEDNS0(4096, dnsmessage.RCodeSuccess, true)
+	_ = b.OPTResource(opt, dnsmessage.OPTResource{})
+	query, err := b.Finish()
+	if err != nil {
+		return nil, false, fmt.Errorf("tlsa %s: %w", qname, err)
+	}
+
+	resp, err := dnsExchange(ctx, server, query, id)
+	if err != nil {
+		return nil, false, fmt.Errorf("tlsa %s: %w", qname, err)
+	}
+
+	var p dnsmessage.Parser
+	h, err := p.Start(resp)
+	if err != nil {
+		return nil, false, fmt.Errorf("tlsa %s: %w", qname, err)
+	}
+	switch h.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, h.AuthenticData, nil
+	default:
+		return nil, false, fmt.Errorf("tlsa %s: %s", qname, h.RCode)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, false, fmt.Errorf("tlsa %s: %w", qname, err)
+	}
+	for {
+		rh, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("tlsa %s: %w", qname, err)
+		}
+		if rh.Type != typeTLSA {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, false, fmt.Errorf("tlsa %s: %w", qname, err)
+			}
+			continue
+		}
+		ur, err := p.UnknownResource()
+		if err != nil {
+			return nil, false, fmt.Errorf("tlsa %s: %w", qname, err)
+		}
+		if len(ur.Data) < 4 {
+			continue
+		}
+		records = append(records, tlsaRecord{
+			usage: ur.Data[0], selector: ur.Data[1], matchingType: ur.Data[2],
+			data: append([]byte(nil), ur.Data[3:]...),
+		})
+	}
+	return records, h.AuthenticData, nil
+}
+
+// dnsExchange sends a query over UDP, retrying over TCP if the answer was
+// truncated.
+func dnsExchange(ctx context.Context, server string, query []byte, id uint16) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	} else {
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		var h dnsmessage.Header
+		var p dnsmessage.Parser
+		if h, err = p.Start(buf[:n]); err != nil || h.ID != id || !h.Response {
+			continue // stray or malformed datagram
+		}
+		if !h.Truncated {
+			return buf[:n], nil
+		}
+		break
+	}
+
+	tc, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer tc.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		_ = tc.SetDeadline(dl)
+	} else {
+		_ = tc.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	if _, err := tc.Write(append(framed, query...)); err != nil {
+		return nil, err
+	}
+	var size [2]byte
+	if _, err := io.ReadFull(tc, size[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(tc, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// mxTLSPolicy is the transport security required for delivery to one MX
+// host.
+type mxTLSPolicy struct {
+	// source names the mechanism ("dane", "mta-sts") for error messages.
+	source string
+
+	// require refuses plaintext and unverifiable TLS.
+	require bool
+
+	// tlsa, when set, replaces WebPKI verification with DANE matching.
+	tlsa []tlsaRecord
+}
+
+// apply configures cfg to enforce the policy for host.
+func (p *mxTLSPolicy) apply(cfg *tls.Config, host string) {
+	if len(p.tlsa) > 0 {
+		records := p.tlsa
+		cfg.InsecureSkipVerify = true // replaced by DANE verification below
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return daneVerify(records, host, cs.PeerCertificates)
+		}
+		return
+	}
+	if p.require {
+		cfg.InsecureSkipVerify = false // MTA-STS: WebPKI-valid for the MX name
+	}
+}
+
+// mxPolicyResolver determines the mxTLSPolicy for a delivery.
+type mxPolicyResolver struct {
+	sts *mtaSTSCache
+
+	// dnsServer is the DNSSEC-validating resolver for TLSA lookups; empty
+	// disables DANE.
+	dnsServer string
+}
+
+// errMXNotPermitted is returned for MX hosts an enforced MTA-STS policy does
+// not list; delivery must try another MX or defer.
+var errMXNotPermitted = errors.New("mx host not permitted by MTA-STS policy")
+
+// resolve returns the policy for delivering mail for domain to mxHost, or nil
+// for plain opportunistic TLS. A TLSA lookup failure is returned as an error
+// (the delivery should be deferred rather than downgraded).
+func (r *mxPolicyResolver) resolve(ctx context.Context, domain, mxHost string) (*mxTLSPolicy, error) {
+	if r.dnsServer != "" {
+		records, secure, err := lookupTLSA(ctx, r.dnsServer, mxHost, 25)
+		if err != nil {
+			return nil, err
+		}
+		var usable []tlsaRecord
+		for _, rec := range records {
+			if rec.usable() {
+				usable = append(usable, rec)
+			}
+		}
+		if secure && len(records) > 0 {
+			// Published but unusable records still mandate TLS (RFC 7672 §2.2).
+			return &mxTLSPolicy{source: "dane", require: true, tlsa: usable}, nil
+		}
+	}
+
+	if r.sts != nil {
+		if p := r.sts.policy(ctx, domain); p != nil && p.mode == mtaSTSEnforce {
+			if !p.matchesMX(mxHost) {
+				return nil, fmt.Errorf("%s: %w", mxHost, errMXNotPermitted)
+			}
+			return &mxTLSPolicy{source: "mta-sts", require: true}, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,295 @@
+package email
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseMTASTSPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+		mode    string
+		mx      int
+	}{
+		{"enforce", "version: STSv1\nmode: enforce\nmx: mx1.example.com\nmx: *.example.net\nmax_age: 86400\n", false, mtaSTSEnforce, 2},
+		{"crlf", "version: STSv1\r\nmode: testing\r\nmx: mx.example.com\r\nmax_age: 600\r\n", false, mtaSTSTesting, 1},
+		{"none without mx", "version: STSv1\nmode: none\nmax_age: 600\n", false, mtaSTSNone, 0},
+		{"bad version", "version: STSv2\nmode: enforce\nmx: mx.example.com\nmax_age: 1\n", true, "", 0},
+		{"bad mode", "version: STSv1\nmode: strict\nmx: mx.example.com\nmax_age: 1\n", true, "", 0},
+		{"no mx", "version: STSv1\nmode: enforce\nmax_age: 1\n", true, "", 0},
+		{"bad max_age", "version: STSv1\nmode: enforce\nmx: mx.example.com\nmax_age: soon\n", true, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseMTASTSPolicy([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMTASTSPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if p.mode != tt.mode || len(p.mx) != tt.mx {
+				t.Errorf("policy = %+v, want mode %q with %d mx", p, tt.mode, tt.mx)
+			}
+		})
+	}
+}
+
+func TestMTASTSMatchesMX(t *testing.T) {
+	p := &mtaSTSPolicy{mx: []string{"mx1.example.com", "*.mail.example.net"}}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"mx1.example.com", true},
+		{"MX1.Example.com.", true},
+		{"mx2.example.com", false},
+		{"a.mail.example.net", true},
+		{"a.b.mail.example.net", false},
+		{"mail.example.net", false},
+	}
+	for _, tt := range tests {
+		if got := p.matchesMX(tt.host); got != tt.want {
+			t.Errorf("matchesMX(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestMTASTSCache(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	txt := []string{"v=STSv1; id=20240101"}
+	fetches := 0
+	fetchErr := error(nil)
+	c := &mtaSTSCache{
+		entries: make(map[string]mtaSTSEntry),
+		lookupTXT: func(ctx context.Context, name string) ([]string, error) {
+			if name != "_mta-sts.example.com" {
+				t.Errorf("TXT lookup for %q", name)
+			}
+			return txt, nil
+		},
+		fetch: func(ctx context.Context, domain string) ([]byte, error) {
+			fetches++
+			return []byte("version: STSv1\nmode: enforce\nmx: mx.example.com\nmax_age: 3600\n"), fetchErr
+		},
+		now: func() time.Time { return now },
+	}
+
+	if p := c.policy(context.Background(), "example.com"); p == nil || p.mode != mtaSTSEnforce || p.id != "20240101" {
+		t.Fatalf("policy = %+v, want enforce policy", p)
+	}
+	if c.policy(context.Background(), "example.com"); fetches != 1 {
+		t.Errorf("unchanged id refetched: %d fetches", fetches)
+	}
+
+	// A stripped TXT record or failing policy host must not erase a cached
+	// policy.
+	txt = nil
+	if p := c.policy(context.Background(), "example.com"); p == nil {
+		t.Error("cached policy lost when TXT record disappeared")
+	}
+	txt, fetchErr = []string{"v=STSv1; id=20240202"}, errors.New("unreachable")
+	if p := c.policy(context.Background(), "example.com"); p == nil {
+		t.Error("cached policy lost when fetch failed")
+	}
+
+	// Once expired, the domain has no policy without a fresh fetch.
+	now = now.Add(2 * time.Hour)
+	txt = nil
+	if p := c.policy(context.Background(), "example.com"); p != nil {
+		t.Errorf("expired policy still used: %+v", p)
+	}
+}
+
+func TestFetchMTASTSRefusesRedirect(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer ts.Close()
+	client := ts.Client()
+	client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return net.Dial(network, ts.Listener.Addr().String())
+	}
+	client.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify = true
+	if _, err := fetchMTASTS(context.Background(), client, "example.com"); err == nil {
+		t.Error("fetchMTASTS followed a redirect")
+	}
+}
+
+func TestDANEVerify(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	cert := ts.Certificate()
+	spki := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	full := sha256.Sum256(cert.Raw)
+
+	tests := []struct {
+		name    string
+		records []tlsaRecord
+		wantErr bool
+	}{
+		{"DANE-EE SPKI SHA-256", []tlsaRecord{{usage: 3, selector: 1, matchingType: 1, data: spki[:]}}, false},
+		{"DANE-EE cert SHA-256", []tlsaRecord{{usage: 3, selector: 0, matchingType: 1, data: full[:]}}, false},
+		{"DANE-EE full cert", []tlsaRecord{{usage: 3, selector: 0, matchingType: 0, data: cert.Raw}}, false},
+		{"mismatch", []tlsaRecord{{usage: 3, selector: 1, matchingType: 1, data: make([]byte, 32)}}, true},
+		{"DANE-TA without chain", []tlsaRecord{{usage: 2, selector: 1, matchingType: 1, data: spki[:]}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := daneVerify(tt.records, "mx.example.com", []*x509.Certificate{cert})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("daneVerify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// The policy replaces WebPKI verification with TLSA matching.
+	p := &mxTLSPolicy{source: "dane", require: true, tlsa: tests[0].records}
+	srv := smtpServer{addr: "mx.example.com:25", policy: p}
+	cfg := srv.tlsConfig("mx.example.com")
+	if !cfg.InsecureSkipVerify || cfg.VerifyConnection == nil {
+		t.Fatal("DANE policy did not install TLSA verification")
+	}
+	if err := cfg.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}); err != nil {
+		t.Errorf("VerifyConnection: %v", err)
+	}
+}
+
+func TestMXPolicyMode(t *testing.T) {
+	mx := smtpServer{addr: "mx.example.com:25"}
+	if got := mx.mode(); got != SMTPSecurityOpportunistic {
+		t.Errorf("mode() without policy = %q, want opportunistic", got)
+	}
+	mx.policy = &mxTLSPolicy{source: "mta-sts", require: true}
+	if got := mx.mode(); got != SMTPSecuritySTARTTLS {
+		t.Errorf("mode() with policy = %q, want starttls", got)
+	}
+	if cfg := mx.tlsConfig("mx.example.com"); cfg.InsecureSkipVerify {
+		t.Error("MTA-STS policy must verify the certificate")
+	}
+}
+
+func TestMXPolicyRefusesPlaintext(t *testing.T) {
+	srv := newFakeSMTP(t) // no STARTTLS offered
+	s := srv.server()
+	s.security = SMTPSecurityOpportunistic
+	s.policy = &mxTLSPolicy{source: "mta-sts", require: true}
+	err := smtpSend(context.Background(), s, testSMTPMessage("body"))
+	if err == nil || !strings.Contains(err.Error(), "mta-sts policy") {
+		t.Errorf("smtpSend() error = %v, want policy refusal", err)
+	}
+}
+
+// fakeDNS answers TLSA queries over UDP with the given records, setting the
+// AD bit when secure.
+func fakeDNS(t *testing.T, secure bool, rcode dnsmessage.RCode, records ...tlsaRecord) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var p dnsmessage.Parser
+			h, err := p.Start(buf[:n])
+			if err != nil {
+				continue
+			}
+			q, err := p.Question()
+			if err != nil {
+				continue
+			}
+			b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, AuthenticData: secure, RCode: rcode})
+			_ = b.StartQuestions()
+			_ = b.Question(q)
+			_ = b.StartAnswers()
+			for _, r := range records {
+				data := append([]byte{r.usage, r.selector, r.matchingType}, r.data...)
+				_ = b.UnknownResource(dnsmessage.ResourceHeader{Name: q.Name, Type: typeTLSA, Class: dnsmessage.ClassINET, TTL: 300},
+					dnsmessage.UnknownResource{Type: typeTLSA, Data: data})
+			}
+			resp, _ := b.Finish()
+			_, _ = pc.WriteTo(resp, from)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestLookupTLSA(t *testing.T) {
+	want := tlsaRecord{usage: 3, selector: 1, matchingType: 1, data: []byte{1, 2, 3}}
+	server := fakeDNS(t, true, dnsmessage.RCodeSuccess, want)
+	records, secure, err := lookupTLSA(context.Background(), server, "mx.example.com", 25)
+	if err != nil {
+		t.Fatalf("lookupTLSA: %v", err)
+	}
+	if !secure || len(records) != 1 || records[0].usage != 3 || string(records[0].data) != "\x01\x02\x03" {
+		t.Errorf("lookupTLSA = %+v, secure %v", records, secure)
+	}
+
+	failing := fakeDNS(t, false, dnsmessage.RCodeServerFailure)
+	if _, _, err := lookupTLSA(context.Background(), failing, "mx.example.com", 25); err == nil {
+		t.Error("SERVFAIL: want error so delivery is deferred, got nil")
+	}
+}
+
+func TestMXPolicyResolve(t *testing.T) {
+	rec := tlsaRecord{usage: 3, selector: 1, matchingType: 1, data: make([]byte, 32)}
+	sts := &mtaSTSCache{
+		entries: make(map[string]mtaSTSEntry),
+		lookupTXT: func(ctx context.Context, name string) ([]string, error) {
+			return []string{"v=STSv1; id=1"}, nil
+		},
+		fetch: func(ctx context.Context, domain string) ([]byte, error) {
+			return []byte("version: STSv1\nmode: enforce\nmx: mx.example.com\nmax_age: 3600\n"), nil
+		},
+		now: time.Now,
+	}
+
+	tests := []struct {
+		name     string
+		resolver *mxPolicyResolver
+		mx       string
+		source   string
+		wantErr  error
+	}{
+		{"dane wins", &mxPolicyResolver{sts: sts, dnsServer: fakeDNS(t, true, dnsmessage.RCodeSuccess, rec)}, "mx.example.com", "dane", nil},
+		{"unsigned tlsa ignored", &mxPolicyResolver{sts: sts, dnsServer: fakeDNS(t, false, dnsmessage.RCodeSuccess, rec)}, "mx.example.com", "mta-sts", nil},
+		{"mta-sts", &mxPolicyResolver{sts: sts}, "mx.example.com", "mta-sts", nil},
+		{"mx not listed", &mxPolicyResolver{sts: sts}, "rogue.example.org", "", errMXNotPermitted},
+		{"no policy", &mxPolicyResolver{}, "mx.example.com", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.resolver.resolve(context.Background(), "example.com", tt.mx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resolve() error = %v, want %v", err, tt.wantErr)
+			}
+			source := ""
+			if p != nil {
+				source = p.source
+			}
+			if source != tt.source {
+				t.Errorf("resolve() source = %q, want %q", source, tt.source)
+			}
+		})
+	}
+}
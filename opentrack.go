@@ -0,0 +1,214 @@
+// opentrack.go - Open classification for tracking pixels. The library does
+// not serve pixels itself; applications that do can pass each pixel hit
+// through an OpenTracker to keep machine opens out of their engagement
+// numbers. Since Apple Mail Privacy Protection (MPP), Apple's proxies fetch
+// every remote image of a message on delivery, whether or not the user
+// reads it, and security gateways do the same to scan links; counted as
+// opens, both inflate open rates to meaningless levels. OpenTracker reports
+// raw counts next to adjusted ones that leave them out.
+package email
+
+import (
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenEvent is one fetch of a message's tracking pixel.
+type OpenEvent struct {
+	// MessageID identifies the tracked message, as encoded in the pixel
+	// URL.
+	MessageID string
+
+	// Time is when the pixel was fetched; Sent, if known, when the message
+	// was sent.
+	Time time.Time
+	Sent time.Time
+
+	// UserAgent and IP are those of the pixel request.
+	UserAgent string
+	IP        netip.Addr
+}
+
+// OpenClass is the classification of an open.
+type OpenClass int
+
+const (
+	// OpenHuman is an open that may be a person reading the message,
+	// including through on-open image proxies (Gmail, Yahoo).
+	OpenHuman OpenClass = iota
+
+	// OpenPrivacyProxy is a prefetch by Apple Mail Privacy Protection: it
+	// says nothing about whether the message was read.
+	OpenPrivacyProxy
+
+	// OpenScanner is a fetch by a security gateway or link scanner shortly
+	// after delivery.
+	OpenScanner
+)
+
+// String returns the class's name.
+func (c OpenClass) String() string {
+	switch c {
+	case OpenHuman:
+		return "human"
+	case OpenPrivacyProxy:
+		return "privacy-proxy"
+	case OpenScanner:
+		return "scanner"
+	}
+	return "unknown"
+}
+
+// Machine reports whether the open was made by software rather than a
+// reader.
+func (c OpenClass) Machine() bool {
+	return c != OpenHuman
+}
+
+// appleNetwork is Apple's 17.0.0.0/8, from which MPP proxies fetch.
+var appleNetwork = netip.MustParsePrefix("17.0.0.0/8")
+
+// scannerAgents are User-Agent fragments of security gateways and link
+// scanners that prefetch images.
+var scannerAgents = []string{"barracuda", "mimecast", "proofpoint", "symantec", "trendmicro", "forcepoint", "bot", "crawler", "spider", "scanner", "python-requests", "curl/", "go-http-client"}
+
+// OpenClassifier classifies pixel hits. The zero value uses the built-in
+// heuristics.
+type OpenClassifier struct {
+	// PrivacyNetworks adds networks whose fetches are privacy-proxy
+	// prefetches, e.g. from Apple's published egress ranges.
+	PrivacyNetworks []netip.Prefix
+
+	// ScannerWindow treats opens this soon after Sent as scanner fetches
+	// (no person opens mail within seconds of it being sent, but gateways
+	// do). Zero disables the check.
+	ScannerWindow time.Duration
+}
+
+// Classify returns the class of the open e. MPP prefetches are recognized
+// by their bare "Mozilla/5.0" User-Agent, alone or together with an Apple
+// (17.0.0.0/8) or PrivacyNetworks address; scanners by their User-Agent or,
+// with ScannerWindow, by their timing.
+func (oc *OpenClassifier) Classify(e OpenEvent) OpenClass {
+	ua := strings.TrimSpace(e.UserAgent)
+	inPrivacyNet := e.IP.IsValid() && appleNetwork.Contains(e.IP.Unmap())
+	for _, p := range oc.PrivacyNetworks {
+		if e.IP.IsValid() && p.Contains(e.IP.Unmap()) {
+			inPrivacyNet = true
+		}
+	}
+	// MPP fetches send a bare "Mozilla/5.0"; a real Apple Mail sends a
+	// full WebKit User-Agent.
+	if ua == "Mozilla/5.0" || inPrivacyNet && !strings.Contains(ua, "AppleWebKit") {
+		return OpenPrivacyProxy
+	}
+	lower := strings.ToLower(ua)
+	if lower == "" {
+		return OpenScanner
+	}
+	for _, s := range scannerAgents {
+		if strings.Contains(lower, s) {
+			return OpenScanner
+		}
+	}
+	if oc.ScannerWindow > 0 && !e.Sent.IsZero() && !e.Time.IsZero() && e.Time.Sub(e.Sent) < oc.ScannerWindow {
+		return OpenScanner
+	}
+	return OpenHuman
+}
+
+// OpenStats are the open counts of one message or of all messages.
+type OpenStats struct {
+	// Raw counts every pixel fetch, as a naive tracker would.
+	Raw int
+
+	// Adjusted counts human opens only.
+	Adjusted int
+
+	// PrivacyProxy and Scanner count the machine opens left out.
+	PrivacyProxy int
+	Scanner      int
+
+	// Messages is the number of messages with at least one open; Opened the
+	// number with at least one human open. For a single message they are 0
+	// or 1.
+	Messages int
+	Opened   int
+}
+
+// OpenTracker counts pixel hits per message, classified by Classifier. It
+// is safe for concurrent use.
+//
+// Example:
+//
+//	tracker := &email.OpenTracker{}
+//	http.HandleFunc("/o/", func(w http.ResponseWriter, r *http.Request) {
+//	    ip, _ := netip.ParseAddr(remoteIP(r))
+//	    tracker.Record(email.OpenEvent{
+//	        MessageID: strings.TrimPrefix(r.URL.Path, "/o/"),
+//	        Time:      time.Now(),
+//	        UserAgent: r.UserAgent(),
+//	        IP:        ip,
+//	    })
+//	    servePixel(w)
+//	})
+type OpenTracker struct {
+	Classifier OpenClassifier
+
+	mu    sync.Mutex
+	stats map[string]*OpenStats
+}
+
+// Record counts the open e and returns its class.
+func (t *OpenTracker) Record(e OpenEvent) OpenClass {
+	class := t.Classifier.Classify(e)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stats == nil {
+		t.stats = make(map[string]*OpenStats)
+	}
+	s := t.stats[e.MessageID]
+	if s == nil {
+		s = &OpenStats{Messages: 1}
+		t.stats[e.MessageID] = s
+	}
+	s.Raw++
+	switch class {
+	case OpenPrivacyProxy:
+		s.PrivacyProxy++
+	case OpenScanner:
+		s.Scanner++
+	default:
+		s.Adjusted++
+		s.Opened = 1
+	}
+	return class
+}
+
+// Stats returns the counts of the message id.
+func (t *OpenTracker) Stats(id string) OpenStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s := t.stats[id]; s != nil {
+		return *s
+	}
+	return OpenStats{}
+}
+
+// Totals returns the counts across all messages.
+func (t *OpenTracker) Totals() OpenStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var total OpenStats
+	for _, s := range t.stats {
+		total.Raw += s.Raw
+		total.Adjusted += s.Adjusted
+		total.PrivacyProxy += s.PrivacyProxy
+		total.Scanner += s.Scanner
+		total.Messages += s.Messages
+		total.Opened += s.Opened
+	}
+	return total
+}
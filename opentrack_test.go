@@ -0,0 +1,69 @@
+package email
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+const (
+	iphoneMailUA = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148"
+	gmailProxyUA = "Mozilla/5.0 (Windows NT 5.1; rv:11.0) Gecko Firefox/11.0 (via ggpht.com GoogleImageProxy)"
+)
+
+func TestOpenClassifier(t *testing.T) {
+	sent := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		oc   OpenClassifier
+		e    OpenEvent
+		want OpenClass
+	}{
+		{"mpp user agent", OpenClassifier{}, OpenEvent{UserAgent: "Mozilla/5.0", IP: netip.MustParseAddr("104.28.1.1")}, OpenPrivacyProxy},
+		{"apple network", OpenClassifier{}, OpenEvent{UserAgent: "", IP: netip.MustParseAddr("17.58.1.1")}, OpenPrivacyProxy},
+		{"apple mail client", OpenClassifier{}, OpenEvent{UserAgent: iphoneMailUA, IP: netip.MustParseAddr("17.58.1.1")}, OpenHuman},
+		{"configured network", OpenClassifier{PrivacyNetworks: []netip.Prefix{netip.MustParsePrefix("172.224.0.0/12")}},
+			OpenEvent{UserAgent: "Mozilla/5.0 (Macintosh)", IP: netip.MustParseAddr("172.225.3.4")}, OpenPrivacyProxy},
+		{"gmail proxy", OpenClassifier{}, OpenEvent{UserAgent: gmailProxyUA, IP: netip.MustParseAddr("66.249.84.1")}, OpenHuman},
+		{"scanner agent", OpenClassifier{}, OpenEvent{UserAgent: "Mimecast-Scanner/1.0"}, OpenScanner},
+		{"no user agent", OpenClassifier{}, OpenEvent{}, OpenScanner},
+		{"within scanner window", OpenClassifier{ScannerWindow: 5 * time.Second},
+			OpenEvent{UserAgent: iphoneMailUA, Sent: sent, Time: sent.Add(2 * time.Second)}, OpenScanner},
+		{"after scanner window", OpenClassifier{ScannerWindow: 5 * time.Second},
+			OpenEvent{UserAgent: iphoneMailUA, Sent: sent, Time: sent.Add(time.Hour)}, OpenHuman},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.oc.Classify(tt.e); got != tt.want {
+				t.Errorf("Classify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenTracker(t *testing.T) {
+	tr := &OpenTracker{}
+	apple := netip.MustParseAddr("17.1.2.3")
+	// m1: prefetched by MPP, then really read twice.
+	tr.Record(OpenEvent{MessageID: "m1", UserAgent: "Mozilla/5.0", IP: apple})
+	tr.Record(OpenEvent{MessageID: "m1", UserAgent: iphoneMailUA})
+	tr.Record(OpenEvent{MessageID: "m1", UserAgent: iphoneMailUA})
+	// m2: only prefetched and scanned.
+	if c := tr.Record(OpenEvent{MessageID: "m2", UserAgent: "Mozilla/5.0", IP: apple}); !c.Machine() {
+		t.Errorf("MPP open class = %v", c)
+	}
+	tr.Record(OpenEvent{MessageID: "m2", UserAgent: "Barracuda Sentinel"})
+
+	if got, want := tr.Stats("m1"), (OpenStats{Raw: 3, Adjusted: 2, PrivacyProxy: 1, Messages: 1, Opened: 1}); got != want {
+		t.Errorf("Stats(m1) = %+v, want %+v", got, want)
+	}
+	if got, want := tr.Stats("m2"), (OpenStats{Raw: 2, PrivacyProxy: 1, Scanner: 1, Messages: 1}); got != want {
+		t.Errorf("Stats(m2) = %+v, want %+v", got, want)
+	}
+	if got, want := tr.Totals(), (OpenStats{Raw: 5, Adjusted: 2, PrivacyProxy: 2, Scanner: 1, Messages: 2, Opened: 1}); got != want {
+		t.Errorf("Totals() = %+v, want %+v", got, want)
+	}
+	if got := tr.Stats("unknown"); got != (OpenStats{}) {
+		t.Errorf("Stats(unknown) = %+v", got)
+	}
+}
@@ -1,16 +1,31 @@
+//go:build !email_no_outlook
+
 // outlook.go - Outlook 365 provider implementation using Microsoft Graph API
 package email
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
-	"path/filepath"
+	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	abstractions "github.com/microsoft/kiota-abstractions-go"
+	azauth "github.com/microsoft/kiota-authentication-azure-go"
+	khttp "github.com/microsoft/kiota-http-go"
 	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	msgraphcore "github.com/microsoftgraph/msgraph-sdk-go-core"
 	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/microsoftgraph/msgraph-sdk-go/models/odataerrors"
 	"github.com/microsoftgraph/msgraph-sdk-go/users"
+	"golang.org/x/oauth2"
 )
 
 // outlookProvider implements the Provider interface for Outlook 365.
@@ -20,9 +35,64 @@ type outlookProvider struct {
 	config *OutlookConfig
 }
 
+// Compile-time guarantees of the optional interfaces Outlook 365 implements
+// (calendars and replies are checked in their own files).
+var (
+	_ MailboxProvider    = (*outlookProvider)(nil)
+	_ AttachmentProvider = (*outlookProvider)(nil)
+	_ HeaderProvider     = (*outlookProvider)(nil)
+	_ PageProvider       = (*outlookProvider)(nil)
+	_ ResultSender       = (*outlookProvider)(nil)
+	_ StatsProvider      = (*outlookProvider)(nil)
+	_ nativeScheduler    = (*outlookProvider)(nil)
+	_ sizeLimiter        = (*outlookProvider)(nil)
+)
+
+func init() {
+	RegisterProvider(ProviderOutlook365, func(config *Config) (Provider, error) {
+		if config.Outlook == nil {
+			return nil, fmt.Errorf("outlook configuration is required")
+		}
+		return created(newOutlookProvider(config.Outlook))
+	})
+}
+
+func (o *outlookProvider) maxMessageSize() int64 { return outlookMaxMessageSize }
+
+// outlookCloud pairs the Azure AD authority and Graph root for one Microsoft
+// cloud. Login for GCC High and DoD share the US Government authority but use
+// different Graph hosts.
+type outlookCloud struct {
+	authority cloud.Configuration
+	graphURL  string
+}
+
+// outlookClouds maps OutlookConfig.CloudEnvironment values to endpoints.
+// GCC (moderate) tenants live in the public cloud and use CloudPublic.
+var outlookClouds = map[string]outlookCloud{
+	CloudPublic:    {authority: cloud.AzurePublic, graphURL: "https://graph.microsoft.com"},
+	CloudUSGovHigh: {authority: cloud.AzureGovernment, graphURL: "https://graph.microsoft.us"},
+	CloudUSGovDoD:  {authority: cloud.AzureGovernment, graphURL: "https://dod-graph.microsoft.us"},
+	CloudChina:     {authority: cloud.AzureChina, graphURL: "https://microsoftgraph.chinacloudapi.cn"},
+}
+
+// outlookCloudFor returns the endpoints for a CloudEnvironment value; empty
+// means the public cloud.
+func outlookCloudFor(env string) (outlookCloud, error) {
+	if env == "" {
+		env = CloudPublic
+	}
+	c, ok := outlookClouds[strings.ToLower(env)]
+	if !ok {
+		return outlookCloud{}, fmt.Errorf("unsupported cloud environment: %s", env)
+	}
+	return c, nil
+}
+
 // newOutlookProvider creates a new Outlook 365 email provider.
-// It authenticates using Azure AD client credentials and initializes
-// the Microsoft Graph SDK client.
+// It authenticates using Azure AD client credentials, as a signed-in user
+// when config.TokenJSON or config.RefreshToken is set, or with the caller's
+// config.Credential, and initializes the Microsoft Graph SDK client.
 //
 // Required Azure AD permissions:
 //   - Mail.Send
@@ -32,19 +102,35 @@ type outlookProvider struct {
 //   - An alias of the authenticated user
 //   - A shared mailbox the user has "Send As" permissions for
 func newOutlookProvider(config *OutlookConfig) (Provider, error) {
-	// Create Azure AD credential using client secret
-	cred, err := azidentity.NewClientSecretCredential(
-		config.TenantID,
-		config.ClientID,
-		config.ClientSecret,
-		&azidentity.ClientSecretCredentialOptions{},
-	)
+	endpoints, err := outlookCloudFor(config.CloudEnvironment)
+	if err != nil {
+		return nil, err
+	}
+
+	var cred azcore.TokenCredential
+	if config.Credential != nil {
+		cred, err = configCredential(config)
+	} else if len(config.TokenJSON) > 0 || config.RefreshToken != "" {
+		cred, err = newDelegatedCredential(config, endpoints)
+	} else {
+		// Create Azure AD credential using client secret
+		clientOpts := azcore.ClientOptions{Cloud: endpoints.authority}
+		if config.HTTPClient != nil {
+			clientOpts.Transport = config.HTTPClient
+		}
+		cred, err = azidentity.NewClientSecretCredential(
+			config.TenantID,
+			config.ClientID,
+			config.ClientSecret,
+			&azidentity.ClientSecretCredentialOptions{ClientOptions: clientOpts},
+		)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("authentication error: %w", err)
 	}
 
 	// Initialize Microsoft Graph client
-	client, err := msgraphsdk.NewGraphServiceClientWithCredentials(cred, []string{"https://graph.microsoft.com/.default"})
+	client, err := newGraphClient(cred, endpoints, config)
 	if err != nil {
 		return nil, fmt.Errorf("error creating Graph client: %w", err)
 	}
@@ -55,10 +141,91 @@ func newOutlookProvider(config *OutlookConfig) (Provider, error) {
 	}, nil
 }
 
+// graphHosts are the hosts the Graph SDK attaches access tokens for by
+// default; requests to any other host go out unauthenticated.
+var graphHosts = []string{
+	"graph.microsoft.com", "graph.microsoft.us", "dod-graph.microsoft.us",
+	"microsoftgraph.chinacloudapi.cn",
+}
+
+// newGraphClient builds the Graph client for a tenant. The base URL is the
+// cloud's Graph root unless config.BaseURL overrides it; the override's host
+// is trusted with tokens as well. A config.HTTPClient keeps the SDK's retry,
+// redirect and telemetry middleware, layered over the client's transport.
+func newGraphClient(cred azcore.TokenCredential, endpoints outlookCloud, config *OutlookConfig) (*msgraphsdk.GraphServiceClient, error) {
+	baseURL := endpoints.graphURL + "/v1.0"
+	hosts := graphHosts
+	if config.BaseURL != "" {
+		u, err := url.Parse(config.BaseURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid base URL %q", config.BaseURL)
+		}
+		baseURL = strings.TrimSuffix(config.BaseURL, "/")
+		hosts = append(append([]string(nil), graphHosts...), u.Host)
+	}
+
+	auth, err := azauth.NewAzureIdentityAuthenticationProviderWithScopesAndValidHosts(
+		cred, []string{endpoints.graphURL + "/.default"}, hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	var httpClient *http.Client
+	if config.HTTPClient != nil || config.Throttle != nil {
+		var hc http.Client
+		if config.HTTPClient != nil {
+			hc = *config.HTTPClient
+		}
+		parent := hc.Transport
+		if config.Throttle != nil {
+			// Below the SDK's retry handler, so its retries are paced too.
+			parent = config.Throttle.transport(parent)
+		}
+		opts := msgraphsdk.GetDefaultClientOptions()
+		hc.Transport = khttp.NewCustomTransportWithParentTransport(
+			parent, msgraphcore.GetDefaultMiddlewaresWithOptions(&opts)...)
+		httpClient = &hc
+	}
+	adapter, err := msgraphsdk.NewGraphRequestAdapterWithParseNodeFactoryAndSerializationWriterFactoryAndHttpClient(
+		auth, nil, nil, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	adapter.SetBaseUrl(baseURL)
+	return msgraphsdk.NewGraphServiceClient(adapter), nil
+}
+
 // Send sends an email message using the Microsoft Graph API.
 // It constructs a Graph API message from the provided Message struct,
 // handles attachments, and sends the email through the sender's mailbox.
 func (o *outlookProvider) Send(ctx context.Context, msg *Message) error {
+	return outlookAPIError(o.send(ctx, msg))
+}
+
+// send is Send, with provider errors not yet wrapped as *APIError.
+func (o *outlookProvider) send(ctx context.Context, msg *Message) error {
+	if o.needsChunking(msg) {
+		_, err := o.sendChunks(ctx, msg, false)
+		return err
+	}
+	if err := checkSentCopy(msg); err != nil {
+		return err
+	}
+
+	// Graph's JSON API only takes "X-" headers; anything else has to travel
+	// inside a MIME submission.
+	if needsMIMESubmission(msg) {
+		if msg.SentFolder != "" {
+			return fmt.Errorf("outlook: signed messages and non \"X-\" headers cannot be combined with SentFolder: %w", ErrUnsupported)
+		}
+		raw, err := buildRawMessage(msg, true)
+		if err != nil {
+			return fmt.Errorf("failed to build message: %w", err)
+		}
+		_, err = o.sendMIME(ctx, msg.From, raw)
+		return err
+	}
+
 	// Construct the Microsoft Graph message object
 	message := o.constructMessage(msg)
 
@@ -67,19 +234,105 @@ func (o *outlookProvider) Send(ctx context.Context, msg *Message) error {
 		return fmt.Errorf("failed to attach files: %w", err)
 	}
 
+	// Filing into a folder needs the sent copy's id, which sendMail does not
+	// return; go through a draft instead.
+	if msg.SentFolder != "" {
+		_, err := o.sendAndFile(ctx, msg.From, message, msg.SentFolder)
+		return err
+	}
+
 	// Create send mail request
 	requestBody := users.NewItemSendMailPostRequestBody()
 	requestBody.SetMessage(message)
-	saveToSentItems := true
+	saveToSentItems := savesToSent(msg)
 	requestBody.SetSaveToSentItems(&saveToSentItems)
 
 	// Send the email
-	err := o.client.Users().ByUserId(msg.From).SendMail().Post(ctx, requestBody, nil)
+	sent := responseHeaders()
+	cfg := &users.ItemSendMailRequestBuilderPostRequestConfiguration{Options: []abstractions.RequestOption{sent}}
+	err := o.client.Users().ByUserId(msg.From).SendMail().Post(ctx, requestBody, cfg)
 	if err != nil {
 		return fmt.Errorf("failed to send email: %w", err)
 	}
 
-	return nil
+	_, err = o.awaitOperation(ctx, sent)
+	return err
+}
+
+// SendWithResult sends msg like Send and reports its identifiers. Unlike
+// Send it always goes through a draft, because sendMail returns no ids; the
+// app therefore needs Mail.ReadWrite as well as Mail.Send. Messages with
+// non "X-" headers are submitted as MIME and report only their Message-ID.
+// When msg.SaveToSent is false the sent copy is deleted once submitted, so
+// the reported ProviderID no longer resolves.
+func (o *outlookProvider) SendWithResult(ctx context.Context, msg *Message) (*SendResult, error) {
+	res, err := o.sendWithResult(ctx, msg)
+	return res, outlookAPIError(err)
+}
+
+// sendWithResult is SendWithResult, with provider errors not yet wrapped
+// as *APIError.
+func (o *outlookProvider) sendWithResult(ctx context.Context, msg *Message) (*SendResult, error) {
+	if o.needsChunking(msg) {
+		return o.sendChunks(ctx, msg, true)
+	}
+	if err := checkSentCopy(msg); err != nil {
+		return nil, err
+	}
+	if needsMIMESubmission(msg) {
+		if msg.SentFolder != "" {
+			return nil, fmt.Errorf("outlook: signed messages and non \"X-\" headers cannot be combined with SentFolder: %w", ErrUnsupported)
+		}
+		msg, id := withMessageID(msg)
+		raw, err := buildRawMessage(msg, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build message: %w", err)
+		}
+		status, err := o.sendMIME(ctx, msg.From, raw)
+		if err != nil {
+			return nil, err
+		}
+		return &SendResult{MessageID: id, Status: status}, nil
+	}
+
+	message := o.constructMessage(msg)
+	if err := o.attachFiles(message, msg.Attachments); err != nil {
+		return nil, fmt.Errorf("failed to attach files: %w", err)
+	}
+	if msg.SentFolder != "" {
+		return o.sendAndFile(ctx, msg.From, message, msg.SentFolder)
+	}
+	res, _, err := o.sendDraft(ctx, msg.From, message)
+	return res, err
+}
+
+// outlookAPIError wraps a Graph or Azure AD refusal in err as an *APIError,
+// which carries a hint for its error code.
+func outlookAPIError(err error) error {
+	var odata *odataerrors.ODataError
+	var aad *azidentity.AuthenticationFailedError
+	var oauth *oauth2.RetrieveError
+	switch {
+	case errors.As(err, &odata):
+		var code string
+		if main := odata.GetErrorEscaped(); main != nil {
+			code = derefStr(main.GetCode())
+		}
+		return apiError(ProviderOutlook365, odata.ResponseStatusCode, code, err)
+	case errors.As(err, &aad):
+		var status int
+		if aad.RawResponse != nil {
+			status = aad.RawResponse.StatusCode
+		}
+		return apiError(ProviderOutlook365, status, "AuthenticationFailed", err)
+	case errors.As(err, &oauth):
+		var status int
+		if oauth.Response != nil {
+			status = oauth.Response.StatusCode
+		}
+		return apiError(ProviderOutlook365, status, oauth.ErrorCode, err)
+	}
+	return err
 }
 
 // constructMessage builds a Microsoft Graph Message object from our Message struct.
@@ -101,7 +354,9 @@ func (o *outlookProvider) constructMessage(msg *Message) models.Messageable {
 	message.SetBody(body)
 
 	// Set recipients
-	message.SetToRecipients(o.createRecipients(msg.To))
+	if len(msg.To) > 0 {
+		message.SetToRecipients(o.createRecipients(msg.To))
+	}
 
 	if len(msg.Cc) > 0 {
 		message.SetCcRecipients(o.createRecipients(msg.Cc))
@@ -111,9 +366,151 @@ func (o *outlookProvider) constructMessage(msg *Message) models.Messageable {
 		message.SetBccRecipients(o.createRecipients(msg.Bcc))
 	}
 
+	custom := msg.Headers
+	if msg.Priority != "" {
+		// Graph derives X-Priority from the importance set below.
+		custom = make(map[string]string, len(msg.Headers))
+		for k, v := range msg.Headers {
+			if !strings.EqualFold(k, "X-Priority") {
+				custom[k] = v
+			}
+		}
+	}
+	if headers := internetMessageHeaders(custom); len(headers) > 0 {
+		message.SetInternetMessageHeaders(headers)
+	}
+
+	if msg.Priority != "" {
+		importance := map[Priority]models.Importance{
+			PriorityHigh:   models.HIGH_IMPORTANCE,
+			PriorityNormal: models.NORMAL_IMPORTANCE,
+			PriorityLow:    models.LOW_IMPORTANCE,
+		}[msg.Priority]
+		message.SetImportance(&importance)
+	}
+
+	// Graph exposes neither sensitivity nor deferred delivery on messages;
+	// set the MAPI properties Exchange reads them from.
+	var props []models.SingleValueLegacyExtendedPropertyable
+	if msg.Sensitivity != "" {
+		props = append(props, extendedProperty("Integer 0x0036", map[Sensitivity]string{ // PidTagSensitivity
+			SensitivityPersonal:     "1",
+			SensitivityPrivate:      "2",
+			SensitivityConfidential: "3",
+		}[msg.Sensitivity]))
+	}
+	if !msg.SendAt.IsZero() {
+		// PidTagDeferredSendTime: Exchange holds the message in the
+		// Outbox until then.
+		props = append(props, extendedProperty("SystemTime 0x3FEF", msg.SendAt.UTC().Format(time.RFC3339)))
+	}
+	if !savesToSent(msg) {
+		// PidTagDeleteAfterSubmit: sendMail takes saveToSentItems, but a
+		// draft sent through /send is always saved unless flagged.
+		props = append(props, extendedProperty("Boolean 0x0E01", "true"))
+	}
+	if len(props) > 0 {
+		message.SetSingleValueExtendedProperties(props)
+	}
+
 	return message
 }
 
+// extendedProperty returns a single-value extended property.
+func extendedProperty(id, value string) models.SingleValueLegacyExtendedPropertyable {
+	prop := models.NewSingleValueLegacyExtendedProperty()
+	prop.SetId(&id)
+	prop.SetValue(&value)
+	return prop
+}
+
+// savesToSent reports whether the sent copy of msg is kept in Sent Items.
+func savesToSent(msg *Message) bool {
+	return msg.SaveToSent == nil || *msg.SaveToSent
+}
+
+// checkSentCopy rejects a msg.SaveToSent of false where the sent copy is
+// needed: to file it into SentFolder, or by the MIME form of sendMail,
+// which always saves it.
+func checkSentCopy(msg *Message) error {
+	if savesToSent(msg) {
+		return nil
+	}
+	if msg.SentFolder != "" {
+		return fmt.Errorf("outlook: SentFolder requires the sent copy, but SaveToSent is false")
+	}
+	if needsMIMESubmission(msg) {
+		return fmt.Errorf("outlook: signed messages and non \"X-\" headers are always saved to Sent Items: %w", ErrUnsupported)
+	}
+	return nil
+}
+
+// schedules reports whether the provider defers msg to its SendAt itself:
+// Graph takes the deferred send time on JSON submissions, not MIME ones.
+func (o *outlookProvider) schedules(msg *Message) bool {
+	return !needsMIMESubmission(msg)
+}
+
+// internetMessageHeaders converts the "X-" custom headers to Graph
+// internetMessageHeaders, in name order. Other headers are not accepted by
+// Graph and are sent through sendMIME instead.
+func internetMessageHeaders(h map[string]string) []models.InternetMessageHeaderable {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		if isXHeader(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	out := make([]models.InternetMessageHeaderable, 0, len(names))
+	for _, name := range names {
+		name, value := name, h[name]
+		header := models.NewInternetMessageHeader()
+		header.SetName(&name)
+		header.SetValue(&value)
+		out = append(out, header)
+	}
+	return out
+}
+
+// needsMIMESubmission reports whether msg has a custom header or a Language
+// Graph's JSON message model cannot carry, or is to be signed or encrypted.
+func needsMIMESubmission(msg *Message) bool {
+	if msg.seal != nil || msg.Language != "" {
+		return true
+	}
+	for name := range msg.Headers {
+		if !isXHeader(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isXHeader reports whether name is an "X-" extension header.
+func isXHeader(name string) bool {
+	return len(name) > 2 && strings.EqualFold(name[:2], "x-")
+}
+
+// sendMIME sends a pre-built RFC 2822 message through sendMail's MIME form
+// (base64 body, text/plain), and returns the final status of a send Graph
+// processed asynchronously (see awaitOperation). Graph always saves it to
+// Sent Items.
+func (o *outlookProvider) sendMIME(ctx context.Context, uid string, raw []byte) (string, error) {
+	builder := o.client.Users().ByUserId(uid).SendMail()
+	req := abstractions.NewRequestInformationWithMethodAndUrlTemplateAndPathParameters(
+		abstractions.POST, builder.UrlTemplate, builder.PathParameters)
+	req.SetStreamContentAndContentType([]byte(base64.StdEncoding.EncodeToString(raw)), "text/plain")
+	sent := responseHeaders()
+	req.AddRequestOptions([]abstractions.RequestOption{sent})
+	errorMapping := abstractions.ErrorMappings{"XXX": odataerrors.CreateODataErrorFromDiscriminatorValue}
+	if err := builder.RequestAdapter.SendNoContent(ctx, req, errorMapping); err != nil {
+		return "", fmt.Errorf("failed to send email: %w", err)
+	}
+	return o.awaitOperation(ctx, sent)
+}
+
 // createRecipients converts email addresses to Microsoft Graph Recipient objects.
 func (o *outlookProvider) createRecipients(addresses []string) []models.Recipientable {
 	recipients := make([]models.Recipientable, len(addresses))
@@ -137,60 +534,41 @@ func (o *outlookProvider) attachFiles(message models.Messageable, attachments []
 
 	msgAttachments := make([]models.Attachmentable, 0, len(attachments))
 	for _, att := range attachments {
-		filename := att.Filename // local copy; avoid &loopvar aliasing
-		attachment := models.NewFileAttachment()
-		attachment.SetName(&filename)
-		attachment.SetContentBytes(att.Content)
-
-		// Determine content type
-		contentType := att.MimeType
-		if contentType == "" {
-			contentType = getContentType(att.Filename)
+		fa, err := newFileAttachment(att)
+		if err != nil {
+			return err
 		}
-		attachment.SetContentType(&contentType)
-
-		msgAttachments = append(msgAttachments, attachment)
+		msgAttachments = append(msgAttachments, fa)
 	}
 
 	message.SetAttachments(msgAttachments)
 	return nil
 }
 
-// getContentType returns the MIME type based on file extension.
-// It supports common file types and defaults to application/octet-stream
-// for unknown extensions.
-func getContentType(filename string) string {
-	ext := strings.ToLower(filepath.Ext(filename))
-	switch ext {
-	case ".pdf":
-		return "application/pdf"
-	case ".doc":
-		return "application/msword"
-	case ".docx":
-		return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
-	case ".xls":
-		return "application/vnd.ms-excel"
-	case ".xlsx":
-		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
-	case ".png":
-		return "image/png"
-	case ".jpg", ".jpeg":
-		return "image/jpeg"
-	case ".gif":
-		return "image/gif"
-	case ".txt":
-		return "text/plain"
-	case ".html", ".htm":
-		return "text/html"
-	case ".zip":
-		return "application/zip"
-	case ".csv":
-		return "text/csv"
-	case ".xml":
-		return "application/xml"
-	case ".json":
-		return "application/json"
-	default:
-		return "application/octet-stream"
+// newFileAttachment converts an Attachment to a Graph FileAttachment, detecting
+// the MIME type from the filename if not specified. Graph takes the content
+// inline in the JSON request, so a streamed attachment is read in full.
+func newFileAttachment(att Attachment) (models.FileAttachmentable, error) {
+	content, err := att.bytes()
+	if err != nil {
+		return nil, fmt.Errorf("attachment %q: %w", att.Filename, err)
+	}
+	filename := att.Filename // local copy; avoid &loopvar aliasing
+	attachment := models.NewFileAttachment()
+	attachment.SetName(&filename)
+	attachment.SetContentBytes(content)
+
+	// Determine content type
+	contentType := att.MimeType
+	if contentType == "" {
+		contentType = getContentType(att.Filename)
+	}
+	attachment.SetContentType(&contentType)
+
+	if att.Inline {
+		inline, contentID := true, att.ContentID
+		attachment.SetIsInline(&inline)
+		attachment.SetContentId(&contentID)
 	}
+	return attachment, nil
 }
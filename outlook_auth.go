@@ -0,0 +1,228 @@
+//go:build !email_no_outlook
+
+// outlook_auth.go - Delegated authentication for Outlook 365. The provider
+// normally authenticates as the application (client credentials), which
+// needs an app-only Mail.Send grant from a tenant administrator. CLI tools
+// can instead sign a user in with the OAuth2 device code flow: the user
+// opens a URL on any device and enters a short code, and the resulting
+// token, saved like a Gmail token, lets the provider send as that user.
+// Web apps that run the authorization code flow themselves pass the
+// refresh token they stored for the user instead, and any other Azure
+// credential can be passed as OutlookConfig.Credential.
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"golang.org/x/oauth2"
+)
+
+// OutlookAuthHelper signs a user in with the device code flow, for
+// OutlookConfig.TokenJSON. The app registration must allow public client
+// flows ("Allow public client flows" under Authentication) and hold the
+// delegated permissions requested.
+type OutlookAuthHelper struct {
+	// TenantID is the Azure AD tenant, or "organizations" for any work
+	// account.
+	TenantID string
+
+	// ClientID is the Azure AD application (client) ID.
+	ClientID string
+
+	// CloudEnvironment selects the Microsoft cloud, as for OutlookConfig.
+	CloudEnvironment string
+
+	// Scopes overrides the delegated Graph permissions requested, e.g.
+	// "Mail.Send" alone. If empty, the helper requests Mail.Send and
+	// Mail.ReadWrite, which SendWithResult and the MailboxProvider
+	// operations need besides sending. offline_access is always added,
+	// for the refresh token.
+	Scopes []string
+
+	// HTTPClient, if set, carries the Azure AD requests.
+	HTTPClient *http.Client
+
+	// Prompt, if set, is called with the verification URL and code to
+	// show the user. It defaults to printing them to standard output.
+	Prompt func(verificationURL, userCode string)
+
+	// authority overrides the cloud's Azure AD host, for tests.
+	authority string
+}
+
+// NewOutlookAuthHelper returns a device code helper for the app clientID
+// in tenantID.
+//
+// Example:
+//
+//	helper := email.NewOutlookAuthHelper("your-tenant-id", "your-client-id")
+//	token, err := helper.Authenticate()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//
+//	// Save token for future use
+//	err = os.WriteFile("outlook-token.json", token, 0600)
+func NewOutlookAuthHelper(tenantID, clientID string) *OutlookAuthHelper {
+	return &OutlookAuthHelper{TenantID: tenantID, ClientID: clientID}
+}
+
+// Authenticate runs the device code flow and returns the token as JSON.
+// It shows the user a URL and a code, and returns once they have signed in
+// there, or fails when the code expires (after 15 minutes).
+func (h *OutlookAuthHelper) Authenticate() ([]byte, error) {
+	return h.AuthenticateWithContext(context.Background())
+}
+
+// AuthenticateWithContext is Authenticate with a caller-supplied context,
+// e.g. to give up earlier.
+func (h *OutlookAuthHelper) AuthenticateWithContext(ctx context.Context) ([]byte, error) {
+	endpoints, err := outlookCloudFor(h.CloudEnvironment)
+	if err != nil {
+		return nil, err
+	}
+	authority := h.authority
+	if authority == "" {
+		authority = endpoints.authority.ActiveDirectoryAuthorityHost
+	}
+	config := outlookOAuthConfig(authority, h.TenantID, h.ClientID, endpoints.graphURL, h.Scopes)
+	if h.HTTPClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, h.HTTPClient)
+	}
+
+	da, err := config.DeviceAuth(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start device code sign-in: %w", err)
+	}
+	if h.Prompt != nil {
+		h.Prompt(da.VerificationURI, da.UserCode)
+	} else {
+		fmt.Printf("To sign in, open %s and enter the code %s\n", da.VerificationURI, da.UserCode)
+	}
+	token, err := config.DeviceAccessToken(ctx, da)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get token: %w", err)
+	}
+	tokenJSON, err := json.Marshal(token)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal token: %w", err)
+	}
+	return tokenJSON, nil
+}
+
+// defaultOutlookDelegatedScopes are the delegated Graph permissions
+// OutlookAuthHelper requests by default.
+var defaultOutlookDelegatedScopes = []string{"Mail.Send", "Mail.ReadWrite"}
+
+// outlookOAuthConfig returns the OAuth2 configuration of a public client
+// app in tenant, at the Azure AD host authority, requesting scopes (short
+// Graph permission names are qualified with graphURL) and offline_access.
+func outlookOAuthConfig(authority, tenant, clientID, graphURL string, scopes []string) *oauth2.Config {
+	if len(scopes) == 0 {
+		scopes = defaultOutlookDelegatedScopes
+	}
+	qualified := make([]string, 0, len(scopes)+1)
+	for _, s := range scopes {
+		if !strings.Contains(s, "://") && s != "offline_access" {
+			s = graphURL + "/" + s
+		}
+		qualified = append(qualified, s)
+	}
+	qualified = append(qualified, "offline_access")
+	base := strings.TrimSuffix(authority, "/") + "/" + tenant + "/oauth2/v2.0/"
+	return &oauth2.Config{
+		ClientID: clientID,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:       base + "authorize",
+			TokenURL:      base + "token",
+			DeviceAuthURL: base + "devicecode",
+			AuthStyle:     oauth2.AuthStyleInParams,
+		},
+		Scopes: qualified,
+	}
+}
+
+// delegatedCredential adapts an OAuth2 token source, which renews the
+// access token with its refresh token, to the credential the Graph SDK
+// takes. The scopes the SDK asks for are those the token was granted.
+type delegatedCredential struct {
+	tokens oauth2.TokenSource
+
+	// onRefresh is OutlookConfig.OnRefreshToken, called when renewal
+	// rotates refreshToken.
+	onRefresh    func(string)
+	mu           sync.Mutex
+	refreshToken string
+}
+
+func (c *delegatedCredential) GetToken(ctx context.Context, _ policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	t, err := c.tokens.Token()
+	if err != nil {
+		return azcore.AccessToken{}, fmt.Errorf("outlook: renew delegated token: %w", err)
+	}
+	c.mu.Lock()
+	rotated := t.RefreshToken != "" && t.RefreshToken != c.refreshToken
+	if rotated {
+		c.refreshToken = t.RefreshToken
+	}
+	c.mu.Unlock()
+	if rotated && c.onRefresh != nil {
+		c.onRefresh(t.RefreshToken)
+	}
+	expires := t.Expiry
+	if expires.IsZero() {
+		expires = time.Now().Add(time.Hour)
+	}
+	return azcore.AccessToken{Token: t.AccessToken, ExpiresOn: expires}, nil
+}
+
+// newDelegatedCredential returns the credential for config.TokenJSON or
+// config.RefreshToken.
+func newDelegatedCredential(config *OutlookConfig, endpoints outlookCloud) (azcore.TokenCredential, error) {
+	if len(config.TokenJSON) > 0 && config.RefreshToken != "" {
+		return nil, fmt.Errorf("set either TokenJSON or RefreshToken, not both")
+	}
+	oauthConfig := outlookOAuthConfig(endpoints.authority.ActiveDirectoryAuthorityHost,
+		config.TenantID, config.ClientID, endpoints.graphURL, nil)
+	// A stored refresh token has no access token yet, so the first
+	// request redeems it.
+	token := &oauth2.Token{RefreshToken: config.RefreshToken}
+	if config.RefreshToken != "" {
+		oauthConfig.ClientSecret = config.ClientSecret
+	} else if err := json.Unmarshal(config.TokenJSON, token); err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	if token.RefreshToken == "" {
+		return nil, fmt.Errorf("token has no refresh token; sign in again with offline_access")
+	}
+	ctx := context.Background()
+	if config.HTTPClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, config.HTTPClient)
+	}
+	return &delegatedCredential{
+		tokens:       oauthConfig.TokenSource(ctx, token),
+		onRefresh:    config.OnRefreshToken,
+		refreshToken: token.RefreshToken,
+	}, nil
+}
+
+// configCredential returns config.Credential, checking that it is a
+// TokenCredential and the only credential configured.
+func configCredential(config *OutlookConfig) (azcore.TokenCredential, error) {
+	if config.ClientSecret != "" || len(config.TokenJSON) > 0 || config.RefreshToken != "" {
+		return nil, fmt.Errorf("a Credential cannot be combined with ClientSecret, TokenJSON or RefreshToken")
+	}
+	cred, ok := config.Credential.(azcore.TokenCredential)
+	if !ok {
+		return nil, fmt.Errorf("credential of type %T is not an azcore.TokenCredential", config.Credential)
+	}
+	return cred, nil
+}
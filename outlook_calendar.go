@@ -1,3 +1,5 @@
+//go:build !email_no_outlook
+
 // outlook_calendar.go - Outlook 365 (Microsoft Graph) implementation of the
 // CalendarProvider interface. Mirrors the SDK idiom of outlook_read.go: the
 // configured UserID is the mailbox, builder/config type names are verified
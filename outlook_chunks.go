@@ -0,0 +1,101 @@
+//go:build !email_no_outlook
+
+// outlook_chunks.go - Splitting of messages with more recipients than
+// Exchange Online accepts in one message. Each chunk is a copy of the
+// message addressed to a consecutive slice of its recipients, so a
+// recipient sees only the To and Cc addresses in their own chunk.
+package email
+
+import (
+	"context"
+	"fmt"
+)
+
+// defaultOutlookMaxRecipients is Exchange Online's default per-message
+// recipient limit.
+const defaultOutlookMaxRecipients = 500
+
+// maxRecipients returns the per-message recipient cap, 0 for none.
+func (o *outlookProvider) maxRecipients() int {
+	switch n := o.config.MaxRecipients; {
+	case n < 0:
+		return 0
+	case n == 0:
+		return defaultOutlookMaxRecipients
+	default:
+		return n
+	}
+}
+
+// needsChunking reports whether msg has more recipients than one Graph
+// message may.
+func (o *outlookProvider) needsChunking(msg *Message) bool {
+	limit := o.maxRecipients()
+	return limit > 0 && len(msg.To)+len(msg.Cc)+len(msg.Bcc) > limit
+}
+
+// recipientChunks splits msg into copies of at most limit recipients each,
+// taking To, then Cc, then Bcc in order.
+func recipientChunks(msg *Message, limit int) []*Message {
+	var chunks []*Message
+	cur := &Message{}
+	fill := 0
+	for _, field := range []struct {
+		addrs []string
+		dst   func(m *Message) *[]string
+	}{
+		{msg.To, func(m *Message) *[]string { return &m.To }},
+		{msg.Cc, func(m *Message) *[]string { return &m.Cc }},
+		{msg.Bcc, func(m *Message) *[]string { return &m.Bcc }},
+	} {
+		for _, addr := range field.addrs {
+			if fill == limit {
+				chunks = append(chunks, cur)
+				cur, fill = &Message{}, 0
+			}
+			dst := field.dst(cur)
+			*dst = append(*dst, addr)
+			fill++
+		}
+	}
+	chunks = append(chunks, cur)
+
+	for i, c := range chunks {
+		out := *msg
+		out.To, out.Cc, out.Bcc = c.To, c.Cc, c.Bcc
+		chunks[i] = &out
+	}
+	return chunks
+}
+
+// sendChunks sends msg as recipientChunks, stopping at the first failure,
+// and returns the first chunk's result. withResult selects SendWithResult,
+// and so drafts, for each chunk. A failure after the first chunk wraps
+// ErrPartialSend: the chunks before it must not be sent again.
+func (o *outlookProvider) sendChunks(ctx context.Context, msg *Message, withResult bool) (*SendResult, error) {
+	chunks := recipientChunks(msg, o.maxRecipients())
+	var first *SendResult
+	sent := 0
+	for i, chunk := range chunks {
+		report := SendChunk{Index: i, Total: len(chunks), Recipients: messageRecipients(chunk)}
+		if withResult {
+			report.Result, report.Err = o.SendWithResult(ctx, chunk)
+		} else {
+			report.Err = o.Send(ctx, chunk)
+		}
+		if o.config.OnChunk != nil {
+			o.config.OnChunk(report)
+		}
+		if report.Err != nil {
+			if i > 0 {
+				return first, fmt.Errorf("%w: sent to %d recipients, then chunk %d of %d: %w", ErrPartialSend, sent, i+1, len(chunks), report.Err)
+			}
+			return nil, fmt.Errorf("outlook: chunk 1 of %d: %w", len(chunks), report.Err)
+		}
+		if i == 0 {
+			first = report.Result
+		}
+		sent += len(report.Recipients)
+	}
+	return first, nil
+}
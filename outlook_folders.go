@@ -0,0 +1,191 @@
+//go:build !email_no_outlook
+
+// outlook_folders.go - Filing a sent message into an Outlook folder. Graph's
+// sendMail returns no id for the saved copy, so when Message.SentFolder is set
+// the provider sends through a draft instead: the draft's internetMessageId
+// survives the send, which lets us find the copy in Sent Items and move it.
+// Folder paths ("Automated/Invoices") are resolved by display name from the
+// mailbox root, creating missing levels, mirroring Gmail's label-on-demand.
+package email
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	abstractions "github.com/microsoft/kiota-abstractions-go"
+	graphmodels "github.com/microsoftgraph/msgraph-sdk-go/models"
+	graphusers "github.com/microsoftgraph/msgraph-sdk-go/users"
+)
+
+// sentCopyAttempts / sentCopyDelay bound the wait for the sent copy to appear
+// in Sent Items; Exchange files it asynchronously, usually within a second.
+const (
+	sentCopyAttempts = 10
+	sentCopyDelay    = 500 * time.Millisecond
+)
+
+// sendAndFile sends message from mailbox uid via a draft and moves the saved
+// copy into folder. Errors after the send has gone out wrap ErrPartialSend
+// and come with the send's result.
+func (o *outlookProvider) sendAndFile(ctx context.Context, uid string, message graphmodels.Messageable, folder string) (*SendResult, error) {
+	res, internetID, err := o.sendDraft(ctx, uid, message)
+	if err != nil {
+		return res, err
+	}
+
+	sentID, err := o.findSentCopy(ctx, uid, internetID)
+	if err != nil {
+		return res, fmt.Errorf("%w: %w", ErrPartialSend, err)
+	}
+	destID, err := o.resolveFolderPath(ctx, uid, folder)
+	if err != nil {
+		return res, fmt.Errorf("%w: %w", ErrPartialSend, err)
+	}
+	body := graphusers.NewItemMessagesItemMovePostRequestBody()
+	body.SetDestinationId(strptr(destID))
+	if _, err := o.client.Users().ByUserId(uid).Messages().ByMessageId(sentID).Move().Post(ctx, body, nil); err != nil {
+		return res, fmt.Errorf("%w: move to %q: %w", ErrPartialSend, folder, err)
+	}
+	return res, nil
+}
+
+// sendDraft creates message as a draft in mailbox uid and sends it,
+// returning its identifiers and raw internetMessageId, also with an error
+// wrapping ErrOutcomeUnknown. The draft is created
+// with immutable ids, so ProviderID stays valid once Exchange moves the
+// message to Sent Items.
+func (o *outlookProvider) sendDraft(ctx context.Context, uid string, message graphmodels.Messageable) (*SendResult, string, error) {
+	cfg := &graphusers.ItemMessagesRequestBuilderPostRequestConfiguration{Headers: abstractions.NewRequestHeaders()}
+	cfg.Headers.Add("Prefer", `IdType="ImmutableId"`)
+	draft, err := o.client.Users().ByUserId(uid).Messages().Post(ctx, message, cfg)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create draft: %w", err)
+	}
+	internetID := derefStr(draft.GetInternetMessageId())
+	res := &SendResult{
+		MessageID:  strings.Trim(internetID, "<>"),
+		ProviderID: derefStr(draft.GetId()),
+		ThreadID:   derefStr(draft.GetConversationId()),
+	}
+
+	sent := responseHeaders()
+	sendCfg := &graphusers.ItemMessagesItemSendRequestBuilderPostRequestConfiguration{Options: []abstractions.RequestOption{sent}}
+	draftItem := o.client.Users().ByUserId(uid).Messages().ByMessageId(res.ProviderID)
+	if err := draftItem.Send().Post(ctx, sendCfg); err != nil {
+		// Best effort: do not leave the unsent draft in Drafts.
+		_ = draftItem.Delete(ctx, nil)
+		return nil, "", fmt.Errorf("failed to send email: %w", err)
+	}
+	if res.Status, err = o.awaitOperation(ctx, sent); err != nil {
+		return res, internetID, err // ErrOutcomeUnknown: the ids are valid
+	}
+	return res, internetID, nil
+}
+
+// findSentCopy polls Sent Items for the message with the given
+// internetMessageId and returns its Graph id.
+func (o *outlookProvider) findSentCopy(ctx context.Context, uid, internetID string) (string, error) {
+	cfg := &graphusers.ItemMailFoldersItemMessagesRequestBuilderGetRequestConfiguration{
+		QueryParameters: &graphusers.ItemMailFoldersItemMessagesRequestBuilderGetQueryParameters{
+			Filter: strptr("internetMessageId eq '" + odataQuote(internetID) + "'"),
+			Select: []string{"id"},
+		},
+	}
+	for attempt := 0; attempt < sentCopyAttempts; attempt++ {
+		resp, err := o.client.Users().ByUserId(uid).
+			MailFolders().ByMailFolderId("sentitems").
+			Messages().Get(ctx, cfg)
+		if err != nil {
+			return "", fmt.Errorf("look up sent copy: %w", err)
+		}
+		if v := resp.GetValue(); len(v) > 0 {
+			return derefStr(v[0].GetId()), nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(sentCopyDelay):
+		}
+	}
+	return "", fmt.Errorf("sent copy %s: %w", internetID, ErrNotFound)
+}
+
+// wellKnownFolders are the Graph well-known folder names, which address the
+// mailbox's own folders whatever their display names.
+var wellKnownFolders = map[string]bool{
+	"archive": true, "clutter": true, "conflicts": true, "conversationhistory": true,
+	"deleteditems": true, "drafts": true, "inbox": true, "junkemail": true,
+	"localfailures": true, "msgfolderroot": true, "outbox": true,
+	"recoverableitemsdeletions": true, "scheduled": true, "searchfolders": true,
+	"sentitems": true, "serverfailures": true, "syncissues": true,
+}
+
+// resolveFolderPath maps a "/"-separated folder path to a folder id, walking
+// display names from the mailbox root and creating missing folders. A single
+// segment that matches no folder is passed through unchanged only if it is a
+// well-known name ("archive") or the id of an existing folder.
+func (o *outlookProvider) resolveFolderPath(ctx context.Context, uid, path string) (string, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	parent := "msgfolderroot"
+	for i, name := range segments {
+		id, err := o.childFolderID(ctx, uid, parent, name)
+		if err != nil {
+			return "", err
+		}
+		if id == "" && len(segments) == 1 && (wellKnownFolders[strings.ToLower(name)] || o.folderExists(ctx, uid, name)) {
+			return name, nil
+		}
+		if id == "" {
+			folder := graphmodels.NewMailFolder()
+			folder.SetDisplayName(strptr(name))
+			created, err := o.client.Users().ByUserId(uid).
+				MailFolders().ByMailFolderId(parent).
+				ChildFolders().Post(ctx, folder, nil)
+			if err != nil {
+				return "", fmt.Errorf("create folder %q: %w", strings.Join(segments[:i+1], "/"), err)
+			}
+			id = derefStr(created.GetId())
+		}
+		parent = id
+	}
+	return parent, nil
+}
+
+// folderExists reports whether id is the id of a folder in mailbox uid.
+func (o *outlookProvider) folderExists(ctx context.Context, uid, id string) bool {
+	cfg := &graphusers.ItemMailFoldersMailFolderItemRequestBuilderGetRequestConfiguration{
+		QueryParameters: &graphusers.ItemMailFoldersMailFolderItemRequestBuilderGetQueryParameters{
+			Select: []string{"id"},
+		},
+	}
+	_, err := o.client.Users().ByUserId(uid).MailFolders().ByMailFolderId(id).Get(ctx, cfg)
+	return err == nil
+}
+
+// childFolderID returns the id of parent's child folder with the given display
+// name, or "" if there is none.
+func (o *outlookProvider) childFolderID(ctx context.Context, uid, parent, name string) (string, error) {
+	cfg := &graphusers.ItemMailFoldersItemChildFoldersRequestBuilderGetRequestConfiguration{
+		QueryParameters: &graphusers.ItemMailFoldersItemChildFoldersRequestBuilderGetQueryParameters{
+			Filter: strptr("displayName eq '" + odataQuote(name) + "'"),
+			Select: []string{"id"},
+		},
+	}
+	resp, err := o.client.Users().ByUserId(uid).
+		MailFolders().ByMailFolderId(parent).
+		ChildFolders().Get(ctx, cfg)
+	if err != nil {
+		return "", fmt.Errorf("look up folder %q: %w", name, err)
+	}
+	if v := resp.GetValue(); len(v) > 0 {
+		return derefStr(v[0].GetId()), nil
+	}
+	return "", nil
+}
+
+// odataQuote escapes a value for use inside a single-quoted OData literal.
+func odataQuote(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
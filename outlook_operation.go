@@ -0,0 +1,122 @@
+//go:build !email_no_outlook
+
+// outlook_operation.go - Long-running send operations. Graph answers
+// sendMail (and a draft's send) with 202 Accepted, which normally means the
+// message has been queued for delivery. For large messages it may instead
+// return a Location header naming an operation still in progress; the
+// provider then polls it until it finishes, so that a submission that fails
+// late is reported as an error rather than as a successful send.
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	abstractions "github.com/microsoft/kiota-abstractions-go"
+	khttp "github.com/microsoft/kiota-http-go"
+	"github.com/microsoftgraph/msgraph-sdk-go/models/odataerrors"
+)
+
+// outlookOperationPoll is the wait between polls of a send operation when
+// Graph suggests none with Retry-After; outlookOperationMaxPoll caps the
+// wait Graph may suggest. The context passed to Send bounds the whole wait.
+const (
+	outlookOperationPoll    = time.Second
+	outlookOperationMaxPoll = 30 * time.Second
+)
+
+// Statuses of a Graph longRunningOperation.
+const (
+	operationNotStarted = "notStarted"
+	operationRunning    = "running"
+	operationSucceeded  = "succeeded"
+)
+
+// responseHeaders returns a request option that captures a response's
+// headers, for the Location and Retry-After of a send.
+func responseHeaders() *khttp.HeadersInspectionOptions {
+	opts := khttp.NewHeadersInspectionOptions()
+	opts.InspectResponseHeaders = true
+	return opts
+}
+
+// awaitOperation waits for the send whose response headers sent captured to
+// finish, and returns the operation's final status. It returns "" at once
+// when the response named no operation, the usual case, in which Graph has
+// accepted the message already. Graph has accepted the send by the time it
+// is called, so when the operation cannot be followed to its end the error
+// wraps ErrOutcomeUnknown: the message may still go out, and must not be
+// sent again.
+func (o *outlookProvider) awaitOperation(ctx context.Context, sent *khttp.HeadersInspectionOptions) (string, error) {
+	location := headerFirst(sent.GetResponseHeaders(), "Location")
+	if location == "" {
+		return "", nil
+	}
+	adapter := o.client.GetAdapter()
+	u, err := url.Parse(adapter.GetBaseUrl() + "/")
+	if err == nil {
+		u, err = u.Parse(location)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: outlook: invalid send operation location %q: %w", ErrOutcomeUnknown, location, err)
+	}
+	wait := pollWait(sent)
+	errorMapping := abstractions.ErrorMappings{"XXX": odataerrors.CreateODataErrorFromDiscriminatorValue}
+	for {
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("%w: outlook: waiting for send operation: %w", ErrOutcomeUnknown, ctx.Err())
+		case <-time.After(wait):
+		}
+
+		polled := responseHeaders()
+		req := abstractions.NewRequestInformation()
+		req.Method = abstractions.GET
+		req.SetUri(*u)
+		req.Headers.TryAdd("Accept", "application/json")
+		req.AddRequestOptions([]abstractions.RequestOption{polled})
+		body, err := adapter.SendPrimitive(ctx, req, "[]byte", errorMapping)
+		if err != nil {
+			return "", fmt.Errorf("%w: outlook: poll send operation: %w", ErrOutcomeUnknown, err)
+		}
+		var op struct {
+			Status       string `json:"status"`
+			StatusDetail string `json:"statusDetail"`
+		}
+		if b, _ := body.([]byte); json.Unmarshal(b, &op) != nil {
+			return "", fmt.Errorf("%w: outlook: poll send operation: unexpected response %q", ErrOutcomeUnknown, b)
+		}
+		switch op.Status {
+		case operationNotStarted, operationRunning:
+			wait = pollWait(polled)
+		case operationSucceeded:
+			return op.Status, nil
+		default:
+			if op.StatusDetail != "" {
+				return "", fmt.Errorf("outlook: send operation %s: %s", op.Status, op.StatusDetail)
+			}
+			return "", fmt.Errorf("outlook: send operation %s", op.Status)
+		}
+	}
+}
+
+// pollWait returns the wait before the next poll that the response whose
+// headers h captured asks for.
+func pollWait(h *khttp.HeadersInspectionOptions) time.Duration {
+	d, ok := retryAfter(headerFirst(h.GetResponseHeaders(), "Retry-After"), time.Now())
+	if !ok || d <= 0 {
+		return outlookOperationPoll
+	}
+	return min(d, outlookOperationMaxPoll)
+}
+
+// headerFirst returns the first value of header name in h, "" if none.
+func headerFirst(h *abstractions.ResponseHeaders, name string) string {
+	if v := h.Get(name); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
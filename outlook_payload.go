@@ -0,0 +1,75 @@
+//go:build !email_no_outlook
+
+// outlook_payload.go - The Graph sendMail request for a Message, built
+// without a Client (see payload.go).
+package email
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+
+	jsonserialization "github.com/microsoft/kiota-serialization-json-go"
+	"github.com/microsoftgraph/msgraph-sdk-go/users"
+)
+
+// BuildGraphPayload returns the Microsoft Graph request that sends msg from
+// its From mailbox, as an Outlook 365 Client's Send would: the JSON form of
+// sendMail, or its MIME form for messages Graph's JSON model cannot carry
+// (custom non "X-" headers, Language). The request needs an access token
+// with Mail.Send for the mailbox.
+//
+// Messages over Exchange Online's default limit of 500 recipients, and
+// messages with a SentFolder, are sent by a Client in several requests;
+// they are rejected here.
+//
+// Example:
+//
+//	p, err := email.BuildGraphPayload(msg)
+//	if err != nil {
+//	    return err
+//	}
+//	queue.Publish(p) // sent later as p.Method https://graph.microsoft.com/v1.0 + p.Path
+func BuildGraphPayload(msg *Message) (*Payload, error) {
+	msg, err := preparePayload(msg)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(messageRecipients(msg)); n > defaultOutlookMaxRecipients {
+		return nil, fmt.Errorf("payload: message has %d recipients, Graph accepts at most %d in one request", n, defaultOutlookMaxRecipients)
+	}
+	if err := checkSentCopy(msg); err != nil {
+		return nil, err
+	}
+	p := &Payload{Method: "POST", Path: "/users/" + url.PathEscape(parseAddr(msg.From)) + "/sendMail"}
+
+	if needsMIMESubmission(msg) {
+		raw, err := buildRawMessage(msg, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build message: %w", err)
+		}
+		p.ContentType = "text/plain"
+		p.Body = []byte(base64.StdEncoding.EncodeToString(raw))
+		return p, nil
+	}
+
+	message := (&outlookProvider{}).constructMessage(msg)
+	if err := (&outlookProvider{}).attachFiles(message, msg.Attachments); err != nil {
+		return nil, fmt.Errorf("failed to attach files: %w", err)
+	}
+	body := users.NewItemSendMailPostRequestBody()
+	body.SetMessage(message)
+	saveToSentItems := savesToSent(msg)
+	body.SetSaveToSentItems(&saveToSentItems)
+
+	w := jsonserialization.NewJsonSerializationWriter()
+	defer w.Close()
+	if err := w.WriteObjectValue("", body); err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+	if p.Body, err = w.GetSerializedContent(); err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+	p.ContentType = "application/json"
+	return p, nil
+}
@@ -1,3 +1,5 @@
+//go:build !email_no_outlook
+
 // outlook_read.go - Outlook 365 (Microsoft Graph) implementation of the
 // MailboxProvider read/management operations. The send path lives in
 // outlook.go; this file adds list/read/search/move/attachments/flags/delete/
@@ -9,12 +11,15 @@ package email
 import (
 	"context"
 	"fmt"
+	"net/mail"
+	"net/textproto"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
+	abstractions "github.com/microsoft/kiota-abstractions-go"
 	graphmodels "github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/microsoftgraph/msgraph-sdk-go/models/odataerrors"
 	graphusers "github.com/microsoftgraph/msgraph-sdk-go/users"
 )
 
@@ -104,6 +109,7 @@ func (o *outlookProvider) Read(ctx context.Context, id string) (*FullMessage, er
 			Select: []string{
 				"id", "subject", "from", "toRecipients", "ccRecipients",
 				"receivedDateTime", "hasAttachments", "isRead", "categories", "body",
+				"internetMessageId", "replyTo", "internetMessageHeaders",
 			},
 		},
 	}
@@ -116,6 +122,16 @@ func (o *outlookProvider) Read(ctx context.Context, id string) (*FullMessage, er
 		Summary: outlookSummary(m),
 		To:      outlookRecipientAddrs(m.GetToRecipients()),
 		Cc:      outlookRecipientAddrs(m.GetCcRecipients()),
+
+		MessageID: strings.Trim(derefStr(m.GetInternetMessageId()), "<>"),
+	}
+	if rt := outlookRecipientAddrs(m.GetReplyTo()); len(rt) > 0 {
+		full.ReplyTo = rt[0]
+	}
+	for _, h := range m.GetInternetMessageHeaders() {
+		if strings.EqualFold(derefStr(h.GetName()), "References") {
+			full.References = derefStr(h.GetValue())
+		}
 	}
 	if body := m.GetBody(); body != nil {
 		content := derefStr(body.GetContent())
@@ -160,6 +176,61 @@ func (o *outlookProvider) Search(ctx context.Context, query string, opts ListOpt
 	return out, nil
 }
 
+// ListPage returns one page of List (q.Search empty) or Search results; the
+// page token is Graph's @odata.nextLink.
+func (o *outlookProvider) ListPage(ctx context.Context, q MessageQuery, pageToken string) ([]Summary, string, error) {
+	uid, err := o.user()
+	if err != nil {
+		return nil, "", err
+	}
+	top := i32ptr(int32(min(q.PageSize, 1000)))
+
+	var resp graphmodels.MessageCollectionResponseable
+	if q.Search != "" {
+		quoted := fmt.Sprintf("%q", q.Search)
+		cfg := &graphusers.ItemMessagesRequestBuilderGetRequestConfiguration{
+			QueryParameters: &graphusers.ItemMessagesRequestBuilderGetQueryParameters{
+				Search: &quoted,
+				Select: summarySelect,
+				Top:    top,
+			},
+		}
+		b := o.client.Users().ByUserId(uid).Messages()
+		if pageToken != "" {
+			b = b.WithUrl(pageToken)
+		}
+		if resp, err = b.Get(ctx, cfg); err != nil {
+			return nil, "", fmt.Errorf("outlook search %s %q: %w", uid, q.Search, err)
+		}
+	} else {
+		folder := q.Folder
+		if folder == "" {
+			folder = "inbox"
+		}
+		cfg := &graphusers.ItemMailFoldersItemMessagesRequestBuilderGetRequestConfiguration{
+			QueryParameters: &graphusers.ItemMailFoldersItemMessagesRequestBuilderGetQueryParameters{
+				Select:  summarySelect,
+				Orderby: []string{"receivedDateTime desc"},
+				Filter:  outlookFilter(q.ListOptions),
+				Top:     top,
+			},
+		}
+		b := o.client.Users().ByUserId(uid).MailFolders().ByMailFolderId(folder).Messages()
+		if pageToken != "" {
+			b = b.WithUrl(pageToken)
+		}
+		if resp, err = b.Get(ctx, cfg); err != nil {
+			return nil, "", fmt.Errorf("outlook list %s/%s: %w", uid, folder, err)
+		}
+	}
+
+	out := make([]Summary, 0, len(resp.GetValue()))
+	for _, m := range resp.GetValue() {
+		out = append(out, outlookSummary(m))
+	}
+	return out, derefStr(resp.GetOdataNextLink()), nil
+}
+
 // Move relocates a message to the destination folder. dest may be a well-known
 // folder name (e.g. "archive", "deleteditems") or a folder id.
 func (o *outlookProvider) Move(ctx context.Context, id, dest string) error {
@@ -202,6 +273,59 @@ func (o *outlookProvider) ListAttachments(ctx context.Context, id string) ([]Att
 	return out, nil
 }
 
+// MessageHeaders returns the message's internetMessageHeaders. Graph only
+// keeps them for messages received from outside the mailbox; drafts and
+// sent items have none.
+func (o *outlookProvider) MessageHeaders(ctx context.Context, id string) (mail.Header, error) {
+	uid, err := o.user()
+	if err != nil {
+		return nil, err
+	}
+	cfg := &graphusers.ItemMessagesMessageItemRequestBuilderGetRequestConfiguration{
+		QueryParameters: &graphusers.ItemMessagesMessageItemRequestBuilderGetQueryParameters{
+			Select: []string{"internetMessageHeaders"},
+		},
+	}
+	m, err := o.client.Users().ByUserId(uid).Messages().ByMessageId(id).Get(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("outlook headers %s/%s: %w", uid, id, err)
+	}
+	h := make(mail.Header)
+	for _, f := range m.GetInternetMessageHeaders() {
+		k := textproto.CanonicalMIMEHeaderKey(derefStr(f.GetName()))
+		h[k] = append(h[k], derefStr(f.GetValue()))
+	}
+	return h, nil
+}
+
+// attachmentValueTemplate is the raw-content URL of one attachment. The SDK
+// has no builder for it, so GetAttachment reuses the attachment item's path
+// parameters with this template.
+const attachmentValueTemplate = "{+baseurl}/users/{user%2Did}/messages/{message%2Did}/attachments/{attachment%2Did}/$value"
+
+// GetAttachment downloads one attachment's raw bytes through its $value
+// endpoint, avoiding both the rest of the message and base64 inflation.
+func (o *outlookProvider) GetAttachment(ctx context.Context, id, attachmentID string) ([]byte, error) {
+	uid, err := o.user()
+	if err != nil {
+		return nil, err
+	}
+	if attachmentID == "" {
+		return nil, fmt.Errorf("outlook get attachment %s/%s: empty attachment id: %w", uid, id, ErrNotFound)
+	}
+	builder := o.client.Users().ByUserId(uid).Messages().ByMessageId(id).Attachments().ByAttachmentId(attachmentID)
+	req := abstractions.NewRequestInformationWithMethodAndUrlTemplateAndPathParameters(
+		abstractions.GET, attachmentValueTemplate, builder.PathParameters)
+	req.Headers.TryAdd("Accept", "application/octet-stream, application/json")
+	errorMapping := abstractions.ErrorMappings{"XXX": odataerrors.CreateODataErrorFromDiscriminatorValue}
+	res, err := builder.RequestAdapter.SendPrimitive(ctx, req, "[]byte", errorMapping)
+	if err != nil {
+		return nil, fmt.Errorf("outlook get attachment %s/%s/%s: %w", uid, id, attachmentID, err)
+	}
+	data, _ := res.([]byte)
+	return data, nil
+}
+
 // SaveAttachments writes a message's file attachments into destDir.
 func (o *outlookProvider) SaveAttachments(ctx context.Context, id, destDir string) ([]string, error) {
 	uid, err := o.user()
@@ -261,58 +385,6 @@ func (o *outlookProvider) SaveMessageRaw(ctx context.Context, id, destDir, baseN
 	return out, nil
 }
 
-// maxAttachmentCollisions caps the OneDrive-style auto-numbering search so a
-// pathological directory (or a races-with-another-writer scenario) can never
-// spin forever. 4096 distinct collisions for one filename in one destDir is far
-// beyond anything a real mailbox produces.
-const maxAttachmentCollisions = 4096
-
-// writeUniqueAttachment writes data into destDir under a collision-free name
-// derived from the attachment's filename, and returns the path actually written.
-//
-// It never overwrites an existing file. If destDir/<name> is free it is used
-// unchanged; otherwise the numeric suffix " (2)", " (3)", ... is inserted before
-// the extension (OneDrive style): "invoice.pdf" -> "invoice (2).pdf",
-// "README" -> "README (2)". The extension boundary is filepath.Ext's, so dotted
-// names like "archive.tar.gz" number as "archive.tar (2).gz".
-//
-// The create is atomic: each candidate is opened with O_CREATE|O_EXCL, so the
-// existence check and the create are a single syscall. This closes the TOCTOU
-// window between "does it exist?" and "write it" — including the same-process
-// repeats dl triggers when it re-runs triage. On EEXIST we advance to the next
-// number and retry; any other open error is returned.
-func writeUniqueAttachment(destDir, name string, data []byte, perm os.FileMode) (string, error) {
-	base := filepath.Base(name)
-	ext := filepath.Ext(base)
-	stem := base[:len(base)-len(ext)]
-
-	for i := 1; i <= maxAttachmentCollisions; i++ {
-		candidate := base
-		if i > 1 {
-			candidate = fmt.Sprintf("%s (%d)%s", stem, i, ext)
-		}
-		out := filepath.Join(destDir, candidate)
-
-		f, err := os.OpenFile(out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
-		if err != nil {
-			if os.IsExist(err) {
-				continue // taken — try the next number
-			}
-			return "", err
-		}
-		if _, werr := f.Write(data); werr != nil {
-			f.Close()
-			return "", werr
-		}
-		if cerr := f.Close(); cerr != nil {
-			return "", cerr
-		}
-		return out, nil
-	}
-	return "", fmt.Errorf("could not find a free name for %q in %q after %d attempts",
-		base, destDir, maxAttachmentCollisions)
-}
-
 // MarkRead sets a message's read state.
 func (o *outlookProvider) MarkRead(ctx context.Context, id string, read bool) error {
 	uid, err := o.user()
@@ -387,6 +459,65 @@ func (o *outlookProvider) ListFolders(ctx context.Context) ([]Folder, error) {
 	return out, nil
 }
 
+// MailboxStats sums the item counts of every mail folder and reads the
+// user's unified storage quota. The quota is best-effort: without permission
+// to read it the counts are still returned, with zero quota.
+func (o *outlookProvider) MailboxStats(ctx context.Context) (*MailboxStats, error) {
+	uid, err := o.user()
+	if err != nil {
+		return nil, err
+	}
+	stats := &MailboxStats{}
+	if err := o.sumFolders(ctx, uid, "msgfolderroot", stats); err != nil {
+		return nil, err
+	}
+
+	inbox, err := o.client.Users().ByUserId(uid).MailFolders().ByMailFolderId("inbox").Get(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("outlook stats %s/inbox: %w", uid, err)
+	}
+	stats.InboxTotal = int64(derefI32(inbox.GetTotalItemCount()))
+	stats.InboxUnread = int64(derefI32(inbox.GetUnreadItemCount()))
+
+	if quota, err := o.client.Users().ByUserId(uid).Settings().Storage().Quota().Get(ctx, nil); err == nil {
+		stats.QuotaUsed = derefI64(quota.GetUsed())
+		stats.QuotaTotal = derefI64(quota.GetTotal())
+	}
+	return stats, nil
+}
+
+// sumFolders adds the item counts of parent's child folders, recursively,
+// to stats.
+func (o *outlookProvider) sumFolders(ctx context.Context, uid, parent string, stats *MailboxStats) error {
+	cfg := &graphusers.ItemMailFoldersItemChildFoldersRequestBuilderGetRequestConfiguration{
+		QueryParameters: &graphusers.ItemMailFoldersItemChildFoldersRequestBuilderGetQueryParameters{
+			Select: []string{"id", "totalItemCount", "unreadItemCount", "childFolderCount"},
+			Top:    i32ptr(100),
+		},
+	}
+	b := o.client.Users().ByUserId(uid).MailFolders().ByMailFolderId(parent).ChildFolders()
+	for {
+		resp, err := b.Get(ctx, cfg)
+		if err != nil {
+			return fmt.Errorf("outlook stats %s/%s: %w", uid, parent, err)
+		}
+		for _, f := range resp.GetValue() {
+			stats.Total += int64(derefI32(f.GetTotalItemCount()))
+			stats.Unread += int64(derefI32(f.GetUnreadItemCount()))
+			if derefI32(f.GetChildFolderCount()) > 0 {
+				if err := o.sumFolders(ctx, uid, derefStr(f.GetId()), stats); err != nil {
+					return err
+				}
+			}
+		}
+		next := derefStr(resp.GetOdataNextLink())
+		if next == "" {
+			return nil
+		}
+		b = b.WithUrl(next)
+	}
+}
+
 // --- conversion helpers -----------------------------------------------------
 
 // outlookFilter builds a $filter string from the unread/since options.
@@ -469,3 +600,10 @@ func derefI32(i *int32) int32 {
 	}
 	return *i
 }
+
+func derefI64(i *int64) int64 {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
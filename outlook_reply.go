@@ -0,0 +1,71 @@
+//go:build !email_no_outlook
+
+// outlook_reply.go - Outlook 365 (Microsoft Graph) implementation of
+// ReplyProvider. A reply is a three-step Graph flow: createReply/createReplyAll
+// makes a draft carrying the thread and quoted original, each attachment is
+// POSTed to the draft, and the draft is sent. The draft is deleted if any step
+// after its creation fails, so a failed reply leaves nothing in Drafts.
+//
+// Graph limits a single attachment POST to 3 MB; larger files need an upload
+// session, which is not implemented here.
+package email
+
+import (
+	"context"
+	"fmt"
+
+	graphmodels "github.com/microsoftgraph/msgraph-sdk-go/models"
+	graphusers "github.com/microsoftgraph/msgraph-sdk-go/users"
+)
+
+// outlookProvider implements ReplyProvider (compile-time check).
+var _ ReplyProvider = (*outlookProvider)(nil)
+
+// ReplyTo sends r as an in-thread reply to the message with the given id.
+func (o *outlookProvider) ReplyTo(ctx context.Context, id string, r Reply) error {
+	uid, err := o.user()
+	if err != nil {
+		return err
+	}
+	item := o.client.Users().ByUserId(uid).Messages().ByMessageId(id)
+
+	var draft graphmodels.Messageable
+	if r.All {
+		body := graphusers.NewItemMessagesItemCreateReplyAllPostRequestBody()
+		body.SetComment(strptr(r.Body))
+		draft, err = item.CreateReplyAll().Post(ctx, body, nil)
+	} else {
+		body := graphusers.NewItemMessagesItemCreateReplyPostRequestBody()
+		body.SetComment(strptr(r.Body))
+		draft, err = item.CreateReply().Post(ctx, body, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("outlook reply %s/%s: %w", uid, id, err)
+	}
+	draftID := derefStr(draft.GetId())
+	drafts := o.client.Users().ByUserId(uid).Messages().ByMessageId(draftID)
+
+	if err := o.sendReplyDraft(ctx, drafts, r.Attachments); err != nil {
+		// Best effort: do not leave a half-built reply in Drafts.
+		_ = drafts.Delete(ctx, nil)
+		return fmt.Errorf("outlook reply %s/%s: %w", uid, id, err)
+	}
+	return nil
+}
+
+// sendReplyDraft uploads the attachments to a reply draft and sends it.
+func (o *outlookProvider) sendReplyDraft(ctx context.Context, draft *graphusers.ItemMessagesMessageItemRequestBuilder, attachments []Attachment) error {
+	for _, att := range attachments {
+		fa, err := newFileAttachment(att)
+		if err != nil {
+			return err
+		}
+		if _, err := draft.Attachments().Post(ctx, fa, nil); err != nil {
+			return fmt.Errorf("attach %q: %w", att.Filename, err)
+		}
+	}
+	if err := draft.Send().Post(ctx, nil); err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,757 @@
+//go:build !email_no_outlook
+
+package email
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	jsonserialization "github.com/microsoft/kiota-serialization-json-go"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+)
+
+// staticToken is a TokenCredential returning a fixed token.
+type staticToken struct{}
+
+func (staticToken) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "tok", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// newTestOutlook returns an Outlook provider for mailbox user@example.com
+// whose Graph requests go to handler.
+func newTestOutlook(t *testing.T, handler http.HandlerFunc) *outlookProvider {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	config := &OutlookConfig{UserID: "user@example.com", BaseURL: srv.URL + "/v1.0", HTTPClient: srv.Client()}
+	endpoints, err := outlookCloudFor("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := newGraphClient(staticToken{}, endpoints, config)
+	if err != nil {
+		t.Fatalf("newGraphClient() error = %v", err)
+	}
+	return &outlookProvider{client: client, config: config}
+}
+
+func TestOutlookCloudFor(t *testing.T) {
+	tests := []struct {
+		env       string
+		graphURL  string
+		authority string
+		wantErr   bool
+	}{
+		{"", "https://graph.microsoft.com", "https://login.microsoftonline.com/", false},
+		{CloudPublic, "https://graph.microsoft.com", "https://login.microsoftonline.com/", false},
+		{CloudUSGovHigh, "https://graph.microsoft.us", "https://login.microsoftonline.us/", false},
+		{"USGovDoD", "https://dod-graph.microsoft.us", "https://login.microsoftonline.us/", false},
+		{CloudChina, "https://microsoftgraph.chinacloudapi.cn", "https://login.chinacloudapi.cn/", false},
+		{"germany", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			got, err := outlookCloudFor(tt.env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("outlookCloudFor(%q) error = %v, wantErr %v", tt.env, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.graphURL != tt.graphURL {
+				t.Errorf("graphURL = %q, want %q", got.graphURL, tt.graphURL)
+			}
+			if got.authority.ActiveDirectoryAuthorityHost != tt.authority {
+				t.Errorf("authority = %q, want %q", got.authority.ActiveDirectoryAuthorityHost, tt.authority)
+			}
+		})
+	}
+}
+
+func TestInternetMessageHeaders(t *testing.T) {
+	msg := &Message{Headers: map[string]string{
+		"X-Campaign-ID": "c1",
+		"x-tag":         "t",
+	}}
+	if needsMIMESubmission(msg) {
+		t.Error("needsMIMESubmission() = true for X- headers only")
+	}
+	got := internetMessageHeaders(msg.Headers)
+	if len(got) != 2 || *got[0].GetName() != "X-Campaign-ID" || *got[1].GetValue() != "t" {
+		t.Errorf("internetMessageHeaders() = %v", got)
+	}
+
+	msg.Headers["Auto-Submitted"] = "auto-generated"
+	if !needsMIMESubmission(msg) {
+		t.Error("needsMIMESubmission() = false with Auto-Submitted")
+	}
+	if got := internetMessageHeaders(msg.Headers); len(got) != 2 {
+		t.Errorf("internetMessageHeaders() kept %d headers, want 2", len(got))
+	}
+}
+
+func TestNewFileAttachmentUTF8Name(t *testing.T) {
+	// Graph takes the name as a JSON string, so UTF-8 passes through as is.
+	for _, name := range []string{"Rechnung_März.pdf", "報告書.pdf", "Ünïcødé résumé.docx"} {
+		att, err := newFileAttachment(Attachment{Filename: name, Content: []byte("x")})
+		if err != nil {
+			t.Fatalf("newFileAttachment(%q) error = %v", name, err)
+		}
+		w := jsonserialization.NewJsonSerializationWriter()
+		if err := w.WriteObjectValue("", att); err != nil {
+			t.Fatal(err)
+		}
+		body, err := w.GetSerializedContent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got struct{ Name string }
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("invalid JSON %s: %v", body, err)
+		}
+		if got.Name != name {
+			t.Errorf("serialized name = %q, want %q", got.Name, name)
+		}
+	}
+}
+
+func TestConstructMessagePriority(t *testing.T) {
+	o := &outlookProvider{}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+		Priority: PriorityHigh, Headers: map[string]string{"X-Priority": "5", "X-Tag": "t"}}
+	m := o.constructMessage(msg)
+	if m.GetImportance() == nil || *m.GetImportance() != models.HIGH_IMPORTANCE {
+		t.Errorf("importance = %v, want high", m.GetImportance())
+	}
+	if h := m.GetInternetMessageHeaders(); len(h) != 1 || *h[0].GetName() != "X-Tag" {
+		t.Errorf("internetMessageHeaders kept X-Priority alongside importance")
+	}
+
+	msg.Priority = ""
+	if m := o.constructMessage(msg); m.GetImportance() != nil || len(m.GetInternetMessageHeaders()) != 2 {
+		t.Errorf("unset priority changed the Graph message")
+	}
+}
+
+func TestConstructMessageSensitivity(t *testing.T) {
+	o := &outlookProvider{}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+		Sensitivity: SensitivityConfidential}
+	props := o.constructMessage(msg).GetSingleValueExtendedProperties()
+	if len(props) != 1 || *props[0].GetId() != "Integer 0x0036" || *props[0].GetValue() != "3" {
+		t.Errorf("extended properties = %v, want PidTagSensitivity 3", props)
+	}
+
+	msg.Sensitivity = ""
+	if props := o.constructMessage(msg).GetSingleValueExtendedProperties(); props != nil {
+		t.Errorf("unset sensitivity set extended properties %v", props)
+	}
+}
+
+func TestConstructMessageSendAt(t *testing.T) {
+	o := &outlookProvider{}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+		SendAt: time.Date(2026, 3, 2, 9, 30, 0, 0, time.FixedZone("CET", 3600))}
+	props := o.constructMessage(msg).GetSingleValueExtendedProperties()
+	if len(props) != 1 || *props[0].GetId() != "SystemTime 0x3FEF" || *props[0].GetValue() != "2026-03-02T08:30:00Z" {
+		t.Errorf("extended properties = %v, want PidTagDeferredSendTime", props)
+	}
+	if !o.schedules(msg) {
+		t.Error("JSON submission not scheduled natively")
+	}
+	msg.Headers = map[string]string{"List-Unsubscribe": "<mailto:u@example.com>"}
+	if o.schedules(msg) {
+		t.Error("MIME submission scheduled natively")
+	}
+	msg.Headers, msg.Language = nil, "de"
+	if !needsMIMESubmission(msg) {
+		t.Error("message with a Language not submitted as MIME")
+	}
+}
+
+func TestOutlookSendEmoji(t *testing.T) {
+	var got struct {
+		Message struct {
+			Subject string
+			Body    struct{ Content string }
+		}
+	}
+	o := newTestOutlook(t, func(w http.ResponseWriter, r *http.Request) {
+		var in io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			in, _ = gzip.NewReader(r.Body)
+		}
+		json.NewDecoder(in).Decode(&got)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	c := &Client{provider: o}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"},
+		Subject: "Launch 🚀 \xed\xa0\xbc\xed\xbe\x89", Body: "👩‍💻 𝔘𝔫𝔦𝔠𝔬𝔡𝔢"}
+	if err := c.SendWithContext(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if got.Message.Subject != "Launch 🚀 🎉" || got.Message.Body.Content != msg.Body {
+		t.Errorf("posted subject %q, body %q", got.Message.Subject, got.Message.Body.Content)
+	}
+}
+
+func TestOutlookSaveToSent(t *testing.T) {
+	var saved []bool
+	o := newTestOutlook(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ SaveToSentItems bool }
+		var in io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			in, _ = gzip.NewReader(r.Body)
+		}
+		json.NewDecoder(in).Decode(&body)
+		saved = append(saved, body.SaveToSentItems)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	no := false
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+	for _, save := range []*bool{nil, &no} {
+		msg.SaveToSent = save
+		if err := o.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+	if fmt.Sprint(saved) != "[true false]" {
+		t.Errorf("saveToSentItems = %v, want [true false]", saved)
+	}
+
+	// Drafts sent through /send are flagged for deletion instead.
+	props := o.constructMessage(msg).GetSingleValueExtendedProperties()
+	if len(props) != 1 || *props[0].GetId() != "Boolean 0x0E01" || *props[0].GetValue() != "true" {
+		t.Errorf("extended properties = %v, want PidTagDeleteAfterSubmit", props)
+	}
+
+	filed := *msg
+	filed.SentFolder = "Automated"
+	if err := o.Send(context.Background(), &filed); err == nil {
+		t.Error("Send() with SentFolder and SaveToSent false succeeded")
+	}
+	mime := *msg
+	mime.Headers = map[string]string{"List-Unsubscribe": "<mailto:u@example.com>"}
+	if _, err := o.SendWithResult(context.Background(), &mime); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("SendWithResult() MIME error = %v, want ErrUnsupported", err)
+	}
+	if len(saved) != 2 {
+		t.Errorf("%d requests sent, want 2", len(saved))
+	}
+}
+
+func TestOutlookSendMIMEOpensAttachmentsOnce(t *testing.T) {
+	var posted string
+	o := newTestOutlook(t, func(w http.ResponseWriter, r *http.Request) {
+		posted = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusAccepted)
+	})
+	opens := 0
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+		Headers: map[string]string{"Auto-Submitted": "auto-generated"}}
+	msg.AttachStream("report.csv", func() (io.ReadCloser, error) {
+		opens++
+		return io.NopCloser(strings.NewReader("a,b\n")), nil
+	})
+	if err := o.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if !strings.HasPrefix(posted, "text/plain") || opens != 1 {
+		t.Errorf("posted %q after opening the attachment %d times, want a MIME submission after one", posted, opens)
+	}
+}
+
+func TestOutlookResolveFolderPath(t *testing.T) {
+	var created []string
+	o := newTestOutlook(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		const user = "/v1.0/users/user@example.com/mailFolders/"
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/childFolders") && r.Method == http.MethodGet:
+			io.WriteString(w, `{"value":[]}`)
+		case strings.HasSuffix(r.URL.Path, "/childFolders"):
+			var folder struct{ DisplayName string }
+			var in io.Reader = r.Body
+			if r.Header.Get("Content-Encoding") == "gzip" {
+				in, _ = gzip.NewReader(r.Body)
+			}
+			json.NewDecoder(in).Decode(&folder)
+			created = append(created, strings.TrimPrefix(r.URL.Path, user)+" "+folder.DisplayName)
+			io.WriteString(w, `{"id":"`+folder.DisplayName+`-id"}`)
+		case r.URL.Path == user+"AAMkAGI2-folder":
+			io.WriteString(w, `{"id":"AAMkAGI2-folder"}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":{"code":"ErrorInvalidIdMalformed","message":"Id is malformed."}}`)
+		}
+	})
+	for _, tt := range []struct{ path, want string }{
+		{"Invoices", "Invoices-id"},
+		{"Archive", "Archive"},
+		{"AAMkAGI2-folder", "AAMkAGI2-folder"},
+		{"Automated/Jobs", "Jobs-id"},
+	} {
+		if got, err := o.resolveFolderPath(context.Background(), "user@example.com", tt.path); err != nil || got != tt.want {
+			t.Errorf("resolveFolderPath(%q) = %q, %v; want %q", tt.path, got, err, tt.want)
+		}
+	}
+	want := "[msgfolderroot/childFolders Invoices msgfolderroot/childFolders Automated Automated-id/childFolders Jobs]"
+	if fmt.Sprint(created) != want {
+		t.Errorf("created %v, want %v", created, want)
+	}
+}
+
+func TestOutlookSendDraftDeletesOnFailure(t *testing.T) {
+	var deleted bool
+	o := newTestOutlook(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodDelete && strings.HasSuffix(r.URL.Path, "/messages/draft-id"):
+			deleted = true
+			w.WriteHeader(http.StatusNoContent)
+		case strings.HasSuffix(r.URL.Path, "/messages/draft-id/send"):
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"error":{"code":"ErrorSendAsDenied","message":"denied"}}`)
+		case strings.HasSuffix(r.URL.Path, "/messages"):
+			io.WriteString(w, `{"id":"draft-id","internetMessageId":"<m@example.com>"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	msg := &Message{From: "user@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+	if _, _, err := o.sendDraft(context.Background(), "user@example.com", o.constructMessage(msg)); err == nil {
+		t.Fatal("sendDraft() succeeded, want the send's error")
+	}
+	if !deleted {
+		t.Error("sendDraft() left the unsent draft in Drafts")
+	}
+}
+
+func TestBuildGraphPayload(t *testing.T) {
+	msg := &Message{From: "Sender <a@example.com>", To: []string{"b@example.com"}, Bcc: []string{"c@example.com"},
+		Subject: "s", Body: "<p>b</p>", HTML: true, Attachments: []Attachment{{Filename: "r.txt", Content: []byte("r")}}}
+	p, err := BuildGraphPayload(msg)
+	if err != nil {
+		t.Fatalf("BuildGraphPayload() error = %v", err)
+	}
+	if p.Method != "POST" || p.Path != "/users/a@example.com/sendMail" || p.ContentType != "application/json" {
+		t.Errorf("payload = %s %s (%s)", p.Method, p.Path, p.ContentType)
+	}
+	var body struct {
+		Message struct {
+			Subject       string
+			BccRecipients []struct{ EmailAddress struct{ Address string } }
+			Attachments   []struct {
+				Type string `json:"@odata.type"`
+				Name string
+			}
+		}
+		SaveToSentItems bool
+	}
+	if err := json.Unmarshal(p.Body, &body); err != nil {
+		t.Fatalf("invalid JSON %s: %v", p.Body, err)
+	}
+	if body.Message.Subject != "s" || !body.SaveToSentItems || len(body.Message.BccRecipients) != 1 ||
+		len(body.Message.Attachments) != 1 || body.Message.Attachments[0].Type != "#microsoft.graph.fileAttachment" {
+		t.Errorf("payload body = %s", p.Body)
+	}
+
+	msg.Language = "de"
+	if p, err := BuildGraphPayload(msg); err != nil || p.ContentType != "text/plain" {
+		t.Errorf("BuildGraphPayload() with Language = %+v, %v; want a MIME payload", p, err)
+	} else if raw, err := base64.StdEncoding.DecodeString(string(p.Body)); err != nil || !strings.Contains(string(raw), "Content-Language: de") {
+		t.Errorf("MIME payload = %q, %v", raw, err)
+	}
+	msg.Language = ""
+
+	msg.SentFolder = "Archive"
+	if _, err := BuildGraphPayload(msg); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("BuildGraphPayload() with SentFolder: error = %v, want ErrUnsupported", err)
+	}
+	msg.SentFolder = ""
+	msg.To = make([]string, 500)
+	for i := range msg.To {
+		msg.To[i] = fmt.Sprintf("r%d@example.com", i)
+	}
+	if _, err := BuildGraphPayload(msg); err == nil {
+		t.Error("BuildGraphPayload() accepted 501 recipients")
+	}
+}
+
+func TestRecipientChunks(t *testing.T) {
+	msg := &Message{From: "a@example.com", Subject: "s", Body: "b",
+		To: []string{"t1", "t2"}, Cc: []string{"c1"}, Bcc: []string{"b1", "b2", "b3", "b4"}}
+	chunks := recipientChunks(msg, 3)
+	want := [][3][]string{
+		{{"t1", "t2"}, {"c1"}, nil},
+		{nil, nil, {"b1", "b2", "b3"}},
+		{nil, nil, {"b4"}},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("got %d chunks, want %d", len(chunks), len(want))
+	}
+	for i, c := range chunks {
+		got := [3][]string{c.To, c.Cc, c.Bcc}
+		if fmt.Sprint(got) != fmt.Sprint(want[i]) {
+			t.Errorf("chunk %d = %v, want %v", i, got, want[i])
+		}
+		if c.Subject != "s" || c.From != "a@example.com" {
+			t.Errorf("chunk %d lost the message fields", i)
+		}
+	}
+}
+
+func TestOutlookSendChunked(t *testing.T) {
+	var posts [][]string
+	o := newTestOutlook(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Message struct {
+				ToRecipients, BccRecipients []struct {
+					EmailAddress struct{ Address string }
+				}
+			}
+		}
+		var in io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" { // the SDK compresses request bodies
+			in, _ = gzip.NewReader(r.Body)
+		}
+		json.NewDecoder(in).Decode(&body)
+		var addrs []string
+		for _, rs := range append(body.Message.ToRecipients, body.Message.BccRecipients...) {
+			addrs = append(addrs, rs.EmailAddress.Address)
+		}
+		posts = append(posts, addrs)
+		if fmt.Sprint(addrs) == "[e@example.com]" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":{"code":"ErrorInvalidRecipients","message":"bad"}}`)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	var reports []SendChunk
+	o.config.MaxRecipients = 2
+	o.config.OnChunk = func(c SendChunk) { reports = append(reports, c) }
+
+	msg := &Message{From: "news@example.com", To: []string{"a@example.com"}, Subject: "s", Body: "b",
+		Bcc: []string{"b@example.com", "c@example.com", "d@example.com"}}
+	if err := o.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if fmt.Sprint(posts) != "[[a@example.com b@example.com] [c@example.com d@example.com]]" {
+		t.Errorf("posted recipients = %v", posts)
+	}
+	if len(reports) != 2 || reports[1].Index != 1 || reports[1].Total != 2 || fmt.Sprint(reports[1].Recipients) != "[c@example.com d@example.com]" {
+		t.Errorf("chunk reports = %+v", reports)
+	}
+
+	msg.Bcc = append(msg.Bcc, "e@example.com")
+	err := o.Send(context.Background(), msg)
+	if !errors.Is(err, ErrPartialSend) || !strings.Contains(err.Error(), "sent to 4 recipients, then chunk 3 of 3") {
+		t.Errorf("Send() error = %v, want ErrPartialSend after 4 recipients", err)
+	}
+	var api *APIError
+	if !errors.As(err, &api) || api.Code != "ErrorInvalidRecipients" {
+		t.Errorf("Send() error = %v, want the chunk's Graph error", err)
+	}
+	if last := reports[len(reports)-1]; last.Err == nil || last.Index != 2 {
+		t.Errorf("last report = %+v", last)
+	}
+}
+
+func TestOutlookAuthHelper(t *testing.T) {
+	var polls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/tenant/oauth2/v2.0/devicecode":
+			if got, want := r.Form.Get("scope"), "https://graph.microsoft.com/Mail.Send offline_access"; got != want {
+				t.Errorf("scope = %q, want %q", got, want)
+			}
+			fmt.Fprint(w, `{"device_code":"dev","user_code":"ABCD-EFGH","verification_uri":"https://microsoft.com/devicelogin","expires_in":900,"interval":1}`)
+		case "/tenant/oauth2/v2.0/token":
+			if r.Form.Get("device_code") != "dev" || r.Form.Get("client_id") != "app" {
+				t.Errorf("token request form = %v", r.Form)
+			}
+			if polls++; polls == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"authorization_pending"}`)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"at","refresh_token":"rt","token_type":"Bearer","expires_in":3600}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	h := NewOutlookAuthHelper("tenant", "app")
+	h.Scopes = []string{"Mail.Send"}
+	h.HTTPClient = srv.Client()
+	h.authority = srv.URL + "/"
+	var prompted string
+	h.Prompt = func(uri, code string) { prompted = uri + " " + code }
+
+	tokenJSON, err := h.Authenticate()
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if prompted != "https://microsoft.com/devicelogin ABCD-EFGH" {
+		t.Errorf("prompted %q", prompted)
+	}
+	var tok struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(tokenJSON, &tok); err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "at" || tok.RefreshToken != "rt" || polls != 2 {
+		t.Errorf("token = %+v after %d polls", tok, polls)
+	}
+}
+
+// redirectTransport sends every request to the test server target.
+type redirectTransport struct{ target string }
+
+func (rt redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host = "http", strings.TrimPrefix(rt.target, "http://")
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestOutlookDelegatedToken(t *testing.T) {
+	var refreshed bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/tenant/oauth2/v2.0/token":
+			r.ParseForm()
+			if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != "rt" {
+				t.Errorf("token request form = %v", r.Form)
+			}
+			refreshed = true
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"access_token":"renewed","refresh_token":"rt2","token_type":"Bearer","expires_in":3600}`)
+		case strings.HasSuffix(r.URL.Path, "/sendMail"):
+			if got := r.Header.Get("Authorization"); got != "Bearer renewed" {
+				t.Errorf("Authorization = %q", got)
+			}
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	expired := `{"access_token":"old","refresh_token":"rt","token_type":"Bearer","expiry":"2020-01-01T00:00:00Z"}`
+	p, err := newOutlookProvider(&OutlookConfig{
+		TenantID:   "tenant",
+		ClientID:   "app",
+		TokenJSON:  []byte(expired),
+		HTTPClient: &http.Client{Transport: redirectTransport{srv.URL}},
+	})
+	if err != nil {
+		t.Fatalf("newOutlookProvider() error = %v", err)
+	}
+	msg := &Message{From: "me@example.com", To: []string{"you@example.com"}, Subject: "Hi", Body: "Hello"}
+	if err := p.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if !refreshed {
+		t.Error("expired token was not renewed")
+	}
+
+	_, err = newOutlookProvider(&OutlookConfig{TenantID: "tenant", ClientID: "app", TokenJSON: []byte(`{"access_token":"at"}`)})
+	if err == nil || !strings.Contains(err.Error(), "refresh token") {
+		t.Errorf("newOutlookProvider() without a refresh token: error = %v", err)
+	}
+}
+
+func TestOutlookRefreshToken(t *testing.T) {
+	var redeemed int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/tenant/oauth2/v2.0/token":
+			r.ParseForm()
+			if r.Form.Get("refresh_token") != "stored" || r.Form.Get("client_secret") != "secret" {
+				t.Errorf("token request form = %v", r.Form)
+			}
+			redeemed++
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"access_token":"at","refresh_token":"rotated","token_type":"Bearer","expires_in":3600}`)
+		case strings.HasSuffix(r.URL.Path, "/sendMail"):
+			if got := r.Header.Get("Authorization"); got != "Bearer at" {
+				t.Errorf("Authorization = %q", got)
+			}
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	var stored []string
+	p, err := newOutlookProvider(&OutlookConfig{
+		TenantID:       "tenant",
+		ClientID:       "app",
+		ClientSecret:   "secret",
+		RefreshToken:   "stored",
+		OnRefreshToken: func(rt string) { stored = append(stored, rt) },
+		HTTPClient:     &http.Client{Transport: redirectTransport{srv.URL}},
+	})
+	if err != nil {
+		t.Fatalf("newOutlookProvider() error = %v", err)
+	}
+	msg := &Message{From: "me@example.com", To: []string{"you@example.com"}, Subject: "Hi", Body: "Hello"}
+	for i := 0; i < 2; i++ {
+		if err := p.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+	if redeemed != 1 {
+		t.Errorf("refresh token redeemed %d times, want 1", redeemed)
+	}
+	if len(stored) != 1 || stored[0] != "rotated" {
+		t.Errorf("OnRefreshToken got %q, want the rotated token once", stored)
+	}
+
+	_, err = newOutlookProvider(&OutlookConfig{TenantID: "tenant", ClientID: "app", RefreshToken: "rt", TokenJSON: []byte(`{}`)})
+	if err == nil || !strings.Contains(err.Error(), "not both") {
+		t.Errorf("newOutlookProvider() with TokenJSON and RefreshToken: error = %v", err)
+	}
+}
+
+func TestOutlookSendOperation(t *testing.T) {
+	tests := []struct {
+		name       string
+		location   bool
+		statuses   []string
+		mime       bool
+		wantStatus string
+		wantErr    string
+		unknown    bool
+	}{
+		{name: "accepted"},
+		{name: "polled", location: true, statuses: []string{"running", "succeeded"}},
+		{name: "mime", location: true, mime: true, statuses: []string{"succeeded"}, wantStatus: "succeeded"},
+		{name: "failed", location: true, statuses: []string{"failed"}, wantErr: "send operation failed: message too large"},
+		{name: "poll error", location: true, statuses: []string{"error"}, wantErr: "poll send operation", unknown: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var polls int
+			p := newTestOutlook(t, func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case strings.HasSuffix(r.URL.Path, "/sendMail"):
+					if tt.location {
+						w.Header().Set("Location", "/v1.0/operations/op1")
+					}
+					w.WriteHeader(http.StatusAccepted)
+				case r.URL.Path == "/v1.0/operations/op1":
+					status := tt.statuses[polls]
+					polls++
+					w.Header().Set("Content-Type", "application/json")
+					if status == "error" {
+						w.WriteHeader(http.StatusBadRequest)
+						io.WriteString(w, `{"error":{"code":"BadRequest","message":"no such operation"}}`)
+						return
+					}
+					fmt.Fprintf(w, `{"id":"op1","status":%q,"statusDetail":"message too large"}`, status)
+				default:
+					http.NotFound(w, r)
+				}
+			})
+			msg := &Message{From: "me@example.com", To: []string{"you@example.com"}, Subject: "Hi", Body: "Hello"}
+			var status string
+			var err error
+			if tt.mime {
+				msg.Headers = map[string]string{"Keywords": "report"}
+				var res *SendResult
+				if res, err = p.SendWithResult(context.Background(), msg); res != nil {
+					status = res.Status
+				}
+			} else {
+				err = p.Send(context.Background(), msg)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				if errors.Is(err, ErrOutcomeUnknown) != tt.unknown {
+					t.Errorf("errors.Is(%v, ErrOutcomeUnknown) = %v, want %v", err, !tt.unknown, tt.unknown)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if polls != len(tt.statuses) {
+				t.Errorf("polled %d times, want %d", polls, len(tt.statuses))
+			}
+			if status != tt.wantStatus {
+				t.Errorf("SendResult.Status = %q, want %q", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestOutlookCredential(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer tok" {
+			t.Errorf("Authorization = %q", got)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	p, err := newOutlookProvider(&OutlookConfig{Credential: staticToken{}, HTTPClient: &http.Client{Transport: redirectTransport{srv.URL}}})
+	if err != nil {
+		t.Fatalf("newOutlookProvider() error = %v", err)
+	}
+	msg := &Message{From: "me@example.com", To: []string{"you@example.com"}, Subject: "Hi", Body: "Hello"}
+	if err := p.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	for _, config := range []*OutlookConfig{
+		{Credential: "not a credential"},
+		{Credential: staticToken{}, ClientSecret: "secret"},
+	} {
+		if _, err := newOutlookProvider(config); err == nil {
+			t.Errorf("newOutlookProvider(%+v) succeeded", config)
+		}
+	}
+}
+
+func TestOutlookAPIErrorHint(t *testing.T) {
+	o := newTestOutlook(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"error":{"code":"ErrorAccessDenied","message":"Access is denied."}}`)
+	})
+	msg := &Message{From: "me@example.com", To: []string{"you@example.com"}, Subject: "Hi", Body: "Hello"}
+	err := o.Send(context.Background(), msg)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "ErrorAccessDenied" || apiErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("Send() error = %v, want an *APIError for ErrorAccessDenied", err)
+	}
+	if !strings.Contains(ErrorHint(err), "Mail.Send") {
+		t.Errorf("ErrorHint() = %q", ErrorHint(err))
+	}
+}
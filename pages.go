@@ -0,0 +1,131 @@
+// pages.go - Lazy, page-at-a-time iteration over List and Search results.
+// Client.List and Client.Search load every matching message before
+// returning; Client.Messages instead fetches one page when the caller has
+// consumed the previous one, so walking a large folder holds a single page in
+// memory and stops fetching as soon as the caller stops.
+package email
+
+import (
+	"context"
+)
+
+// defaultPageSize is MessageQuery.PageSize's default.
+const defaultPageSize = 50
+
+// MessageQuery selects the messages Client.Messages iterates over.
+type MessageQuery struct {
+	// Search is a provider-native search query, as for Search. If empty,
+	// the messages of ListOptions.Folder are listed, as for List.
+	Search string
+
+	// ListOptions filters the messages. Limit caps the total number of
+	// messages iterated (0 means all).
+	ListOptions
+
+	// PageSize is the number of messages fetched per request. Defaults to 50.
+	PageSize int
+}
+
+// PageProvider is implemented by mailbox providers that can fetch List and
+// Search results one page at a time. Both built-in providers implement it.
+type PageProvider interface {
+	// ListPage returns the page of results for q starting at pageToken (""
+	// for the first page), holding up to q.PageSize messages, and the token
+	// of the following page ("" after the last page).
+	ListPage(ctx context.Context, q MessageQuery, pageToken string) ([]Summary, string, error)
+}
+
+// MessageIterator walks the results of a MessageQuery. Pages are fetched on
+// demand by Next; it is not safe for concurrent use.
+//
+// Example:
+//
+//	it := client.Messages(ctx, email.MessageQuery{ListOptions: email.ListOptions{Folder: "inbox"}})
+//	for it.Next() {
+//	    s := it.Summary()
+//	    fmt.Println(s.Received, s.Subject)
+//	}
+//	if err := it.Err(); err != nil {
+//	    log.Fatal(err)
+//	}
+type MessageIterator struct {
+	ctx   context.Context
+	query MessageQuery
+	fetch func(ctx context.Context, q MessageQuery, pageToken string) ([]Summary, string, error)
+
+	page  []Summary
+	cur   Summary
+	token string
+	seen  int
+	done  bool
+	err   error
+}
+
+// Messages returns an iterator over the messages matching q. Nothing is
+// fetched until the first call to Next. Providers that do not implement
+// PageProvider are read with a single List or Search call.
+func (c *Client) Messages(ctx context.Context, q MessageQuery) *MessageIterator {
+	if q.PageSize <= 0 {
+		q.PageSize = defaultPageSize
+	}
+	it := &MessageIterator{ctx: ctx, query: q}
+	r, err := c.receiver()
+	switch pp, ok := r.(PageProvider); {
+	case err != nil:
+		it.err, it.done = err, true
+	case ok:
+		it.fetch = pp.ListPage
+	default:
+		it.fetch = func(ctx context.Context, q MessageQuery, _ string) ([]Summary, string, error) {
+			if q.Search != "" {
+				s, err := r.Search(ctx, q.Search, q.ListOptions)
+				return s, "", err
+			}
+			s, err := r.List(ctx, q.ListOptions)
+			return s, "", err
+		}
+	}
+	return it
+}
+
+// Next advances to the next message, fetching the next page if needed. It
+// returns false when the results are exhausted, Limit is reached or an
+// error occurred; check Err afterwards.
+func (it *MessageIterator) Next() bool {
+	if it.query.Limit > 0 && it.seen >= it.query.Limit {
+		it.done = true
+	}
+	for len(it.page) == 0 {
+		if it.done {
+			return false
+		}
+		if err := it.ctx.Err(); err != nil {
+			it.err, it.done = err, true
+			return false
+		}
+		q := it.query
+		if q.Limit > 0 {
+			q.PageSize = min(q.PageSize, q.Limit-it.seen)
+		}
+		page, next, err := it.fetch(it.ctx, q, it.token)
+		if err != nil {
+			it.err, it.done = err, true
+			return false
+		}
+		it.page, it.token = page, next
+		it.done = next == ""
+	}
+	it.cur, it.page = it.page[0], it.page[1:]
+	it.seen++
+	return true
+}
+
+// Summary returns the current message.
+func (it *MessageIterator) Summary() Summary {
+	return it.cur
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *MessageIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,47 @@
+//go:build !email_no_gmail
+
+package email
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGmailListPage(t *testing.T) {
+	var listQueries []string
+	provider := newTestGmail(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if id, ok := strings.CutPrefix(r.URL.Path, "/gmail/v1/users/me/messages/"); ok {
+			fmt.Fprintf(w, `{"id":%q,"payload":{"headers":[{"name":"Subject","value":"msg %s"}]}}`, id, id)
+			return
+		}
+		listQueries = append(listQueries, r.URL.RawQuery)
+		if r.URL.Query().Get("pageToken") == "" {
+			io.WriteString(w, `{"messages":[{"id":"m1"},{"id":"m2"}],"nextPageToken":"p2"}`)
+		} else {
+			io.WriteString(w, `{"messages":[{"id":"m3"}]}`)
+		}
+	})
+
+	q := MessageQuery{ListOptions: ListOptions{UnreadOnly: true}, PageSize: 2}
+	it := (&Client{provider: provider}).Messages(context.Background(), q)
+	var subjects []string
+	for it.Next() {
+		subjects = append(subjects, it.Summary().Subject)
+	}
+	if it.Err() != nil {
+		t.Fatalf("Err() = %v", it.Err())
+	}
+	if want := []string{"msg m1", "msg m2", "msg m3"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("subjects = %v, want %v", subjects, want)
+	}
+	if len(listQueries) != 2 || !strings.Contains(listQueries[0], "labelIds=INBOX") ||
+		!strings.Contains(listQueries[0], "maxResults=2") || !strings.Contains(listQueries[1], "pageToken=p2") {
+		t.Errorf("list requests = %q", listQueries)
+	}
+}
@@ -0,0 +1,41 @@
+//go:build go1.23
+
+// pages_iter.go - Range-over-func access to Client.Messages, for Go 1.23
+// and later. Breaking out of the loop stops fetching, as with Next.
+package email
+
+import (
+	"context"
+	"iter"
+)
+
+// All returns the remaining messages as an iterator of (message, nil)
+// pairs. If the iteration fails, it yields one last (zero Summary, error)
+// pair, the error Err reports.
+//
+// Example:
+//
+//	for s, err := range client.Messages(ctx, q).All() {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    fmt.Println(s.Received, s.Subject)
+//	}
+func (it *MessageIterator) All() iter.Seq2[Summary, error] {
+	return func(yield func(Summary, error) bool) {
+		for it.Next() {
+			if !yield(it.Summary(), nil) {
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			yield(Summary{}, err)
+		}
+	}
+}
+
+// AllMessages is Messages(ctx, q).All(): an iterator over the messages
+// matching q, fetched a page at a time as the loop consumes them.
+func (c *Client) AllMessages(ctx context.Context, q MessageQuery) iter.Seq2[Summary, error] {
+	return c.Messages(ctx, q).All()
+}
@@ -0,0 +1,47 @@
+//go:build go1.23
+
+package email
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestClientAllMessages(t *testing.T) {
+	t.Run("early break", func(t *testing.T) {
+		mb := &pagedMailbox{total: 100}
+		var ids []string
+		for s, err := range (&Client{provider: mb}).AllMessages(context.Background(), MessageQuery{PageSize: 3}) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, s.ID)
+			if len(ids) == 4 {
+				break
+			}
+		}
+		if want := []string{"0", "1", "2", "3"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("ids = %v, want %v", ids, want)
+		}
+		if len(mb.fetches) != 2 {
+			t.Errorf("fetched %d pages, want 2", len(mb.fetches))
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		mb := &pagedMailbox{total: 5, failAt: "2"}
+		var ids []string
+		var errs []error
+		for s, err := range (&Client{provider: mb}).AllMessages(context.Background(), MessageQuery{PageSize: 2}) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			ids = append(ids, s.ID)
+		}
+		if len(ids) != 2 || len(errs) != 1 || errs[0].Error() != "page failed" {
+			t.Errorf("got ids %v and errors %v, want 2 ids then the page error", ids, errs)
+		}
+	})
+}
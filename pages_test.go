@@ -0,0 +1,103 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// pagedMailbox serves total messages in pages through ListPage.
+type pagedMailbox struct {
+	mockMailbox
+	total   int
+	fetches []string // page tokens requested
+	failAt  string
+}
+
+func (m *pagedMailbox) ListPage(_ context.Context, q MessageQuery, token string) ([]Summary, string, error) {
+	m.fetches = append(m.fetches, token)
+	if token == m.failAt && m.failAt != "" {
+		return nil, "", errors.New("page failed")
+	}
+	start, _ := strconv.Atoi(token)
+	end := min(start+q.PageSize, m.total)
+	var page []Summary
+	for i := start; i < end; i++ {
+		page = append(page, Summary{ID: strconv.Itoa(i)})
+	}
+	next := ""
+	if end < m.total {
+		next = strconv.Itoa(end)
+	}
+	return page, next, nil
+}
+
+func collectIDs(it *MessageIterator) []string {
+	var ids []string
+	for it.Next() {
+		ids = append(ids, it.Summary().ID)
+	}
+	return ids
+}
+
+func TestClientMessages(t *testing.T) {
+	t.Run("pages lazily", func(t *testing.T) {
+		mb := &pagedMailbox{total: 5}
+		it := (&Client{provider: mb}).Messages(context.Background(), MessageQuery{PageSize: 2})
+		if len(mb.fetches) != 0 {
+			t.Fatal("fetched before Next")
+		}
+		it.Next()
+		it.Next()
+		if len(mb.fetches) != 1 {
+			t.Errorf("fetched %d pages for 2 messages, want 1", len(mb.fetches))
+		}
+		ids := append([]string{"0", "1"}, collectIDs(it)...)
+		if want := []string{"0", "1", "2", "3", "4"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("ids = %v, want %v", ids, want)
+		}
+		if want := []string{"", "2", "4"}; !reflect.DeepEqual(mb.fetches, want) {
+			t.Errorf("page tokens = %q, want %q", mb.fetches, want)
+		}
+		if it.Err() != nil {
+			t.Errorf("Err() = %v", it.Err())
+		}
+	})
+
+	t.Run("limit across pages", func(t *testing.T) {
+		mb := &pagedMailbox{total: 100}
+		q := MessageQuery{PageSize: 4, ListOptions: ListOptions{Limit: 6}}
+		ids := collectIDs((&Client{provider: mb}).Messages(context.Background(), q))
+		if len(ids) != 6 || len(mb.fetches) != 2 {
+			t.Errorf("got %d messages in %d fetches, want 6 in 2", len(ids), len(mb.fetches))
+		}
+	})
+
+	t.Run("page error", func(t *testing.T) {
+		mb := &pagedMailbox{total: 10, failAt: "3"}
+		it := (&Client{provider: mb}).Messages(context.Background(), MessageQuery{PageSize: 3})
+		if ids := collectIDs(it); len(ids) != 3 {
+			t.Errorf("got %d messages before the error, want 3", len(ids))
+		}
+		if it.Err() == nil || it.Next() {
+			t.Errorf("Err() = %v, want the page error and no further messages", it.Err())
+		}
+	})
+
+	t.Run("fallback to List", func(t *testing.T) {
+		mb := &mockMailbox{summ: []Summary{{ID: "a"}, {ID: "b"}}}
+		ids := collectIDs((&Client{provider: mb}).Messages(context.Background(), MessageQuery{ListOptions: ListOptions{Folder: "Archive"}}))
+		if !reflect.DeepEqual(ids, []string{"a", "b"}) || mb.listOpts.Folder != "Archive" {
+			t.Errorf("ids = %v, opts = %+v", ids, mb.listOpts)
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		it := (&Client{provider: &mockProvider{}}).Messages(context.Background(), MessageQuery{})
+		if it.Next() || !errors.Is(it.Err(), ErrUnsupported) {
+			t.Errorf("Err() = %v, want ErrUnsupported", it.Err())
+		}
+	})
+}
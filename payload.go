@@ -0,0 +1,42 @@
+// payload.go - Provider requests built without a Client. A system that
+// composes, signs or queues messages in one service and transmits them from
+// another can render a Message into the HTTP request a provider's API takes
+// (BuildGraphPayload, BuildGmailPayload) and hand that on; the transmitting
+// side only adds the endpoint's host and an access token.
+package email
+
+import "fmt"
+
+// Payload is an HTTP request that sends a message through a provider's API.
+type Payload struct {
+	// Method is the HTTP method, POST for both providers.
+	Method string
+
+	// Path is the request path, relative to the API's host: Graph's
+	// "https://graph.microsoft.com/v1.0" (or a national cloud's) and
+	// Gmail's "https://gmail.googleapis.com".
+	Path string
+
+	// ContentType is the Content-Type of Body.
+	ContentType string
+
+	// Body is the request body.
+	Body []byte
+}
+
+// preparePayload returns msg repaired and validated as a send would, for a
+// payload builder. Steps that follow the send itself, Outlook's SentFolder
+// and Gmail's Labels, cannot be part of a payload and are rejected.
+func preparePayload(msg *Message) (*Message, error) {
+	msg = repairText(msg)
+	if err := msg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	if msg.SentFolder != "" {
+		return nil, fmt.Errorf("payload: SentFolder is applied after sending, which a payload cannot do: %w", ErrUnsupported)
+	}
+	if len(msg.Labels) > 0 {
+		return nil, fmt.Errorf("payload: Labels are applied after sending, which a payload cannot do: %w", ErrUnsupported)
+	}
+	return msg, nil
+}
@@ -0,0 +1,213 @@
+// pgp.go - OpenPGP signing and encryption as PGP/MIME (RFC 3156). Signed
+// messages are a multipart/signed of the content and a detached signature;
+// encrypted ones a multipart/encrypted whose payload is the content,
+// signed as well when a signing key is configured. Like S/MIME, sealing
+// happens where messages are rendered, so it covers every raw submission
+// path (Gmail API and SMTP relay, direct delivery, Outlook's MIME path).
+//
+// The OpenPGP implementation is github.com/ProtonMail/go-crypto/openpgp, the
+// maintained successor of the deprecated golang.org/x/crypto/openpgp, which
+// also reads modern keys such as Ed25519 with Curve25519 encryption subkeys.
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// PGPConfig holds the OpenPGP keys messages are signed and encrypted with.
+// Only the body and attachments are protected: the subject and other
+// header fields travel in clear.
+type PGPConfig struct {
+	// SigningKey is the sender's armored private key. When set, messages
+	// are signed.
+	SigningKey []byte
+
+	// Passphrase unlocks SigningKey if it is protected.
+	Passphrase []byte
+
+	// Encrypt encrypts messages to every recipient's public key, and to the
+	// signing key so that the sent copy stays readable. Sending to a
+	// recipient without a key in RecipientKeys fails. The key ids of Bcc
+	// recipients are visible to every recipient.
+	Encrypt bool
+
+	// RecipientKeys are armored public keys (each entry may hold several),
+	// matched to recipients by the email addresses of their user ids.
+	RecipientKeys [][]byte
+}
+
+// pgpSealer signs and encrypts messages per a PGPConfig.
+type pgpSealer struct {
+	signer  *openpgp.Entity
+	encrypt bool
+	keys    map[string]*openpgp.Entity // by lowercased address
+	config  *packet.Config
+}
+
+// newPGPSealer parses and unlocks config's keys.
+func newPGPSealer(config *PGPConfig) (*pgpSealer, error) {
+	s := &pgpSealer{
+		encrypt: config.Encrypt,
+		keys:    make(map[string]*openpgp.Entity),
+		config:  &packet.Config{DefaultHash: crypto.SHA256},
+	}
+	if len(config.SigningKey) > 0 {
+		ring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(config.SigningKey))
+		if err != nil {
+			return nil, fmt.Errorf("pgp: invalid signing key: %w", err)
+		}
+		for _, e := range ring {
+			if e.PrivateKey != nil {
+				s.signer = e
+				break
+			}
+		}
+		if s.signer == nil {
+			return nil, fmt.Errorf("pgp: signing key has no private key")
+		}
+		if err := unlockPGPEntity(s.signer, config.Passphrase); err != nil {
+			return nil, err
+		}
+	}
+	if !s.encrypt && s.signer == nil {
+		return nil, fmt.Errorf("pgp: neither a signing key nor encryption configured")
+	}
+	for i, armored := range config.RecipientKeys {
+		ring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(armored))
+		if err != nil {
+			return nil, fmt.Errorf("pgp: invalid recipient key %d: %w", i, err)
+		}
+		for _, e := range ring {
+			for _, id := range e.Identities {
+				if id.UserId != nil && id.UserId.Email != "" {
+					s.keys[strings.ToLower(id.UserId.Email)] = e
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+// unlockPGPEntity decrypts e's private keys with passphrase.
+func unlockPGPEntity(e *openpgp.Entity, passphrase []byte) error {
+	keys := []*packet.PrivateKey{e.PrivateKey}
+	for _, sub := range e.Subkeys {
+		keys = append(keys, sub.PrivateKey)
+	}
+	for _, k := range keys {
+		if k == nil || !k.Encrypted {
+			continue
+		}
+		if err := k.Decrypt(passphrase); err != nil {
+			return fmt.Errorf("pgp: unlocking signing key: %w", err)
+		}
+	}
+	return nil
+}
+
+// recipientKeys returns the public keys msg is encrypted to.
+func (s *pgpSealer) recipientKeys(msg *Message) ([]*openpgp.Entity, error) {
+	var to []*openpgp.Entity
+	for _, r := range messageRecipients(msg) {
+		addr := strings.ToLower(parseAddr(r))
+		key, ok := s.keys[addr]
+		if !ok {
+			return nil, fmt.Errorf("pgp: no public key for recipient %s", addr)
+		}
+		to = append(to, key)
+	}
+	if s.signer != nil {
+		to = append(to, s.signer)
+	}
+	return to, nil
+}
+
+// check returns an error if msg is to be encrypted and a recipient has no
+// key.
+func (s *pgpSealer) check(msg *Message) error {
+	if !s.encrypt {
+		return nil
+	}
+	_, err := s.recipientKeys(msg)
+	return err
+}
+
+// write renders msg per opts and writes it to w as a PGP/MIME message.
+func (s *pgpSealer) write(w io.Writer, msg *Message, opts rawOptions) error {
+	outer, content, boundary, err := contentEntity(msg, opts)
+	if err != nil {
+		return err
+	}
+	if s.encrypt {
+		return s.writeEncrypted(w, msg, outer, content, boundary+"-encrypted")
+	}
+
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, s.signer, bytes.NewReader(content), s.config); err != nil {
+		return fmt.Errorf("pgp: signing: %w", err)
+	}
+	boundary += "-signed"
+	out := bufio.NewWriter(w)
+	out.WriteString(outer)
+	out.WriteString(`Content-Type: multipart/signed; micalg=pgp-sha256; protocol="application/pgp-signature"; boundary=` + boundary + "\r\n\r\n")
+	out.WriteString("--" + boundary + "\r\n")
+	out.Write(content)
+	out.WriteString("\r\n--" + boundary + "\r\n")
+	out.WriteString("Content-Type: application/pgp-signature; name=signature.asc\r\n")
+	out.WriteString("Content-Description: OpenPGP digital signature\r\n")
+	out.WriteString("Content-Disposition: attachment; filename=signature.asc\r\n\r\n")
+	out.Write(canonicalCRLF(sig.Bytes()))
+	out.WriteString("\r\n--" + boundary + "--\r\n")
+	return out.Flush()
+}
+
+// writeEncrypted writes the multipart/encrypted message of content, signed
+// inside the encryption if there is a signing key.
+func (s *pgpSealer) writeEncrypted(w io.Writer, msg *Message, outer string, content []byte, boundary string) error {
+	to, err := s.recipientKeys(msg)
+	if err != nil {
+		return err
+	}
+	var armored bytes.Buffer
+	aw, err := armor.Encode(&armored, "PGP MESSAGE", nil)
+	if err != nil {
+		return err
+	}
+	pw, err := openpgp.Encrypt(aw, to, s.signer, nil, s.config)
+	if err != nil {
+		return fmt.Errorf("pgp: encrypting: %w", err)
+	}
+	if _, err := pw.Write(content); err != nil {
+		return fmt.Errorf("pgp: encrypting: %w", err)
+	}
+	if err := pw.Close(); err != nil {
+		return fmt.Errorf("pgp: encrypting: %w", err)
+	}
+	if err := aw.Close(); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	out.WriteString(outer)
+	out.WriteString(`Content-Type: multipart/encrypted; protocol="application/pgp-encrypted"; boundary=` + boundary + "\r\n\r\n")
+	out.WriteString("--" + boundary + "\r\n")
+	out.WriteString("Content-Type: application/pgp-encrypted\r\n")
+	out.WriteString("Content-Description: PGP/MIME version identification\r\n\r\n")
+	out.WriteString("Version: 1\r\n\r\n")
+	out.WriteString("--" + boundary + "\r\n")
+	out.WriteString("Content-Type: application/octet-stream; name=encrypted.asc\r\n")
+	out.WriteString("Content-Description: OpenPGP encrypted message\r\n")
+	out.WriteString("Content-Disposition: inline; filename=encrypted.asc\r\n\r\n")
+	out.Write(canonicalCRLF(armored.Bytes()))
+	out.WriteString("\r\n--" + boundary + "--\r\n")
+	return out.Flush()
+}
@@ -0,0 +1,232 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// testPGPKey returns a new entity for addr, of the key type of config (RSA
+// if nil), with its armored private and public keys.
+func testPGPKey(t *testing.T, addr string, config *packet.Config) (e *openpgp.Entity, private, public []byte) {
+	t.Helper()
+	e, err := openpgp.NewEntity("Test", "", addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var priv, pub bytes.Buffer
+	w, _ := armor.Encode(&priv, openpgp.PrivateKeyType, nil)
+	if err := e.SerializePrivate(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	w, _ = armor.Encode(&pub, openpgp.PublicKeyType, nil)
+	if err := e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return e, priv.Bytes(), pub.Bytes()
+}
+
+// pgpParts returns the content type parameters and raw parts of a rendered
+// multipart message.
+func pgpParts(t *testing.T, raw []byte) (string, map[string]string, [][]byte) {
+	t.Helper()
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(m.Body)
+	// Split by hand: a signature covers the part's exact bytes, headers
+	// included, which multipart.Reader does not expose.
+	var parts [][]byte
+	for _, p := range bytes.Split(body, []byte("--"+params["boundary"]))[1:] {
+		if bytes.HasPrefix(p, []byte("--")) {
+			break
+		}
+		p = bytes.TrimPrefix(p, []byte("\r\n"))
+		parts = append(parts, bytes.TrimSuffix(p, []byte("\r\n")))
+	}
+	return mediaType, params, parts
+}
+
+func TestPGPSign(t *testing.T) {
+	sender, priv, _ := testPGPKey(t, "legal@example.com", nil)
+	s, err := newPGPSealer(&PGPConfig{SigningKey: priv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &Message{From: "legal@example.com", To: []string{"client@example.com"}, Subject: "Letter",
+		Body: "Dear client,\nsee attached — signed.\n", seal: s,
+		Attachments: []Attachment{{Filename: "letter.pdf", Content: []byte("%PDF")}}}
+	raw, err := buildRawMessage(msg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, parts := pgpParts(t, raw)
+	if mediaType != "multipart/signed" || params["protocol"] != "application/pgp-signature" || params["micalg"] != "pgp-sha256" {
+		t.Fatalf("Content-Type = %s %v", mediaType, params)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts", len(parts))
+	}
+	_, sig, _ := bytes.Cut(parts[1], []byte("\r\n\r\n"))
+	if _, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{sender}, bytes.NewReader(parts[0]), bytes.NewReader(sig), nil); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+	if !bytes.HasPrefix(parts[0], []byte("Content-Type: multipart/mixed")) {
+		t.Errorf("signed part:\n%s", parts[0])
+	}
+}
+
+func TestPGPEncrypt(t *testing.T) {
+	sender, priv, _ := testPGPKey(t, "legal@example.com", nil)
+	recipient, _, pub := testPGPKey(t, "client@example.com", nil)
+	s, err := newPGPSealer(&PGPConfig{SigningKey: priv, Encrypt: true, RecipientKeys: [][]byte{pub}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &Message{From: "legal@example.com", To: []string{"Client <client@example.com>"}, Subject: "Letter",
+		Body: "Privileged and confidential.", seal: s}
+	if err := s.check(msg); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := buildRawMessage(msg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("Privileged")) {
+		t.Fatal("body in clear")
+	}
+	mediaType, params, parts := pgpParts(t, raw)
+	if mediaType != "multipart/encrypted" || params["protocol"] != "application/pgp-encrypted" || len(parts) != 2 {
+		t.Fatalf("Content-Type = %s %v, %d parts", mediaType, params, len(parts))
+	}
+	if !bytes.Contains(parts[0], []byte("Version: 1")) {
+		t.Errorf("control part:\n%s", parts[0])
+	}
+
+	// Both the recipient and the sender (for the sent copy) can decrypt it,
+	// and the signature inside verifies.
+	for name, key := range map[string]*openpgp.Entity{"recipient": recipient, "sender": sender} {
+		_, payload, _ := bytes.Cut(parts[1], []byte("\r\n\r\n"))
+		block, err := armor.Decode(bytes.NewReader(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		md, err := openpgp.ReadMessage(block.Body, openpgp.EntityList{key, sender}, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		plain, err := io.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !md.IsSigned || md.SignatureError != nil {
+			t.Errorf("%s: signed = %v, signature error = %v", name, md.IsSigned, md.SignatureError)
+		}
+		pm, err := mail.ReadMessage(bytes.NewReader(plain))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct, _, _ := mime.ParseMediaType(pm.Header.Get("Content-Type")); ct != "text/plain" {
+			t.Errorf("%s: decrypted Content-Type %q", name, ct)
+		}
+		if b, _ := io.ReadAll(pm.Body); string(b) != "Privileged and confidential." {
+			t.Errorf("%s: decrypted body %q", name, b)
+		}
+	}
+
+	unknown := &Message{From: "legal@example.com", To: []string{"client@example.com"}, Bcc: []string{"other@example.com"},
+		Subject: "s", Body: "b"}
+	if err := s.check(unknown); err == nil || !strings.Contains(err.Error(), "other@example.com") {
+		t.Errorf("check() = %v, want missing key error", err)
+	}
+}
+
+func TestPGPEd25519(t *testing.T) {
+	// Ed25519 signing keys with Curve25519 encryption subkeys, the default
+	// of current GnuPG.
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	sender, priv, _ := testPGPKey(t, "legal@example.com", config)
+	recipient, _, pub := testPGPKey(t, "client@example.com", config)
+	if sub := recipient.Subkeys; len(sub) != 1 || sub[0].PublicKey.PubKeyAlgo != packet.PubKeyAlgoECDH {
+		t.Fatalf("recipient subkeys = %+v", sub)
+	}
+	s, err := newPGPSealer(&PGPConfig{SigningKey: priv, Encrypt: true, RecipientKeys: [][]byte{pub}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &Message{From: "legal@example.com", To: []string{"client@example.com"}, Subject: "Letter",
+		Body: "Privileged and confidential.", seal: s}
+	raw, err := buildRawMessage(msg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, parts := pgpParts(t, raw)
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts", len(parts))
+	}
+	_, payload, _ := bytes.Cut(parts[1], []byte("\r\n\r\n"))
+	block, err := armor.Decode(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := openpgp.ReadMessage(block.Body, openpgp.EntityList{recipient, sender}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !md.IsSigned || md.SignatureError != nil {
+		t.Errorf("signed = %v, signature error = %v", md.IsSigned, md.SignatureError)
+	}
+	if !bytes.HasSuffix(plain, []byte("Privileged and confidential.")) {
+		t.Errorf("decrypted:\n%s", plain)
+	}
+}
+
+func TestClientSendPGP(t *testing.T) {
+	_, priv, _ := testPGPKey(t, "legal@example.com", nil)
+	s, err := newPGPSealer(&PGPConfig{SigningKey: priv, Encrypt: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := &mockProvider{}
+	c := &Client{provider: mock, sealer: s}
+	msg := &Message{From: "legal@example.com", To: []string{"client@example.com"}, Subject: "s", Body: "b"}
+	if err := c.SendWithContext(context.Background(), msg); err == nil {
+		t.Error("expected error sending to a recipient without a key")
+	}
+	if len(mock.calls) != 0 {
+		t.Error("message was sent")
+	}
+}
+
+func TestNewPGPSealerErrors(t *testing.T) {
+	_, _, pub := testPGPKey(t, "a@example.com", nil)
+	for name, config := range map[string]*PGPConfig{
+		"nothing to do":      {},
+		"public signing key": {SigningKey: pub},
+		"garbage":            {SigningKey: []byte("not a key")},
+		"garbage recipient":  {Encrypt: true, RecipientKeys: [][]byte{[]byte("x")}},
+	} {
+		if _, err := newPGPSealer(config); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
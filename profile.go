@@ -0,0 +1,384 @@
+// profile.go - Layered configuration profiles. LoadConfig resolves a Config
+// from a base file, an optional per-environment overlay and environment
+// variable overrides, so the differences between dev, staging and prod live
+// in one structured place:
+//
+//	email.json          base settings shared by every environment
+//	email.prod.json     overlay for LoadConfig("prod")
+//	EMAIL_* / OUTLOOK_* / GMAIL_* variables override both
+//
+// Overlays are JSON merge patches (RFC 7386): objects merge key by key, any
+// other value replaces the base value, and null removes it.
+package email
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// configProfile is the file representation of a Config. The doc, env,
+// required, secret and enum tags describe each field for ConfigSchema.
+type configProfile struct {
+	Provider   string             `json:"provider" doc:"Default provider for sending." env:"EMAIL_PROVIDER" required:"true" enum:"outlook365,gmail,direct"`
+	Outlook    *outlookProfile    `json:"outlook" doc:"Microsoft 365 settings, used when provider is outlook365."`
+	Gmail      *gmailProfile      `json:"gmail" doc:"Gmail settings, used when provider is gmail."`
+	Direct     *directProfile     `json:"direct" doc:"Direct-to-MX delivery settings, used when provider is direct."`
+	Routes     []routeProfile     `json:"routes" doc:"Recipient-domain routes to other providers; the first route matching every recipient is used."`
+	Deployment *deploymentProfile `json:"deployment" doc:"Deployment metadata stamped as headers on every message."`
+	Recipients *recipientProfile  `json:"recipient_policy" doc:"Checks on recipients before each send."`
+	Budget     *budgetProfile     `json:"send_budget" doc:"Hard cap on the messages sent, against runaway jobs."`
+}
+
+type outlookProfile struct {
+	TenantID     string `json:"tenant_id" doc:"Azure AD tenant (directory) ID." env:"OUTLOOK_TENANT_ID" required:"true"`
+	ClientID     string `json:"client_id" doc:"Azure AD application (client) ID." env:"OUTLOOK_CLIENT_ID" required:"true"`
+	ClientSecret string `json:"client_secret" doc:"Azure AD application client secret." env:"OUTLOOK_CLIENT_SECRET" required:"true" secret:"true"`
+	UserID       string `json:"user_id" doc:"Mailbox that reading and management operations act on; sending uses each message's From."`
+	Cloud        string `json:"cloud" doc:"National cloud; empty for the global service." env:"OUTLOOK_CLOUD" enum:",public,usgovhigh,usgovdod,china"`
+	BaseURL      string `json:"base_url" doc:"Graph API base URL override, e.g. for a local mock."`
+
+	// SharedThrottle paces the client with SharedGraphThrottle, so that
+	// profiles of the same app and tenant share Microsoft's limits.
+	SharedThrottle bool `json:"shared_throttle" doc:"Share one Graph request throttle with the other clients of this app and tenant."`
+}
+
+type gmailProfile struct {
+	CredentialsFile string       `json:"credentials_file" doc:"Path of the OAuth2 client credentials JSON from Google Cloud Console." env:"GMAIL_CREDENTIALS_FILE" required:"true"`
+	TokenFile       string       `json:"token_file" doc:"Path of the stored OAuth2 token JSON." env:"GMAIL_TOKEN_FILE" secret:"true"`
+	Scopes          []string     `json:"scopes" doc:"OAuth2 scopes to request; defaults to gmail.send and gmail.modify."`
+	SMTPRelay       bool         `json:"smtp_relay" doc:"Send through Gmail's SMTP server with XOAUTH2 instead of the API."`
+	SMTPAddr        string       `json:"smtp_addr" doc:"SMTP server host:port; defaults to smtp.gmail.com:587."`
+	SMTPUser        string       `json:"smtp_user" doc:"SMTP login; defaults to the From address."`
+	SMTPSecurity    SMTPSecurity `json:"smtp_security" doc:"SMTP connection security; empty picks it from the port." enum:",tls,starttls,opportunistic"`
+	SMTPPins        []string     `json:"smtp_pins" doc:"Base64 SHA-256 hashes of the SMTP server's public key, one of which must match."`
+	DailyLimit      int          `json:"daily_limit" doc:"Messages each account may send per day before sends are refused locally; 0 for no local limit."`
+	SentLabels      []string     `json:"sent_labels" doc:"Labels applied to every sent message, e.g. automated/outbound; created if missing."`
+	VerifySendAs    bool         `json:"verify_send_as" doc:"Fail sends whose From is not a verified send-as alias of the account, instead of Gmail rewriting the sender."`
+	BaseURL         string       `json:"base_url" doc:"Gmail API base URL override, e.g. for a local mock."`
+}
+
+type directProfile struct {
+	Hostname       string            `json:"hostname" doc:"Name announced in EHLO, matching the sending IP's reverse DNS; defaults to the host name."`
+	DKIM           *dkimProfile      `json:"dkim" doc:"DKIM signing key for outgoing messages."`
+	DisableMTASTS  bool              `json:"disable_mta_sts" doc:"Skip MTA-STS policy lookups."`
+	DNSSECResolver string            `json:"dnssec_resolver" doc:"DNSSEC-validating resolver (host:port) for DANE TLSA lookups; DANE is off when empty."`
+	RetrySchedule  []profileDuration `json:"retry_schedule" doc:"Delays between delivery retries after temporary failures."`
+	GreylistRetry  []profileDuration `json:"greylist_retry_schedule" doc:"Delays between retries after greylisting."`
+	MaxQueueTime   profileDuration   `json:"max_queue_time" doc:"How long a deferred delivery is retried before it bounces; defaults to 5 days."`
+	IPPools        map[string]IPPool `json:"ip_pools" doc:"Named pools of local addresses to send from, selected per message."`
+	DefaultIPPool  string            `json:"default_ip_pool" doc:"Pool for messages that name none."`
+}
+
+type dkimProfile struct {
+	Domain         string   `json:"domain" doc:"Signing domain (d=)." required:"true"`
+	Selector       string   `json:"selector" doc:"Key selector (s=)." required:"true"`
+	PrivateKeyFile string   `json:"private_key_file" doc:"Path of the PEM private key (RSA or Ed25519)." required:"true" secret:"true"`
+	Headers        []string `json:"headers" doc:"Header fields to sign; defaults to the recommended set."`
+}
+
+type deploymentProfile struct {
+	AppVersion  string            `json:"app_version" doc:"Application version, sent as X-App-Version."`
+	Environment string            `json:"environment" doc:"Deployment environment, sent as X-Environment."`
+	Commit      string            `json:"commit" doc:"Source commit, sent as X-Git-Commit."`
+	Headers     map[string]string `json:"headers" doc:"Further headers to stamp on every message."`
+}
+
+type recipientProfile struct {
+	Role              PolicyAction `json:"role" doc:"Action for role accounts (info@, sales@)." enum:"allow,warn,reject"`
+	RoleAccounts      []string     `json:"role_accounts" doc:"Local parts added to the built-in role account list."`
+	Disposable        PolicyAction `json:"disposable" doc:"Action for disposable email domains." enum:"allow,warn,reject"`
+	DisposableDomains []string     `json:"disposable_domains" doc:"Domains added to the built-in disposable list."`
+	Free              PolicyAction `json:"free" doc:"Action for free webmail domains." enum:"allow,warn,reject"`
+	FreeDomains       []string     `json:"free_domains" doc:"Domains added to the built-in free webmail list."`
+	Allow             []string     `json:"allow" doc:"Recipient patterns exempt from the checks."`
+	Deny              []string     `json:"deny" doc:"Recipient patterns always rejected."`
+}
+
+type budgetProfile struct {
+	PerHour int  `json:"per_hour" doc:"Maximum messages in any 60 minutes; 0 for no limit."`
+	PerDay  int  `json:"per_day" doc:"Maximum messages in any 24 hours; 0 for no limit."`
+	Latch   bool `json:"latch" doc:"Once a limit is hit, refuse every send until the budget is reset."`
+}
+
+type routeProfile struct {
+	Name    string         `json:"name" doc:"Route name for SendVia; defaults to the route's provider."`
+	Domains []string       `json:"domains" doc:"Recipient patterns: domains, *.subdomain wildcards or address globs."`
+	Config  *configProfile `json:"config" doc:"Provider configuration of the route; routes cannot be nested." required:"true"`
+}
+
+// profileDuration is a time.Duration written as a string ("15m", "120h").
+type profileDuration time.Duration
+
+func (d *profileDuration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"15m\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = profileDuration(v)
+	return nil
+}
+
+// LoadConfig resolves the configuration for env ("dev", "prod", ...; the
+// EMAIL_ENV variable if empty). It reads email.json and email.<env>.json from
+// the EMAIL_CONFIG_DIR directory (default "."), merges the overlay onto the
+// base and applies environment variable overrides (EMAIL_PROVIDER and the
+// OUTLOOK_* / GMAIL_* variables of ConfigFromEnv). Either file may be
+// missing, but not both. Relative file paths in the files are resolved
+// against the config directory.
+//
+// Example email.json:
+//
+//	{
+//	  "provider": "outlook365",
+//	  "outlook": {"tenant_id": "...", "client_id": "...", "user_id": "info@example.com"},
+//	  "routes": [{"domains": ["*@gmail.com"], "config": {"provider": "gmail",
+//	    "gmail": {"credentials_file": "credentials.json", "token_file": "token.json"}}}]
+//	}
+//
+// and email.dev.json, pointing development at a mock Graph server:
+//
+//	{"outlook": {"base_url": "http://localhost:8080/v1.0"}, "routes": null}
+func LoadConfig(env string) (*Config, error) {
+	dir, paths := profilePaths(env)
+	var merged any
+	found := false
+	for _, path := range paths {
+		layer, ok, err := readProfileLayer(path)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			merged, found = mergePatch(merged, layer), true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no configuration found in %s for environment %q", dir, env)
+	}
+
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	var p configProfile
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	p.resolvePaths(dir)
+	p.applyEnv()
+	return p.config()
+}
+
+// profilePaths returns the config directory and the layer files for env, base
+// first.
+func profilePaths(env string) (string, []string) {
+	if env == "" {
+		env = os.Getenv("EMAIL_ENV")
+	}
+	dir := os.Getenv("EMAIL_CONFIG_DIR")
+	if dir == "" {
+		dir = "."
+	}
+	paths := []string{filepath.Join(dir, "email.json")}
+	if env != "" {
+		paths = append(paths, filepath.Join(dir, "email."+env+".json"))
+	}
+	return dir, paths
+}
+
+// readProfileLayer reads one JSON layer; a missing file is not an error.
+func readProfileLayer(path string) (any, bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("read %s: %w", path, err)
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, false, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return v, true, nil
+}
+
+// mergePatch applies an RFC 7386 JSON merge patch to target.
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// resolvePaths makes relative file paths relative to dir.
+func (p *configProfile) resolvePaths(dir string) {
+	abs := func(path *string) {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+	if p.Gmail != nil {
+		abs(&p.Gmail.CredentialsFile)
+		abs(&p.Gmail.TokenFile)
+	}
+	if p.Direct != nil && p.Direct.DKIM != nil {
+		abs(&p.Direct.DKIM.PrivateKeyFile)
+	}
+	for _, r := range p.Routes {
+		if r.Config != nil {
+			r.Config.resolvePaths(dir)
+		}
+	}
+}
+
+// applyEnv overrides the top-level provider settings with the environment
+// variables ConfigFromEnv reads, where set.
+func (p *configProfile) applyEnv() {
+	set := func(dst *string, name string) {
+		if v := os.Getenv(name); v != "" {
+			*dst = v
+		}
+	}
+	set(&p.Provider, "EMAIL_PROVIDER")
+
+	if p.Outlook == nil {
+		p.Outlook = &outlookProfile{}
+	}
+	set(&p.Outlook.TenantID, "OUTLOOK_TENANT_ID")
+	set(&p.Outlook.ClientID, "OUTLOOK_CLIENT_ID")
+	set(&p.Outlook.ClientSecret, "OUTLOOK_CLIENT_SECRET")
+	set(&p.Outlook.Cloud, "OUTLOOK_CLOUD")
+	if *p.Outlook == (outlookProfile{}) {
+		p.Outlook = nil
+	}
+
+	gmail := p.Gmail
+	if gmail == nil {
+		gmail = &gmailProfile{}
+	}
+	set(&gmail.CredentialsFile, "GMAIL_CREDENTIALS_FILE")
+	set(&gmail.TokenFile, "GMAIL_TOKEN_FILE")
+	if p.Gmail != nil || gmail.CredentialsFile != "" || gmail.TokenFile != "" {
+		p.Gmail = gmail
+	}
+}
+
+// config converts the profile into a Config, reading the files it names.
+func (p *configProfile) config() (*Config, error) {
+	c := &Config{Provider: p.Provider}
+	if p.Outlook != nil {
+		c.Outlook = &OutlookConfig{
+			TenantID:         p.Outlook.TenantID,
+			ClientID:         p.Outlook.ClientID,
+			ClientSecret:     p.Outlook.ClientSecret,
+			UserID:           p.Outlook.UserID,
+			CloudEnvironment: p.Outlook.Cloud,
+			BaseURL:          p.Outlook.BaseURL,
+		}
+		if p.Outlook.SharedThrottle {
+			c.Outlook.Throttle = SharedGraphThrottle(p.Outlook.TenantID, p.Outlook.ClientID)
+		}
+	}
+	if p.Gmail != nil {
+		g := &GmailConfig{
+			Scopes:       p.Gmail.Scopes,
+			SMTPRelay:    p.Gmail.SMTPRelay,
+			SMTPAddr:     p.Gmail.SMTPAddr,
+			SMTPUser:     p.Gmail.SMTPUser,
+			SMTPSecurity: p.Gmail.SMTPSecurity,
+			SMTPPins:     p.Gmail.SMTPPins,
+			DailyLimit:   p.Gmail.DailyLimit,
+			SentLabels:   p.Gmail.SentLabels,
+			VerifySendAs: p.Gmail.VerifySendAs,
+			BaseURL:      p.Gmail.BaseURL,
+		}
+		var err error
+		if p.Gmail.CredentialsFile != "" {
+			if g.CredentialsJSON, err = os.ReadFile(p.Gmail.CredentialsFile); err != nil {
+				return nil, fmt.Errorf("failed to read credentials file: %w", err)
+			}
+		}
+		if p.Gmail.TokenFile != "" {
+			if g.TokenJSON, err = os.ReadFile(p.Gmail.TokenFile); err != nil {
+				return nil, fmt.Errorf("failed to read token file: %w", err)
+			}
+		}
+		c.Gmail = g
+	}
+	if p.Direct != nil {
+		d := &DirectConfig{
+			Hostname:       p.Direct.Hostname,
+			DisableMTASTS:  p.Direct.DisableMTASTS,
+			DNSSECResolver: p.Direct.DNSSECResolver,
+			MaxQueueTime:   time.Duration(p.Direct.MaxQueueTime),
+			IPPools:        p.Direct.IPPools,
+			DefaultIPPool:  p.Direct.DefaultIPPool,
+		}
+		for _, r := range p.Direct.RetrySchedule {
+			d.RetrySchedule = append(d.RetrySchedule, time.Duration(r))
+		}
+		for _, r := range p.Direct.GreylistRetry {
+			d.GreylistRetrySchedule = append(d.GreylistRetrySchedule, time.Duration(r))
+		}
+		if k := p.Direct.DKIM; k != nil {
+			key, err := os.ReadFile(k.PrivateKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read DKIM key: %w", err)
+			}
+			d.DKIM = &DKIMConfig{Domain: k.Domain, Selector: k.Selector, PrivateKeyPEM: key, Headers: k.Headers}
+		}
+		c.Direct = d
+	}
+	if d := p.Deployment; d != nil {
+		c.Deployment = &DeploymentInfo{AppVersion: d.AppVersion, Environment: d.Environment, Commit: d.Commit, Headers: d.Headers}
+	}
+	if r := p.Recipients; r != nil {
+		c.RecipientPolicy = &RecipientPolicy{
+			Role:              r.Role,
+			RoleAccounts:      r.RoleAccounts,
+			Disposable:        r.Disposable,
+			DisposableDomains: r.DisposableDomains,
+			Free:              r.Free,
+			FreeDomains:       r.FreeDomains,
+			Allow:             r.Allow,
+			Deny:              r.Deny,
+		}
+	}
+	if b := p.Budget; b != nil {
+		c.Budget = &SendBudget{PerHour: b.PerHour, PerDay: b.PerDay, Latch: b.Latch}
+	}
+	for i, r := range p.Routes {
+		if r.Config == nil {
+			return nil, fmt.Errorf("route %d: configuration is required", i)
+		}
+		rc, err := r.Config.config()
+		if err != nil {
+			return nil, fmt.Errorf("route %d: %w", i, err)
+		}
+		c.Routes = append(c.Routes, Route{Name: r.Name, Domains: r.Domains, Config: rc})
+	}
+	return c, nil
+}
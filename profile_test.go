@@ -0,0 +1,122 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergePatch(t *testing.T) {
+	base := map[string]any{"a": "b", "c": map[string]any{"d": "e", "f": "g"}, "list": []any{1.0}}
+	patch := map[string]any{"a": "z", "c": map[string]any{"f": nil}, "list": []any{2.0, 3.0}}
+	want := map[string]any{"a": "z", "c": map[string]any{"d": "e"}, "list": []any{2.0, 3.0}}
+	if got := mergePatch(base, patch); !reflect.DeepEqual(got, want) {
+		t.Errorf("mergePatch() = %v, want %v", got, want)
+	}
+}
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("EMAIL_CONFIG_DIR", dir)
+	for _, v := range []string{"EMAIL_ENV", "EMAIL_PROVIDER", "OUTLOOK_TENANT_ID", "OUTLOOK_CLIENT_ID",
+		"OUTLOOK_CLIENT_SECRET", "OUTLOOK_CLOUD", "GMAIL_CREDENTIALS_FILE", "GMAIL_TOKEN_FILE"} {
+		t.Setenv(v, "")
+	}
+	return dir
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"email.json": `{
+			"provider": "outlook365",
+			"outlook": {"tenant_id": "t", "client_id": "c", "client_secret": "s", "user_id": "info@example.com"},
+			"routes": [{"name": "personal", "domains": ["*@gmail.com"],
+				"config": {"provider": "gmail", "gmail": {"credentials_file": "creds.json", "token_file": "token.json"}}}]
+		}`,
+		"email.prod.json": `{
+			"outlook": {"cloud": "usgovhigh", "user_id": "noreply@example.com"},
+			"direct": {"hostname": "mta.example.com", "retry_schedule": ["1m", "10m"], "max_queue_time": "48h"},
+			"deployment": {"app_version": "2.4.0", "environment": "prod"},
+			"recipient_policy": {"role": "warn", "disposable": "reject", "deny": ["competitor.com"]},
+			"send_budget": {"per_hour": 500, "latch": true}
+		}`,
+		"email.dev.json": `{"outlook": {"base_url": "http://localhost:8080/v1.0"}, "routes": null}`,
+		"creds.json":     `{"installed":{}}`,
+		"token.json":     `{"access_token":"x"}`,
+	})
+
+	prod, err := LoadConfig("prod")
+	if err != nil {
+		t.Fatalf("LoadConfig(prod): %v", err)
+	}
+	if prod.Provider != ProviderOutlook365 || prod.Outlook.TenantID != "t" || prod.Outlook.CloudEnvironment != CloudUSGovHigh || prod.Outlook.UserID != "noreply@example.com" {
+		t.Errorf("prod outlook = %+v", prod.Outlook)
+	}
+	if prod.Direct == nil || prod.Direct.MaxQueueTime != 48*time.Hour || !reflect.DeepEqual(prod.Direct.RetrySchedule, []time.Duration{time.Minute, 10 * time.Minute}) {
+		t.Errorf("prod direct = %+v", prod.Direct)
+	}
+	if prod.Deployment == nil || prod.Deployment.AppVersion != "2.4.0" || prod.Deployment.Environment != "prod" {
+		t.Errorf("prod deployment = %+v", prod.Deployment)
+	}
+	if rp := prod.RecipientPolicy; rp == nil || rp.Role != PolicyWarn || rp.Disposable != PolicyReject || len(rp.Deny) != 1 {
+		t.Errorf("prod recipient policy = %+v", prod.RecipientPolicy)
+	}
+	if b := prod.Budget; b == nil || b.PerHour != 500 || b.PerDay != 0 || !b.Latch {
+		t.Errorf("prod send budget = %+v", prod.Budget)
+	}
+	if len(prod.Routes) != 1 || string(prod.Routes[0].Config.Gmail.CredentialsJSON) != `{"installed":{}}` {
+		t.Errorf("prod routes = %+v", prod.Routes)
+	}
+
+	t.Setenv("EMAIL_ENV", "dev")
+	t.Setenv("OUTLOOK_CLIENT_SECRET", "from-env")
+	dev, err := LoadConfig("")
+	if err != nil {
+		t.Fatalf("LoadConfig(dev): %v", err)
+	}
+	if dev.Outlook.BaseURL != "http://localhost:8080/v1.0" || dev.Outlook.ClientSecret != "from-env" || len(dev.Routes) != 0 {
+		t.Errorf("dev config = %+v, outlook %+v", dev, dev.Outlook)
+	}
+
+	// Env file paths are used as given, not relative to the config dir.
+	t.Setenv("EMAIL_PROVIDER", ProviderGmail)
+	t.Setenv("GMAIL_CREDENTIALS_FILE", filepath.Join(dir, "creds.json"))
+	t.Setenv("GMAIL_TOKEN_FILE", filepath.Join(dir, "token.json"))
+	env, err := LoadConfig("staging") // no overlay: base only
+	if err != nil {
+		t.Fatalf("LoadConfig(staging): %v", err)
+	}
+	if env.Provider != ProviderGmail || env.Gmail == nil || len(env.Gmail.TokenJSON) == 0 {
+		t.Errorf("env override config = %+v", env)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		env   string
+	}{
+		{"no files", nil, "prod"},
+		{"unknown field", map[string]string{"email.json": `{"provider": "gmail", "gmial": {}}`}, ""},
+		{"bad duration", map[string]string{"email.json": `{"direct": {"max_queue_time": 5}}`}, ""},
+		{"bad overlay", map[string]string{"email.json": `{}`, "email.prod.json": `{`}, "prod"},
+		{"missing key file", map[string]string{"email.json": `{"direct": {"dkim": {"private_key_file": "nope.pem"}}}`}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfigFiles(t, tt.files)
+			if _, err := LoadConfig(tt.env); err == nil {
+				t.Error("want error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+// quota.go - Provider sending quotas. Gmail caps how many messages each
+// account sends per day; once the cap is hit every send fails until the
+// quota resets, so retrying is pointless. Providers that know their quota
+// report it through QuotaReporter and fail sends past it with a
+// *QuotaExceededError, which tells callers when to resume.
+package email
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Quota is a sending account's usage of its provider's daily quota.
+type Quota struct {
+	// Limit is the messages allowed per quota day; 0 when unknown.
+	Limit int
+
+	// Used is the messages sent through this process this quota day. Sends
+	// by other processes or clients on the same account are not seen.
+	Used int
+
+	// Remaining is Limit - Used, or -1 when Limit is unknown. It is 0 once
+	// the provider has refused a send for quota.
+	Remaining int
+
+	// Exhausted reports that sends fail until ResetAt.
+	Exhausted bool
+
+	// ResetAt is when the current quota day ends.
+	ResetAt time.Time
+}
+
+// QuotaReporter is implemented by providers that track a sending quota.
+type QuotaReporter interface {
+	// Quota returns the quota usage of the sending account user (an email
+	// address).
+	Quota(user string) Quota
+}
+
+// Quota returns the default provider's quota usage for the sending account
+// user, or ErrUnsupported if the provider does not track one.
+//
+// Example:
+//
+//	q, err := client.Quota("news@example.com")
+//	if err == nil && q.Remaining >= 0 && q.Remaining < len(batch.Messages) {
+//	    schedule(batch, q.ResetAt)
+//	}
+func (c *Client) Quota(user string) (Quota, error) {
+	r, ok := c.provider.(QuotaReporter)
+	if !ok {
+		return Quota{}, fmt.Errorf("quota: %w", ErrUnsupported)
+	}
+	return r.Quota(user), nil
+}
+
+// QuotaExceededError is returned by Send when the sending account has used
+// up its daily quota. Nothing is sent; sending to anyone from the account
+// fails until ResetAt, so the send should be deferred, not retried. It
+// matches ErrDailyQuotaExceeded with errors.Is.
+type QuotaExceededError struct {
+	// User is the sending account.
+	User string
+
+	// Limit is the configured daily limit; 0 if the provider refused the
+	// send on its own.
+	Limit int
+
+	// ResetAt is when the quota resets.
+	ResetAt time.Time
+
+	// Err is the provider's refusal; nil when the limit was enforced
+	// locally.
+	Err error
+}
+
+func (e *QuotaExceededError) Error() string {
+	msg := fmt.Sprintf("%s for %s; resets at %s", ErrDailyQuotaExceeded, e.User, e.ResetAt.Format(time.RFC3339))
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is reports whether target is ErrDailyQuotaExceeded.
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrDailyQuotaExceeded
+}
+
+// Hint suggests deferring sends until the quota resets.
+func (e *QuotaExceededError) Hint() string {
+	return fmt.Sprintf("defer sends from %s until %s; retrying before then fails", e.User, e.ResetAt.Format(time.RFC3339))
+}
+
+// Unwrap returns the provider's error.
+func (e *QuotaExceededError) Unwrap() error {
+	return e.Err
+}
+
+// pacificTime is the zone Google's daily quotas reset in, at midnight.
+var pacificTime = sync.OnceValue(func() *time.Location {
+	if loc, err := time.LoadLocation("America/Los_Angeles"); err == nil {
+		return loc
+	}
+	return time.FixedZone("PST", -8*60*60) // no tzdata; off by an hour in summer
+})
+
+// dailyQuota counts sends per user over quota days that end at midnight in
+// loc. It is safe for concurrent use.
+type dailyQuota struct {
+	limit int
+	loc   *time.Location
+	now   func() time.Time
+
+	mu    sync.Mutex
+	users map[string]*quotaDay
+}
+
+// quotaDay is one user's usage of the quota day ending at end.
+type quotaDay struct {
+	end       time.Time
+	sent      int
+	exhausted bool
+}
+
+// newDailyQuota returns a tracker allowing limit sends per user and day
+// (unlimited if 0).
+func newDailyQuota(limit int, loc *time.Location) *dailyQuota {
+	return &dailyQuota{limit: limit, loc: loc, now: time.Now, users: make(map[string]*quotaDay)}
+}
+
+// day returns user's current quota day; the caller holds q.mu.
+func (q *dailyQuota) day(user string) *quotaDay {
+	now := q.now().In(q.loc)
+	d := q.users[user]
+	if d == nil || !now.Before(d.end) {
+		y, m, dd := now.Date()
+		d = &quotaDay{end: time.Date(y, m, dd+1, 0, 0, 0, 0, q.loc)}
+		q.users[user] = d
+	}
+	return d
+}
+
+// acquire counts a send by user, or returns a *QuotaExceededError if the
+// quota is used up.
+func (q *dailyQuota) acquire(user string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d := q.day(user)
+	if d.exhausted || (q.limit > 0 && d.sent >= q.limit) {
+		return &QuotaExceededError{User: user, Limit: q.limit, ResetAt: d.end}
+	}
+	d.sent++
+	return nil
+}
+
+// release takes back a send acquired for user that did not go out. If the
+// provider refused it for quota (exhausted), the user is paused until the
+// quota day ends and the returned error says so.
+func (q *dailyQuota) release(user string, exhausted bool, cause error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d := q.day(user)
+	if d.sent > 0 {
+		d.sent--
+	}
+	if !exhausted {
+		return cause
+	}
+	d.exhausted = true
+	return &QuotaExceededError{User: user, Limit: q.limit, ResetAt: d.end, Err: cause}
+}
+
+// quota reports user's usage.
+func (q *dailyQuota) quota(user string) Quota {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d := q.day(user)
+	s := Quota{Limit: q.limit, Used: d.sent, Remaining: -1, Exhausted: d.exhausted, ResetAt: d.end}
+	if q.limit > 0 {
+		s.Remaining = max(q.limit-d.sent, 0)
+		s.Exhausted = s.Exhausted || s.Remaining == 0
+	}
+	if s.Exhausted {
+		s.Remaining = 0
+	}
+	return s
+}
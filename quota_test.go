@@ -0,0 +1,82 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDailyQuota(t *testing.T) {
+	loc := time.FixedZone("PST", -8*60*60)
+	now := time.Date(2026, 3, 2, 23, 0, 0, 0, loc)
+	q := newDailyQuota(2, loc)
+	q.now = func() time.Time { return now }
+	midnight := time.Date(2026, 3, 3, 0, 0, 0, 0, loc)
+
+	for i := 0; i < 2; i++ {
+		if err := q.acquire("a@example.com"); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+	err := q.acquire("a@example.com")
+	var qerr *QuotaExceededError
+	if !errors.As(err, &qerr) || !errors.Is(err, ErrDailyQuotaExceeded) || !qerr.ResetAt.Equal(midnight) || qerr.Limit != 2 {
+		t.Fatalf("acquire past limit = %v", err)
+	}
+	if err := q.acquire("b@example.com"); err != nil {
+		t.Errorf("other user: %v", err)
+	}
+
+	// A failed send is not counted; a quota refusal pauses the user even
+	// under the local limit.
+	if err := q.release("b@example.com", false, errors.New("boom")); err == nil || errors.Is(err, ErrDailyQuotaExceeded) {
+		t.Errorf("release() = %v, want the cause", err)
+	}
+	if got := q.quota("b@example.com"); got.Used != 0 || got.Remaining != 2 || got.Exhausted {
+		t.Errorf("quota after failed send = %+v", got)
+	}
+	q.acquire("b@example.com")
+	if err := q.release("b@example.com", true, errors.New("550 5.4.5 Daily user sending limit exceeded")); !errors.Is(err, ErrDailyQuotaExceeded) {
+		t.Errorf("release(exhausted) = %v", err)
+	}
+	if got := q.quota("b@example.com"); !got.Exhausted || got.Remaining != 0 {
+		t.Errorf("quota after refusal = %+v", got)
+	}
+
+	now = midnight.Add(time.Minute)
+	for _, user := range []string{"a@example.com", "b@example.com"} {
+		if got := q.quota(user); got.Used != 0 || got.Exhausted || !got.ResetAt.Equal(midnight.AddDate(0, 0, 1)) {
+			t.Errorf("%s after reset = %+v", user, got)
+		}
+	}
+
+	unlimited := newDailyQuota(0, loc)
+	unlimited.acquire("a@example.com")
+	if got := unlimited.quota("a@example.com"); got.Remaining != -1 || got.Used != 1 {
+		t.Errorf("unlimited quota = %+v", got)
+	}
+}
+
+func TestClientQuotaUnsupported(t *testing.T) {
+	if _, err := (&Client{provider: &mockProvider{}}).Quota("a@example.com"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Quota() error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestSendBatchStopsOnQuota(t *testing.T) {
+	mock := &mockProvider{sendFunc: func(_ context.Context, msg *Message) error {
+		if msg.To[0] == "user2@example.com" {
+			return &QuotaExceededError{User: "news@example.com", ResetAt: time.Now().Add(time.Hour)}
+		}
+		return nil
+	}}
+	c := &Client{provider: mock}
+	report, err := c.SendBatch(testBatch("quota", 5))
+	if !errors.Is(err, ErrDailyQuotaExceeded) {
+		t.Fatalf("SendBatch() error = %v, want ErrDailyQuotaExceeded", err)
+	}
+	if report.Sent != 2 || report.Failed != 1 || len(mock.calls) != 3 {
+		t.Errorf("sent %d, failed %d, attempted %d; want 2, 1, 3", report.Sent, report.Failed, len(mock.calls))
+	}
+}
@@ -0,0 +1,305 @@
+// recipientpolicy.go - Recipient policies that protect sender reputation.
+// Mail to role accounts (abuse@, noreply@) and throwaway inboxes bounces,
+// complains or goes unread far more often than mail to people; a Client
+// configured with a RecipientPolicy warns about or rejects such recipients
+// before anything is sent. Free webmail addresses can be flagged too, for
+// business-only mail, and a Classify hook adds application checks. Allow and
+// deny lists use the Route pattern syntax.
+package email
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// PolicyAction is what a RecipientPolicy does with a matching recipient.
+type PolicyAction int
+
+const (
+	// PolicyAllow sends as usual; it is the zero value, leaving a check off.
+	PolicyAllow PolicyAction = iota
+
+	// PolicyWarn sends, but reports the recipient to RecipientPolicy.OnWarn.
+	PolicyWarn
+
+	// PolicyReject refuses the whole message with a *RecipientRejectedError.
+	PolicyReject
+)
+
+// String returns the action's name as used in configuration files.
+func (a PolicyAction) String() string {
+	switch a {
+	case PolicyAllow:
+		return "allow"
+	case PolicyWarn:
+		return "warn"
+	case PolicyReject:
+		return "reject"
+	}
+	return fmt.Sprintf("PolicyAction(%d)", int(a))
+}
+
+// UnmarshalText parses "allow", "warn" or "reject".
+func (a *PolicyAction) UnmarshalText(b []byte) error {
+	for _, v := range []PolicyAction{PolicyAllow, PolicyWarn, PolicyReject} {
+		if strings.EqualFold(string(b), v.String()) {
+			*a = v
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid policy action %q", b)
+}
+
+// RecipientPolicy configures the recipient checks made before each send.
+type RecipientPolicy struct {
+	// Role is the action for role accounts: mailboxes of a function rather
+	// than a person, like abuse@, postmaster@ or noreply@. Tags are ignored
+	// ("noreply+x@" is noreply@).
+	Role PolicyAction
+
+	// RoleAccounts adds local parts to the built-in role account list.
+	RoleAccounts []string
+
+	// Disposable is the action for addresses at known disposable-email
+	// domains (mailinator.com, ...) and their subdomains.
+	Disposable PolicyAction
+
+	// DisposableDomains adds domains to the built-in disposable list, which
+	// is deliberately short; load a maintained list with ReadDomainList.
+	DisposableDomains []string
+
+	// Free is the action for addresses at free webmail providers (gmail.com,
+	// outlook.com, ...), e.g. to keep B2B mail to work addresses.
+	Free PolicyAction
+
+	// FreeDomains adds domains to the built-in free webmail list.
+	FreeDomains []string
+
+	// Classify, if set, is consulted for each recipient the Allow and Deny
+	// lists leave open, before the built-in checks. It receives the
+	// lowercased bare address and returns the action and a reason for
+	// RecipientIssue; PolicyAllow defers to the built-in checks.
+	Classify func(address string) (action PolicyAction, reason string)
+
+	// Allow lists recipients exempt from the Role and Disposable checks, as
+	// Route patterns ("ops.example.com", "abuse@partner.com", "*@*.corp").
+	Allow []string
+
+	// Deny lists recipients that are always rejected, as Route patterns.
+	Deny []string
+
+	// OnWarn, if set, is called for each recipient a PolicyWarn check
+	// matched; the message is still sent.
+	OnWarn func(RecipientIssue)
+}
+
+// RecipientIssue is one recipient flagged by a RecipientPolicy.
+type RecipientIssue struct {
+	// Address is the bare recipient address.
+	Address string
+
+	// Reason is "role", "disposable", "free", "denied" or the reason given
+	// by RecipientPolicy.Classify; Message.ValidateStrict reports "no such
+	// domain" and "null MX".
+	Reason string
+}
+
+// RecipientRejectedError is returned by Send when a RecipientPolicy rejects
+// one or more recipients, and by Message.ValidateStrict for undeliverable
+// ones. Nothing is sent. It matches ErrRecipientRejected
+// with errors.Is.
+type RecipientRejectedError struct {
+	Issues []RecipientIssue
+}
+
+func (e *RecipientRejectedError) Error() string {
+	parts := make([]string, len(e.Issues))
+	for i, is := range e.Issues {
+		parts[i] = is.Address + " (" + is.Reason + ")"
+	}
+	return ErrRecipientRejected.Error() + ": " + strings.Join(parts, ", ")
+}
+
+// Is reports whether target is ErrRecipientRejected.
+func (e *RecipientRejectedError) Is(target error) bool {
+	return target == ErrRecipientRejected
+}
+
+// Hint suggests removing the rejected recipients.
+func (e *RecipientRejectedError) Hint() string {
+	return "remove the listed recipients, or relax the RecipientPolicy if they are wanted"
+}
+
+// defaultRoleAccounts are local parts treated as role accounts.
+var defaultRoleAccounts = []string{
+	"abuse", "postmaster", "hostmaster", "webmaster", "mailer-daemon", "root",
+	"noreply", "no-reply", "donotreply", "do-not-reply", "nobody", "security",
+	"admin", "administrator", "spam", "list", "list-request", "unsubscribe",
+}
+
+// defaultDisposableDomains are well-known disposable-email domains. The list
+// is deliberately short; DisposableDomains extends it from a maintained
+// source.
+var defaultDisposableDomains = []string{
+	"mailinator.com", "guerrillamail.com", "guerrillamail.net", "sharklasers.com",
+	"10minutemail.com", "temp-mail.org", "yopmail.com", "trashmail.com",
+	"getnada.com", "dispostable.com", "maildrop.cc", "throwawaymail.com",
+	"fakeinbox.com", "mailnesia.com", "mintemail.com", "discard.email",
+	"emailondeck.com", "tempmailo.com", "moakt.com", "spamgourmet.com",
+}
+
+// defaultFreeDomains are large free webmail providers.
+var defaultFreeDomains = []string{
+	"gmail.com", "googlemail.com", "outlook.com", "hotmail.com", "live.com",
+	"msn.com", "yahoo.com", "ymail.com", "aol.com", "icloud.com", "me.com",
+	"mac.com", "proton.me", "protonmail.com", "gmx.com", "gmx.de", "gmx.net",
+	"web.de", "mail.com", "zoho.com", "yandex.com", "yandex.ru", "mail.ru",
+	"qq.com", "163.com", "126.com", "fastmail.com", "tutanota.com",
+}
+
+// ReadDomainList reads a domain list with one domain per line, as published
+// by the disposable-email-domains project and similar. Blank lines and
+// everything after a "#" are ignored. It suits RecipientPolicy's
+// DisposableDomains and FreeDomains, e.g. from an embedded file:
+//
+//	//go:embed disposable_email_blocklist.conf
+//	var blocklist string
+//
+//	domains, err := email.ReadDomainList(strings.NewReader(blocklist))
+func ReadDomainList(r io.Reader) ([]string, error) {
+	var domains []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			domains = append(domains, strings.ToLower(line))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("domain list: %w", err)
+	}
+	return domains, nil
+}
+
+// recipientPolicy is a RecipientPolicy with its lists compiled.
+type recipientPolicy struct {
+	config      *RecipientPolicy
+	roles       map[string]bool
+	disposable  map[string]bool
+	free        map[string]bool
+	allow, deny []string
+}
+
+// newRecipientPolicy compiles config.
+func newRecipientPolicy(config *RecipientPolicy) (*recipientPolicy, error) {
+	p := &recipientPolicy{
+		config:     config,
+		roles:      make(map[string]bool),
+		disposable: make(map[string]bool),
+		free:       make(map[string]bool),
+	}
+	for _, r := range append(defaultRoleAccounts, config.RoleAccounts...) {
+		p.roles[strings.ToLower(r)] = true
+	}
+	for _, d := range append(defaultDisposableDomains, config.DisposableDomains...) {
+		p.disposable[strings.ToLower(strings.TrimPrefix(d, "@"))] = true
+	}
+	for _, d := range append(defaultFreeDomains, config.FreeDomains...) {
+		p.free[strings.ToLower(strings.TrimPrefix(d, "@"))] = true
+	}
+	var err error
+	if p.allow, err = compilePatterns(config.Allow); err != nil {
+		return nil, fmt.Errorf("recipient policy allow list: %w", err)
+	}
+	if p.deny, err = compilePatterns(config.Deny); err != nil {
+		return nil, fmt.Errorf("recipient policy deny list: %w", err)
+	}
+	return p, nil
+}
+
+// compilePatterns normalizes Route-style patterns and checks their syntax.
+func compilePatterns(patterns []string) ([]string, error) {
+	out := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		n := normalizeRoutePattern(p)
+		if _, err := path.Match(n, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// recipientPolicy returns the client's recipient policy, nil if it has none.
+func (c *Client) recipientPolicy() *recipientPolicy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.policy
+}
+
+// check applies the policy to msg's recipients, calling OnWarn for warnings
+// and returning a *RecipientRejectedError if any recipient is rejected.
+func (p *recipientPolicy) check(msg *Message) error {
+	var rejected []RecipientIssue
+	for _, a := range messageRecipients(msg) {
+		addr := strings.ToLower(parseAddr(a))
+		issue, action := p.classify(addr)
+		switch action {
+		case PolicyWarn:
+			if p.config.OnWarn != nil {
+				p.config.OnWarn(issue)
+			}
+		case PolicyReject:
+			rejected = append(rejected, issue)
+		}
+	}
+	if len(rejected) > 0 {
+		return &RecipientRejectedError{Issues: rejected}
+	}
+	return nil
+}
+
+// classify returns the issue and action for one lowercased address.
+func (p *recipientPolicy) classify(addr string) (RecipientIssue, PolicyAction) {
+	if matchAny(p.deny, addr) {
+		return RecipientIssue{Address: addr, Reason: "denied"}, PolicyReject
+	}
+	if matchAny(p.allow, addr) {
+		return RecipientIssue{}, PolicyAllow
+	}
+	if p.config.Classify != nil {
+		if action, reason := p.config.Classify(addr); action != PolicyAllow {
+			return RecipientIssue{Address: addr, Reason: reason}, action
+		}
+	}
+	local, domain, _ := strings.Cut(addr, "@")
+	local, _, _ = strings.Cut(local, "+")
+	if p.config.Role != PolicyAllow && p.roles[local] {
+		return RecipientIssue{Address: addr, Reason: "role"}, p.config.Role
+	}
+	if p.config.Disposable != PolicyAllow {
+		for d := domain; d != ""; {
+			if p.disposable[d] {
+				return RecipientIssue{Address: addr, Reason: "disposable"}, p.config.Disposable
+			}
+			_, d, _ = strings.Cut(d, ".")
+		}
+	}
+	if p.config.Free != PolicyAllow && p.free[domain] {
+		return RecipientIssue{Address: addr, Reason: "free"}, p.config.Free
+	}
+	return RecipientIssue{}, PolicyAllow
+}
+
+// matchAny reports whether addr matches one of the patterns.
+func matchAny(patterns []string, addr string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, addr); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package email
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecipientPolicyCheck(t *testing.T) {
+	policy, err := newRecipientPolicy(&RecipientPolicy{
+		Role:              PolicyWarn,
+		Disposable:        PolicyReject,
+		DisposableDomains: []string{"burner.example"},
+		Allow:             []string{"abuse@partner.com", "qa.mailinator.com"},
+		Deny:              []string{"competitor.com"},
+	})
+	if err != nil {
+		t.Fatalf("newRecipientPolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		to       []string
+		warned   []RecipientIssue
+		rejected []RecipientIssue
+	}{
+		{"person", []string{"jane@example.com"}, nil, nil},
+		{"role warns", []string{"NoReply+bounce@Example.com"},
+			[]RecipientIssue{{"noreply+bounce@example.com", "role"}}, nil},
+		{"allowed role", []string{"Partner Abuse <abuse@partner.com>"}, nil, nil},
+		{"disposable", []string{"jane@example.com", "x@mailinator.com", "y@inbox.burner.example"},
+			nil, []RecipientIssue{{"x@mailinator.com", "disposable"}, {"y@inbox.burner.example", "disposable"}}},
+		{"allowed disposable subdomain", []string{"tester@qa.mailinator.com"}, nil, nil},
+		{"denied", []string{"ceo@competitor.com"}, nil, []RecipientIssue{{"ceo@competitor.com", "denied"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warned []RecipientIssue
+			policy.config.OnWarn = func(is RecipientIssue) { warned = append(warned, is) }
+			err := policy.check(&Message{To: tt.to})
+			if !reflect.DeepEqual(warned, tt.warned) {
+				t.Errorf("warned = %v, want %v", warned, tt.warned)
+			}
+			if tt.rejected == nil {
+				if err != nil {
+					t.Errorf("check() error = %v", err)
+				}
+				return
+			}
+			var rerr *RecipientRejectedError
+			if !errors.As(err, &rerr) || !errors.Is(err, ErrRecipientRejected) {
+				t.Fatalf("check() error = %v, want *RecipientRejectedError", err)
+			}
+			if !reflect.DeepEqual(rerr.Issues, tt.rejected) {
+				t.Errorf("rejected = %v, want %v", rerr.Issues, tt.rejected)
+			}
+		})
+	}
+}
+
+func TestRecipientPolicyFreeAndClassify(t *testing.T) {
+	policy, err := newRecipientPolicy(&RecipientPolicy{
+		Free:        PolicyWarn,
+		FreeDomains: []string{"@Mail.Example"},
+		Allow:       []string{"founder@gmail.com"},
+		Classify: func(addr string) (PolicyAction, string) {
+			if strings.HasSuffix(addr, "@churned.example") {
+				return PolicyReject, "churned customer"
+			}
+			return PolicyAllow, ""
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warned []RecipientIssue
+	policy.config.OnWarn = func(is RecipientIssue) { warned = append(warned, is) }
+	err = policy.check(&Message{To: []string{"a@gmail.com", "founder@gmail.com", "b@mail.example", "c@sub.gmail.com"}})
+	if err != nil {
+		t.Errorf("check() error = %v", err)
+	}
+	if want := []RecipientIssue{{"a@gmail.com", "free"}, {"b@mail.example", "free"}}; !reflect.DeepEqual(warned, want) {
+		t.Errorf("warned = %v, want %v", warned, want)
+	}
+
+	err = policy.check(&Message{To: []string{"x@churned.example"}})
+	var rerr *RecipientRejectedError
+	if !errors.As(err, &rerr) || !reflect.DeepEqual(rerr.Issues, []RecipientIssue{{"x@churned.example", "churned customer"}}) {
+		t.Errorf("check() error = %v, want churned customer rejection", err)
+	}
+}
+
+func TestReadDomainList(t *testing.T) {
+	got, err := ReadDomainList(strings.NewReader("# disposable domains\n\nBurner.example\r\nthrowaway.example  # since 2023\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"burner.example", "throwaway.example"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadDomainList() = %v, want %v", got, want)
+	}
+}
+
+func TestClientSendRecipientPolicy(t *testing.T) {
+	policy, err := newRecipientPolicy(&RecipientPolicy{Role: PolicyReject})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := &mockProvider{}
+	client := &Client{provider: mock, policy: policy}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Bcc: []string{"postmaster@example.net"}, Subject: "s", Body: "b"}
+	if err := client.Send(msg); !errors.Is(err, ErrRecipientRejected) {
+		t.Fatalf("Send() error = %v, want ErrRecipientRejected", err)
+	}
+	if len(mock.calls) != 0 {
+		t.Error("message sent despite rejection")
+	}
+
+	var action PolicyAction
+	if err := action.UnmarshalText([]byte("Reject")); err != nil || action != PolicyReject {
+		t.Errorf("UnmarshalText(Reject) = %v, %v", action, err)
+	}
+	if err := action.UnmarshalText([]byte("block")); err == nil {
+		t.Error("UnmarshalText(block) error = nil")
+	}
+}
@@ -0,0 +1,107 @@
+// registry.go - Provider registration. Every provider registers a factory
+// under its Config.Provider name from an init function, and NewClient looks
+// the name up, so a program only links the providers it compiles in. The
+// Outlook 365 and Gmail providers bring in the Microsoft Graph and Google API
+// SDKs; building with the email_no_outlook or email_no_gmail tag leaves
+// them, and their SDKs, out of the binary:
+//
+//	go build -tags email_no_outlook,email_no_gmail ./cmd/mailer
+//
+// Providers outside this package register the same way and are enabled by
+// importing their package, typically for its side effect only:
+//
+//	package ses
+//
+//	func init() {
+//	    email.RegisterProvider("ses", func(c *email.Config) (email.Provider, error) {
+//	        return newProvider(c.Custom["ses"])
+//	    })
+//	}
+package email
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ProviderFactory creates a provider from a client's configuration. It is
+// called by NewClient, and for each Route, which return its errors as they
+// are.
+type ProviderFactory func(config *Config) (Provider, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]ProviderFactory)
+)
+
+// excludedProviders names the build tag that leaves out each built-in
+// provider, for the error when one is configured but not compiled in.
+var excludedProviders = map[string]string{
+	ProviderOutlook365: "email_no_outlook",
+	ProviderGmail:      "email_no_gmail",
+}
+
+func init() {
+	RegisterProvider(ProviderDirect, func(config *Config) (Provider, error) {
+		if config.Direct == nil {
+			return nil, fmt.Errorf("direct configuration is required")
+		}
+		return created(newDirectProvider(config.Direct))
+	})
+}
+
+// created returns the result of a built-in provider's constructor, with
+// the error wrapped as NewClient reports it.
+func created[P Provider](provider P, err error) (Provider, error) {
+	if err != nil {
+		return nil, fmt.Errorf("failed to create provider: %w", err)
+	}
+	return provider, nil
+}
+
+// RegisterProvider makes a provider available under name, the
+// Config.Provider value that selects it. Like database/sql.Register, it is
+// meant to be called from init functions and panics if name is empty,
+// factory is nil or name is registered already.
+func RegisterProvider(name string, factory ProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if name == "" {
+		panic("email: RegisterProvider with an empty name")
+	}
+	if factory == nil {
+		panic("email: RegisterProvider factory is nil for " + name)
+	}
+	if _, dup := providers[name]; dup {
+		panic("email: RegisterProvider called twice for " + name)
+	}
+	providers[name] = factory
+}
+
+// Providers returns the names of the registered providers, sorted.
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// providerFactory returns the factory registered under name, or an error
+// saying why there is none.
+func providerFactory(name string) (ProviderFactory, error) {
+	providersMu.RLock()
+	factory, ok := providers[name]
+	providersMu.RUnlock()
+	if ok {
+		return factory, nil
+	}
+	if tag, builtin := excludedProviders[name]; builtin {
+		return nil, fmt.Errorf("provider %s is not compiled in (built with the %s tag)", name, tag)
+	}
+	return nil, fmt.Errorf("unsupported provider: %s", name)
+}
@@ -0,0 +1,79 @@
+package email
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRegisterProvider(t *testing.T) {
+	mock := &mockProvider{}
+	var got *Config
+	RegisterProvider("registry-test", func(config *Config) (Provider, error) {
+		got = config
+		return mock, nil
+	})
+
+	if names := Providers(); !slices.Contains(names, "registry-test") || !slices.Contains(names, ProviderDirect) {
+		t.Errorf("Providers() = %v, want registry-test and %s", names, ProviderDirect)
+	}
+
+	config := &Config{Provider: "registry-test", Custom: map[string]interface{}{"region": "eu-west-1"}}
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if got != config {
+		t.Error("factory not called with the client's config")
+	}
+	if err := client.Send(&Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(mock.calls) != 1 {
+		t.Errorf("provider got %d sends, want 1", len(mock.calls))
+	}
+}
+
+func TestRegisterProviderPanics(t *testing.T) {
+	factory := func(*Config) (Provider, error) { return &mockProvider{}, nil }
+	tests := []struct {
+		name     string
+		provider string
+		factory  ProviderFactory
+		want     string
+	}{
+		{"empty name", "", factory, "empty name"},
+		{"nil factory", "registry-nil", nil, "nil"},
+		{"duplicate", ProviderDirect, factory, "twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if msg, _ := r.(string); !strings.Contains(msg, tt.want) {
+					t.Errorf("panic = %v, want it to mention %q", r, tt.want)
+				}
+			}()
+			RegisterProvider(tt.provider, tt.factory)
+		})
+	}
+}
+
+func TestProviderFactoryExcluded(t *testing.T) {
+	providersMu.Lock()
+	saved := providers[ProviderGmail]
+	delete(providers, ProviderGmail)
+	providersMu.Unlock()
+	defer func() {
+		if saved != nil {
+			providersMu.Lock()
+			providers[ProviderGmail] = saved
+			providersMu.Unlock()
+		}
+	}()
+
+	_, err := NewClient(&Config{Provider: ProviderGmail})
+	if err == nil || !strings.Contains(err.Error(), "email_no_gmail") {
+		t.Errorf("NewClient error = %v, want it to name the email_no_gmail tag", err)
+	}
+}
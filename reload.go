@@ -0,0 +1,213 @@
+// reload.go - Live reload of routing rules and send limits. Operators can
+// retune which recipients go through which provider, the send budget and the
+// recipient policy without restarting: ReloadRoutes swaps a client's routes
+// atomically, and WatchConfig re-reads the LoadConfig files on SIGHUP or when
+// they change. Providers and their credentials are fixed at NewClient: a
+// file reload keeps every route's provider, with its quota, token cache and
+// throttle, and refuses changes to provider settings, which need a restart.
+package email
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+// ReloadRoutes replaces the client's recipient routes. The new routes are
+// built in full before the swap, so on error the old routes stay in effect;
+// sends already in flight finish on the provider they were routed to. Each
+// route gets a new provider, built from its Config.
+func (c *Client) ReloadRoutes(routes []Route) error {
+	compiled, err := newRoutes(routes, nil)
+	if err != nil {
+		return fmt.Errorf("invalid routes: %w", err)
+	}
+	c.mu.Lock()
+	c.routes = compiled
+	c.mu.Unlock()
+	return nil
+}
+
+// WatchOptions configures WatchConfig.
+type WatchOptions struct {
+	// Env selects the LoadConfig environment (EMAIL_ENV if empty).
+	Env string
+
+	// Interval is how often the config files are checked for changes.
+	// Defaults to 10 seconds; a negative value disables polling, leaving
+	// SIGHUP as the only trigger.
+	Interval time.Duration
+
+	// OnReload, if set, is called after each reload attempt with its error
+	// (nil on success), e.g. for logging.
+	OnReload func(error)
+
+	// trigger, if set, forces a reload on each receive, for tests.
+	trigger <-chan struct{}
+}
+
+// defaultWatchInterval is WatchOptions.Interval's default.
+const defaultWatchInterval = 10 * time.Second
+
+// WatchConfig reloads the client's settings from LoadConfig(opts.Env)
+// whenever the process receives SIGHUP or the config files change, until
+// ctx is done. A reload applies the routes' domains and send windows, the
+// send budget's limits and the recipient policy. Routes are matched to the
+// running ones by name; a new route, or a change to the provider settings
+// (credentials included) of the default provider or of a route, fails the
+// reload. A failed reload is reported to OnReload and leaves the current
+// settings in place. Under WebAssembly, which has no signals, only file
+// changes trigger a reload. It blocks; run it in its own goroutine:
+//
+//	go client.WatchConfig(ctx, email.WatchOptions{
+//	    Env:      "prod",
+//	    OnReload: func(err error) { log.Printf("email config reload: %v", err) },
+//	})
+func (c *Client) WatchConfig(ctx context.Context, opts WatchOptions) error {
+	hup, stop := notifyReload()
+	defer stop()
+
+	interval := opts.Interval
+	if interval == 0 {
+		interval = defaultWatchInterval
+	}
+	var tick <-chan time.Time
+	if interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	// Provider settings are compared with the files as they were when the
+	// watch started.
+	base, _ := LoadConfig(opts.Env)
+	reload := func() {
+		config, err := LoadConfig(opts.Env)
+		if err == nil && base == nil {
+			base = config
+		}
+		if err == nil {
+			err = c.reloadConfig(base, config)
+		}
+		if opts.OnReload != nil {
+			opts.OnReload(err)
+		}
+	}
+
+	last := profileFingerprint(opts.Env)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-hup:
+			last = profileFingerprint(opts.Env)
+			reload()
+		case <-opts.trigger:
+			last = profileFingerprint(opts.Env)
+			reload()
+		case <-tick:
+			if fp := profileFingerprint(opts.Env); fp != last {
+				last = fp
+				reload()
+			}
+		}
+	}
+}
+
+// reloadConfig applies the reloadable settings of config, after checking
+// that its provider settings are those of base.
+func (c *Client) reloadConfig(base, config *Config) error {
+	if !reflect.DeepEqual(providerSettingsOf(base), providerSettingsOf(config)) {
+		return fmt.Errorf("the default provider's settings changed; restart to apply them")
+	}
+	baseRoutes := make(map[string][]providerSettings, len(base.Routes))
+	for _, r := range base.Routes {
+		if r.Config != nil {
+			baseRoutes[routeName(r)] = append(baseRoutes[routeName(r)], providerSettingsOf(r.Config))
+		}
+	}
+	for i, r := range config.Routes {
+		if r.Config == nil {
+			return fmt.Errorf("invalid routes: route %d: configuration is required", i)
+		}
+		name := routeName(r)
+		if b := baseRoutes[name]; len(b) == 0 || !reflect.DeepEqual(b[0], providerSettingsOf(r.Config)) {
+			return fmt.Errorf("route %q: new or changed provider settings; restart to apply them", name)
+		}
+		baseRoutes[name] = baseRoutes[name][1:]
+	}
+
+	c.mu.RLock()
+	current, policy := c.routes, c.policy
+	c.mu.RUnlock()
+	routes, err := newRoutes(config.Routes, current)
+	if err != nil {
+		return fmt.Errorf("invalid routes: %w", err)
+	}
+	if config.RecipientPolicy != nil {
+		rp := *config.RecipientPolicy
+		if policy != nil { // hooks are set in code, not in the files
+			if rp.Classify == nil {
+				rp.Classify = policy.config.Classify
+			}
+			if rp.OnWarn == nil {
+				rp.OnWarn = policy.config.OnWarn
+			}
+		}
+		if policy, err = newRecipientPolicy(&rp); err != nil {
+			return err
+		}
+	} else {
+		policy = nil
+	}
+	var budget *sendBudget
+	if config.Budget != nil {
+		if budget, err = newSendBudget(config.Budget); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.routes, c.policy = routes, policy
+	switch {
+	case budget == nil:
+		c.budget = nil
+	case c.budget == nil:
+		c.budget = budget
+	default:
+		c.budget.setLimits(budget.config)
+	}
+	return nil
+}
+
+// providerSettings are the settings of a Config that make up its provider.
+type providerSettings struct {
+	Provider string
+	Outlook  *OutlookConfig
+	Gmail    *GmailConfig
+	Direct   *DirectConfig
+	Custom   map[string]interface{}
+}
+
+// providerSettingsOf returns config's provider settings.
+func providerSettingsOf(config *Config) providerSettings {
+	return providerSettings{config.Provider, config.Outlook, config.Gmail, config.Direct, config.Custom}
+}
+
+// profileFingerprint summarizes the modification time and size of the
+// env's config files, to detect changes by polling.
+func profileFingerprint(env string) string {
+	_, paths := profilePaths(env)
+	var fp string
+	for _, path := range paths {
+		if fi, err := os.Stat(path); err == nil {
+			fp += fmt.Sprintf("%s:%d:%d;", path, fi.ModTime().UnixNano(), fi.Size())
+		} else {
+			fp += path + ":-;"
+		}
+	}
+	return fp
+}
@@ -0,0 +1,12 @@
+//go:build js || wasip1
+
+// reload_nosignal.go - WatchConfig under WebAssembly, which has no signals:
+// only changes to the config files trigger a reload.
+package email
+
+import "os"
+
+// notifyReload returns a nil channel, which never receives.
+func notifyReload() (<-chan os.Signal, func()) {
+	return nil, func() {}
+}
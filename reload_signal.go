@@ -0,0 +1,19 @@
+//go:build !js && !wasip1
+
+// reload_signal.go - SIGHUP as a WatchConfig trigger, on the platforms that
+// deliver signals.
+package email
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyReload returns a channel receiving SIGHUP, and a func that stops
+// the delivery.
+func notifyReload() (<-chan os.Signal, func()) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	return hup, func() { signal.Stop(hup) }
+}
@@ -0,0 +1,119 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func directRoute(name string, domains ...string) Route {
+	return Route{Name: name, Domains: domains, Config: &Config{
+		Provider: ProviderDirect,
+		Direct:   &DirectConfig{Hostname: "mta.example.com", DisableMTASTS: true},
+	}}
+}
+
+func TestClientReloadRoutes(t *testing.T) {
+	def := &mockProvider{}
+	c := &Client{provider: def, name: "default"}
+	msg := &Message{To: []string{"a@example.net"}}
+
+	if err := c.ReloadRoutes([]Route{directRoute("mx", "example.net")}); err != nil {
+		t.Fatalf("ReloadRoutes: %v", err)
+	}
+	if _, ok := c.route(msg).(*directProvider); !ok {
+		t.Error("message not routed through the reloaded route")
+	}
+
+	// An invalid set leaves the current routes in place.
+	if err := c.ReloadRoutes([]Route{directRoute("a", "x.com"), directRoute("a", "y.com")}); err == nil {
+		t.Fatal("duplicate route names: want error, got nil")
+	}
+	if _, err := c.providerNamed("mx"); err != nil {
+		t.Errorf("routes lost after failed reload: %v", err)
+	}
+
+	if err := c.ReloadRoutes(nil); err != nil {
+		t.Fatalf("ReloadRoutes(nil): %v", err)
+	}
+	if got := c.route(msg); got != def {
+		t.Error("cleared routes still route the message")
+	}
+}
+
+func TestClientWatchConfig(t *testing.T) {
+	const route = `"routes": [{"name": "mx", "domains": [%q],
+		"config": {"provider": "direct", "direct": {"hostname": %q, "disable_mta_sts": true}}}]`
+	files := func(domain, routeHost string, perHour int) string {
+		return fmt.Sprintf(`{"provider": "direct", "direct": {"hostname": "mta.example.com"},
+			"send_budget": {"per_hour": %d}, "recipient_policy": {"deny": ["*@blocked.example"]}, `+route+`}`,
+			perHour, domain, routeHost)
+	}
+	dir := writeConfigFiles(t, map[string]string{"email.json": files("example.net", "mx.example.com", 10)})
+	config, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.RecipientPolicy.OnWarn = func(RecipientIssue) {}
+	c, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx := c.route(&Message{To: []string{"a@example.net"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trigger := make(chan struct{})
+	reloads := make(chan error)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.WatchConfig(ctx, WatchOptions{Interval: -1, trigger: trigger, OnReload: func(err error) { reloads <- err }})
+	}()
+	reload := func(content string) error {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, "email.json"), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		trigger <- struct{}{}
+		return <-reloads
+	}
+
+	// Domains, limits and the policy are reloaded; the route keeps its
+	// provider.
+	if err := reload(files("example.org", "mx.example.com", 1)); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := c.route(&Message{To: []string{"a@example.org"}}); got != mx {
+		t.Error("reloaded route did not keep its provider")
+	}
+	if got := c.sendLimits().config.PerHour; got != 1 {
+		t.Errorf("reloaded budget PerHour = %d, want 1", got)
+	}
+	if err := c.recipientPolicy().check(&Message{To: []string{"x@blocked.example"}}); err == nil {
+		t.Error("reloaded recipient policy does not deny")
+	}
+	if c.recipientPolicy().config.OnWarn == nil {
+		t.Error("reloaded recipient policy lost its OnWarn hook")
+	}
+
+	// Provider settings are not: the reload fails and changes nothing.
+	for name, content := range map[string]string{
+		"route provider":   files("example.com", "mx2.example.com", 5),
+		"default provider": strings.Replace(files("example.com", "mx.example.com", 5), "mta.example.com", "mta2.example.com", 1),
+	} {
+		if err := reload(content); err == nil || !strings.Contains(err.Error(), "restart") {
+			t.Errorf("%s change: reload error = %v, want a restart to be required", name, err)
+		}
+	}
+	if c.route(&Message{To: []string{"a@example.org"}}) != mx || c.sendLimits().config.PerHour != 1 {
+		t.Error("failed reload changed the settings")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("WatchConfig() = %v, want context.Canceled", err)
+	}
+}
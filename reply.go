@@ -0,0 +1,74 @@
+// reply.go - In-thread replies to messages already in the mailbox, with
+// attachments. Unlike Send, which always starts a new conversation, a reply is
+// created from the original message so it keeps the thread, the quoted history
+// and the recipients. Implemented for Outlook 365 (outlook_reply.go); Gmail
+// returns ErrUnsupported.
+package email
+
+import "context"
+
+// Reply describes an in-thread reply to an existing message.
+type Reply struct {
+	// Body is the reply text. It is placed above the quoted original; HTML
+	// markup is rendered by Outlook.
+	Body string
+
+	// Attachments are uploaded to the reply before it is sent (optional).
+	Attachments []Attachment
+
+	// All replies to the sender and all original recipients (reply-all)
+	// instead of the sender only.
+	All bool
+}
+
+// ReplyProvider is implemented by providers that can reply in-thread to a
+// message in the configured mailbox (Outlook 365).
+type ReplyProvider interface {
+	// ReplyTo sends r as a reply to the message with the given id.
+	ReplyTo(ctx context.Context, id string, r Reply) error
+}
+
+// replier returns the client's provider as a ReplyProvider, or ErrUnsupported.
+func (c *Client) replier() (ReplyProvider, error) {
+	rp, ok := c.provider.(ReplyProvider)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return rp, nil
+}
+
+// ReplyTo replies in-thread to the message with the given id, with a default
+// timeout.
+//
+// Example:
+//
+//	err := client.ReplyTo(msgID, email.Reply{
+//	    Body:        "Please find the requested invoice attached.",
+//	    Attachments: []email.Attachment{{Filename: "invoice.pdf", Content: pdf}},
+//	})
+func (c *Client) ReplyTo(id string, r Reply) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	return c.ReplyToWithContext(ctx, id, r)
+}
+
+// ReplyToWithContext is ReplyTo with a caller-supplied context. Like
+// sends, replies count against the client's SendBudget and are recorded by
+// its UsageMeter, though without recipients, which are the original
+// message's and not known here.
+func (c *Client) ReplyToWithContext(ctx context.Context, id string, r Reply) error {
+	rp, err := c.replier()
+	if err != nil {
+		return err
+	}
+	if b := c.sendLimits(); b != nil {
+		if err := b.take(); err != nil {
+			return err
+		}
+	}
+	err = rp.ReplyTo(ctx, id, r)
+	if c.usage != nil {
+		c.usage.record(ctx, &Message{Body: r.Body, Attachments: r.Attachments}, err)
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// mockReplier is a send-only provider that also implements ReplyProvider.
+type mockReplier struct {
+	mockProvider
+	id    string
+	reply Reply
+}
+
+func (m *mockReplier) ReplyTo(_ context.Context, id string, r Reply) error {
+	m.id, m.reply = id, r
+	return nil
+}
+
+func TestClientReplyTo(t *testing.T) {
+	if err := (&Client{provider: &mockProvider{}}).ReplyTo("id", Reply{}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("ReplyTo on send-only provider: got %v, want ErrUnsupported", err)
+	}
+
+	mock := &mockReplier{}
+	c := &Client{provider: mock}
+	r := Reply{Body: "see attached", All: true, Attachments: []Attachment{{Filename: "a.pdf"}}}
+	if err := c.ReplyTo("msg-1", r); err != nil {
+		t.Fatalf("ReplyTo: %v", err)
+	}
+	if mock.id != "msg-1" || !mock.reply.All || len(mock.reply.Attachments) != 1 {
+		t.Errorf("provider got id=%q reply=%+v", mock.id, mock.reply)
+	}
+}
+
+func TestClientReplyToBudgetAndUsage(t *testing.T) {
+	budget, err := newSendBudget(&SendBudget{PerHour: 1, Latch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := &mockReplier{}
+	usage := NewUsageMeter()
+	c := &Client{provider: mock, budget: budget, usage: usage}
+	if err := c.ReplyTo("msg-1", Reply{Body: "on it"}); err != nil {
+		t.Fatalf("ReplyTo: %v", err)
+	}
+	mock.id = ""
+	if err := c.ReplyTo("msg-2", Reply{Body: "on it"}); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("ReplyTo with a tripped budget: got %v, want ErrBudgetExceeded", err)
+	}
+	if mock.id != "" {
+		t.Error("reply sent despite the tripped budget")
+	}
+	if got := usage.Snapshot(); len(got) != 1 || got[0].Messages != 1 {
+		t.Errorf("usage = %+v, want one reply", got)
+	}
+}
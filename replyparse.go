@@ -0,0 +1,127 @@
+// replyparse.go - Splitting inbound replies into new content, signature and
+// quoted history, in the spirit of GitHub's email_reply_parser. Mail clients
+// agree on no markup for this, so the parser works line by line from the
+// conventions they do share: "> " quoting, attribution lines ("On ... wrote:"
+// and its translations), Outlook's header block and separators, the "-- "
+// signature delimiter and mobile "Sent from my ..." footers.
+package email
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ParsedReply is a reply body split by ParseReply.
+type ParsedReply struct {
+	// Body is the new content the sender wrote, with inline answers kept.
+	Body string
+
+	// Signature is the sender's signature, if one was recognized.
+	Signature string
+
+	// Quoted is the quoted history: inline "> " lines and everything from
+	// the attribution of the previous message on.
+	Quoted string
+}
+
+// ParseReply splits a plain-text reply into its parts. For messages read
+// from a mailbox, FullMessage.ParseReply also handles HTML-only bodies.
+//
+// Example:
+//
+//	r := email.ParseReply(full.BodyText)
+//	if strings.EqualFold(r.Body, "approve") {
+//	    ...
+//	}
+func ParseReply(text string) ParsedReply {
+	lines, kinds := classifyReply(text)
+	var parts [3][]string
+	for i, line := range lines {
+		parts[kinds[i]] = append(parts[kinds[i]], line)
+	}
+	join := func(l []string) string {
+		return PlainText(strings.Join(l, "\n"), TextOptions{})
+	}
+	return ParsedReply{Body: join(parts[replyBody]), Signature: join(parts[replySignature]), Quoted: join(parts[replyQuoted])}
+}
+
+// ParseReply splits the message's body with ParseReply, converting an
+// HTML-only body to text first.
+func (m *FullMessage) ParseReply() ParsedReply {
+	return ParseReply(m.Text(TextOptions{}))
+}
+
+// replyKind classifies a line of a reply.
+type replyKind int
+
+const (
+	replyBody replyKind = iota
+	replySignature
+	replyQuoted
+)
+
+// classifyReply splits text into lines and classifies each. Once quoted
+// history starts it runs to the end; a signature runs until the history.
+func classifyReply(text string) ([]string, []replyKind) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	kinds := make([]replyKind, len(lines))
+	state := replyBody
+	for i, line := range lines {
+		if state != replyQuoted && quoteStart(lines, i) {
+			state = replyQuoted
+		}
+		if state == replyBody && signatureStart(line) {
+			state = replySignature
+		}
+		switch {
+		case state == replyQuoted:
+			kinds[i] = replyQuoted
+		case strings.HasPrefix(strings.TrimSpace(line), ">"):
+			kinds[i] = replyQuoted
+		default:
+			kinds[i] = state
+		}
+	}
+	return lines, kinds
+}
+
+var (
+	// attributionRe matches a reply attribution ("On Mon, 1 Jan 2024 at
+	// 10:00, Alice <a@example.com> wrote:") in the languages most clients
+	// ship; clients may wrap it onto a second line.
+	attributionRe = regexp.MustCompile(`^(On\s.{1,200}\swrote|Am\s.{1,200}\sschrieb.{0,40}|Le\s.{1,200}\sa\sécrit\s?|El\s.{1,200}\sescribió|Il\s.{1,200}\sha\sscritto|Op\s.{1,200}\sschreef.{0,40})\s?:$`)
+
+	// originalMessageRe matches separators clients put above forwarded or
+	// quoted messages.
+	originalMessageRe = regexp.MustCompile(`^(-{2,}\s*(Original Message|Forwarded message|Ursprüngliche Nachricht|Message d'origine)\s*-{2,}|_{20,})$`)
+
+	// mobileSignatureRe matches the footers mobile and webmail clients add.
+	mobileSignatureRe = regexp.MustCompile(`^(Sent from my \S.{0,40}|Sent from (Mail|Outlook|Yahoo Mail) for .{1,40}|Get Outlook for (iOS|Android)|Sent from Yahoo Mail.{0,40}|Von meinem .{1,40} gesendet|Envoyé de mon .{1,40})$`)
+)
+
+// quoteStart reports whether lines[i] starts the quoted history.
+func quoteStart(lines []string, i int) bool {
+	line := strings.TrimSpace(lines[i])
+	if originalMessageRe.MatchString(line) || attributionRe.MatchString(line) {
+		return true
+	}
+	if i+1 < len(lines) {
+		next := strings.TrimSpace(lines[i+1])
+		if line != "" && next != "" && !attributionRe.MatchString(next) && attributionRe.MatchString(line+" "+next) {
+			return true
+		}
+		if strings.HasPrefix(line, "From: ") && (strings.HasPrefix(next, "Sent: ") || strings.HasPrefix(next, "Date: ")) {
+			return true
+		}
+	}
+	return false
+}
+
+// signatureStart reports whether line starts a signature: the "-- "
+// delimiter (often stripped to "--" in transit) or a mobile footer.
+func signatureStart(line string) bool {
+	if line == "-- " || strings.TrimRight(line, " \t") == "--" {
+		return true
+	}
+	return mobileSignatureRe.MatchString(strings.TrimSpace(line))
+}
@@ -0,0 +1,67 @@
+package email
+
+import "testing"
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want ParsedReply
+	}{
+		{
+			name: "plain",
+			text: "Just a message.\r\n",
+			want: ParsedReply{Body: "Just a message."},
+		},
+		{
+			name: "gmail",
+			text: "Yes, approved.\n\nBob\n-- \nBob Smith | CFO\n\nOn Mon, 1 Jan 2024 at 10:00, Alice <a@example.com> wrote:\n> Can you approve?\n>\n> Alice",
+			want: ParsedReply{
+				Body:      "Yes, approved.\n\nBob",
+				Signature: "--\nBob Smith | CFO",
+				Quoted:    "On Mon, 1 Jan 2024 at 10:00, Alice <a@example.com> wrote:\n> Can you approve?\n>\n> Alice",
+			},
+		},
+		{
+			name: "mobile footer",
+			text: "On my way\n\nSent from my iPhone\n\n> On Jan 1, 2024, at 10:00, Alice wrote:\n> Where are you?",
+			want: ParsedReply{Body: "On my way", Signature: "Sent from my iPhone", Quoted: "> On Jan 1, 2024, at 10:00, Alice wrote:\n> Where are you?"},
+		},
+		{
+			name: "inline answers",
+			text: "> Ship Monday?\nYes.\n> Who reviews?\nCarol.",
+			want: ParsedReply{Body: "Yes.\nCarol.", Quoted: "> Ship Monday?\n> Who reviews?"},
+		},
+		{
+			name: "outlook",
+			text: "Done.\n\n________________________________\nFrom: Alice <a@example.com>\nSent: Monday, January 1, 2024 10:00 AM\nSubject: Task",
+			want: ParsedReply{Body: "Done.", Quoted: "________________________________\nFrom: Alice <a@example.com>\nSent: Monday, January 1, 2024 10:00 AM\nSubject: Task"},
+		},
+		{
+			name: "german attribution",
+			text: "Passt.\n\nAm 01.01.2024 um 10:00 schrieb Alice <a@example.com>:\n> Passt das?",
+			want: ParsedReply{Body: "Passt.", Quoted: "Am 01.01.2024 um 10:00 schrieb Alice <a@example.com>:\n> Passt das?"},
+		},
+		{
+			name: "wrapped attribution",
+			text: "On Monday we ship.\nOn Mon, 1 Jan 2024 at 10:00, Alice Example\n<alice@example.com> wrote:\n\nShip?",
+			want: ParsedReply{Body: "On Monday we ship.", Quoted: "On Mon, 1 Jan 2024 at 10:00, Alice Example\n<alice@example.com> wrote:\n\nShip?"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseReply(tt.text); got != tt.want {
+				t.Errorf("ParseReply() =\n%+q\nwant\n%+q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFullMessageParseReply(t *testing.T) {
+	m := &FullMessage{BodyHTML: `<div>Approved.</div><div>Sent from my iPhone</div>` +
+		`<div class="gmail_quote"><div class="gmail_attr">On Mon, Alice &lt;a@example.com&gt; wrote:</div><blockquote>OK?</blockquote></div>`}
+	got := m.ParseReply()
+	if got.Body != "Approved." || got.Signature != "Sent from my iPhone" || got.Quoted != "On Mon, Alice <a@example.com> wrote:\n\nOK?" {
+		t.Errorf("ParseReply() = %+q", got)
+	}
+}
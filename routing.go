@@ -0,0 +1,201 @@
+// routing.go - Recipient-domain based provider routing. A Client built from a
+// Config with Routes sends each message through the first route whose domain
+// patterns match every recipient, and through the top-level provider
+// otherwise. SendVia picks a provider explicitly by name instead. Routing only
+// affects sending; mailbox and calendar operations keep using the top-level
+// (default) provider.
+package email
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Route maps recipient domain patterns to a provider configuration.
+type Route struct {
+	// Name identifies the route for Client.SendVia. If empty it defaults to
+	// the route's Config.Provider (e.g. "outlook365").
+	Name string
+
+	// Domains lists the recipient patterns this route accepts. A pattern is a
+	// bare domain ("ourcompany.com"), a subdomain wildcard ("*.ourcompany.com"),
+	// or a full address glob ("*@ourcompany.com", "ops-*@ourcompany.com").
+	// Matching is case-insensitive; "*" matches any recipient. A route with no
+	// Domains is never selected automatically and is reachable only through
+	// SendVia.
+	Domains []string
+
+	// Config is the provider configuration used for matching messages. Only
+	// the provider fields (Provider, Outlook, Gmail, Direct) and SendWindows
+	// are read; Routes on a route's Config are not allowed.
+	Config *Config
+}
+
+// providerRoute is a Route compiled into a live provider.
+type providerRoute struct {
+	name     string
+	patterns []string
+	provider Provider
+	windows  *SendWindows
+}
+
+// newRoutes builds the providers for each configured route. A route named
+// like one of keep takes over its provider instead, in order for routes of
+// the same name, so that its quota, token cache and throttle carry over.
+func newRoutes(routes []Route, keep []providerRoute) ([]providerRoute, error) {
+	out := make([]providerRoute, 0, len(routes))
+	names := make(map[string]bool, len(routes))
+	kept := make(map[string][]Provider, len(keep))
+	for _, r := range keep {
+		kept[r.name] = append(kept[r.name], r.provider)
+	}
+	for i, r := range routes {
+		if r.Config == nil {
+			return nil, fmt.Errorf("route %d: configuration is required", i)
+		}
+		if len(r.Config.Routes) > 0 {
+			return nil, fmt.Errorf("route %d: routes cannot be nested", i)
+		}
+		if r.Name != "" {
+			if names[r.Name] {
+				return nil, fmt.Errorf("route %d: duplicate route name %q", i, r.Name)
+			}
+			names[r.Name] = true
+		}
+		patterns := make([]string, 0, len(r.Domains))
+		for _, d := range r.Domains {
+			p := normalizeRoutePattern(d)
+			// Surface malformed globs at construction, not on first send.
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("route %d: invalid pattern %q: %w", i, d, err)
+			}
+			patterns = append(patterns, p)
+		}
+		windows, err := newSendWindows(r.Config.SendWindows)
+		if err != nil {
+			return nil, fmt.Errorf("route %d: %w", i, err)
+		}
+		name := routeName(r)
+		var provider Provider
+		if k := kept[name]; len(k) > 0 {
+			provider, kept[name] = k[0], k[1:]
+		} else if provider, err = newProvider(r.Config); err != nil {
+			return nil, fmt.Errorf("route %d: %w", i, err)
+		}
+		out = append(out, providerRoute{name: name, patterns: patterns, provider: provider, windows: windows})
+	}
+	return out, nil
+}
+
+// routeName returns the name r is reachable under with SendVia.
+func routeName(r Route) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Config.Provider
+}
+
+// route returns the provider a message should be sent through: the first
+// route matching every recipient, or the client's default provider.
+func (c *Client) route(msg *Message) Provider {
+	rcpts := messageRecipients(msg)
+	if len(rcpts) == 0 {
+		return c.provider
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, r := range c.routes {
+		if r.matchesAll(rcpts) {
+			return r.provider
+		}
+	}
+	return c.provider
+}
+
+// SendVia sends msg through the named provider with a default timeout,
+// bypassing recipient routing. name is the top-level Config.Provider or a
+// Route's Name; an unknown name returns an error wrapping ErrNotFound.
+//
+// Example:
+//
+//	// Marketing mail through the ESP route, regardless of recipients.
+//	err := client.SendVia("marketing", msg)
+func (c *Client) SendVia(name string, msg *Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	return c.SendViaWithContext(ctx, name, msg)
+}
+
+// SendViaWithContext is SendVia with a caller-supplied context.
+func (c *Client) SendViaWithContext(ctx context.Context, name string, msg *Message) error {
+	provider, err := c.providerNamed(name)
+	if err != nil {
+		return err
+	}
+	_, err = c.send(ctx, provider, msg, false)
+	return err
+}
+
+// providerNamed resolves a provider name: the default provider first, then
+// the routes in order.
+func (c *Client) providerNamed(name string) (Provider, error) {
+	if name == c.name {
+		return c.provider, nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, r := range c.routes {
+		if r.name == name {
+			return r.provider, nil
+		}
+	}
+	return nil, fmt.Errorf("provider %q: %w", name, ErrNotFound)
+}
+
+// matchesAll reports whether every recipient matches one of the route's
+// patterns. A message split across routes falls back to the default provider
+// rather than being divided, so Cc/Bcc visibility is never changed.
+func (r providerRoute) matchesAll(rcpts []string) bool {
+	if len(r.patterns) == 0 {
+		return false
+	}
+	for _, addr := range rcpts {
+		if !r.matches(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether a single address matches one of the patterns.
+func (r providerRoute) matches(addr string) bool {
+	addr = strings.ToLower(asciiAddress(parseAddr(addr)))
+	for _, p := range r.patterns {
+		if ok, _ := path.Match(p, addr); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeRoutePattern lower-cases a pattern, converts an internationalized
+// domain to ASCII as recipients are, and turns a bare domain into an address
+// glob ("ourcompany.com" -> "*@ourcompany.com").
+func normalizeRoutePattern(p string) string {
+	p = strings.ToLower(strings.TrimSpace(p))
+	if p == "*" || strings.Contains(p, "@") {
+		return asciiAddress(p)
+	}
+	return "*@" + asciiDomain(p)
+}
+
+// messageRecipients returns all To, Cc and Bcc addresses of a message.
+func messageRecipients(msg *Message) []string {
+	out := make([]string, 0, len(msg.To)+len(msg.Cc)+len(msg.Bcc))
+	out = append(out, msg.To...)
+	out = append(out, msg.Cc...)
+	out = append(out, msg.Bcc...)
+	return out
+}
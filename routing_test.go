@@ -0,0 +1,160 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNormalizeRoutePattern(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"ourcompany.com", "*@ourcompany.com"},
+		{"  OurCompany.COM ", "*@ourcompany.com"},
+		{"*.ourcompany.com", "*@*.ourcompany.com"},
+		{"*@ourcompany.com", "*@ourcompany.com"},
+		{"ops-*@ourcompany.com", "ops-*@ourcompany.com"},
+		{"*", "*"},
+	}
+	for _, tt := range tests {
+		if got := normalizeRoutePattern(tt.in); got != tt.want {
+			t.Errorf("normalizeRoutePattern(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestClientRoute(t *testing.T) {
+	def := &mockProvider{}
+	internal := &mockProvider{}
+	partner := &mockProvider{}
+	c := &Client{
+		provider: def,
+		routes: []providerRoute{
+			{patterns: []string{normalizeRoutePattern("ourcompany.com")}, provider: internal},
+			{patterns: []string{normalizeRoutePattern("*.partner.org")}, provider: partner},
+		},
+	}
+
+	tests := []struct {
+		name string
+		msg  *Message
+		want Provider
+	}{
+		{
+			name: "all internal recipients",
+			msg:  &Message{To: []string{"a@ourcompany.com"}, Cc: []string{"B@OurCompany.com"}},
+			want: internal,
+		},
+		{
+			name: "display-named recipient",
+			msg:  &Message{To: []string{"Alice <alice@ourcompany.com>"}},
+			want: internal,
+		},
+		{
+			name: "subdomain wildcard",
+			msg:  &Message{To: []string{"x@eu.partner.org"}},
+			want: partner,
+		},
+		{
+			name: "subdomain wildcard excludes apex",
+			msg:  &Message{To: []string{"x@partner.org"}},
+			want: def,
+		},
+		{
+			name: "mixed recipients fall back to default",
+			msg:  &Message{To: []string{"a@ourcompany.com"}, Bcc: []string{"c@example.com"}},
+			want: def,
+		},
+		{
+			name: "external recipient",
+			msg:  &Message{To: []string{"c@example.com"}},
+			want: def,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.route(tt.msg); got != tt.want {
+				t.Errorf("route() picked the wrong provider")
+			}
+		})
+	}
+}
+
+func TestClientSendRouted(t *testing.T) {
+	def := &mockProvider{}
+	internal := &mockProvider{}
+	c := &Client{
+		provider: def,
+		routes:   []providerRoute{{patterns: []string{"*@ourcompany.com"}, provider: internal}},
+	}
+	msg := &Message{
+		From:    "noreply@ourcompany.com",
+		To:      []string{"ops@ourcompany.com"},
+		Subject: "Routed",
+		Body:    "Body",
+	}
+	if err := c.SendWithContext(context.Background(), msg); err != nil {
+		t.Fatalf("SendWithContext: %v", err)
+	}
+	if len(internal.calls) != 1 || len(def.calls) != 0 {
+		t.Errorf("calls: internal=%d default=%d, want 1/0", len(internal.calls), len(def.calls))
+	}
+}
+
+func TestClientSendVia(t *testing.T) {
+	def := &mockProvider{}
+	esp := &mockProvider{}
+	c := &Client{
+		provider: def,
+		name:     ProviderOutlook365,
+		routes:   []providerRoute{{name: "marketing", provider: esp}},
+	}
+	msg := &Message{
+		From:    "news@ourcompany.com",
+		To:      []string{"customer@example.com"},
+		Subject: "Newsletter",
+		Body:    "Body",
+	}
+
+	// A route without patterns is never picked automatically...
+	if got := c.route(msg); got != def {
+		t.Error("pattern-less route was selected by recipient routing")
+	}
+	// ...but is reachable by name.
+	if err := c.SendVia("marketing", msg); err != nil {
+		t.Fatalf("SendVia(marketing): %v", err)
+	}
+	if err := c.SendVia(ProviderOutlook365, msg); err != nil {
+		t.Fatalf("SendVia(outlook365): %v", err)
+	}
+	if len(esp.calls) != 1 || len(def.calls) != 1 {
+		t.Errorf("calls: esp=%d default=%d, want 1/1", len(esp.calls), len(def.calls))
+	}
+	if err := c.SendVia("unknown", msg); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SendVia(unknown): got %v, want ErrNotFound", err)
+	}
+}
+
+func TestNewRoutesErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []Route
+	}{
+		{"nil config", []Route{{Domains: []string{"x.com"}}}},
+		{"duplicate name", []Route{
+			{Name: "esp", Config: &Config{Provider: "nope"}},
+			{Name: "esp", Config: &Config{Provider: "nope"}},
+		}},
+		{"bad pattern", []Route{{Domains: []string{"[x.com"}, Config: &Config{Provider: ProviderGmail}}}},
+		{"nested", []Route{{Domains: []string{"x.com"}, Config: &Config{Routes: []Route{{}}}}}},
+		{"unsupported provider", []Route{{Domains: []string{"x.com"}, Config: &Config{Provider: "nope"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newRoutes(tt.routes, nil); err == nil {
+				t.Error("newRoutes() error = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !email_no_gmail
+
+package email
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestGmailSaveMessageRawUnsupported locks the YAGNI decision: Gmail's
+// SaveMessageRaw is a stub returning ErrUnsupported (satisfies the compile-time
+// MailboxProvider assertion without an untested base64url impl). (G3)
+func TestGmailSaveMessageRawUnsupported(t *testing.T) {
+	g := &gmailProvider{} // nil service is never touched; stub returns before use
+	_, err := g.SaveMessageRaw(context.Background(), "id", t.TempDir(), "subject")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("gmail SaveMessageRaw: got %v, want ErrUnsupported", err)
+	}
+}
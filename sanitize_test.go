@@ -1,8 +1,6 @@
 package email
 
 import (
-	"context"
-	"errors"
 	"strings"
 	"testing"
 	"unicode/utf8"
@@ -85,14 +83,3 @@ func TestEnsureEMLSuffix_MultibyteCapNoSplit(t *testing.T) {
 		t.Errorf("stem = %d bytes; want <= %d", len(stem), emlStemMaxBytes)
 	}
 }
-
-// TestGmailSaveMessageRawUnsupported locks the YAGNI decision: Gmail's
-// SaveMessageRaw is a stub returning ErrUnsupported (satisfies the compile-time
-// MailboxProvider assertion without an untested base64url impl). (G3)
-func TestGmailSaveMessageRawUnsupported(t *testing.T) {
-	g := &gmailProvider{} // nil service is never touched; stub returns before use
-	_, err := g.SaveMessageRaw(context.Background(), "id", t.TempDir(), "subject")
-	if !errors.Is(err, ErrUnsupported) {
-		t.Errorf("gmail SaveMessageRaw: got %v, want ErrUnsupported", err)
-	}
-}
@@ -0,0 +1,232 @@
+// schedule.go - Scheduled sending. A message with a future SendAt is
+// deferred by Outlook 365 in the mailbox itself (the Graph deferred-send
+// property); for the other providers a client's Scheduler holds it in
+// memory and sends it through the client when it is due, with the
+// recipient policy, send windows and budget applied at that time.
+package email
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Scheduler holds messages until their SendAt and then sends them. Held
+// messages live in memory: they are lost if the process exits, and Stop
+// returns them so that they can be persisted. The zero Scheduler is ready
+// to use.
+//
+// Example:
+//
+//	scheduler := &email.Scheduler{
+//	    OnResult: func(s email.ScheduledSend, err error) {
+//	        if err != nil {
+//	            log.Printf("scheduled send %s failed: %v", s.ID, err)
+//	        }
+//	    },
+//	}
+//	config.Scheduler = scheduler
+//	defer scheduler.Stop()
+type Scheduler struct {
+	// OnResult, if set, is called with the outcome of every scheduled send.
+	OnResult func(ScheduledSend, error)
+
+	mu      sync.Mutex
+	queue   []*scheduledSend // by SendAt
+	timer   *time.Timer
+	lastID  int64
+	stopped bool
+}
+
+// ScheduledSend describes a message held by a Scheduler.
+type ScheduledSend struct {
+	// ID identifies the send, e.g. to Cancel it. SendWithResult reports it
+	// as SendResult.ScheduleID.
+	ID string
+
+	// SendAt is when the message is due.
+	SendAt time.Time
+
+	// Message is the held copy of the message.
+	Message *Message
+}
+
+// scheduledSend is a held message with the send that dispatches it.
+type scheduledSend struct {
+	ScheduledSend
+	send func(context.Context) error
+
+	// ctx carries the values of the scheduling context, such as its usage
+	// tags, to the send.
+	ctx context.Context
+}
+
+// nativeScheduler is implemented by providers that defer messages to their
+// SendAt themselves.
+type nativeScheduler interface {
+	// schedules reports whether the provider defers msg itself.
+	schedules(msg *Message) bool
+}
+
+// schedulesNatively reports whether provider defers msg itself. Signed
+// messages are submitted as MIME, which carries no deferred send time.
+func (c *Client) schedulesNatively(provider Provider, msg *Message) bool {
+	s, ok := provider.(nativeScheduler)
+	return ok && c.sealer == nil && s.schedules(msg)
+}
+
+// schedule hands a copy of msg to the client's Scheduler, to be sent
+// through provider at msg.SendAt with the values of ctx, but not its
+// deadline or cancellation.
+func (c *Client) schedule(ctx context.Context, provider Provider, msg *Message) (*SendResult, error) {
+	if c.scheduler == nil {
+		return nil, fmt.Errorf("message scheduled for %s: provider cannot schedule sends and no Scheduler is configured: %w",
+			msg.SendAt.Format(time.RFC3339), ErrUnsupported)
+	}
+	held := cloneMessage(msg)
+	id, err := c.scheduler.add(context.WithoutCancel(ctx), msg.SendAt, held, func(ctx context.Context) error {
+		due := *held
+		due.SendAt = time.Time{}
+		_, err := c.send(ctx, provider, &due, false)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SendResult{ScheduleID: id}, nil
+}
+
+// add queues msg to be sent by send at at, with a context carrying the
+// values of ctx, and returns its id.
+func (s *Scheduler) add(ctx context.Context, at time.Time, msg *Message, send func(context.Context) error) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return "", fmt.Errorf("scheduler stopped")
+	}
+	s.lastID++
+	e := &scheduledSend{
+		ScheduledSend: ScheduledSend{ID: strconv.FormatInt(s.lastID, 10), SendAt: at, Message: msg},
+		send:          send,
+		ctx:           ctx,
+	}
+	i := sort.Search(len(s.queue), func(i int) bool { return s.queue[i].SendAt.After(at) })
+	s.queue = append(s.queue, nil)
+	copy(s.queue[i+1:], s.queue[i:])
+	s.queue[i] = e
+	s.arm()
+	return e.ID, nil
+}
+
+// arm sets the timer for the first queued send. s.mu must be held.
+func (s *Scheduler) arm() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if len(s.queue) == 0 || s.stopped {
+		return
+	}
+	s.timer = time.AfterFunc(time.Until(s.queue[0].SendAt), s.dispatch)
+}
+
+// dispatch sends the messages that are due, in SendAt order.
+func (s *Scheduler) dispatch() {
+	s.mu.Lock()
+	now := time.Now()
+	n := 0
+	for n < len(s.queue) && !s.queue[n].SendAt.After(now) {
+		n++
+	}
+	due := s.queue[:n:n]
+	s.queue = s.queue[n:]
+	s.arm()
+	s.mu.Unlock()
+
+	for _, e := range due {
+		ctx, cancel := context.WithTimeout(e.ctx, defaultTimeout)
+		err := e.send(ctx)
+		cancel()
+		if s.OnResult != nil {
+			s.OnResult(e.ScheduledSend, err)
+		}
+	}
+}
+
+// Pending returns the held messages, soonest first.
+func (s *Scheduler) Pending() []ScheduledSend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending()
+}
+
+// pending returns the held messages. s.mu must be held.
+func (s *Scheduler) pending() []ScheduledSend {
+	out := make([]ScheduledSend, len(s.queue))
+	for i, e := range s.queue {
+		out[i] = e.ScheduledSend
+	}
+	return out
+}
+
+// Cancel drops the held message id, reporting whether it was still held.
+func (s *Scheduler) Cancel(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, e := range s.queue {
+		if e.ID == id {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			s.arm()
+			return true
+		}
+	}
+	return false
+}
+
+// Stop stops sending and returns the messages still held, soonest first.
+// Sends in progress finish; scheduling further sends fails.
+func (s *Scheduler) Stop() []ScheduledSend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := s.pending()
+	s.stopped, s.queue = true, nil
+	s.arm()
+	return pending
+}
+
+// cloneMessage returns a copy of msg that shares no slices, maps or
+// attachment content with it, so that the caller may reuse msg while the
+// copy is held.
+func cloneMessage(msg *Message) *Message {
+	out := *msg
+	out.To = append([]string(nil), msg.To...)
+	out.Cc = append([]string(nil), msg.Cc...)
+	out.Bcc = append([]string(nil), msg.Bcc...)
+	out.Labels = append([]string(nil), msg.Labels...)
+	if msg.Headers != nil {
+		out.Headers = make(map[string]string, len(msg.Headers))
+		for k, v := range msg.Headers {
+			out.Headers[k] = v
+		}
+	}
+	if msg.Attachments != nil {
+		out.Attachments = make([]Attachment, len(msg.Attachments))
+		for i, a := range msg.Attachments {
+			a.Content = append([]byte(nil), a.Content...)
+			out.Attachments[i] = a
+		}
+	}
+	if msg.SaveToSent != nil {
+		save := *msg.SaveToSent
+		out.SaveToSent = &save
+	}
+	if msg.DSN != nil {
+		dsn := *msg.DSN
+		dsn.Notify = append([]string(nil), msg.DSN.Notify...)
+		out.DSN = &dsn
+	}
+	return &out
+}
@@ -0,0 +1,97 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClientScheduledSend(t *testing.T) {
+	results := make(chan error, 1)
+	scheduler := &Scheduler{OnResult: func(_ ScheduledSend, err error) { results <- err }}
+	defer scheduler.Stop()
+	mock := &mockProvider{}
+	usage := NewUsageMeter()
+	c := &Client{provider: mock, scheduler: scheduler, usage: usage}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+		Headers: map[string]string{"X-Campaign": "spring"}, SendAt: time.Now().Add(50 * time.Millisecond)}
+
+	ctx, cancel := context.WithCancel(WithUsageTags(context.Background(), "acme", "digest"))
+	res, err := c.SendWithResultContext(ctx, msg)
+	cancel()
+	if err != nil || res.ScheduleID == "" {
+		t.Fatalf("SendWithResult() = %+v, %v", res, err)
+	}
+	// The held message is a copy; the caller may reuse msg.
+	msg.To[0], msg.Headers["X-Campaign"] = "c@example.com", "summer"
+
+	if p := scheduler.Pending(); len(p) != 1 || p[0].ID != res.ScheduleID {
+		t.Fatalf("Pending() = %+v", p)
+	}
+	select {
+	case err := <-results:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduled message not sent")
+	}
+	if len(mock.calls) != 1 || !mock.calls[0].SendAt.IsZero() ||
+		mock.calls[0].To[0] != "b@example.com" || mock.calls[0].Headers["X-Campaign"] != "spring" {
+		t.Errorf("sent %+v", mock.calls)
+	}
+	// The send keeps the usage tags, but not the cancellation, of its context.
+	if u := usage.Snapshot(); len(u) != 1 || u[0].Tenant != "acme" || u[0].Tag != "digest" || u[0].Messages != 1 {
+		t.Errorf("usage = %+v", u)
+	}
+
+	// A SendAt in the past sends at once.
+	msg.SendAt = time.Now().Add(-time.Minute)
+	if err := c.Send(msg); err != nil || len(mock.calls) != 2 {
+		t.Errorf("past SendAt: %v, %d calls", err, len(mock.calls))
+	}
+}
+
+func TestSchedulerCancelStop(t *testing.T) {
+	s := &Scheduler{}
+	sent := make(chan string, 3)
+	at := time.Now().Add(time.Hour)
+	var ids []string
+	for _, subject := range []string{"late", "early", "middle"} {
+		offset := map[string]time.Duration{"early": 0, "middle": time.Minute, "late": 2 * time.Minute}[subject]
+		id, err := s.add(context.Background(), at.Add(offset), &Message{Subject: subject}, func(context.Context) error {
+			sent <- subject
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if !s.Cancel(ids[2]) || s.Cancel(ids[2]) {
+		t.Error("Cancel() did not drop the message exactly once")
+	}
+	pending := s.Stop()
+	if len(pending) != 2 || pending[0].Message.Subject != "early" || pending[1].Message.Subject != "late" {
+		t.Errorf("Stop() = %+v, want early then late", pending)
+	}
+	if _, err := s.add(context.Background(), time.Now(), &Message{}, nil); err == nil {
+		t.Error("stopped scheduler accepted a message")
+	}
+	if len(sent) != 0 {
+		t.Error("message sent before it was due")
+	}
+}
+
+func TestClientScheduledSendUnsupported(t *testing.T) {
+	c := &Client{provider: &mockProvider{}}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+		SendAt: time.Now().Add(time.Hour)}
+	if err := c.Send(msg); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Send() without a scheduler = %v, want ErrUnsupported", err)
+	}
+	if err := c.Send(msg, WithDryRun()); err != nil {
+		t.Errorf("dry run = %v", err)
+	}
+}
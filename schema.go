@@ -0,0 +1,185 @@
+// schema.go - A machine-readable description of the LoadConfig file format,
+// for tools that generate settings UIs, validate configuration in CI or
+// document it. ConfigSchema is derived from the profile structs themselves
+// (their json, doc, env, required, secret and enum tags), so it cannot drift
+// from what LoadConfig accepts.
+package email
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Schema describes the configuration files read by LoadConfig. It
+// marshals to JSON for consumers in other languages.
+type Schema struct {
+	// Version is the package version the schema describes.
+	Version string `json:"version"`
+
+	// Fields are the top-level settings.
+	Fields []SchemaField `json:"fields"`
+
+	// Env lists the environment variables LoadConfig reads, including those
+	// overriding fields (see SchemaField.Env).
+	Env []SchemaEnv `json:"env"`
+}
+
+// SchemaField describes one setting.
+type SchemaField struct {
+	// Key is the setting's JSON key.
+	Key string `json:"key"`
+
+	// Path locates the setting from the top: keys joined by ".", with "[]"
+	// for array elements and "{}" for map values, e.g.
+	// "direct.ip_pools{}.addrs".
+	Path string `json:"path"`
+
+	// Type is "string", "integer", "boolean", "duration" (a string such as
+	// "15m"), "array", "map" (an object with arbitrary keys), "object" or
+	// "config" (a nested configuration with the top-level fields).
+	Type string `json:"type"`
+
+	// Elem is the element type of an array or map.
+	Elem string `json:"elem,omitempty"`
+
+	// Description says what the setting does.
+	Description string `json:"description"`
+
+	// Required reports that the setting must be given whenever its
+	// enclosing object is.
+	Required bool `json:"required,omitempty"`
+
+	// Secret marks credentials, to be masked in UIs and logs.
+	Secret bool `json:"secret,omitempty"`
+
+	// Enum lists the accepted values; "" stands for leaving it unset.
+	Enum []string `json:"enum,omitempty"`
+
+	// Env is the environment variable that overrides the setting.
+	Env string `json:"env,omitempty"`
+
+	// Fields describe the settings of an object, or of the elements of an
+	// array or map of objects.
+	Fields []SchemaField `json:"fields,omitempty"`
+}
+
+// SchemaEnv describes an environment variable read by LoadConfig.
+type SchemaEnv struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Path is the setting the variable overrides, if any.
+	Path string `json:"path,omitempty"`
+}
+
+// ConfigSchema describes the configuration file format of LoadConfig: every
+// setting with its type, description, requirement, accepted values and
+// environment variable.
+//
+// Example:
+//
+//	b, _ := json.MarshalIndent(email.ConfigSchema(), "", "  ")
+//	os.WriteFile("email.schema.json", b, 0o644)
+func ConfigSchema() *Schema {
+	s := &Schema{
+		Version: Version,
+		Fields:  schemaFields(reflect.TypeOf(configProfile{}), ""),
+		Env: []SchemaEnv{
+			{Name: "EMAIL_ENV", Description: "Environment whose overlay (email.<env>.json) LoadConfig applies when called with no env."},
+			{Name: "EMAIL_CONFIG_DIR", Description: "Directory of the configuration files; defaults to the working directory."},
+		},
+	}
+	var collect func([]SchemaField)
+	collect = func(fields []SchemaField) {
+		for _, f := range fields {
+			if f.Env != "" {
+				s.Env = append(s.Env, SchemaEnv{Name: f.Env, Description: f.Description, Path: f.Path})
+			}
+			collect(f.Fields)
+		}
+	}
+	collect(s.Fields)
+	return s
+}
+
+var (
+	durationType      = reflect.TypeOf(profileDuration(0))
+	configProfileType = reflect.TypeOf(configProfile{})
+)
+
+// schemaFields describes the fields of struct type t, whose path is prefix.
+func schemaFields(t reflect.Type, prefix string) []SchemaField {
+	var out []SchemaField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		key, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = sf.Name
+		}
+		f := SchemaField{
+			Key:         key,
+			Path:        strings.TrimPrefix(prefix+"."+key, "."),
+			Description: sf.Tag.Get("doc"),
+			Required:    sf.Tag.Get("required") == "true",
+			Secret:      sf.Tag.Get("secret") == "true",
+			Env:         sf.Tag.Get("env"),
+		}
+		if enum, ok := sf.Tag.Lookup("enum"); ok {
+			f.Enum = strings.Split(enum, ",")
+		}
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		switch ft.Kind() {
+		case reflect.Slice, reflect.Map:
+			f.Type, f.Elem = "array", schemaType(ft.Elem())
+			elemPath := f.Path + "[]"
+			if ft.Kind() == reflect.Map {
+				f.Type, elemPath = "map", f.Path+"{}"
+			}
+			if f.Elem == "object" {
+				f.Fields = schemaFields(ft.Elem(), elemPath)
+			}
+		default:
+			f.Type = schemaType(ft)
+			if f.Type == "object" {
+				f.Fields = schemaFields(ft, f.Path)
+			}
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// schemaType names the schema type of a non-container Go type.
+func schemaType(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == durationType:
+		return "duration"
+	case t == configProfileType:
+		return "config"
+	case t == reflect.TypeOf(PolicyAction(0)):
+		return "string" // parsed from its name
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int64:
+		return "integer"
+	case reflect.Struct:
+		return "object"
+	}
+	return t.Kind().String()
+}
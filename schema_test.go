@@ -0,0 +1,94 @@
+package email
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestConfigSchema(t *testing.T) {
+	s := ConfigSchema()
+	byPath := make(map[string]SchemaField)
+	var walk func([]SchemaField)
+	walk = func(fields []SchemaField) {
+		for _, f := range fields {
+			if f.Description == "" {
+				t.Errorf("%s has no description", f.Path)
+			}
+			byPath[f.Path] = f
+			walk(f.Fields)
+		}
+	}
+	walk(s.Fields)
+
+	for path, want := range map[string]string{
+		"provider":                     "string",
+		"outlook.client_secret":        "string",
+		"gmail.daily_limit":            "integer",
+		"direct.max_queue_time":        "duration",
+		"direct.retry_schedule":        "array",
+		"direct.ip_pools":              "map",
+		"direct.ip_pools{}.Addrs":      "array",
+		"direct.dkim.selector":         "string",
+		"recipient_policy.role":        "string",
+		"routes[].config":              "config",
+		"send_budget.latch":            "boolean",
+		"outlook.shared_throttle":      "boolean",
+		"deployment.headers":           "map",
+		"gmail.smtp_security":          "string",
+		"recipient_policy.deny":        "array",
+		"routes[].domains":             "array",
+		"direct.dkim.private_key_file": "string",
+	} {
+		if f, ok := byPath[path]; !ok || f.Type != want {
+			t.Errorf("%s: type %q, want %q", path, f.Type, want)
+		}
+	}
+	if f := byPath["outlook.client_secret"]; !f.Required || !f.Secret || f.Env != "OUTLOOK_CLIENT_SECRET" {
+		t.Errorf("client_secret = %+v", f)
+	}
+	if f := byPath["direct.retry_schedule"]; f.Elem != "duration" {
+		t.Errorf("retry_schedule elem = %q", f.Elem)
+	}
+	if got := strings.Join(byPath["outlook.cloud"].Enum, ","); got != ","+strings.Join([]string{CloudPublic, CloudUSGovHigh, CloudUSGovDoD, CloudChina}, ",") {
+		t.Errorf("cloud enum = %q", got)
+	}
+
+	if _, err := json.Marshal(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestConfigSchemaEnv checks that every variable the schema lists
+// overrides the setting it names.
+func TestConfigSchemaEnv(t *testing.T) {
+	s := ConfigSchema()
+	for _, e := range s.Env {
+		if e.Path != "" {
+			t.Setenv(e.Name, "from-"+e.Name)
+		}
+	}
+	p := &configProfile{}
+	p.applyEnv()
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range s.Env {
+		if e.Path == "" {
+			continue
+		}
+		var v any = doc
+		for _, key := range strings.Split(e.Path, ".") {
+			m, _ := v.(map[string]any)
+			v = m[key]
+		}
+		if v != "from-"+e.Name {
+			t.Errorf("%s sets %s = %v", e.Name, e.Path, v)
+		}
+	}
+}
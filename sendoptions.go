@@ -0,0 +1,206 @@
+// sendoptions.go - Per-send options. Transport-level concerns of a single
+// send (how long it may take, which provider carries it, whether it really
+// goes out) are not part of the message, so rather than growing Message
+// they are passed to Send as SendOptions:
+//
+//	err := client.SendWithContext(ctx, msg,
+//	    email.WithProvider("transactional"),
+//	    email.WithIdempotencyKey("order-1234-receipt"))
+package email
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// SendOption configures a single Send, SendWithContext, SendWithResult or
+// SendWithResultContext call.
+type SendOption func(*sendOptions)
+
+// sendOptions are the resolved SendOptions of a send.
+type sendOptions struct {
+	timeout        time.Duration
+	provider       string
+	dryRun         bool
+	idempotencyKey string
+	priority       Priority
+}
+
+// WithTimeout bounds the send to d. It replaces Send's default timeout
+// and shortens, but cannot extend, the deadline of a caller's context.
+func WithTimeout(d time.Duration) SendOption {
+	return func(o *sendOptions) { o.timeout = d }
+}
+
+// WithProvider sends through the named provider, bypassing recipient
+// routing like SendVia. name is the top-level Config.Provider or a Route's
+// Name; an unknown name fails with an error wrapping ErrNotFound.
+func WithProvider(name string) SendOption {
+	return func(o *sendOptions) { o.provider = name }
+}
+
+// WithDryRun goes through everything a send does up to the provider, short
+// of sending: the message is validated, checked against the recipient
+// policy and size limit, and rendered, and any error returned, but nothing
+// is sent. Send windows, send budgets, duplicate monitoring and usage
+// metering are left untouched.
+func WithDryRun() SendOption {
+	return func(o *sendOptions) { o.dryRun = true }
+}
+
+// WithIdempotencyKey makes the send idempotent under key: once a send with
+// the key has gone out, further sends with it through the same client
+// return the first send's result (and error, for ErrPartialSend and
+// ErrOutcomeUnknown) without sending again, for 24 hours. A send with the
+// key still in progress is waited for; a failed one may be retried. Keys are held in memory, so
+// they do not survive a restart.
+func WithIdempotencyKey(key string) SendOption {
+	return func(o *sendOptions) { o.idempotencyKey = key }
+}
+
+// WithPriority sends the message with priority p, overriding
+// Message.Priority.
+func WithPriority(p Priority) SendOption {
+	return func(o *sendOptions) { o.priority = p }
+}
+
+// newSendOptions resolves opts.
+func newSendOptions(opts []SendOption) sendOptions {
+	var o sendOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// sendOptionsCtxKey is the context key under which a send's options reach
+// Client.send.
+type sendOptionsCtxKey struct{}
+
+// dryRun reports whether ctx carries the options of a dry run.
+func dryRun(ctx context.Context) bool {
+	o, _ := ctx.Value(sendOptionsCtxKey{}).(*sendOptions)
+	return o != nil && o.dryRun
+}
+
+// sendWithOptions sends msg per opts, through the routed provider unless
+// WithProvider names another.
+func (c *Client) sendWithOptions(ctx context.Context, msg *Message, result bool, o sendOptions) (*SendResult, error) {
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+	provider := c.route(msg)
+	if o.provider != "" {
+		var err error
+		if provider, err = c.providerNamed(o.provider); err != nil {
+			return nil, err
+		}
+	}
+	if o.priority != "" {
+		prioritized := *msg
+		prioritized.Priority = o.priority
+		msg = &prioritized
+	}
+	if o.dryRun {
+		return c.send(context.WithValue(ctx, sendOptionsCtxKey{}, &o), provider, msg, result)
+	}
+	if o.idempotencyKey == "" {
+		return c.send(ctx, provider, msg, result)
+	}
+	return c.idempotency.do(ctx, o.idempotencyKey, func() (*SendResult, error) {
+		return c.send(ctx, provider, msg, result)
+	})
+}
+
+// renderDryRun renders msg as the built-in providers would, discarding the
+// output, for a dry run to report rendering errors.
+func renderDryRun(msg *Message) (*SendResult, error) {
+	if err := writeMessage(io.Discard, msg, rawOptions{withBcc: true}); err != nil {
+		return nil, err
+	}
+	return &SendResult{}, nil
+}
+
+// idempotencyWindow is how long a sent idempotency key is remembered.
+const idempotencyWindow = 24 * time.Hour
+
+// idempotencyKeys remembers the sends made with idempotency keys.
+type idempotencyKeys struct {
+	mu        sync.Mutex
+	sends     map[string]*idempotentSend
+	lastSweep time.Time
+}
+
+// idempotentSend is a send made with an idempotency key. done is closed
+// when it has finished.
+type idempotentSend struct {
+	done chan struct{}
+	at   time.Time
+	res  *SendResult
+	err  error
+}
+
+// do runs send unless a send with key has gone out within the window, in
+// which case it returns that send's outcome. A send with key in progress
+// is waited for first.
+func (k *idempotencyKeys) do(ctx context.Context, key string, send func() (*SendResult, error)) (*SendResult, error) {
+	for {
+		k.mu.Lock()
+		now := time.Now()
+		if k.sends == nil {
+			k.sends = make(map[string]*idempotentSend)
+		}
+		if now.Sub(k.lastSweep) > idempotencyWindow {
+			for key, s := range k.sends {
+				if !s.at.IsZero() && now.Sub(s.at) > idempotencyWindow {
+					delete(k.sends, key)
+				}
+			}
+			k.lastSweep = now
+		}
+		s, ok := k.sends[key]
+		if ok && !s.at.IsZero() && now.Sub(s.at) > idempotencyWindow {
+			ok = false
+		}
+		if !ok {
+			s = &idempotentSend{done: make(chan struct{})}
+			k.sends[key] = s
+			k.mu.Unlock()
+			return k.run(key, s, send)
+		}
+		k.mu.Unlock()
+
+		select {
+		case <-s.done:
+			if s.err == nil || errors.Is(s.err, ErrPartialSend) || errors.Is(s.err, ErrOutcomeUnknown) {
+				return s.res, s.err
+			}
+			// The send failed and was forgotten; try again.
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// run performs the send s for key, remembering it if it went out. A send
+// that panics is forgotten like a failed one, so waiters try again.
+func (k *idempotencyKeys) run(key string, s *idempotentSend, send func() (*SendResult, error)) (*SendResult, error) {
+	s.err = errors.New("email: send panicked")
+	defer func() {
+		k.mu.Lock()
+		if s.err == nil || errors.Is(s.err, ErrPartialSend) || errors.Is(s.err, ErrOutcomeUnknown) {
+			s.at = time.Now()
+		} else {
+			delete(k.sends, key)
+		}
+		k.mu.Unlock()
+		close(s.done)
+	}()
+	s.res, s.err = send()
+	return s.res, s.err
+}
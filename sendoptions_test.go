@@ -0,0 +1,126 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSendOptions(t *testing.T) {
+	def, esp := &mockProvider{}, &mockProvider{}
+	budget, err := newSendBudget(&SendBudget{PerHour: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{provider: def, name: "gmail", budget: budget,
+		routes: []providerRoute{{name: "marketing", provider: esp}}}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+
+	if err := c.Send(msg, WithDryRun()); err != nil || len(def.calls) != 0 {
+		t.Fatalf("dry run = %v, %d calls", err, len(def.calls))
+	}
+	if err := c.Send(&Message{From: "a@example.com"}, WithDryRun()); err == nil {
+		t.Error("dry run of an invalid message succeeded")
+	}
+
+	// The dry run took nothing from the budget.
+	if err := c.Send(msg, WithProvider("marketing"), WithPriority(PriorityHigh)); err != nil {
+		t.Fatal(err)
+	}
+	if len(esp.calls) != 1 || esp.calls[0].Priority != PriorityHigh || msg.Priority != "" {
+		t.Errorf("provider/priority override: %d calls, %+v", len(esp.calls), esp.calls)
+	}
+	if err := c.Send(msg, WithProvider("nope")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown provider: %v, want ErrNotFound", err)
+	}
+
+	c = &Client{provider: &mockProvider{sendFunc: func(ctx context.Context, _ *Message) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}}
+	start := time.Now()
+	if err := c.Send(msg, WithTimeout(20*time.Millisecond)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Send() with timeout = %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("WithTimeout did not shorten the send")
+	}
+}
+
+func TestSendIdempotencyKey(t *testing.T) {
+	var mu sync.Mutex
+	fail := true
+	mock := &mockProvider{}
+	mock.sendFunc = func(context.Context, *Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			fail = false
+			return errors.New("transient")
+		}
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+	c := &Client{provider: mock}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+
+	if err := c.Send(msg, WithIdempotencyKey("k")); err == nil {
+		t.Fatal("first send did not fail")
+	}
+	// A failed send may be retried; concurrent retries send once.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Send(msg, WithIdempotencyKey("k")); err != nil {
+				t.Errorf("retry: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := c.Send(msg, WithIdempotencyKey("other")); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(mock.calls) != 3 {
+		t.Errorf("provider called %d times, want 3", len(mock.calls))
+	}
+}
+
+func TestSendIdempotencyKeyOutcomeUnknown(t *testing.T) {
+	mock := &mockProvider{sendFunc: func(context.Context, *Message) error {
+		return fmt.Errorf("%w: poll timed out", ErrOutcomeUnknown)
+	}}
+	c := &Client{provider: mock}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+
+	// A send that may have gone out is not retried under its key.
+	for i := 0; i < 2; i++ {
+		if err := c.Send(msg, WithIdempotencyKey("k")); !errors.Is(err, ErrOutcomeUnknown) {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+	if len(mock.calls) != 1 {
+		t.Errorf("provider called %d times, want 1", len(mock.calls))
+	}
+}
+
+func TestIdempotencyKeysPanic(t *testing.T) {
+	var keys idempotencyKeys
+	func() {
+		defer func() { recover() }()
+		keys.do(context.Background(), "k", func() (*SendResult, error) { panic("provider bug") })
+	}()
+	// The key is forgotten, so the next send with it goes out.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	res, err := keys.do(ctx, "k", func() (*SendResult, error) { return &SendResult{MessageID: "m"}, nil })
+	if err != nil || res.MessageID != "m" {
+		t.Errorf("do() after a panicking send = %+v, %v; want the new send's result", res, err)
+	}
+}
@@ -0,0 +1,89 @@
+// sendresult.go - Identifiers of a sent message. Send reports only success;
+// SendWithResult also returns the message's RFC 5322 Message-ID and the
+// provider's own ids, so callers can correlate a send with later bounces,
+// complaints, replies or Gmail/Graph lookups.
+package email
+
+import (
+	"context"
+	"strings"
+)
+
+// SendResult identifies a sent message.
+type SendResult struct {
+	// MessageID is the Message-ID header, without angle brackets. Bounces,
+	// complaints and replies refer to the message by it.
+	MessageID string
+
+	// ProviderID is the provider's id for the sent message: the Gmail API
+	// message id or the Graph (immutable) message id. Empty for SMTP
+	// submission and direct delivery.
+	ProviderID string
+
+	// ThreadID is the provider's conversation id: the Gmail thread id or the
+	// Graph conversationId. Empty where ProviderID is.
+	ThreadID string
+
+	// Status is the final status of a send the provider completed
+	// asynchronously: "succeeded" when Graph answered with a long-running
+	// operation to poll rather than accepting the message outright. Empty
+	// for sends accepted at once, the usual case.
+	Status string
+
+	// ScheduleID is the Scheduler id of a message held for sending at its
+	// SendAt (see Scheduler.Cancel); the other fields are empty then.
+	ScheduleID string
+}
+
+// ResultSender is implemented by providers that can report the identifiers
+// of a sent message. All built-in providers implement it.
+type ResultSender interface {
+	// SendWithResult sends msg like Send and returns its identifiers. The
+	// result may be non-nil with an ErrPartialSend error.
+	SendWithResult(ctx context.Context, msg *Message) (*SendResult, error)
+}
+
+// Compile-time guarantee that direct delivery reports results; Outlook 365
+// and Gmail list theirs in outlook.go and gmail.go.
+var _ ResultSender = (*directProvider)(nil)
+
+// SendWithResult is Send, returning the sent message's identifiers.
+// Providers that do not implement ResultSender return an empty SendResult.
+// A send that went out but failed afterwards (ErrPartialSend) still returns
+// its result alongside the error.
+//
+// Example:
+//
+//	res, err := client.SendWithResult(msg)
+//	if err != nil {
+//	    return err
+//	}
+//	db.RecordSend(orderID, res.MessageID, res.ProviderID)
+func (c *Client) SendWithResult(msg *Message, opts ...SendOption) (*SendResult, error) {
+	o := newSendOptions(opts)
+	if o.timeout <= 0 {
+		o.timeout = defaultTimeout
+	}
+	return c.sendWithOptions(context.Background(), msg, true, o)
+}
+
+// SendWithResultContext is SendWithResult with a caller-supplied context.
+func (c *Client) SendWithResultContext(ctx context.Context, msg *Message, opts ...SendOption) (*SendResult, error) {
+	return c.sendWithOptions(ctx, msg, true, newSendOptions(opts))
+}
+
+// withMessageID returns msg with a Message-ID header, adding a new one to a
+// copy if it has none, and the id without angle brackets.
+func withMessageID(msg *Message) (*Message, string) {
+	if id := headerValue(msg.Headers, "Message-Id"); id != "" {
+		return msg, strings.Trim(id, "<>")
+	}
+	id := newMessageID(parseAddr(msg.From))
+	out := *msg
+	out.Headers = make(map[string]string, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		out.Headers[k] = v
+	}
+	out.Headers["Message-ID"] = "<" + id + ">"
+	return &out, id
+}
@@ -0,0 +1,64 @@
+//go:build !email_no_gmail
+
+package email
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGmailSendWithResult(t *testing.T) {
+	tests := []struct {
+		name      string
+		canRead   bool
+		wantMsgID string // "" means the generated id
+	}{
+		{"read back", true, "CAF123@mail.gmail.com"},
+		{"send scope only", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sentRaw string
+			provider := newTestGmail(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.Method == http.MethodPost && r.URL.Path == "/gmail/v1/users/me/messages/send":
+					var m struct{ Raw string }
+					json.NewDecoder(r.Body).Decode(&m)
+					raw, _ := base64.URLEncoding.DecodeString(m.Raw)
+					sentRaw = string(raw)
+					io.WriteString(w, `{"id":"m1","threadId":"t1"}`)
+				case r.Method == http.MethodGet && r.URL.Path == "/gmail/v1/users/me/messages/m1" && tt.canRead:
+					io.WriteString(w, `{"id":"m1","payload":{"headers":[{"name":"Message-Id","value":"<CAF123@mail.gmail.com>"}]}}`)
+				default:
+					w.WriteHeader(http.StatusForbidden)
+					io.WriteString(w, `{"error":{"code":403,"message":"Insufficient Permission"}}`)
+				}
+			})
+			msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+			res, err := (&Client{provider: provider}).SendWithResult(msg)
+			if err != nil {
+				t.Fatalf("SendWithResult() error = %v", err)
+			}
+			if res.ProviderID != "m1" || res.ThreadID != "t1" {
+				t.Errorf("SendWithResult() = %+v, want ProviderID m1, ThreadID t1", res)
+			}
+			if res.MessageID == "" || !strings.Contains(sentRaw, "Message-ID: <") {
+				t.Fatalf("MessageID = %q, sent message lacks a Message-ID:\n%s", res.MessageID, sentRaw)
+			}
+			if tt.wantMsgID != "" && res.MessageID != tt.wantMsgID {
+				t.Errorf("MessageID = %q, want %q", res.MessageID, tt.wantMsgID)
+			}
+			if tt.wantMsgID == "" && !strings.Contains(sentRaw, "<"+res.MessageID+">") {
+				t.Errorf("MessageID %q is not the one sent:\n%s", res.MessageID, sentRaw)
+			}
+			if msg.Headers != nil {
+				t.Errorf("caller's message was modified: %v", msg.Headers)
+			}
+		})
+	}
+}
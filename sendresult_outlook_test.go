@@ -0,0 +1,44 @@
+//go:build !email_no_outlook
+
+package email
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestOutlookSendWithResult(t *testing.T) {
+	var prefer string
+	var sent bool
+	provider := newTestOutlook(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1.0/users/a@example.com/messages":
+			prefer = r.Header.Get("Prefer")
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id":"draft-1","internetMessageId":"<abc@example.com>","conversationId":"conv-1"}`)
+		case "/v1.0/users/a@example.com/messages/draft-1/send":
+			sent = true
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+	res, err := provider.SendWithResult(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+	want := SendResult{MessageID: "abc@example.com", ProviderID: "draft-1", ThreadID: "conv-1"}
+	if *res != want {
+		t.Errorf("SendWithResult() = %+v, want %+v", *res, want)
+	}
+	if !sent {
+		t.Error("draft was not sent")
+	}
+	if prefer != `IdType="ImmutableId"` {
+		t.Errorf("Prefer = %q, want immutable ids", prefer)
+	}
+}
@@ -0,0 +1,34 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClientSendWithResultFallback(t *testing.T) {
+	mp := &mockProvider{}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+	res, err := (&Client{provider: mp}).SendWithResult(msg)
+	if err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+	if *res != (SendResult{}) || len(mp.calls) != 1 {
+		t.Errorf("SendWithResult() = %+v after %d sends, want an empty result after one", res, len(mp.calls))
+	}
+}
+
+func TestWithMessageID(t *testing.T) {
+	msg := &Message{From: "Alice <a@example.com>", Headers: map[string]string{"message-id": " <given@example.com> "}}
+	if got, id := withMessageID(msg); got != msg || id != "given@example.com" {
+		t.Errorf("withMessageID(existing) = %p, %q; want the message unchanged and given@example.com", got, id)
+	}
+
+	msg = &Message{From: "Alice <a@example.com>", Headers: map[string]string{"X-Tag": "1"}}
+	got, id := withMessageID(msg)
+	if !strings.HasSuffix(id, "@example.com") || got.Headers["Message-ID"] != "<"+id+">" || got.Headers["X-Tag"] != "1" {
+		t.Errorf("withMessageID() = %v, %q", got.Headers, id)
+	}
+	if len(msg.Headers) != 1 {
+		t.Errorf("original headers modified: %v", msg.Headers)
+	}
+}
@@ -0,0 +1,236 @@
+// sendwindow.go - Provider blackout periods. While a provider is under
+// maintenance (a tenant migration, a relay upgrade) messages through it
+// should wait rather than fail or go out half-configured. A Config's
+// SendWindows pauses sending through its provider (and a Route's through
+// the route's): SendBatch holds its remaining messages until the blackout
+// ends, Send waits if the blackout ends within its context and otherwise
+// fails with a *SendWindowClosedError saying when to try again. Critical
+// messages can be let through regardless.
+package email
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SendWindows configures when a provider must not be sent through.
+//
+// Example:
+//
+//	config.SendWindows = &email.SendWindows{
+//	    Blackouts: []email.SendWindow{
+//	        email.Blackout{Start: migrationStart, End: migrationEnd},
+//	        email.DailyBlackout{Start: 2 * time.Hour, End: 3 * time.Hour, Location: berlin},
+//	    },
+//	    Critical: func(m *email.Message) bool { return m.Priority == email.PriorityHigh },
+//	}
+type SendWindows struct {
+	// Blackouts are the periods during which sending is paused.
+	Blackouts []SendWindow
+
+	// Critical, if set, selects messages sent even during a blackout, such
+	// as password resets or outage notices.
+	Critical func(*Message) bool
+
+	// Now returns the current time. Defaults to time.Now; set it to test
+	// or simulate a schedule.
+	Now func() time.Time
+}
+
+// SendWindow is a blackout schedule. Blackout and DailyBlackout cover
+// one-off and recurring maintenance; implement it for other calendars.
+type SendWindow interface {
+	// Closed reports whether sending is paused at t and, if so, until when.
+	Closed(t time.Time) (closed bool, until time.Time)
+}
+
+// Blackout is a one-off blackout from Start until End.
+type Blackout struct {
+	Start, End time.Time
+}
+
+// Closed implements SendWindow.
+func (b Blackout) Closed(t time.Time) (bool, time.Time) {
+	if !t.Before(b.Start) && t.Before(b.End) {
+		return true, b.End
+	}
+	return false, time.Time{}
+}
+
+// DailyBlackout is a blackout recurring every day, or on the listed
+// Weekdays, between the times of day Start and End (offsets from midnight).
+// An End before Start wraps past midnight: {Start: 23h, End: 1h} pauses
+// from 23:00 until 01:00 the next day, with Weekdays naming the day it
+// starts on.
+type DailyBlackout struct {
+	Start, End time.Duration
+
+	// Weekdays limits the blackout to these days; empty means every day.
+	Weekdays []time.Weekday
+
+	// Location is the time zone of Start and End. Defaults to UTC.
+	Location *time.Location
+}
+
+// Closed implements SendWindow.
+func (d DailyBlackout) Closed(t time.Time) (bool, time.Time) {
+	loc := d.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	lt := t.In(loc)
+	y, m, day := lt.Date()
+	// A window that wraps past midnight may have started yesterday.
+	for _, offset := range []int{-1, 0} {
+		midnight := time.Date(y, m, day+offset, 0, 0, 0, 0, loc)
+		if !d.on(midnight.Weekday()) {
+			continue
+		}
+		start, end := midnight.Add(d.Start), midnight.Add(d.End)
+		if d.End <= d.Start {
+			end = end.Add(24 * time.Hour)
+		}
+		if !lt.Before(start) && lt.Before(end) {
+			return true, end
+		}
+	}
+	return false, time.Time{}
+}
+
+// on reports whether the blackout applies to windows starting on day.
+func (d DailyBlackout) on(day time.Weekday) bool {
+	if len(d.Weekdays) == 0 {
+		return true
+	}
+	for _, w := range d.Weekdays {
+		if w == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (d DailyBlackout) validate() error {
+	if d.Start < 0 || d.Start >= 24*time.Hour || d.End < 0 || d.End >= 24*time.Hour {
+		return fmt.Errorf("daily blackout %s-%s: times must be within a day", d.Start, d.End)
+	}
+	return nil
+}
+
+func (b Blackout) validate() error {
+	if !b.End.After(b.Start) {
+		return fmt.Errorf("blackout %s-%s: end must be after start", b.Start.Format(time.RFC3339), b.End.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// SendWindowClosedError is returned by Send when the provider is in a
+// blackout that does not end within the send's context. Nothing is sent.
+// It matches ErrSendWindowClosed with errors.Is.
+type SendWindowClosedError struct {
+	// Provider is the name of the paused provider.
+	Provider string
+
+	// Until is when the blackout ends.
+	Until time.Time
+}
+
+func (e *SendWindowClosedError) Error() string {
+	return fmt.Sprintf("%s: provider %q paused until %s", ErrSendWindowClosed, e.Provider, e.Until.Format(time.RFC3339))
+}
+
+// Is reports whether target is ErrSendWindowClosed.
+func (e *SendWindowClosedError) Is(target error) bool {
+	return target == ErrSendWindowClosed
+}
+
+// Hint suggests deferring the send to the end of the blackout.
+func (e *SendWindowClosedError) Hint() string {
+	return fmt.Sprintf("schedule the message for after %s (Message.SendAt), or send it through another provider", e.Until.Format(time.RFC3339))
+}
+
+// maxChainedBlackouts bounds the back-to-back blackouts followed to find
+// when sending resumes.
+const maxChainedBlackouts = 64
+
+// newSendWindows checks a SendWindows configuration.
+func newSendWindows(config *SendWindows) (*SendWindows, error) {
+	if config == nil {
+		return nil, nil
+	}
+	for i, w := range config.Blackouts {
+		if w == nil {
+			return nil, fmt.Errorf("invalid send windows: blackout %d is nil", i)
+		}
+		if v, ok := w.(interface{ validate() error }); ok {
+			if err := v.validate(); err != nil {
+				return nil, fmt.Errorf("invalid send windows: %w", err)
+			}
+		}
+	}
+	w := *config
+	if w.Now == nil {
+		w.Now = time.Now
+	}
+	return &w, nil
+}
+
+// closedUntil returns when the blackout in effect at t ends, following
+// back-to-back blackouts, or the zero time if sending is allowed at t.
+func (w *SendWindows) closedUntil(t time.Time) time.Time {
+	var until time.Time
+	for i := 0; i < maxChainedBlackouts; i++ {
+		extended := false
+		for _, b := range w.Blackouts {
+			if closed, end := b.Closed(t); closed && end.After(t) {
+				t, until, extended = end, end, true
+			}
+		}
+		if !extended {
+			break
+		}
+	}
+	return until
+}
+
+// routeOf returns the name and send windows of provider p.
+func (c *Client) routeOf(p Provider) (string, *SendWindows) {
+	if p == c.provider {
+		return c.name, c.windows
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, r := range c.routes {
+		if r.provider == p {
+			return r.name, r.windows
+		}
+	}
+	return "", nil
+}
+
+// awaitWindow returns once provider may send msg: at once outside a
+// blackout or for a critical message, after waiting when the blackout ends
+// before ctx does, and with a *SendWindowClosedError otherwise.
+func (c *Client) awaitWindow(ctx context.Context, provider Provider, msg *Message) error {
+	name, w := c.routeOf(provider)
+	if w == nil || (w.Critical != nil && w.Critical(msg)) {
+		return nil
+	}
+	now := w.Now()
+	until := w.closedUntil(now)
+	if until.IsZero() {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(until) {
+		return &SendWindowClosedError{Provider: name, Until: until}
+	}
+	timer := time.NewTimer(until.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
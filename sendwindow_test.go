@@ -0,0 +1,103 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDailyBlackout(t *testing.T) {
+	berlin := time.FixedZone("CET", 60*60)
+	at := func(day, hour, min int) time.Time { return time.Date(2026, 3, day, hour, min, 0, 0, berlin) } // 2 March is a Monday
+	tests := []struct {
+		name   string
+		window DailyBlackout
+		t      time.Time
+		until  time.Time // zero when open
+	}{
+		{"inside", DailyBlackout{Start: 2 * time.Hour, End: 3 * time.Hour, Location: berlin}, at(2, 2, 30), at(2, 3, 0)},
+		{"at end", DailyBlackout{Start: 2 * time.Hour, End: 3 * time.Hour, Location: berlin}, at(2, 3, 0), time.Time{}},
+		{"other zone", DailyBlackout{Start: 2 * time.Hour, End: 3 * time.Hour}, at(2, 2, 30), time.Time{}},
+		{"wraps, evening", DailyBlackout{Start: 23 * time.Hour, End: time.Hour, Location: berlin}, at(2, 23, 30), at(3, 1, 0)},
+		{"wraps, morning", DailyBlackout{Start: 23 * time.Hour, End: time.Hour, Location: berlin}, at(3, 0, 30), at(3, 1, 0)},
+		{"weekday", DailyBlackout{Start: 0, End: 6 * time.Hour, Weekdays: []time.Weekday{time.Sunday}, Location: berlin}, at(1, 5, 0), at(1, 6, 0)},
+		{"not weekday", DailyBlackout{Start: 0, End: 6 * time.Hour, Weekdays: []time.Weekday{time.Sunday}, Location: berlin}, at(2, 5, 0), time.Time{}},
+		{"wrap from weekday", DailyBlackout{Start: 22 * time.Hour, End: 2 * time.Hour, Weekdays: []time.Weekday{time.Sunday}, Location: berlin}, at(2, 1, 0), at(2, 2, 0)},
+	}
+	for _, tt := range tests {
+		closed, until := tt.window.Closed(tt.t)
+		if closed != !tt.until.IsZero() || !until.Equal(tt.until) {
+			t.Errorf("%s: Closed() = %v, %v; want until %v", tt.name, closed, until, tt.until)
+		}
+	}
+}
+
+func TestSendWindowsClosedUntil(t *testing.T) {
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	w, err := newSendWindows(&SendWindows{Blackouts: []SendWindow{
+		Blackout{Start: start, End: start.Add(time.Hour)},
+		Blackout{Start: start.Add(time.Hour), End: start.Add(2 * time.Hour)}, // back to back
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := w.closedUntil(start.Add(30 * time.Minute)); !got.Equal(start.Add(2 * time.Hour)) {
+		t.Errorf("closedUntil() = %v, want end of the second blackout", got)
+	}
+	if got := w.closedUntil(start.Add(3 * time.Hour)); !got.IsZero() {
+		t.Errorf("closedUntil() after the blackouts = %v", got)
+	}
+
+	for name, config := range map[string]*SendWindows{
+		"reversed": {Blackouts: []SendWindow{Blackout{Start: start, End: start}}},
+		"daily":    {Blackouts: []SendWindow{DailyBlackout{Start: 25 * time.Hour}}},
+		"nil":      {Blackouts: []SendWindow{nil}},
+	} {
+		if _, err := newSendWindows(config); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestClientSendWindow(t *testing.T) {
+	now := time.Now()
+	windows, err := newSendWindows(&SendWindows{
+		Blackouts: []SendWindow{Blackout{Start: now.Add(-time.Hour), End: now.Add(time.Hour)}},
+		Critical:  func(m *Message) bool { return m.Priority == PriorityHigh },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := &mockProvider{}
+	c := &Client{provider: mock, name: "outlook365", windows: windows}
+	msg := &Message{From: "ops@example.com", To: []string{"a@example.com"}, Subject: "s", Body: "b"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = c.SendWithContext(ctx, msg)
+	var closed *SendWindowClosedError
+	if !errors.As(err, &closed) || !errors.Is(err, ErrSendWindowClosed) || closed.Provider != "outlook365" || !closed.Until.Equal(now.Add(time.Hour)) {
+		t.Fatalf("Send() error = %v, want *SendWindowClosedError", err)
+	}
+	if len(mock.calls) != 0 {
+		t.Fatal("message sent during the blackout")
+	}
+
+	critical := *msg
+	critical.Priority = PriorityHigh
+	if err := c.SendWithContext(ctx, &critical); err != nil || len(mock.calls) != 1 {
+		t.Errorf("critical Send() = %v, %d calls", err, len(mock.calls))
+	}
+
+	// A batch waits for the blackout to end.
+	windows.Blackouts = []SendWindow{Blackout{Start: now.Add(-time.Hour), End: time.Now().Add(50 * time.Millisecond)}}
+	start := time.Now()
+	report, err := c.SendBatch(testBatch("b", 2))
+	if err != nil || report.Sent != 2 {
+		t.Fatalf("SendBatch() = %+v, %v", report, err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("batch sent after %v, during the blackout", elapsed)
+	}
+}
@@ -0,0 +1,118 @@
+// size.go - Pre-send size checks. Each API provider caps the size of a
+// message it takes, and an oversized message otherwise fails only after it
+// has been rendered and uploaded, with a 413 or an opaque API error. Client
+// estimates the encoded size of every message before it is handed to the
+// provider and rejects one over the provider's limit with a
+// *MessageTooLargeError. SMTP servers advertise their own limit (SIZE),
+// which the SMTP paths check against the exact size.
+package email
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// MessageTooLargeError is returned when a message exceeds the size its
+// provider or server accepts. Nothing is sent. It matches
+// ErrMessageTooLarge with errors.Is.
+type MessageTooLargeError struct {
+	// Provider names the provider whose limit was exceeded; it is empty
+	// for an SMTP server's advertised limit.
+	Provider string
+
+	// Size is the message's encoded size in bytes, estimated when checked
+	// before sending.
+	Size int64
+
+	// Limit is the largest size accepted, in bytes.
+	Limit int64
+}
+
+func (e *MessageTooLargeError) Error() string {
+	if e.Provider == "" {
+		return fmt.Sprintf("%s: message is %d bytes, server limit is %d", ErrMessageTooLarge, e.Size, e.Limit)
+	}
+	return fmt.Sprintf("%s: message is %d bytes, %s accepts at most %d", ErrMessageTooLarge, e.Size, e.Provider, e.Limit)
+}
+
+// Is reports whether target is ErrMessageTooLarge.
+func (e *MessageTooLargeError) Is(target error) bool {
+	return target == ErrMessageTooLarge
+}
+
+// Hint suggests shrinking the message.
+func (e *MessageTooLargeError) Hint() string {
+	return fmt.Sprintf("shrink the message below %d bytes: compress the attachments (Config.ZipAttachments) or send links to them", e.Limit)
+}
+
+// sizeLimiter is implemented by providers with a fixed message size limit.
+type sizeLimiter interface {
+	// maxMessageSize returns the largest encoded message accepted, in bytes.
+	maxMessageSize() int64
+}
+
+// Provider size limits.
+const (
+	// outlookMaxMessageSize is Graph's limit for a sendMail request.
+	// Messages up to 150 MB need attachment upload sessions, which the
+	// send path does not use.
+	outlookMaxMessageSize = 4 << 20
+
+	// headerOverhead approximates the header fields and MIME part headers
+	// of a message, per message and per part.
+	headerOverhead = 1 << 10
+)
+
+// checkSize rejects msg if its estimated size exceeds the limit of
+// provider.
+func (c *Client) checkSize(provider Provider, msg *Message) error {
+	sl, ok := provider.(sizeLimiter)
+	if !ok {
+		return nil
+	}
+	if size, limit := estimateSize(msg), sl.maxMessageSize(); size > limit {
+		name, _ := c.routeOf(provider)
+		return &MessageTooLargeError{Provider: name, Size: size, Limit: limit}
+	}
+	return nil
+}
+
+// estimateSize estimates the encoded size of msg in bytes: its bodies and
+// attachments in their transfer encodings plus headerOverhead for the
+// header and each part. Streamed attachments (Attachment.Open) are not
+// opened and count as their part header only.
+func estimateSize(msg *Message) int64 {
+	size := int64(headerOverhead) + textSize(msg.Body)
+	if msg.HTML && msg.TextBody != "" {
+		size += headerOverhead + textSize(msg.TextBody)
+	}
+	for _, a := range msg.Attachments {
+		size += headerOverhead
+		switch a.Encoding {
+		case EncodingQuotedPrintable, Encoding7Bit:
+			size += textSize(string(a.Content))
+		default:
+			size += base64Size(int64(len(a.Content)))
+		}
+	}
+	return size
+}
+
+// base64Size is the size of n bytes base64-encoded in lines of 76
+// characters ending in CRLF.
+func base64Size(n int64) int64 {
+	encoded := (n + 2) / 3 * 4
+	return encoded + (encoded+75)/76*2
+}
+
+// textSize bounds the size of s quoted-printable encoded: each byte of a
+// non-ASCII character takes three ("=C3=A9").
+func textSize(s string) int64 {
+	n := int64(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			n += 2
+		}
+	}
+	return n
+}
@@ -0,0 +1,36 @@
+//go:build !email_no_outlook
+
+package email
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestClientSendTooLarge(t *testing.T) {
+	o := &outlookProvider{}
+	c := &Client{provider: o, name: "outlook365"}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+		Attachments: []Attachment{{Filename: "big.bin", Content: make([]byte, outlookMaxMessageSize)}}}
+
+	err := c.SendWithContext(context.Background(), msg)
+	var tooLarge *MessageTooLargeError
+	if !errors.As(err, &tooLarge) || !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("Send() error = %v, want *MessageTooLargeError", err)
+	}
+	if tooLarge.Provider != "outlook365" || tooLarge.Limit != outlookMaxMessageSize || tooLarge.Size <= tooLarge.Limit {
+		t.Errorf("error = %+v", tooLarge)
+	}
+	if !strings.Contains(err.Error(), "outlook365 accepts at most") {
+		t.Errorf("Error() = %q", err)
+	}
+
+	// Providers without a fixed limit are not checked.
+	mock := &mockProvider{}
+	c = &Client{provider: mock}
+	if err := c.SendWithContext(context.Background(), msg); err != nil || len(mock.calls) != 1 {
+		t.Errorf("Send() through mock = %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package email
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEstimateSize(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 3<<20)
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "héllo",
+		Attachments: []Attachment{{Filename: "big.bin", Content: content}}}
+	raw, err := buildRawMessage(msg, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	est := estimateSize(msg)
+	if est < int64(len(raw)) || est > int64(len(raw))+4*headerOverhead {
+		t.Errorf("estimateSize() = %d, rendered %d bytes", est, len(raw))
+	}
+
+	if got := textSize("é"); got != 6 {
+		t.Errorf("textSize(é) = %d, want 6", got)
+	}
+	if got := base64Size(57); got != 78 {
+		t.Errorf("base64Size(57) = %d, want one 76-character line and CRLF", got)
+	}
+}
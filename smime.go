@@ -0,0 +1,288 @@
+// smime.go - S/MIME signing (RFC 8551). A signed message is a
+// multipart/signed of the message content and a detached PKCS#7 SignedData
+// signature over it, carrying the signer's certificate chain so recipients
+// can verify it without a directory lookup. Signing happens where the
+// message is rendered, so it applies to every raw submission path: the Gmail
+// API and SMTP relay, Outlook's MIME submission and direct delivery, where
+// the DKIM signature is added on top.
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SMIMEConfig holds the certificate and key messages are signed with.
+type SMIMEConfig struct {
+	// CertificatePEM is the signing certificate, optionally followed by
+	// the intermediate certificates of its chain, which are included in
+	// every signature.
+	CertificatePEM []byte
+
+	// PrivateKeyPEM is the certificate's private key: RSA (PKCS#1 or
+	// PKCS#8) or ECDSA (SEC 1 or PKCS#8).
+	PrivateKeyPEM []byte
+}
+
+// Object identifiers of PKCS#7 SignedData (RFC 5652).
+var (
+	oidData            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// smimeSigner signs rendered messages.
+type smimeSigner struct {
+	cert   *x509.Certificate
+	chain  [][]byte // DER certificates, signer first
+	key    crypto.Signer
+	sigAlg pkix.AlgorithmIdentifier
+}
+
+// newSMIMESigner parses and checks config's certificate and key.
+func newSMIMESigner(config *SMIMEConfig) (*smimeSigner, error) {
+	s := &smimeSigner{}
+	for rest := config.CertificatePEM; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return nil, fmt.Errorf("smime: invalid certificate: %w", err)
+		}
+		s.chain = append(s.chain, block.Bytes)
+	}
+	if len(s.chain) == 0 {
+		return nil, fmt.Errorf("smime: no PEM certificate found")
+	}
+	s.cert, _ = x509.ParseCertificate(s.chain[0])
+
+	block, _ := pem.Decode(config.PrivateKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("smime: no PEM private key found")
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("smime: invalid private key: %w", err)
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if !k.PublicKey.Equal(s.cert.PublicKey) {
+			return nil, fmt.Errorf("smime: private key does not match the certificate")
+		}
+		s.key = k
+		s.sigAlg = pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+	case *ecdsa.PrivateKey:
+		if !k.PublicKey.Equal(s.cert.PublicKey) {
+			return nil, fmt.Errorf("smime: private key does not match the certificate")
+		}
+		s.key = k
+		s.sigAlg = pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+	default:
+		return nil, fmt.Errorf("smime: unsupported key type %T", key)
+	}
+	return s, nil
+}
+
+// check returns an error if the certificate names email addresses and the
+// sender is not one of them: clients flag such signatures as invalid.
+func (s *smimeSigner) check(msg *Message) error {
+	if len(s.cert.EmailAddresses) == 0 {
+		return nil
+	}
+	addr := parseAddr(msg.From)
+	for _, a := range s.cert.EmailAddresses {
+		if strings.EqualFold(a, addr) {
+			return nil
+		}
+	}
+	return fmt.Errorf("smime: certificate is not valid for sender %s", addr)
+}
+
+// write renders msg per opts and writes it to w as a multipart/signed
+// message.
+func (s *smimeSigner) write(w io.Writer, msg *Message, opts rawOptions) error {
+	outer, signed, boundary, err := contentEntity(msg, opts)
+	if err != nil {
+		return err
+	}
+	sig, err := s.sign(signed, time.Now())
+	if err != nil {
+		return err
+	}
+
+	boundary += "-signed"
+	out := bufio.NewWriter(w)
+	out.WriteString(outer)
+	out.WriteString(`Content-Type: multipart/signed; protocol="application/pkcs7-signature"; micalg=sha-256; boundary=` + boundary + "\r\n\r\n")
+	out.WriteString("--" + boundary + "\r\n")
+	out.Write(signed)
+	out.WriteString("\r\n--" + boundary + "\r\n")
+	out.WriteString("Content-Type: application/pkcs7-signature; name=smime.p7s\r\n")
+	out.WriteString("Content-Transfer-Encoding: base64\r\n")
+	out.WriteString("Content-Disposition: attachment; filename=smime.p7s\r\n\r\n")
+	lines := &lineWrapper{w: out, width: 76}
+	enc := base64.NewEncoder(base64.StdEncoding, lines)
+	if _, err := enc.Write(sig); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	if lines.col > 0 {
+		out.WriteString("\r\n")
+	}
+	out.WriteString("--" + boundary + "--\r\n")
+	return out.Flush()
+}
+
+// PKCS#7 structures, as far as signing needs them.
+type (
+	pkcs7ContentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"optional"` // [0] EXPLICIT, built by hand
+	}
+
+	pkcs7SignedData struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      pkcs7ContentInfo
+		Certificates     asn1.RawValue
+		SignerInfos      asn1.RawValue
+	}
+
+	pkcs7SignerInfo struct {
+		Version                   int
+		IssuerAndSerialNumber     pkcs7IssuerAndSerial
+		DigestAlgorithm           pkix.AlgorithmIdentifier
+		AuthenticatedAttributes   asn1.RawValue
+		DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+		EncryptedDigest           []byte
+	}
+
+	pkcs7IssuerAndSerial struct {
+		Issuer       asn1.RawValue
+		SerialNumber *big.Int
+	}
+
+	pkcs7Attribute struct {
+		Type   asn1.ObjectIdentifier
+		Values asn1.RawValue
+	}
+)
+
+// derSet returns the DER SET of the already encoded elements, sorted as
+// DER requires. With tag, it is an implicitly tagged [tag] instead.
+func derSet(elems [][]byte, tag int) asn1.RawValue {
+	sort.Slice(elems, func(i, j int) bool { return bytes.Compare(elems[i], elems[j]) < 0 })
+	v := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(elems, nil)}
+	if tag >= 0 {
+		v.Class, v.Tag = asn1.ClassContextSpecific, tag
+	}
+	return v
+}
+
+// sign returns the DER PKCS#7 detached SignedData of content, with
+// content type, signing time and message digest as signed attributes.
+func (s *smimeSigner) sign(content []byte, now time.Time) ([]byte, error) {
+	digest := sha256.Sum256(content)
+	var attrs [][]byte
+	for _, a := range []struct {
+		oid   asn1.ObjectIdentifier
+		value any
+	}{
+		{oidContentType, oidData},
+		{oidSigningTime, now.UTC()},
+		{oidMessageDigest, digest[:]},
+	} {
+		v, err := asn1.Marshal(a.value)
+		if err != nil {
+			return nil, err
+		}
+		attr, err := asn1.Marshal(pkcs7Attribute{Type: a.oid, Values: derSet([][]byte{v}, -1)})
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+
+	// The signature covers the attributes encoded as a SET, not with the
+	// [0] tag they are transmitted with (RFC 5652, section 5.4).
+	signedAttrs, err := asn1.Marshal(derSet(attrs, -1))
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(signedAttrs)
+	signature, err := s.key.Sign(rand.Reader, h[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("smime: signing: %w", err)
+	}
+
+	sha256Alg := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	signerInfo, err := asn1.Marshal(pkcs7SignerInfo{
+		Version: 1,
+		IssuerAndSerialNumber: pkcs7IssuerAndSerial{
+			Issuer:       asn1.RawValue{FullBytes: s.cert.RawIssuer},
+			SerialNumber: s.cert.SerialNumber,
+		},
+		DigestAlgorithm:           sha256Alg,
+		AuthenticatedAttributes:   derSet(attrs, 0),
+		DigestEncryptionAlgorithm: s.sigAlg,
+		EncryptedDigest:           signature,
+	})
+	if err != nil {
+		return nil, err
+	}
+	digestAlg, err := asn1.Marshal(sha256Alg)
+	if err != nil {
+		return nil, err
+	}
+	certs := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: bytes.Join(s.chain, nil)}
+	signedData, err := asn1.Marshal(pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: derSet([][]byte{digestAlg}, -1),
+		ContentInfo:      pkcs7ContentInfo{ContentType: oidData},
+		Certificates:     certs,
+		SignerInfos:      derSet([][]byte{signerInfo}, -1),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pkcs7ContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+}
@@ -0,0 +1,25 @@
+//go:build !email_no_outlook
+
+package email
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+)
+
+func TestOutlookSMIMEUsesMIMESubmission(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := newSMIMESigner(testSMIMEConfig(t, key, "legal@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &Message{From: "legal@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b", seal: signer}
+	if !needsMIMESubmission(msg) {
+		t.Error("signed messages must use Outlook's MIME submission")
+	}
+}
@@ -0,0 +1,216 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSMIMEConfig returns a self-signed certificate for addr and its key.
+func testSMIMEConfig(t *testing.T, key crypto.Signer, addr string) *SMIMEConfig {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(42),
+		Subject:        pkix.Name{CommonName: addr},
+		EmailAddresses: []string{addr},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &SMIMEConfig{
+		CertificatePEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		PrivateKeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+	}
+}
+
+// verifySMIME checks the detached signature of a rendered multipart/signed
+// message and returns the signed content.
+func verifySMIME(t *testing.T, raw []byte) []byte {
+	t.Helper()
+	s := string(raw)
+	i := strings.Index(s, "boundary=")
+	if i < 0 {
+		t.Fatalf("no multipart/signed boundary in:\n%s", s)
+	}
+	boundary := s[i+len("boundary=") : i+strings.Index(s[i:], "\r\n")]
+	parts := strings.Split(s, "--"+boundary)
+	if len(parts) != 4 || !strings.HasSuffix(parts[1], "\r\n") {
+		t.Fatalf("unexpected multipart/signed structure:\n%s", s)
+	}
+	content := []byte(strings.TrimSuffix(strings.TrimPrefix(parts[1], "\r\n"), "\r\n"))
+	_, sigPart, _ := strings.Cut(parts[2], "\r\n\r\n")
+	der, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(sigPart, "\r\n", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ci pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil || !ci.ContentType.Equal(oidSignedData) {
+		t.Fatalf("content info: %v %v", ci.ContentType, err)
+	}
+	var sd pkcs7SignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(sd.Certificates.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var si pkcs7SignerInfo
+	if _, err := asn1.Unmarshal(sd.SignerInfos.Bytes, &si); err != nil {
+		t.Fatal(err)
+	}
+	if si.IssuerAndSerialNumber.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		t.Error("signer serial number does not match the certificate")
+	}
+
+	// The message digest attribute must match the content.
+	digest := sha256.Sum256(content)
+	found := false
+	for rest := si.AuthenticatedAttributes.Bytes; len(rest) > 0; {
+		var a pkcs7Attribute
+		if rest, err = asn1.Unmarshal(rest, &a); err != nil {
+			t.Fatal(err)
+		}
+		if a.Type.Equal(oidMessageDigest) {
+			var got []byte
+			asn1.Unmarshal(a.Values.Bytes, &got)
+			found = bytes.Equal(got, digest[:])
+		}
+	}
+	if !found {
+		t.Error("message digest attribute missing or wrong")
+	}
+
+	attrs := si.AuthenticatedAttributes
+	attrs.Class, attrs.Tag, attrs.FullBytes = asn1.ClassUniversal, asn1.TagSet, nil
+	signed, _ := asn1.Marshal(attrs)
+	h := sha256.Sum256(signed)
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(pub, crypto.SHA256, h[:], si.EncryptedDigest)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, h[:], si.EncryptedDigest) {
+			err = rsa.ErrVerification
+		}
+	}
+	if err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+	return content
+}
+
+func TestSMIMESign(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, key := range map[string]crypto.Signer{"rsa": rsaKey, "ecdsa": ecKey} {
+		t.Run(name, func(t *testing.T) {
+			signer, err := newSMIMESigner(testSMIMEConfig(t, key, "legal@example.com"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := &Message{
+				From: "Legal <legal@example.com>", To: []string{"client@example.com"}, Subject: "Engagement letter",
+				Body: "Dear client,\nplease find attached — signed.\n", Headers: map[string]string{"X-Matter": "1234"},
+				Attachments: []Attachment{{Filename: "letter.pdf", Content: []byte("%PDF-1.4"), MimeType: "application/pdf"}},
+				seal:        signer,
+			}
+			raw, err := buildRawMessage(msg, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header, _, _ := strings.Cut(string(raw), "\r\n\r\n")
+			if !strings.Contains(header, "multipart/signed") || !strings.Contains(header, "X-Matter: 1234") ||
+				!strings.Contains(header, "Subject: Engagement letter") {
+				t.Errorf("outer header:\n%s", header)
+			}
+			content := verifySMIME(t, raw)
+			if !strings.HasPrefix(string(content), "Content-Type: multipart/mixed") ||
+				strings.Contains(string(content), "Subject:") {
+				t.Errorf("signed content should be the MIME body entity only:\n%s", content)
+			}
+			if bytes.Contains(bytes.ReplaceAll(content, []byte("\r\n"), nil), []byte("\n")) {
+				t.Error("signed content has bare LF line endings")
+			}
+			if !isASCII(string(content)) {
+				t.Error("signed content is not 7-bit")
+			}
+		})
+	}
+}
+
+func TestClientSendSMIME(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := newSMIMESigner(testSMIMEConfig(t, key, "legal@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := &mockProvider{}
+	c := &Client{provider: mock, sealer: signer}
+	msg := &Message{From: "legal@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+	if err := c.SendWithContext(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if mock.calls[0].seal != signer || msg.seal != nil {
+		t.Error("signer should be set on the sent copy only")
+	}
+
+	other := &Message{From: "sales@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+	if err := c.SendWithContext(context.Background(), other); err == nil {
+		t.Error("expected error for a sender the certificate does not cover")
+	}
+}
+
+func TestNewSMIMESignerErrors(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	good := testSMIMEConfig(t, key, "a@example.com")
+	mismatched := testSMIMEConfig(t, otherKey, "a@example.com")
+	tests := []struct {
+		name   string
+		config *SMIMEConfig
+	}{
+		{"no certificate", &SMIMEConfig{PrivateKeyPEM: good.PrivateKeyPEM}},
+		{"no key", &SMIMEConfig{CertificatePEM: good.CertificatePEM}},
+		{"key mismatch", &SMIMEConfig{CertificatePEM: good.CertificatePEM, PrivateKeyPEM: mismatched.PrivateKeyPEM}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newSMIMESigner(tt.config); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,436 @@
+// smtp.go - Minimal SMTP submission shared by the SMTP-based send paths (the
+// Gmail XOAUTH2 relay and direct-to-MX delivery). It dials the server,
+// upgrades with STARTTLS, optionally authenticates and transmits one RFC 5322
+// message over implicit TLS, required or opportunistic STARTTLS (optionally
+// with public key pinning), adapting to the server's SIZE, 8BITMIME, SMTPUTF8
+// and DSN extensions. The message bytes come from the same MIME builder as
+// the Gmail API path; only the transport differs.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// smtpMessage is one SMTP submission.
+type smtpMessage struct {
+	from  string
+	rcpts []string
+
+	// dsn requests delivery status notifications, if the server supports DSN.
+	dsn *DSNOptions
+
+	// write streams the message; sevenBit asks for a rendering safe for
+	// servers without 8BITMIME. It is called more than once (a sizing pass,
+	// then DATA) and must produce identical output each time.
+	write func(w io.Writer, sevenBit bool) error
+}
+
+// held returns m with both renderings written out in memory, for a delivery
+// retried after the sender's Message may have changed or been reused.
+func (m smtpMessage) held() (smtpMessage, error) {
+	var raw [2]bytes.Buffer // 8-bit, 7-bit
+	for i, sevenBit := range []bool{false, true} {
+		if err := m.write(&raw[i], sevenBit); err != nil {
+			return smtpMessage{}, err
+		}
+	}
+	m.write = func(w io.Writer, sevenBit bool) error {
+		variant := raw[0].Bytes()
+		if sevenBit {
+			variant = raw[1].Bytes()
+		}
+		_, err := w.Write(variant)
+		return err
+	}
+	return m, nil
+}
+
+// SMTPSecurity selects how an SMTP connection is protected.
+type SMTPSecurity string
+
+// SMTP security modes.
+const (
+	// SMTPSecurityAuto picks the mode from the port: 465 implicit TLS, 25
+	// opportunistic, anything else (587) required STARTTLS.
+	SMTPSecurityAuto SMTPSecurity = ""
+
+	// SMTPSecurityTLS uses implicit TLS from the first byte (SMTPS, port 465).
+	SMTPSecurityTLS SMTPSecurity = "tls"
+
+	// SMTPSecuritySTARTTLS requires the server to offer STARTTLS and upgrades
+	// before anything else is sent (submission, port 587).
+	SMTPSecuritySTARTTLS SMTPSecurity = "starttls"
+
+	// SMTPSecurityOpportunistic upgrades with STARTTLS when offered and
+	// continues in plaintext otherwise (MX relay, port 25). As usual for
+	// opportunistic TLS (RFC 7435) the certificate is not verified, but pins
+	// still apply. Credentials are never sent over plaintext, nor to an
+	// unverified server: with credentials this mode is SMTPSecuritySTARTTLS.
+	SMTPSecurityOpportunistic SMTPSecurity = "opportunistic"
+)
+
+// smtpServer describes where and how to submit.
+type smtpServer struct {
+	addr     string // host:port
+	auth     smtp.Auth
+	security SMTPSecurity
+
+	// pins are base64 SHA-256 hashes of acceptable SubjectPublicKeyInfos
+	// (optionally "sha256/"-prefixed); one certificate in the chain must match.
+	pins []string
+
+	// helo is the name announced in EHLO; net/smtp's "localhost" if empty.
+	helo string
+
+	// localAddr is the source address to connect from; the system chooses
+	// if nil.
+	localAddr net.Addr
+
+	// policy is the recipient domain's MTA-STS or DANE policy when delivering
+	// directly to an MX host; nil otherwise.
+	policy *mxTLSPolicy
+}
+
+// mode resolves SMTPSecurityAuto from the port.
+// A policy requiring TLS, or credentials to send, turn opportunistic into
+// required STARTTLS.
+func (s smtpServer) mode() SMTPSecurity {
+	mode := s.security
+	if mode == SMTPSecurityAuto {
+		_, port, _ := net.SplitHostPort(s.addr)
+		switch port {
+		case "465":
+			mode = SMTPSecurityTLS
+		case "25":
+			mode = SMTPSecurityOpportunistic
+		default:
+			mode = SMTPSecuritySTARTTLS
+		}
+	}
+	if mode == SMTPSecurityOpportunistic && (s.auth != nil || s.policy != nil && s.policy.require) {
+		mode = SMTPSecuritySTARTTLS
+	}
+	return mode
+}
+
+// tlsConfig returns the TLS configuration for host, with pin checking.
+func (s smtpServer) tlsConfig(host string) *tls.Config {
+	cfg := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if s.mode() == SMTPSecurityOpportunistic {
+		cfg.InsecureSkipVerify = true // see SMTPSecurityOpportunistic
+	}
+	if len(s.pins) > 0 {
+		pins := make(map[string]bool, len(s.pins))
+		for _, p := range s.pins {
+			pins[strings.TrimPrefix(p, "sha256/")] = true
+		}
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, cert := range cs.PeerCertificates {
+				sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+				if pins[base64.StdEncoding.EncodeToString(sum[:])] {
+					return nil
+				}
+			}
+			return fmt.Errorf("no certificate matches the configured public key pins")
+		}
+	}
+	if s.policy != nil {
+		s.policy.apply(cfg, host)
+	}
+	return cfg
+}
+
+// smtpSend delivers m through srv. Security follows srv.mode(); in every mode
+// auth is only attempted over TLS, so credentials are never sent in clear.
+// The context bounds the whole exchange.
+//
+// The submission adapts to the EHLO extensions: a message larger than the
+// advertised SIZE is rejected before MAIL FROM with ErrMessageTooLarge; 8-bit
+// content is declared with BODY=8BITMIME or re-rendered 7-bit when the
+// server lacks it; non-ASCII addresses need SMTPUTF8; DSN parameters are sent
+// only to servers advertising DSN.
+func smtpSend(ctx context.Context, srv smtpServer, m smtpMessage) error {
+	addr, auth, mode := srv.addr, srv.auth, srv.mode()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("smtp address %q: %w", addr, err)
+	}
+
+	var conn net.Conn
+	if mode == SMTPSecurityTLS {
+		d := tls.Dialer{NetDialer: &net.Dialer{LocalAddr: srv.localAddr}, Config: srv.tlsConfig(host)}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		d := net.Dialer{LocalAddr: srv.localAddr}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("smtp dial %s: %w", addr, err)
+	}
+	// net/smtp has no context support: bound the exchange by the context's
+	// deadline and abort it on cancellation by closing the connection.
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp greeting %s: %w", addr, ctxErr(ctx, err))
+	}
+	defer c.Close()
+	if srv.helo != "" {
+		if err := c.Hello(srv.helo); err != nil {
+			return fmt.Errorf("smtp EHLO %s: %w", addr, ctxErr(ctx, err))
+		}
+	}
+
+	if mode != SMTPSecurityTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(srv.tlsConfig(host)); err != nil {
+				return fmt.Errorf("smtp starttls %s: %w", addr, ctxErr(ctx, err))
+			}
+		} else if srv.policy != nil && srv.policy.require {
+			return fmt.Errorf("smtp %s: server does not offer STARTTLS; %s policy forbids plaintext", addr, srv.policy.source)
+		} else if mode == SMTPSecuritySTARTTLS {
+			return fmt.Errorf("smtp %s: server does not offer STARTTLS", addr)
+		}
+	}
+
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("smtp auth %s: %w", addr, ctxErr(ctx, err))
+		}
+	}
+
+	sevenBit, mailParams, err := smtpNegotiate(c, m)
+	if err != nil {
+		return fmt.Errorf("smtp %s: %w", addr, err)
+	}
+	dsn, _ := c.Extension("DSN")
+	if dsn && m.dsn != nil {
+		mailParams += m.dsn.mailParams()
+	}
+
+	// net/smtp's Mail and Rcpt take no parameters; issue the commands directly.
+	if err := smtpCmd(c, 250, "MAIL FROM:<%s>%s", m.from, mailParams); err != nil {
+		return fmt.Errorf("smtp MAIL FROM %s: %w", m.from, ctxErr(ctx, err))
+	}
+	for _, rcpt := range m.rcpts {
+		var rcptParams string
+		if dsn && m.dsn != nil {
+			rcptParams = m.dsn.rcptParams(rcpt)
+		}
+		if err := smtpCmd(c, 25, "RCPT TO:<%s>%s", rcpt, rcptParams); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s: %w", rcpt, ctxErr(ctx, err))
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", ctxErr(ctx, err))
+	}
+	if err := m.write(w, sevenBit); err != nil {
+		w.Close()
+		return fmt.Errorf("smtp DATA: %w", ctxErr(ctx, err))
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp DATA: %w", ctxErr(ctx, err))
+	}
+	// The message is accepted once DATA completes; a failed QUIT is harmless.
+	_ = c.Quit()
+	return nil
+}
+
+// smtpNegotiate picks the rendering for the server's extensions (sevenBit)
+// and returns it with the MAIL FROM parameters (SIZE, BODY, SMTPUTF8). The
+// message is streamed through a counter rather than buffered.
+func smtpNegotiate(c *smtp.Client, m smtpMessage) (bool, string, error) {
+	var params string
+
+	utf8Addrs := !isASCII(m.from)
+	for _, r := range m.rcpts {
+		utf8Addrs = utf8Addrs || !isASCII(r)
+	}
+	if utf8Addrs {
+		if ok, _ := c.Extension("SMTPUTF8"); !ok {
+			return false, "", fmt.Errorf("server does not support SMTPUTF8, required for internationalized addresses: %w", ErrUnsupported)
+		}
+		params += " SMTPUTF8"
+	}
+
+	var size countingWriter
+	if err := m.write(&size, false); err != nil {
+		return false, "", err
+	}
+	sevenBit := false
+	if size.eightBit {
+		if ok, _ := c.Extension("8BITMIME"); ok || utf8Addrs {
+			params += " BODY=8BITMIME"
+		} else {
+			sevenBit, size = true, countingWriter{}
+			if err := m.write(&size, true); err != nil {
+				return false, "", err
+			}
+		}
+	}
+
+	if ok, arg := c.Extension("SIZE"); ok {
+		if limit, err := strconv.ParseInt(strings.TrimSpace(arg), 10, 64); err == nil && limit > 0 && size.n > limit {
+			return false, "", &MessageTooLargeError{Size: size.n, Limit: limit}
+		}
+		params += " SIZE=" + strconv.FormatInt(size.n, 10)
+	}
+	return sevenBit, params, nil
+}
+
+// countingWriter counts the bytes written and notes any 8-bit byte.
+type countingWriter struct {
+	n        int64
+	eightBit bool
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.n += int64(len(p))
+	if !cw.eightBit && !isASCII(string(p)) {
+		cw.eightBit = true
+	}
+	return len(p), nil
+}
+
+// smtpCmd sends one command and checks the reply code class (expect 250 for
+// an exact code, 25 for any 25x).
+func smtpCmd(c *smtp.Client, expect int, format string, args ...any) error {
+	id, err := c.Text.Cmd(format, args...)
+	if err != nil {
+		return err
+	}
+	c.Text.StartResponse(id)
+	defer c.Text.EndResponse(id)
+	_, _, err = c.Text.ReadResponse(expect)
+	return err
+}
+
+// validate checks the DSN keywords.
+func (d *DSNOptions) validate() error {
+	for _, n := range d.Notify {
+		switch strings.ToUpper(n) {
+		case "SUCCESS", "FAILURE", "DELAY":
+		case "NEVER":
+			if len(d.Notify) > 1 {
+				return fmt.Errorf("dsn: NEVER cannot be combined with other notify values")
+			}
+		default:
+			return fmt.Errorf("dsn: invalid notify value %q", n)
+		}
+	}
+	switch strings.ToUpper(d.Return) {
+	case "", "FULL", "HDRS":
+	default:
+		return fmt.Errorf("dsn: invalid return value %q", d.Return)
+	}
+	if len(d.EnvelopeID) > 100 {
+		return fmt.Errorf("dsn: envelope id longer than 100 characters")
+	}
+	return nil
+}
+
+// mailParams renders the DSN MAIL FROM parameters (RFC 3461).
+func (d *DSNOptions) mailParams() string {
+	var p string
+	if d.Return != "" {
+		p += " RET=" + strings.ToUpper(d.Return)
+	}
+	if d.EnvelopeID != "" {
+		p += " ENVID=" + xtext(d.EnvelopeID)
+	}
+	return p
+}
+
+// rcptParams renders the DSN RCPT TO parameters for one recipient.
+func (d *DSNOptions) rcptParams(rcpt string) string {
+	var p string
+	if len(d.Notify) > 0 {
+		p += " NOTIFY=" + strings.ToUpper(strings.Join(d.Notify, ","))
+	}
+	if !isASCII(rcpt) {
+		return p + " ORCPT=utf-8;" + utf8AddrXtext(rcpt)
+	}
+	return p + " ORCPT=rfc822;" + xtext(rcpt)
+}
+
+// utf8AddrXtext encodes an internationalized address per RFC 6533 section
+// 3: UTF-8 is kept, while "+", "=", `\` and controls become `\x{XX}`.
+func utf8AddrXtext(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r <= ' ' || r == 0x7f || r == '+' || r == '=' || r == '\\' {
+			fmt.Fprintf(&b, "\\x{%X}", r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// xtext encodes s per RFC 3461 section 4: "+", "=" and characters outside
+// printable ASCII become "+XX".
+func xtext(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '!' || c > '~' || c == '+' || c == '=' {
+			fmt.Fprintf(&b, "+%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// ctxErr prefers the context's error when the context ended the exchange, so
+// callers see context.DeadlineExceeded instead of an i/o timeout.
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return errors.Join(ctx.Err(), err)
+	}
+	return err
+}
+
+// xoauth2Auth implements smtp.Auth for Google's XOAUTH2 SASL mechanism.
+type xoauth2Auth struct {
+	user, token string
+}
+
+// Start returns the XOAUTH2 initial response. Like smtp.PlainAuth it refuses
+// to send the bearer token over an unencrypted connection.
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("smtp: XOAUTH2 requires an encrypted connection")
+	}
+	resp := "user=" + a.user + "\x01auth=Bearer " + a.token + "\x01\x01"
+	return "XOAUTH2", []byte(resp), nil
+}
+
+// Next answers a server challenge. On failure Google sends a base64 JSON error
+// as a challenge and expects an empty response, after which it returns the
+// final 535 error that net/smtp surfaces.
+func (a *xoauth2Auth) Next(_ []byte, more bool) ([]byte, error) {
+	if more {
+		return []byte{}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,335 @@
+package email
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestXOAUTH2Auth(t *testing.T) {
+	a := &xoauth2Auth{user: "me@example.com", token: "ya29.token"}
+
+	if _, _, err := a.Start(&smtp.ServerInfo{Name: "smtp.gmail.com", TLS: false}); err == nil {
+		t.Error("Start over plaintext: want error, got nil")
+	}
+
+	mech, resp, err := a.Start(&smtp.ServerInfo{Name: "smtp.gmail.com", TLS: true})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if mech != "XOAUTH2" {
+		t.Errorf("mechanism = %q, want XOAUTH2", mech)
+	}
+	if want := "user=me@example.com\x01auth=Bearer ya29.token\x01\x01"; string(resp) != want {
+		t.Errorf("initial response = %q, want %q", resp, want)
+	}
+
+	// An error challenge must be answered with an empty response.
+	if next, err := a.Next([]byte(`{"status":"400"}`), true); err != nil || next == nil || len(next) != 0 {
+		t.Errorf("Next(more) = %q, %v; want empty response", next, err)
+	}
+}
+
+// fakeSMTP is a minimal plaintext SMTP server advertising the given EHLO
+// extensions. It records the commands and message data of one session.
+type fakeSMTP struct {
+	addr     string
+	commands chan []string
+	data     chan string
+}
+
+func newFakeSMTP(t *testing.T, exts ...string) *fakeSMTP {
+	t.Helper()
+	return newFakeSMTPTLS(t, nil, exts...)
+}
+
+// newFakeSMTPTLS is newFakeSMTP with STARTTLS answered using config, if
+// set; exts must then include "STARTTLS".
+func newFakeSMTPTLS(t *testing.T, config *tls.Config, exts ...string) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeSMTP{addr: ln.Addr().String(), commands: make(chan []string, 1), data: make(chan string, 1)}
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		var cmds []string
+		defer func() { f.commands <- cmds }()
+		tp.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmds = append(cmds, line)
+			switch verb := strings.ToUpper(strings.Fields(line)[0]); verb {
+			case "EHLO":
+				reply := append([]string{"fake"}, exts...)
+				for i, r := range reply {
+					sep := "-"
+					if i == len(reply)-1 {
+						sep = " "
+					}
+					tp.PrintfLine("250%s%s", sep, r)
+				}
+			case "STARTTLS":
+				tp.PrintfLine("220 ready")
+				tc := tls.Server(conn, config)
+				if tc.Handshake() != nil {
+					return
+				}
+				tp = textproto.NewConn(tc)
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				b, _ := tp.ReadDotBytes()
+				f.data <- string(b)
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("250 ok")
+			}
+		}
+	}()
+	return f
+}
+
+// server returns the submission target for f; it speaks plaintext only.
+func (f *fakeSMTP) server() smtpServer {
+	return smtpServer{addr: f.addr, security: SMTPSecurityOpportunistic}
+}
+
+func testSMTPMessage(body string) smtpMessage {
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "Grüße", Body: body}
+	return smtpMessage{
+		from:  "a@example.com",
+		rcpts: []string{"b@example.com"},
+		write: func(w io.Writer, sevenBit bool) error {
+			return writeMessage(w, msg, rawOptions{sevenBit: sevenBit})
+		},
+	}
+}
+
+func TestSMTPSendExtensions(t *testing.T) {
+	t.Run("8bitmime and dsn", func(t *testing.T) {
+		srv := newFakeSMTP(t, "8BITMIME", "DSN", "SIZE 100000")
+		m := testSMTPMessage("Grüße aus Köln")
+		m.dsn = &DSNOptions{Notify: []string{"failure", "delay"}, Return: "hdrs", EnvelopeID: "send+42"}
+		if err := smtpSend(context.Background(), srv.server(), m); err != nil {
+			t.Fatalf("smtpSend() error = %v", err)
+		}
+		data := <-srv.data
+		cmds := strings.Join(<-srv.commands, "\n")
+		for _, want := range []string{
+			"MAIL FROM:<a@example.com> BODY=8BITMIME SIZE=",
+			" RET=HDRS ENVID=send+2B42",
+			"RCPT TO:<b@example.com> NOTIFY=FAILURE,DELAY ORCPT=rfc822;b@example.com",
+		} {
+			if !strings.Contains(cmds, want) {
+				t.Errorf("commands lack %q:\n%s", want, cmds)
+			}
+		}
+		if !strings.Contains(data, "Grüße aus Köln") {
+			t.Errorf("8-bit body was re-encoded:\n%s", data)
+		}
+	})
+
+	t.Run("7bit fallback", func(t *testing.T) {
+		srv := newFakeSMTP(t)
+		m := testSMTPMessage("Grüße aus Köln")
+		m.dsn = &DSNOptions{Notify: []string{"NEVER"}}
+		if err := smtpSend(context.Background(), srv.server(), m); err != nil {
+			t.Fatalf("smtpSend() error = %v", err)
+		}
+		data := <-srv.data
+		cmds := strings.Join(<-srv.commands, "\n")
+		if strings.Contains(cmds, "BODY=") || strings.Contains(cmds, "NOTIFY=") {
+			t.Errorf("unadvertised parameters sent:\n%s", cmds)
+		}
+		if !isASCII(data) || !strings.Contains(data, "Content-Transfer-Encoding: quoted-printable") {
+			t.Errorf("body not degraded to 7-bit:\n%s", data)
+		}
+		if !strings.Contains(data, "Subject: =?utf-8?q?Gr=C3=BC=C3=9Fe?=") {
+			t.Errorf("subject not encoded:\n%s", data)
+		}
+	})
+
+	t.Run("size preflight", func(t *testing.T) {
+		srv := newFakeSMTP(t, "SIZE 100")
+		err := smtpSend(context.Background(), srv.server(), testSMTPMessage(strings.Repeat("x", 200)))
+		if !errors.Is(err, ErrMessageTooLarge) {
+			t.Fatalf("smtpSend() error = %v, want ErrMessageTooLarge", err)
+		}
+		for _, c := range <-srv.commands {
+			if strings.HasPrefix(c, "MAIL") {
+				t.Errorf("MAIL FROM sent despite size limit")
+			}
+		}
+	})
+
+	t.Run("smtputf8", func(t *testing.T) {
+		srv := newFakeSMTP(t, "SMTPUTF8", "DSN")
+		m := testSMTPMessage("body")
+		m.rcpts = []string{"用户@例子.测试"}
+		m.dsn = &DSNOptions{Notify: []string{"FAILURE"}}
+		if err := smtpSend(context.Background(), srv.server(), m); err != nil {
+			t.Fatalf("smtpSend() error = %v", err)
+		}
+		<-srv.data
+		cmds := strings.Join(<-srv.commands, "\n")
+		for _, want := range []string{"MAIL FROM:<a@example.com> SMTPUTF8", "RCPT TO:<用户@例子.测试> NOTIFY=FAILURE ORCPT=utf-8;用户@例子.测试"} {
+			if !strings.Contains(cmds, want) {
+				t.Errorf("commands lack %q:\n%s", want, cmds)
+			}
+		}
+	})
+
+	t.Run("utf8 address without smtputf8", func(t *testing.T) {
+		srv := newFakeSMTP(t, "8BITMIME")
+		m := testSMTPMessage("body")
+		m.rcpts = []string{"jörg@example.com"}
+		if err := smtpSend(context.Background(), srv.server(), m); !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("smtpSend() error = %v, want ErrUnsupported", err)
+		}
+	})
+}
+
+func TestDSNOptionsValidate(t *testing.T) {
+	tests := []struct {
+		dsn     DSNOptions
+		wantErr bool
+	}{
+		{DSNOptions{Notify: []string{"SUCCESS", "failure"}, Return: "full"}, false},
+		{DSNOptions{Notify: []string{"NEVER"}}, false},
+		{DSNOptions{Notify: []string{"NEVER", "FAILURE"}}, true},
+		{DSNOptions{Notify: []string{"SOMETIMES"}}, true},
+		{DSNOptions{Return: "BODY"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.dsn.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("validate(%+v) error = %v, wantErr %v", tt.dsn, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSMTPServerMode(t *testing.T) {
+	tests := []struct {
+		srv  smtpServer
+		want SMTPSecurity
+	}{
+		{smtpServer{addr: "smtp.gmail.com:465"}, SMTPSecurityTLS},
+		{smtpServer{addr: "smtp.gmail.com:587"}, SMTPSecuritySTARTTLS},
+		{smtpServer{addr: "mx.example.com:25"}, SMTPSecurityOpportunistic},
+		{smtpServer{addr: "relay.example.com:2525"}, SMTPSecuritySTARTTLS},
+		{smtpServer{addr: "relay.example.com:465", security: SMTPSecuritySTARTTLS}, SMTPSecuritySTARTTLS},
+	}
+	for _, tt := range tests {
+		if got := tt.srv.mode(); got != tt.want {
+			t.Errorf("mode(%s, %q) = %q, want %q", tt.srv.addr, tt.srv.security, got, tt.want)
+		}
+	}
+}
+
+func TestSMTPServerPins(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	cert := ts.Certificate()
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+
+	ok := smtpServer{addr: "relay.example.com:587", pins: []string{"sha256/" + pin}}
+	if err := ok.tlsConfig("relay.example.com").VerifyConnection(state); err != nil {
+		t.Errorf("matching pin rejected: %v", err)
+	}
+	bad := smtpServer{addr: "relay.example.com:587", pins: []string{"AAAA"}}
+	if err := bad.tlsConfig("relay.example.com").VerifyConnection(state); err == nil {
+		t.Error("mismatching pin accepted")
+	}
+	if cfg := (smtpServer{addr: "relay.example.com:587"}).tlsConfig("relay.example.com"); cfg.VerifyConnection != nil || cfg.InsecureSkipVerify {
+		t.Error("unpinned STARTTLS config must use regular verification only")
+	}
+}
+
+func TestSMTPOpportunisticAuthVerifies(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler()) // for its self-signed certificate
+	defer ts.Close()
+	srv := newFakeSMTPTLS(t, ts.TLS, "STARTTLS")
+	s := srv.server()
+	s.auth = &xoauth2Auth{user: "me@example.com", token: "ya29.token"}
+	if err := smtpSend(context.Background(), s, testSMTPMessage("body")); err == nil {
+		t.Fatal("smtpSend() with credentials accepted a self-signed certificate")
+	}
+	for _, cmd := range <-srv.commands {
+		if strings.HasPrefix(cmd, "AUTH") {
+			t.Errorf("credentials sent to an unverified server: %q", cmd)
+		}
+	}
+}
+
+func TestSMTPRequiredSTARTTLS(t *testing.T) {
+	srv := newFakeSMTP(t) // no STARTTLS offered
+	s := srv.server()
+	s.security = SMTPSecuritySTARTTLS
+	if err := smtpSend(context.Background(), s, testSMTPMessage("body")); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("smtpSend() error = %v, want STARTTLS refusal", err)
+	}
+}
+
+func TestSMTPSendStreamedAttachment(t *testing.T) {
+	srv := newFakeSMTP(t, "SIZE 100000")
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b"}
+	opens := 0
+	msg.AttachStream("data.txt", func() (io.ReadCloser, error) {
+		opens++
+		return io.NopCloser(strings.NewReader("streamed")), nil
+	})
+	m := smtpMessage{
+		from:  "a@example.com",
+		rcpts: []string{"b@example.com"},
+		write: func(w io.Writer, sevenBit bool) error {
+			return writeMessage(w, msg, rawOptions{sevenBit: sevenBit, boundary: "b1"})
+		},
+	}
+	if err := smtpSend(context.Background(), srv.server(), m); err != nil {
+		t.Fatalf("smtpSend: %v", err)
+	}
+	<-srv.data
+	var size int
+	for _, c := range <-srv.commands {
+		if strings.HasPrefix(c, "MAIL FROM:") {
+			fmt.Sscanf(c[strings.Index(c, "SIZE=")+5:], "%d", &size)
+		}
+	}
+	if opens != 2 {
+		t.Errorf("Open called %d times, want 2 (size pass and DATA)", opens)
+	}
+	raw, err := renderMessage(msg, rawOptions{boundary: "b1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != len(raw) {
+		t.Errorf("declared SIZE=%d for a %d byte message", size, len(raw))
+	}
+}
@@ -0,0 +1,51 @@
+// stats.go - Mailbox statistics for dashboards that watch shared mailboxes:
+// message and unread counts for the whole mailbox and the inbox, plus storage
+// quota where the provider reports it. Implemented by both built-in
+// providers (gmail_read.go, outlook_read.go).
+package email
+
+import "context"
+
+// MailboxStats summarizes a mailbox.
+type MailboxStats struct {
+	// Total and Unread count the messages in the whole mailbox. For Outlook
+	// they are summed over all mail folders, so a message is counted once;
+	// for Gmail they count messages, not threads.
+	Total  int64
+	Unread int64
+
+	// InboxTotal and InboxUnread count the messages in the inbox.
+	InboxTotal  int64
+	InboxUnread int64
+
+	// QuotaUsed and QuotaTotal are the mailbox storage used and allowed, in
+	// bytes. They are 0 when the provider does not report quota: the Gmail
+	// API never does, and Graph only with permission to read the user's
+	// storage settings.
+	QuotaUsed  int64
+	QuotaTotal int64
+}
+
+// StatsProvider is implemented by providers that can report mailbox
+// statistics. Both built-in providers implement it.
+type StatsProvider interface {
+	// MailboxStats returns the statistics of the configured mailbox.
+	MailboxStats(ctx context.Context) (*MailboxStats, error)
+}
+
+// MailboxStats returns message counts and quota for the configured mailbox,
+// with a default timeout.
+func (c *Client) MailboxStats() (*MailboxStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	return c.MailboxStatsWithContext(ctx)
+}
+
+// MailboxStatsWithContext is MailboxStats with a caller-supplied context.
+func (c *Client) MailboxStatsWithContext(ctx context.Context) (*MailboxStats, error) {
+	sp, ok := c.provider.(StatsProvider)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return sp.MailboxStats(ctx)
+}
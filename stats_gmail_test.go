@@ -0,0 +1,33 @@
+//go:build !email_no_gmail
+
+package email
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestGmailMailboxStats(t *testing.T) {
+	provider := newTestGmail(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/gmail/v1/users/me/profile":
+			io.WriteString(w, `{"emailAddress":"me@example.com","messagesTotal":1200,"threadsTotal":800}`)
+		case "/gmail/v1/users/me/labels/INBOX":
+			io.WriteString(w, `{"id":"INBOX","messagesTotal":300,"messagesUnread":12}`)
+		case "/gmail/v1/users/me/labels/UNREAD":
+			io.WriteString(w, `{"id":"UNREAD","messagesTotal":40}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	got, err := (&Client{provider: provider}).MailboxStats()
+	if err != nil {
+		t.Fatalf("MailboxStats() error = %v", err)
+	}
+	want := MailboxStats{Total: 1200, Unread: 40, InboxTotal: 300, InboxUnread: 12}
+	if *got != want {
+		t.Errorf("MailboxStats() = %+v, want %+v", *got, want)
+	}
+}
@@ -0,0 +1,49 @@
+//go:build !email_no_outlook
+
+package email
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestOutlookMailboxStats(t *testing.T) {
+	for _, quota := range []bool{true, false} {
+		provider := newTestOutlook(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			const user = "/v1.0/users/user@example.com"
+			switch r.URL.Path {
+			case user + "/mailFolders/msgfolderroot/childFolders":
+				io.WriteString(w, `{"value":[
+					{"id":"inbox-id","totalItemCount":300,"unreadItemCount":12,"childFolderCount":1},
+					{"id":"sent-id","totalItemCount":500,"unreadItemCount":0,"childFolderCount":0}]}`)
+			case user + "/mailFolders/inbox-id/childFolders":
+				io.WriteString(w, `{"value":[{"id":"sub-id","totalItemCount":25,"unreadItemCount":3,"childFolderCount":0}]}`)
+			case user + "/mailFolders/inbox":
+				io.WriteString(w, `{"id":"inbox-id","totalItemCount":300,"unreadItemCount":12}`)
+			case user + "/settings/storage/quota":
+				if !quota {
+					w.WriteHeader(http.StatusForbidden)
+					io.WriteString(w, `{"error":{"code":"accessDenied","message":"Access denied"}}`)
+					return
+				}
+				io.WriteString(w, `{"used":1048576,"total":53687091200}`)
+			default:
+				http.NotFound(w, r)
+			}
+		})
+		got, err := provider.MailboxStats(context.Background())
+		if err != nil {
+			t.Fatalf("MailboxStats() error = %v", err)
+		}
+		want := MailboxStats{Total: 825, Unread: 15, InboxTotal: 300, InboxUnread: 12}
+		if quota {
+			want.QuotaUsed, want.QuotaTotal = 1048576, 53687091200
+		}
+		if *got != want {
+			t.Errorf("MailboxStats(quota=%v) = %+v, want %+v", quota, *got, want)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package email
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClientMailboxStatsUnsupported(t *testing.T) {
+	if _, err := (&Client{provider: &mockProvider{}}).MailboxStats(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("MailboxStats() error = %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,399 @@
+// template.go - Named message templates. A TemplateStore holds a subject, an
+// HTML body and a plain-text body per template, parsed once with
+// text/template and html/template (which escapes data for HTML), and renders
+// them into a Message; Client.SendTemplate fills in an envelope with the
+// result and sends it. Templates come from strings (Add) or from files in
+// an fs.FS (AddFS), e.g. an embed.FS compiled into the binary. A template
+// may have variants for several locales (AddLocale, AddFSLocale); the one
+// best matching the requested locale is rendered and the message's Language
+// set from it.
+package email
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"text/template/parse"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// TemplateStore is a set of named message templates. It is safe for
+// concurrent use.
+//
+// Templates execute with missingkey=error, so a map missing a field fails
+// the send instead of mailing "<no value>" to customers.
+type TemplateStore struct {
+	funcs map[string]any
+
+	mu        sync.RWMutex
+	templates map[string]*templateVariants
+}
+
+// templateVariants are the variants of one template: the default one, if
+// any, and those for a locale, in the order they were first added.
+type templateVariants struct {
+	base      *messageTemplate
+	localized []localizedTemplate
+}
+
+// localizedTemplate is the variant of a template for one locale.
+type localizedTemplate struct {
+	tag language.Tag
+	t   *messageTemplate
+}
+
+// messageTemplate is one parsed template; html or text may be nil.
+// htmlTree is a copy of html's parse tree as parsed, which html/template
+// rewrites when it first executes, for NewTemplate's checks.
+type messageTemplate struct {
+	subject  *texttemplate.Template
+	html     *htmltemplate.Template
+	htmlTree *parse.Tree
+	text     *texttemplate.Template
+}
+
+// NewTemplateStore returns an empty store. funcs, if given, are made
+// available to every template, as with template.Funcs.
+func NewTemplateStore(funcs ...map[string]any) *TemplateStore {
+	s := &TemplateStore{funcs: make(map[string]any), templates: make(map[string]*templateVariants)}
+	for _, fm := range funcs {
+		for k, v := range fm {
+			s.funcs[k] = v
+		}
+	}
+	return s
+}
+
+// Add parses and registers the template name, replacing its default variant
+// if there is one. subject and at least one of htmlBody and textBody are required;
+// with both, the message is sent as HTML with a plain-text alternative.
+//
+// Example:
+//
+//	store := email.NewTemplateStore()
+//	err := store.Add("welcome",
+//	    "Welcome, {{.Name}}",
+//	    `<p>Hi {{.Name}}, your account is ready.</p>`,
+//	    "Hi {{.Name}}, your account is ready.")
+func (s *TemplateStore) Add(name, subject, htmlBody, textBody string) error {
+	t, err := s.parse(name, subject, htmlBody, textBody)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.variants(name).base = t
+	s.mu.Unlock()
+	return nil
+}
+
+// AddLocale is Add for the variant of the template name in locale, a BCP 47
+// tag such as "de" or "pt-BR". A template may have variants for any number
+// of locales besides, or instead of, the default one Add registers.
+//
+// Example:
+//
+//	err := store.AddLocale("welcome", "de",
+//	    "Willkommen, {{.Name}}",
+//	    `<p>Hallo {{.Name}}, Ihr Konto ist bereit.</p>`,
+//	    "Hallo {{.Name}}, Ihr Konto ist bereit.")
+func (s *TemplateStore) AddLocale(name, locale, subject, htmlBody, textBody string) error {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return fmt.Errorf("template %q: invalid locale %q: %w", name, locale, err)
+	}
+	t, err := s.parse(name, subject, htmlBody, textBody)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := s.variants(name)
+	for i := range v.localized {
+		if v.localized[i].tag == tag {
+			v.localized[i].t = t
+			return nil
+		}
+	}
+	v.localized = append(v.localized, localizedTemplate{tag: tag, t: t})
+	return nil
+}
+
+// variants returns the variants of the template name, adding it if it is
+// new. s.mu must be held.
+func (s *TemplateStore) variants(name string) *templateVariants {
+	v := s.templates[name]
+	if v == nil {
+		v = &templateVariants{}
+		s.templates[name] = v
+	}
+	return v
+}
+
+// parse parses the parts of a template.
+func (s *TemplateStore) parse(name, subject, htmlBody, textBody string) (*messageTemplate, error) {
+	if name == "" {
+		return nil, fmt.Errorf("template name is required")
+	}
+	if subject == "" {
+		return nil, fmt.Errorf("template %q: subject is required", name)
+	}
+	if htmlBody == "" && textBody == "" {
+		return nil, fmt.Errorf("template %q: an HTML or text body is required", name)
+	}
+	t := &messageTemplate{}
+	var err error
+	if t.subject, err = texttemplate.New(name + ".subject").Option("missingkey=error").Funcs(s.funcs).Parse(subject); err != nil {
+		return nil, fmt.Errorf("template %q: subject: %w", name, err)
+	}
+	if htmlBody != "" {
+		if t.html, err = htmltemplate.New(name + ".html").Option("missingkey=error").Funcs(s.funcs).Parse(htmlBody); err != nil {
+			return nil, fmt.Errorf("template %q: html body: %w", name, err)
+		}
+		t.htmlTree = t.html.Tree.Copy()
+	}
+	if textBody != "" {
+		if t.text, err = texttemplate.New(name + ".txt").Option("missingkey=error").Funcs(s.funcs).Parse(textBody); err != nil {
+			return nil, fmt.Errorf("template %q: text body: %w", name, err)
+		}
+	}
+	return t, nil
+}
+
+// Template file suffixes recognized by AddFS.
+const (
+	subjectSuffix = ".subject.tmpl"
+	htmlSuffix    = ".html.tmpl"
+	textSuffix    = ".txt.tmpl"
+)
+
+// AddFS registers the templates found in the files of fsys matching the
+// glob patterns (as fs.Glob). Each template is a group of files named after
+// it: NAME.subject.tmpl, and NAME.html.tmpl and/or NAME.txt.tmpl. Files with
+// other names are ignored.
+//
+// Example:
+//
+//	//go:embed templates
+//	var templateFS embed.FS
+//
+//	err := store.AddFS(templateFS, "templates/*.tmpl")
+func (s *TemplateStore) AddFS(fsys fs.FS, patterns ...string) error {
+	return addFS(fsys, patterns, s.Add)
+}
+
+// AddFSLocale is AddFS for the variants in locale (see AddLocale), e.g.
+// with the templates of each locale in a directory of their own:
+//
+//	err := store.AddFSLocale(templateFS, "de", "templates/de/*.tmpl")
+func (s *TemplateStore) AddFSLocale(fsys fs.FS, locale string, patterns ...string) error {
+	return addFS(fsys, patterns, func(name, subject, htmlBody, textBody string) error {
+		return s.AddLocale(name, locale, subject, htmlBody, textBody)
+	})
+}
+
+// addFS reads the templates in the files of fsys matching patterns and
+// registers them with add.
+func addFS(fsys fs.FS, patterns []string, add func(name, subject, htmlBody, textBody string) error) error {
+	type parts [3]string // subject, html, text
+	found := make(map[string]*parts)
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return err
+		}
+		for _, file := range matches {
+			base := path.Base(file)
+			var name string
+			var kind int // index into parts
+			for i, suffix := range []string{subjectSuffix, htmlSuffix, textSuffix} {
+				if n, ok := strings.CutSuffix(base, suffix); ok && n != "" {
+					name, kind = n, i
+					break
+				}
+			}
+			if name == "" {
+				continue
+			}
+			content, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				return err
+			}
+			p := found[name]
+			if p == nil {
+				p = &parts{}
+				found[name] = p
+			}
+			p[kind] = string(content)
+		}
+	}
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := found[name]
+		if err := add(name, strings.TrimSpace(p[0]), p[1], p[2]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Names returns the names of the registered templates, sorted.
+func (s *TemplateStore) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.templates))
+	for name := range s.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render executes the template name with data and returns a Message with
+// its Subject, Body, HTML and TextBody set, e.g. for previews; the envelope
+// fields are left empty. It renders the default variant, or the first
+// locale variant added if there is none. A missing template is reported as
+// ErrNotFound.
+func (s *TemplateStore) Render(name string, data any) (*Message, error) {
+	return s.RenderLocale(name, "", data)
+}
+
+// RenderLocale is Render for locale, a BCP 47 tag or an Accept-Language
+// list ("de-CH, en;q=0.8"). It renders the variant best matching locale,
+// falling back to the default variant, and sets the message's Language to
+// the variant's locale; the default variant leaves Language empty.
+//
+// Example:
+//
+//	msg, err := store.RenderLocale("welcome", user.Locale, user)
+func (s *TemplateStore) RenderLocale(name, locale string, data any) (*Message, error) {
+	s.mu.RLock()
+	v, ok := s.templates[name]
+	var t *messageTemplate
+	var tag language.Tag
+	var err error
+	if ok {
+		t, tag, err = v.pick(locale)
+	}
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("template %q: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("template %q: invalid locale %q: %w", name, locale, err)
+	}
+	msg, err := t.render(name, data)
+	if err != nil {
+		return nil, err
+	}
+	if tag != language.Und {
+		msg.Language = tag.String()
+	}
+	return msg, nil
+}
+
+// pick returns the variant to render for locale and its locale, which is
+// language.Und for the default variant.
+func (v *templateVariants) pick(locale string) (*messageTemplate, language.Tag, error) {
+	if locale != "" && len(v.localized) > 0 {
+		prefs, _, err := language.ParseAcceptLanguage(locale)
+		if err != nil {
+			return nil, language.Und, err
+		}
+		tags := make([]language.Tag, len(v.localized))
+		for i, l := range v.localized {
+			tags[i] = l.tag
+		}
+		if _, i, conf := language.NewMatcher(tags).Match(prefs...); conf != language.No {
+			return v.localized[i].t, v.localized[i].tag, nil
+		}
+	}
+	if v.base != nil {
+		return v.base, language.Und, nil
+	}
+	return v.localized[0].t, v.localized[0].tag, nil
+}
+
+// render executes t, the template name, with data.
+func (t *messageTemplate) render(name string, data any) (*Message, error) {
+	var b bytes.Buffer
+	if err := t.subject.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("template %q: subject: %w", name, err)
+	}
+	// A subject is one line; template whitespace is not meant literally.
+	msg := &Message{Subject: strings.Join(strings.Fields(b.String()), " ")}
+
+	var text string
+	if t.text != nil {
+		b.Reset()
+		if err := t.text.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("template %q: text body: %w", name, err)
+		}
+		text = b.String()
+	}
+	if t.html == nil {
+		msg.Body = text
+		return msg, nil
+	}
+	b.Reset()
+	if err := t.html.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("template %q: html body: %w", name, err)
+	}
+	msg.Body, msg.HTML, msg.TextBody = b.String(), true, text
+	return msg, nil
+}
+
+// SendTemplate renders the template name with data from the Client's
+// TemplateStore (Config.Templates) and sends it with the addresses,
+// attachments and other fields of envelope, whose Subject and bodies are
+// replaced. The template is rendered for envelope.Language (see
+// RenderLocale), and the message sent with the Language of the variant
+// rendered; the default variant keeps envelope.Language. It uses a 30
+// second timeout.
+//
+// Example:
+//
+//	err := client.SendTemplate("welcome", user, &email.Message{
+//	    From: "hello@example.com",
+//	    To:   []string{user.Email},
+//	})
+func (c *Client) SendTemplate(name string, data any, envelope *Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return c.SendTemplateWithContext(ctx, name, data, envelope)
+}
+
+// SendTemplateWithContext is SendTemplate with a caller-supplied context.
+func (c *Client) SendTemplateWithContext(ctx context.Context, name string, data any, envelope *Message) error {
+	if c.templates == nil {
+		return fmt.Errorf("template %q: no template store configured: %w", name, ErrNotFound)
+	}
+	return c.sendTemplate(ctx, c.templates, name, data, envelope)
+}
+
+// sendTemplate renders the template name of store with data and sends it
+// with the fields of envelope, as SendTemplate describes.
+func (c *Client) sendTemplate(ctx context.Context, store *TemplateStore, name string, data any, envelope *Message) error {
+	rendered, err := store.RenderLocale(name, envelope.Language, data)
+	if err != nil {
+		return err
+	}
+	msg := *envelope
+	msg.Subject, msg.Body, msg.HTML, msg.TextBody = rendered.Subject, rendered.Body, rendered.HTML, rendered.TextBody
+	if rendered.Language != "" {
+		msg.Language = rendered.Language
+	}
+	return c.SendWithContext(ctx, &msg)
+}
@@ -0,0 +1,200 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestTemplateStoreRender(t *testing.T) {
+	store := NewTemplateStore(map[string]any{"upper": strings.ToUpper})
+	if err := store.Add("welcome", "Welcome,\n  {{.Name}}", `<p>Hi {{.Name}}</p>`, "Hi {{upper .Name}}"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add("notice", "Notice", "", "Plain {{.Name}}"); err != nil {
+		t.Fatal(err)
+	}
+
+	data := map[string]string{"Name": "<Ann>"}
+	msg, err := store.Render("welcome", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Welcome, <Ann>" || !msg.HTML || msg.Body != "<p>Hi &lt;Ann&gt;</p>" || msg.TextBody != "Hi <ANN>" {
+		t.Errorf("welcome = %+v", msg)
+	}
+
+	msg, err = store.Render("notice", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.HTML || msg.Body != "Plain <Ann>" || msg.TextBody != "" {
+		t.Errorf("notice = %+v", msg)
+	}
+
+	if _, err := store.Render("welcome", map[string]string{}); err == nil {
+		t.Error("missing key: expected error")
+	}
+	if _, err := store.Render("nope", data); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown template: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestTemplateStoreAddErrors(t *testing.T) {
+	store := NewTemplateStore()
+	tests := []struct {
+		name, subject, html, text string
+	}{
+		{"", "s", "h", ""},
+		{"a", "", "h", ""},
+		{"a", "s", "", ""},
+		{"a", "{{.X", "h", ""},
+		{"a", "s", "{{if}}", ""},
+	}
+	for _, tt := range tests {
+		if err := store.Add(tt.name, tt.subject, tt.html, tt.text); err == nil {
+			t.Errorf("Add(%q, %q, %q, %q): expected error", tt.name, tt.subject, tt.html, tt.text)
+		}
+	}
+}
+
+func TestTemplateStoreAddFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"mail/reset.subject.tmpl":  {Data: []byte("Reset your password\n")},
+		"mail/reset.html.tmpl":     {Data: []byte(`<a href="{{.URL}}">Reset</a>`)},
+		"mail/reset.txt.tmpl":      {Data: []byte("Reset: {{.URL}}")},
+		"mail/digest.subject.tmpl": {Data: []byte("Your digest")},
+		"mail/digest.txt.tmpl":     {Data: []byte("{{len .}} updates")},
+		"mail/README.md":           {Data: []byte("ignored")},
+	}
+	store := NewTemplateStore()
+	if err := store.AddFS(fsys, "mail/*"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(store.Names(), ","); got != "digest,reset" {
+		t.Errorf("Names() = %s", got)
+	}
+	msg, err := store.Render("reset", map[string]string{"URL": "https://example.com/r?t=1&u=2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Reset your password" || msg.Body != `<a href="https://example.com/r?t=1&amp;u=2">Reset</a>` || msg.TextBody != "Reset: https://example.com/r?t=1&u=2" {
+		t.Errorf("reset = %+v", msg)
+	}
+
+	bad := fstest.MapFS{"x.html.tmpl": {Data: []byte("<p>no subject</p>")}}
+	if err := NewTemplateStore().AddFS(bad, "*"); err == nil {
+		t.Error("template without subject: expected error")
+	}
+}
+
+func TestTemplateStoreRenderLocale(t *testing.T) {
+	store := NewTemplateStore()
+	for _, v := range []struct{ locale, subject string }{{"", "Welcome"}, {"de", "Willkommen"}, {"pt-BR", "Bem-vindo"}} {
+		var err error
+		if v.locale == "" {
+			err = store.Add("welcome", v.subject, "", "b")
+		} else {
+			err = store.AddLocale("welcome", v.locale, v.subject, "", "b")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.AddLocale("welcome", "de", "Hallo", "", "b"); err != nil { // replaces
+		t.Fatal(err)
+	}
+	tests := []struct {
+		locale, subject, language string
+	}{
+		{"", "Welcome", ""},
+		{"de", "Hallo", "de"},
+		{"de-CH", "Hallo", "de"},
+		{"pt", "Bem-vindo", "pt-BR"},
+		{"fr-FR, de;q=0.5", "Hallo", "de"},
+		{"ja", "Welcome", ""},
+	}
+	for _, tt := range tests {
+		msg, err := store.RenderLocale("welcome", tt.locale, nil)
+		if err != nil {
+			t.Fatalf("RenderLocale(%q): %v", tt.locale, err)
+		}
+		if msg.Subject != tt.subject || msg.Language != tt.language {
+			t.Errorf("RenderLocale(%q) = %q, language %q; want %q, %q", tt.locale, msg.Subject, msg.Language, tt.subject, tt.language)
+		}
+	}
+	if _, err := store.RenderLocale("welcome", "de;q=x", nil); err == nil {
+		t.Error("invalid locale: expected error")
+	}
+	if err := store.AddLocale("welcome", "not a tag", "s", "", "b"); err == nil {
+		t.Error("AddLocale with invalid locale: expected error")
+	}
+
+	// Without a default variant, the first locale added is the fallback.
+	fsys := fstest.MapFS{
+		"fr/reset.subject.tmpl": {Data: []byte("Réinitialiser")},
+		"fr/reset.txt.tmpl":     {Data: []byte("b")},
+		"it/reset.subject.tmpl": {Data: []byte("Reimposta")},
+		"it/reset.txt.tmpl":     {Data: []byte("b")},
+	}
+	only := NewTemplateStore()
+	if err := only.AddFSLocale(fsys, "fr", "fr/*"); err != nil {
+		t.Fatal(err)
+	}
+	if err := only.AddFSLocale(fsys, "it", "it/*"); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := only.Render("reset", nil); err != nil || msg.Subject != "Réinitialiser" || msg.Language != "fr" {
+		t.Errorf("Render() = %+v, %v", msg, err)
+	}
+	if msg, err := only.RenderLocale("reset", "it-CH", nil); err != nil || msg.Subject != "Reimposta" {
+		t.Errorf("RenderLocale(it-CH) = %+v, %v", msg, err)
+	}
+}
+
+func TestClientSendTemplate(t *testing.T) {
+	store := NewTemplateStore()
+	if err := store.Add("welcome", "Welcome {{.}}", "<b>{{.}}</b>", "{{.}}"); err != nil {
+		t.Fatal(err)
+	}
+	mock := &mockProvider{}
+	c := &Client{provider: mock, templates: store}
+	envelope := &Message{From: "hello@example.com", To: []string{"ann@example.com"}, Subject: "ignored"}
+
+	if err := c.SendTemplateWithContext(context.Background(), "welcome", "Ann", envelope); err != nil {
+		t.Fatal(err)
+	}
+	if len(mock.calls) != 1 {
+		t.Fatalf("calls = %d", len(mock.calls))
+	}
+	got := mock.calls[0]
+	if got.Subject != "Welcome Ann" || got.Body != "<b>Ann</b>" || !got.HTML || got.TextBody != "Ann" || got.To[0] != "ann@example.com" {
+		t.Errorf("sent %+v", got)
+	}
+	if envelope.Subject != "ignored" {
+		t.Error("envelope was modified")
+	}
+
+	if err := store.AddLocale("welcome", "es", "Bienvenida {{.}}", "<b>{{.}}</b>", "{{.}}"); err != nil {
+		t.Fatal(err)
+	}
+	for _, lang := range []string{"es-MX", "nl"} {
+		localized := *envelope
+		localized.Language = lang
+		if err := c.SendTemplateWithContext(context.Background(), "welcome", "Ann", &localized); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := mock.calls[1]; got.Subject != "Bienvenida Ann" || got.Language != "es" {
+		t.Errorf("es-MX: sent %q, language %q", got.Subject, got.Language)
+	}
+	if got := mock.calls[2]; got.Subject != "Welcome Ann" || got.Language != "nl" {
+		t.Errorf("nl: sent %q, language %q", got.Subject, got.Language)
+	}
+
+	if err := (&Client{provider: mock}).SendTemplateWithContext(context.Background(), "welcome", "Ann", envelope); !errors.Is(err, ErrNotFound) {
+		t.Errorf("no store: err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,120 @@
+// textencoding.go - Making message text valid UTF-8 before it is sent. Text
+// that reaches Go from Java, JavaScript or Windows APIs sometimes carries
+// characters outside the Basic Multilingual Plane (emoji, rarer CJK) as
+// UTF-16 surrogate pairs encoded one half at a time (CESU-8), or as lone
+// halves. Both providers pass such bytes on as they are: Graph's JSON
+// encoder turns each byte into U+FFFD and mail clients render raw MIME as
+// "????". Clients repair the text of every message before sending it.
+package email
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// repairUTF8 returns s as valid UTF-8. Surrogate pairs encoded as two
+// three-byte sequences are joined into the character they stand for; lone
+// surrogates and other invalid bytes become U+FFFD.
+func repairUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		if hi, ok := surrogateAt(s, i); ok {
+			if lo, ok := surrogateAt(s, i+3); ok && utf16.IsSurrogate(hi) && hi < 0xDC00 && lo >= 0xDC00 {
+				b.WriteRune(utf16.DecodeRune(hi, lo))
+				i += 6
+				continue
+			}
+			b.WriteRune(utf8.RuneError)
+			i += 3
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(s[i:])
+		b.WriteRune(r) // RuneError for an invalid byte
+		i += n
+	}
+	return b.String()
+}
+
+// surrogateAt decodes the three-byte encoding of a UTF-16 surrogate
+// (U+D800 to U+DFFF) at s[i:], which utf8 rejects.
+func surrogateAt(s string, i int) (rune, bool) {
+	if i+3 > len(s) || s[i] != 0xED || s[i+1] < 0xA0 || s[i+1] > 0xBF || s[i+2] < 0x80 || s[i+2] > 0xBF {
+		return 0, false
+	}
+	return 0xD000 | rune(s[i+1]&0x3F)<<6 | rune(s[i+2]&0x3F), true
+}
+
+// repairText returns msg with its text repaired by repairUTF8: subject,
+// bodies, addresses, header values and attachment filenames. msg is
+// returned as is when it is valid already, and is never changed.
+func repairText(msg *Message) *Message {
+	if textValid(msg) {
+		return msg
+	}
+	out := *msg
+	out.From = repairUTF8(msg.From)
+	out.Subject = repairUTF8(msg.Subject)
+	out.Body = repairUTF8(msg.Body)
+	out.TextBody = repairUTF8(msg.TextBody)
+	out.To = repairAll(msg.To)
+	out.Cc = repairAll(msg.Cc)
+	out.Bcc = repairAll(msg.Bcc)
+	if msg.Headers != nil {
+		out.Headers = make(map[string]string, len(msg.Headers))
+		for k, v := range msg.Headers {
+			out.Headers[k] = repairUTF8(v)
+		}
+	}
+	if msg.Attachments != nil {
+		out.Attachments = make([]Attachment, len(msg.Attachments))
+		for i, a := range msg.Attachments {
+			a.Filename = repairUTF8(a.Filename)
+			out.Attachments[i] = a
+		}
+	}
+	return &out
+}
+
+// textValid reports whether all the text repairText covers is valid UTF-8.
+func textValid(msg *Message) bool {
+	for _, s := range []string{msg.From, msg.Subject, msg.Body, msg.TextBody} {
+		if !utf8.ValidString(s) {
+			return false
+		}
+	}
+	for _, list := range [][]string{msg.To, msg.Cc, msg.Bcc} {
+		for _, s := range list {
+			if !utf8.ValidString(s) {
+				return false
+			}
+		}
+	}
+	for _, v := range msg.Headers {
+		if !utf8.ValidString(v) {
+			return false
+		}
+	}
+	for _, a := range msg.Attachments {
+		if !utf8.ValidString(a.Filename) {
+			return false
+		}
+	}
+	return true
+}
+
+// repairAll returns addrs with every element repaired by repairUTF8.
+func repairAll(addrs []string) []string {
+	if addrs == nil {
+		return nil
+	}
+	out := make([]string, len(addrs))
+	for i, a := range addrs {
+		out[i] = repairUTF8(a)
+	}
+	return out
+}
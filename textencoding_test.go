@@ -0,0 +1,63 @@
+package email
+
+import (
+	"context"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRepairUTF8(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"valid", "Sale 🔥 für 会議", "Sale 🔥 für 会議"},
+		{"cesu-8 pair", "party \xed\xa0\xbc\xed\xbe\x89!", "party 🎉!"},
+		{"lone high surrogate", "a\xed\xa0\xbdb", "a�b"},
+		{"lone low surrogate", "a\xed\xb8\x80b", "a�b"},
+		{"reversed pair", "\xed\xbe\x89\xed\xa0\xbc", "��"},
+		{"latin-1 byte", "caf\xe9", "caf�"},
+		{"truncated sequence", "ok \xf0\x9f\x8e", "ok ���"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := repairUTF8(tt.in)
+			if got != tt.want {
+				t.Errorf("repairUTF8(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("repairUTF8(%q) is not valid UTF-8", tt.in)
+			}
+		})
+	}
+}
+
+func TestSendRepairsText(t *testing.T) {
+	mock := &mockProvider{}
+	c := &Client{provider: mock}
+	cesu := "\xed\xa0\xbd\xed\xb8\x80" // U+1F600 as a CESU-8 surrogate pair
+	msg := &Message{
+		From:        "a@example.com",
+		To:          []string{"b@example.com"},
+		Subject:     "Hi " + cesu,
+		Body:        "Body " + cesu,
+		Headers:     map[string]string{"X-Note": cesu},
+		Attachments: []Attachment{{Filename: cesu + ".txt", Content: []byte("x")}},
+	}
+	if err := c.SendWithContext(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	sent := mock.calls[0]
+	if sent.Subject != "Hi 😀" || sent.Body != "Body 😀" || sent.Headers["X-Note"] != "😀" || sent.Attachments[0].Filename != "😀.txt" {
+		t.Errorf("sent %q / %q / %q / %q", sent.Subject, sent.Body, sent.Headers["X-Note"], sent.Attachments[0].Filename)
+	}
+	if msg.Subject != "Hi "+cesu || msg.Attachments[0].Filename != cesu+".txt" {
+		t.Error("caller's message changed")
+	}
+
+	valid := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "🎉", Body: "b"}
+	if repairText(valid) != valid {
+		t.Error("valid message copied")
+	}
+}
@@ -0,0 +1,303 @@
+// typedtemplate.go - Templates bound to the type of their data. A
+// Template[T] renders a template of a TemplateStore with a T only, so a
+// caller passing the wrong data does not compile, and NewTemplate checks
+// every field the template's variants reference ({{.Order.Total}}) against
+// T, so a template referring to a renamed or missing field fails at startup
+// rather than on the first send that renders it.
+package email
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template/parse"
+)
+
+// Template is the template name of a TemplateStore, rendered with data of
+// type T. It is safe for concurrent use.
+//
+// Example:
+//
+//	type Welcome struct {
+//	    Name  string
+//	    Email string
+//	}
+//
+//	var welcome = email.MustTemplate[Welcome](store, "welcome")
+//
+//	err := welcome.RenderAndSend(client, Welcome{Name: user.Name}, &email.Message{
+//	    From: "hello@example.com",
+//	    To:   []string{user.Email},
+//	})
+type Template[T any] struct {
+	store *TemplateStore
+	name  string
+}
+
+// NewTemplate returns the template name of store, bound to T. It checks the
+// template's variants, as registered at the time, against T: each field or
+// method a variant references on its data, or on a field of it, must exist
+// on T. Data reached through maps and interfaces is not checked, nor the
+// bodies of range and with actions over such data. A missing template is
+// reported as ErrNotFound.
+func NewTemplate[T any](store *TemplateStore, name string) (*Template[T], error) {
+	store.mu.RLock()
+	v, ok := store.templates[name]
+	var variants []*messageTemplate
+	if ok {
+		if v.base != nil {
+			variants = append(variants, v.base)
+		}
+		for _, l := range v.localized {
+			variants = append(variants, l.t)
+		}
+	}
+	store.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("template %q: %w", name, ErrNotFound)
+	}
+	data := reflect.TypeOf((*T)(nil)).Elem()
+	for _, t := range variants {
+		if err := t.check(data); err != nil {
+			return nil, fmt.Errorf("template %q: %w", name, err)
+		}
+	}
+	return &Template[T]{store: store, name: name}, nil
+}
+
+// MustTemplate is NewTemplate for package-level variables: it panics on
+// error.
+func MustTemplate[T any](store *TemplateStore, name string) *Template[T] {
+	t, err := NewTemplate[T](store, name)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Name returns the template's name.
+func (t *Template[T]) Name() string { return t.name }
+
+// Render is TemplateStore.Render for data.
+func (t *Template[T]) Render(data T) (*Message, error) {
+	return t.store.RenderLocale(t.name, "", data)
+}
+
+// RenderLocale is TemplateStore.RenderLocale for data.
+func (t *Template[T]) RenderLocale(locale string, data T) (*Message, error) {
+	return t.store.RenderLocale(t.name, locale, data)
+}
+
+// RenderAndSend renders the template with data and sends it through client
+// with the fields of envelope, as Client.SendTemplate does. It uses a 30
+// second timeout.
+func (t *Template[T]) RenderAndSend(client *Client, data T, envelope *Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	return t.RenderAndSendWithContext(ctx, client, data, envelope)
+}
+
+// RenderAndSendWithContext is RenderAndSend with a caller-supplied context.
+func (t *Template[T]) RenderAndSendWithContext(ctx context.Context, client *Client, data T, envelope *Message) error {
+	return client.sendTemplate(ctx, t.store, t.name, data, envelope)
+}
+
+// check checks the fields t references on its data against data.
+func (t *messageTemplate) check(data reflect.Type) error {
+	trees := []*parse.Tree{t.subject.Tree, t.htmlTree, nil}
+	if t.text != nil {
+		trees[2] = t.text.Tree
+	}
+	for i, part := range []string{"subject", "html body", "text body"} {
+		if trees[i] == nil || trees[i].Root == nil {
+			continue
+		}
+		c := fieldChecker{root: data}
+		if err := c.node(trees[i].Root, data); err != nil {
+			return fmt.Errorf("%s: %w", part, err)
+		}
+	}
+	return nil
+}
+
+// fieldChecker walks a template's parse tree, resolving field chains
+// against the type of the data they apply to. A nil type is data whose
+// type is not known, which is not checked.
+type fieldChecker struct {
+	root reflect.Type // the type of $
+}
+
+// node checks n, evaluated with dot of type dot.
+func (c fieldChecker) node(n parse.Node, dot reflect.Type) error {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := c.node(child, dot); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		_, err := c.pipe(n.Pipe, dot)
+		return err
+	case *parse.IfNode:
+		if _, err := c.pipe(n.Pipe, dot); err != nil {
+			return err
+		}
+		return c.branch(&n.BranchNode, dot, dot)
+	case *parse.RangeNode:
+		t, err := c.pipe(n.Pipe, dot)
+		if err != nil {
+			return err
+		}
+		return c.branch(&n.BranchNode, dot, elemType(t))
+	case *parse.WithNode:
+		t, err := c.pipe(n.Pipe, dot)
+		if err != nil {
+			return err
+		}
+		return c.branch(&n.BranchNode, dot, t)
+	case *parse.TemplateNode:
+		_, err := c.pipe(n.Pipe, dot)
+		return err
+	}
+	return nil
+}
+
+// branch checks the bodies of an if, range or with action: List with dot
+// of type inner, ElseList with dot of type outer. The pipeline is checked
+// by the caller.
+func (c fieldChecker) branch(n *parse.BranchNode, outer, inner reflect.Type) error {
+	if err := c.node(n.List, inner); err != nil {
+		return err
+	}
+	if n.ElseList != nil {
+		return c.node(n.ElseList, outer)
+	}
+	return nil
+}
+
+// pipe checks the commands of p and returns the type of its value: the
+// type of its only argument when it is a lone field, variable or dot, and
+// nil (not known) when a function or method with arguments produces it.
+func (c fieldChecker) pipe(p *parse.PipeNode, dot reflect.Type) (reflect.Type, error) {
+	if p == nil {
+		return nil, nil
+	}
+	var result reflect.Type
+	for _, cmd := range p.Cmds {
+		for _, arg := range cmd.Args {
+			t, err := c.arg(arg, dot)
+			if err != nil {
+				return nil, err
+			}
+			result = t
+		}
+	}
+	if len(p.Cmds) != 1 || len(p.Cmds[0].Args) != 1 {
+		result = nil
+	}
+	return result, nil
+}
+
+// arg checks a command argument and returns the type of its value, nil if
+// it is not known.
+func (c fieldChecker) arg(n parse.Node, dot reflect.Type) (reflect.Type, error) {
+	switch n := n.(type) {
+	case *parse.DotNode:
+		return dot, nil
+	case *parse.FieldNode:
+		return resolveFields(dot, n.Ident)
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" {
+			return resolveFields(c.root, n.Ident[1:])
+		}
+	case *parse.ChainNode:
+		if p, ok := n.Node.(*parse.PipeNode); ok {
+			t, err := c.pipe(p, dot)
+			if err != nil {
+				return nil, err
+			}
+			return resolveFields(t, n.Field)
+		}
+	case *parse.PipeNode:
+		return c.pipe(n, dot)
+	}
+	return nil, nil
+}
+
+// resolveFields returns the type of the field or method chain fields on a
+// value of type t, as text/template evaluates it, or an error naming the
+// first that does not exist. Chains through maps and interfaces are not
+// known and return nil.
+func resolveFields(t reflect.Type, fields []string) (reflect.Type, error) {
+	for i, name := range fields {
+		if t == nil {
+			return nil, nil
+		}
+		if m, ok := t.MethodByName(name); ok {
+			t = methodResult(m.Type)
+			continue
+		}
+		if t.Kind() != reflect.Pointer && t.Kind() != reflect.Interface {
+			if m, ok := reflect.PointerTo(t).MethodByName(name); ok {
+				t = methodResult(m.Type)
+				continue
+			}
+		}
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			f, ok := t.FieldByName(name)
+			if !ok || !f.IsExported() {
+				return nil, fmt.Errorf("field .%s: %s has no field or method %s", strings.Join(fields[:i+1], "."), t, name)
+			}
+			t = f.Type
+		case reflect.Map:
+			t = t.Elem()
+			if t.Kind() == reflect.Interface {
+				t = nil
+			}
+		case reflect.Interface:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("field .%s: %s has no fields", strings.Join(fields[:i+1], "."), t)
+		}
+	}
+	if t != nil && t.Kind() == reflect.Interface {
+		return nil, nil
+	}
+	return t, nil
+}
+
+// methodResult returns the type of the first result of a method of type
+// m, nil if it is not known.
+func methodResult(m reflect.Type) reflect.Type {
+	if m.NumOut() == 0 {
+		return nil
+	}
+	return m.Out(0)
+}
+
+// elemType returns the type of the elements range iterates over in a value
+// of type t, nil if it is not known.
+func elemType(t reflect.Type) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+		if e := t.Elem(); e.Kind() != reflect.Interface {
+			return e
+		}
+	}
+	return nil
+}
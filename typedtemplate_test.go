@@ -0,0 +1,121 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type orderLine struct {
+	SKU   string
+	Price float64
+}
+
+type orderData struct {
+	Name     string
+	Customer *struct{ Email string }
+	Lines    []orderLine
+	Extra    map[string]any
+	Tags     map[string]orderLine
+	private  string
+}
+
+func (orderData) Total() float64      { return 0 }
+func (*orderData) Greeting() string   { return "" }
+func (o orderData) Line(i int) string { return o.Lines[i].SKU }
+
+func TestNewTemplateChecksFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject string
+		wantErr string
+	}{
+		{name: "field", subject: "{{.Name}}"},
+		{name: "pointer field", subject: "{{.Customer.Email}}"},
+		{name: "method", subject: "{{.Total}} {{.Greeting}} {{.Line 0}}"},
+		{name: "range element", subject: "{{range .Lines}}{{.SKU}} {{$.Name}}{{end}}"},
+		{name: "range with variables", subject: "{{range $i, $l := .Lines}}{{.Price}}{{end}}"},
+		{name: "with", subject: "{{with .Customer}}{{.Email}}{{else}}{{.Name}}{{end}}"},
+		{name: "map of any", subject: "{{.Extra.anything.goes}}"},
+		{name: "map of structs", subject: "{{.Tags.vip.SKU}}"},
+		{name: "function", subject: `{{printf "%s" .Name | len}}`},
+		{name: "missing", subject: "{{.Nmae}}", wantErr: "field .Nmae"},
+		{name: "unexported", subject: "{{.private}}", wantErr: "field .private"},
+		{name: "missing nested", subject: "{{.Customer.Phone}}", wantErr: "field .Customer.Phone"},
+		{name: "missing in range", subject: "{{range .Lines}}{{.Qty}}{{end}}", wantErr: "field .Qty"},
+		{name: "missing in if", subject: "{{if .Paid}}paid{{end}}", wantErr: "field .Paid"},
+		{name: "missing in map value", subject: "{{.Tags.vip.Qty}}", wantErr: "field .Tags.vip.Qty"},
+		{name: "missing via root", subject: "{{range .Lines}}{{$.Nmae}}{{end}}", wantErr: "field .Nmae"},
+		{name: "field of a string", subject: "{{.Name.First}}", wantErr: "field .Name.First"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewTemplateStore()
+			if err := store.Add("order", tt.subject, "", "body"); err != nil {
+				t.Fatal(err)
+			}
+			_, err := NewTemplate[orderData](store, "order")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("NewTemplate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewTemplate() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewTemplateChecksVariants(t *testing.T) {
+	store := NewTemplateStore()
+	if err := store.Add("order", "Order for {{.Name}}", "<p>{{.Name}}</p>", ""); err != nil {
+		t.Fatal(err)
+	}
+	// Rendering escapes the HTML template, rewriting its parse tree.
+	if _, err := store.Render("order", orderData{Name: "Ann"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTemplate[orderData](store, "order"); err != nil {
+		t.Fatalf("NewTemplate() after rendering: %v", err)
+	}
+	if err := store.AddLocale("order", "de", "Bestellung", "<p>{{.Kunde}}</p>", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTemplate[orderData](store, "order"); err == nil || !strings.Contains(err.Error(), "html body") {
+		t.Errorf("NewTemplate() with a bad de variant: error = %v", err)
+	}
+	if _, err := NewTemplate[orderData](store, "nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("NewTemplate() of a missing template: error = %v, want ErrNotFound", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("MustTemplate() did not panic")
+		}
+	}()
+	MustTemplate[orderData](store, "order")
+}
+
+func TestTemplateRenderAndSend(t *testing.T) {
+	store := NewTemplateStore()
+	if err := store.Add("order", "Order for {{.Name}}", "<p>{{range .Lines}}{{.SKU}} {{end}}</p>", ""); err != nil {
+		t.Fatal(err)
+	}
+	order := MustTemplate[orderData](store, "order")
+	mock := &mockProvider{}
+	c := &Client{provider: mock}
+
+	data := orderData{Name: "Ann", Lines: []orderLine{{SKU: "A1"}, {SKU: "B2"}}, private: "not rendered"}
+	envelope := &Message{From: "shop@example.com", To: []string{"ann@example.com"}}
+	if err := order.RenderAndSendWithContext(context.Background(), c, data, envelope); err != nil {
+		t.Fatal(err)
+	}
+	if len(mock.calls) != 1 {
+		t.Fatalf("calls = %d", len(mock.calls))
+	}
+	if got := mock.calls[0]; got.Subject != "Order for Ann" || got.Body != "<p>A1 B2 </p>" || got.To[0] != "ann@example.com" {
+		t.Errorf("sent %+v", got)
+	}
+}
@@ -0,0 +1,203 @@
+// usage.go - Send accounting for operators that bill or report email usage.
+// A UsageMeter attached via Config.Usage counts messages, recipients and
+// payload bytes per tenant/tag; the tenant and tag travel on the send context
+// (WithUsageTags) so the Message type stays free of billing concerns. Export is
+// pull-based (Snapshot/Flush) or periodic through Run.
+package email
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// UsageRecord is the accumulated usage for one tenant/tag pair over a window.
+type UsageRecord struct {
+	// Tenant and Tag identify the bucket; both are empty for untagged sends.
+	Tenant string
+	Tag    string
+
+	// Messages is the number of messages accepted by the provider.
+	Messages int64
+
+	// Failed is the number of messages the provider rejected or that errored.
+	Failed int64
+
+	// Recipients is the number of To/Cc/Bcc addresses across accepted messages.
+	Recipients int64
+
+	// Bytes is the payload volume of accepted messages: subject, body and
+	// attachment content, before transfer encoding.
+	Bytes int64
+
+	// Start, End bound the accounting window the record covers.
+	Start time.Time
+	End   time.Time
+}
+
+// usageKey identifies a usage bucket.
+type usageKey struct {
+	tenant, tag string
+}
+
+// UsageMeter accumulates per-tenant/per-tag send usage. It is safe for
+// concurrent use and may be shared by several Clients.
+type UsageMeter struct {
+	mu     sync.Mutex
+	start  time.Time
+	counts map[usageKey]*UsageRecord
+}
+
+// NewUsageMeter returns an empty meter whose window starts now.
+func NewUsageMeter() *UsageMeter {
+	return &UsageMeter{
+		start:  time.Now(),
+		counts: make(map[usageKey]*UsageRecord),
+	}
+}
+
+// usageCtxKey is the context key for usage tags.
+type usageCtxKey struct{}
+
+// WithUsageTags returns a context that attributes sends made with it to the
+// given tenant and tag in the client's UsageMeter.
+//
+// Example:
+//
+//	ctx := email.WithUsageTags(ctx, "acme", "invoice")
+//	err := client.SendWithContext(ctx, msg)
+func WithUsageTags(ctx context.Context, tenant, tag string) context.Context {
+	return context.WithValue(ctx, usageCtxKey{}, usageKey{tenant: tenant, tag: tag})
+}
+
+// record adds one send attempt to the bucket named by the context's tags.
+func (u *UsageMeter) record(ctx context.Context, msg *Message, sendErr error) {
+	key, _ := ctx.Value(usageCtxKey{}).(usageKey)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	rec, ok := u.counts[key]
+	if !ok {
+		rec = &UsageRecord{Tenant: key.tenant, Tag: key.tag}
+		u.counts[key] = rec
+	}
+	if sendErr != nil {
+		rec.Failed++
+		return
+	}
+	rec.Messages++
+	rec.Recipients += int64(len(msg.To) + len(msg.Cc) + len(msg.Bcc))
+	rec.Bytes += payloadSize(msg)
+}
+
+// Snapshot returns the current window's records, sorted by tenant then tag,
+// without resetting the meter.
+func (u *UsageMeter) Snapshot() []UsageRecord {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.snapshotLocked(time.Now())
+}
+
+// Flush returns the current window's records and starts a new, empty window.
+// Each send is therefore reported by exactly one Flush.
+func (u *UsageMeter) Flush() []UsageRecord {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	now := time.Now()
+	out := u.snapshotLocked(now)
+	u.start = now
+	u.counts = make(map[usageKey]*UsageRecord)
+	return out
+}
+
+// snapshotLocked copies the records out; the caller holds u.mu.
+func (u *UsageMeter) snapshotLocked(end time.Time) []UsageRecord {
+	out := make([]UsageRecord, 0, len(u.counts))
+	for _, rec := range u.counts {
+		r := *rec
+		r.Start, r.End = u.start, end
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Tenant != out[j].Tenant {
+			return out[i].Tenant < out[j].Tenant
+		}
+		return out[i].Tag < out[j].Tag
+	})
+	return out
+}
+
+// defaultUsageInterval is Run's interval when it is not positive.
+const defaultUsageInterval = time.Hour
+
+// Run calls export with the flushed records every interval (an hour if it
+// is not positive) until ctx is done, then performs a final flush so no
+// usage is lost on shutdown. Empty windows are not exported. Run blocks;
+// start it in its own goroutine.
+//
+// Example:
+//
+//	go meter.Run(ctx, time.Hour, func(recs []email.UsageRecord) {
+//	    billing.Push(recs)
+//	})
+func (u *UsageMeter) Run(ctx context.Context, interval time.Duration, export func([]UsageRecord)) {
+	if interval <= 0 {
+		interval = defaultUsageInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if recs := u.Flush(); len(recs) > 0 {
+				export(recs)
+			}
+			return
+		case <-ticker.C:
+			if recs := u.Flush(); len(recs) > 0 {
+				export(recs)
+			}
+		}
+	}
+}
+
+// WriteUsageCSV writes records as CSV with a header row, for billing imports.
+// Times are RFC 3339 in UTC.
+func WriteUsageCSV(w io.Writer, records []UsageRecord) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"tenant", "tag", "messages", "failed", "recipients", "bytes", "start", "end"}); err != nil {
+		return err
+	}
+	for _, r := range records {
+		row := []string{
+			r.Tenant,
+			r.Tag,
+			strconv.FormatInt(r.Messages, 10),
+			strconv.FormatInt(r.Failed, 10),
+			strconv.FormatInt(r.Recipients, 10),
+			strconv.FormatInt(r.Bytes, 10),
+			r.Start.UTC().Format(time.RFC3339),
+			r.End.UTC().Format(time.RFC3339),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// payloadSize is the unencoded size of a message's subject, body and
+// attachment content. Streamed attachments are not counted: their size is
+// only known once they are sent.
+func payloadSize(msg *Message) int64 {
+	n := int64(len(msg.Subject) + len(msg.Body) + len(msg.TextBody))
+	for _, att := range msg.Attachments {
+		n += int64(len(att.Content))
+	}
+	return n
+}
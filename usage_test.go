@@ -0,0 +1,99 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUsageMeterRecordsPerTag(t *testing.T) {
+	meter := NewUsageMeter()
+	mock := &mockProvider{}
+	c := &Client{provider: mock, usage: meter}
+
+	msg := &Message{
+		From:        "sender@example.com",
+		To:          []string{"a@example.com", "b@example.com"},
+		Cc:          []string{"c@example.com"},
+		Subject:     "Hi",
+		Body:        "Body",
+		Attachments: []Attachment{{Filename: "a.txt", Content: []byte("12345")}},
+	}
+
+	acme := WithUsageTags(context.Background(), "acme", "invoice")
+	for i := 0; i < 2; i++ {
+		if err := c.SendWithContext(acme, msg); err != nil {
+			t.Fatalf("SendWithContext: %v", err)
+		}
+	}
+	if err := c.SendWithContext(context.Background(), msg); err != nil {
+		t.Fatalf("SendWithContext: %v", err)
+	}
+	mock.sendFunc = func(context.Context, *Message) error { return errors.New("boom") }
+	_ = c.SendWithContext(acme, msg)
+
+	recs := meter.Flush()
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2: %+v", len(recs), recs)
+	}
+	untagged, tagged := recs[0], recs[1]
+	if untagged.Tenant != "" || untagged.Messages != 1 {
+		t.Errorf("untagged = %+v, want 1 message", untagged)
+	}
+	if tagged.Tenant != "acme" || tagged.Tag != "invoice" {
+		t.Fatalf("tagged bucket = %q/%q", tagged.Tenant, tagged.Tag)
+	}
+	if tagged.Messages != 2 || tagged.Failed != 1 || tagged.Recipients != 6 {
+		t.Errorf("tagged = %+v, want 2 messages, 1 failed, 6 recipients", tagged)
+	}
+	if want := int64(2 * (len("Hi") + len("Body") + 5)); tagged.Bytes != want {
+		t.Errorf("tagged.Bytes = %d, want %d", tagged.Bytes, want)
+	}
+
+	if recs := meter.Flush(); len(recs) != 0 {
+		t.Errorf("second Flush returned %d records, want 0", len(recs))
+	}
+}
+
+func TestUsageMeterSkipsInvalidMessages(t *testing.T) {
+	meter := NewUsageMeter()
+	c := &Client{provider: &mockProvider{}, usage: meter}
+	_ = c.Send(&Message{From: "sender@example.com"})
+	if recs := meter.Snapshot(); len(recs) != 0 {
+		t.Errorf("invalid message was accounted: %+v", recs)
+	}
+}
+
+func TestUsageMeterRunDefaultInterval(t *testing.T) {
+	meter := NewUsageMeter()
+	c := &Client{provider: &mockProvider{}, usage: meter}
+	if err := c.Send(&Message{From: "sender@example.com", To: []string{"a@example.com"}, Subject: "Hi", Body: "Body"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// A zero interval is defaulted rather than panicking; the final flush
+	// exports the send.
+	var exported []UsageRecord
+	meter.Run(ctx, 0, func(recs []UsageRecord) { exported = append(exported, recs...) })
+	if len(exported) != 1 || exported[0].Messages != 1 {
+		t.Errorf("exported %+v", exported)
+	}
+}
+
+func TestWriteUsageCSV(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteUsageCSV(&buf, []UsageRecord{{Tenant: "acme", Tag: "invoice", Messages: 3, Bytes: 42}})
+	if err != nil {
+		t.Fatalf("WriteUsageCSV: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	if !strings.HasPrefix(lines[1], "acme,invoice,3,0,0,42,") {
+		t.Errorf("row = %q", lines[1])
+	}
+}
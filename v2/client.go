@@ -0,0 +1,83 @@
+// Package email is version 2 of the go-email API. It sends immutable,
+// builder-constructed Messages (see Message) through the same providers
+// and configuration as version 1, which it wraps: a v2 Client is a v1
+// Client underneath, and both versions can be used side by side while
+// code migrates.
+//
+// Example:
+//
+//	client, err := email.NewClient(&v1.Config{
+//	    Provider: "gmail",
+//	    Gmail:    &v1.GmailConfig{CredentialsJSON: credentialsJSON, TokenJSON: tokenJSON},
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	msg := email.NewMessage().
+//	    From("sender@company.com").
+//	    To("recipient@example.com").
+//	    Subject("Hello").
+//	    Text("This is a test email!").
+//	    Build()
+//	err = client.Send(ctx, msg)
+package email
+
+import (
+	"context"
+
+	v1 "github.com/mariosplit/go-email"
+)
+
+// Client sends Messages. It is safe for concurrent use.
+type Client struct {
+	c *v1.Client
+}
+
+// NewClient creates a client from a v1 configuration.
+func NewClient(config *v1.Config) (*Client, error) {
+	c, err := v1.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{c: c}, nil
+}
+
+// Wrap returns a v2 client sending through an existing v1 client.
+func Wrap(c *v1.Client) *Client {
+	return &Client{c: c}
+}
+
+// V1 returns the underlying v1 client, for the operations v2 does not
+// cover yet (reading mail, calendars, statistics, ...).
+func (c *Client) V1() *v1.Client {
+	return c.c
+}
+
+// Send sends msg. The send is bounded by ctx only; pass v1.WithTimeout for
+// a timeout of its own.
+func (c *Client) Send(ctx context.Context, msg *Message, opts ...v1.SendOption) error {
+	return c.c.SendWithContext(ctx, msg.send(), opts...)
+}
+
+// SendWithResult is Send, returning the sent message's identifiers.
+func (c *Client) SendWithResult(ctx context.Context, msg *Message, opts ...v1.SendOption) (*v1.SendResult, error) {
+	return c.c.SendWithResultContext(ctx, msg.send(), opts...)
+}
+
+// SendBatch sends msgs as the batch id (see v1 Client.SendBatch). The same
+// *Message may appear more than once.
+func (c *Client) SendBatch(ctx context.Context, id string, msgs []*Message) (*v1.BatchReport, error) {
+	b := &v1.Batch{ID: id, Messages: make([]*v1.Message, len(msgs))}
+	for i, m := range msgs {
+		b.Messages[i] = m.send()
+	}
+	return c.c.SendBatchWithContext(ctx, b)
+}
+
+// send returns the v1 message handed to the v1 client. The v1 send path
+// copies a message before changing it and never writes through its slices
+// or maps, so they are shared rather than copied.
+func (m *Message) send() *v1.Message {
+	out := m.m
+	return &out
+}
@@ -0,0 +1,302 @@
+// message.go - The immutable Message of the v2 API. A v1 Message is a
+// struct of exported fields passed by pointer, so a message reused across
+// goroutines (a batch template, a retried send) can be changed under a send
+// in progress. A v2 Message is built once with a MessageBuilder and cannot
+// be changed afterwards: its fields are read through accessors that return
+// copies, and variations are built from it with Builder.
+package email
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	v1 "github.com/mariosplit/go-email"
+)
+
+// Message is an immutable email message. Build one with NewMessage; the
+// zero Message is empty. A *Message may be shared and sent from any number
+// of goroutines.
+type Message struct {
+	m v1.Message
+}
+
+// MessageBuilder constructs a Message. Its methods set a field and return
+// the builder for chaining; Build returns the message. A MessageBuilder is
+// not safe for concurrent use, but the messages it builds are independent
+// of it and of each other.
+//
+// Example:
+//
+//	msg := email.NewMessage().
+//	    From("sender@company.com").
+//	    To("recipient@example.com").
+//	    Subject("Hello").
+//	    Text("This is a test email!").
+//	    Build()
+type MessageBuilder struct {
+	m v1.Message
+}
+
+// NewMessage returns a builder for a new message.
+func NewMessage() *MessageBuilder {
+	return &MessageBuilder{}
+}
+
+// From sets the sender's address.
+func (b *MessageBuilder) From(addr string) *MessageBuilder {
+	b.m.From = addr
+	return b
+}
+
+// To adds primary recipients.
+func (b *MessageBuilder) To(addrs ...string) *MessageBuilder {
+	b.m.To = append(b.m.To, addrs...)
+	return b
+}
+
+// Cc adds carbon copy recipients.
+func (b *MessageBuilder) Cc(addrs ...string) *MessageBuilder {
+	b.m.Cc = append(b.m.Cc, addrs...)
+	return b
+}
+
+// Bcc adds blind carbon copy recipients.
+func (b *MessageBuilder) Bcc(addrs ...string) *MessageBuilder {
+	b.m.Bcc = append(b.m.Bcc, addrs...)
+	return b
+}
+
+// Subject sets the subject line.
+func (b *MessageBuilder) Subject(subject string) *MessageBuilder {
+	b.m.Subject = subject
+	return b
+}
+
+// Text sets a plain-text body, replacing any HTML body.
+func (b *MessageBuilder) Text(body string) *MessageBuilder {
+	b.m.Body, b.m.HTML, b.m.TextBody = body, false, ""
+	return b
+}
+
+// HTML sets an HTML body with an optional plain-text alternative (see
+// v1 Message.TextBody), replacing any plain-text body.
+func (b *MessageBuilder) HTML(body, text string) *MessageBuilder {
+	b.m.Body, b.m.HTML, b.m.TextBody = body, true, text
+	return b
+}
+
+// Attach adds an attachment. Its content is copied when the message is
+// built.
+func (b *MessageBuilder) Attach(a v1.Attachment) *MessageBuilder {
+	b.m.Attachments = append(b.m.Attachments, a)
+	return b
+}
+
+// Header sets a custom header field (see v1 Message.Headers).
+func (b *MessageBuilder) Header(name, value string) *MessageBuilder {
+	if b.m.Headers == nil {
+		b.m.Headers = make(map[string]string)
+	}
+	b.m.Headers[name] = value
+	return b
+}
+
+// Priority sets the message's importance.
+func (b *MessageBuilder) Priority(p v1.Priority) *MessageBuilder {
+	b.m.Priority = p
+	return b
+}
+
+// Sensitivity marks the message as personal, private or confidential.
+func (b *MessageBuilder) Sensitivity(s v1.Sensitivity) *MessageBuilder {
+	b.m.Sensitivity = s
+	return b
+}
+
+// Language sets the language of the content, a BCP 47 tag such as "de".
+func (b *MessageBuilder) Language(tag string) *MessageBuilder {
+	b.m.Language = tag
+	return b
+}
+
+// SendAt schedules the message for later delivery.
+func (b *MessageBuilder) SendAt(t time.Time) *MessageBuilder {
+	b.m.SendAt = t
+	return b
+}
+
+// Labels adds labels applied to the sent message (Gmail).
+func (b *MessageBuilder) Labels(labels ...string) *MessageBuilder {
+	b.m.Labels = append(b.m.Labels, labels...)
+	return b
+}
+
+// SentFolder sets the folder the sent copy is filed into (Outlook 365).
+func (b *MessageBuilder) SentFolder(folder string) *MessageBuilder {
+	b.m.SentFolder = folder
+	return b
+}
+
+// SaveToSent sets whether a copy is kept in Sent Items (see v1
+// Message.SaveToSent).
+func (b *MessageBuilder) SaveToSent(save bool) *MessageBuilder {
+	b.m.SaveToSent = &save
+	return b
+}
+
+// DSN requests delivery status notifications for SMTP submissions.
+func (b *MessageBuilder) DSN(opts v1.DSNOptions) *MessageBuilder {
+	b.m.DSN = &opts
+	return b
+}
+
+// IPPool selects the outbound IP pool (direct delivery).
+func (b *MessageBuilder) IPPool(pool string) *MessageBuilder {
+	b.m.IPPool = pool
+	return b
+}
+
+// MIMELayout sets the multipart structure of the rendered message.
+func (b *MessageBuilder) MIMELayout(layout v1.MIMELayout) *MessageBuilder {
+	b.m.MIMELayout = layout
+	return b
+}
+
+// Build returns the message. It is not validated until it is sent; call
+// Validate to check it earlier. The builder can go on to build further
+// messages.
+func (b *MessageBuilder) Build() *Message {
+	return &Message{m: *clone(&b.m)}
+}
+
+// Builder returns a builder preset with the message's fields, to build a
+// variation of it. The message itself is not changed.
+//
+// Example:
+//
+//	reminder := invoice.Builder().Subject("Reminder: " + invoice.Subject()).Build()
+func (m *Message) Builder() *MessageBuilder {
+	return &MessageBuilder{m: *clone(&m.m)}
+}
+
+// FromV1 returns an immutable copy of a v1 message.
+func FromV1(msg *v1.Message) *Message {
+	return &Message{m: *clone(msg)}
+}
+
+// V1 returns a copy of the message as a v1 Message, for APIs that take
+// one. Changing the copy does not change m.
+func (m *Message) V1() *v1.Message {
+	return clone(&m.m)
+}
+
+// Validate checks the message as v1 Message.Validate does.
+func (m *Message) Validate() error {
+	return m.m.Validate()
+}
+
+// From returns the sender's address.
+func (m *Message) From() string { return m.m.From }
+
+// To returns the primary recipients.
+func (m *Message) To() []string { return slices.Clone(m.m.To) }
+
+// Cc returns the carbon copy recipients.
+func (m *Message) Cc() []string { return slices.Clone(m.m.Cc) }
+
+// Bcc returns the blind carbon copy recipients.
+func (m *Message) Bcc() []string { return slices.Clone(m.m.Bcc) }
+
+// Subject returns the subject line.
+func (m *Message) Subject() string { return m.m.Subject }
+
+// Body returns the body and whether it is HTML.
+func (m *Message) Body() (body string, html bool) { return m.m.Body, m.m.HTML }
+
+// TextBody returns the plain-text alternative of an HTML body.
+func (m *Message) TextBody() string { return m.m.TextBody }
+
+// Attachments returns copies of the attachments.
+func (m *Message) Attachments() []v1.Attachment { return cloneAttachments(m.m.Attachments) }
+
+// Headers returns a copy of the custom header fields.
+func (m *Message) Headers() map[string]string { return maps.Clone(m.m.Headers) }
+
+// Priority returns the message's importance.
+func (m *Message) Priority() v1.Priority { return m.m.Priority }
+
+// Sensitivity returns the message's sensitivity.
+func (m *Message) Sensitivity() v1.Sensitivity { return m.m.Sensitivity }
+
+// Language returns the language of the content.
+func (m *Message) Language() string { return m.m.Language }
+
+// SendAt returns when the message is scheduled to be sent.
+func (m *Message) SendAt() time.Time { return m.m.SendAt }
+
+// Labels returns the labels applied to the sent message.
+func (m *Message) Labels() []string { return slices.Clone(m.m.Labels) }
+
+// SentFolder returns the folder the sent copy is filed into.
+func (m *Message) SentFolder() string { return m.m.SentFolder }
+
+// SaveToSent returns whether a copy is kept in Sent Items, and false for ok
+// when the client default applies.
+func (m *Message) SaveToSent() (save, ok bool) {
+	if m.m.SaveToSent == nil {
+		return false, false
+	}
+	return *m.m.SaveToSent, true
+}
+
+// DSN returns the delivery status notification request, if any.
+func (m *Message) DSN() (v1.DSNOptions, bool) {
+	if m.m.DSN == nil {
+		return v1.DSNOptions{}, false
+	}
+	return *m.m.DSN, true
+}
+
+// IPPool returns the outbound IP pool.
+func (m *Message) IPPool() string { return m.m.IPPool }
+
+// MIMELayout returns the multipart structure of the rendered message.
+func (m *Message) MIMELayout() v1.MIMELayout { return m.m.MIMELayout }
+
+// clone returns a deep copy of msg: nothing reachable from the copy is
+// shared with msg.
+func clone(msg *v1.Message) *v1.Message {
+	out := *msg
+	out.To = slices.Clone(msg.To)
+	out.Cc = slices.Clone(msg.Cc)
+	out.Bcc = slices.Clone(msg.Bcc)
+	out.Labels = slices.Clone(msg.Labels)
+	out.Attachments = cloneAttachments(msg.Attachments)
+	out.Headers = maps.Clone(msg.Headers)
+	if msg.DSN != nil {
+		dsn := *msg.DSN
+		dsn.Notify = slices.Clone(msg.DSN.Notify)
+		out.DSN = &dsn
+	}
+	if msg.SaveToSent != nil {
+		save := *msg.SaveToSent
+		out.SaveToSent = &save
+	}
+	return &out
+}
+
+// cloneAttachments returns a deep copy of attachments. Streamed content
+// (Attachment.Open) is not copied; Open must return the same content on
+// every call anyway.
+func cloneAttachments(attachments []v1.Attachment) []v1.Attachment {
+	if attachments == nil {
+		return nil
+	}
+	out := make([]v1.Attachment, len(attachments))
+	for i, a := range attachments {
+		a.Content = slices.Clone(a.Content)
+		out[i] = a
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package email
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	v1 "github.com/mariosplit/go-email"
+)
+
+func TestMessageImmutable(t *testing.T) {
+	content := []byte("report")
+	b := NewMessage().
+		From("a@example.com").
+		To("b@example.com").
+		Subject("s").
+		HTML("<p>hi</p>", "hi").
+		Header("X-Campaign", "c1").
+		Attach(v1.Attachment{Filename: "r.txt", Content: content})
+	msg := b.Build()
+
+	// Changing the builder, the inputs or the returned values leaves the
+	// message alone.
+	b.To("c@example.com").Header("X-Campaign", "c2")
+	content[0] = 'X'
+	msg.To()[0] = "x@example.com"
+	msg.Headers()["X-Campaign"] = "c3"
+	msg.Attachments()[0].Content[0] = 'Y'
+	msg.V1().Subject = "changed"
+
+	if got := msg.To(); !reflect.DeepEqual(got, []string{"b@example.com"}) {
+		t.Errorf("To() = %v", got)
+	}
+	if got := msg.Headers()["X-Campaign"]; got != "c1" {
+		t.Errorf("X-Campaign = %q", got)
+	}
+	if got := string(msg.Attachments()[0].Content); got != "report" {
+		t.Errorf("attachment content = %q", got)
+	}
+	if body, html := msg.Body(); body != "<p>hi</p>" || !html || msg.TextBody() != "hi" || msg.Subject() != "s" {
+		t.Errorf("Body() = %q, %v", body, html)
+	}
+
+	variant := msg.Builder().Subject("Re: s").Build()
+	if variant.Subject() != "Re: s" || msg.Subject() != "s" || variant.From() != "a@example.com" {
+		t.Errorf("variant subject %q, original %q", variant.Subject(), msg.Subject())
+	}
+	if err := msg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+func TestClientSendShared(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"m1"}`)
+	}))
+	defer srv.Close()
+	c, err := NewClient(&v1.Config{Provider: "gmail", Gmail: &v1.GmailConfig{
+		CredentialsJSON: []byte(`{"installed":{"client_id":"id","client_secret":"secret","token_uri":"https://oauth2.googleapis.com/token","redirect_uris":["http://localhost"]}}`),
+		TokenJSON:       []byte(`{"access_token":"tok","token_type":"Bearer","expiry":"2999-01-01T00:00:00Z"}`),
+		BaseURL:         srv.URL + "/",
+		HTTPClient:      srv.Client(),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := NewMessage().From("a@example.com").To("b@example.com").Subject("s").Text("b").Build()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Send(context.Background(), msg, v1.WithPriority(v1.PriorityHigh)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	report, err := c.SendBatch(context.Background(), "b", []*Message{msg, msg})
+	if err != nil || report.Sent != 2 {
+		t.Fatalf("SendBatch() = %+v, %v", report, err)
+	}
+	if len(bodies) != 10 || msg.Priority() != "" {
+		t.Errorf("sent %d messages, priority %q", len(bodies), msg.Priority())
+	}
+}
@@ -4,20 +4,24 @@ package email
 // Version information
 const (
 	// Version is the current version of the go-email package
-	Version = "v1.3.2"
+	Version = "v1.4.0"
 
 	// VersionMajor is the major version number
 	VersionMajor = 1
 
 	// VersionMinor is the minor version number
-	VersionMinor = 3
+	VersionMinor = 4
 
 	// VersionPatch is the patch version number
-	VersionPatch = 2
+	VersionPatch = 0
 
 	// VersionPreRelease is the pre-release version identifier
 	VersionPreRelease = ""
+)
 
+// Build information, set during build with
+// -ldflags "-X github.com/mariosplit/go-email.GitCommit=$(git rev-parse HEAD)"
+var (
 	// BuildDate is the date the binary was built (set during build)
 	BuildDate = ""
 
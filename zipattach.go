@@ -0,0 +1,111 @@
+// zipattach.go - Automatic zipping of large attachments. A message whose
+// attachments together exceed a threshold gets them bundled into a single
+// zip archive, under their original names, so that it stays under the
+// provider's size limit and arrives as one download. Inline attachments,
+// which the HTML body references, are never zipped.
+package email
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// AttachmentZip configures automatic zipping of attachments.
+//
+// Example:
+//
+//	config.ZipAttachments = &email.AttachmentZip{Threshold: 10 << 20}
+type AttachmentZip struct {
+	// Threshold is the total size in bytes of a message's attachments above
+	// which they are zipped.
+	Threshold int64
+
+	// Filename names the zip archive. Defaults to "attachments.zip".
+	Filename string
+}
+
+// defaultZipFilename names the archive when AttachmentZip.Filename is empty.
+const defaultZipFilename = "attachments.zip"
+
+func (z *AttachmentZip) validate() error {
+	if z.Threshold <= 0 {
+		return fmt.Errorf("invalid attachment zip: threshold must be positive")
+	}
+	if strings.ContainsAny(z.Filename, "/\\") {
+		return fmt.Errorf("invalid attachment zip: filename %q contains a path separator", z.Filename)
+	}
+	return nil
+}
+
+// apply returns msg with its attachments zipped if they exceed the
+// threshold, and msg itself otherwise. Only attachments held in memory
+// count and are zipped: streamed ones (Attachment.Open) are sent as they
+// are, so that large files are not read into memory.
+func (z *AttachmentZip) apply(msg *Message) (*Message, error) {
+	var total int64
+	var zipped, kept []Attachment
+	for _, a := range msg.Attachments {
+		if a.Inline || a.Open != nil {
+			kept = append(kept, a)
+			continue
+		}
+		total += int64(len(a.Content))
+		zipped = append(zipped, a)
+	}
+	if total <= z.Threshold || len(zipped) == 0 {
+		return msg, nil
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	names := make(map[string]bool)
+	for i, a := range zipped {
+		f, err := w.Create(uniqueZipName(zipEntryName(a.Filename, i), names))
+		if err != nil {
+			return nil, fmt.Errorf("zip attachments: %w", err)
+		}
+		if _, err := f.Write(a.Content); err != nil {
+			return nil, fmt.Errorf("zip attachments: %w", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("zip attachments: %w", err)
+	}
+
+	name := z.Filename
+	if name == "" {
+		name = defaultZipFilename
+	}
+	out := *msg
+	out.Attachments = append([]Attachment{{
+		Filename: name,
+		Content:  buf.Bytes(),
+		MimeType: "application/zip",
+	}}, kept...)
+	return &out, nil
+}
+
+// zipEntryName returns the archive name of the i-th zipped attachment: its
+// filename without any directory, which a zip entry must not escape to.
+func zipEntryName(filename string, i int) string {
+	name := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		return fmt.Sprintf("attachment%d", i+1)
+	}
+	return name
+}
+
+// uniqueZipName returns name, or name numbered "report (2).pdf" if an
+// earlier entry in seen has it, and records the result in seen.
+func uniqueZipName(name string, seen map[string]bool) string {
+	unique := name
+	ext := path.Ext(name)
+	for n := 2; seen[strings.ToLower(unique)]; n++ {
+		unique = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+	}
+	seen[strings.ToLower(unique)] = true
+	return unique
+}
@@ -0,0 +1,68 @@
+package email
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestAttachmentZip(t *testing.T) {
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b", HTML: true,
+		Attachments: []Attachment{
+			{Filename: "report.pdf", Content: bytes.Repeat([]byte("a"), 600)},
+			{Filename: "logo.png", Content: []byte("png"), Inline: true, ContentID: "logo"},
+			{Filename: "dir/report.pdf", Content: bytes.Repeat([]byte("b"), 600)},
+			{Filename: "big.csv", Open: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(nil)), nil }},
+		}}
+
+	z := &AttachmentZip{Threshold: 1000}
+	got, err := z.apply(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Attachments) != 4 {
+		t.Error("apply modified the message")
+	}
+	var names []string
+	for _, a := range got.Attachments {
+		names = append(names, a.Filename)
+	}
+	if want := []string{"attachments.zip", "logo.png", "big.csv"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("attachments = %v, want %v", names, want)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(got.Attachments[0].Content), int64(len(got.Attachments[0].Content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []string
+	for _, f := range zr.File {
+		entries = append(entries, f.Name)
+	}
+	if want := []string{"report.pdf", "report (2).pdf"}; !reflect.DeepEqual(entries, want) {
+		t.Errorf("zip entries = %v, want %v", entries, want)
+	}
+
+	if same, _ := (&AttachmentZip{Threshold: 1200}).apply(msg); same != msg {
+		t.Error("attachments at the threshold were zipped")
+	}
+	if err := (&AttachmentZip{}).validate(); err == nil {
+		t.Error("zero threshold accepted")
+	}
+}
+
+func TestClientZipAttachments(t *testing.T) {
+	mock := &mockProvider{}
+	c := &Client{provider: mock, zip: &AttachmentZip{Threshold: 10, Filename: "files.zip"}}
+	msg := &Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "s", Body: "b",
+		Attachments: []Attachment{{Filename: "a.txt", Content: []byte("0123456789ab")}}}
+	if err := c.SendWithContext(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if sent := mock.calls[0].Attachments; len(sent) != 1 || sent[0].Filename != "files.zip" || sent[0].MimeType != "application/zip" {
+		t.Errorf("sent attachments = %+v", sent)
+	}
+}